@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/util"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/jessevdk/go-flags"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultDataDirname = "data"
+	defaultFormat      = "json"
+	defaultNumOrders   = 100
+)
+
+var (
+	defaultHomeDir = util.AppDataDir("qitmeerd", false)
+	defaultDataDir = filepath.Join(defaultHomeDir, defaultDataDirname)
+	defaultDbType  = "ffldb"
+	defaultDAGType = "phantom"
+)
+
+type Config struct {
+	HomeDir string `short:"A" long:"appdata" description:"Path to application home directory"`
+	DataDir string `short:"b" long:"datadir" description:"Directory to store data"`
+	TestNet bool   `long:"testnet" description:"Use the test network"`
+	MixNet  bool   `long:"mixnet" description:"Use the test mix pow network"`
+	PrivNet bool   `long:"privnet" description:"Use the private network"`
+	DbType  string `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	DAGType string `short:"G" long:"dagtype" description:"DAG type {phantom,conflux,spectre} "`
+	Start   int64  `short:"s" long:"start" description:"The first order to export, the default is 100 orders before the end"`
+	End     int64  `short:"e" long:"end" description:"The last order to export, the default is the main chain tip"`
+	Format  string `short:"f" long:"format" description:"Output format {json,dot}"`
+	Fixture string `long:"fixture" description:"Put the json blocks under this name, as the blocks data of core/blockdag/testData.json"`
+	Output  string `short:"o" long:"output" description:"Output file, the default is the standard output"`
+}
+
+// LoadConfig initializes and parses the config using command line options.
+func LoadConfig() (*Config, error) {
+	// Default config.
+	cfg := Config{
+		HomeDir: defaultHomeDir,
+		DataDir: defaultDataDir,
+		DbType:  defaultDbType,
+		DAGType: defaultDAGType,
+		Start:   -1,
+		End:     -1,
+		Format:  defaultFormat,
+	}
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		return nil, err
+	}
+
+	// Update the data directory when only the home directory is specified.
+	if cfg.HomeDir != defaultHomeDir && cfg.DataDir == defaultDataDir {
+		cfg.HomeDir, _ = filepath.Abs(cfg.HomeDir)
+		cfg.DataDir = filepath.Join(cfg.HomeDir, defaultDataDirname)
+	}
+
+	// assign active network params while we're at it
+	numNets := 0
+	if cfg.TestNet {
+		numNets++
+		params.ActiveNetParams = &params.TestNetParam
+	}
+	if cfg.PrivNet {
+		numNets++
+		params.ActiveNetParams = &params.PrivNetParam
+	}
+	if cfg.MixNet {
+		numNets++
+		params.ActiveNetParams = &params.MixNetParam
+	}
+	if numNets == 0 {
+		params.ActiveNetParams = &params.MainNetParam
+	}
+	// Multiple networks can't be selected simultaneously.
+	if numNets > 1 {
+		return nil, fmt.Errorf("loadConfig: the testnet, mixnet and privnet " +
+			"params can't be used together -- choose one of the three")
+	}
+
+	if cfg.Format != "json" && cfg.Format != "dot" {
+		return nil, fmt.Errorf("loadConfig: unknown format %s, use json or dot", cfg.Format)
+	}
+	if cfg.Fixture != "" && cfg.Format != "json" {
+		return nil, fmt.Errorf("loadConfig: a fixture is exported as json")
+	}
+
+	cfg.DataDir = util.CleanAndExpandPath(cfg.DataDir)
+	cfg.DataDir = filepath.Join(cfg.DataDir, params.ActiveNetParams.Name)
+	return &cfg, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/services/mining"
+	"io"
+	"os"
+)
+
+func main() {
+	if err := export(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func export() error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Load the block database.
+	db, err := LoadBlockDB(cfg)
+	if err != nil {
+		return fmt.Errorf("load block database: %v", err)
+	}
+	defer db.Close()
+
+	bc, err := blockchain.New(&blockchain.Config{
+		DB:           db,
+		ChainParams:  params.ActiveNetParams.Params,
+		TimeSource:   blockchain.NewMedianTime(),
+		DAGType:      cfg.DAGType,
+		BlockVersion: mining.BlockVersion(params.ActiveNetParams.Params.Net),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The default range is the last orders of the main chain.
+	bd := bc.BlockDAG()
+	end := cfg.End
+	if end < 0 {
+		end = int64(bd.GetMainChainTip().GetOrder())
+	}
+	start := cfg.Start
+	if start < 0 {
+		start = end - defaultNumOrders + 1
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start > end {
+		return fmt.Errorf("The start order %d is after the end order %d", start, end)
+	}
+	blocks, err := bd.Export(uint(start), uint(end))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if cfg.Output != "" {
+		f, err := os.Create(cfg.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if cfg.Format == "dot" {
+		return blockdag.WriteDot(w, blocks)
+	}
+	var data interface{} = blocks
+	if cfg.Fixture != "" {
+		data = map[string]interface{}{cfg.Fixture: blocks}
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/params"
+	"path/filepath"
+)
+
+const (
+	// blockDbNamePrefix is the prefix for the block database name.  The
+	// database type is appended to this value to form the full block
+	// database name.
+	blockDbNamePrefix = "blocks"
+)
+
+// LoadBlockDB opens the block database of the selected database backend and
+// network, it must have been created by qitmeerd.
+func LoadBlockDB(cfg *Config) (database.DB, error) {
+	// The database name is based on the database type.
+	dbName := blockDbNamePrefix + "_" + cfg.DbType
+	dbPath := filepath.Join(cfg.DataDir, dbName)
+
+	log.Info("Loading block database", "dbPath", dbPath)
+	db, err := database.Open(cfg.DbType, dbPath, params.ActiveNetParams.Net)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Block database loaded")
+	return db, nil
+}
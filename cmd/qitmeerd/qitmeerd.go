@@ -101,6 +101,14 @@ func qitmeerdMain(nodeChan chan<- *node.Node) error {
 
 		return nil
 	}
+	if cfg.DropCFIndex {
+		if err := index.DropCfIndex(db, interrupt); err != nil {
+			log.Error(fmt.Sprintf("%v", err))
+			return err
+		}
+
+		return nil
+	}
 
 	// Cleanup the block database
 	if cfg.Cleanup {
@@ -40,6 +40,17 @@ _qx()
         tx-decode
         tx-encode
         tx-sign
+        tx-fee
+        multisig-new
+        tx-sign-multisig
+        tx-combine
+        tx-multisig-status
+        psbt-create
+        psbt-update
+        psbt-sign
+        psbt-combine
+        psbt-finalize
+        psbt-decode
         msg-sign
         msg-verify
         compact-to-uint64
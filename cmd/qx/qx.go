@@ -77,6 +77,17 @@ addr & tx & sign
     tx-encode             encode a unsigned transaction.
     tx-decode             decode a transaction in base16 to json format.
     tx-sign               sign a transactions using a private key.
+    tx-fee                calculate the fee of a transaction at a fee rate.
+    multisig-new          create a m-of-n multisig redeem script and its P2SH address.
+    tx-sign-multisig      add the signatures of a private key to a P2SH multisig transaction.
+    tx-combine            combine the signatures of partially signed P2SH multisig transactions.
+    tx-multisig-status    show the signatures still missing from a P2SH multisig transaction.
+    psbt-create           create a partially signed transaction from an unsigned transaction.
+    psbt-update           add the utxo, redeem script or bip32 path of an input or an output to a psbt.
+    psbt-sign             sign the inputs of a psbt using a private key.
+    psbt-combine          combine several psbt of the same transaction.
+    psbt-finalize         finalize the signed inputs of a psbt and extract the signed transaction.
+    psbt-decode           decode a psbt to json format.
     msg-sign              create a message signature
     msg-verify            validate a message signature
     signature-decode      decode a ECDSA signature
@@ -129,6 +140,14 @@ var txOutputs qx.TxOutputsFlag
 var txVersion qx.TxVersionFlag
 var txLockTime qx.TxLockTimeFlag
 var privateKey string
+var txFeeRate int64
+var multisigRequired int
+var redeemScript string
+var psbtInput int
+var psbtOutput int
+var psbtUtxo string
+var psbtDerivation string
+var psbtExtract bool
 var msgSignatureMode string
 
 func main() {
@@ -411,6 +430,81 @@ MEER is the 64 bit spend amount in qitmeer.`)
 	}
 	txSignCmd.StringVar(&privateKey, "k", "", "the ec private key to sign the raw transaction")
 
+	txFeeCmd := flag.NewFlagSet("tx-fee", flag.ExitOnError)
+	txFeeCmd.Usage = func() {
+		cmdUsage(txFeeCmd, "Usage: qx tx-fee [-r fee_rate] [raw_tx_base16_string] \n")
+	}
+	txFeeCmd.Int64Var(&txFeeRate, "r", 10000, "the fee rate in atoms per kilobyte, e.g. the result of the estimateFee RPC")
+
+	multisigNewCmd := flag.NewFlagSet("multisig-new", flag.ExitOnError)
+	multisigNewCmd.Usage = func() {
+		cmdUsage(multisigNewCmd, "Usage: qx multisig-new [-m required] [-n network] [ec_public_key...] \n")
+	}
+	multisigNewCmd.IntVar(&multisigRequired, "m", 1, "the number of signatures required to spend")
+	multisigNewCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	txSignMultisigCmd := flag.NewFlagSet("tx-sign-multisig", flag.ExitOnError)
+	txSignMultisigCmd.Usage = func() {
+		cmdUsage(txSignMultisigCmd, "Usage: qx tx-sign-multisig [-k private_key] [-s redeem_script] [-n network] [raw_tx_base16_string] \n")
+	}
+	txSignMultisigCmd.StringVar(&privateKey, "k", "", "the ec private key to sign the raw transaction")
+	txSignMultisigCmd.StringVar(&redeemScript, "s", "", "the multisig redeem script spent by every input")
+	txSignMultisigCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	txCombineCmd := flag.NewFlagSet("tx-combine", flag.ExitOnError)
+	txCombineCmd.Usage = func() {
+		cmdUsage(txCombineCmd, "Usage: qx tx-combine [-s redeem_script] [-n network] [raw_tx_base16_string...] \n")
+	}
+	txCombineCmd.StringVar(&redeemScript, "s", "", "the multisig redeem script spent by every input")
+	txCombineCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	txMultisigStatusCmd := flag.NewFlagSet("tx-multisig-status", flag.ExitOnError)
+	txMultisigStatusCmd.Usage = func() {
+		cmdUsage(txMultisigStatusCmd, "Usage: qx tx-multisig-status [-s redeem_script] [-n network] [raw_tx_base16_string] \n")
+	}
+	txMultisigStatusCmd.StringVar(&redeemScript, "s", "", "the multisig redeem script spent by every input")
+	txMultisigStatusCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	psbtCreateCmd := flag.NewFlagSet("psbt-create", flag.ExitOnError)
+	psbtCreateCmd.Usage = func() {
+		cmdUsage(psbtCreateCmd, "Usage: qx psbt-create [raw_tx_base16_string] \n")
+	}
+
+	psbtUpdateCmd := flag.NewFlagSet("psbt-update", flag.ExitOnError)
+	psbtUpdateCmd.Usage = func() {
+		cmdUsage(psbtUpdateCmd, "Usage: qx psbt-update [-i input_index | -o output_index] [-u utxo] [-s redeem_script] [-d bip32_derivation] [psbt_base64_string] \n")
+	}
+	psbtUpdateCmd.IntVar(&psbtInput, "i", -1, "the index of the input to update")
+	psbtUpdateCmd.IntVar(&psbtOutput, "o", -1, "the index of the output to update")
+	psbtUpdateCmd.StringVar(&psbtUtxo, "u", "", "the output spent by the input encoded as AMOUNT:PKSCRIPT, the amount in atoms")
+	psbtUpdateCmd.StringVar(&redeemScript, "s", "", "the redeem script of the P2SH output spent by the input or paid by the output")
+	psbtUpdateCmd.StringVar(&psbtDerivation, "d", "", "the bip32 derivation of a key encoded as PUBKEY:FINGERPRINT:PATH, e.g. 02...:0a1b2c3d:m/44'/0'/0'/0/1")
+
+	psbtSignCmd := flag.NewFlagSet("psbt-sign", flag.ExitOnError)
+	psbtSignCmd.Usage = func() {
+		cmdUsage(psbtSignCmd, "Usage: qx psbt-sign [-k private_key] [-n network] [psbt_base64_string] \n")
+	}
+	psbtSignCmd.StringVar(&privateKey, "k", "", "the ec private key to sign the psbt")
+	psbtSignCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	psbtCombineCmd := flag.NewFlagSet("psbt-combine", flag.ExitOnError)
+	psbtCombineCmd.Usage = func() {
+		cmdUsage(psbtCombineCmd, "Usage: qx psbt-combine [psbt_base64_string...] \n")
+	}
+
+	psbtFinalizeCmd := flag.NewFlagSet("psbt-finalize", flag.ExitOnError)
+	psbtFinalizeCmd.Usage = func() {
+		cmdUsage(psbtFinalizeCmd, "Usage: qx psbt-finalize [-x] [-n network] [psbt_base64_string] \n")
+	}
+	psbtFinalizeCmd.BoolVar(&psbtExtract, "x", true, "extract the signed raw transaction once every input is finalized")
+	psbtFinalizeCmd.StringVar(&network, "n", "testnet", "the target network. (mainnet, testnet, privnet, mixnet)")
+
+	psbtDecodeCmd := flag.NewFlagSet("psbt-decode", flag.ExitOnError)
+	psbtDecodeCmd.Usage = func() {
+		cmdUsage(psbtDecodeCmd, "Usage: qx psbt-decode [-n network] [psbt_base64_string] \n")
+	}
+	psbtDecodeCmd.StringVar(&network, "n", "testnet", "decode psbt for the target network. (mainnet, testnet, privnet, mixnet)")
+
 	msgSignCmd := flag.NewFlagSet("msg-sign", flag.ExitOnError)
 	msgSignCmd.Usage = func() {
 		cmdUsage(msgSignCmd, "Usage: msg-sign [wif] [message] \n")
@@ -466,6 +560,17 @@ MEER is the 64 bit spend amount in qitmeer.`)
 		txEncodeCmd,
 		txDecodeCmd,
 		txSignCmd,
+		txFeeCmd,
+		multisigNewCmd,
+		txSignMultisigCmd,
+		txCombineCmd,
+		txMultisigStatusCmd,
+		psbtCreateCmd,
+		psbtUpdateCmd,
+		psbtSignCmd,
+		psbtCombineCmd,
+		psbtFinalizeCmd,
+		psbtDecodeCmd,
 		msgSignCmd,
 		msgVerifyCmd,
 	}
@@ -1291,6 +1396,192 @@ MEER is the 64 bit spend amount in qitmeer.`)
 		}
 	}
 
+	if txFeeCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				txFeeCmd.Usage()
+			} else {
+				qx.TxFeeSTDO(os.Args[len(os.Args)-1], txFeeRate)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.TxFeeSTDO(str, txFeeRate)
+		}
+	}
+
+	if multisigNewCmd.Parsed() {
+		if multisigNewCmd.NArg() == 0 || multisigNewCmd.Arg(0) == "help" || multisigNewCmd.Arg(0) == "--help" {
+			multisigNewCmd.Usage()
+		} else {
+			qx.MultisigNewSTDO(multisigRequired, multisigNewCmd.Args(), network)
+		}
+	}
+
+	if txSignMultisigCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				txSignMultisigCmd.Usage()
+			} else {
+				qx.TxSignMultisigSTDO(privateKey, redeemScript, os.Args[len(os.Args)-1], network)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.TxSignMultisigSTDO(privateKey, redeemScript, str, network)
+		}
+	}
+
+	if txCombineCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if txCombineCmd.NArg() == 0 || txCombineCmd.Arg(0) == "help" || txCombineCmd.Arg(0) == "--help" {
+				txCombineCmd.Usage()
+			} else {
+				qx.TxCombineSTDO(redeemScript, txCombineCmd.Args(), network)
+			}
+		} else { //try from STDIN, one transaction per line
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			qx.TxCombineSTDO(redeemScript, strings.Fields(string(src)), network)
+		}
+	}
+
+	if txMultisigStatusCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				txMultisigStatusCmd.Usage()
+			} else {
+				qx.TxMultisigStatusSTDO(redeemScript, os.Args[len(os.Args)-1], network)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.TxMultisigStatusSTDO(redeemScript, str, network)
+		}
+	}
+
+	if psbtCreateCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				psbtCreateCmd.Usage()
+			} else {
+				qx.PsbtCreateSTDO(os.Args[len(os.Args)-1])
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.PsbtCreateSTDO(str)
+		}
+	}
+
+	if psbtUpdateCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				psbtUpdateCmd.Usage()
+			} else {
+				qx.PsbtUpdateSTDO(os.Args[len(os.Args)-1], psbtInput, psbtOutput, psbtUtxo, redeemScript, psbtDerivation)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.PsbtUpdateSTDO(str, psbtInput, psbtOutput, psbtUtxo, redeemScript, psbtDerivation)
+		}
+	}
+
+	if psbtSignCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				psbtSignCmd.Usage()
+			} else {
+				qx.PsbtSignSTDO(privateKey, os.Args[len(os.Args)-1], network)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.PsbtSignSTDO(privateKey, str, network)
+		}
+	}
+
+	if psbtCombineCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if psbtCombineCmd.NArg() == 0 || psbtCombineCmd.Arg(0) == "help" || psbtCombineCmd.Arg(0) == "--help" {
+				psbtCombineCmd.Usage()
+			} else {
+				qx.PsbtCombineSTDO(psbtCombineCmd.Args())
+			}
+		} else { //try from STDIN, one psbt per line
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			qx.PsbtCombineSTDO(strings.Fields(string(src)))
+		}
+	}
+
+	if psbtFinalizeCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				psbtFinalizeCmd.Usage()
+			} else {
+				qx.PsbtFinalizeSTDO(os.Args[len(os.Args)-1], network, psbtExtract)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.PsbtFinalizeSTDO(str, network, psbtExtract)
+		}
+	}
+
+	if psbtDecodeCmd.Parsed() {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
+				psbtDecodeCmd.Usage()
+			} else {
+				qx.PsbtDecodeSTDO(os.Args[len(os.Args)-1], network)
+			}
+		} else { //try from STDIN
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				errExit(err)
+			}
+			str := strings.TrimSpace(string(src))
+			qx.PsbtDecodeSTDO(str, network)
+		}
+	}
+
 	if msgSignCmd.Parsed() {
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeNamedPipe) == 0 {
@@ -2,6 +2,7 @@ package marshal
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/psbt"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
 	"github.com/Qitmeer/qitmeer/params"
@@ -138,6 +140,9 @@ func MarshJsonVout(tx *types.Transaction, filterAddrMap map[string]struct{}, par
 		var vout json.Vout
 		voutSPK := &vout.ScriptPubKey
 		vout.Amount = v.Amount
+		if !v.Asset.IsMeer() {
+			vout.Asset = v.Asset.String()
+		}
 		voutSPK.Addresses = encodedAddrs
 		voutSPK.Asm = disbuf
 		voutSPK.Hex = hex.EncodeToString(v.PkScript)
@@ -149,6 +154,101 @@ func MarshJsonVout(tx *types.Transaction, filterAddrMap map[string]struct{}, par
 	return voutList
 }
 
+// MarshJsonPsbt converts the given partially signed transaction to the RPC
+// output, reporting the number of signatures every input is still missing.
+func MarshJsonPsbt(p *psbt.Packet, params *params.Params) *json.DecodePsbtResult {
+	tx := p.UnsignedTx
+	result := &json.DecodePsbtResult{
+		Tx: json.OrderedResult{
+			{Key: "txid", Val: tx.TxHash().String()},
+			{Key: "version", Val: int32(tx.Version)},
+			{Key: "txtype", Val: types.DetermineTxType(tx).String()},
+			{Key: "locktime", Val: tx.LockTime},
+			{Key: "timestamp", Val: tx.Timestamp.Format(time.RFC3339)},
+			{Key: "vin", Val: MarshJsonVin(tx)},
+			{Key: "vout", Val: MarshJsonVout(tx, nil, params)},
+		},
+		Unknown:  marshJsonUnknowns(p.Unknowns),
+		Inputs:   make([]json.PsbtInputResult, len(p.Inputs)),
+		Outputs:  make([]json.PsbtOutputResult, len(p.Outputs)),
+		Complete: p.IsComplete(),
+	}
+	if fee, err := p.Fee(); err == nil {
+		result.Fee = &fee
+	}
+
+	for i, in := range p.Inputs {
+		inResult := &result.Inputs[i]
+		if in.Utxo != nil {
+			utxoTx := &types.Transaction{TxOut: []*types.TxOutput{in.Utxo}}
+			inResult.Utxo = &MarshJsonVout(utxoTx, nil, params)[0]
+		}
+		if len(in.PartialSigs) > 0 {
+			inResult.PartialSigs = make(map[string]string)
+			for _, sig := range in.PartialSigs {
+				inResult.PartialSigs[hex.EncodeToString(sig.PubKey)] =
+					hex.EncodeToString(sig.Signature)
+			}
+		}
+		inResult.SighashType = uint32(in.SighashType)
+		inResult.RedeemScript = marshJsonScript(in.RedeemScript)
+		inResult.Bip32Derivs = marshJsonBip32Derivations(in.Bip32Derivation)
+		inResult.FinalScriptSig = marshJsonScript(in.FinalScriptSig)
+		inResult.MissingSigs, _ = p.MissingSigs(i, params)
+		inResult.Unknown = marshJsonUnknowns(in.Unknowns)
+	}
+	for i, out := range p.Outputs {
+		outResult := &result.Outputs[i]
+		outResult.RedeemScript = marshJsonScript(out.RedeemScript)
+		outResult.Bip32Derivs = marshJsonBip32Derivations(out.Bip32Derivation)
+		outResult.Unknown = marshJsonUnknowns(out.Unknowns)
+	}
+	return result
+}
+
+func marshJsonScript(script []byte) *json.ScriptSig {
+	if script == nil {
+		return nil
+	}
+	// The disassembled string will contain [error] inline if the script
+	// doesn't fully parse, so ignore the error here.
+	disbuf, _ := txscript.DisasmString(script)
+	return &json.ScriptSig{Asm: disbuf, Hex: hex.EncodeToString(script)}
+}
+
+func marshJsonBip32Derivations(derivations []*psbt.Bip32Derivation) []json.Bip32DerivationResult {
+	results := make([]json.Bip32DerivationResult, 0, len(derivations))
+	for _, d := range derivations {
+		path := "m"
+		for _, index := range d.Path {
+			if index >= 0x80000000 {
+				path += fmt.Sprintf("/%d'", index-0x80000000)
+			} else {
+				path += fmt.Sprintf("/%d", index)
+			}
+		}
+		var fingerprint [4]byte
+		binary.LittleEndian.PutUint32(fingerprint[:], d.Fingerprint)
+		results = append(results, json.Bip32DerivationResult{
+			PubKey:            hex.EncodeToString(d.PubKey),
+			MasterFingerprint: hex.EncodeToString(fingerprint[:]),
+			Path:              path,
+		})
+	}
+	return results
+}
+
+func marshJsonUnknowns(unknowns []*psbt.Unknown) map[string]string {
+	if len(unknowns) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(unknowns))
+	for _, u := range unknowns {
+		result[hex.EncodeToString(u.Key)] = hex.EncodeToString(u.Value)
+	}
+	return result
+}
+
 // RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
 // returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
 // transaction hashes.
@@ -43,7 +43,7 @@ func (a *ProxiedAddr) Network() string {
 }
 
 func (a *ProxiedAddr) String() string {
-	return fmt.Sprintf("%s:%d", a.Host, a.Port)
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
 }
 
 type proxiedConn struct {
@@ -160,104 +160,45 @@ func (p *Proxy) dial(network, addr string, timeout time.Duration) (net.Conn, err
 	if err != nil {
 		return nil, err
 	}
-
-	conn, err := net.DialTimeout("tcp", p.Addr, timeout)
-	if err != nil {
-		return nil, err
-	}
-
-	var user, pass string
-	if p.TorIsolation {
-		var b [16]byte
-		_, err := io.ReadFull(rand.Reader, b[:])
-		if err != nil {
-			conn.Close()
-			return nil, err
-		}
-		user = hex.EncodeToString(b[0:8])
-		pass = hex.EncodeToString(b[8:16])
-	} else {
-		user = p.Username
-		pass = p.Password
-	}
-	buf := make([]byte, 32+len(host)+len(user)+len(pass))
-
-	// Initial greeting
-	buf[0] = protocolVersion
-	if user != "" {
-		buf = buf[:4]
-		buf[1] = 2 // num auth methods
-		buf[2] = authNone
-		buf[3] = authUsernamePassword
-	} else {
-		buf = buf[:3]
-		buf[1] = 1 // num auth methods
-		buf[2] = authNone
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host name %s is too long", host)
 	}
 
-	_, err = conn.Write(buf)
+	conn, err := net.DialTimeout("tcp", p.Addr, timeout)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
-
-	// Server's auth choice
-
-	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
-		conn.Close()
-		return nil, err
-	}
-	if buf[0] != protocolVersion {
-		conn.Close()
-		return nil, ErrInvalidProxyResponse
-	}
-	err = nil
-	switch buf[1] {
-	default:
-		err = ErrInvalidProxyResponse
-	case authUnavailable:
-		err = ErrNoAcceptableAuthMethod
-	case authGssApi:
-		err = ErrNoAcceptableAuthMethod
-	case authUsernamePassword:
-		buf = buf[:3+len(user)+len(pass)]
-		buf[0] = 1 // version
-		buf[1] = byte(len(user))
-		copy(buf[2:], user)
-		buf[2+len(user)] = byte(len(pass))
-		copy(buf[3+len(user):], pass)
-		if _, err = conn.Write(buf); err != nil {
-			conn.Close()
-			return nil, err
-		}
-		if _, err = io.ReadFull(conn, buf[:2]); err != nil {
-			conn.Close()
-			return nil, err
-		}
-		if buf[0] != 1 { // version
-			err = ErrInvalidProxyResponse
-		} else if buf[1] != 0 { // 0 = succes, else auth failed
-			err = ErrAuthFailed
-		}
-	case authNone:
-		// Do nothing
+	// The proxy may be slow to set up the connection, such as tor building
+	// a circuit, bound the whole handshake by the timeout.
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
 	}
-	if err != nil {
+	if err := p.authenticate(conn); err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	// Command / connection request
+	// Command / connection request, the buffer has room for the longest
+	// domain of the response.  The host names are sent as is, so that the
+	// proxy resolves them and no lookup leaks to the local resolver.
 
-	buf = buf[:7+len(host)]
+	buf := make([]byte, 4, 7+255)
 	buf[0] = protocolVersion
 	buf[1] = commandTcpConnect
 	buf[2] = 0 // reserved
-	buf[3] = addressTypeDomain
-	buf[4] = byte(len(host))
-	copy(buf[5:], host)
-	buf[5+len(host)] = byte(port >> 8)
-	buf[6+len(host)] = byte(port & 0xff)
+	if ip := net.ParseIP(host); ip == nil {
+		buf[3] = addressTypeDomain
+		buf = append(buf, byte(len(host)))
+		buf = append(buf, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		buf[3] = addressTypeIPv4
+		buf = append(buf, ip4...)
+	} else {
+		buf[3] = addressTypeIPv6
+		buf = append(buf, ip.To16()...)
+	}
+	buf = append(buf, byte(port>>8), byte(port&0xff))
 	if _, err := conn.Write(buf); err != nil {
 		conn.Close()
 		return nil, err
@@ -295,13 +236,13 @@ func (p *Proxy) dial(network, addr string, timeout time.Duration) (net.Conn, err
 			conn.Close()
 			return nil, err
 		}
-		paddr.Host = net.IP(buf).String()
+		paddr.Host = net.IP(buf[:4]).String()
 	case addressTypeIPv6:
 		if _, err := io.ReadFull(conn, buf[:16]); err != nil {
 			conn.Close()
 			return nil, err
 		}
-		paddr.Host = net.IP(buf).String()
+		paddr.Host = net.IP(buf[:16]).String()
 	case addressTypeDomain:
 		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
 			conn.Close()
@@ -327,3 +268,79 @@ func (p *Proxy) dial(network, addr string, timeout time.Duration) (net.Conn, err
 		remoteAddr: &ProxiedAddr{network, host, port},
 	}, nil
 }
+
+// authenticate greets the proxy and authenticates with the credentials, or
+// with random credentials when tor stream isolation is enabled.
+func (p *Proxy) authenticate(conn net.Conn) error {
+	var user, pass string
+	if p.TorIsolation {
+		var b [16]byte
+		_, err := io.ReadFull(rand.Reader, b[:])
+		if err != nil {
+			return err
+		}
+		user = hex.EncodeToString(b[0:8])
+		pass = hex.EncodeToString(b[8:16])
+	} else {
+		user = p.Username
+		pass = p.Password
+	}
+	buf := make([]byte, 32+len(user)+len(pass))
+
+	// Initial greeting
+	buf[0] = protocolVersion
+	if user != "" {
+		buf = buf[:4]
+		buf[1] = 2 // num auth methods
+		buf[2] = authNone
+		buf[3] = authUsernamePassword
+	} else {
+		buf = buf[:3]
+		buf[1] = 1 // num auth methods
+		buf[2] = authNone
+	}
+
+	_, err := conn.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	// Server's auth choice
+
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return err
+	}
+	if buf[0] != protocolVersion {
+		return ErrInvalidProxyResponse
+	}
+	err = nil
+	switch buf[1] {
+	default:
+		err = ErrInvalidProxyResponse
+	case authUnavailable:
+		err = ErrNoAcceptableAuthMethod
+	case authGssApi:
+		err = ErrNoAcceptableAuthMethod
+	case authUsernamePassword:
+		buf = buf[:3+len(user)+len(pass)]
+		buf[0] = 1 // version
+		buf[1] = byte(len(user))
+		copy(buf[2:], user)
+		buf[2+len(user)] = byte(len(pass))
+		copy(buf[3+len(user):], pass)
+		if _, err = conn.Write(buf); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, buf[:2]); err != nil {
+			return err
+		}
+		if buf[0] != 1 { // version
+			err = ErrInvalidProxyResponse
+		} else if buf[1] != 0 { // 0 = succes, else auth failed
+			err = ErrAuthFailed
+		}
+	case authNone:
+		// Do nothing
+	}
+	return err
+}
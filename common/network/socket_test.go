@@ -0,0 +1,220 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// socksRequest is a connect request received by the test SOCKS5 server.
+type socksRequest struct {
+	user     string
+	pass     string
+	addrType byte
+	host     string
+	port     int
+}
+
+// socksServer is a SOCKS5 server which records the connect requests and
+// answers them with its status.
+type socksServer struct {
+	listener net.Listener
+	status   byte
+	requests chan socksRequest
+}
+
+func newSocksServer(t *testing.T, status byte) *socksServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{
+		listener: listener,
+		status:   status,
+		requests: make(chan socksRequest, 10),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var req socksRequest
+	buf := make([]byte, 256)
+
+	// Greeting, the credentials are used when they are offered.
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	methods := buf[:buf[1]]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(authNone)
+	for _, m := range methods {
+		if m == authUsernamePassword {
+			method = authUsernamePassword
+		}
+	}
+	conn.Write([]byte{protocolVersion, method})
+	if method == authUsernamePassword {
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		user := make([]byte, buf[1])
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		pass := make([]byte, buf[0])
+		if _, err := io.ReadFull(conn, pass); err != nil {
+			return
+		}
+		req.user, req.pass = string(user), string(pass)
+		conn.Write([]byte{1, 0})
+	}
+
+	// Connect request.
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	req.addrType = buf[3]
+	switch req.addrType {
+	case addressTypeIPv4:
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		req.host = net.IP(buf[:4]).String()
+	case addressTypeIPv6:
+		if _, err := io.ReadFull(conn, buf[:16]); err != nil {
+			return
+		}
+		req.host = net.IP(buf[:16]).String()
+	case addressTypeDomain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		host := make([]byte, buf[0])
+		if _, err := io.ReadFull(conn, host); err != nil {
+			return
+		}
+		req.host = string(host)
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	req.port = int(buf[0])<<8 | int(buf[1])
+	s.requests <- req
+
+	conn.Write([]byte{protocolVersion, s.status, 0, addressTypeIPv4,
+		10, 0, 0, 1, 0x1f, 0xba})
+	io.Copy(ioutil.Discard, conn)
+}
+
+func (s *socksServer) request(t *testing.T) socksRequest {
+	select {
+	case req := <-s.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received by the proxy")
+	}
+	return socksRequest{}
+}
+
+func Test_ProxyDial(t *testing.T) {
+	s := newSocksServer(t, statusRequestGranted)
+	defer s.listener.Close()
+
+	tests := []struct {
+		addr     string
+		addrType byte
+		host     string
+	}{
+		// The host names are resolved by the proxy.
+		{"seed.example.com:8130", addressTypeDomain, "seed.example.com"},
+		{"expyuzz4wqqyqhjn.onion:18130", addressTypeDomain, "expyuzz4wqqyqhjn.onion"},
+		{"1.2.3.4:8130", addressTypeIPv4, "1.2.3.4"},
+		{"[2001:db8::1]:8130", addressTypeIPv6, "2001:db8::1"},
+	}
+	proxy := &Proxy{Addr: s.listener.Addr().String()}
+	for _, test := range tests {
+		conn, err := proxy.DialTimeout("tcp", test.addr, 5*time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", test.addr, err)
+		}
+		req := s.request(t)
+		if req.addrType != test.addrType || req.host != test.host {
+			t.Fatalf("%s: proxy got address type %d and host %s", test.addr,
+				req.addrType, req.host)
+		}
+		if conn.RemoteAddr().String() != test.addr {
+			t.Fatalf("%s: remote address %s", test.addr, conn.RemoteAddr())
+		}
+		if conn.LocalAddr().String() != "10.0.0.1:8122" {
+			t.Fatalf("%s: bound address %s", test.addr, conn.LocalAddr())
+		}
+		conn.Close()
+	}
+}
+
+func Test_ProxyAuth(t *testing.T) {
+	s := newSocksServer(t, statusRequestGranted)
+	defer s.listener.Close()
+
+	proxy := &Proxy{Addr: s.listener.Addr().String(), Username: "user", Password: "pass"}
+	conn, err := proxy.Dial("tcp", "1.2.3.4:8130")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if req := s.request(t); req.user != "user" || req.pass != "pass" {
+		t.Fatalf("proxy got credentials %s:%s", req.user, req.pass)
+	}
+
+	// Tor stream isolation uses new random credentials for each
+	// connection.
+	proxy.TorIsolation = true
+	users := make(map[string]struct{})
+	for i := 0; i < 2; i++ {
+		conn, err := proxy.Dial("tcp", "1.2.3.4:8130")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		req := s.request(t)
+		if req.user == "user" || req.user == "" {
+			t.Fatalf("proxy got credentials %s:%s", req.user, req.pass)
+		}
+		users[req.user] = struct{}{}
+	}
+	if len(users) != 2 {
+		t.Fatal("isolated connections used the same credentials")
+	}
+}
+
+func Test_ProxyRefused(t *testing.T) {
+	s := newSocksServer(t, statusHostUnreachable)
+	defer s.listener.Close()
+
+	proxy := &Proxy{Addr: s.listener.Addr().String()}
+	_, err := proxy.Dial("tcp", "seed.example.com:8130")
+	if err != statusErrors[statusHostUnreachable] {
+		t.Fatalf("got error %v, want %v", err, statusErrors[statusHostUnreachable])
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+const (
+	// OnionSuffix ends the host names of the tor hidden services.
+	OnionSuffix = ".onion"
+
+	// onionV2Len is the length of the host of a version 2 hidden service,
+	// the base32 of the 10 bytes hash of its key.
+	onionV2Len = 16
+
+	// onionV3Len is the length of the host of a version 3 hidden service,
+	// the base32 of its 32 bytes ed25519 key, a 2 bytes checksum and the
+	// version.
+	onionV3Len = 56
+
+	// onionV3Version is the last byte of the version 3 addresses.
+	onionV3Version = 3
+)
+
+// onionV3ChecksumTag prefixes the data hashed into the checksum of a version 3
+// address.
+var onionV3ChecksumTag = []byte(".onion checksum")
+
+// OnionCatPrefix starts the IPv6 addresses which the version 2 hidden services
+// are mapped to, the range used by OnionCat (fd87:d87e:eb43::/48).  The 10
+// bytes hash of the key of the service follow the prefix.
+var OnionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// IsOnionHost returns whether the host is the address of a tor hidden service.
+func IsOnionHost(host string) bool {
+	return strings.HasSuffix(strings.ToLower(host), OnionSuffix)
+}
+
+// ParseOnionHost returns the version of the hidden service of the passed
+// host, 2 or 3, and the data it encodes: the hash of the key of a version 2
+// service, or the key of a version 3 service.  The checksum of the version 3
+// addresses is verified.
+func ParseOnionHost(host string) (int, []byte, error) {
+	if !IsOnionHost(host) {
+		return 0, nil, fmt.Errorf("%s is not an onion address", host)
+	}
+	name := strings.ToUpper(host[:len(host)-len(OnionSuffix)])
+	switch len(name) {
+	case onionV2Len:
+		data, err := base32.StdEncoding.DecodeString(name)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid onion address %s: %v", host, err)
+		}
+		return 2, data, nil
+
+	case onionV3Len:
+		data, err := base32.StdEncoding.DecodeString(name)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid onion address %s: %v", host, err)
+		}
+		pubKey, checksum, version := data[:32], data[32:34], data[34]
+		if version != onionV3Version {
+			return 0, nil, fmt.Errorf("invalid onion address %s: version %d",
+				host, version)
+		}
+		if !bytes.Equal(checksum, onionV3Checksum(pubKey)) {
+			return 0, nil, fmt.Errorf("invalid onion address %s: bad checksum", host)
+		}
+		return 3, pubKey, nil
+	}
+	return 0, nil, fmt.Errorf("invalid onion address %s: bad length", host)
+}
+
+// OnionV3Host returns the host of the version 3 hidden service of the passed
+// ed25519 public key.
+func OnionV3Host(pubKey []byte) string {
+	data := make([]byte, 0, 35)
+	data = append(data, pubKey...)
+	data = append(data, onionV3Checksum(pubKey)...)
+	data = append(data, onionV3Version)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(data)) + OnionSuffix
+}
+
+func onionV3Checksum(pubKey []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(onionV3ChecksumTag)
+	buf.Write(pubKey)
+	buf.WriteByte(onionV3Version)
+	sum := sha3.Sum256(buf.Bytes())
+	return sum[:2]
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_ParseOnionHost(t *testing.T) {
+	pubKey := bytes.Repeat([]byte{0x5a}, 32)
+	v3Host := OnionV3Host(pubKey)
+	if len(v3Host) != onionV3Len+len(OnionSuffix) {
+		t.Fatalf("version 3 host %s", v3Host)
+	}
+
+	// A version 3 host with the checksum or the version of the key
+	// changed.
+	tamper := func(i int) string {
+		name := []byte(strings.ToUpper(v3Host[:onionV3Len]))
+		if name[i] == 'A' {
+			name[i] = 'B'
+		} else {
+			name[i] = 'A'
+		}
+		return strings.ToLower(string(name)) + OnionSuffix
+	}
+
+	tests := []struct {
+		host    string
+		version int
+		data    []byte
+	}{
+		{"expyuzz4wqqyqhjn.onion", 2, []byte{0x25, 0xdf, 0x8a, 0x67, 0x3c,
+			0xb4, 0x21, 0x88, 0x1d, 0x2d}},
+		{"EXPYUZZ4WQQYQHJN.onion", 2, []byte{0x25, 0xdf, 0x8a, 0x67, 0x3c,
+			0xb4, 0x21, 0x88, 0x1d, 0x2d}},
+		{v3Host, 3, pubKey},
+		{strings.ToUpper(v3Host), 3, pubKey},
+		{tamper(52), 0, nil},             // checksum
+		{tamper(onionV3Len - 1), 0, nil}, // version
+		{"expyuzz4wqqyqhj.onion", 0, nil},
+		{"expyuzz4wqqyqhj1.onion", 0, nil},
+		{"expyuzz4wqqyqhjn.com", 0, nil},
+	}
+	for _, test := range tests {
+		version, data, err := ParseOnionHost(test.host)
+		if test.version == 0 {
+			if err == nil {
+				t.Errorf("%s: invalid host parsed", test.host)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.host, err)
+			continue
+		}
+		if version != test.version || !bytes.Equal(data, test.data) {
+			t.Errorf("%s: parsed version %d data %x, want %d %x", test.host,
+				version, data, test.version, test.data)
+		}
+	}
+}
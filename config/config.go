@@ -20,6 +20,8 @@ type Config struct {
 	DisableListen      bool     `long:"nolisten" description:"Disable listening for incoming connections"`
 	RPCUser            string   `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass            string   `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
+	RPCAuth            []string `long:"rpcauth" description:"Add an RPC user with the <user>:<salt>$<hash> credentials, where the hash is the hex encoded HMAC-SHA256 of the password keyed by the salt"`
+	RPCAllow           []string `long:"rpcallow" description:"Restrict an RPC user to the listed namespaces and methods, <user>:<namespace or namespace_method>[,...] (e.g. dashboard:qitmeer_getBlockCount,miner)"`
 	RPCCert            string   `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey             string   `long:"rpckey" description:"File containing the certificate key"`
 	RPCMaxClients      int      `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
@@ -32,7 +34,13 @@ type Config struct {
 	DropTxIndex        bool     `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex          bool     `long:"addrindex" description:"Maintain a full address-based transaction index which makes the getrawtransactions RPC available"`
 	DropAddrIndex      bool     `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	NoPeerBloomFilters bool     `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
+	NoCFilters         bool     `long:"nocfilters" description:"Disable committed filtering (CF) support"`
+	DropCFIndex        bool     `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
+	NoCmpctBlocks      bool     `long:"nocompactblocks" description:"Disable the compact block relay, the blocks are always sent and fetched in full"`
+	MaxUploadTarget    uint64   `long:"maxuploadtarget" description:"Try to keep the outbound traffic under the given target in MiB per 24h, the historic blocks are no longer served to the non-whitelisted peers once it is reached (0 for no limit)"`
 	LightNode          bool     `long:"light" description:"start as a qitmeer light node"`
+	Wallet             bool     `long:"wallet" description:"Enable the built-in wallet, which keeps its encrypted keys in the data dir and indexes the outputs paying to it. Its key operations are served by the wallet RPC module"`
 	SigCacheMaxSize    uint     `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	DumpBlockchain     string   `long:"dumpblockchain" description:"Write blockchain as a flat file of blocks for use with addblock, to the specified filename"`
 	TestNet            bool     `long:"testnet" description:"Use the test network"`
@@ -43,11 +51,14 @@ type Config struct {
 	DebugLevel         string   `short:"d" long:"debuglevel" description:"Logging level {trace, debug, info, warn, error, critical} "`
 	DebugPrintOrigins  bool     `long:"printorigin" description:"Print log debug location (file:line) "`
 	// MemPool Config
-	NoRelayPriority  bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
-	FreeTxRelayLimit float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
-	AcceptNonStd     bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
-	MaxOrphanTxs     int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
-	MinTxFee         int64   `long:"mintxfee" description:"The minimum transaction fee in AtomMEER/kB."`
+	NoRelayPriority   bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
+	FreeTxRelayLimit  float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
+	AcceptNonStd      bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
+	RejectReplacement bool    `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
+	MaxOrphanTxs      int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MinTxFee          int64   `long:"mintxfee" description:"The minimum transaction fee in AtomMEER/kB."`
+	MaxMempool        uint64  `long:"maxmempool" description:"Keep the transaction memory pool below <n> megabytes, evicting the transactions paying the lowest fee rate (0 for no limit)"`
+	NoPersistMempool  bool    `long:"nopersistmempool" description:"Do not save the mempool on shutdown and load it on startup"`
 	// Miner
 	Generate          bool     `long:"generate" description:"Generate (mine) coins using the CPU"`
 	MiningAddrs       []string `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
@@ -67,7 +78,17 @@ type Config struct {
 	Upnp            bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
 	Whitelists      []string `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
 	whitelists      []*net.IPNet
-	MaxInbound      int `long:"maxinbound" description:"The max total of inbound peer for host"`
+	MaxInbound      int      `long:"maxinbound" description:"The max total of inbound peer for host"`
+	V2Transport     bool     `long:"v2transport" description:"Support the encrypted v2 peer transport, outbound peers use it when the remote peer advertises it. The peers are not authenticated, it offers no protection against a man in the middle"`
+	Proxy           string   `long:"proxy" description:"Connect to the peers and resolve their names via the SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	ProxyUser       string   `long:"proxyuser" description:"Username for the proxy server"`
+	ProxyPass       string   `long:"proxypass" default-mask:"-" description:"Password for the proxy server"`
+	OnionProxy      string   `long:"onion" description:"Connect to the tor hidden services via the SOCKS5 proxy, the proxy option is used by default (eg. 127.0.0.1:9050)"`
+	OnionProxyUser  string   `long:"onionuser" description:"Username for the onion proxy server"`
+	OnionProxyPass  string   `long:"onionpass" default-mask:"-" description:"Password for the onion proxy server"`
+	NoOnion         bool     `long:"noonion" description:"Disable connecting to the tor hidden services"`
+	TorIsolation    bool     `long:"torisolation" description:"Enable tor stream isolation by randomizing the proxy credentials of each connection"`
+	OnlyNet         []string `long:"onlynet" description:"Only connect automatically to the peers of the network {ipv4, ipv6, onion}, it can be given several times"`
 	//P2P - server ban
 	Banning         bool          `long:"banning" description:"Enable banning of misbehaving peers"`
 	BanDuration     time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
@@ -75,9 +96,11 @@ type Config struct {
 	GetAddrPercent  int           `short:"T" long:"getaddrpercent" description:"It is the percentage of total addresses known that we will share with a call to AddressCache."`
 	TrickleInterval time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 
-	DAGType     string `short:"G" long:"dagtype" description:"DAG type {phantom,conflux,spectre} "`
-	Cleanup     bool   `short:"L" long:"cleanup" description:"Cleanup the block database "`
-	BuildLedger bool   `long:"buildledger" description:"Generate the genesis ledger for the next qitmeer version."`
+	DAGType      string `short:"G" long:"dagtype" description:"DAG type {phantom,conflux,spectre} "`
+	DAGCacheSize uint   `long:"dagcachesize" description:"The number of DAG blocks kept in memory, the others are loaded from the database when needed (0 keeps all blocks in memory)"`
+	Cleanup      bool   `short:"L" long:"cleanup" description:"Cleanup the block database "`
+	Prune        uint64 `long:"prune" description:"Delete the old blocks to keep the block files below the target size in MiB, only the block headers are kept (0 disables pruning)"`
+	BuildLedger  bool   `long:"buildledger" description:"Generate the genesis ledger for the next qitmeer version."`
 
 	Zmqpubhashblock string `long:"zmqpubhashblock" description:"Enable publish hash block  in <address>"`
 	Zmqpubrawblock  string `long:"zmqpubrawblock" description:"Enable publish raw block in <address>"`
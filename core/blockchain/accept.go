@@ -138,10 +138,7 @@ func (b *BlockChain) maybeAcceptBlock(block *types.SerializedBlock, flags Behavi
 	b.getReorganizeNodes(newNode, block, newOrders, &oldOrders)
 	b.index.AddNode(newNode)
 	newNode.SetStatusFlags(statusDataStored)
-	err = newNode.FlushToDB(b)
-	if err != nil {
-		panic(err.Error())
-	}
+	newNode.flushStatus(b)
 	// Insert the block into the database if it's not already there.  Even
 	// though it is possible the block will ultimately fail to connect, it
 	// has already passed all proof-of-work and validity tests which means
@@ -230,11 +227,8 @@ func (b *BlockChain) FastAcceptBlock(block *types.SerializedBlock) error {
 	b.getReorganizeNodes(newNode, block, newOrders, &oldOrders)
 	b.index.AddNode(newNode)
 	newNode.SetStatusFlags(statusDataStored)
-	err := newNode.FlushToDB(b)
-	if err != nil {
-		return err
-	}
-	err = b.db.Update(func(dbTx database.Tx) error {
+	newNode.flushStatus(b)
+	err := b.db.Update(func(dbTx database.Tx) error {
 		if err := dbMaybeStoreBlock(dbTx, block); err != nil {
 			return err
 		}
@@ -0,0 +1,461 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+)
+
+// assetFlags is a bitmask defining additional information and state for an
+// asset in a utxo view.
+type assetFlags uint8
+
+const (
+	// afModified indicates that an asset has been modified since it was
+	// loaded.
+	afModified assetFlags = 1 << iota
+
+	// afRemoved indicates that the issuance of an asset has been
+	// disconnected and the asset has to be removed from the registry.
+	afRemoved
+)
+
+// AssetEntry houses details about an issued native asset.
+type AssetEntry struct {
+	id      types.AssetId
+	issueTx hash.Hash // The hash of the issuing transaction.
+	issuer  []byte    // The public key script allowed to revoke the asset.
+	supply  uint64    // The amount created by the issuing transaction.
+	revoked uint64    // The amount destroyed by revoking transactions.
+
+	flags assetFlags
+}
+
+// Id returns the identifier of the asset.
+func (entry *AssetEntry) Id() types.AssetId {
+	return entry.id
+}
+
+// IssueTx returns the hash of the transaction that issued the asset.
+func (entry *AssetEntry) IssueTx() hash.Hash {
+	return entry.issueTx
+}
+
+// Issuer returns the public key script of the output spent by the first input
+// of the issuing transaction.  Only spenders of outputs locked by the same
+// script may revoke the asset.
+func (entry *AssetEntry) Issuer() []byte {
+	return entry.issuer
+}
+
+// Supply returns the amount of the asset created at issuance.
+func (entry *AssetEntry) Supply() uint64 {
+	return entry.supply
+}
+
+// Revoked returns the amount of the asset that has been revoked.
+func (entry *AssetEntry) Revoked() uint64 {
+	return entry.revoked
+}
+
+// Circulating returns the amount of the asset that has not been revoked.
+func (entry *AssetEntry) Circulating() uint64 {
+	return entry.supply - entry.revoked
+}
+
+// assetBalanceKey identifies the balance of an asset held by a public key
+// script.
+type assetBalanceKey struct {
+	script hash.Hash
+	asset  types.AssetId
+}
+
+// newAssetBalanceKey returns the balance key of the passed script and asset.
+func newAssetBalanceKey(pkScript []byte, asset types.AssetId) assetBalanceKey {
+	return assetBalanceKey{script: hash.HashH(pkScript), asset: asset}
+}
+
+// bytes returns the database key of the balance.  Keys are prefixed by the
+// script hash so the balances of one script can be iterated by a cursor.
+func (key *assetBalanceKey) bytes() []byte {
+	serialized := make([]byte, hash.HashSize+types.AssetIdSize)
+	copy(serialized, key.script[:])
+	copy(serialized[hash.HashSize:], key.asset[:])
+	return serialized
+}
+
+// assetOutputAmounts sums the output amounts of the passed transaction by
+// asset.  The native coin is skipped.
+func assetOutputAmounts(tx *types.Transaction) map[types.AssetId]uint64 {
+	amounts := make(map[types.AssetId]uint64)
+	for _, txOut := range tx.TxOut {
+		if txOut.Asset.IsMeer() {
+			continue
+		}
+		amounts[txOut.Asset] += txOut.Amount
+	}
+	return amounts
+}
+
+// assetBurns returns the amount of every asset that the passed input and output
+// totals no longer account for.
+func assetBurns(in, out map[types.AssetId]uint64) map[types.AssetId]uint64 {
+	burns := make(map[types.AssetId]uint64)
+	for id, amount := range in {
+		if amount > out[id] {
+			burns[id] = amount - out[id]
+		}
+	}
+	return burns
+}
+
+// LookupAsset returns information about the passed asset from the point of
+// view of the utxo view.  Assets that were not loaded into the view are
+// fetched from the database.  Nil is returned for unknown assets.
+func (view *UtxoViewpoint) LookupAsset(db database.DB, id types.AssetId) (*AssetEntry, error) {
+	if entry, ok := view.assets[id]; ok {
+		if entry.flags&afRemoved != 0 {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	var entry *AssetEntry
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchAssetEntry(dbTx, id)
+		return err
+	})
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	view.assets[id] = entry
+	return entry, nil
+}
+
+// addAssetBalance records a change of the balance of the passed asset held by
+// the script.  Changes of the native coin are ignored.
+func (view *UtxoViewpoint) addAssetBalance(asset types.AssetId, pkScript []byte, delta int64) {
+	if asset.IsMeer() {
+		return
+	}
+	view.assetBalances[newAssetBalanceKey(pkScript, asset)] += delta
+}
+
+// addAssetOutputBalances records the asset balances created by the spendable
+// outputs of the passed transaction, or removes them when sign is negative.
+func (view *UtxoViewpoint) addAssetOutputBalances(tx *types.Tx, sign int64) {
+	for _, txOut := range tx.Tx.TxOut {
+		if txscript.IsUnspendable(txOut.PkScript) {
+			continue
+		}
+		view.addAssetBalance(txOut.Asset, txOut.PkScript, sign*int64(txOut.Amount))
+	}
+}
+
+// connectAssetTransaction updates the asset registry of the view for the passed
+// transaction.  Issuing transactions register their asset and revoking
+// transactions account for the amounts they destroy.  It must be called
+// before the inputs of the transaction are spent in the view.
+func (view *UtxoViewpoint) connectAssetTransaction(tx *types.Tx, bc *BlockChain) error {
+	msgTx := tx.Tx
+	switch types.DetermineTxType(msgTx) {
+	case types.AssetIssue:
+		prevOut := &msgTx.TxIn[0].PreviousOut
+		issuer := view.entries[*prevOut]
+		if issuer == nil {
+			return AssertError(fmt.Sprintf("view missing input %v",
+				*prevOut))
+		}
+		id := types.NewAssetId(prevOut)
+		view.assets[id] = &AssetEntry{
+			id:      id,
+			issueTx: *tx.Hash(),
+			issuer:  issuer.pkScript,
+			supply:  assetOutputAmounts(msgTx)[id],
+			flags:   afModified,
+		}
+
+	case types.AssetRevoke:
+		in := make(map[types.AssetId]uint64)
+		for _, txIn := range msgTx.TxIn {
+			entry := view.entries[txIn.PreviousOut]
+			if entry == nil {
+				return AssertError(fmt.Sprintf("view missing input %v",
+					txIn.PreviousOut))
+			}
+			if !entry.asset.IsMeer() {
+				in[entry.asset] += entry.amount
+			}
+		}
+		for id, amount := range assetBurns(in, assetOutputAmounts(msgTx)) {
+			asset, err := view.LookupAsset(bc.db, id)
+			if err != nil {
+				return err
+			}
+			if asset == nil {
+				return AssertError(fmt.Sprintf("revoking unknown "+
+					"asset %v", id))
+			}
+			asset.revoked += amount
+			asset.flags |= afModified
+		}
+	}
+	return nil
+}
+
+// disconnectAssetTransaction reverts the changes connectAssetTransaction made
+// to the asset registry of the view using the spent txout information of the
+// transaction.
+func (view *UtxoViewpoint) disconnectAssetTransaction(tx *types.Tx, stxos []SpentTxOut, bc *BlockChain) error {
+	msgTx := tx.Tx
+	switch types.DetermineTxType(msgTx) {
+	case types.AssetIssue:
+		id := types.NewAssetId(&msgTx.TxIn[0].PreviousOut)
+		view.assets[id] = &AssetEntry{id: id, flags: afModified | afRemoved}
+
+	case types.AssetRevoke:
+		in := make(map[types.AssetId]uint64)
+		for _, stxo := range stxos {
+			if !stxo.Asset.IsMeer() {
+				in[stxo.Asset] += stxo.OriAmount
+			}
+		}
+		for id, amount := range assetBurns(in, assetOutputAmounts(msgTx)) {
+			asset, err := view.LookupAsset(bc.db, id)
+			if err != nil {
+				return err
+			}
+			if asset == nil || asset.revoked < amount {
+				return AssertError(fmt.Sprintf("unable to restore "+
+					"revoked amount of asset %v", id))
+			}
+			asset.revoked -= amount
+			asset.flags |= afModified
+		}
+	}
+	return nil
+}
+
+// commitAssets forgets the removed assets and the balance changes of the view
+// and marks all remaining assets as unmodified.
+func (view *UtxoViewpoint) commitAssets() {
+	for id, entry := range view.assets {
+		if entry.flags&afRemoved != 0 {
+			delete(view.assets, id)
+			continue
+		}
+		entry.flags &^= afModified
+	}
+	view.assetBalances = make(map[assetBalanceKey]int64)
+}
+
+// serializeAssetEntry returns the entry serialized to a format that is suitable
+// for long-term storage.  The format is:
+//
+//   <issue tx hash><supply><revoked><issuer script>
+//
+//   Field            Type       Size
+//   issue tx hash    hash.Hash  32
+//   supply           VLQ        variable
+//   revoked          VLQ        variable
+//   issuer script    []byte     remaining bytes
+func serializeAssetEntry(entry *AssetEntry) []byte {
+	size := hash.HashSize + serializeSizeVLQ(entry.supply) +
+		serializeSizeVLQ(entry.revoked) + len(entry.issuer)
+	serialized := make([]byte, size)
+	offset := copy(serialized, entry.issueTx[:])
+	offset += putVLQ(serialized[offset:], entry.supply)
+	offset += putVLQ(serialized[offset:], entry.revoked)
+	copy(serialized[offset:], entry.issuer)
+	return serialized
+}
+
+// deserializeAssetEntry decodes an asset entry from the passed serialized byte
+// slice.
+func deserializeAssetEntry(id types.AssetId, serialized []byte) (*AssetEntry, error) {
+	if len(serialized) < hash.HashSize {
+		return nil, errDeserialize("unexpected end of data for asset")
+	}
+	entry := &AssetEntry{id: id}
+	offset := copy(entry.issueTx[:], serialized[:hash.HashSize])
+
+	var bytesRead int
+	entry.supply, bytesRead = deserializeVLQ(serialized[offset:])
+	if bytesRead == 0 {
+		return nil, errDeserialize("unexpected end of data after " +
+			"issue transaction")
+	}
+	offset += bytesRead
+	entry.revoked, bytesRead = deserializeVLQ(serialized[offset:])
+	if bytesRead == 0 {
+		return nil, errDeserialize("unexpected end of data after " +
+			"supply")
+	}
+	offset += bytesRead
+	entry.issuer = make([]byte, len(serialized[offset:]))
+	copy(entry.issuer, serialized[offset:])
+	return entry, nil
+}
+
+// dbFetchAssetEntry uses an existing database transaction to fetch the passed
+// asset from the registry.  Nil is returned for both the entry and the error
+// when the asset has not been issued.
+func dbFetchAssetEntry(dbTx database.Tx, id types.AssetId) (*AssetEntry, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.AssetBucketName)
+	serialized := bucket.Get(id[:])
+	if serialized == nil {
+		return nil, nil
+	}
+	entry, err := deserializeAssetEntry(id, serialized)
+	if err != nil {
+		if isDeserializeErr(err) {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt asset entry "+
+					"for %v: %v", id, err),
+			}
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// dbPutAssetChanges uses an existing database transaction to update the asset
+// registry and the asset balances with the changes of the view.
+func dbPutAssetChanges(dbTx database.Tx, view *UtxoViewpoint) error {
+	meta := dbTx.Metadata()
+	assetBucket := meta.Bucket(dbnamespace.AssetBucketName)
+	for id, entry := range view.assets {
+		if entry.flags&afModified == 0 {
+			continue
+		}
+		key := id
+		if entry.flags&afRemoved != 0 {
+			err := assetBucket.Delete(key[:])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := assetBucket.Put(key[:], serializeAssetEntry(entry))
+		if err != nil {
+			return err
+		}
+	}
+
+	balanceBucket := meta.Bucket(dbnamespace.AssetBalanceBucketName)
+	for key, delta := range view.assetBalances {
+		if delta == 0 {
+			continue
+		}
+		serializedKey := key.bytes()
+		var balance int64
+		if serialized := balanceBucket.Get(serializedKey); len(serialized) == 8 {
+			balance = int64(dbnamespace.ByteOrder.Uint64(serialized))
+		}
+		balance += delta
+		if balance < 0 {
+			return AssertError(fmt.Sprintf("negative balance of "+
+				"asset %v", key.asset))
+		}
+		if balance == 0 {
+			err := balanceBucket.Delete(serializedKey)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		serialized := make([]byte, 8)
+		dbnamespace.ByteOrder.PutUint64(serialized, uint64(balance))
+		err := balanceBucket.Put(serializedKey, serialized)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbCreateAssetBuckets creates the buckets that house the asset registry and
+// the asset balances when they do not exist yet.
+func dbCreateAssetBuckets(meta database.Bucket) error {
+	_, err := meta.CreateBucketIfNotExists(dbnamespace.AssetBucketName)
+	if err != nil {
+		return err
+	}
+	_, err = meta.CreateBucketIfNotExists(dbnamespace.AssetBalanceBucketName)
+	return err
+}
+
+// FetchAssetEntry returns the registry entry of the passed asset, or nil when
+// it has not been issued.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchAssetEntry(id types.AssetId) (*AssetEntry, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	var entry *AssetEntry
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchAssetEntry(dbTx, id)
+		return err
+	})
+	return entry, err
+}
+
+// FetchAssetEntries returns the registry entries of all issued assets.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchAssetEntries() ([]*AssetEntry, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	var entries []*AssetEntry
+	err := b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.AssetBucketName)
+		return bucket.ForEach(func(k, v []byte) error {
+			var id types.AssetId
+			copy(id[:], k)
+			entry, err := deserializeAssetEntry(id, v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// FetchAssetBalances returns the balances of all assets held by outputs locked
+// by the passed public key script.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchAssetBalances(pkScript []byte) (map[types.AssetId]uint64, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	balances := make(map[types.AssetId]uint64)
+	prefix := hash.HashH(pkScript)
+	err := b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.AssetBalanceBucketName)
+		cursor := bucket.Cursor()
+		for ok := cursor.Seek(prefix[:]); ok; ok = cursor.Next() {
+			key := cursor.Key()
+			if !bytes.HasPrefix(key, prefix[:]) {
+				break
+			}
+			var id types.AssetId
+			copy(id[:], key[hash.HashSize:])
+			balances[id] = dbnamespace.ByteOrder.Uint64(cursor.Value())
+		}
+		return nil
+	})
+	return balances, err
+}
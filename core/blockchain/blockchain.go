@@ -9,11 +9,14 @@ import (
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/merkle"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/engine/vm"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/common/progresslog"
+	"github.com/Qitmeer/qitmeer/trie"
 	"os"
 	"sort"
 	"sync"
@@ -110,6 +113,25 @@ type BlockChain struct {
 
 	// Cache Invalid tx
 	CacheInvalidTx bool
+
+	// stateDB houses the nodes of the trie committing to the utxo set and
+	// stateRoot is its root as of the last connected block.  They are
+	// protected by the chain lock.  stateCache caches the states of the
+	// main parents derived from it.
+	stateDB    *trie.Database
+	stateRoot  hash.Hash
+	stateCache *stateTrieCache
+
+	// contractEngine executes the contract transactions and contractRoot
+	// is the root of the trie holding the contracts and their storage as
+	// of the last connected block.  Its nodes are kept in stateDB.  The
+	// root is protected by the chain lock.
+	contractEngine vm.Engine
+	contractRoot   hash.Hash
+
+	// deploymentCaches caches the current deployment threshold state for
+	// blocks in each of the actively defined deployments.
+	deploymentCaches []thresholdStateCache
 }
 
 // Config is a descriptor which specifies the blockchain instance configuration.
@@ -169,6 +191,18 @@ type Config struct {
 	// Setting different dag types will use different consensus
 	DAGType string
 
+	// The number of dag blocks kept in memory, the others are loaded from
+	// the database when needed. Zero keeps all of the blocks in memory.
+	DAGCacheSize uint
+
+	// The size in bytes the block files are pruned down to, only the
+	// headers of the old blocks are kept. Zero disables pruning.
+	PruneTarget uint64
+
+	// ContractEngine executes the contract transactions.  The reference
+	// engine is used when it is nil.
+	ContractEngine vm.Engine
+
 	// block version
 	BlockVersion uint32
 
@@ -267,10 +301,23 @@ func New(config *Config) (*BlockChain, error) {
 		CacheInvalidTx:     config.CacheInvalidTx,
 	}
 	b.subsidyCache = NewSubsidyCache(0, b.params)
+	b.pruner = newChainPruner(&b, config.PruneTarget)
+	b.contractEngine = config.ContractEngine
+	if b.contractEngine == nil {
+		engine, err := vm.GetEngine(vm.RefEngineName)
+		if err != nil {
+			return nil, err
+		}
+		b.contractEngine = engine
+	}
+	if err := b.checkDeployments(); err != nil {
+		return nil, err
+	}
+	b.deploymentCaches = newThresholdCaches(uint32(len(b.deployments())))
 
 	b.bd = &blockdag.BlockDAG{}
 	b.bd.Init(config.DAGType, b.CalcWeight,
-		1.0/float64(par.TargetTimePerBlock/time.Second), b.index.GetDAGBlockID, b.db)
+		1.0/float64(par.TargetTimePerBlock/time.Second), b.index.GetDAGBlockID, b.db, config.DAGCacheSize)
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
@@ -278,6 +325,16 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Load the trie committing to the utxo set.
+	if err := b.initStateTrie(); err != nil {
+		return nil, err
+	}
+
+	// Load the root of the contract storage.
+	if err := b.initContractTrie(); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -290,7 +347,6 @@ func New(config *Config) (*BlockChain, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.pruner = newChainPruner(&b)
 
 	log.Info(fmt.Sprintf("DAG Type:%s", b.bd.GetName()))
 	log.Info("Blockchain database version", "chain", b.dbInfo.version, "compression", b.dbInfo.compVer,
@@ -389,6 +445,13 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 				dbInfo.bidxVer, currentBlockIndexVersion)
 		}
 
+		// A pruned database can't serve the old blocks any more.
+		if dbIsPruned(dbTx) && b.pruner.targetSize == 0 {
+			return fmt.Errorf("the old blocks have been pruned from the " +
+				"database. you can restart with '--prune' or cleanup " +
+				"your block data base by '--cleanup'.")
+		}
+
 		b.dbInfo = dbInfo
 		isStateInitialized = true
 		return nil
@@ -441,18 +504,17 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 		// Determine how many blocks will be loaded into the index in order to
 		// allocate the right amount as a single alloc versus a whole bunch of
 		// littles ones to reduce pressure on the GC.
-		var block *types.SerializedBlock
 		for i := uint(0); i < uint(state.total); i++ {
 			blockHash := b.bd.GetBlockHash(i)
-			block, err = dbFetchBlockByHash(dbTx, blockHash)
+			header, parentHashes, err := b.fetchHeaderAndParents(dbTx, i, blockHash)
 			if err != nil {
 				return err
 			}
-			if i != 0 && block.Block().Header.GetVersion() != b.BlockVersion {
+			if i != 0 && baseBlockVersion(header.GetVersion()) != b.BlockVersion {
 				return fmt.Errorf("The dag block is not match current genesis block. you can cleanup your block data base by '--cleanup'.")
 			}
 			parents := []*blockNode{}
-			for _, pb := range block.Block().Parents {
+			for _, pb := range parentHashes {
 				parent := b.index.LookupNode(pb)
 				if parent == nil {
 					return fmt.Errorf("Can't find parent %s", pb.String())
@@ -462,7 +524,7 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 			refblock := b.bd.GetBlockById(i)
 			//
 			node := &blockNode{}
-			initBlockNode(node, &block.Block().Header, parents)
+			initBlockNode(node, header, parents)
 			b.index.addNode(node)
 			node.status = BlockStatus(refblock.GetStatus())
 			node.SetOrder(uint64(refblock.GetOrder()))
@@ -476,6 +538,10 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 		// Set the best chain view to the stored best state.
 		// Load the raw block bytes for the best block.
 		mainTip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+		block, err := dbFetchBlockByHash(dbTx, mainTip.GetHash())
+		if err != nil {
+			return err
+		}
 		// Initialize the state related to the best block.
 		blockSize := uint64(block.Block().SerializeSize())
 		numTxns := uint64(len(block.Block().Transactions))
@@ -487,6 +553,38 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 	return err
 }
 
+// fetchHeaderAndParents loads the header and the parents of the dag block with
+// the passed id.  The parents of a pruned block are taken from the dag in the
+// order of their hashes, which is the order blocks are built with.
+func (b *BlockChain) fetchHeaderAndParents(dbTx database.Tx, id uint, h *hash.Hash) (*types.BlockHeader, []*hash.Hash, error) {
+	block, err := dbFetchBlockByHash(dbTx, h)
+	if err == nil {
+		return &block.Block().Header, block.Block().Parents, nil
+	}
+	if !database.IsError(err, database.ErrBlockPruned) {
+		return nil, nil, err
+	}
+	header, err := dbFetchHeaderByHash(dbTx, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The genesis block has no parents.
+	parentIds := b.bd.GetBlockById(id).GetParents()
+	if parentIds == nil || parentIds.IsEmpty() {
+		return header, nil, nil
+	}
+	parents := blockdag.NewHashSet()
+	for _, pid := range parentIds.List() {
+		parents.Add(b.bd.GetBlockHash(pid))
+	}
+	parentHashes := parents.SortList(false)
+	paMerkles := merkle.BuildParentsMerkleTreeStore(parentHashes)
+	if len(paMerkles) == 0 || !paMerkles[len(paMerkles)-1].IsEqual(&header.ParentRoot) {
+		return nil, nil, fmt.Errorf("Can't restore the parents of the pruned block %s", h)
+	}
+	return header, parentHashes, nil
+}
+
 // HaveBlock returns whether or not the chain instance has the block represented
 // by the passed hash.  This includes checking the various places a block can
 // be like part of the main chain, on a side chain, or in the orphan pool.
@@ -738,6 +836,9 @@ func (b *BlockChain) connectDagChain(node *blockNode, block *types.SerializedBlo
 
 		stxos := []SpentTxOut{}
 		err := b.checkConnectBlock(node, block, view, &stxos)
+		if err == nil {
+			err = b.checkStateRoot(node, block)
+		}
 		if err != nil {
 			node.Invalid(b)
 			stxos = []SpentTxOut{}
@@ -772,10 +873,31 @@ func (b *BlockChain) connectDagChain(node *blockNode, block *types.SerializedBlo
 
 	// Reorganize the chain.
 	log.Debug(fmt.Sprintf("Start DAG REORGANIZE: Block %v is causing a reorganize.", node.hash))
+	oldBest := b.BestSnapshot()
 	err := b.reorganizeChain(oldOrders, newOrders, block)
 	if err != nil {
 		return false, err
 	}
+
+	// Notify the caller of the new orders of the blocks.
+	mainTip := b.bd.GetMainChainTip()
+	rd := &ReorganizationNotifyData{
+		OldHash:   oldBest.Hash,
+		OldHeight: uint64(oldBest.GraphState.GetMainHeight()),
+		NewHash:   *mainTip.GetHash(),
+		NewHeight: uint64(b.bd.GetGraphState().GetMainHeight()),
+	}
+	for e := newOrders.Front(); e != nil; e = e.Next() {
+		ib := e.Value.(blockdag.IBlock)
+		if !ib.IsOrdered() {
+			continue
+		}
+		rd.Blocks = append(rd.Blocks, ReorderedBlock{
+			Hash:  *ib.GetHash(),
+			Order: uint64(ib.GetOrder()),
+		})
+	}
+	b.sendNotification(Reorganization, rd)
 	//b.updateBestState(node, block)
 	return true, nil
 }
@@ -844,12 +966,17 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 		if err != nil {
 			return err
 		}
-		return nil
+
+		// Write the dag blocks which were changed by the block along
+		// with the best state, so the dag always matches the block
+		// total of the state when it is loaded again.
+		return b.bd.WriteDirtyBlocks(dbTx)
 	})
 
 	if err != nil {
 		return err
 	}
+	b.bd.Commit()
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
 	// allows the old version to act as a snapshot which callers can use
@@ -874,14 +1001,46 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock, view *UtxoViewpoint, stxos []SpentTxOut) error {
+	// Commit the changes of the utxo set to the state trie.  Its nodes are
+	// written in the database transaction below along with the rest of the
+	// chain state.
+	stateRoot, err := b.connectStateTrie(view)
+	if err != nil {
+		return err
+	}
+
+	// Run the contract transactions of the block.  The contract storage
+	// is committed the same way as the state trie.
+	receipt, err := b.executeContracts(node, block, view)
+	if err != nil {
+		return err
+	}
+
 	// Atomically insert info into the database.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err = b.db.Update(func(dbTx database.Tx) error {
 		// Add the block hash and height to the block index.
 		err := dbPutBlockIndex(dbTx, block.Hash(), node.order)
 		if err != nil {
 			return err
 		}
 
+		// Write the nodes of the state trie and the contract storage,
+		// then store the receipt of the contract transactions and the
+		// state root of the block order.  The new roots are referenced
+		// before the trie of the previous state tip is released.
+		err = b.flushStateTrie(dbTx, stateRoot, receipt.StorageRoot)
+		if err != nil {
+			return err
+		}
+		err = dbPutBlockReceipt(dbTx, block.Hash(), receipt)
+		if err != nil {
+			return err
+		}
+		err = dbPutStateRoot(dbTx, node.order, &stateRoot)
+		if err != nil {
+			return err
+		}
+
 		// Update the utxo set using the state of the utxo view.  This
 		// entails removing all of the utxos spent and adding the new
 		// ones created by the block.
@@ -914,6 +1073,8 @@ func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock,
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.commit()
+	b.stateRoot = stateRoot
+	b.contractRoot = receipt.StorageRoot
 
 	b.sendNotification(BlockConnected, []*types.SerializedBlock{block})
 	return nil
@@ -924,14 +1085,43 @@ func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock,
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) disconnectBlock(node *blockNode, block *types.SerializedBlock, view *UtxoViewpoint, stxos []SpentTxOut) error {
+	// Revert the changes of the utxo set in the state trie.  The orders of
+	// the blocks change, so the cached states of the main parents are
+	// computed again.
+	stateRoot, err := b.connectStateTrie(view)
+	if err != nil {
+		return err
+	}
+	b.stateCache.reset()
+
 	// Calculate the exact subsidy produced by adding the block.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	var contractRoot hash.Hash
+	err = b.db.Update(func(dbTx database.Tx) error {
 		// Remove the block hash and order from the block index.
 		err := dbRemoveBlockIndex(dbTx, block.Hash(), int64(node.order)) //TODO, remove type conversion
 		if err != nil {
 			return err
 		}
 
+		// Write the nodes of the reverted state trie and remove the
+		// state root of the block order.
+		err = b.flushStateTrie(dbTx, stateRoot)
+		if err != nil {
+			return err
+		}
+		err = dbRemoveStateRoot(dbTx, node.order, &stateRoot)
+		if err != nil {
+			return err
+		}
+
+		// Remove the receipt of the contract transactions and restore
+		// the contract storage of the previous block order.
+		contractRoot, err = dbRemoveBlockReceipt(dbTx, block.Hash(),
+			node.order)
+		if err != nil {
+			return err
+		}
+
 		// Update the utxo set using the state of the utxo view.  This
 		// entails restoring all of the utxos spent and removing the new
 		// ones created by the block.
@@ -963,6 +1153,8 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *types.SerializedBlo
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.commit()
+	b.stateRoot = stateRoot
+	b.contractRoot = contractRoot
 
 	b.sendNotification(BlockDisconnected, block)
 
@@ -1043,7 +1235,7 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 		newn.UnsetStatusFlags(statusValid)
 		n.UnsetStatusFlags(statusInvalid)
 		newn.UnsetStatusFlags(statusInvalid)
-		newn.FlushToDB(b)
+		newn.flushStatus(b)
 
 		err = b.disconnectBlock(n, block, view, stxos)
 		if err != nil {
@@ -1074,6 +1266,9 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 		view.SetViewpoints([]*hash.Hash{n.GetHash()})
 		stxos := []SpentTxOut{}
 		err = b.checkConnectBlock(n, block, view, &stxos)
+		if err == nil {
+			err = b.checkStateRoot(n, block)
+		}
 		if err != nil {
 			n.Invalid(b)
 			stxos = []SpentTxOut{}
@@ -1255,6 +1450,9 @@ func (b *BlockChain) CalculateFees(block *types.SerializedBlock) int64 {
 			continue
 		}
 		for _, txOut := range tx.Transaction().TxOut {
+			if !txOut.Asset.IsMeer() {
+				continue
+			}
 			totalAtomOut += int64(txOut.Amount)
 		}
 	}
@@ -1265,7 +1463,8 @@ func (b *BlockChain) CalculateFees(block *types.SerializedBlock) int64 {
 	var totalAtomIn int64
 	if spentTxos != nil {
 		for _, st := range spentTxos {
-			if transactions[st.TxIndex].IsDuplicate {
+			if transactions[st.TxIndex].IsDuplicate ||
+				!st.Asset.IsMeer() {
 				continue
 			}
 			totalAtomIn += int64(st.Amount)
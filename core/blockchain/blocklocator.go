@@ -85,8 +85,8 @@ func (b *BlockChain) locateBlocks(locator BlockLocator, hashStop *hash.Hash, max
 	hashesSet := blockdag.NewHashSet()
 
 	// First of all, we need to make sure we have the parents of block.
-	for _, v := range endBlock.GetParents().GetMap() {
-		hashesSet.Add(v.(blockdag.IBlock).GetHash())
+	for k := range endBlock.GetParents().GetMap() {
+		hashesSet.Add(b.bd.GetBlockHash(k))
 	}
 
 	curNum := uint32(hashesSet.Size())
@@ -8,7 +8,6 @@ import (
 	"github.com/Qitmeer/qitmeer/core/merkle"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/core/types/pow"
-	"github.com/Qitmeer/qitmeer/database"
 	"math/big"
 	"sort"
 	"time"
@@ -332,13 +331,13 @@ func (node *blockNode) GetStatus() BlockStatus {
 func (node *blockNode) Valid(b *BlockChain) {
 	node.SetStatusFlags(statusValid)
 	node.UnsetStatusFlags(statusInvalid)
-	node.FlushToDB(b)
+	node.flushStatus(b)
 }
 
 func (node *blockNode) Invalid(b *BlockChain) {
 	node.SetStatusFlags(statusInvalid)
 	node.UnsetStatusFlags(statusValid)
-	node.FlushToDB(b)
+	node.flushStatus(b)
 }
 
 func (node *blockNode) IsOrdered() bool {
@@ -360,24 +359,14 @@ func (node *blockNode) UnsetStatusFlags(flags BlockStatus) {
 	node.dirty = true
 }
 
-func (node *blockNode) FlushToDB(b *BlockChain) error {
+// Hand the status of the node to its dag block, which is written to the
+// database along with the best state of the chain.
+func (node *blockNode) flushStatus(b *BlockChain) {
 	if !node.dirty {
-		return nil
-	}
-	err := b.db.Update(func(dbTx database.Tx) error {
-		block := b.bd.GetBlock(node.GetHash())
-		block.SetStatus(blockdag.BlockStatus(node.status))
-		err := blockdag.DBPutDAGBlock(dbTx, block)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
-	// If write was successful, clear the dirty set.
-	if err == nil {
-		node.dirty = false
+		return
 	}
-	return err
+	b.bd.SetBlockStatus(node.GetHash(), blockdag.BlockStatus(node.status))
+	node.dirty = false
 }
 
 // return node ID
@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testBlockVersion is the block version generated on the test networks.
+const testBlockVersion = 12
+
+// testChain is a chain of the private network on a temporary database, its
+// blocks are built by the test without proof of work.
+type testChain struct {
+	*BlockChain
+	t     *testing.T
+	par   *params.Params
+	dir   string
+	db    database.DB
+	nonce int64
+	last  time.Time
+
+	// blockFileSize is the maximum size of the block files, the default
+	// size of the database is used when it is zero.
+	blockFileSize uint32
+
+	// dagCacheSize is the number of dag blocks kept in memory, all of
+	// the blocks are kept when it is zero.
+	dagCacheSize uint
+}
+
+// newTestChain creates a chain with the passed parameters in a new temporary
+// directory.
+func newTestChain(t *testing.T, par *params.Params) *testChain {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testChain{t: t, par: par, dir: dir, last: par.GenesisBlock.Header.Timestamp}
+	tc.open(0)
+	return tc
+}
+
+// open opens the database of the chain and loads the chain from it.
+func (tc *testChain) open(pruneTarget uint64) {
+	if err := tc.load(pruneTarget); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// load opens the database of the chain and loads the chain from it, the
+// database is closed again when the chain can't be loaded.
+func (tc *testChain) load(pruneTarget uint64) error {
+	path := filepath.Join(tc.dir, "db")
+	args := []interface{}{path, tc.par.Net}
+	if tc.blockFileSize > 0 {
+		args = append(args, tc.blockFileSize)
+	}
+	db, err := database.Open("ffldb", args...)
+	if err != nil {
+		db, err = database.Create("ffldb", args...)
+	}
+	if err != nil {
+		return err
+	}
+	tc.db = db
+	tc.BlockChain, err = New(&Config{
+		DB:           db,
+		ChainParams:  tc.par,
+		TimeSource:   NewMedianTime(),
+		DAGType:      "phantom",
+		BlockVersion: testBlockVersion,
+		PruneTarget:  pruneTarget,
+		DAGCacheSize: tc.dagCacheSize,
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	return nil
+}
+
+// restart closes the chain and opens it again from its database.
+func (tc *testChain) restart(pruneTarget uint64) {
+	tc.db.Close()
+	tc.open(pruneTarget)
+}
+
+// close closes the chain and removes its directory.
+func (tc *testChain) close() {
+	tc.db.Close()
+	os.RemoveAll(tc.dir)
+}
+
+// newBlock returns a block with the passed parents and transactions after the
+// coinbase, the mining tips are used when no parents are passed.  The header
+// commits to the state root of the block.
+func (tc *testChain) newBlock(parents []*hash.Hash, txs ...*types.Transaction) *types.SerializedBlock {
+	if len(parents) == 0 {
+		parents = tc.GetMiningTips()
+	}
+	ids := tc.bd.GetIdSet(parents)
+	mainParent := tc.index.LookupNode(tc.bd.GetMainParent(ids).GetHash())
+	blues := tc.bd.GetBlues(ids)
+
+	tc.nonce++
+	signScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(mainParent.GetHeight() + 1)).AddInt64(tc.nonce).
+		AddData([]byte("/qitmeer/")).Script()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	coinbase := types.NewTransaction()
+	coinbase.AddTxIn(&types.TxInput{
+		PreviousOut: *types.NewOutPoint(&hash.Hash{}, types.MaxPrevOutIndex),
+		Sequence:    types.MaxTxInSequenceNum,
+		SignScript:  signScript,
+	})
+	coinbase.AddTxOut(&types.TxOutput{
+		Amount:   uint64(tc.subsidyCache.CalcBlockSubsidy(int64(blues))),
+		PkScript: []byte{txscript.OP_TRUE},
+	})
+
+	block := types.Block{Header: types.BlockHeader{
+		Pow: pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{}),
+	}}
+	for _, parent := range parents {
+		if err := block.AddParent(parent); err != nil {
+			tc.t.Fatal(err)
+		}
+	}
+	blockTxns := []*types.Tx{types.NewTx(coinbase)}
+	for _, tx := range txs {
+		blockTxns = append(blockTxns, types.NewTx(tx))
+	}
+	witnessMerkles := merkle.BuildMerkleTreeStore(blockTxns, true)
+	witnessPreimage := append(witnessMerkles[len(witnessMerkles)-1].Bytes(), signScript...)
+	coinbase.TxIn[0].PreviousOut.Hash = hash.DoubleHashH(witnessPreimage)
+	blockTxns[0] = types.NewTx(coinbase)
+	for _, tx := range blockTxns {
+		if err := block.AddTransaction(tx.Tx); err != nil {
+			tc.t.Fatal(err)
+		}
+	}
+
+	tc.last = tc.last.Add(time.Second)
+	tc.ChainRLock()
+	version, err := tc.calcNextBlockVersion(mainParent)
+	if err != nil {
+		tc.ChainRUnlock()
+		tc.t.Fatal(err)
+	}
+	instance := pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{})
+	instance.SetParams(tc.par.PowConfig)
+	instance.SetMainHeight(int64(mainParent.GetHeight() + 1))
+	difficulty, err := tc.calcNextRequiredDifficulty(mainParent, tc.last, instance)
+	tc.ChainRUnlock()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+
+	paMerkles := merkle.BuildParentsMerkleTreeStore(block.Parents)
+	merkles := merkle.BuildMerkleTreeStore(blockTxns, false)
+	block.Header = types.BlockHeader{
+		Version:    version,
+		ParentRoot: *paMerkles[len(paMerkles)-1],
+		TxRoot:     *merkles[len(merkles)-1],
+		Timestamp:  tc.last,
+		Difficulty: difficulty,
+		Pow:        pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{}),
+	}
+	stateRoot, err := tc.CalcStateRoot(parents)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	block.Header.StateRoot = stateRoot
+	return types.NewBlock(&block)
+}
+
+// processBlock processes the passed block, it must connect to the DAG.
+func (tc *testChain) processBlock(block *types.SerializedBlock) error {
+	isOrphan, err := tc.ProcessBlock(block, BFNoPoWCheck)
+	if err != nil {
+		return err
+	}
+	if isOrphan {
+		tc.t.Fatalf("block %v is an orphan", block.Hash())
+	}
+	return nil
+}
+
+// mustProcessBlock processes the passed block and fails the test when it is
+// rejected or found invalid.
+func (tc *testChain) mustProcessBlock(block *types.SerializedBlock) {
+	tc.t.Helper()
+	if err := tc.processBlock(block); err != nil {
+		tc.t.Fatalf("block %v: %v", block.Hash(), err)
+	}
+	if tc.isInvalid(block.Hash()) {
+		tc.t.Fatalf("block %v is invalid", block.Hash())
+	}
+}
+
+// isInvalid returns whether the passed block failed validation when it was
+// connected.
+func (tc *testChain) isInvalid(h *hash.Hash) bool {
+	node := tc.index.LookupNode(h)
+	if node == nil {
+		tc.t.Fatalf("unknown block %v", h)
+	}
+	return tc.index.NodeStatus(node).KnownInvalid()
+}
@@ -0,0 +1,574 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/engine/vm"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/trie"
+)
+
+const (
+	// ContractGasPrice is the number of atoms the fee of a contract
+	// transaction has to pay for every unit of its gas limit.
+	ContractGasPrice = 1
+
+	// MaxContractGasPerTx is the maximum gas limit of a contract
+	// transaction.
+	MaxContractGasPerTx = 10000000
+
+	// contractCreateGasPerByte is the gas used to store every byte of the
+	// code of a created contract.
+	contractCreateGasPerByte = 1
+)
+
+var (
+	// contractEntryPrefix is the prefix of the keys of the contract entries
+	// in the contract storage trie.
+	contractEntryPrefix = []byte{'c'}
+
+	// contractStoragePrefix is the prefix of the keys of the storage of the
+	// contracts in the contract storage trie.
+	contractStoragePrefix = []byte{'s'}
+)
+
+// ContractPayloadScript returns the script of the first output of a contract
+// transaction carrying the passed serialized payload.  The script starts with
+// OP_RETURN, so the output is never added to the utxo set, and pushes the
+// payload in chunks of up to MaxScriptElementSize bytes.
+func ContractPayloadScript(payload []byte) ([]byte, error) {
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN)
+	for len(payload) > 0 {
+		chunk := payload
+		if len(chunk) > txscript.MaxScriptElementSize {
+			chunk = chunk[:txscript.MaxScriptElementSize]
+		}
+		builder.AddData(chunk)
+		payload = payload[len(chunk):]
+	}
+	return builder.Script()
+}
+
+// ExtractContractPayload returns the payload carried by the first output of the
+// passed contract transaction.
+func ExtractContractPayload(tx *types.Transaction) (*types.ContractPayload, error) {
+	txType := types.DetermineTxType(tx)
+	if len(tx.TxOut) == 0 {
+		str := fmt.Sprintf("%v transaction has no payload output", txType)
+		return nil, ruleError(ErrInvalidContractTx, str)
+	}
+	pkScript := tx.TxOut[0].PkScript
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN ||
+		!txscript.IsPushOnlyScript(pkScript[1:]) {
+		str := fmt.Sprintf("first output of %v transaction does not "+
+			"carry a payload", txType)
+		return nil, ruleError(ErrInvalidContractTx, str)
+	}
+	pushes, err := txscript.PushedData(pkScript[1:])
+	if err != nil {
+		return nil, ruleError(ErrInvalidContractTx, err.Error())
+	}
+	payload, err := types.ParseContractPayload(txType, bytes.Join(pushes, nil))
+	if err != nil {
+		return nil, ruleError(ErrInvalidContractTx, err.Error())
+	}
+	return payload, nil
+}
+
+// checkContractSanity performs the context free checks of a contract
+// transaction.  Its first output must carry a well formed payload with a gas
+// limit in range and no amount.
+func checkContractSanity(tx *types.Transaction) error {
+	if !tx.IsContractTx() {
+		return nil
+	}
+	if tx.IsCoinBase() {
+		return ruleError(ErrInvalidContractTx, "coinbase transaction "+
+			"must not be a contract transaction")
+	}
+	payload, err := ExtractContractPayload(tx)
+	if err != nil {
+		return err
+	}
+	if tx.TxOut[0].Amount != 0 {
+		str := fmt.Sprintf("payload output of contract transaction "+
+			"carries an amount of %v", tx.TxOut[0].Amount)
+		return ruleError(ErrInvalidContractTx, str)
+	}
+	if payload.GasLimit == 0 || payload.GasLimit > MaxContractGasPerTx {
+		str := fmt.Sprintf("contract transaction gas limit %v is not in "+
+			"range 1 to %v", payload.GasLimit, MaxContractGasPerTx)
+		return ruleError(ErrInvalidContractTx, str)
+	}
+	return nil
+}
+
+// checkContractFee ensures the fee of a contract transaction pays for the gas
+// limit of its payload.
+func checkContractFee(tx *types.Tx, fee int64) error {
+	msgTx := tx.Transaction()
+	if !msgTx.IsContractTx() {
+		return nil
+	}
+	payload, err := ExtractContractPayload(msgTx)
+	if err != nil {
+		return err
+	}
+	if fee < int64(payload.GasLimit*ContractGasPrice) {
+		str := fmt.Sprintf("fee of %v of contract transaction %v does "+
+			"not pay for its gas limit of %v", fee, tx.Hash(),
+			payload.GasLimit)
+		return ruleError(ErrContractGasNotPaid, str)
+	}
+	return nil
+}
+
+// ContractEntry houses the details of a contract in the contract storage.
+type ContractEntry struct {
+	id    types.ContractId
+	owner []byte
+	code  []byte
+}
+
+// Id returns the identifier of the contract.
+func (entry *ContractEntry) Id() types.ContractId {
+	return entry.id
+}
+
+// Owner returns the script of the output spent by the first input of the
+// transaction that created the contract.  Only transactions whose first input
+// spends an output with the same script may destroy the contract.
+func (entry *ContractEntry) Owner() []byte {
+	return entry.owner
+}
+
+// Code returns the code of the contract.
+func (entry *ContractEntry) Code() []byte {
+	return entry.code
+}
+
+// serializeContractEntry returns the serialized contract entry.
+//
+//   <owner script length as VLQ><owner script><code>
+func serializeContractEntry(entry *ContractEntry) []byte {
+	serialized := make([]byte, serializeSizeVLQ(uint64(len(entry.owner)))+
+		len(entry.owner)+len(entry.code))
+	offset := putVLQ(serialized, uint64(len(entry.owner)))
+	offset += copy(serialized[offset:], entry.owner)
+	copy(serialized[offset:], entry.code)
+	return serialized
+}
+
+// deserializeContractEntry decodes a contract entry from the passed serialized
+// bytes.
+func deserializeContractEntry(id types.ContractId, serialized []byte) (*ContractEntry, error) {
+	ownerLen, offset := deserializeVLQ(serialized)
+	if offset == 0 || uint64(len(serialized[offset:])) < ownerLen {
+		return nil, errDeserialize("unexpected end of data in contract " +
+			"entry")
+	}
+	end := offset + int(ownerLen)
+	return &ContractEntry{
+		id:    id,
+		owner: serialized[offset:end:end],
+		code:  serialized[end:],
+	}, nil
+}
+
+// contractEntryKey returns the key of the entry of the passed contract in the
+// contract storage trie.
+func contractEntryKey(id types.ContractId) []byte {
+	return append(append([]byte{}, contractEntryPrefix...), id[:]...)
+}
+
+// contractStorageKey returns the key of the passed storage key of a contract
+// in the contract storage trie.
+func contractStorageKey(id types.ContractId, key []byte) []byte {
+	k := make([]byte, 0, len(contractStoragePrefix)+len(id)+len(key))
+	k = append(append(append(k, contractStoragePrefix...), id[:]...), key...)
+	return k
+}
+
+// contractStorage implements the vm.StateDB interface for a single call of a
+// contract.  The changes are held back until the call succeeded.
+type contractStorage struct {
+	trie    *trie.Trie
+	id      types.ContractId
+	changes map[string][]byte
+}
+
+// GetState returns the value stored at the passed key.
+//
+// This is part of the vm.StateDB interface implementation.
+func (s *contractStorage) GetState(key []byte) ([]byte, error) {
+	if value, ok := s.changes[string(key)]; ok {
+		return value, nil
+	}
+	return s.trie.TryGet(contractStorageKey(s.id, key))
+}
+
+// SetState stores the passed value at the key.
+//
+// This is part of the vm.StateDB interface implementation.
+func (s *contractStorage) SetState(key []byte, value []byte) error {
+	s.changes[string(key)] = value
+	return nil
+}
+
+// commit writes the changes of the call to the trie and adds the changed keys
+// to the passed set.
+func (s *contractStorage) commit(changed map[string]struct{}) error {
+	for key, value := range s.changes {
+		k := contractStorageKey(s.id, []byte(key))
+		var err error
+		if len(value) == 0 {
+			err = s.trie.TryDelete(k)
+		} else {
+			err = s.trie.TryUpdate(k, value)
+		}
+		if err != nil {
+			return err
+		}
+		changed[string(k)] = struct{}{}
+	}
+	return nil
+}
+
+// fetchContractEntry returns the entry of the passed contract in the trie, or
+// nil when the contract does not exist.
+func fetchContractEntry(t *trie.Trie, id types.ContractId) (*ContractEntry, error) {
+	serialized, err := t.TryGet(contractEntryKey(id))
+	if err != nil || serialized == nil {
+		return nil, err
+	}
+	return deserializeContractEntry(id, serialized)
+}
+
+// executeContracts runs the contract transactions of the passed block in the
+// order of the block and commits the changes of the contract storage to the
+// trie database.  It returns the receipt of the block.  Nothing is executed for
+// blocks which failed validation or before the contract deployment is active.
+//
+// The storage root and the receipts are committed to by the state root of the
+// blocks whose main parent is the passed block, see contractStateRoot.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) executeContracts(node *blockNode, block *types.SerializedBlock, view *UtxoViewpoint) (*types.BlockReceipt, error) {
+	receipt := &types.BlockReceipt{
+		BlockNumber: node.order,
+		StorageRoot: b.contractRoot,
+	}
+	if node.GetStatus().KnownInvalid() {
+		return receipt, nil
+	}
+
+	var t *trie.Trie
+	changed := make(map[string]struct{})
+	for _, tx := range block.Transactions() {
+		if tx.IsDuplicate || !tx.Tx.IsContractTx() {
+			continue
+		}
+		if t == nil {
+			active, err := b.isDeploymentActive(node.GetMainParent(b),
+				params.DeploymentContracts)
+			if err != nil {
+				return nil, err
+			}
+			if !active {
+				return receipt, nil
+			}
+			t, err = trie.New(b.contractRoot, b.stateDB)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entry := view.LookupEntry(tx.Tx.TxIn[0].PreviousOut)
+		if entry == nil {
+			return nil, AssertError(fmt.Sprintf("view missing input %v",
+				tx.Tx.TxIn[0].PreviousOut))
+		}
+		txReceipt, err := b.executeContract(t, tx, entry.PkScript(),
+			node.order, changed)
+		if err != nil {
+			return nil, err
+		}
+		receipt.TxReceipts = append(receipt.TxReceipts, txReceipt)
+	}
+	if t == nil {
+		return receipt, nil
+	}
+
+	root, err := b.commitStateTrie(t)
+	if err != nil {
+		return nil, err
+	}
+	receipt.StorageRoot = root
+	receipt.ChangeRoot = calcChangeRoot(changed)
+	return receipt, nil
+}
+
+// executeContract runs a single contract transaction against the trie.  A
+// failed execution only leaves the gas it used in the receipt.
+func (b *BlockChain) executeContract(t *trie.Trie, tx *types.Tx, caller []byte, order uint64, changed map[string]struct{}) (*types.TxReceipt, error) {
+	msgTx := tx.Transaction()
+	txType := types.DetermineTxType(msgTx)
+	payload, err := ExtractContractPayload(msgTx)
+	if err != nil {
+		return nil, err
+	}
+	txReceipt := &types.TxReceipt{
+		TxHash:   *tx.Hash(),
+		Contract: payload.Contract,
+	}
+
+	switch txType {
+	case types.ContractCreate:
+		id := types.NewContractId(&msgTx.TxIn[0].PreviousOut)
+		txReceipt.Contract = id
+		txReceipt.GasUsed = uint64(len(payload.Data)) * contractCreateGasPerByte
+		if txReceipt.GasUsed > payload.GasLimit {
+			txReceipt.GasUsed = payload.GasLimit
+			return txReceipt, nil
+		}
+		if b.contractEngine.Validate(payload.Data) != nil {
+			return txReceipt, nil
+		}
+		key := contractEntryKey(id)
+		entry := &ContractEntry{id: id, owner: caller, code: payload.Data}
+		err := t.TryUpdate(key, serializeContractEntry(entry))
+		if err != nil {
+			return nil, err
+		}
+		changed[string(key)] = struct{}{}
+
+	case types.ContractUpdate:
+		entry, err := fetchContractEntry(t, payload.Contract)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return txReceipt, nil
+		}
+		storage := &contractStorage{
+			trie:    t,
+			id:      payload.Contract,
+			changes: make(map[string][]byte),
+		}
+		result, err := b.contractEngine.Execute(&vm.Context{
+			Contract:   hash.Hash(payload.Contract),
+			Caller:     caller,
+			TxHash:     *tx.Hash(),
+			BlockOrder: order,
+			Code:       entry.code,
+			Input:      payload.Data,
+			GasLimit:   payload.GasLimit,
+		}, storage)
+		if err != nil {
+			return nil, err
+		}
+		txReceipt.GasUsed = result.GasUsed
+		if result.Err != nil {
+			return txReceipt, nil
+		}
+		if err := storage.commit(changed); err != nil {
+			return nil, err
+		}
+		for _, event := range result.Events {
+			txReceipt.Events = append(txReceipt.Events, event)
+		}
+
+	case types.ContractDestroy:
+		entry, err := fetchContractEntry(t, payload.Contract)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || !bytes.Equal(entry.owner, caller) {
+			return txReceipt, nil
+		}
+
+		// Remove the entry and all of the storage of the contract.
+		prefix := contractStorageKey(payload.Contract, nil)
+		keys := [][]byte{contractEntryKey(payload.Contract)}
+		it := trie.NewIterator(t.NodeIterator(prefix))
+		for it.Next() && bytes.HasPrefix(it.Key, prefix) {
+			keys = append(keys, append([]byte{}, it.Key...))
+		}
+		if it.Err != nil {
+			return nil, it.Err
+		}
+		for _, key := range keys {
+			if err := t.TryDelete(key); err != nil {
+				return nil, err
+			}
+			changed[string(key)] = struct{}{}
+		}
+	}
+
+	txReceipt.Success = true
+	return txReceipt, nil
+}
+
+// calcChangeRoot returns the merkle root of the hashes of the passed changed
+// keys of the contract storage trie in the order of the keys.
+func calcChangeRoot(changed map[string]struct{}) hash.Hash {
+	if len(changed) == 0 {
+		return hash.Hash{}
+	}
+	keys := make([]string, 0, len(changed))
+	for key := range changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hashes := make([]*hash.Hash, len(keys))
+	for i, key := range keys {
+		h := hash.DoubleHashH([]byte(key))
+		hashes[i] = &h
+	}
+	store := merkle.BuildParentsMerkleTreeStore(hashes)
+	return *store[len(store)-1]
+}
+
+// calcReceiptRoot returns the merkle root of the hashes of the transaction
+// receipts of the passed block receipt in the order they were executed.
+func calcReceiptRoot(receipt *types.BlockReceipt) hash.Hash {
+	if len(receipt.TxReceipts) == 0 {
+		return hash.Hash{}
+	}
+	hashes := make([]*hash.Hash, len(receipt.TxReceipts))
+	for i, txr := range receipt.TxReceipts {
+		h := txr.Hash()
+		hashes[i] = &h
+	}
+	store := merkle.BuildParentsMerkleTreeStore(hashes)
+	return *store[len(store)-1]
+}
+
+// initContractTrie loads the root of the contract storage as of the last
+// connected block.
+func (b *BlockChain) initContractTrie() error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		_, err := meta.CreateBucketIfNotExists(dbnamespace.ContractRootBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucketIfNotExists(dbnamespace.ReceiptBucketName)
+		if err != nil {
+			return err
+		}
+		if serialized := meta.Get(dbnamespace.ContractTipKeyName); serialized != nil {
+			copy(b.contractRoot[:], serialized)
+		}
+		return nil
+	})
+}
+
+// dbPutBlockReceipt uses an existing database transaction to store the receipt
+// of the passed block and make its storage root the contract tip.
+func dbPutBlockReceipt(dbTx database.Tx, blockHash *hash.Hash, receipt *types.BlockReceipt) error {
+	meta := dbTx.Metadata()
+	var buf bytes.Buffer
+	if err := receipt.Serialize(&buf); err != nil {
+		return err
+	}
+	err := meta.Bucket(dbnamespace.ReceiptBucketName).Put(blockHash[:], buf.Bytes())
+	if err != nil {
+		return err
+	}
+	var key [4]byte
+	dbnamespace.ByteOrder.PutUint32(key[:], uint32(receipt.BlockNumber))
+	err = meta.Bucket(dbnamespace.ContractRootBucketName).Put(key[:],
+		receipt.StorageRoot[:])
+	if err != nil {
+		return err
+	}
+	err = dbRefStateRoot(dbTx, receipt.StorageRoot, 1)
+	if err != nil {
+		return err
+	}
+	return meta.Put(dbnamespace.ContractTipKeyName, receipt.StorageRoot[:])
+}
+
+// dbRemoveBlockReceipt uses an existing database transaction to remove the
+// receipt of the passed block and make the storage root of the previous block
+// order the contract tip.  It returns the new contract tip.
+func dbRemoveBlockReceipt(dbTx database.Tx, blockHash *hash.Hash, order uint64) (hash.Hash, error) {
+	meta := dbTx.Metadata()
+	err := meta.Bucket(dbnamespace.ReceiptBucketName).Delete(blockHash[:])
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	rootBucket := meta.Bucket(dbnamespace.ContractRootBucketName)
+	var key [4]byte
+	dbnamespace.ByteOrder.PutUint32(key[:], uint32(order))
+	var removed hash.Hash
+	copy(removed[:], rootBucket.Get(key[:]))
+	if err := rootBucket.Delete(key[:]); err != nil {
+		return hash.Hash{}, err
+	}
+	if err := dbRefStateRoot(dbTx, removed, -1); err != nil {
+		return hash.Hash{}, err
+	}
+	var root hash.Hash
+	if order > 0 {
+		dbnamespace.ByteOrder.PutUint32(key[:], uint32(order-1))
+		copy(root[:], rootBucket.Get(key[:]))
+	}
+	return root, meta.Put(dbnamespace.ContractTipKeyName, root[:])
+}
+
+// FetchBlockReceipt returns the receipt of the passed block, or nil when the
+// block is not connected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchBlockReceipt(blockHash *hash.Hash) (*types.BlockReceipt, error) {
+	var receipt *types.BlockReceipt
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		receipt, err = dbFetchBlockReceipt(dbTx, blockHash)
+		return err
+	})
+	return receipt, err
+}
+
+// dbFetchBlockReceipt uses an existing database transaction to fetch the
+// receipt of the passed block, or nil when the block has none.
+func dbFetchBlockReceipt(dbTx database.Tx, blockHash *hash.Hash) (*types.BlockReceipt, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.ReceiptBucketName)
+	if bucket == nil {
+		return nil, nil
+	}
+	serialized := bucket.Get(blockHash[:])
+	if serialized == nil {
+		return nil, nil
+	}
+	receipt := &types.BlockReceipt{}
+	if err := receipt.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// FetchContract returns the entry of the passed contract as of the last
+// connected block, or nil when the contract does not exist.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchContract(id types.ContractId) (*ContractEntry, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	t, err := trie.New(b.contractRoot, b.stateDB)
+	if err != nil {
+		return nil, err
+	}
+	return fetchContractEntry(t, id)
+}
@@ -0,0 +1,243 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database/statedb"
+	"github.com/Qitmeer/qitmeer/engine/vm"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/trie"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_ContractExecution(t *testing.T) {
+	engine, err := vm.GetEngine(vm.RefEngineName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BlockChain{
+		contractEngine: engine,
+		stateDB:        trie.NewDatabase(statedb.NewMemDatabase()),
+	}
+	tr, err := trie.New(hash.Hash{}, b.stateDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTx := func(txType types.TxType, payload *types.ContractPayload) *types.Tx {
+		mtx := types.NewTransaction()
+		mtx.SetTxType(txType)
+		mtx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{byte(txType)}, 0), nil))
+		script, err := ContractPayloadScript(payload.Bytes(txType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtx.AddTxOut(types.NewTxOutput(0, script))
+		if err := checkContractSanity(mtx); err != nil {
+			t.Fatal(err)
+		}
+		extracted, err := ExtractContractPayload(mtx)
+		if err != nil || !bytes.Equal(extracted.Bytes(txType), payload.Bytes(txType)) {
+			t.Fatalf("payload %v %v, want %v", extracted, err, payload)
+		}
+		return types.NewTx(mtx)
+	}
+	word := func(w uint64) []byte {
+		var b [vm.WordSize]byte
+		binary.BigEndian.PutUint64(b[:], w)
+		return b[:]
+	}
+	push := func(w uint64) []byte {
+		return append([]byte{vm.OP_PUSH}, word(w)...)
+	}
+
+	// Add the first input word to the counter at key 1 and log it.  The
+	// code is larger than a single push to test the chunked payload.
+	var code []byte
+	code = append(code, push(1)...)
+	code = append(code, vm.OP_SLOAD)
+	code = append(code, push(0)...)
+	code = append(code, vm.OP_INPUT, vm.OP_ADD, vm.OP_DUP, vm.OP_LOG)
+	code = append(code, push(1)...)
+	code = append(code, vm.OP_SSTORE, vm.OP_STOP)
+	code = append(code, make([]byte, 3000)...)
+
+	owner := []byte{0x51}
+	changed := make(map[string]struct{})
+	createTx := newTx(types.ContractCreate, &types.ContractPayload{
+		GasLimit: 10000,
+		Data:     code,
+	})
+	receipt, err := b.executeContract(tr, createTx, owner, 1, changed)
+	if err != nil || !receipt.Success || receipt.GasUsed != uint64(len(code)) {
+		t.Fatalf("create receipt %v %v", receipt, err)
+	}
+	id := receipt.Contract
+	if id != types.NewContractId(&createTx.Tx.TxIn[0].PreviousOut) {
+		t.Fatalf("contract id %v", id)
+	}
+
+	call := newTx(types.ContractUpdate, &types.ContractPayload{
+		GasLimit: 1000,
+		Contract: id,
+		Data:     word(5),
+	})
+	for i := uint64(1); i <= 2; i++ {
+		receipt, err = b.executeContract(tr, call, []byte{0x52}, 2, changed)
+		if err != nil || !receipt.Success || len(receipt.Events) != 1 ||
+			!bytes.Equal(receipt.Events[0], word(5*i)) {
+			t.Fatalf("call receipt %v %v", receipt, err)
+		}
+	}
+
+	// A call running out of gas fails without changing the storage.
+	receipt, err = b.executeContract(tr, newTx(types.ContractUpdate,
+		&types.ContractPayload{GasLimit: 10, Contract: id, Data: word(5)}),
+		[]byte{0x52}, 2, changed)
+	if err != nil || receipt.Success || receipt.GasUsed != 10 {
+		t.Fatalf("out of gas receipt %v %v", receipt, err)
+	}
+	value, err := tr.TryGet(contractStorageKey(id, word(1)))
+	if err != nil || !bytes.Equal(value, word(10)) {
+		t.Fatalf("counter %x %v, want %x", value, err, word(10))
+	}
+
+	// Only the owner may destroy the contract.
+	destroy := newTx(types.ContractDestroy, &types.ContractPayload{
+		GasLimit: 1,
+		Contract: id,
+	})
+	receipt, err = b.executeContract(tr, destroy, []byte{0x52}, 3, changed)
+	if err != nil || receipt.Success {
+		t.Fatalf("destroy by other %v %v", receipt, err)
+	}
+	receipt, err = b.executeContract(tr, destroy, owner, 3, changed)
+	if err != nil || !receipt.Success {
+		t.Fatalf("destroy by owner %v %v", receipt, err)
+	}
+	if entry, err := fetchContractEntry(tr, id); entry != nil || err != nil {
+		t.Fatalf("contract %v %v after destroy", entry, err)
+	}
+	empty, _ := trie.New(hash.Hash{}, b.stateDB)
+	if tr.Hash() != empty.Hash() {
+		t.Fatalf("storage left after destroy")
+	}
+	if calcChangeRoot(changed) == (hash.Hash{}) {
+		t.Fatalf("empty change root")
+	}
+}
+
+func Test_BlockReceiptSerialize(t *testing.T) {
+	receipt := &types.BlockReceipt{
+		BlockNumber: 7,
+		StorageRoot: hash.Hash{1},
+		ChangeRoot:  hash.Hash{2},
+		TxReceipts: []*types.TxReceipt{{
+			TxHash:   hash.Hash{3},
+			Contract: types.ContractId{4},
+			Success:  true,
+			GasUsed:  42,
+			Events:   []types.Event{{5, 6}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := receipt.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	serialized := buf.Bytes()
+	var decoded types.BlockReceipt
+	if err := decoded.Deserialize(bytes.NewReader(serialized)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.TxReceipts[0], receipt.TxReceipts[0]) {
+		t.Fatalf("decoded %v, want %v", decoded.TxReceipts[0], receipt.TxReceipts[0])
+	}
+	var reserialized bytes.Buffer
+	if err := decoded.Serialize(&reserialized); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reserialized.Bytes(), serialized) {
+		t.Fatalf("reserialized %x, want %x", reserialized.Bytes(), serialized)
+	}
+}
+
+func Test_ContractStateRoot(t *testing.T) {
+	// Only the contracts deployment gets active, it enables the check of the
+	// state root on its own.
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	deployments := append([]params.ConsensusDeployment{},
+		params.PrivNetParams.Deployments[testBlockVersion]...)
+	deployments[params.DeploymentStateRoot].StartTime = math.MaxInt64
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		testBlockVersion: deployments,
+	}
+	tc := newTestChain(t, &par)
+	defer tc.close()
+
+	for i := 0; ; i++ {
+		active, err := tc.IsDeploymentActive(params.DeploymentContracts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active {
+			break
+		}
+		if i > int(par.MinerConfirmationWindow)*4 {
+			t.Fatal("contracts deployment not active")
+		}
+		tc.mustProcessBlock(tc.newBlock(nil))
+	}
+	if active, _ := tc.IsDeploymentActive(params.DeploymentStateRoot); active {
+		t.Fatal("state root deployment active")
+	}
+
+	// The state root of a block extending the chain commits to the utxo set,
+	// the storage root and the receipts of the tip.
+	tips := tc.GetMiningTips()
+	tc.stateCache.reset()
+	root, err := tc.CalcStateRoot(tips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := tc.FetchBlockReceipt(tips[0])
+	if err != nil || receipt == nil {
+		t.Fatalf("receipt of tip %v %v", receipt, err)
+	}
+	receiptRoot := calcReceiptRoot(receipt)
+	var buf [hash.HashSize * 3]byte
+	copy(buf[:], tc.stateRoot[:])
+	copy(buf[hash.HashSize:], receipt.StorageRoot[:])
+	copy(buf[hash.HashSize*2:], receiptRoot[:])
+	if want := hash.DoubleHashH(buf[:]); root != want {
+		t.Fatalf("state root %v, want %v", root, want)
+	}
+
+	// Committing to the utxo set only is invalid.
+	block := tc.newBlock(tips)
+	block.Block().Header.StateRoot = tc.stateRoot
+	bad := types.NewBlock(block.Block())
+	if err := tc.processBlock(bad); err != nil {
+		t.Fatal(err)
+	}
+	if !tc.isInvalid(bad.Hash()) {
+		t.Fatal("block without the contract commitment is valid")
+	}
+	tc.mustProcessBlock(tc.newBlock(nil))
+
+	// The receipt root commits to every transaction receipt.
+	receipt = &types.BlockReceipt{TxReceipts: []*types.TxReceipt{
+		{TxHash: hash.Hash{1}, Success: true, GasUsed: 10},
+		{TxHash: hash.Hash{2}, Events: []types.Event{{3}}},
+	}}
+	receiptRoot = calcReceiptRoot(receipt)
+	receipt.TxReceipts[1].Events[0][0] = 4
+	if calcReceiptRoot(receipt) == receiptRoot {
+		t.Fatal("receipt root doesn't commit to the events")
+	}
+}
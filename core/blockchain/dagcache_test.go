@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func Test_DAGPaging(t *testing.T) {
+	tc := newTestChain(t, &params.PrivNetParams)
+	defer tc.close()
+
+	// Only a few dag blocks are kept in memory, so most of them are paged
+	// out while the blocks are processed.
+	tc.dagCacheSize = 4
+	tc.restart(0)
+	var blocks []*types.SerializedBlock
+	for i := 0; i < 30; i++ {
+		tips := tc.GetMiningTips()
+		block := tc.newBlock(tips)
+		tc.mustProcessBlock(block)
+		blocks = append(blocks, block)
+		// Fork every few blocks, the next block merges both sides.
+		if i%3 == 0 {
+			fork := tc.newBlock(tips)
+			tc.mustProcessBlock(fork)
+			blocks = append(blocks, fork)
+		}
+	}
+
+	// The same blocks get the same orders in a dag which keeps all of the
+	// blocks in memory.
+	mc := newTestChain(t, &params.PrivNetParams)
+	defer mc.close()
+	for _, block := range blocks {
+		mc.mustProcessBlock(block)
+	}
+	checkOrders := func(tc *testChain) {
+		t.Helper()
+		if !tc.bd.GetMainChainTip().GetHash().IsEqual(mc.bd.GetMainChainTip().GetHash()) {
+			t.Fatalf("main chain tip %v, want %v", tc.bd.GetMainChainTip().GetHash(),
+				mc.bd.GetMainChainTip().GetHash())
+		}
+		order := tc.bd.GetOrder()
+		if len(order) != len(mc.bd.GetOrder()) {
+			t.Fatalf("%d orders, want %d", len(order), len(mc.bd.GetOrder()))
+		}
+		for _, block := range blocks {
+			ib := tc.bd.GetBlock(block.Hash())
+			want := mc.bd.GetBlock(block.Hash())
+			if ib.GetOrder() != want.GetOrder() || ib.GetStatus() != want.GetStatus() {
+				t.Fatalf("block %v has order %d and status %d, want %d and %d",
+					block.Hash(), ib.GetOrder(), ib.GetStatus(), want.GetOrder(),
+					want.GetStatus())
+			}
+			if order[ib.GetOrder()] != ib.GetID() {
+				t.Fatalf("the order %d is block %d, want %d", ib.GetOrder(),
+					order[ib.GetOrder()], ib.GetID())
+			}
+		}
+	}
+	checkOrders(tc)
+
+	// Every changed dag block was written along with the chain state, so
+	// the paged out blocks are loaded the same after a restart.
+	tc.restart(0)
+	checkOrders(tc)
+	block := tc.newBlock([]*hash.Hash{blocks[len(blocks)-1].Hash()})
+	tc.mustProcessBlock(block)
+	mc.mustProcessBlock(block)
+	blocks = append(blocks, block)
+	checkOrders(tc)
+}
@@ -308,10 +308,22 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Create the buckets that house the asset registry and the
+		// asset balances.
+		err = dbCreateAssetBuckets(meta)
+		if err != nil {
+			return err
+		}
+
+		// Create the bucket that houses the dag children index.
+		err = blockdag.DBCreateDAGBuckets(meta)
+		if err != nil {
+			return err
+		}
+
 		// Add the genesis block to the block index.
-		ib := b.bd.GetBlock(&node.hash)
-		ib.SetStatus(blockdag.BlockStatus(node.status))
-		err = blockdag.DBPutDAGBlock(dbTx, ib)
+		b.bd.SetBlockStatus(&node.hash, blockdag.BlockStatus(node.status))
+		err = b.bd.WriteDirtyBlocks(dbTx)
 		if err != nil {
 			return err
 		}
@@ -345,7 +357,11 @@ func (b *BlockChain) createChainState() error {
 		// Store the genesis block into the database.
 		return dbTx.StoreBlock(genesisBlock)
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	b.bd.Commit()
+	return nil
 }
 
 // dbPutDatabaseInfo uses an existing database transaction to store the database
@@ -395,6 +411,20 @@ func dbPutDatabaseInfo(dbTx database.Tx, dbi *databaseInfo) error {
 		uint64Bytes(uint64(dbi.created.Unix())))
 }
 
+// dbIsPruned uses an existing database transaction to determine whether old
+// blocks have been pruned from the database.
+func dbIsPruned(dbTx database.Tx) bool {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BCDBInfoBucketName)
+	return bucket != nil && bucket.Get(dbnamespace.BCDBInfoPrunedKeyName) != nil
+}
+
+// dbPutPruned uses an existing database transaction to mark that old blocks
+// have been pruned from the database.
+func dbPutPruned(dbTx database.Tx) error {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BCDBInfoBucketName)
+	return bucket.Put(dbnamespace.BCDBInfoPrunedKeyName, []byte{1})
+}
+
 // -----------------------------------------------------------------------------
 // The block index consists of two buckets with an entry for every block in
 // the chain.  One bucket is for the hash to order mapping and the other
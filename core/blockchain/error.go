@@ -335,6 +335,35 @@ const (
 	// ErrNoViewpoint
 	ErrNoViewpoint
 
+	// ErrInvalidAssetTx indicates an asset transaction is malformed, such
+	// as an issuance that tags outputs with an asset other than the one it
+	// creates or a regular transaction that spends asset outputs.
+	ErrInvalidAssetTx
+
+	// ErrAssetNotConserved indicates the asset amounts of the inputs and
+	// outputs of a transaction do not balance as required by its type.
+	ErrAssetNotConserved
+
+	// ErrAssetUnauthorized indicates an asset revocation whose first input
+	// does not spend an output controlled by the issuer of the asset.
+	ErrAssetUnauthorized
+
+	// ErrUnknownAsset indicates a transaction references an asset that has
+	// never been issued.
+	ErrUnknownAsset
+
+	// ErrBadStateRoot indicates the state root committed in a block header
+	// does not match the utxo set after connecting the block.
+	ErrBadStateRoot
+
+	// ErrInvalidContractTx indicates a contract transaction is malformed,
+	// such as a missing or undecodable payload in its first output.
+	ErrInvalidContractTx
+
+	// ErrContractGasNotPaid indicates the fee of a contract transaction
+	// does not pay for the gas limit of its payload.
+	ErrContractGasNotPaid
+
 	// numErrorCodes is the maximum error code number used in tests.
 	numErrorCodes
 )
@@ -410,6 +439,15 @@ var errorCodeStrings = map[ErrorCode]string{
 
 	ErrNoBlueCoinbase: "ErrNoBlueCoinbase",
 	ErrNoViewpoint:    "ErrNoViewpoint",
+
+	ErrInvalidAssetTx:    "ErrInvalidAssetTx",
+	ErrAssetNotConserved: "ErrAssetNotConserved",
+	ErrAssetUnauthorized: "ErrAssetUnauthorized",
+	ErrUnknownAsset:      "ErrUnknownAsset",
+	ErrBadStateRoot:      "ErrBadStateRoot",
+
+	ErrInvalidContractTx:  "ErrInvalidContractTx",
+	ErrContractGasNotPaid: "ErrContractGasNotPaid",
 }
 
 // String returns the ErrorCode as a human-readable name.
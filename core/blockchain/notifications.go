@@ -77,12 +77,23 @@ type BlockAcceptedNotifyData struct {
 }
 
 // ReorganizationNotifyData is the structure for data indicating information
-// about a reorganization.
+// about a reorganization.  The old and new hashes and heights are those of the
+// main chain tip before and after the reorganization.
 type ReorganizationNotifyData struct {
 	OldHash   hash.Hash
 	OldHeight uint64
 	NewHash   hash.Hash
 	NewHeight uint64
+
+	// Blocks are the blocks which were connected again with a new order,
+	// in order.
+	Blocks []ReorderedBlock
+}
+
+// ReorderedBlock is a block whose order was changed by a reorganization.
+type ReorderedBlock struct {
+	Hash  hash.Hash
+	Order uint64
 }
 
 // Notification defines notification that is sent to the caller via the callback
@@ -2,25 +2,45 @@
 package blockchain
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/database"
 )
 
 // pruningIntervalInMinutes is the interval in which to prune the blockchain's
 // nodes and restore memory to the garbage collector.
 const pruningIntervalInMinutes = 5
 
+// minBlocksToKeep is the number of orders behind the main chain tip whose
+// blocks and spend journal entries are never pruned, because the blocks can
+// still be reordered by new blocks.
+const minBlocksToKeep = 2880
+
 // chainPruner is used to occasionally prune the blockchain of old nodes that
-// can be freed to the garbage collector.
+// can be freed to the garbage collector.  When a target size is configured,
+// it also deletes the old block data and spend journal entries.
 type chainPruner struct {
 	chain              *BlockChain
 	lastNodeInsertTime time.Time
+
+	// targetSize is the size in bytes the block files are pruned down to,
+	// zero disables pruning of the block data.
+	targetSize uint64
+
+	// minKeep is the number of orders behind the main chain tip whose
+	// blocks are kept, it is minBlocksToKeep out of the tests.
+	minKeep uint64
 }
 
 // newChainPruner returns a new chain pruner.
-func newChainPruner(chain *BlockChain) *chainPruner {
+func newChainPruner(chain *BlockChain, targetSize uint64) *chainPruner {
 	return &chainPruner{
 		chain:              chain,
 		lastNodeInsertTime: time.Now(),
+		targetSize:         targetSize,
+		minKeep:            minBlocksToKeep,
 	}
 }
 
@@ -35,4 +55,56 @@ func (c *chainPruner) pruneChainIfNeeded() {
 		return
 	}
 	c.lastNodeInsertTime = now
+
+	if c.targetSize > 0 {
+		if err := c.pruneBlocks(); err != nil {
+			log.Error("Unable to prune blocks", "error", err)
+		}
+	}
+}
+
+// keepBlock returns whether the data of the passed block is still needed,
+// which is the case for the blocks that are not ordered yet or can still be
+// reordered.
+//
+// This function MUST be called with the chainLock held.
+func (c *chainPruner) keepBlock(h *hash.Hash, tipOrder uint64) bool {
+	node := c.chain.index.LookupNode(h)
+	if node == nil || !node.IsOrdered() {
+		return true
+	}
+	return node.GetOrder()+c.minKeep > tipOrder
+}
+
+// pruneBlocks deletes the old block data until the block files are no larger
+// than the target size, and removes the spend journal entries of the blocks
+// which can no longer be reordered.
+//
+// This function MUST be called with the chainLock held for writes.
+func (c *chainPruner) pruneBlocks() error {
+	tipOrder := uint64(c.chain.bd.GetMainChainTip().GetOrder())
+	keep := func(h *hash.Hash) bool {
+		return c.keepBlock(h, tipOrder)
+	}
+	return c.chain.db.Update(func(dbTx database.Tx) error {
+		pruned, err := dbTx.PruneBlocks(c.targetSize, keep)
+		if err != nil {
+			return err
+		}
+		if len(pruned) > 0 {
+			if err := dbPutPruned(dbTx); err != nil {
+				return err
+			}
+			log.Info(fmt.Sprintf("Pruned %d old blocks", len(pruned)))
+		}
+
+		removed, err := dbPruneSpendJournal(dbTx, keep)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			log.Debug(fmt.Sprintf("Removed %d spend journal entries", removed))
+		}
+		return nil
+	})
 }
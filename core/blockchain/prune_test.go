@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/params"
+	"strings"
+	"testing"
+)
+
+func Test_PruneRestart(t *testing.T) {
+	tc := newTestChain(t, &params.PrivNetParams)
+	defer tc.close()
+
+	// Every block is written to its own file, so the old files can be
+	// pruned.
+	tc.blockFileSize = 1
+	tc.restart(1)
+	var hashes []*hash.Hash
+	for i := 0; i < 20; i++ {
+		block := tc.newBlock(nil)
+		tc.mustProcessBlock(block)
+		hashes = append(hashes, block.Hash())
+	}
+
+	const minKeep = 5
+	checkPruned := func() {
+		t.Helper()
+		tipOrder := uint64(tc.bd.GetMainChainTip().GetOrder())
+		err := tc.db.View(func(dbTx database.Tx) error {
+			for _, h := range hashes {
+				node := tc.index.LookupNode(h)
+				wantPruned := node.GetOrder()+minKeep <= tipOrder
+				_, err := dbFetchBlockByHash(dbTx, h)
+				if pruned := database.IsError(err, database.ErrBlockPruned); pruned != wantPruned {
+					t.Errorf("block %v of order %d: %v", h, node.GetOrder(), err)
+				}
+				if _, err := dbFetchHeaderByHash(dbTx, h); err != nil {
+					t.Errorf("header of block %v: %v", h, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tc.pruner.minKeep = minKeep
+	tc.ChainLock()
+	err := tc.pruner.pruneBlocks()
+	tc.ChainUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPruned()
+
+	// A pruned database can only be loaded with pruning enabled.
+	mainTip := *tc.bd.GetMainChainTip().GetHash()
+	tc.db.Close()
+	if err := tc.load(0); err == nil || !strings.Contains(err.Error(), "pruned") {
+		t.Fatalf("pruned database loaded without pruning: %v", err)
+	}
+
+	// The DAG is rebuilt from the headers of the pruned blocks.
+	tc.open(1)
+	if !tc.bd.GetMainChainTip().GetHash().IsEqual(&mainTip) {
+		t.Fatalf("main chain tip %v after restart, want %v",
+			tc.bd.GetMainChainTip().GetHash(), mainTip)
+	}
+	checkPruned()
+	tc.mustProcessBlock(tc.newBlock(nil))
+}
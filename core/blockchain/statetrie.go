@@ -0,0 +1,773 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/database/statedb"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/trie"
+	"math"
+	"sort"
+	"sync"
+)
+
+// errStateNodeNotFound is returned by the state trie database for missing
+// trie nodes.
+var errStateNodeNotFound = errors.New("state trie node not found")
+
+// stateTrieDB implements the statedb.Database interface on top of the state
+// trie bucket of the block database so the trie nodes are stored alongside
+// the utxo set they commit to.
+type stateTrieDB struct {
+	db database.DB
+
+	// tx is the database transaction updating the chain state while the
+	// trie nodes are flushed by flushStateTrie, nil otherwise.
+	tx database.Tx
+}
+
+// view runs the passed function with the metadata bucket in the database
+// transaction updating the chain state, or in a new read-only one.
+func (s *stateTrieDB) view(fn func(meta database.Bucket) error) error {
+	if s.tx != nil {
+		return fn(s.tx.Metadata())
+	}
+	return s.db.View(func(dbTx database.Tx) error {
+		return fn(dbTx.Metadata())
+	})
+}
+
+// update runs the passed function with the metadata bucket in the database
+// transaction updating the chain state, or in a new one.
+func (s *stateTrieDB) update(fn func(meta database.Bucket) error) error {
+	if s.tx != nil {
+		return fn(s.tx.Metadata())
+	}
+	return s.db.Update(func(dbTx database.Tx) error {
+		return fn(dbTx.Metadata())
+	})
+}
+
+// Put stores the passed trie node.
+func (s *stateTrieDB) Put(key []byte, value []byte) error {
+	return s.update(func(meta database.Bucket) error {
+		return dbPutStateNode(meta, key, value)
+	})
+}
+
+// Get returns a copy of the passed trie node.
+func (s *stateTrieDB) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.view(func(meta database.Bucket) error {
+		bucket := meta.Bucket(dbnamespace.StateTrieBucketName)
+		serialized := bucket.Get(key)
+		if serialized == nil {
+			return errStateNodeNotFound
+		}
+		value = make([]byte, len(serialized))
+		copy(value, serialized)
+		return nil
+	})
+	return value, err
+}
+
+// Has returns whether or not the passed trie node is stored.
+func (s *stateTrieDB) Has(key []byte) (bool, error) {
+	var exists bool
+	err := s.view(func(meta database.Bucket) error {
+		bucket := meta.Bucket(dbnamespace.StateTrieBucketName)
+		exists = bucket.Get(key) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// Delete removes the passed trie node.
+func (s *stateTrieDB) Delete(key []byte) error {
+	return s.update(func(meta database.Bucket) error {
+		return meta.Bucket(dbnamespace.StateTrieBucketName).Delete(key)
+	})
+}
+
+// Close does nothing since the block database is owned by the caller.
+func (s *stateTrieDB) Close() {}
+
+// NewBatch returns a batch writing all trie nodes in a single database
+// transaction.
+func (s *stateTrieDB) NewBatch() statedb.Batch {
+	return &stateTrieBatch{s: s}
+}
+
+// stateTrieBatch implements the statedb.Batch interface for stateTrieDB.
+type stateTrieBatch struct {
+	s      *stateTrieDB
+	keys   [][]byte
+	values [][]byte
+	size   int
+}
+
+// Put queues the passed trie node for writing.
+func (b *stateTrieBatch) Put(key []byte, value []byte) error {
+	b.keys = append(b.keys, append([]byte{}, key...))
+	b.values = append(b.values, append([]byte{}, value...))
+	b.size += len(value)
+	return nil
+}
+
+// ValueSize returns the amount of data queued.
+func (b *stateTrieBatch) ValueSize() int {
+	return b.size
+}
+
+// Write stores all queued trie nodes.
+func (b *stateTrieBatch) Write() error {
+	if len(b.keys) == 0 {
+		return nil
+	}
+	return b.s.update(func(meta database.Bucket) error {
+		for i, key := range b.keys {
+			err := dbPutStateNode(meta, key, b.values[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Reset drops all queued trie nodes.
+func (b *stateTrieBatch) Reset() {
+	b.keys = nil
+	b.values = nil
+	b.size = 0
+}
+
+// dbPutStateNode uses an existing metadata bucket to store the passed trie node
+// unless it is already stored.  A new node starts without references and adds
+// one to each of its children, which are always stored before it.  Keys which
+// are not node hashes, such as the preimages of the secure tries, are stored
+// without reference counts.
+func dbPutStateNode(meta database.Bucket, key []byte, value []byte) error {
+	nodes := meta.Bucket(dbnamespace.StateTrieBucketName)
+	if nodes.Get(key) != nil {
+		return nil
+	}
+	if err := nodes.Put(key, value); err != nil {
+		return err
+	}
+	if len(key) != hash.HashSize {
+		return nil
+	}
+	var serialized [4]byte
+	refs := meta.Bucket(dbnamespace.StateTrieRefsBucketName)
+	if err := refs.Put(key, serialized[:]); err != nil {
+		return err
+	}
+	children, err := trie.NodeChildren(value)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := dbRefStateNode(meta, child[:], 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRefStateNode uses an existing metadata bucket to add the passed delta to
+// the reference count of the passed trie node.  A node no longer referenced by
+// a stored node nor by a root of the chain state is deleted, which releases
+// its children in turn.  The nodes stored before the reference counts were
+// kept have none and are never deleted.
+func dbRefStateNode(meta database.Bucket, key []byte, delta int32) error {
+	refs := meta.Bucket(dbnamespace.StateTrieRefsBucketName)
+	serialized := refs.Get(key)
+	if serialized == nil {
+		return nil
+	}
+	count := int64(dbnamespace.ByteOrder.Uint32(serialized)) + int64(delta)
+	if count > 0 {
+		var buf [4]byte
+		dbnamespace.ByteOrder.PutUint32(buf[:], uint32(count))
+		return refs.Put(key, buf[:])
+	}
+
+	nodes := meta.Bucket(dbnamespace.StateTrieBucketName)
+	children, err := trie.NodeChildren(nodes.Get(key))
+	if err != nil {
+		return err
+	}
+	if err := nodes.Delete(key); err != nil {
+		return err
+	}
+	if err := refs.Delete(key); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := dbRefStateNode(meta, child[:], -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRefStateRoot uses an existing database transaction to add the passed delta
+// to the references of the passed trie root.  The chain state references the
+// state tip and the contract storage root of every block order, the nodes of
+// the other tries are deleted once nothing references them.
+func dbRefStateRoot(dbTx database.Tx, root hash.Hash, delta int32) error {
+	if root == (hash.Hash{}) {
+		return nil
+	}
+	return dbRefStateNode(dbTx.Metadata(), root[:], delta)
+}
+
+// serializeStateEntry returns the value committed to the state trie for the
+// passed utxo entry.  It is the serialized utxo entry without the hash of the
+// containing block, which is unknown while the block is being created.
+//
+//   <header code><asset id><compressed txout>
+func serializeStateEntry(entry *UtxoEntry) ([]byte, error) {
+	headerCode, err := utxoEntryHeaderCode(entry)
+	if err != nil {
+		return nil, err
+	}
+	size := serializeSizeVLQ(headerCode) +
+		compressedTxOutSize(entry.Amount(), entry.PkScript())
+	if !entry.asset.IsMeer() {
+		size += types.AssetIdSize
+	}
+	serialized := make([]byte, size)
+	offset := putVLQ(serialized, headerCode)
+	if !entry.asset.IsMeer() {
+		offset += copy(serialized[offset:], entry.asset[:])
+	}
+	putCompressedTxOut(serialized[offset:], entry.Amount(), entry.PkScript())
+	return serialized, nil
+}
+
+// stateChange is a change of the state trie: the value of an output is set,
+// or the output is deleted when the value is nil.
+type stateChange struct {
+	key   []byte
+	value []byte
+}
+
+// calcStateChanges returns the changes of the passed view to apply to the state
+// trie the same way dbPutUtxoView applies them to the utxo set.
+func calcStateChanges(view *UtxoViewpoint) ([]stateChange, error) {
+	var changes []stateChange
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+		key := outpointKey(outpoint)
+		change := stateChange{key: append([]byte{}, *key...)}
+		recycleOutpointKey(key)
+		if !entry.IsSpent() {
+			var err error
+			change.value, err = serializeStateEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// applyStateChanges applies the passed changes to the state trie.
+func applyStateChanges(t *trie.Trie, changes []stateChange) error {
+	for _, change := range changes {
+		var err error
+		if change.value == nil {
+			err = t.TryDelete(change.key)
+		} else {
+			err = t.TryUpdate(change.key, change.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStateTrie applies the changes of the passed view to the state trie the
+// same way dbPutUtxoView applies them to the utxo set.
+func updateStateTrie(t *trie.Trie, view *UtxoViewpoint) error {
+	changes, err := calcStateChanges(view)
+	if err != nil {
+		return err
+	}
+	return applyStateChanges(t, changes)
+}
+
+// maxStateTrieCacheEntries is the maximum number of main parent roots and of
+// block reverts kept by the state trie cache.
+const maxStateTrieCacheEntries = 256
+
+// stateTrieCache caches the state roots of the main parents the blocks and the
+// block templates commit to, and the changes reverting the connected blocks.
+// The state of a main parent only depends on its past, so it is computed once
+// and the blocks ordered after it are only read from the database the first
+// time they are reverted.  The cache is reset when a block is disconnected
+// since the orders of the blocks change.
+type stateTrieCache struct {
+	mtx     sync.Mutex
+	roots   map[hash.Hash]hash.Hash
+	reverts map[hash.Hash][]stateChange
+}
+
+// newStateTrieCache returns an empty state trie cache.
+func newStateTrieCache() *stateTrieCache {
+	return &stateTrieCache{
+		roots:   make(map[hash.Hash]hash.Hash),
+		reverts: make(map[hash.Hash][]stateChange),
+	}
+}
+
+// root returns the cached state root of the passed main parent.
+func (c *stateTrieCache) root(mainParent *hash.Hash) (hash.Hash, bool) {
+	c.mtx.Lock()
+	root, ok := c.roots[*mainParent]
+	c.mtx.Unlock()
+	return root, ok
+}
+
+// addRoot caches the state root of the passed main parent, evicting a random
+// entry when the cache is full.
+func (c *stateTrieCache) addRoot(mainParent *hash.Hash, root hash.Hash) {
+	c.mtx.Lock()
+	if len(c.roots) >= maxStateTrieCacheEntries {
+		for h := range c.roots {
+			delete(c.roots, h)
+			break
+		}
+	}
+	c.roots[*mainParent] = root
+	c.mtx.Unlock()
+}
+
+// revert returns the cached changes reverting the passed block.
+func (c *stateTrieCache) revert(blockHash *hash.Hash) ([]stateChange, bool) {
+	c.mtx.Lock()
+	changes, ok := c.reverts[*blockHash]
+	c.mtx.Unlock()
+	return changes, ok
+}
+
+// addRevert caches the changes reverting the passed block, evicting a random
+// entry when the cache is full.
+func (c *stateTrieCache) addRevert(blockHash *hash.Hash, changes []stateChange) {
+	c.mtx.Lock()
+	if len(c.reverts) >= maxStateTrieCacheEntries {
+		for h := range c.reverts {
+			delete(c.reverts, h)
+			break
+		}
+	}
+	c.reverts[*blockHash] = changes
+	c.mtx.Unlock()
+}
+
+// reset empties the cache.
+func (c *stateTrieCache) reset() {
+	c.mtx.Lock()
+	c.roots = make(map[hash.Hash]hash.Hash)
+	c.reverts = make(map[hash.Hash][]stateChange)
+	c.mtx.Unlock()
+}
+
+// initStateTrie loads the state trie as of the last connected block.  The
+// trie is built from the utxo set when the database does not contain it yet.
+func (b *BlockChain) initStateTrie() error {
+	b.stateDB = trie.NewDatabase(&stateTrieDB{db: b.db})
+	b.stateCache = newStateTrieCache()
+
+	var root *hash.Hash
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		_, err := meta.CreateBucketIfNotExists(dbnamespace.StateTrieBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucketIfNotExists(dbnamespace.StateTrieRefsBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucketIfNotExists(dbnamespace.StateRootBucketName)
+		if err != nil {
+			return err
+		}
+		if serialized := meta.Get(dbnamespace.StateTipKeyName); serialized != nil {
+			root, err = hash.NewHash(serialized)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if root != nil {
+		b.stateRoot = *root
+		return nil
+	}
+
+	log.Info("Building state trie from the utxo set ...")
+	t, err := trie.New(hash.Hash{}, b.stateDB)
+	if err != nil {
+		return err
+	}
+	err = b.db.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		return utxoBucket.ForEach(func(k, v []byte) error {
+			entry, err := DeserializeUtxoEntry(v)
+			if err != nil {
+				return err
+			}
+			serialized, err := serializeStateEntry(entry)
+			if err != nil {
+				return err
+			}
+			return t.TryUpdate(k, serialized)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	newRoot, err := b.commitStateTrie(t)
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := b.flushStateTrie(dbTx, newRoot)
+		if err != nil {
+			return err
+		}
+		return dbPutStateTip(dbTx, &newRoot)
+	})
+	if err != nil {
+		return err
+	}
+	b.stateRoot = newRoot
+	log.Info(fmt.Sprintf("State trie built: root=%v", newRoot))
+	return nil
+}
+
+// commitStateTrie commits the nodes of the passed trie to the trie database and
+// returns its root.  The nodes stay in memory until flushStateTrie writes them
+// along with the chain state referencing the root.
+func (b *BlockChain) commitStateTrie(t *trie.Trie) (hash.Hash, error) {
+	return t.Commit(nil)
+}
+
+// flushStateTrie uses an existing database transaction to write the nodes of
+// the passed roots committed to the trie database.  Roots which were flushed
+// before and the roots of empty tries are skipped.
+func (b *BlockChain) flushStateTrie(dbTx database.Tx, roots ...hash.Hash) error {
+	if disk, ok := b.stateDB.DiskDB().(*stateTrieDB); ok {
+		disk.tx = dbTx
+		defer func() {
+			disk.tx = nil
+		}()
+	}
+	for _, root := range roots {
+		if root == (hash.Hash{}) {
+			continue
+		}
+		err := b.stateDB.Commit(root, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mainStateRoot returns the state root of the utxo set as of the passed main
+// parent, that is the utxo set of its past after connecting it.  It is the
+// state as of the last connected block with the changes of the blocks ordered
+// before the passed order which are not in the past of the main parent
+// reverted, so it doesn't depend on how the blocks of the DAG are ordered
+// around the main parent.  Blocks which failed validation changed nothing and
+// are skipped.
+//
+// The passed order is the one of the block being connected, all the connected
+// blocks are ordered before it, so the root only depends on the main parent
+// and is cached until a block is disconnected.
+//
+// Once the contracts deployment is active, the returned root also commits to
+// the contract storage and receipts of the main parent, see contractStateRoot.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) mainStateRoot(mainParent *blockNode, order uint64) (hash.Hash, error) {
+	if !mainParent.IsOrdered() {
+		return hash.Hash{}, AssertError(fmt.Sprintf("main parent %v is "+
+			"not ordered", mainParent.GetHash()))
+	}
+	if root, ok := b.stateCache.root(mainParent.GetHash()); ok {
+		return root, nil
+	}
+	t, err := trie.New(b.stateRoot, b.stateDB)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+
+	// The blocks ordered after the main parent are not in its past, and
+	// neither is the anticone ordered before it.
+	var nodes BlockNodeList
+	addNode := func(h *hash.Hash) {
+		node := b.index.LookupNode(h)
+		if node == nil || !node.IsOrdered() || node.GetOrder() >= order ||
+			b.index.NodeStatus(node).KnownInvalid() {
+			return
+		}
+		nodes = append(nodes, node)
+	}
+	for o := mainParent.GetOrder() + 1; o < order; o++ {
+		h := b.bd.GetBlockByOrder(uint(o))
+		if h == nil {
+			break
+		}
+		addNode(h)
+	}
+	anticone, err := b.bd.GetAnticone(mainParent.GetHash())
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	for _, h := range anticone {
+		if node := b.index.LookupNode(h); node != nil &&
+			node.GetOrder() < mainParent.GetOrder() {
+			addNode(h)
+		}
+	}
+	sort.Sort(sort.Reverse(nodes))
+
+	for _, node := range nodes {
+		changes, err := b.revertStateChanges(node)
+		if err != nil {
+			return hash.Hash{}, err
+		}
+		err = applyStateChanges(t, changes)
+		if err != nil {
+			return hash.Hash{}, err
+		}
+	}
+	root := t.Hash()
+	active, err := b.isDeploymentActive(mainParent, params.DeploymentContracts)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	if active {
+		root, err = b.contractStateRoot(mainParent, root)
+		if err != nil {
+			return hash.Hash{}, err
+		}
+	}
+	b.stateCache.addRoot(mainParent.GetHash(), root)
+	return root, nil
+}
+
+// contractStateRoot returns the state root committing to the passed root of
+// the utxo set along with the storage root and the receipt root of the passed
+// main parent.  Unlike the utxo set, the contracts of the main parent were
+// executed on top of the blocks ordered before it, so the root only stays the
+// same through the reorganizations which keep the order of its past.  Blocks
+// connected without a receipt executed no contracts.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) contractStateRoot(mainParent *blockNode, utxoRoot hash.Hash) (hash.Hash, error) {
+	var receipt *types.BlockReceipt
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		receipt, err = dbFetchBlockReceipt(dbTx, mainParent.GetHash())
+		return err
+	})
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	if receipt == nil {
+		receipt = &types.BlockReceipt{}
+	}
+	receiptRoot := calcReceiptRoot(receipt)
+	var buf [hash.HashSize * 3]byte
+	copy(buf[:], utxoRoot[:])
+	copy(buf[hash.HashSize:], receipt.StorageRoot[:])
+	copy(buf[hash.HashSize*2:], receiptRoot[:])
+	return hash.DoubleHashH(buf[:]), nil
+}
+
+// revertStateChanges returns the changes of the state trie reverting the passed
+// connected block.  They are read from the block and its spend journal the
+// first time and cached.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) revertStateChanges(node *blockNode) ([]stateChange, error) {
+	if changes, ok := b.stateCache.revert(node.GetHash()); ok {
+		return changes, nil
+	}
+	block, err := b.fetchBlockByHash(node.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	block.SetOrder(node.GetOrder())
+	b.CalculateDAGDuplicateTxs(block)
+	stxos, err := b.fetchSpendJournal(block)
+	if err != nil {
+		return nil, err
+	}
+	view := NewUtxoViewpoint()
+	err = view.disconnectTransactions(block, stxos, b)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := calcStateChanges(view)
+	if err != nil {
+		return nil, err
+	}
+	b.stateCache.addRevert(node.GetHash(), changes)
+	return changes, nil
+}
+
+// CalcStateRoot returns the state root a block with the passed parents has to
+// commit to.  It is the root of the utxo set as of the main parent of the
+// block, so it only depends on the parents and stays the same however the
+// block is ordered with the blocks of its anticone.  Once the contracts
+// deployment is active it also commits to the contract storage and receipts
+// of the main parent.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcStateRoot(parents []*hash.Hash) (hash.Hash, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	mainParent := b.bd.GetMainParent(b.bd.GetIdSet(parents))
+	if mainParent == nil {
+		return hash.Hash{}, AssertError(fmt.Sprintf("no main parent "+
+			"in %v", parents))
+	}
+	return b.mainStateRoot(b.index.LookupNode(mainParent.GetHash()),
+		math.MaxUint64)
+}
+
+// connectStateTrie applies the changes of the passed view to the state trie and
+// commits it to the trie database.  The returned root only becomes the state
+// tip once its nodes were flushed and it was stored with dbPutStateRoot.
+func (b *BlockChain) connectStateTrie(view *UtxoViewpoint) (hash.Hash, error) {
+	t, err := trie.New(b.stateRoot, b.stateDB)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	err = updateStateTrie(t, view)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return b.commitStateTrie(t)
+}
+
+// checkStateRoot ensures the state root committed in the header of the block
+// being connected matches the utxo set as of its main parent once the state
+// root deployment is active.  The root doesn't depend on the order of the
+// blocks, so a block keeps its validity through the reorganizations of the
+// DAG.  Once the contracts deployment is active, the root must also match the
+// contract storage and receipts of the main parent.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkStateRoot(node *blockNode, block *types.SerializedBlock) error {
+	mainParent := node.GetMainParent(b)
+	active, err := b.isDeploymentActive(mainParent, params.DeploymentStateRoot)
+	if err != nil {
+		return err
+	}
+	if !active {
+		active, err = b.isDeploymentActive(mainParent,
+			params.DeploymentContracts)
+		if err != nil || !active {
+			return err
+		}
+	}
+	root, err := b.mainStateRoot(mainParent, node.GetOrder())
+	if err != nil {
+		return err
+	}
+	header := &block.Block().Header
+	if !header.StateRoot.IsEqual(&root) {
+		str := fmt.Sprintf("block state root is invalid - block "+
+			"header indicates %v, but calculated value is %v",
+			header.StateRoot, root)
+		return ruleError(ErrBadStateRoot, str)
+	}
+	return nil
+}
+
+// dbPutStateTip uses an existing database transaction to make the passed root
+// the state tip.  The trie of the previous tip is released, so its nodes which
+// are not part of the new one are deleted.
+func dbPutStateTip(dbTx database.Tx, root *hash.Hash) error {
+	meta := dbTx.Metadata()
+	var prevRoot hash.Hash
+	copy(prevRoot[:], meta.Get(dbnamespace.StateTipKeyName))
+	if err := dbRefStateRoot(dbTx, *root, 1); err != nil {
+		return err
+	}
+	if err := dbRefStateRoot(dbTx, prevRoot, -1); err != nil {
+		return err
+	}
+	return meta.Put(dbnamespace.StateTipKeyName, root[:])
+}
+
+// dbPutStateRoot uses an existing database transaction to store the state root
+// of the passed block order and make it the state tip.
+func dbPutStateRoot(dbTx database.Tx, order uint64, root *hash.Hash) error {
+	meta := dbTx.Metadata()
+	var key [4]byte
+	dbnamespace.ByteOrder.PutUint32(key[:], uint32(order))
+	err := meta.Bucket(dbnamespace.StateRootBucketName).Put(key[:], root[:])
+	if err != nil {
+		return err
+	}
+	return dbPutStateTip(dbTx, root)
+}
+
+// dbRemoveStateRoot uses an existing database transaction to remove the state
+// root of the passed block order and make the passed root the state tip.
+func dbRemoveStateRoot(dbTx database.Tx, order uint64, root *hash.Hash) error {
+	meta := dbTx.Metadata()
+	var key [4]byte
+	dbnamespace.ByteOrder.PutUint32(key[:], uint32(order))
+	err := meta.Bucket(dbnamespace.StateRootBucketName).Delete(key[:])
+	if err != nil {
+		return err
+	}
+	return dbPutStateTip(dbTx, root)
+}
+
+// FetchStateRoot returns the state root of the utxo set after the block with
+// the passed order was connected, or nil when it is unknown.  Only the nodes
+// of the trie of the last connected block are kept, the older roots can't be
+// opened.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchStateRoot(order uint64) (*hash.Hash, error) {
+	var root *hash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.StateRootBucketName)
+		if bucket == nil {
+			return nil
+		}
+		var key [4]byte
+		dbnamespace.ByteOrder.PutUint32(key[:], uint32(order))
+		serialized := bucket.Get(key[:])
+		if serialized == nil {
+			return nil
+		}
+		var err error
+		root, err = hash.NewHash(serialized)
+		return err
+	})
+	return root, err
+}
@@ -0,0 +1,238 @@
+package blockchain
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/database/statedb"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/trie"
+	"math"
+	"testing"
+)
+
+func Test_StateTrieRoot(t *testing.T) {
+	mtx := types.NewTransaction()
+	mtx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	mtx.AddTxOut(types.NewTxOutput(100, []byte{0x51}))
+	mtx.AddTxOut(types.NewTxOutput(200, []byte{0x52}))
+	tx := types.NewTx(mtx)
+
+	newTrie := func() *trie.Trie {
+		tr, err := trie.New(hash.Hash{}, trie.NewDatabase(statedb.NewMemDatabase()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+	empty := newTrie().Hash()
+
+	// The root must not depend on the block containing the outputs.
+	viewA := NewUtxoViewpoint()
+	viewA.AddTxOuts(tx, &hash.Hash{0xa})
+	trieA := newTrie()
+	if err := updateStateTrie(trieA, viewA); err != nil {
+		t.Fatal(err)
+	}
+	viewB := NewUtxoViewpoint()
+	viewB.AddTxOuts(tx, &hash.Hash{0xb})
+	trieB := newTrie()
+	if err := updateStateTrie(trieB, viewB); err != nil {
+		t.Fatal(err)
+	}
+	if trieA.Hash() != trieB.Hash() {
+		t.Fatalf("state root depends on block hash: %v != %v", trieA.Hash(), trieB.Hash())
+	}
+	if trieA.Hash() == empty {
+		t.Fatal("state root unchanged after adding outputs")
+	}
+
+	// Spending every output restores the empty root.
+	for i := range mtx.TxOut {
+		viewA.LookupEntry(*types.NewOutPoint(tx.Hash(), uint32(i))).Spend()
+	}
+	if err := updateStateTrie(trieA, viewA); err != nil {
+		t.Fatal(err)
+	}
+	if trieA.Hash() != empty {
+		t.Fatalf("state root %v after spending all outputs, want %v", trieA.Hash(), empty)
+	}
+}
+
+func Test_StateRootDeployment(t *testing.T) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		testBlockVersion: params.PrivNetParams.Deployments[testBlockVersion],
+	}
+	tc := newTestChain(t, &par)
+	defer tc.close()
+
+	// The state root isn't checked before the deployment is active.
+	block := tc.newBlock(nil)
+	block.Block().Header.StateRoot = hash.Hash{1}
+	tc.mustProcessBlock(types.NewBlock(block.Block()))
+
+	for i := 0; ; i++ {
+		active, err := tc.IsDeploymentActive(params.DeploymentStateRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active {
+			break
+		}
+		if i > int(par.MinerConfirmationWindow)*4 {
+			t.Fatal("state root deployment not active")
+		}
+		tc.mustProcessBlock(tc.newBlock(nil))
+	}
+
+	// Blocks have to commit to the state root once it is active.
+	block = tc.newBlock(nil)
+	block.Block().Header.StateRoot = hash.Hash{1}
+	bad := types.NewBlock(block.Block())
+	if err := tc.processBlock(bad); err != nil {
+		t.Fatal(err)
+	}
+	if !tc.isInvalid(bad.Hash()) {
+		t.Fatal("block with a bad state root is valid")
+	}
+
+	// The root of a block only depends on its past, so it stays valid when
+	// a block of its anticone is ordered before it.
+	parents := tc.GetMiningTips()
+	blockA := tc.newBlock(parents)
+	blockB := tc.newBlock(parents)
+	tc.mustProcessBlock(blockA)
+	tc.mustProcessBlock(blockB)
+	tc.mustProcessBlock(tc.newBlock(nil))
+
+	// The trie nodes are stored along with the chain state.
+	tc.restart(0)
+	tc.mustProcessBlock(tc.newBlock(nil))
+}
+
+func Test_StateTriePruning(t *testing.T) {
+	tc := newTestChain(t, &params.PrivNetParams)
+	defer tc.close()
+
+	// checkNodes ensures the stored trie nodes are exactly the ones of the
+	// state tip.
+	checkNodes := func() {
+		t.Helper()
+		tr, err := trie.New(tc.stateRoot, tc.stateDB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reachable := make(map[hash.Hash]struct{})
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if h := it.Hash(); h != (hash.Hash{}) {
+				reachable[h] = struct{}{}
+			}
+		}
+		if it.Error() != nil {
+			t.Fatal(it.Error())
+		}
+		stored := make(map[hash.Hash]struct{})
+		err = tc.db.View(func(dbTx database.Tx) error {
+			meta := dbTx.Metadata()
+			refs := meta.Bucket(dbnamespace.StateTrieRefsBucketName)
+			err := meta.Bucket(dbnamespace.StateTrieBucketName).ForEach(
+				func(k, v []byte) error {
+					if refs.Get(k) == nil {
+						t.Fatalf("trie node %x has no reference count", k)
+					}
+					stored[hash.MustBytesToHash(k)] = struct{}{}
+					return nil
+				})
+			if err != nil {
+				return err
+			}
+			return refs.ForEach(func(k, v []byte) error {
+				if _, ok := stored[hash.MustBytesToHash(k)]; !ok {
+					t.Fatalf("reference count of missing node %x", k)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != len(reachable) {
+			t.Fatalf("%d trie nodes stored, want %d", len(stored), len(reachable))
+		}
+		for h := range reachable {
+			if _, ok := stored[h]; !ok {
+				t.Fatalf("trie node %v of the state tip is missing", h)
+			}
+		}
+	}
+	checkNodes()
+
+	// The nodes of the previous state tips are deleted as the blocks are
+	// connected, reorganized and disconnected.
+	for i := 0; i < 20; i++ {
+		tips := tc.GetMiningTips()
+		tc.mustProcessBlock(tc.newBlock(tips))
+		if i%4 == 0 {
+			tc.mustProcessBlock(tc.newBlock(tips))
+		}
+		checkNodes()
+	}
+	tc.restart(0)
+	checkNodes()
+	tc.mustProcessBlock(tc.newBlock(nil))
+	checkNodes()
+}
+
+func Test_StateRootCache(t *testing.T) {
+	tc := newTestChain(t, &params.PrivNetParams)
+	defer tc.close()
+	var blocks []*types.SerializedBlock
+	for i := 0; i < 10; i++ {
+		block := tc.newBlock(nil)
+		tc.mustProcessBlock(block)
+		blocks = append(blocks, block)
+	}
+
+	// The state of a main parent ordered before the last block is the
+	// state after connecting it, the blocks ordered after it are reverted.
+	// Its root was cached when the next block was created.
+	node := tc.index.LookupNode(blocks[4].Hash())
+	want, err := tc.FetchStateRoot(node.GetOrder())
+	if err != nil || want == nil {
+		t.Fatalf("no state root for order %d: %v", node.GetOrder(), err)
+	}
+	if cached, ok := tc.stateCache.root(node.GetHash()); !ok || cached != *want {
+		t.Fatalf("state root of the main parent not cached")
+	}
+	tc.stateCache.reset()
+	root, err := tc.mainStateRoot(node, math.MaxUint64)
+	if err != nil || root != *want {
+		t.Fatalf("state root %v, want %v: %v", root, want, err)
+	}
+
+	// The root is cached again along with the changes reverting the
+	// blocks ordered after the main parent.
+	if cached, ok := tc.stateCache.root(node.GetHash()); !ok || cached != root {
+		t.Fatalf("state root of the main parent not cached")
+	}
+	for _, block := range blocks[5:] {
+		if _, ok := tc.stateCache.revert(block.Hash()); !ok {
+			t.Fatalf("revert of block %v not cached", block.Hash())
+		}
+	}
+	tc.stateCache.roots = make(map[hash.Hash]hash.Hash)
+	if root, err := tc.mainStateRoot(node, math.MaxUint64); err != nil ||
+		root != *want {
+		t.Fatalf("state root %v from the cached reverts, want %v", root, want)
+	}
+	tc.stateCache.reset()
+	if root, err := tc.mainStateRoot(node, math.MaxUint64); err != nil ||
+		root != *want {
+		t.Fatalf("state root %v from the database, want %v", root, want)
+	}
+}
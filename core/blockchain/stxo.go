@@ -58,6 +58,9 @@ const SpentTxOutTxInIndexSize = 4
 //   bits 2-3 - transaction type
 //   bit  4   - is fully spent
 //
+// The header code of each entry sets bit 1 when the spent output carries an
+// asset identifier, which is then serialized behind the original amount.
+//
 // The stake extra field contains minimally encoded outputs for all
 // consensus-related outputs in the stake transaction. It is only
 // encoded for tickets.
@@ -85,10 +88,11 @@ type SpentTxOut struct {
 	Amount     uint64 // The total amount of the output.
 	PkScript   []byte // The public key script for the output.
 	BlockHash  hash.Hash
-	IsCoinBase bool   // Whether creating tx is a coinbase.
-	TxIndex    uint32 // The index of tx in block.
-	TxInIndex  uint32 // The index of TxInput in the tx.
-	OriAmount  uint64 // The original amount of the output.
+	IsCoinBase bool          // Whether creating tx is a coinbase.
+	TxIndex    uint32        // The index of tx in block.
+	TxInIndex  uint32        // The index of TxInput in the tx.
+	OriAmount  uint64        // The original amount of the output.
+	Asset      types.AssetId // The asset the amount is denominated in.
 }
 
 func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
@@ -99,6 +103,9 @@ func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
 	if stxo.IsCoinBase {
 		headerCode |= 0x01
 	}
+	if !stxo.Asset.IsMeer() {
+		headerCode |= 0x02
+	}
 
 	return headerCode
 }
@@ -113,6 +120,9 @@ func spentTxOutSerializeSize(stxo *SpentTxOut) int {
 	size += hash.HashSize
 	size += SpentTxOutTxIndexSize + SpentTxOutTxInIndexSize
 	size += 8
+	if !stxo.Asset.IsMeer() {
+		size += types.AssetIdSize
+	}
 	return size + compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
 }
 
@@ -132,6 +142,9 @@ func putSpentTxOut(target []byte, stxo *SpentTxOut) int {
 	offset += SpentTxOutTxInIndexSize
 	byteOrder.PutUint64(target[offset:], stxo.OriAmount)
 	offset += 8
+	if !stxo.Asset.IsMeer() {
+		offset += copy(target[offset:], stxo.Asset[:])
+	}
 	return offset + putCompressedTxOut(target[offset:], uint64(stxo.Amount), stxo.PkScript)
 }
 
@@ -163,8 +176,9 @@ func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
 	// Decode the header code.
 	//
 	// Bit 0 indicates containing transaction is a coinbase.
-	// Bits 1-x encode height of containing transaction.
+	// Bit 1 indicates the output carries an asset identifier.
 	stxo.IsCoinBase = code&0x01 != 0
+	hasAsset := code&0x02 != 0
 
 	stxo.BlockHash.SetBytes(serialized[offset : offset+hash.HashSize])
 	offset += hash.HashSize
@@ -175,6 +189,14 @@ func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
 	offset += SpentTxOutTxInIndexSize
 	stxo.OriAmount = uint64(byteOrder.Uint64(serialized[offset : offset+8]))
 	offset += 8
+	if hasAsset {
+		if len(serialized[offset:]) < types.AssetIdSize {
+			return offset, errDeserialize("unexpected end of data " +
+				"after original amount")
+		}
+		copy(stxo.Asset[:], serialized[offset:offset+types.AssetIdSize])
+		offset += types.AssetIdSize
+	}
 	// Decode the compressed txout.
 	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
 		serialized[offset:])
@@ -310,6 +332,30 @@ func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *hash.Hash) error {
 	return spendBucket.Delete(blockHash[:])
 }
 
+// dbPruneSpendJournal uses an existing database transaction to remove the spend
+// journal entries of all of the blocks the keep function returns false for.
+func dbPruneSpendJournal(dbTx database.Tx, keep func(hash *hash.Hash) bool) (int, error) {
+	spendBucket := dbTx.Metadata().Bucket(dbnamespace.SpendJournalBucketName)
+	var removed []hash.Hash
+	err := spendBucket.ForEach(func(k, v []byte) error {
+		var blockHash hash.Hash
+		copy(blockHash[:], k)
+		if !keep(&blockHash) {
+			removed = append(removed, blockHash)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i := range removed {
+		if err := dbRemoveSpendJournalEntry(dbTx, &removed[i]); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), nil
+}
+
 func GetStxo(txIndex uint32, txInIndex uint32, stxos []SpentTxOut) *SpentTxOut {
 	for _, stxo := range stxos {
 		if stxo.TxIndex == txIndex &&
@@ -0,0 +1,358 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"sync"
+)
+
+// ThresholdState define the various threshold states used when voting on
+// consensus changes.
+type ThresholdState byte
+
+// These constants are used to identify specific threshold states.
+const (
+	// ThresholdDefined is the first state for each deployment and is the
+	// state for the genesis block has by definition for all deployments.
+	ThresholdDefined ThresholdState = iota
+
+	// ThresholdStarted is the state for a deployment once its start time
+	// has been reached.
+	ThresholdStarted
+
+	// ThresholdLockedIn is the state for a deployment during the retarget
+	// period which is after the ThresholdStarted state period and the
+	// number of blocks that have voted for the deployment equal or exceed
+	// the required number of votes for the deployment.
+	ThresholdLockedIn
+
+	// ThresholdActive is the state for a deployment for all blocks after a
+	// retarget period in which the deployment was in the ThresholdLockedIn
+	// state.
+	ThresholdActive
+
+	// ThresholdFailed is the state for a deployment once its expiration
+	// time has been reached and it did not reach the ThresholdLockedIn
+	// state.
+	ThresholdFailed
+
+	// numThresholdsStates is the maximum number of threshold states used in
+	// tests.
+	numThresholdsStates
+)
+
+// thresholdStateStrings is a map of ThresholdState values back to their
+// constant names for pretty printing.
+var thresholdStateStrings = map[ThresholdState]string{
+	ThresholdDefined:  "ThresholdDefined",
+	ThresholdStarted:  "ThresholdStarted",
+	ThresholdLockedIn: "ThresholdLockedIn",
+	ThresholdActive:   "ThresholdActive",
+	ThresholdFailed:   "ThresholdFailed",
+}
+
+// String returns the ThresholdState as a human-readable name.
+func (t ThresholdState) String() string {
+	if s := thresholdStateStrings[t]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown ThresholdState (%d)", int(t))
+}
+
+// thresholdConditionChecker provides a generic interface that is invoked to
+// determine when a consensus rule change threshold should be changed.
+type thresholdConditionChecker interface {
+	// BeginTime returns the unix timestamp for the median block time after
+	// which voting on a rule change starts (at the next window).
+	BeginTime() uint64
+
+	// EndTime returns the unix timestamp for the median block time after
+	// which an attempted rule change fails if it has not already been
+	// locked in or activated.
+	EndTime() uint64
+
+	// RuleChangeActivationThreshold is the number of blocks for which the
+	// condition must be true in order to lock in a rule change.
+	RuleChangeActivationThreshold() uint32
+
+	// MinerConfirmationWindow is the number of blocks in each threshold
+	// state retarget window.
+	MinerConfirmationWindow() uint32
+
+	// Condition returns whether or not the rule change activation condition
+	// has been met.  This typically involves checking whether or not the
+	// bit associated with the condition is set, but can be more complex as
+	// needed.
+	Condition(*blockNode) (bool, error)
+}
+
+// thresholdStateCache provides a type to cache the threshold states of each
+// threshold window for a set of IDs.  The states only depend on the main
+// chain leading to a window, so they never change once calculated and are
+// simply recalculated after a restart.
+type thresholdStateCache struct {
+	lock    sync.Mutex
+	entries map[hash.Hash]ThresholdState
+}
+
+// Lookup returns the threshold state associated with the given hash along with
+// a boolean that indicates whether or not it is valid.
+//
+// This function is safe for concurrent access.
+func (c *thresholdStateCache) Lookup(hash *hash.Hash) (ThresholdState, bool) {
+	c.lock.Lock()
+	state, ok := c.entries[*hash]
+	c.lock.Unlock()
+	return state, ok
+}
+
+// Update updates the cache to contain the provided hash to threshold state
+// mapping.
+//
+// This function is safe for concurrent access.
+func (c *thresholdStateCache) Update(hash *hash.Hash, state ThresholdState) {
+	c.lock.Lock()
+	c.entries[*hash] = state
+	c.lock.Unlock()
+}
+
+// newThresholdCaches returns a new array of caches to be used when calculating
+// threshold states.
+func newThresholdCaches(numCaches uint32) []thresholdStateCache {
+	caches := make([]thresholdStateCache, numCaches)
+	for i := 0; i < len(caches); i++ {
+		caches[i] = thresholdStateCache{
+			entries: make(map[hash.Hash]ThresholdState),
+		}
+	}
+	return caches
+}
+
+// mainAncestor returns the ancestor of the node at the passed main height by
+// following the main parents.  It returns nil when the node is below the
+// height.
+func (node *blockNode) mainAncestor(b *BlockChain, height uint) *blockNode {
+	n := node
+	for n != nil && n.GetHeight() > height {
+		n = n.GetMainParent(b)
+	}
+	if n == nil || n.GetHeight() != height {
+		return nil
+	}
+	return n
+}
+
+// thresholdState returns the current rule change threshold state for the block
+// AFTER the given node and deployment ID.  The cache is used to ensure the
+// threshold states for previous windows are only calculated once.
+//
+// Since a block of the DAG can have many parents, the windows are counted in
+// main heights and the state of a block follows the chain of its main parents.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdConditionChecker, cache *thresholdStateCache) (ThresholdState, error) {
+	// The threshold state for the window that contains the genesis block is
+	// defined by definition.
+	confirmationWindow := uint(checker.MinerConfirmationWindow())
+	if confirmationWindow == 0 {
+		return ThresholdFailed, AssertError("threshold window of zero blocks")
+	}
+	if prevNode == nil || (prevNode.GetHeight()+1) < confirmationWindow {
+		return ThresholdDefined, nil
+	}
+
+	// Get the ancestor that is the last block of the previous confirmation
+	// window in order to get its threshold state.  This can be done because
+	// the state is the same for all blocks within a given window.
+	prevNode = prevNode.mainAncestor(b, prevNode.GetHeight()-
+		(prevNode.GetHeight()+1)%confirmationWindow)
+
+	// Iterate backwards through each of the previous confirmation windows
+	// to find the most recently cached threshold state.
+	var neededStates []*blockNode
+	for prevNode != nil {
+		// Nothing more to do if the state of the block is already
+		// cached.
+		if _, ok := cache.Lookup(&prevNode.hash); ok {
+			break
+		}
+
+		// The start and expiration times are based on the median block
+		// time, so calculate it now.
+		medianTime := prevNode.CalcPastMedianTime(b)
+
+		// The state is simply defined if the start time hasn't been
+		// been reached yet.
+		if uint64(medianTime.Unix()) < checker.BeginTime() {
+			cache.Update(&prevNode.hash, ThresholdDefined)
+			break
+		}
+
+		// Add this node to the list of nodes that need the state
+		// calculated and cached.
+		neededStates = append(neededStates, prevNode)
+
+		// Get the ancestor that is the last block of the previous
+		// confirmation window.
+		if prevNode.GetHeight() < confirmationWindow {
+			prevNode = nil
+			break
+		}
+		prevNode = prevNode.mainAncestor(b, prevNode.GetHeight()-confirmationWindow)
+	}
+
+	// Start with the threshold state for the most recent confirmation
+	// window that has a cached state.
+	state := ThresholdDefined
+	if prevNode != nil {
+		var ok bool
+		state, ok = cache.Lookup(&prevNode.hash)
+		if !ok {
+			return ThresholdFailed, AssertError(fmt.Sprintf(
+				"thresholdState: cache lookup failed for %v",
+				prevNode.hash))
+		}
+	}
+
+	// Since each threshold state depends on the state of the previous
+	// window, iterate starting from the oldest unknown window.
+	for neededNum := len(neededStates) - 1; neededNum >= 0; neededNum-- {
+		prevNode := neededStates[neededNum]
+
+		switch state {
+		case ThresholdDefined:
+			// The deployment of the rule change fails if it expires
+			// before it is accepted and locked in.
+			medianTime := prevNode.CalcPastMedianTime(b)
+			medianTimeUnix := uint64(medianTime.Unix())
+			if medianTimeUnix >= checker.EndTime() {
+				state = ThresholdFailed
+				break
+			}
+
+			// The state for the rule moves to the started state
+			// once its start time has been reached (and it hasn't
+			// already expired per the above).
+			if medianTimeUnix >= checker.BeginTime() {
+				state = ThresholdStarted
+			}
+
+		case ThresholdStarted:
+			// The deployment of the rule change fails if it expires
+			// before it is accepted and locked in.
+			medianTime := prevNode.CalcPastMedianTime(b)
+			if uint64(medianTime.Unix()) >= checker.EndTime() {
+				state = ThresholdFailed
+				break
+			}
+
+			// At this point, the rule change is still being voted
+			// on by the miners, so iterate backwards through the
+			// main chain of the confirmation window to count all
+			// of the votes.
+			var count uint32
+			countNode := prevNode
+			for i := uint(0); i < confirmationWindow && countNode != nil; i++ {
+				condition, err := checker.Condition(countNode)
+				if err != nil {
+					return ThresholdFailed, err
+				}
+				if condition {
+					count++
+				}
+
+				// Get the main parent of the current node.
+				countNode = countNode.GetMainParent(b)
+			}
+
+			// The state is locked in if the number of blocks in the
+			// period that voted for the rule change meets the
+			// activation threshold.
+			if count >= checker.RuleChangeActivationThreshold() {
+				state = ThresholdLockedIn
+			}
+
+		case ThresholdLockedIn:
+			// The new rule becomes active when its previous state
+			// was locked in.
+			state = ThresholdActive
+
+		// Nothing to do if the previous state is active or failed since
+		// they are both terminal states.
+		case ThresholdActive:
+		case ThresholdFailed:
+		}
+
+		// Update the cache to avoid recalculating the state in the
+		// future.
+		cache.Update(&prevNode.hash, state)
+	}
+
+	return state, nil
+}
+
+// deploymentState returns the current rule change threshold for a given
+// deployment ID for the block AFTER the provided node.  The deployments are
+// the ones defined for the block version of the chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) deploymentState(prevNode *blockNode, deploymentID uint32) (ThresholdState, error) {
+	deployments := b.deployments()
+	if deploymentID >= uint32(len(deployments)) {
+		return ThresholdFailed, DeploymentError(fmt.Sprint(deploymentID))
+	}
+
+	deployment := &deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	cache := &b.deploymentCaches[deploymentID]
+
+	return b.thresholdState(prevNode, checker, cache)
+}
+
+// ThresholdState returns the current rule change threshold state of the given
+// deployment ID for the block AFTER the block with the provided hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ThresholdState(blockHash *hash.Hash, deploymentID uint32) (ThresholdState, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	node := b.index.LookupNode(blockHash)
+	if node == nil {
+		return ThresholdFailed, HashError(blockHash.String())
+	}
+	return b.deploymentState(node, deploymentID)
+}
+
+// isDeploymentActive returns whether or not the provided deployment is active
+// for the block AFTER the provided node.  Deployments which are not defined
+// for the block version of the chain are never active.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isDeploymentActive(prevNode *blockNode, deploymentID uint32) (bool, error) {
+	if deploymentID >= uint32(len(b.deployments())) {
+		return false, nil
+	}
+	state, err := b.deploymentState(prevNode, deploymentID)
+	if err != nil {
+		return false, err
+	}
+	return state == ThresholdActive, nil
+}
+
+// IsDeploymentActive returns whether or not the provided deployment is active
+// for the block following the main chain tip.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	tip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	return b.isDeploymentActive(tip, deploymentID)
+}
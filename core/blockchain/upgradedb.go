@@ -3,6 +3,7 @@ package blockchain
 import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/dbnamespace"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/database"
@@ -18,11 +19,21 @@ func (b *BlockChain) upgradeDB() error {
 	err := b.db.Update(func(dbTx database.Tx) error {
 		meta := dbTx.Metadata()
 		bidxStart := time.Now()
+		// Version 4 introduced the asset registry.
+		err := dbCreateAssetBuckets(meta)
+		if err != nil {
+			return err
+		}
+		// Version 5 introduced the dag children index.
+		err = blockdag.DBBuildDAGChildren(dbTx)
+		if err != nil {
+			return err
+		}
 		spendBucket := meta.Bucket(dbnamespace.SpendJournalBucketName)
 		if spendBucket == nil {
 			return nil
 		}
-		err := checkSpendJournal(dbTx, spendBucket)
+		err = checkSpendJournal(dbTx, spendBucket)
 		if err != nil {
 			return err
 		}
@@ -46,6 +46,7 @@ type UtxoEntry struct {
 	amount      uint64 // The amount of the output.
 	pkScript    []byte // The public key script for the output.
 	blockHash   hash.Hash
+	asset       types.AssetId // The asset the amount is denominated in.
 	packedFlags txoFlags
 }
 
@@ -94,6 +95,11 @@ func (entry *UtxoEntry) PkScript() []byte {
 	return entry.pkScript
 }
 
+// Asset returns the asset the amount of the output is denominated in.
+func (entry *UtxoEntry) Asset() types.AssetId {
+	return entry.asset
+}
+
 // Clone returns a shallow copy of the utxo entry.
 func (entry *UtxoEntry) Clone() *UtxoEntry {
 	if entry == nil {
@@ -104,6 +110,7 @@ func (entry *UtxoEntry) Clone() *UtxoEntry {
 		amount:      entry.amount,
 		pkScript:    entry.pkScript,
 		blockHash:   entry.blockHash,
+		asset:       entry.asset,
 		packedFlags: entry.packedFlags,
 	}
 }
@@ -118,12 +125,19 @@ func (entry *UtxoEntry) Clone() *UtxoEntry {
 type UtxoViewpoint struct {
 	entries    map[types.TxOutPoint]*UtxoEntry
 	viewpoints []*hash.Hash
+
+	// assets and assetBalances hold the changes of the asset registry
+	// made by the transactions connected to or disconnected from the view.
+	assets        map[types.AssetId]*AssetEntry
+	assetBalances map[assetBalanceKey]int64
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
 func NewUtxoViewpoint() *UtxoViewpoint {
 	return &UtxoViewpoint{
-		entries: make(map[types.TxOutPoint]*UtxoEntry),
+		entries:       make(map[types.TxOutPoint]*UtxoEntry),
+		assets:        make(map[types.AssetId]*AssetEntry),
+		assetBalances: make(map[assetBalanceKey]int64),
 	}
 }
 
@@ -133,6 +147,8 @@ func (view *UtxoViewpoint) RemoveEntry(outpoint types.TxOutPoint) {
 
 func (view *UtxoViewpoint) Clean() {
 	view.entries = map[types.TxOutPoint]*UtxoEntry{}
+	view.assets = map[types.AssetId]*AssetEntry{}
+	view.assetBalances = map[assetBalanceKey]int64{}
 }
 
 // Entries returns the underlying map that stores of all the utxo entries.
@@ -194,6 +210,7 @@ func (view *UtxoViewpoint) addTxOut(outpoint types.TxOutPoint, txOut *types.TxOu
 	entry.amount = txOut.Amount
 	entry.pkScript = txOut.PkScript
 	entry.blockHash = *blockHash
+	entry.asset = txOut.Asset
 	entry.packedFlags = tfModified
 	if isCoinBase {
 		entry.packedFlags |= tfCoinBase
@@ -379,6 +396,13 @@ func (view *UtxoViewpoint) connectTransaction(tx *types.Tx, node *blockNode, blo
 		return nil
 	}
 
+	// Update the asset registry before the inputs are spent since the
+	// issuer of new assets is taken from the first input.
+	err := view.connectAssetTransaction(tx, bc)
+	if err != nil {
+		return err
+	}
+
 	// Spend the referenced utxos by marking them spent in the view and,
 	// if a slice was provided for the spent txout details, append an entry
 	// to it.
@@ -392,6 +416,7 @@ func (view *UtxoViewpoint) connectTransaction(tx *types.Tx, node *blockNode, blo
 				txIn.PreviousOut))
 		}
 		entry.Spend()
+		view.addAssetBalance(entry.asset, entry.pkScript, -int64(entry.amount))
 
 		// Don't create the stxo details if not requested.
 		if stxos == nil {
@@ -410,6 +435,7 @@ func (view *UtxoViewpoint) connectTransaction(tx *types.Tx, node *blockNode, blo
 			IsCoinBase: entry.IsCoinBase(),
 			TxIndex:    uint32(tx.Index()),
 			TxInIndex:  uint32(txInIndex),
+			Asset:      entry.asset,
 		}
 		if stxo.IsCoinBase && txIn.PreviousOut.OutIndex == 0 {
 			stxo.Amount += uint64(bc.GetFees(&stxo.BlockHash))
@@ -420,6 +446,7 @@ func (view *UtxoViewpoint) connectTransaction(tx *types.Tx, node *blockNode, blo
 
 	// Add the transaction's outputs as available utxos.
 	view.AddTxOuts(tx, node.GetHash()) //TODO, remove type conversion
+	view.addAssetOutputBalances(tx, 1)
 
 	return nil
 }
@@ -465,6 +492,7 @@ func (view *UtxoViewpoint) disconnectTransactions(block *types.SerializedBlock,
 					amount:      txOut.Amount,
 					pkScript:    txOut.PkScript,
 					blockHash:   *block.Hash(),
+					asset:       txOut.Asset,
 					packedFlags: packedFlags,
 				}
 
@@ -473,10 +501,16 @@ func (view *UtxoViewpoint) disconnectTransactions(block *types.SerializedBlock,
 
 			entry.Spend()
 		}
+		view.addAssetOutputBalances(tx, -1)
 
 		if isCoinBase {
 			continue
 		}
+		txStxos := stxos[stxoIdx-len(tx.Tx.TxIn)+1 : stxoIdx+1]
+		err := view.disconnectAssetTransaction(tx, txStxos, bc)
+		if err != nil {
+			return err
+		}
 		for txInIdx := len(tx.Tx.TxIn) - 1; txInIdx > -1; txInIdx-- {
 			stxo := &stxos[stxoIdx]
 			stxoIdx--
@@ -491,10 +525,12 @@ func (view *UtxoViewpoint) disconnectTransactions(block *types.SerializedBlock,
 			entry.amount = stxo.OriAmount
 			entry.pkScript = stxo.PkScript
 			entry.blockHash = stxo.BlockHash
+			entry.asset = stxo.Asset
 			entry.packedFlags = tfModified
 			if stxo.IsCoinBase {
 				entry.packedFlags |= tfCoinBase
 			}
+			view.addAssetBalance(entry.asset, entry.pkScript, int64(entry.amount))
 		}
 	}
 
@@ -513,6 +549,7 @@ func (view *UtxoViewpoint) commit() {
 
 		entry.packedFlags ^= tfModified
 	}
+	view.commitAssets()
 }
 
 func (bc *BlockChain) IsInvalidOut(entry *UtxoEntry) bool {
@@ -675,7 +712,7 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
 		}
 	}
 
-	return nil
+	return dbPutAssetChanges(dbTx, view)
 }
 
 // deserializeUtxoEntry decodes a utxo entry from the passed serialized byte
@@ -691,15 +728,28 @@ func DeserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 	// Decode the header code.
 	//
 	// Bit 0 indicates whether the containing transaction is a coinbase.
-	// Bits 1-x encode id of containing transaction.
+	// Bit 1 indicates whether the output carries an asset identifier.
 	isCoinBase := code&0x01 != 0
+	hasAsset := code&0x02 != 0
 
+	if len(serialized[offset:]) < hash.HashSize {
+		return nil, errDeserialize("unexpected end of data after header")
+	}
 	blockHash, err := hash.NewHash(serialized[offset : offset+hash.HashSize])
 	if err != nil {
 		return nil, errDeserialize(fmt.Sprintf("unable to decode "+
 			"utxo: %v", err))
 	}
 	offset += hash.HashSize
+	var asset types.AssetId
+	if hasAsset {
+		if len(serialized[offset:]) < types.AssetIdSize {
+			return nil, errDeserialize("unexpected end of data " +
+				"after block hash")
+		}
+		copy(asset[:], serialized[offset:offset+types.AssetIdSize])
+		offset += types.AssetIdSize
+	}
 	// Decode the compressed unspent transaction output.
 	amount, pkScript, _, err := decodeCompressedTxOut(serialized[offset:])
 	if err != nil {
@@ -711,6 +761,7 @@ func DeserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 		amount:      amount,
 		pkScript:    pkScript,
 		blockHash:   *blockHash,
+		asset:       asset,
 		packedFlags: 0,
 	}
 	if isCoinBase {
@@ -735,6 +786,9 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 	// Calculate the size needed to serialize the entry.
 	size := serializeSizeVLQ(headerCode) + hash.HashSize +
 		compressedTxOutSize(uint64(entry.Amount()), entry.PkScript())
+	if !entry.asset.IsMeer() {
+		size += types.AssetIdSize
+	}
 
 	// Serialize the header code followed by the compressed unspent
 	// transaction output.
@@ -742,6 +796,9 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 	offset := putVLQ(serialized, headerCode)
 	copy(serialized[offset:offset+hash.HashSize], entry.blockHash.Bytes())
 	offset += hash.HashSize
+	if !entry.asset.IsMeer() {
+		offset += copy(serialized[offset:], entry.asset[:])
+	}
 	offset += putCompressedTxOut(serialized[offset:], uint64(entry.Amount()),
 		entry.PkScript())
 
@@ -777,12 +834,15 @@ func utxoEntryHeaderCode(entry *UtxoEntry) (uint64, error) {
 	}
 
 	// As described in the serialization format comments, the header code
-	// encodes the height shifted over one bit and the coinbase flag in the
-	// lowest bit.
+	// encodes the coinbase flag in the lowest bit and whether an asset
+	// identifier follows the block hash in the next one.
 	headerCode := uint64(0)
 	if entry.IsCoinBase() {
 		headerCode |= 0x01
 	}
+	if !entry.asset.IsMeer() {
+		headerCode |= 0x02
+	}
 
 	return headerCode, nil
 }
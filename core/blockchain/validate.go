@@ -7,6 +7,7 @@
 package blockchain
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -56,8 +57,11 @@ func (b *BlockChain) checkBlockSanity(block *types.SerializedBlock, timeSource M
 	header := &msgBlock.Header
 
 	// TODO It can be considered to delete in the future when it is officially launched
-	if header.GetVersion() != b.BlockVersion {
-		return ruleError(ErrBlockVersionTooOld, "block version too old")
+	if !b.isValidBlockVersion(header.GetVersion()) {
+		str := fmt.Sprintf("block version %#x is not version %d with the "+
+			"signalling bits of its deployments", header.GetVersion(),
+			b.BlockVersion)
+		return ruleError(ErrBlockVersionTooOld, str)
 	}
 
 	// A block must have at least one regular transaction.
@@ -155,7 +159,8 @@ func (b *BlockChain) checkBlockSanity(block *types.SerializedBlock, timeSource M
 		// transaction tree.
 		msgTx := tx.Transaction()
 		txType := types.DetermineTxType(msgTx)
-		if txType != types.TxTypeRegular {
+		if txType != types.TxTypeRegular && !types.IsAssetTxType(txType) &&
+			!types.IsContractTxType(txType) {
 			errStr := fmt.Sprintf("block contains a irregular "+
 				"transaction in the regular transaction tree at "+
 				"index %d", i)
@@ -264,6 +269,14 @@ func checkBlockHeaderSanity(header *types.BlockHeader, timeSource MedianTimeSour
 	return nil
 }
 
+// CheckBlockHeaderSanity performs the context free checks of a block header,
+// including its proof of work, without the block body.  The main height is the
+// height of the main parent of the block plus one.  It is used by nodes which
+// only keep the block headers.
+func CheckBlockHeaderSanity(header *types.BlockHeader, timeSource MedianTimeSource, chainParams *params.Params, mHeight uint) error {
+	return checkBlockHeaderSanity(header, timeSource, BFNone, chainParams, mHeight)
+}
+
 // checkProofOfWork ensures the block header bits which indicate the target
 // difficulty is in min/max range and that the block hash is less than the
 // target difficulty as claimed.
@@ -312,8 +325,8 @@ func CheckTransactionSanity(tx *types.Transaction, params *params.Params) error
 	// transaction.  Also, the total of all outputs must abide by the same
 	// restrictions.  All amounts in a transaction are in a unit value
 	// known as an atom.  One Coin is a quantity of atoms as defined by
-	// the AtomsPerCoin constant.
-	var totalAtom int64
+	// the AtomsPerCoin constant.  The totals are tracked per asset.
+	totalAtoms := make(map[types.AssetId]int64)
 	for _, txOut := range tx.TxOut {
 		atom := txOut.Amount
 		if atom < 0 {
@@ -331,7 +344,7 @@ func CheckTransactionSanity(tx *types.Transaction, params *params.Params) error
 		// Two's complement int64 overflow guarantees that any overflow
 		// is detected and reported.
 		// TODO revisit the overflow check
-		totalAtom += int64(atom)
+		totalAtom := totalAtoms[txOut.Asset] + int64(atom)
 		if totalAtom < 0 {
 			str := fmt.Sprintf("total value of all transaction "+
 				"outputs exceeds max allowed value of %v",
@@ -345,6 +358,17 @@ func CheckTransactionSanity(tx *types.Transaction, params *params.Params) error
 				types.MaxAmount)
 			return ruleError(ErrInvalidTxOutValue, str)
 		}
+		totalAtoms[txOut.Asset] = totalAtom
+	}
+
+	err := checkAssetSanity(tx)
+	if err != nil {
+		return err
+	}
+
+	err = checkContractSanity(tx)
+	if err != nil {
+		return err
 	}
 
 	// Check for duplicate transaction inputs.
@@ -391,6 +415,137 @@ func CheckTransactionSanity(tx *types.Transaction, params *params.Params) error
 	return nil
 }
 
+// checkAssetSanity performs the context free checks of the asset outputs of a
+// transaction.  Only asset transactions may tag outputs with an asset other
+// than the native coin, and an issuing transaction may only tag outputs with
+// the asset it creates.
+func checkAssetSanity(tx *types.Transaction) error {
+	txType := types.DetermineTxType(tx)
+	if !types.IsAssetTxType(txType) {
+		for i, txOut := range tx.TxOut {
+			if !txOut.Asset.IsMeer() {
+				str := fmt.Sprintf("transaction output %d of %v "+
+					"transaction carries asset %v", i, txType,
+					txOut.Asset)
+				return ruleError(ErrInvalidAssetTx, str)
+			}
+		}
+		return nil
+	}
+
+	if tx.IsCoinBase() {
+		return ruleError(ErrInvalidAssetTx, "coinbase transaction "+
+			"must not be an asset transaction")
+	}
+
+	var issued types.AssetId
+	if txType == types.AssetIssue {
+		issued = types.NewAssetId(&tx.TxIn[0].PreviousOut)
+	}
+	numIssued := 0
+	for i, txOut := range tx.TxOut {
+		if txOut.Asset.IsMeer() {
+			continue
+		}
+		if txOut.Amount == 0 {
+			str := fmt.Sprintf("transaction output %d carries no "+
+				"amount of asset %v", i, txOut.Asset)
+			return ruleError(ErrInvalidAssetTx, str)
+		}
+		if txscript.IsUnspendable(txOut.PkScript) {
+			str := fmt.Sprintf("transaction output %d locks asset "+
+				"%v in an unspendable script", i, txOut.Asset)
+			return ruleError(ErrInvalidAssetTx, str)
+		}
+		if txType == types.AssetIssue {
+			if txOut.Asset != issued {
+				str := fmt.Sprintf("transaction output %d of "+
+					"issuing transaction carries asset %v "+
+					"instead of %v", i, txOut.Asset, issued)
+				return ruleError(ErrInvalidAssetTx, str)
+			}
+			numIssued++
+		}
+	}
+	if txType == types.AssetIssue && numIssued == 0 {
+		str := fmt.Sprintf("issuing transaction does not create any "+
+			"amount of asset %v", issued)
+		return ruleError(ErrInvalidAssetTx, str)
+	}
+	return nil
+}
+
+// checkAssetInputs ensures the asset amounts spent by a transaction balance
+// the asset amounts it creates as required by its type:
+//
+//   - regular and issuing transactions may not spend any asset
+//   - transferring transactions must create exactly the spent amount of every
+//     asset
+//   - revoking transactions must destroy some amount of at least one asset and
+//     may only do so when their first input spends an output locked by the
+//     script of the issuer of every destroyed asset
+func (b *BlockChain) checkAssetInputs(tx *types.Tx, assetsIn map[types.AssetId]uint64, utxoView *UtxoViewpoint) error {
+	msgTx := tx.Transaction()
+	txHash := tx.Hash()
+	txType := types.DetermineTxType(msgTx)
+	if txType == types.TxTypeRegular || txType == types.AssetIssue {
+		if len(assetsIn) > 0 {
+			str := fmt.Sprintf("%v transaction %v spends asset "+
+				"outputs", txType, txHash)
+			return ruleError(ErrInvalidAssetTx, str)
+		}
+		return nil
+	}
+	if !types.IsAssetTxType(txType) {
+		return nil
+	}
+
+	assetsOut := assetOutputAmounts(msgTx)
+	for id, amount := range assetsOut {
+		if assetsIn[id] < amount {
+			str := fmt.Sprintf("transaction %v creates %v of asset "+
+				"%v but only spends %v", txHash, amount, id,
+				assetsIn[id])
+			return ruleError(ErrAssetNotConserved, str)
+		}
+	}
+	burns := assetBurns(assetsIn, assetsOut)
+	if txType == types.AssetTransfer {
+		for id, amount := range burns {
+			str := fmt.Sprintf("transferring transaction %v "+
+				"destroys %v of asset %v", txHash, amount, id)
+			return ruleError(ErrAssetNotConserved, str)
+		}
+		return nil
+	}
+
+	// Revoking transactions.
+	if len(burns) == 0 {
+		str := fmt.Sprintf("revoking transaction %v does not destroy "+
+			"any asset", txHash)
+		return ruleError(ErrAssetNotConserved, str)
+	}
+	revoker := utxoView.LookupEntry(msgTx.TxIn[0].PreviousOut)
+	for id := range burns {
+		asset, err := utxoView.LookupAsset(b.db, id)
+		if err != nil {
+			return err
+		}
+		if asset == nil {
+			str := fmt.Sprintf("transaction %v revokes unknown "+
+				"asset %v", txHash, id)
+			return ruleError(ErrUnknownAsset, str)
+		}
+		if !bytes.Equal(revoker.PkScript(), asset.Issuer()) {
+			str := fmt.Sprintf("first input of transaction %v is "+
+				"not controlled by the issuer of asset %v",
+				txHash, id)
+			return ruleError(ErrAssetUnauthorized, str)
+		}
+	}
+	return nil
+}
+
 // Validate the tax in coinbase transaction. Prevent miners from attacking.
 func validateCoinbaseTax(tx *types.Transaction, params *params.Params) error {
 	if len(tx.TxOut) > CoinbaseOutput_tax {
@@ -497,6 +652,15 @@ func (b *BlockChain) checkBlockContext(block *types.SerializedBlock, mainParent
 	if err != nil {
 		return err
 	}
+
+	// The transaction types introduced by rule changes are only valid once
+	// their deployment is active.
+	for _, tx := range block.Transactions() {
+		err := b.checkTxTypeDeployment(tx.Tx, mainParent)
+		if err != nil {
+			return err
+		}
+	}
 	header := &block.Block().Header
 	fastAdd := flags&BFFastAdd == BFFastAdd
 	if !fastAdd {
@@ -568,6 +732,46 @@ func (b *BlockChain) checkBlockContext(block *types.SerializedBlock, mainParent
 	return nil
 }
 
+// checkTxTypeDeployment ensures the type of the passed transaction is valid for
+// the block after the passed node.  The asset and contract transactions are
+// only valid once their deployment is active.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkTxTypeDeployment(tx *types.Transaction, prevNode *blockNode) error {
+	txType := types.DetermineTxType(tx)
+	var deploymentID uint32
+	switch {
+	case types.IsAssetTxType(txType):
+		deploymentID = params.DeploymentAssets
+	case types.IsContractTxType(txType):
+		deploymentID = params.DeploymentContracts
+	default:
+		return nil
+	}
+	active, err := b.isDeploymentActive(prevNode, deploymentID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		str := fmt.Sprintf("transaction %v of type %v is not valid "+
+			"before its deployment is active", tx.TxHash(), txType)
+		return ruleError(ErrIrregTxInRegularTree, str)
+	}
+	return nil
+}
+
+// CheckTxTypeDeployment ensures the type of the passed transaction is valid for
+// the block after the end of the current main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckTxTypeDeployment(tx *types.Transaction) error {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	tip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	return b.checkTxTypeDeployment(tx, tip)
+}
+
 func (b *BlockChain) checkBlockSubsidy(block *types.SerializedBlock) error {
 	parents := blockdag.NewIdSet()
 	for _, v := range block.Block().Parents {
@@ -1028,6 +1232,7 @@ func (b *BlockChain) CheckTransactionInputs(tx *types.Tx, utxoView *UtxoViewpoin
 	// General transaction testing.
 	// -------------------------------------------------------------------
 	targets := []uint{}
+	assetsIn := make(map[types.AssetId]uint64)
 	for idx, txIn := range msgTx.TxIn {
 		utxoEntry := utxoView.LookupEntry(txIn.PreviousOut)
 		if utxoEntry == nil || utxoEntry.IsSpent() {
@@ -1071,6 +1276,22 @@ func (b *BlockChain) CheckTransactionInputs(tx *types.Tx, utxoView *UtxoViewpoin
 			return 0, ruleError(ErrInvalidTxOutValue, str)
 		}
 
+		// Asset amounts are accounted for separately and do not
+		// contribute to the fees.
+		if !utxoEntry.Asset().IsMeer() {
+			lastAssetIn := assetsIn[utxoEntry.Asset()]
+			assetsIn[utxoEntry.Asset()] += uint64(originTxAtom)
+			if assetsIn[utxoEntry.Asset()] < lastAssetIn ||
+				assetsIn[utxoEntry.Asset()] > types.MaxAmount {
+				str := fmt.Sprintf("total value of asset %v in "+
+					"transaction inputs is higher than max "+
+					"allowed value of %v", utxoEntry.Asset(),
+					types.MaxAmount)
+				return 0, ruleError(ErrInvalidTxOutValue, str)
+			}
+			continue
+		}
+
 		// The total of all outputs must not be more than the max
 		// allowed per transaction.  Also, we could potentially
 		// overflow the accumulator so check for overflow.
@@ -1104,11 +1325,19 @@ func (b *BlockChain) CheckTransactionInputs(tx *types.Tx, utxoView *UtxoViewpoin
 		}
 	}
 
+	err := b.checkAssetInputs(tx, assetsIn, utxoView)
+	if err != nil {
+		return 0, err
+	}
+
 	// Calculate the total output amount for this transaction.  It is safe
 	// to ignore overflow and out of range errors here because those error
 	// conditions would have already been caught by checkTransactionSanity.
 	var totalAtomOut int64
 	for _, txOut := range tx.Transaction().TxOut {
+		if !txOut.Asset.IsMeer() {
+			continue
+		}
 		totalAtomOut += int64(txOut.Amount) //TODO, remove type conversion
 	}
 
@@ -1125,6 +1354,12 @@ func (b *BlockChain) CheckTransactionInputs(tx *types.Tx, utxoView *UtxoViewpoin
 	// the inputs are >= the outputs.
 	txFeeInAtom := totalAtomIn - totalAtomOut
 
+	// Ensure the fee of a contract transaction pays for its gas limit.
+	err = checkContractFee(tx, txFeeInAtom)
+	if err != nil {
+		return 0, err
+	}
+
 	return txFeeInAtom, nil
 }
 
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"encoding/hex"
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/params"
 	"testing"
@@ -65,3 +66,125 @@ func checkTransactionSanityForAllNet(tx *types.Transaction) error {
 	}
 	return nil
 }
+
+func Test_CheckAssetSanity(t *testing.T) {
+	pkScript, err := hex.DecodeString("76a914c1777151516afe2b9f59bbd1479231aa2f250d2888ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevOut := types.NewOutPoint(&hash.Hash{1}, 0)
+	assetId := types.NewAssetId(prevOut)
+	newTx := func(txType types.TxType, outs ...*types.TxOutput) *types.Transaction {
+		tx := types.NewTransaction()
+		tx.SetTxType(txType)
+		tx.AddTxIn(types.NewTxInput(prevOut, []byte{}))
+		for _, out := range outs {
+			tx.AddTxOut(out)
+		}
+		return tx
+	}
+	output := func(amount uint64, asset types.AssetId) *types.TxOutput {
+		return &types.TxOutput{Amount: amount, PkScript: pkScript, Asset: asset}
+	}
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+		code ErrorCode
+	}{
+		{"issue", newTx(types.AssetIssue, output(1000, assetId),
+			output(1, types.MeerAssetId)), -1},
+		{"issue without asset", newTx(types.AssetIssue,
+			output(1, types.MeerAssetId)), ErrInvalidAssetTx},
+		{"issue foreign asset", newTx(types.AssetIssue, output(1000, assetId),
+			output(1000, types.AssetId{2})), ErrInvalidAssetTx},
+		{"zero asset amount", newTx(types.AssetTransfer,
+			output(0, assetId)), ErrInvalidAssetTx},
+		{"regular with asset", newTx(types.TxTypeRegular,
+			output(1000, assetId)), ErrInvalidAssetTx},
+		{"transfer", newTx(types.AssetTransfer, output(types.MaxAmount, assetId),
+			output(types.MaxAmount, types.MeerAssetId)), -1},
+		{"asset total too high", newTx(types.AssetTransfer,
+			output(types.MaxAmount, assetId),
+			output(1, assetId)), ErrInvalidTxOutValue},
+	}
+	for _, test := range tests {
+		err := CheckTransactionSanity(test.tx, &params.PrivNetParams)
+		if test.code == -1 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != test.code {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.code)
+		}
+	}
+}
+
+func Test_AssetDeployment(t *testing.T) {
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{9}, 0), nil))
+	tx.AddTxOut(&types.TxOutput{
+		Amount:   1,
+		PkScript: []byte{0x51},
+		Asset:    types.NewAssetId(&tx.TxIn[0].PreviousOut),
+	})
+	tx.SetTxType(types.AssetIssue)
+	testTxTypeDeployment(t, params.DeploymentAssets, tx)
+}
+
+func Test_ContractDeployment(t *testing.T) {
+	payload := &types.ContractPayload{GasLimit: 1, Data: []byte{0x00}}
+	script, err := ContractPayloadScript(payload.Bytes(types.ContractCreate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{9}, 0), nil))
+	tx.AddTxOut(types.NewTxOutput(0, script))
+	tx.SetTxType(types.ContractCreate)
+	testTxTypeDeployment(t, params.DeploymentContracts, tx)
+}
+
+// testTxTypeDeployment ensures the passed transaction is rejected by the chain
+// until the passed deployment is active.
+func testTxTypeDeployment(t *testing.T, deploymentID uint32, tx *types.Transaction) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	tc := newTestChain(t, &par)
+	defer tc.close()
+
+	isIrregular := func(err error) bool {
+		rerr, ok := err.(RuleError)
+		return ok && rerr.ErrorCode == ErrIrregTxInRegularTree
+	}
+	if err := tc.CheckTxTypeDeployment(tx); !isIrregular(err) {
+		t.Fatalf("transaction accepted before activation: %v", err)
+	}
+	if err := tc.processBlock(tc.newBlock(nil, tx)); !isIrregular(err) {
+		t.Fatalf("block with transaction accepted before activation: %v", err)
+	}
+
+	for i := 0; ; i++ {
+		active, err := tc.IsDeploymentActive(deploymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active {
+			break
+		}
+		if i > int(par.MinerConfirmationWindow)*4 {
+			t.Fatalf("deployment %d not active", deploymentID)
+		}
+		tc.mustProcessBlock(tc.newBlock(nil))
+	}
+	if err := tc.CheckTxTypeDeployment(tx); err != nil {
+		t.Fatalf("transaction rejected after activation: %v", err)
+	}
+	if err := tc.processBlock(tc.newBlock(nil, tx)); isIrregular(err) {
+		t.Fatalf("block with transaction rejected after activation: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+// Only the first 2 bytes of the block version are part of the version, the
+// last 2 bytes are used by miners as extra nonce.  The version bits are laid
+// out within the first 2 bytes as follows:
+//
+//   Bits    Meaning
+//   0-7     base block version, must match the block version of the chain
+//   8-15    signalling bits of the deployments
+const (
+	// vbBaseVersionMask is the mask of the base block version within the
+	// block version.
+	vbBaseVersionMask = 0x00ff
+
+	// vbSignalShift is the position of the signalling bit of the deployment
+	// with bit number zero within the block version.
+	vbSignalShift = 8
+
+	// vbNumBits is the total number of bits available for use with the
+	// version bits scheme.
+	vbNumBits = 8
+)
+
+// baseBlockVersion returns the base block version of the passed block version
+// with the signalling bits and the extra nonce stripped.
+func baseBlockVersion(version uint32) uint32 {
+	return version & vbBaseVersionMask
+}
+
+// isValidBlockVersion returns whether the passed block version, without the
+// extra nonce, has the base block version of the chain and sets no signalling
+// bits other than the ones of the deployments defined for it.
+func (b *BlockChain) isValidBlockVersion(version uint32) bool {
+	if baseBlockVersion(version) != b.BlockVersion {
+		return false
+	}
+	validBits := uint32(vbBaseVersionMask)
+	for _, deployment := range b.deployments() {
+		validBits |= uint32(1) << (vbSignalShift + uint32(deployment.BitNumber))
+	}
+	return version&^validBits == 0
+}
+
+// deploymentChecker provides a thresholdConditionChecker which can be used to
+// test a specific deployment rule.  This is required for properly detecting
+// and activating consensus rule changes.
+type deploymentChecker struct {
+	deployment *params.ConsensusDeployment
+	chain      *BlockChain
+}
+
+// Ensure the deploymentChecker type implements the thresholdConditionChecker
+// interface.
+var _ thresholdConditionChecker = deploymentChecker{}
+
+// BeginTime returns the unix timestamp for the median block time after which
+// voting on a rule change starts (at the next window).
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) BeginTime() uint64 {
+	return c.deployment.StartTime
+}
+
+// EndTime returns the unix timestamp for the median block time after which an
+// attempted rule change fails if it has not already been locked in or
+// activated.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) EndTime() uint64 {
+	return c.deployment.ExpireTime
+}
+
+// RuleChangeActivationThreshold is the number of blocks for which the condition
+// must be true in order to lock in a rule change.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) RuleChangeActivationThreshold() uint32 {
+	return c.chain.params.RuleChangeActivationThreshold
+}
+
+// MinerConfirmationWindow is the number of blocks in each threshold state
+// retarget window.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) MinerConfirmationWindow() uint32 {
+	return c.chain.params.MinerConfirmationWindow
+}
+
+// Condition returns true when the specific bit defined by the deployment
+// associated with the checker is set.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) Condition(node *blockNode) (bool, error) {
+	conditionMask := uint32(1) << (vbSignalShift + uint32(c.deployment.BitNumber))
+	return node.blockVersion&conditionMask == conditionMask, nil
+}
+
+// deployments returns the deployments defined for the block version of the
+// chain.
+func (b *BlockChain) deployments() []params.ConsensusDeployment {
+	return b.params.Deployments[b.BlockVersion]
+}
+
+// checkDeployments ensures the deployments of the block version of the chain
+// fit into the version bits.
+func (b *BlockChain) checkDeployments() error {
+	if b.BlockVersion != baseBlockVersion(b.BlockVersion) {
+		return AssertError(fmt.Sprintf("BlockVersion can not be bigger "+
+			"than %d", vbBaseVersionMask))
+	}
+	deployments := b.deployments()
+	if len(deployments) == 0 {
+		return nil
+	}
+	if b.params.MinerConfirmationWindow == 0 ||
+		b.params.RuleChangeActivationThreshold > b.params.MinerConfirmationWindow {
+		return AssertError(fmt.Sprintf("invalid deployment threshold %d "+
+			"of %d blocks", b.params.RuleChangeActivationThreshold,
+			b.params.MinerConfirmationWindow))
+	}
+	for id, deployment := range deployments {
+		if deployment.BitNumber >= vbNumBits {
+			return AssertError(fmt.Sprintf("deployment %d uses bit %d, "+
+				"only %d bits are available", id, deployment.BitNumber,
+				vbNumBits))
+		}
+	}
+	return nil
+}
+
+// calcNextBlockVersion calculates the expected version of the block after the
+// passed previous block node based on the state of started and locked in
+// rule change deployments.
+//
+// This function differs from the exported CalcNextBlockVersion in that the
+// exported version uses the main chain tip as the previous block node
+// while this function accepts any block node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) calcNextBlockVersion(prevNode *blockNode) (uint32, error) {
+	// Set the appropriate bits for each actively defined rule deployment
+	// that is either in the process of being voted on, or locked in for the
+	// activation at the next threshold window change.
+	expectedVersion := b.BlockVersion
+	deployments := b.deployments()
+	for id := range deployments {
+		deployment := &deployments[id]
+		cache := &b.deploymentCaches[id]
+		checker := deploymentChecker{deployment: deployment, chain: b}
+		state, err := b.thresholdState(prevNode, checker, cache)
+		if err != nil {
+			return 0, err
+		}
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			expectedVersion |= uint32(1) << (vbSignalShift + uint32(deployment.BitNumber))
+		}
+	}
+	return expectedVersion, nil
+}
+
+// CalcNextBlockVersion calculates the expected version of the block after the
+// end of the current main chain based on the state of started and locked in
+// rule change deployments.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcNextBlockVersion() (uint32, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	tip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	return b.calcNextBlockVersion(tip)
+}
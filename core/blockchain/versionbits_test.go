@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func Test_VersionBits(t *testing.T) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		12: {{BitNumber: 2, StartTime: 1, ExpireTime: 2}},
+	}
+	b := &BlockChain{params: &par, BlockVersion: 12}
+	if err := b.checkDeployments(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The extra nonce and the signalling bits are not part of the base
+	// block version.
+	version := uint32(0xbeef<<16) | 1<<(vbSignalShift+2) | 12
+	if baseBlockVersion(version) != 12 {
+		t.Fatalf("got base version %d, want 12", baseBlockVersion(version))
+	}
+
+	// Only the signalling bits of the defined deployments may be set.
+	for _, test := range []struct {
+		version uint32
+		want    bool
+	}{
+		{12, true},
+		{12 | 1<<(vbSignalShift+2), true},
+		{12 | 1<<(vbSignalShift+1), false},
+		{12 | 1<<(vbSignalShift+7), false},
+		{13 | 1<<(vbSignalShift+2), false},
+	} {
+		if got := b.isValidBlockVersion(test.version); got != test.want {
+			t.Errorf("version %x is valid %v, want %v", test.version, got, test.want)
+		}
+	}
+
+	checker := deploymentChecker{deployment: &b.deployments()[0], chain: b}
+	for _, test := range []struct {
+		version uint32
+		want    bool
+	}{
+		{12, false},
+		{version, true},
+		{12 | 1<<(vbSignalShift+1), false},
+		{12 | 1<<2, false},
+	} {
+		got, err := checker.Condition(&blockNode{blockVersion: test.version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("condition of version %x is %v, want %v", test.version, got, test.want)
+		}
+	}
+
+	// Deployments must fit into the signalling bits.
+	par.Deployments[12][0].BitNumber = vbNumBits
+	if err := b.checkDeployments(); err == nil {
+		t.Fatal("deployment outside of the signalling bits was accepted")
+	}
+	par.Deployments[12][0].BitNumber = 0
+	b.BlockVersion = 1 << vbSignalShift
+	if err := b.checkDeployments(); err == nil {
+		t.Fatal("block version overlapping the signalling bits was accepted")
+	}
+
+	if ThresholdLockedIn.String() != "ThresholdLockedIn" {
+		t.Fatalf("got %v", ThresholdLockedIn)
+	}
+}
+
+func Test_UndefinedSignalBitRejected(t *testing.T) {
+	tc := newTestChain(t, &params.PrivNetParams)
+	defer tc.close()
+
+	block := tc.newBlock(nil)
+	block.Block().Header.Version |= 1 << (vbSignalShift + vbNumBits - 1)
+	err := tc.processBlock(types.NewBlock(block.Block()))
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBlockVersionTooOld {
+		t.Fatalf("block signalling an undefined deployment: %v", err)
+	}
+	tc.mustProcessBlock(tc.newBlock(nil))
+}
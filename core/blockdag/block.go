@@ -48,7 +48,7 @@ type IBlock interface {
 	HasParents() bool
 
 	// Add child nodes to block
-	AddChild(child IBlock)
+	AddChild(child uint)
 
 	// Get all the children of block
 	GetChildren() *IdSet
@@ -83,8 +83,10 @@ type IBlock interface {
 
 // It is the element of a DAG. It is the most basic data unit.
 type Block struct {
-	id       uint
-	hash     hash.Hash
+	id   uint
+	hash hash.Hash
+	// The parents and children only have the ids, because the blocks may
+	// be paged out. Please resolve them by the dag.
 	parents  *IdSet
 	children *IdSet
 
@@ -126,42 +128,12 @@ func (b *Block) HasParents() bool {
 	return true
 }
 
-// Parent with order in front.
-func (b *Block) GetForwardParent() *Block {
-	if b.parents == nil || b.parents.IsEmpty() {
-		return nil
-	}
-	var result *Block = nil
-	for _, v := range b.parents.GetMap() {
-		parent := v.(*Block)
-		if result == nil || parent.GetOrder() < result.GetOrder() {
-			result = parent
-		}
-	}
-	return result
-}
-
-// Parent with order in back.
-func (b *Block) GetBackParent() *Block {
-	if b == nil || b.parents == nil || b.parents.IsEmpty() {
-		return nil
-	}
-	var result *Block = nil
-	for _, v := range b.parents.GetMap() {
-		parent := v.(*Block)
-		if result == nil || parent.GetOrder() > result.GetOrder() {
-			result = parent
-		}
-	}
-	return result
-}
-
 // Add child nodes to block
-func (b *Block) AddChild(child IBlock) {
+func (b *Block) AddChild(child uint) {
 	if b.children == nil {
 		b.children = NewIdSet()
 	}
-	b.children.AddPair(child.GetID(), child)
+	b.children.Add(child)
 }
 
 // Get all the children of block
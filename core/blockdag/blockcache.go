@@ -0,0 +1,111 @@
+package blockdag
+
+import (
+	"container/list"
+	"sync"
+)
+
+// blockCache keeps the recently used blocks of the DAG in memory.  The least
+// recently used blocks are dropped once the cache is full, and loaded again
+// from the database by the DAG when they are needed.  A cache with a capacity
+// of zero never drops any block.
+//
+// The blocks which differ from the database are never dropped until they have
+// been written, and while the DAG is changing its blocks no block is dropped
+// at all.
+type blockCache struct {
+	lock sync.Mutex
+
+	// The maximum number of blocks in the cache
+	capacity uint
+
+	blocks map[uint]*list.Element
+	lru    *list.List
+
+	// Whether the block of the id was not written to the database yet
+	isDirty func(id uint) bool
+	holding bool
+}
+
+// Return the block of the id and mark it as the most recently used one.
+func (c *blockCache) get(id uint) IBlock {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.blocks[id]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(IBlock)
+	}
+	return nil
+}
+
+// Add a block to the cache, the least recently used blocks will be dropped
+// if the cache is full.  If the cache already has a block with the same id,
+// that one is kept and returned.
+func (c *blockCache) put(ib IBlock) IBlock {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.blocks[ib.GetID()]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(IBlock)
+	}
+	c.blocks[ib.GetID()] = c.lru.PushFront(ib)
+	if !c.holding {
+		c.trim()
+	}
+	return ib
+}
+
+// Drop the least recently used blocks until the cache is not over capacity,
+// skipping the blocks which were not written to the database yet.
+func (c *blockCache) trim() {
+	if c.capacity == 0 {
+		return
+	}
+	for e := c.lru.Back(); e != nil && uint(c.lru.Len()) > c.capacity; {
+		prev := e.Prev()
+		id := e.Value.(IBlock).GetID()
+		if c.isDirty == nil || !c.isDirty(id) {
+			c.lru.Remove(e)
+			delete(c.blocks, id)
+		}
+		e = prev
+	}
+}
+
+// Keep all of the blocks in memory until release
+func (c *blockCache) hold() {
+	c.lock.Lock()
+	c.holding = true
+	c.lock.Unlock()
+}
+
+// Stop holding the blocks and drop the ones over capacity which are already
+// in the database.
+func (c *blockCache) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.holding = false
+	c.trim()
+}
+
+// The number of the blocks in memory
+func (c *blockCache) size() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Len()
+}
+
+// Create a new block cache, isDirty reports the blocks which must stay in
+// memory because they were not written to the database yet.
+func newBlockCache(capacity uint, isDirty func(id uint) bool) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		blocks:   map[uint]*list.Element{},
+		lru:      list.New(),
+		isDirty:  isDirty,
+	}
+}
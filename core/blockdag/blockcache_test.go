@@ -0,0 +1,175 @@
+package blockdag
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_BlockCache(t *testing.T) {
+	dirty := NewIdSet()
+	c := newBlockCache(2, dirty.Has)
+	for i := uint(0); i < 3; i++ {
+		c.put(&Block{id: i})
+	}
+	if c.size() != 2 || c.get(0) != nil {
+		t.Fatalf("the least recently used block was not dropped")
+	}
+	// 1 is used again, so 2 is dropped next.
+	c.get(1)
+	c.put(&Block{id: 3})
+	if c.get(1) == nil || c.get(2) != nil {
+		t.Fatalf("the cache does not drop by the recently use")
+	}
+
+	// The changed blocks are never dropped until they are written.
+	dirty.Add(1)
+	old := c.get(1)
+	c.put(&Block{id: 4})
+	c.put(&Block{id: 5})
+	if c.get(1) != old || c.size() != 2 {
+		t.Fatalf("the changed block was dropped")
+	}
+	if c.put(&Block{id: 1}) != old {
+		t.Fatalf("the changed block was replaced")
+	}
+
+	// No block is dropped while holding.
+	c.hold()
+	c.put(&Block{id: 6})
+	c.put(&Block{id: 7})
+	if c.size() != 4 {
+		t.Fatalf("%d blocks are in memory while holding, want 4", c.size())
+	}
+	dirty.Clean()
+	c.release()
+	if c.size() != 2 || c.get(1) != nil {
+		t.Fatalf("the written blocks were not dropped after release")
+	}
+
+	// A cache without capacity keeps every block.
+	c = newBlockCache(0, nil)
+	for i := uint(0); i < 10; i++ {
+		c.put(&Block{id: i})
+	}
+	if c.size() != 10 {
+		t.Fatalf("%d blocks are in memory, want 10", c.size())
+	}
+}
+
+func Test_PagingBlocks(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+
+	dir, err := ioutil.TempDir("", "dagpaging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), protocol.PrivNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(dbnamespace.BlockIndexBucketName)
+		if err != nil {
+			return err
+		}
+		return DBCreateDAGBuckets(dbTx.Metadata())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the same graph again with only two blocks in memory.
+	ids := map[hash.Hash]uint{}
+	pd := &BlockDAG{}
+	pd.Init(phantom, CalcBlockWeight, -1, func(h *hash.Hash) uint {
+		id, ok := ids[*h]
+		if !ok {
+			return MaxId
+		}
+		return id
+	}, db, 2)
+	for _, tb := range testData.PH_Fig2Blocks {
+		ib := tbMap[tb.Tag]
+		block := &TestBlock{hash: *ib.GetHash(), parents: bd.getBlockById(ib.GetID()).GetParents()}
+		l, pib := pd.AddBlock(block)
+		if l == nil || pib.GetID() != ib.GetID() {
+			t.Fatalf("failed to add %s", tb.Tag)
+		}
+		ids[*ib.GetHash()] = pib.GetID()
+		// The changed blocks are still in memory to be written.
+		err = db.Update(pd.WriteDirtyBlocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pd.Commit()
+	}
+	if pd.blocks.size() > 2 {
+		t.Fatalf("%d blocks are in memory", pd.blocks.size())
+	}
+
+	for i := uint(0); i < bd.GetBlockTotal(); i++ {
+		if !pd.GetBlockByOrder(i).IsEqual(bd.GetBlockByOrder(i)) {
+			t.Fatalf("the block of order %d is different", i)
+		}
+	}
+	anBlock := tbMap[testData.PH_GetAnticone.Input]
+	anticone := pd.getAnticone(pd.getBlockById(anBlock.GetID()), nil)
+	if !processResult(anticone, changeToIDList(testData.PH_GetAnticone.Output)) {
+		t.Fatalf("the anticone is different")
+	}
+
+	// The blocks are loaded lazily after a restart, the indexes are
+	// rebuilt like an upgrade of the database.
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.DeleteBucket(dbnamespace.DagChildrenBucketName)
+		if err != nil {
+			return err
+		}
+		err = DBBuildDAGChildren(dbTx)
+		if err != nil {
+			return err
+		}
+		return DBPutDAGInfo(dbTx, pd)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld := &BlockDAG{}
+	ld.Init(phantom, CalcBlockWeight, -1, pd.getBlockId, db, 2)
+	err = db.View(func(dbTx database.Tx) error {
+		return ld.Load(dbTx, pd.GetBlockTotal(), pd.GetGenesisHash())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ld.GetMainChainTip().GetHash().IsEqual(bd.GetMainChainTip().GetHash()) {
+		t.Fatalf("the main chain tip is different")
+	}
+	for i := uint(0); i < bd.GetBlockTotal(); i++ {
+		if !ld.GetBlockByOrder(i).IsEqual(bd.GetBlockByOrder(i)) {
+			t.Fatalf("the block of order %d is different after loading", i)
+		}
+	}
+	order := ld.GetOrder()
+	if len(order) != len(bd.GetOrder()) {
+		t.Fatalf("%d orders, want %d", len(order), len(bd.GetOrder()))
+	}
+	for i, id := range bd.GetOrder() {
+		if order[i] != id {
+			t.Fatalf("the id of order %d is %d, want %d", i, order[i], id)
+		}
+	}
+}
@@ -155,8 +155,13 @@ type BlockDAG struct {
 	// The genesis of block dag
 	genesis hash.Hash
 
-	// Use block hash to save all blocks with mapping
-	blocks map[uint]IBlock
+	// The blocks which are in memory, the others are paged out to the
+	// database.
+	blocks *blockCache
+
+	// The blocks which were changed since they have been written to the
+	// database.
+	dirty *IdSet
 
 	// The total number blocks that this dag currently owned
 	blockTotal uint
@@ -168,6 +173,7 @@ type BlockDAG struct {
 	lastTime time.Time
 
 	// The full sequence of dag, please note that the order starts at zero.
+	// It is kept in memory even if the blocks are paged out.
 	order map[uint]uint
 
 	// Current dag instance used. Different algorithms work according to
@@ -199,8 +205,10 @@ func (bd *BlockDAG) GetInstance() IBlockDAG {
 	return bd.instance
 }
 
-// Initialize self, the function to be invoked at the beginning
-func (bd *BlockDAG) Init(dagType string, calcWeight CalcWeight, blockRate float64, getBlockId GetBlockId, db database.DB) IBlockDAG {
+// Initialize self, the function to be invoked at the beginning.
+// The cacheSize is the number of blocks which are kept in memory, the others
+// are paged out to the database.  Zero keeps all of the blocks in memory.
+func (bd *BlockDAG) Init(dagType string, calcWeight CalcWeight, blockRate float64, getBlockId GetBlockId, db database.DB, cacheSize uint) IBlockDAG {
 	bd.lastTime = time.Unix(time.Now().Unix(), 0)
 
 	bd.calcWeight = calcWeight
@@ -211,6 +219,13 @@ func (bd *BlockDAG) Init(dagType string, calcWeight CalcWeight, blockRate float6
 		bd.blockRate = anticone.DefaultBlockRate
 	}
 	bd.instance = NewBlockDAG(dagType)
+	// Only phantom can page its blocks out, the other dag types need all
+	// of the blocks in memory.
+	if _, ok := bd.instance.(*Phantom); !ok || db == nil {
+		cacheSize = 0
+	}
+	bd.dirty = NewIdSet()
+	bd.blocks = newBlockCache(cacheSize, bd.isDirty)
 	bd.instance.Init(bd)
 	return bd.instance
 }
@@ -224,6 +239,11 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 	if b == nil {
 		return nil, nil
 	}
+	// The blocks which are changing must stay in memory, they are written
+	// to the database along with the chain state by WriteDirtyBlocks.
+	bd.blocks.hold()
+	defer bd.blocks.release()
+
 	// Must keep no block in outside.
 	/*	if bd.hasBlock(b.GetHash()) {
 		return nil
@@ -249,11 +269,9 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 	//
 	block := Block{id: bd.blockTotal, hash: *b.GetHash(), layer: 0, status: StatusNone, mainParent: MaxId}
 
-	if bd.blocks == nil {
-		bd.blocks = map[uint]IBlock{}
-	}
 	ib := bd.instance.CreateBlock(&block)
-	bd.blocks[block.id] = ib
+	bd.markDirty(block.id)
+	bd.blocks.put(ib)
 	if bd.blockTotal == 0 {
 		bd.genesis = *block.GetHash()
 	}
@@ -265,8 +283,9 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 		var maxLayer uint = 0
 		for _, v := range parents {
 			parent := v.(IBlock)
-			block.parents.AddPair(parent.GetID(), parent)
-			parent.AddChild(ib)
+			block.parents.Add(parent.GetID())
+			parent.AddChild(block.id)
+			bd.markDirty(parent.GetID())
 			if block.mainParent > parent.GetID() {
 				block.mainParent = parent.GetID()
 			}
@@ -314,6 +333,9 @@ func (bd *BlockDAG) HasBlock(h *hash.Hash) bool {
 
 // Is there a block in DAG?
 func (bd *BlockDAG) hasBlockById(id uint) bool {
+	if bd.isPaging() && id < bd.blockTotal {
+		return true
+	}
 	return bd.getBlockById(id) != nil
 }
 
@@ -369,11 +391,95 @@ func (bd *BlockDAG) getBlockById(id uint) IBlock {
 	if id == MaxId {
 		return nil
 	}
-	block, ok := bd.blocks[id]
-	if !ok {
+	block := bd.blocks.get(id)
+	if block != nil || !bd.isPaging() || id >= bd.blockTotal {
+		return block
+	}
+	// The block was paged out, so load it again from the database.
+	err := bd.db.View(func(dbTx database.Tx) error {
+		block = bd.instance.CreateBlock(&Block{id: id})
+		return DBGetDAGBlock(dbTx, block)
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("Can't load dag block %d:%s", id, err))
 		return nil
 	}
-	return block
+	return bd.blocks.put(block)
+}
+
+// Whether the blocks are paged out to the database
+func (bd *BlockDAG) isPaging() bool {
+	return bd.blocks.capacity > 0
+}
+
+// Acquire the block id by order
+func (bd *BlockDAG) getOrderId(order uint) uint {
+	return bd.order[order]
+}
+
+// Setting the block id of order, the block needs to be written to database.
+func (bd *BlockDAG) setOrderId(order uint, id uint) {
+	bd.order[order] = id
+	bd.markDirty(id)
+}
+
+// Mark the block as changed, so it stays in memory until it is written to
+// the database.  The blocks of a dag without database are never written.
+func (bd *BlockDAG) markDirty(id uint) {
+	if bd.db == nil {
+		return
+	}
+	bd.dirty.Add(id)
+}
+
+// Whether the block was changed since it has been written to the database
+func (bd *BlockDAG) isDirty(id uint) bool {
+	return bd.dirty.Has(id)
+}
+
+// Set the status of the block, it is written to the database along with the
+// chain state.
+func (bd *BlockDAG) SetBlockStatus(h *hash.Hash, status BlockStatus) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib := bd.getBlock(h)
+	if ib == nil {
+		return
+	}
+	ib.SetStatus(status)
+	bd.markDirty(ib.GetID())
+}
+
+// WriteDirtyBlocks stores the blocks which were changed since the last commit
+// in the database transaction of the chain state, so that the dag and the
+// chain state are always written atomically.  Commit must be called once the
+// transaction has been committed.
+func (bd *BlockDAG) WriteDirtyBlocks(dbTx database.Tx) error {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	for k := range bd.dirty.GetMap() {
+		ib := bd.blocks.get(k)
+		if ib == nil {
+			return fmt.Errorf("the changed dag block %d is not in memory", k)
+		}
+		err := DBPutDAGBlock(dbTx, ib)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit marks the blocks written by WriteDirtyBlocks as unchanged, then the
+// blocks which are over the capacity of the cache can be paged out.
+func (bd *BlockDAG) Commit() {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	bd.dirty.Clean()
+	bd.blocks.release()
 }
 
 // Total number of blocks
@@ -422,16 +528,16 @@ func (bd *BlockDAG) BuildMerkleTreeStoreFromTips() []*hash.Hash {
 func (bd *BlockDAG) updateTips(b IBlock) {
 	if bd.tips == nil {
 		bd.tips = NewIdSet()
-		bd.tips.AddPair(b.GetID(), b)
+		bd.tips.Add(b.GetID())
 		return
 	}
-	for k, v := range bd.tips.GetMap() {
-		block := v.(IBlock)
+	for k := range bd.tips.GetMap() {
+		block := bd.getBlockById(k)
 		if block.HasChildren() {
 			bd.tips.Remove(k)
 		}
 	}
-	bd.tips.AddPair(b.GetID(), b)
+	bd.tips.Add(b.GetID())
 }
 
 // The last time is when add one block to DAG.
@@ -481,7 +587,7 @@ func (bd *BlockDAG) GetPrevious(id uint) (uint, error) {
 		return 0, fmt.Errorf("no pre")
 	}
 	// TODO
-	return bd.order[b.GetOrder()-1], nil
+	return bd.getOrderId(b.GetOrder() - 1), nil
 }
 
 // Returns a future collection of block. This function is a recursively called function
@@ -491,9 +597,9 @@ func (bd *BlockDAG) getFutureSet(fs *IdSet, b IBlock) {
 	if children == nil || children.IsEmpty() {
 		return
 	}
-	for k, v := range children.GetMap() {
-		ib := v.(IBlock)
+	for k := range children.GetMap() {
 		if !fs.Has(k) {
+			ib := bd.getBlockById(k)
 			fs.AddPair(k, ib)
 			bd.getFutureSet(fs, ib)
 		}
@@ -593,8 +699,8 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		}
 		needRec := true
 		if cur.HasChildren() {
-			for _, v := range cur.GetChildren().GetMap() {
-				ib := v.(IBlock)
+			for k := range cur.GetChildren().GetMap() {
+				ib := bd.getBlockById(k)
 				if gs.GetTips().Has(ib.GetHash()) || !fs.Has(ib.GetHash()) && ib.IsOrdered() {
 					needRec = false
 					break
@@ -604,9 +710,8 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		if needRec {
 			fs.AddPair(cur.GetHash(), cur)
 			if cur.HasParents() {
-				for _, v := range cur.GetParents().GetMap() {
-					value := v.(IBlock)
-					ib := value
+				for k := range cur.GetParents().GetMap() {
+					ib := bd.getBlockById(k)
 					if fs.Has(ib.GetHash()) {
 						continue
 					}
@@ -626,8 +731,8 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		}
 		if ib.HasChildren() {
 			need := true
-			for _, v := range ib.GetChildren().GetMap() {
-				ib := v.(IBlock)
+			for k := range ib.GetChildren().GetMap() {
+				ib := bd.getBlockById(k)
 				if gs.GetTips().Has(ib.GetHash()) {
 					need = false
 					break
@@ -685,8 +790,8 @@ func (bd *BlockDAG) recAnticone(bs *IdSet, futureSet *IdSet, anticone *IdSet, ib
 		parents := ib.GetParents()
 
 		//Because parents can not be empty, so there is no need to judge.
-		for _, v := range parents.GetMap() {
-			pib := v.(IBlock)
+		for k := range parents.GetMap() {
+			pib := bd.getBlockById(k)
 			bd.recAnticone(bs, futureSet, anticone, pib)
 		}
 	}
@@ -700,8 +805,8 @@ func (bd *BlockDAG) getAnticone(b IBlock, exclude *IdSet) *IdSet {
 	anticone := NewIdSet()
 	bs := NewIdSet()
 	bs.AddPair(b.GetID(), b)
-	for _, v := range bd.tips.GetMap() {
-		ib := v.(IBlock)
+	for k := range bd.tips.GetMap() {
+		ib := bd.getBlockById(k)
 		bd.recAnticone(bs, futureSet, anticone, ib)
 	}
 	if exclude != nil {
@@ -713,8 +818,8 @@ func (bd *BlockDAG) getAnticone(b IBlock, exclude *IdSet) *IdSet {
 // getParentsAnticone
 func (bd *BlockDAG) getParentsAnticone(parents *IdSet) *IdSet {
 	anticone := NewIdSet()
-	for _, v := range bd.tips.GetMap() {
-		ib := v.(IBlock)
+	for k := range bd.tips.GetMap() {
+		ib := bd.getBlockById(k)
 		bd.recAnticone(parents, NewIdSet(), anticone, ib)
 	}
 	return anticone
@@ -789,8 +894,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 	mainsubdag.Add(0)
 	mainsubdagTips := NewIdSet()
 
-	for _, v := range parents.GetMap() {
-		ib := v.(IBlock)
+	for k := range parents.GetMap() {
+		ib := bd.getBlockById(k)
 		cur := &Block{id: ib.GetID(), hash: *ib.GetHash(), parents: NewIdSet(), mainParent: MaxId}
 		if ib.GetID() == b.GetMainParent() {
 			mainsubdag.Add(ib.GetID())
@@ -809,8 +914,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 		for _, v := range mainsubdagTips.GetMap() {
 			ib := v.(IBlock)
 			if ib.HasParents() {
-				for _, pv := range ib.GetParents().GetMap() {
-					pib := pv.(IBlock)
+				for pk := range ib.GetParents().GetMap() {
+					pib := bd.getBlockById(pk)
 					if mainsubdag.Has(pib.GetID()) {
 						continue
 					}
@@ -832,8 +937,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 		for _, v := range mainsubdagTips.GetMap() {
 			ib := v.(IBlock)
 			if ib.HasParents() {
-				for _, pv := range ib.GetParents().GetMap() {
-					pib := pv.(IBlock)
+				for pk := range ib.GetParents().GetMap() {
+					pib := bd.getBlockById(pk)
 					if mainsubdag.Has(pib.GetID()) {
 						continue
 					}
@@ -851,8 +956,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 			tb := v.(*Block)
 			realib := bd.getBlockById(tb.GetID())
 			if realib.HasParents() {
-				for _, pv := range realib.GetParents().GetMap() {
-					pib := pv.(IBlock)
+				for pk := range realib.GetParents().GetMap() {
+					pib := bd.getBlockById(pk)
 					var cur *Block
 					if anticone.Has(pib.GetID()) {
 						cur = anticone.Get(pib.GetID()).(*Block)
@@ -903,6 +1008,25 @@ func (bd *BlockDAG) sortBlock(src []*hash.Hash) []*hash.Hash {
 	return result
 }
 
+// Sort the ids of set by the hash of their blocks
+func (bd *BlockDAG) sortHashList(set *IdSet, reverse bool) []uint {
+	list := BlockHashSlice{}
+	for k := range set.GetMap() {
+		list = append(list, bd.getBlockById(k))
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(list))
+	} else {
+		sort.Sort(list)
+	}
+
+	result := []uint{}
+	for _, v := range list {
+		result = append(result, v.GetID())
+	}
+	return result
+}
+
 // Sort block by id
 func (bd *BlockDAG) SortBlock(src []*hash.Hash) []*hash.Hash {
 	bd.stateLock.Lock()
@@ -944,9 +1068,9 @@ func (bd *BlockDAG) GetConfirmations(id uint) uint {
 		if !cur.HasChildren() {
 			continue
 		} else {
-			childList := cur.GetChildren().SortHashList(false)
+			childList := bd.sortHashList(cur.GetChildren(), false)
 			for _, v := range childList {
-				ib := cur.GetChildren().Get(v).(IBlock)
+				ib := bd.getBlockById(v)
 				queue = append(queue, ib)
 			}
 		}
@@ -983,7 +1107,7 @@ func (bd *BlockDAG) getValidTips(limit bool) []IBlock {
 	temp.Remove(mainParent.GetID())
 	var parents []uint
 	if temp.Size() > 1 {
-		parents = temp.SortHashList(false)
+		parents = bd.sortHashList(temp, false)
 	} else {
 		parents = temp.List()
 	}
@@ -1119,7 +1243,8 @@ func (bd *BlockDAG) Load(dbTx database.Tx, blockTotal uint, genesis *hash.Hash)
 	}
 	bd.genesis = *genesis
 	bd.blockTotal = blockTotal
-	bd.blocks = map[uint]IBlock{}
+	bd.dirty = NewIdSet()
+	bd.blocks = newBlockCache(bd.blocks.capacity, bd.isDirty)
 	bd.tips = NewIdSet()
 	return bd.instance.Load(dbTx)
 }
@@ -1182,8 +1307,8 @@ func (bd *BlockDAG) IsHourglass(id uint) bool {
 	//
 	queueSet := NewIdSet()
 	queue := []IBlock{}
-	for _, v := range bd.tips.GetMap() {
-		ib := v.(IBlock)
+	for k := range bd.tips.GetMap() {
+		ib := bd.getBlockById(k)
 		if !ib.IsOrdered() {
 			continue
 		}
@@ -1206,8 +1331,8 @@ func (bd *BlockDAG) IsHourglass(id uint) bool {
 		if !cur.HasParents() {
 			continue
 		}
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
 			if queueSet.Has(ib.GetID()) || !ib.IsOrdered() {
 				continue
 			}
@@ -1279,8 +1404,8 @@ func (bd *BlockDAG) GetMaturity(target uint, views []uint) uint {
 			continue
 		}
 
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
 			if queueSet.Has(ib.GetID()) {
 				continue
 			}
@@ -1317,9 +1442,9 @@ func (bd *BlockDAG) getMainFork(ib IBlock, backward bool) IBlock {
 			if !cur.HasChildren() {
 				continue
 			} else {
-				childList := cur.GetChildren().SortHashList(false)
+				childList := bd.sortHashList(cur.GetChildren(), false)
 				for _, v := range childList {
-					ib := cur.GetChildren().Get(v).(IBlock)
+					ib := bd.getBlockById(v)
 					queue = append(queue, ib)
 				}
 			}
@@ -1327,9 +1452,9 @@ func (bd *BlockDAG) getMainFork(ib IBlock, backward bool) IBlock {
 			if !cur.HasParents() {
 				continue
 			} else {
-				parentsList := cur.GetParents().SortHashList(false)
+				parentsList := bd.sortHashList(cur.GetParents(), false)
 				for _, v := range parentsList {
-					ib := cur.GetParents().Get(v).(IBlock)
+					ib := bd.getBlockById(v)
 					queue = append(queue, ib)
 				}
 			}
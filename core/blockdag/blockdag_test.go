@@ -154,7 +154,7 @@ func InitBlockDAG(dagType string, graph string) IBlockDAG {
 		return nil
 	}
 	bd = BlockDAG{}
-	instance := bd.Init(dagType, CalcBlockWeight, -1, onGetBlockId, nil)
+	instance := bd.Init(dagType, CalcBlockWeight, -1, onGetBlockId, nil, 0)
 	tbMap = map[string]IBlock{}
 	for i := 0; i < blen; i++ {
 		parents := NewIdSet()
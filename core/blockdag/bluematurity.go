@@ -204,8 +204,8 @@ func (bd *BlockDAG) processMaturity(target IBlock, views []IBlock, mainViewIB IB
 			continue
 		}
 
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
 			if queueSet.Has(ib.GetID()) {
 				continue
 			}
@@ -108,9 +108,8 @@ func (con *Conflux) GetTipsList() []IBlock {
 	tips.Remove(con.privotTip.GetID())
 	//tipsList := tips.List()
 	result := []IBlock{con.privotTip}
-	for _, v := range tips.GetMap() {
-		ib := v.(IBlock)
-		result = append(result, ib)
+	for k := range tips.GetMap() {
+		result = append(result, con.bd.getBlockById(k))
 	}
 	return result
 }
@@ -8,7 +8,8 @@ import (
 )
 
 // DBPutDAGBlock stores the information needed to reconstruct the provided
-// block in the block index according to the format described above.
+// block in the block index according to the format described above.  The
+// children of the block are stored in their own index.
 func DBPutDAGBlock(dbTx database.Tx, block IBlock) error {
 	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
 	var serializedID [4]byte
@@ -21,7 +22,14 @@ func DBPutDAGBlock(dbTx database.Tx, block IBlock) error {
 	if err != nil {
 		return err
 	}
-	return bucket.Put(key, buff.Bytes())
+	err = bucket.Put(key, buff.Bytes())
+	if err != nil {
+		return err
+	}
+	if !block.HasChildren() {
+		return nil
+	}
+	return dbPutDAGChildren(dbTx, block.GetID(), block.GetChildren().List())
 }
 
 // DBGetDAGBlock get dag block data by resouce ID
@@ -35,7 +43,92 @@ func DBGetDAGBlock(dbTx database.Tx, block IBlock) error {
 		return fmt.Errorf("get dag block error")
 	}
 
-	return block.Decode(bytes.NewReader(data))
+	err := block.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	children, err := dbGetDAGChildren(dbTx, block.GetID())
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		block.AddChild(child)
+	}
+	return nil
+}
+
+// dbPutDAGChildren stores the children ids of the dag block with the id.
+func dbPutDAGChildren(dbTx database.Tx, id uint, children []uint) error {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.DagChildrenBucketName)
+	var serializedID [4]byte
+	dbnamespace.ByteOrder.PutUint32(serializedID[:], uint32(id))
+
+	serialized := make([]byte, 4*len(children))
+	for i, child := range children {
+		dbnamespace.ByteOrder.PutUint32(serialized[i*4:], uint32(child))
+	}
+	return bucket.Put(serializedID[:], serialized)
+}
+
+// dbGetDAGChildren returns the children ids of the dag block with the id.
+func dbGetDAGChildren(dbTx database.Tx, id uint) ([]uint, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.DagChildrenBucketName)
+	var serializedID [4]byte
+	dbnamespace.ByteOrder.PutUint32(serializedID[:], uint32(id))
+
+	data := bucket.Get(serializedID[:])
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("dag children of %d are corrupt", id)
+	}
+	children := make([]uint, 0, len(data)/4)
+	for i := 0; i < len(data); i += 4 {
+		children = append(children, uint(dbnamespace.ByteOrder.Uint32(data[i:])))
+	}
+	return children, nil
+}
+
+// DBCreateDAGBuckets creates the buckets which house the children index of
+// the dag blocks.
+func DBCreateDAGBuckets(meta database.Bucket) error {
+	_, err := meta.CreateBucketIfNotExists(dbnamespace.DagChildrenBucketName)
+	return err
+}
+
+// DBBuildDAGChildren builds the children index from all of the blocks in the
+// block index.  It is used to upgrade the databases which were created before
+// the blocks of the dag could be paged out.
+func DBBuildDAGChildren(dbTx database.Tx) error {
+	err := DBCreateDAGBuckets(dbTx.Metadata())
+	if err != nil {
+		return err
+	}
+	children := map[uint][]uint{}
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
+	err = bucket.ForEach(func(k, v []byte) error {
+		// The index only needs the general part of the blocks which
+		// all of the dag types share.
+		block := &Block{}
+		err := block.Decode(bytes.NewReader(v))
+		if err != nil {
+			return err
+		}
+		if block.HasParents() {
+			for _, parent := range block.parents.List() {
+				children[parent] = append(children[parent], block.id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, c := range children {
+		err := dbPutDAGChildren(dbTx, id, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func GetOrderLogStr(order uint) string {
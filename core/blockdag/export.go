@@ -0,0 +1,125 @@
+package blockdag
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The tag of the block standing for the past of an exported range of orders.
+const ExportRootTag = "root"
+
+// ExportBlock describes a block of an exported part of the DAG.  The tag and
+// parents fields are the blocks data of the blockdag test data, so a part of
+// a real DAG can be replayed as a new test fixture.
+type ExportBlock struct {
+	Tag        string   `json:"tag"`
+	Parents    []string `json:"parents"`
+	Hash       string   `json:"hash,omitempty"`
+	MainParent string   `json:"mainparent,omitempty"`
+	Order      uint     `json:"order"`
+	Layer      uint     `json:"layer"`
+	Blue       bool     `json:"blue"`
+}
+
+// Export walks the blocks from the start order to the end order, both included,
+// and describes them along with their coloring at the current state of the DAG.
+// The blocks are tagged by order.  The parents out of the range are always
+// ordered before it, they are replaced by a root block so that the exported
+// blocks are a DAG by themselves.
+func (bd *BlockDAG) Export(start uint, end uint) ([]*ExportBlock, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	if end < start {
+		return nil, fmt.Errorf("The end order %d is before the start order %d", end, start)
+	}
+	if end-start >= MaxTopologyPageSize {
+		return nil, fmt.Errorf("No more than %d blocks can be exported at once", MaxTopologyPageSize)
+	}
+
+	var root *ExportBlock
+	result := []*ExportBlock{}
+	for order := start; order <= end; order++ {
+		id := bd.getOrderId(order)
+		ib := bd.getBlockById(id)
+		if id == MaxId || ib == nil || ib.GetOrder() != order {
+			if order == start {
+				return nil, fmt.Errorf("No block at order %d", order)
+			}
+			break
+		}
+		eb := &ExportBlock{
+			Tag:     exportTag(ib),
+			Parents: []string{},
+			Hash:    ib.GetHash().String(),
+			Order:   ib.GetOrder(),
+			Layer:   ib.GetLayer(),
+			Blue:    bd.instance.IsBlue(id),
+		}
+		if ib.HasParents() {
+			for _, pid := range ib.GetParents().SortList(false) {
+				parent := bd.getBlockById(pid)
+				if parent.GetOrder() >= start {
+					eb.Parents = append(eb.Parents, exportTag(parent))
+					continue
+				}
+				if root == nil {
+					root = &ExportBlock{Tag: ExportRootTag, Parents: []string{}, Blue: true}
+				}
+				if len(eb.Parents) == 0 || eb.Parents[0] != ExportRootTag {
+					eb.Parents = append([]string{ExportRootTag}, eb.Parents...)
+				}
+			}
+			if ib.GetMainParent() != MaxId {
+				mainParent := bd.getBlockById(ib.GetMainParent())
+				if mainParent.GetOrder() >= start {
+					eb.MainParent = exportTag(mainParent)
+				} else {
+					eb.MainParent = ExportRootTag
+				}
+			}
+		}
+		result = append(result, eb)
+	}
+	if root != nil {
+		result = append([]*ExportBlock{root}, result...)
+	}
+	return result, nil
+}
+
+func exportTag(ib IBlock) string {
+	return strconv.FormatUint(uint64(ib.GetOrder()), 10)
+}
+
+// WriteDot writes the exported blocks as a graphviz digraph, the edges point
+// from the blocks to their parents and the main parent edges are bold.
+func WriteDot(w io.Writer, blocks []*ExportBlock) error {
+	if _, err := fmt.Fprintf(w, "digraph dag {\n\trankdir=RL;\n\tnode [style=filled];\n"); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		color := "lightblue"
+		if !b.Blue {
+			color = "lightcoral"
+		}
+		label := b.Tag
+		if b.Hash != "" {
+			label = fmt.Sprintf("%s\\n%.8s\\nlayer %d", b.Tag, b.Hash, b.Layer)
+		}
+		if _, err := fmt.Fprintf(w, "\t%q [label=\"%s\" fillcolor=%s];\n", b.Tag, label, color); err != nil {
+			return err
+		}
+		for _, p := range b.Parents {
+			style := ""
+			if p == b.MainParent {
+				style = " [style=bold]"
+			}
+			if _, err := fmt.Fprintf(w, "\t%q -> %q%s;\n", b.Tag, p, style); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
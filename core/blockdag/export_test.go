@@ -0,0 +1,63 @@
+package blockdag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Export(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+	// Only the blocks up to the main chain tip have a stable order
+	total := bd.GetMainChainTip().GetOrder() + 1
+
+	blocks, err := bd.Export(0, total+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint(len(blocks)) != total || len(blocks[0].Parents) != 0 {
+		t.Fatalf("export the ordered DAG: %d blocks of %d", len(blocks), total)
+	}
+	for _, b := range blocks {
+		ib := bd.GetBlockById(bd.getOrderId(b.Order))
+		parents := 0
+		if ib.HasParents() {
+			parents = ib.GetParents().Size()
+		}
+		if b.Hash != ib.GetHash().String() || b.Blue != bd.IsBlue(ib.GetID()) || len(b.Parents) != parents {
+			t.Fatalf("export of block %s: %+v", getBlockTag(ib.GetID()), b)
+		}
+	}
+
+	// The past of the range is replaced by a root block
+	blocks, err = bd.Export(3, total-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks[0].Tag != ExportRootTag || uint(len(blocks)) != total-3+1 {
+		t.Fatalf("export a range: %+v", blocks[0])
+	}
+	tags := map[string]bool{}
+	for _, b := range blocks {
+		for _, p := range b.Parents {
+			if !tags[p] {
+				t.Fatalf("parent %s of %s is not exported before it", p, b.Tag)
+			}
+		}
+		tags[b.Tag] = true
+	}
+	if _, err := bd.Export(total, total+1); err == nil {
+		t.Fatalf("export out of the DAG")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDot(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "digraph dag {") || !strings.Contains(buf.String(), "[style=bold]") {
+		t.Fatalf("dot output:\n%s", buf.String())
+	}
+}
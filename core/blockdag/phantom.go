@@ -123,12 +123,8 @@ func (ph *Phantom) getExtremeBlue(bs *IdSet, bluest bool) *PhantomBlock {
 
 func (ph *Phantom) calculateBlueSet(pb *PhantomBlock, diffAnticone *IdSet) {
 	kc := ph.getKChain(pb)
-	for _, v := range diffAnticone.GetMap() {
-		cur, ok := v.(*PhantomBlock)
-		if !ok {
-			panic("phantom block type is error.")
-		}
-		ph.colorBlock(kc, cur, pb.blueDiffAnticone, pb.redDiffAnticone)
+	for k := range diffAnticone.GetMap() {
+		ph.colorBlock(kc, ph.getBlock(k), pb.blueDiffAnticone, pb.redDiffAnticone)
 	}
 	if diffAnticone.Size() != pb.blueDiffAnticone.Size()+pb.redDiffAnticone.Size() {
 		log.Error(fmt.Sprintf("error blue set"))
@@ -271,7 +267,7 @@ func (ph *Phantom) buildSortDiffAnticone(diffAn *IdSet) *IdSet {
 func (ph *Phantom) updateMainChain(buestTip *PhantomBlock, pb *PhantomBlock) *PhantomBlock {
 	ph.virtualBlock.SetOrder(MaxBlockOrder)
 	if !ph.isMaxMainTip(buestTip) {
-		ph.diffAnticone.AddPair(pb.GetID(), pb)
+		ph.diffAnticone.Add(pb.GetID())
 		return nil
 	}
 	if ph.mainChain.tip == MaxId {
@@ -280,7 +276,7 @@ func (ph *Phantom) updateMainChain(buestTip *PhantomBlock, pb *PhantomBlock) *Ph
 		ph.mainChain.blocks.Add(buestTip.GetID())
 		ph.diffAnticone.Clean()
 		buestTip.SetOrder(0)
-		ph.bd.order[0] = buestTip.GetID()
+		ph.bd.setOrderId(0, buestTip.GetID())
 		return buestTip
 	}
 
@@ -296,7 +292,7 @@ func (ph *Phantom) updateMainChain(buestTip *PhantomBlock, pb *PhantomBlock) *Ph
 	ph.diffAnticone = ph.bd.getAnticone(ph.bd.getBlockById(ph.mainChain.tip), nil)
 
 	changeOrder := ph.bd.getBlockById(intersection).GetOrder() + 1
-	return ph.getBlock(ph.bd.order[changeOrder])
+	return ph.getBlock(ph.bd.getOrderId(changeOrder))
 }
 
 func (ph *Phantom) isMaxMainTip(pb *PhantomBlock) bool {
@@ -350,17 +346,17 @@ func (ph *Phantom) updateMainOrder(path []uint, intersection uint) {
 	for i := l - 1; i >= 0; i-- {
 		curBlock := ph.getBlock(path[i])
 		curBlock.SetOrder(startOrder + uint(curBlock.blueDiffAnticone.Size()+curBlock.redDiffAnticone.Size()+1))
-		ph.bd.order[curBlock.GetOrder()] = curBlock.GetID()
+		ph.bd.setOrderId(curBlock.GetOrder(), curBlock.GetID())
 		ph.mainChain.blocks.Add(curBlock.GetID())
 		for k, v := range curBlock.blueDiffAnticone.GetMap() {
 			dab := ph.getBlock(k)
 			dab.SetOrder(startOrder + v.(uint))
-			ph.bd.order[dab.GetOrder()] = dab.GetID()
+			ph.bd.setOrderId(dab.GetOrder(), dab.GetID())
 		}
 		for k, v := range curBlock.redDiffAnticone.GetMap() {
 			dab := ph.getBlock(k)
 			dab.SetOrder(startOrder + v.(uint))
-			ph.bd.order[dab.GetOrder()] = dab.GetID()
+			ph.bd.setOrderId(dab.GetOrder(), dab.GetID())
 		}
 		startOrder = curBlock.GetOrder()
 	}
@@ -376,7 +372,7 @@ func (ph *Phantom) UpdateVirtualBlockOrder() *PhantomBlock {
 	var maxLayer uint = 0
 	for k := range ph.bd.tips.GetMap() {
 		parent := ph.bd.getBlockById(k)
-		ph.virtualBlock.parents.AddPair(k, parent)
+		ph.virtualBlock.parents.Add(k)
 
 		if maxLayer == 0 || maxLayer < parent.GetLayer() {
 			maxLayer = parent.GetLayer()
@@ -400,12 +396,12 @@ func (ph *Phantom) UpdateVirtualBlockOrder() *PhantomBlock {
 	for k, v := range ph.virtualBlock.blueDiffAnticone.GetMap() {
 		dab := ph.getBlock(k)
 		dab.SetOrder(startOrder + v.(uint))
-		ph.bd.order[dab.GetOrder()] = dab.GetID()
+		ph.bd.setOrderId(dab.GetOrder(), dab.GetID())
 	}
 	for k, v := range ph.virtualBlock.redDiffAnticone.GetMap() {
 		dab := ph.getBlock(k)
 		dab.SetOrder(startOrder + v.(uint))
-		ph.bd.order[dab.GetOrder()] = dab.GetID()
+		ph.bd.setOrderId(dab.GetOrder(), dab.GetID())
 	}
 
 	ph.virtualBlock.SetOrder(ph.bd.blockTotal + 1)
@@ -421,6 +417,7 @@ func (ph *Phantom) preUpdateVirtualBlock() *PhantomBlock {
 	for k := range ph.diffAnticone.GetMap() {
 		dab := ph.getBlock(k)
 		dab.SetOrder(MaxBlockOrder)
+		ph.bd.markDirty(k)
 	}
 	return nil
 }
@@ -456,7 +453,7 @@ func (ph *Phantom) GetBlockByOrder(order uint) *hash.Hash {
 	if order > ph.GetMainChainTip().GetOrder() {
 		return nil
 	}
-	ib := ph.bd.getBlockById(ph.bd.order[order])
+	ib := ph.bd.getBlockById(ph.bd.getOrderId(order))
 	if ib != nil {
 		return ib.GetHash()
 	}
@@ -498,17 +495,17 @@ func (ph *Phantom) getOrderChangeList(pb *PhantomBlock) *list.List {
 			refNodes.PushBack(pb)
 		} else if pb.IsOrdered() && pb.GetOrder() <= ph.GetMainChainTip().GetOrder() {
 			for i := ph.GetMainChainTip().GetOrder(); i >= 0; i-- {
-				refNodes.PushFront(ph.getBlock(ph.bd.order[i]))
-				if ph.bd.order[i] == pb.GetID() {
+				id := ph.bd.getOrderId(i)
+				refNodes.PushFront(ph.getBlock(id))
+				if id == pb.GetID() {
 					break
 				}
 			}
 		}
 	}
 	if !ph.diffAnticone.IsEmpty() {
-		for _, v := range ph.diffAnticone.GetMap() {
-			ib := v.(IBlock)
-			refNodes.PushBack(ib)
+		for k := range ph.diffAnticone.GetMap() {
+			refNodes.PushBack(ph.getBlock(k))
 		}
 	}
 	return refNodes
@@ -575,25 +572,14 @@ func (ph *Phantom) Load(dbTx database.Tx) error {
 		if i == 0 && !ib.GetHash().IsEqual(ph.bd.GetGenesisHash()) {
 			return fmt.Errorf("genesis data mismatch")
 		}
-		// Make up for missing
-		if ib.HasParents() {
-			parentsSet := NewIdSet()
-			for k := range ib.GetParents().GetMap() {
-				parent := ph.bd.getBlockById(k)
-				parentsSet.AddPair(k, parent)
-				parent.AddChild(ib)
-			}
-			ib.GetParents().Clean()
-			ib.GetParents().AddSet(parentsSet)
-		}
-		ph.bd.blocks[ib.GetID()] = ib
+		ib = ph.bd.blocks.put(ib)
 
 		ph.bd.updateTips(ib)
 		//
-		ph.bd.order[ib.GetOrder()] = ib.GetID()
-
-		if !ib.IsOrdered() {
-			ph.diffAnticone.AddPair(ib.GetID(), ib)
+		if ib.IsOrdered() {
+			ph.bd.order[ib.GetOrder()] = ib.GetID()
+		} else {
+			ph.diffAnticone.Add(ib.GetID())
 		}
 	}
 
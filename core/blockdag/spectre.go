@@ -132,8 +132,8 @@ func (sp *Spectre) Vote(b1 IBlock, b2 IBlock) (bool, error) {
 		if children == nil { // tips
 			outer.Enqueue(h)
 		} else { // haven't voted children
-			for _, ch := range children.GetMap() {
-				if !sp.hasVoted(*ch.(IBlock).GetHash()) {
+			for id := range children.GetMap() {
+				if !sp.hasVoted(*sp.bd.getBlockById(id).GetHash()) {
 					outer.Enqueue(h)
 					break
 				}
@@ -156,24 +156,25 @@ func (sp *Spectre) Vote(b1 IBlock, b2 IBlock) (bool, error) {
 			continue
 		}
 
-		for _, ch := range children.GetMap() {
-			if sp.hasVoted(*ch.(IBlock).GetHash()) {
+		for id := range children.GetMap() {
+			ch := sp.bd.getBlockById(id)
+			if sp.hasVoted(*ch.GetHash()) {
 				continue
 			}
 			all := true // all parented voted
-			chParents := sp.bd.getBlock(ch.(IBlock).GetHash()).GetParents()
-			for _, ph := range chParents.GetMap() {
+			chParents := ch.GetParents()
+			for pid := range chParents.GetMap() {
+				ph := sp.bd.getBlockById(pid)
 				// note: must ignore dangling parent,
 				// e.g. in figure ByteBall2, 7 is a dangling node, so once 17 and 21 are voted, 24 is able to vote
-				if !sp.hasVoted(*ph.(IBlock).GetHash()) && !sp.dangling.Has(ph.(IBlock).GetHash()) {
+				if !sp.hasVoted(*ph.GetHash()) && !sp.dangling.Has(ph.GetHash()) {
 					all = false
 					break
 				}
 			}
 			if all {
-				vb := sp.bd.getBlock(ch.(IBlock).GetHash())
-				sp.VoteByBlock(vb)
-				outer.Enqueue(ch)
+				sp.VoteByBlock(ch)
+				outer.Enqueue(*ch.GetHash())
 			} else {
 				done = false
 			}
@@ -235,8 +236,8 @@ func (sp *Spectre) votedPast(virtualBlock IBlock) *BlockDAG {
 			visited.Add(&h)
 		}
 		hParents := sp.bd.getBlock(&h).GetParents()
-		for _, ib := range hParents.GetMap() {
-			ph := *ib.(IBlock).GetHash()
+		for id := range hParents.GetMap() {
+			ph := *sp.bd.getBlockById(id).GetHash()
 			if sp.dangling.Has(&ph) {
 				continue
 			}
@@ -248,7 +249,7 @@ func (sp *Spectre) votedPast(virtualBlock IBlock) *BlockDAG {
 				// must cache block  due to children index
 				sb, ok := cache[ph]
 				if !ok {
-					sb = &Block{hash: ph, parents: NewIdSet(), id: ib.(IBlock).GetID()}
+					sb = &Block{hash: ph, parents: NewIdSet(), id: id}
 					cache[ph] = sb
 				}
 				sb.GetParents().AddPair(sp.bd.getBlock(&h).GetID(), sp.bd.getBlock(&h))
@@ -262,14 +263,15 @@ func (sp *Spectre) votedPast(virtualBlock IBlock) *BlockDAG {
 	}
 	sb := &SpectreBlockData{hash: vh}
 	vp := &BlockDAG{}
-	vp.Init(spectre, nil, -1, nil, nil)
+	vp.Init(spectre, nil, -1, nil, nil, 0)
 	vp.AddBlock(sb)
 	visited = NewHashSet()
 
 	q = util.NewIterativeQueue()
 	if virtualBlock == nil {
-		for _, th := range sp.bd.tips.GetMap() {
-			sb := &SpectreBlockData{hash: *th.(IBlock).GetHash()}
+		for id := range sp.bd.tips.GetMap() {
+			th := *sp.bd.getBlockById(id).GetHash()
+			sb := &SpectreBlockData{hash: th}
 			sb.parents = []*hash.Hash{}
 			// create a virtual block as genesis
 			sb.parents = append(sb.parents, &vh)
@@ -283,8 +285,8 @@ func (sp *Spectre) votedPast(virtualBlock IBlock) *BlockDAG {
 		pos := q.Dequeue().(hash.Hash)
 		visited.Add(&pos)
 		posParents := sp.bd.getBlock(&pos).GetParents()
-		for _, ib := range posParents.GetMap() {
-			ph := *ib.(IBlock).GetHash()
+		for id := range posParents.GetMap() {
+			ph := *sp.bd.getBlockById(id).GetHash()
 			if !sp.hasVoted(ph) || sp.dangling.Has(&ph) {
 				continue
 			}
@@ -294,11 +296,12 @@ func (sp *Spectre) votedPast(virtualBlock IBlock) *BlockDAG {
 
 			all := true
 			phChildren := sp.bd.getBlock(&ph).GetChildren()
-			for _, ch := range phChildren.GetMap() {
-				if _, ok := cache[*ch.(IBlock).GetHash()]; !ok {
+			for id := range phChildren.GetMap() {
+				ch := sp.bd.getBlockById(id)
+				if _, ok := cache[*ch.GetHash()]; !ok {
 					continue
 				}
-				if !visited.Has(ch.(IBlock).GetHash()) {
+				if !visited.Has(ch.GetHash()) {
 					all = false
 				}
 			}
@@ -325,8 +328,8 @@ func (sp *Spectre) updateVotes(votedPast *BlockDAG, vh hash.Hash) bool {
 	// increase votedPast with new nodes, only happening on updating votes in candidates' past sets
 	if !votedPast.hasBlockById(votedPast.getBlock(&vh).GetID()) {
 		vhChildren := sp.bd.getBlock(&vh).GetChildren()
-		for id, ch := range vhChildren.GetMap() {
-			if !votedPast.hasBlockById(id) && !sp.hasVoted(*ch.(IBlock).GetHash()) {
+		for id := range vhChildren.GetMap() {
+			if !votedPast.hasBlockById(id) && !sp.hasVoted(*sp.bd.getBlockById(id).GetHash()) {
 				canUpdate = false
 				break
 			}
@@ -344,11 +347,11 @@ func (sp *Spectre) updateVotes(votedPast *BlockDAG, vh hash.Hash) bool {
 	}
 
 	// max parent has more nodes in its future set, which means more votes to inherit
-	for id, ph := range parents.GetMap() {
-		if ph.(IBlock).GetHash().IsEqual(votedPast.getGenesis().GetHash()) {
+	for id := range parents.GetMap() {
+		b := votedPast.getBlockById(id)
+		if b.GetHash().IsEqual(votedPast.getGenesis().GetHash()) {
 			continue
 		}
-		b := votedPast.getBlockById(id)
 		sb := votedPast.instance.(*Spectre).sblocks[*b.GetHash()]
 		if sb.Votes1 < 0 || sb.Votes2 < 0 {
 			canUpdate = false
@@ -414,10 +417,11 @@ func (sp *Spectre) updateTipVotes(voter *SpectreBlock, maxParent *SpectreBlock,
 	tipStack := stack.New()
 	tipSet := NewHashSet()
 	// take out all other tips and add their votes to child
-	for _, h := range voterParents.GetMap() {
-		if !h.(IBlock).GetHash().IsEqual(maxParent.GetHash()) && !h.(IBlock).GetHash().IsEqual(votedPast.getGenesis().GetHash()) {
+	for id := range voterParents.GetMap() {
+		h := votedPast.getBlockById(id)
+		if !h.GetHash().IsEqual(maxParent.GetHash()) && !h.GetHash().IsEqual(votedPast.getGenesis().GetHash()) {
 			tipStack.Push(h)
-			tipSet.Add(h.(IBlock).GetHash())
+			tipSet.Add(h.GetHash())
 		}
 	}
 	for tipStack.Len() > 0 {
@@ -444,15 +448,15 @@ func (sp *Spectre) updateTipVotes(voter *SpectreBlock, maxParent *SpectreBlock,
 		// e.g. in ByteBall2 with 21 as the virtual block, from 10's view, if we want to find 12's exclusive future,
 		// we save 12 into tipSet first, the 14 and 15 are 12's exclusive parents since all their children
 		// (just 12 in this case ) exist in tipSet
-		for _, ib := range tb.GetParents().GetMap() {
-			tp := *ib.(IBlock).GetHash()
+		for id := range tb.GetParents().GetMap() {
+			tp := *votedPast.getBlockById(id).GetHash()
 			if tipSet.Has(&tp) {
 				continue
 			}
 			only := true
 			tpChildren := votedPast.getBlock(&tp).GetChildren()
-			for _, tc := range tpChildren.GetMap() {
-				if !tipSet.Has(tc.(IBlock).GetHash()) {
+			for id := range tpChildren.GetMap() {
+				if !tipSet.Has(votedPast.getBlockById(id).GetHash()) {
 					only = false
 					break
 				}
@@ -475,8 +479,8 @@ func (sp *Spectre) followParents(virtualBlock IBlock) (bool, bool, error) {
 	} else { // past set of one node
 		parents = virtualBlock.GetParents()
 	}
-	for _, id := range parents.GetMap() {
-		ph := *id.(IBlock).GetHash()
+	for id := range parents.GetMap() {
+		ph := *sp.bd.getBlockById(id).GetHash()
 		if sp.dangling.Has(&ph) {
 			continue
 		}
@@ -553,8 +557,8 @@ func (sp *Spectre) voteFromFutureSet(votedPast *BlockDAG) *HashSet {
 	visited := NewHashSet()
 
 	vChildren := votedPast.getBlock(vb.GetHash()).GetChildren()
-	for _, ib := range vChildren.GetMap() {
-		ch := *ib.(IBlock).GetHash()
+	for id := range vChildren.GetMap() {
+		ch := *votedPast.getBlockById(id).GetHash()
 		// only children with one parent (virtual block) will be selected as initial tips,
 		// because they are only dependent on their single parent and their votes can be updated directly
 		// e.g. note 22 in ByteBall2, 14, 20 can be initialized with 0 votes, but 15 cannot due to its multiple parents
@@ -587,8 +591,8 @@ func (sp *Spectre) voteFromFutureSet(votedPast *BlockDAG) *HashSet {
 		n := unvisited.Dequeue().(hash.Hash)
 		childrenUpdated := true
 		nChildren := votedPast.getBlock(&n).GetChildren()
-		for _, id := range nChildren.GetMap() {
-			ch := *id.(IBlock).GetHash()
+		for id := range nChildren.GetMap() {
+			ch := *votedPast.getBlockById(id).GetHash()
 			if !visited.Has(&ch) {
 				if sp.updateVotes(votedPast, ch) {
 					visited.Add(&ch)
@@ -636,9 +640,10 @@ func (sp *Spectre) voteFromPastSet(votedPast *BlockDAG, tips *HashSet) bool {
 	outerNodes := NewHashSet()
 	for h := range tips.GetMap() {
 		hParents := sp.bd.getBlock(&h).GetParents()
-		for _, ib := range hParents.GetMap() {
-			ph := *ib.(IBlock).GetHash()
-			if !outerNodes.Has(&ph) && !votedPast.hasBlockById(ib.(IBlock).GetID()) {
+		for id := range hParents.GetMap() {
+			ib := sp.bd.getBlockById(id)
+			ph := *ib.GetHash()
+			if !outerNodes.Has(&ph) && !votedPast.hasBlockById(id) {
 				unvisited.Enqueue(ph)
 				outerNodes.AddPair(&ph, ib)
 			}
@@ -688,8 +693,8 @@ func (sp *Spectre) voteFromPastSet(votedPast *BlockDAG, tips *HashSet) bool {
 					}
 					allUpdated := votedPast.hasBlockById(ib.(IBlock).GetID())
 					oParents := sp.bd.getBlock(&o).GetParents()
-					for _, oib := range oParents.GetMap() {
-						ph := *oib.(IBlock).GetHash()
+					for id := range oParents.GetMap() {
+						ph := *sp.bd.getBlockById(id).GetHash()
 						if !sp.updateVotes(votedPast, ph) {
 							allUpdated = false
 							break
@@ -706,10 +711,11 @@ func (sp *Spectre) voteFromPastSet(votedPast *BlockDAG, tips *HashSet) bool {
 				for r := range removing.GetMap() {
 					outerNodes.Remove(&r)
 					rChildren := votedPast.getBlock(&r).GetChildren()
-					for _, c := range rChildren.GetMap() {
-						if !outerNodes.Has(c.(IBlock).GetHash()) {
-							outerNodes.Add(c.(IBlock).GetHash())
-							unvisited.Enqueue(c)
+					for id := range rChildren.GetMap() {
+						c := votedPast.getBlockById(id).GetHash()
+						if !outerNodes.Has(c) {
+							outerNodes.Add(c)
+							unvisited.Enqueue(*c)
 						}
 					}
 				}
@@ -726,9 +732,9 @@ func (sp *Spectre) newVoter(vh hash.Hash, votedPast *BlockDAG) IBlock {
 	sb := SpectreBlockData{hash: vh}
 	sb.parents = []*hash.Hash{}
 	vhChildren := sp.bd.getBlock(&vh).GetChildren()
-	for _, ib := range vhChildren.GetMap() {
-		hash := *ib.(IBlock).GetHash()
-		if votedPast.hasBlockById(ib.(IBlock).GetID()) {
+	for id := range vhChildren.GetMap() {
+		hash := *sp.bd.getBlockById(id).GetHash()
+		if votedPast.hasBlockById(id) {
 			sb.parents = append(sb.parents, &hash)
 		}
 	}
@@ -743,13 +749,10 @@ func (sp *Spectre) newVoter(vh hash.Hash, votedPast *BlockDAG) IBlock {
 			hash := *h
 			block.parents.Add(votedPast.getBlock(&hash).GetID())
 			parent := votedPast.getBlock(&hash)
-			parent.AddChild(&block)
+			parent.AddChild(block.id)
 		}
 	}
-	if votedPast.blocks == nil {
-		votedPast.blocks = map[uint]IBlock{}
-	}
-	votedPast.blocks[block.id] = &block
+	votedPast.blocks.put(&block)
 	if votedPast.blockTotal == 0 {
 		votedPast.genesis = *block.GetHash()
 	}
@@ -775,9 +778,9 @@ func (sp *Spectre) voteByUniqueFutureSet(b1 IBlock, b2 IBlock) {
 
 	for hf, ibf := range fs1.GetMap() {
 		hfParents := sp.bd.getBlockById(hf).GetParents()
-		for h, ib := range hfParents.GetMap() {
+		for h := range hfParents.GetMap() {
 			if !fs1.Has(h) && !fs2.Has(h) {
-				sp.dangling.Add(ib.(IBlock).GetHash())
+				sp.dangling.Add(sp.bd.getBlockById(h).GetHash())
 			}
 		}
 		if fs2.Has(hf) {
@@ -789,20 +792,20 @@ func (sp *Spectre) voteByUniqueFutureSet(b1 IBlock, b2 IBlock) {
 
 	for _, ib := range fs2.GetMap() {
 		hfParents := ib.(IBlock).GetParents()
-		for h, ibp := range hfParents.GetMap() {
+		for h := range hfParents.GetMap() {
 			if !fs1.Has(h) && !fs2.Has(h) {
-				sp.dangling.Add(ibp.(IBlock).GetHash())
+				sp.dangling.Add(sp.bd.getBlockById(h).GetHash())
 			}
 		}
 		sp.voteSecond(*ib.(IBlock).GetHash())
 	}
 	sp.dangling.Remove(b1.GetHash())
 	sp.dangling.Remove(b2.GetHash())
-	for _, ib := range b1.GetParents().GetMap() {
-		sp.dangling.Remove(ib.(IBlock).GetHash())
+	for id := range b1.GetParents().GetMap() {
+		sp.dangling.Remove(sp.bd.getBlockById(id).GetHash())
 	}
-	for _, ib := range b2.GetParents().GetMap() {
-		sp.dangling.Remove(ib.(IBlock).GetHash())
+	for id := range b2.GetParents().GetMap() {
+		sp.dangling.Remove(sp.bd.getBlockById(id).GetHash())
 	}
 }
 
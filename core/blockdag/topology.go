@@ -0,0 +1,212 @@
+package blockdag
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+)
+
+// The maximum number of blocks returned by one topology query, the past,
+// future and blue sets are paged by this size.
+const MaxTopologyPageSize = 1000
+
+// Return the block of hash, or an error when the DAG doesn't have it.
+func (bd *BlockDAG) mustGetBlock(h *hash.Hash) (IBlock, error) {
+	ib := bd.getBlock(h)
+	if ib == nil {
+		return nil, fmt.Errorf("Block not found: %v", h)
+	}
+	return ib, nil
+}
+
+// Convert a list of block ids to block hashes
+func (bd *BlockDAG) getHashList(ids []uint) []*hash.Hash {
+	result := make([]*hash.Hash, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, bd.getBlockById(id).GetHash())
+	}
+	return result
+}
+
+// Check the page of a topology query
+func checkPage(count uint) error {
+	if count == 0 || count > MaxTopologyPageSize {
+		return fmt.Errorf("The page size must be between 1 and %d", MaxTopologyPageSize)
+	}
+	return nil
+}
+
+// GetAnticone returns the anticone of the block at the current state of the
+// DAG, it is sorted by block id.
+func (bd *BlockDAG) GetAnticone(h *hash.Hash) ([]*hash.Hash, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib, err := bd.mustGetBlock(h)
+	if err != nil {
+		return nil, err
+	}
+	return bd.getHashList(bd.getAnticone(ib, nil).SortList(false)), nil
+}
+
+// GetPastSet returns a page of the past set of the block, the past set is
+// walked breadth first from the parents of block so the closest blocks come
+// first. It skips start blocks, returns at most count blocks and reports
+// whether there are more.
+func (bd *BlockDAG) GetPastSet(h *hash.Hash, start uint, count uint) ([]*hash.Hash, bool, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib, err := bd.mustGetBlock(h)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkPage(count); err != nil {
+		return nil, false, err
+	}
+	ids, more := bd.walkSet(ib, func(b IBlock) *IdSet { return b.GetParents() }, start, count)
+	return bd.getHashList(ids), more, nil
+}
+
+// GetFutureSet returns a page of the future set of the block, in the same way
+// as GetPastSet but walking the children. Note that the future set grows with
+// the DAG, so the later pages may shift between calls.
+func (bd *BlockDAG) GetFutureSet(h *hash.Hash, start uint, count uint) ([]*hash.Hash, bool, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib, err := bd.mustGetBlock(h)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkPage(count); err != nil {
+		return nil, false, err
+	}
+	ids, more := bd.walkSet(ib, func(b IBlock) *IdSet { return b.GetChildren() }, start, count)
+	return bd.getHashList(ids), more, nil
+}
+
+// Walk the blocks reachable from b through next breadth first, the neighbors
+// are visited by id so that the pages are stable. It stops as soon as the page
+// is full, so the blocks out of the page are never loaded.
+func (bd *BlockDAG) walkSet(b IBlock, next func(IBlock) *IdSet, start uint, count uint) ([]uint, bool) {
+	result := []uint{}
+	visited := NewIdSet()
+	visited.Add(b.GetID())
+	queue := []IBlock{b}
+	skipped := uint(0)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		neighbors := next(cur)
+		if neighbors == nil || neighbors.IsEmpty() {
+			continue
+		}
+		for _, k := range neighbors.SortList(false) {
+			if visited.Has(k) {
+				continue
+			}
+			if uint(len(result)) == count {
+				return result, true
+			}
+			visited.Add(k)
+			if skipped < start {
+				skipped++
+			} else {
+				result = append(result, k)
+			}
+			queue = append(queue, bd.getBlockById(k))
+		}
+	}
+	return result, false
+}
+
+// GetBlueSet returns a page of the blue set of the past of block, as colored
+// by the block itself. The blues are listed from the block back along its
+// main parent chain, so the page count matches the blue number of block.
+// Only phantom colors the blocks.
+func (bd *BlockDAG) GetBlueSet(h *hash.Hash, start uint, count uint) ([]*hash.Hash, bool, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib, err := bd.mustGetBlock(h)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkPage(count); err != nil {
+		return nil, false, err
+	}
+	pb, ok := ib.(*PhantomBlock)
+	if !ok {
+		return nil, false, fmt.Errorf("The blue set is not supported by %s", bd.instance.GetName())
+	}
+
+	result := []uint{}
+	skipped := uint(0)
+	add := func(id uint) bool {
+		if uint(len(result)) == count {
+			return false
+		}
+		if skipped < start {
+			skipped++
+		} else {
+			result = append(result, id)
+		}
+		return true
+	}
+	for cur := pb; ; {
+		if cur != pb && !add(cur.GetID()) {
+			return bd.getHashList(result), true, nil
+		}
+		for _, k := range cur.blueDiffAnticone.SortList(false) {
+			if !add(k) {
+				return bd.getHashList(result), true, nil
+			}
+		}
+		if cur.mainParent == MaxId {
+			break
+		}
+		cur = bd.getBlockById(cur.mainParent).(*PhantomBlock)
+	}
+	return bd.getHashList(result), false, nil
+}
+
+// GetMainParentChain returns the main parent chain from the block of from to
+// the block of to, both included and from first. The block of from must be on
+// the main parent chain of to, and at most MaxTopologyPageSize blocks apart.
+func (bd *BlockDAG) GetMainParentChain(from *hash.Hash, to *hash.Hash) ([]*hash.Hash, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	fromBlock, err := bd.mustGetBlock(from)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := bd.mustGetBlock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []uint{}
+	for {
+		if len(chain) == MaxTopologyPageSize {
+			return nil, fmt.Errorf("The main parent chain is longer than %d blocks", MaxTopologyPageSize)
+		}
+		chain = append(chain, cur.GetID())
+		if cur.GetID() == fromBlock.GetID() {
+			break
+		}
+		if cur.GetMainParent() == MaxId || cur.GetLayer() <= fromBlock.GetLayer() {
+			return nil, fmt.Errorf("%v is not on the main parent chain of %v", from, to)
+		}
+		cur = bd.getBlockById(cur.GetMainParent())
+	}
+	return bd.getHashList(reverseIdList(chain)), nil
+}
+
+func reverseIdList(s []uint) []uint {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package blockdag
+
+import (
+	"testing"
+)
+
+func Test_Topology(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+
+	anticone, err := bd.GetAnticone(tbMap[testData.PH_GetAnticone.Input].GetHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !processResult(bd.GetIdSet(anticone), changeToIDList(testData.PH_GetAnticone.Output)) {
+		t.FailNow()
+	}
+
+	// The future set is paged
+	futureBlock := tbMap[testData.PH_GetFutureSet.Input].GetHash()
+	first, more, err := bd.GetFutureSet(futureBlock, 0, 2)
+	if err != nil || len(first) != 2 || !more {
+		t.Fatalf("first page of future set: %v %v %v", first, more, err)
+	}
+	second, more, err := bd.GetFutureSet(futureBlock, 2, MaxTopologyPageSize)
+	if err != nil || len(second) != 2 || more {
+		t.Fatalf("second page of future set: %v %v %v", second, more, err)
+	}
+	if !processResult(bd.GetIdSet(append(first, second...)), changeToIDList(testData.PH_GetFutureSet.Output)) {
+		t.FailNow()
+	}
+	if _, _, err := bd.GetFutureSet(futureBlock, 0, 0); err == nil {
+		t.Fatalf("empty page")
+	}
+
+	past, more, err := bd.GetPastSet(tbMap["J"].GetHash(), 0, MaxTopologyPageSize)
+	if err != nil || more {
+		t.Fatalf("past set: %v %v", more, err)
+	}
+	if !processResult(bd.GetIdSet(past), changeToIDList([]string{"A", "B", "C", "D", "E", "G"})) {
+		t.FailNow()
+	}
+
+	// The blue set of the main chain tip has its blue number of blocks
+	tip := bd.GetMainChainTip().(*PhantomBlock)
+	blues, more, err := bd.GetBlueSet(tip.GetHash(), 0, MaxTopologyPageSize)
+	if err != nil || more || uint(len(blues)) != tip.GetBlueNum() {
+		t.Fatalf("blue set: %d blues of %d %v %v", len(blues), tip.GetBlueNum(), more, err)
+	}
+	for _, h := range blues {
+		if !bd.IsBlue(bd.GetBlock(h).GetID()) {
+			t.Fatalf("%s is not blue", getBlockTag(bd.GetBlock(h).GetID()))
+		}
+	}
+	page, more, err := bd.GetBlueSet(tip.GetHash(), 1, 2)
+	if err != nil || !more || len(page) != 2 || !page[0].IsEqual(blues[1]) {
+		t.Fatalf("page of blue set: %v %v %v", page, more, err)
+	}
+
+	chain, err := bd.GetMainParentChain(tbMap["A"].GetHash(), tip.GetHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain[0].IsEqual(tbMap["A"].GetHash()) || !chain[len(chain)-1].IsEqual(tip.GetHash()) {
+		t.Fatalf("main parent chain %v", chain)
+	}
+	for i := 1; i < len(chain); i++ {
+		if bd.GetBlock(chain[i]).GetMainParent() != bd.GetBlock(chain[i-1]).GetID() {
+			t.Fatalf("%d is not the main parent of %d", i-1, i)
+		}
+	}
+	if _, err := bd.GetMainParentChain(tbMap["H"].GetHash(), tbMap["J"].GetHash()); err == nil {
+		t.Fatalf("H is not on the main parent chain of J")
+	}
+}
@@ -12,6 +12,10 @@ import (
 
 // update db to new version
 func (bd *BlockDAG) UpgradeDB(dbTx database.Tx, blockTotal uint) error {
+	err := DBCreateDAGBuckets(dbTx.Metadata())
+	if err != nil {
+		return err
+	}
 	blocks := NewHashSet()
 	for i := uint(0); i < blockTotal; i++ {
 		block := Block{id: i}
@@ -36,6 +36,11 @@ var (
 	// BCDBInfoBucketName bucket.
 	BCDBInfoCreatedKeyName = []byte("created")
 
+	// BCDBInfoPrunedKeyName is the name of the database key used to mark
+	// that old blocks have been pruned from the database.  It is itself
+	// under the BCDBInfoBucketName bucket.
+	BCDBInfoPrunedKeyName = []byte("pruned")
+
 	// HashIndexBucketName is the name of the db bucket used to house to the
 	// block hash -> block order index.
 	HashIndexBucketName = []byte("hashidx")
@@ -68,6 +73,52 @@ var (
 	// dag information
 	DagInfoBucketName = []byte("daginfo")
 
+	// DagChildrenBucketName is the name of the db bucket used to house the
+	// block id -> children ids index of the dag blocks.
+	DagChildrenBucketName = []byte("dagchildren")
+
 	// CacheInvalidTx is the name of the db bucket used to cache invalid tx
 	CacheInvalidTxName = []byte("cacheinvalidtx")
+
+	// AssetBucketName is the name of the db bucket used to house the
+	// registry of issued native assets.
+	AssetBucketName = []byte("assets")
+
+	// AssetBalanceBucketName is the name of the db bucket used to house the
+	// asset balances held by every public key script.
+	AssetBalanceBucketName = []byte("assetbalances")
+
+	// StateTrieBucketName is the name of the db bucket used to house the
+	// nodes of the trie committing to the utxo set.
+	StateTrieBucketName = []byte("statetrie")
+
+	// StateTrieRefsBucketName is the name of the db bucket used to house the
+	// node hash -> reference count index of the state trie nodes, counting
+	// the stored nodes and the roots referencing them.
+	StateTrieRefsBucketName = []byte("statetrierefs")
+
+	// StateRootBucketName is the name of the db bucket used to house the
+	// block order -> state root index.
+	StateRootBucketName = []byte("stateroots")
+
+	// StateTipKeyName is the name of the db key used to store the state
+	// root of the utxo set as of the last connected block.
+	StateTipKeyName = []byte("statetip")
+
+	// ContractRootBucketName is the name of the db bucket used to house the
+	// block order -> contract storage root index.  The nodes of the
+	// contract storage trie are stored in the state trie bucket.
+	ContractRootBucketName = []byte("contractroots")
+
+	// ContractTipKeyName is the name of the db key used to store the root
+	// of the contract storage as of the last connected block.
+	ContractTipKeyName = []byte("contracttip")
+
+	// ReceiptBucketName is the name of the db bucket used to house the
+	// block hash -> block receipt index.
+	ReceiptBucketName = []byte("receipts")
+
+	// FeeEstimatorKeyName is the name of the db key used to store the state
+	// of the fee estimator while the node is stopped.
+	FeeEstimatorKeyName = []byte("estimatefee")
 )
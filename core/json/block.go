@@ -45,8 +45,37 @@ type GetBlockHeaderVerboseResult struct {
 	ParentRoot    string    `json:"parentroot"`
 	TxRoot        string    `json:"txRoot"`
 	StateRoot     string    `json:"stateRoot"`
+	OrderState    string    `json:"orderStateRoot,omitempty"`
 	Difficulty    uint32    `json:"difficulty"`
 	Layer         uint32    `json:"layer"`
 	Time          int64     `json:"time"`
 	PowResult     PowResult `json:"pow"`
 }
+
+// DeploymentInfoResult models the state of a consensus rule change deployment
+// as returned by the getDeploymentInfo command.
+type DeploymentInfoResult struct {
+	Name       string `json:"name"`
+	Bit        uint8  `json:"bit"`
+	StartTime  uint64 `json:"startTime"`
+	ExpireTime uint64 `json:"expireTime"`
+	Status     string `json:"status"`
+}
+
+// GetDeploymentInfoResult models the data from the getDeploymentInfo command.
+// The states apply to the block following the main chain tip.
+type GetDeploymentInfoResult struct {
+	Hash        string                 `json:"hash"`
+	Window      uint32                 `json:"window"`
+	Threshold   uint32                 `json:"threshold"`
+	Deployments []DeploymentInfoResult `json:"deployments"`
+}
+
+// GetDAGSetResult models a page of a block set of the DAG, as returned by the
+// getPastSet, getFutureSet and getBlueSet commands.
+type GetDAGSetResult struct {
+	Hash   string   `json:"hash"`
+	Start  uint     `json:"start"`
+	Blocks []string `json:"blocks"`
+	More   bool     `json:"more"`
+}
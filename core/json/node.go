@@ -38,6 +38,8 @@ type GetPeerInfoResult struct {
 	LastRecv   int64               `json:"lastrecv"`
 	BytesSent  uint64              `json:"bytessent"`
 	BytesRecv  uint64              `json:"bytesrecv"`
+	SentPerMsg map[string]MsgStats `json:"sent_per_msg"`
+	RecvPerMsg map[string]MsgStats `json:"recv_per_msg"`
 	ConnTime   int64               `json:"conntime"`
 	TimeOffset int64               `json:"timeoffset"`
 	PingTime   float64             `json:"pingtime"`
@@ -45,11 +47,45 @@ type GetPeerInfoResult struct {
 	Version    uint32              `json:"version"`
 	SubVer     string              `json:"subver"`
 	Inbound    bool                `json:"inbound"`
+	Transport  string              `json:"transport"`
 	BanScore   int32               `json:"banscore"`
 	SyncNode   bool                `json:"syncnode"`
 	GraphState GetGraphStateResult `json:"graphstate"`
 }
 
+// MsgStats models the messages and bytes of a command in the getpeerinfo
+// command.
+type MsgStats struct {
+	Msgs  uint64 `json:"msgs"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// NetRateResult models the traffic rate over a time window.
+type NetRateResult struct {
+	Window     int64   `json:"window"`
+	SentPerSec float64 `json:"sentpersec"`
+	RecvPerSec float64 `json:"recvpersec"`
+}
+
+// UploadTargetResult models the upload target in the getnettotals command.
+type UploadTargetResult struct {
+	TimeFrame             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks bool   `json:"serve_historical_blocks"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"`
+}
+
+// GetNetTotalsResult models the data returned from the getnettotals command.
+type GetNetTotalsResult struct {
+	TotalBytesRecv uint64             `json:"totalbytesrecv"`
+	TotalBytesSent uint64             `json:"totalbytessent"`
+	TimeMillis     int64              `json:"timemillis"`
+	Rates          []NetRateResult    `json:"rates"`
+	UploadTarget   UploadTargetResult `json:"uploadtarget"`
+}
+
 // GetGraphStateResult data
 type GetGraphStateResult struct {
 	Tips       []string `json:"tips"`
@@ -59,6 +95,8 @@ type GetGraphStateResult struct {
 }
 
 type GetBanlistResult struct {
-	Host   string `json:"host"`
-	Expire string `json:"expire"`
+	Host    string `json:"host"`
+	Created string `json:"created"`
+	Expire  string `json:"expire"`
+	Reason  string `json:"reason"`
 }
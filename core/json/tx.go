@@ -73,6 +73,7 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 // getrawtransaction and decoderawtransaction use the same structure.
 type Vout struct {
 	Amount       uint64             `json:"amount"`
+	Asset        string             `json:"asset,omitempty"`
 	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
 }
 
@@ -104,6 +105,67 @@ type GetUtxoResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// ListUnspentResult models a successful response from the listUnspent
+// command.
+type ListUnspentResult struct {
+	TxId          string  `json:"txid"`
+	Vout          uint32  `json:"vout"`
+	Address       string  `json:"address"`
+	ScriptPubKey  string  `json:"scriptPubKey"`
+	Amount        float64 `json:"amount"`
+	Confirmations uint    `json:"confirmations"`
+	Coinbase      bool    `json:"coinbase"`
+	Spendable     bool    `json:"spendable"`
+}
+
+// GetMempoolInfoResult models the data returned from the getmempoolinfo
+// command.  The fee rates are in atoms/kB.
+type GetMempoolInfoResult struct {
+	Size          int64 `json:"size"`
+	Bytes         int64 `json:"bytes"`
+	MaxMempool    int64 `json:"maxmempool"`
+	MempoolMinFee int64 `json:"mempoolminfee"`
+	MinRelayTxFee int64 `json:"minrelaytxfee"`
+}
+
+// DecodePsbtResult models the data returned from the decodePsbt command.  The
+// fee is only known once the outputs spent by every input were added.
+type DecodePsbtResult struct {
+	Tx       interface{}        `json:"tx"`
+	Unknown  map[string]string  `json:"unknown,omitempty"`
+	Inputs   []PsbtInputResult  `json:"inputs"`
+	Outputs  []PsbtOutputResult `json:"outputs"`
+	Fee      *int64             `json:"fee,omitempty"`
+	Complete bool               `json:"complete"`
+}
+
+// PsbtInputResult models the signing data of an input of a decoded psbt.  The
+// partial signatures are keyed by public key.
+type PsbtInputResult struct {
+	Utxo           *Vout                   `json:"utxo,omitempty"`
+	PartialSigs    map[string]string       `json:"partialSignatures,omitempty"`
+	SighashType    uint32                  `json:"sighash,omitempty"`
+	RedeemScript   *ScriptSig              `json:"redeemScript,omitempty"`
+	Bip32Derivs    []Bip32DerivationResult `json:"bip32Derivs,omitempty"`
+	FinalScriptSig *ScriptSig              `json:"finalScriptSig,omitempty"`
+	MissingSigs    int                     `json:"missingSigs,omitempty"`
+	Unknown        map[string]string       `json:"unknown,omitempty"`
+}
+
+// PsbtOutputResult models the data of an output of a decoded psbt.
+type PsbtOutputResult struct {
+	RedeemScript *ScriptSig              `json:"redeemScript,omitempty"`
+	Bip32Derivs  []Bip32DerivationResult `json:"bip32Derivs,omitempty"`
+	Unknown      map[string]string       `json:"unknown,omitempty"`
+}
+
+// Bip32DerivationResult models the BIP32 derivation path of a public key.
+type Bip32DerivationResult struct {
+	PubKey            string `json:"pubkey"`
+	MasterFingerprint string `json:"masterFingerprint"`
+	Path              string `json:"path"`
+}
+
 // GetRawTransactionsResult models the data from the getrawtransactions
 // command.
 type GetRawTransactionsResult struct {
@@ -70,6 +70,14 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFTypes      = "cftypes"
+	CmdFilterAdd    = "filteradd"
+	CmdFilterClear  = "filterclear"
+	CmdFilterLoad   = "filterload"
+	CmdMerkleBlock  = "merkleblock"
+	CmdSendCmpct    = "sendcmpct"
+	CmdCmpctBlock   = "cmpctblock"
+	CmdGetBlockTxn  = "getblocktxn"
+	CmdBlockTxn     = "blocktxn"
 )
 
 // Message is an interface that describes a qitmeer message.  A type that
@@ -134,31 +142,38 @@ func makeEmptyMessage(command string) (Message, error) {
 		msg = &MsgSyncPoint{}
 	case CmdFeeFilter:
 		msg = &MsgFeeFilter{}
+	case CmdGetCFilter:
+		msg = &MsgGetCFilter{}
+	case CmdGetCFHeaders:
+		msg = &MsgGetCFHeaders{}
+	case CmdGetCFTypes:
+		msg = &MsgGetCFTypes{}
+	case CmdCFilter:
+		msg = &MsgCFilter{}
+	case CmdCFHeaders:
+		msg = &MsgCFHeaders{}
+	case CmdCFTypes:
+		msg = &MsgCFTypes{}
+	case CmdFilterAdd:
+		msg = &MsgFilterAdd{}
+	case CmdFilterClear:
+		msg = &MsgFilterClear{}
+	case CmdFilterLoad:
+		msg = &MsgFilterLoad{}
+	case CmdMerkleBlock:
+		msg = &MsgMerkleBlock{}
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
 	/*
 		case CmdSendHeaders:
 			msg = &MsgSendHeaders{}
-
-
-
-		case CmdGetCFilter:
-			msg = &MsgGetCFilter{}
-
-		case CmdGetCFHeaders:
-			msg = &MsgGetCFHeaders{}
-
-		case CmdGetCFTypes:
-			msg = &MsgGetCFTypes{}
-
-		case CmdCFilter:
-			msg = &MsgCFilter{}
-
-		case CmdCFHeaders:
-			msg = &MsgCFHeaders{}
-
-		case CmdCFTypes:
-			msg = &MsgCFTypes{}
 	*/
-
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -8,6 +8,7 @@ package message
 
 import (
 	"fmt"
+	"github.com/Qitmeer/qitmeer/core/protocol"
 	s "github.com/Qitmeer/qitmeer/core/serialization"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"io"
@@ -27,6 +28,10 @@ const MaxAddrPerMsg = 1000
 //
 // Use the AddAddress function to build up the list of known addresses when
 // sending an addr message to another peer.
+//
+// Since protocol version AddrV2Version the addresses are encoded with the id of
+// their network, so the version 3 tor hidden services can be relayed.  The
+// addresses of the networks which are not known are skipped.
 type MsgAddr struct {
 	AddrList []*types.NetAddress
 }
@@ -78,10 +83,17 @@ func (msg *MsgAddr) Decode(r io.Reader, pver uint32) error {
 	msg.AddrList = make([]*types.NetAddress, 0, count)
 	for i := uint64(0); i < count; i++ {
 		na := &addrList[i]
-		err := types.ReadNetAddress(r, pver, na, true)
+		if pver >= protocol.AddrV2Version {
+			err = types.ReadNetAddressV2(r, pver, na, true)
+		} else {
+			err = types.ReadNetAddress(r, pver, na, true)
+		}
 		if err != nil {
 			return err
 		}
+		if na.IP == nil && na.Host == "" {
+			continue
+		}
 		msg.AddAddress(na)
 	}
 	return nil
@@ -105,7 +117,11 @@ func (msg *MsgAddr) Encode(w io.Writer, pver uint32) error {
 	}
 
 	for _, na := range msg.AddrList {
-		err = types.WriteNetAddress(w, pver, na, true)
+		if pver >= protocol.AddrV2Version {
+			err = types.WriteNetAddressV2(w, pver, na, true)
+		} else {
+			err = types.WriteNetAddress(w, pver, na, true)
+		}
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,100 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+// MsgBlockTxn implements the Message interface and represents a blocktxn
+// message.  It is the response to a getblocktxn message and holds the
+// requested transactions of the block in order of the requested indexes.
+type MsgBlockTxn struct {
+	BlockHash    hash.Hash
+	Transactions []*types.Transaction
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) Decode(r io.Reader, pver uint32) error {
+	err := s.ReadElements(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.Decode", str)
+	}
+
+	msg.Transactions = make([]*types.Transaction, 0, count)
+	for i := uint64(0); i < count; i++ {
+		tx := types.Transaction{}
+		err := tx.Decode(r, pver)
+		if err != nil {
+			return err
+		}
+		msg.Transactions = append(msg.Transactions, &tx)
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) Encode(w io.Writer, pver uint32) error {
+	count := len(msg.Transactions)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.Encode", str)
+	}
+
+	err := s.WriteElements(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	for _, tx := range msg.Transactions {
+		err = tx.Encode(w, pver, types.TxSerializeFull)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	return types.MaxBlockPayload
+}
+
+// NewMsgBlockTxn returns a new blocktxn message that conforms to the Message
+// interface.  See MsgBlockTxn for details.
+func NewMsgBlockTxn(blockHash *hash.Hash) *MsgBlockTxn {
+	return &MsgBlockTxn{
+		BlockHash:    *blockHash,
+		Transactions: make([]*types.Transaction, 0),
+	}
+}
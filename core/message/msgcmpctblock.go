@@ -0,0 +1,233 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+// ShortIDSize is the size of the short transaction ids of a compact block.
+const ShortIDSize = 6
+
+// PrefilledTx is a transaction which is sent in full within a compact block,
+// along with its index in the block.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *types.Transaction
+}
+
+// MsgCmpctBlock implements the Message interface and represents a cmpctblock
+// message.  It holds the header and parents of a block, the transactions of
+// the block being replaced by short ids which the receiver matches against
+// its transaction pool.  The transactions the receiver can't have, such as
+// the coinbase, are prefilled.
+//
+// The prefilled transactions are sorted by index, and the short ids are the
+// ids of the other transactions in order of the block.
+type MsgCmpctBlock struct {
+	Header       types.BlockHeader
+	Parents      []*hash.Hash
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []*PrefilledTx
+}
+
+// TxCount returns the number of transactions of the block.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) Decode(r io.Reader, pver uint32) error {
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > types.MaxParentsPerBlock {
+		str := fmt.Sprintf("too many parents for message "+
+			"[count %v, max %v]", count, types.MaxParentsPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.Parents = make([]*hash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var h hash.Hash
+		err := s.ReadElements(r, &h)
+		if err != nil {
+			return err
+		}
+		msg.Parents = append(msg.Parents, &h)
+	}
+
+	err = s.ReadElements(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	count, err = s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.ShortIDs = make([]uint64, 0, count)
+	var buf [8]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf[:ShortIDSize]); err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, binary.LittleEndian.Uint64(buf[:]))
+	}
+
+	count, err = s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	txCount := uint64(len(msg.ShortIDs)) + count
+	if txCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", txCount, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+
+	// The indexes are differentially encoded, each one is the number of
+	// transactions skipped since the previous prefilled transaction.
+	msg.PrefilledTxs = make([]*PrefilledTx, 0, count)
+	index := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		diff, err := s.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			index++
+		}
+		if diff >= txCount || index+diff >= txCount {
+			str := fmt.Sprintf("prefilled transaction index out of "+
+				"range [count %v]", txCount)
+			return messageError("MsgCmpctBlock.Decode", str)
+		}
+		index += diff
+
+		tx := types.Transaction{}
+		err = tx.Decode(r, pver)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxs = append(msg.PrefilledTxs,
+			&PrefilledTx{Index: uint32(index), Tx: &tx})
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) Encode(w io.Writer, pver uint32) error {
+	if len(msg.Parents) > types.MaxParentsPerBlock {
+		str := fmt.Sprintf("too many parents for message "+
+			"[count %v, max %v]", len(msg.Parents), types.MaxParentsPerBlock)
+		return messageError("MsgCmpctBlock.Encode", str)
+	}
+	txCount := msg.TxCount()
+	if txCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", txCount, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Encode", str)
+	}
+
+	err := msg.Header.Serialize(w)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.Parents)))
+	if err != nil {
+		return err
+	}
+	for _, h := range msg.Parents {
+		err = s.WriteElements(w, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.WriteElements(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, id := range msg.ShortIDs {
+		binary.LittleEndian.PutUint64(buf[:], id)
+		if _, err := w.Write(buf[:ShortIDSize]); err != nil {
+			return err
+		}
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	next := uint32(0)
+	for _, ptx := range msg.PrefilledTxs {
+		if ptx.Index < next || int(ptx.Index) >= txCount {
+			str := fmt.Sprintf("prefilled transaction index %v is "+
+				"out of order or range [count %v]", ptx.Index, txCount)
+			return messageError("MsgCmpctBlock.Encode", str)
+		}
+		err = s.WriteVarInt(w, pver, uint64(ptx.Index-next))
+		if err != nil {
+			return err
+		}
+		next = ptx.Index + 1
+
+		err = ptx.Tx.Encode(w, pver, types.TxSerializeFull)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	return MaxMessagePayload
+}
+
+// NewMsgCmpctBlock returns a new cmpctblock message that conforms to the
+// Message interface.  See MsgCmpctBlock for details.
+func NewMsgCmpctBlock(bh *types.BlockHeader, parents []*hash.Hash, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header:       *bh,
+		Parents:      parents,
+		Nonce:        nonce,
+		ShortIDs:     make([]uint64, 0),
+		PrefilledTxs: make([]*PrefilledTx, 0),
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a
+// getblocktxn message.  It is used to request the transactions of a compact
+// block which couldn't be found in the transaction pool, by their indexes in
+// the block.  The response is a blocktxn message.
+type MsgGetBlockTxn struct {
+	BlockHash hash.Hash
+	Indexes   []uint32
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Decode(r io.Reader, pver uint32) error {
+	err := s.ReadElements(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.Decode", str)
+	}
+
+	// The indexes are differentially encoded like the ones of the
+	// prefilled transactions of a compact block.
+	msg.Indexes = make([]uint32, 0, count)
+	index := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		diff, err := s.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			index++
+		}
+		if diff >= maxTxPerBlock || index+diff >= maxTxPerBlock {
+			str := fmt.Sprintf("transaction index out of range "+
+				"[max %v]", maxTxPerBlock)
+			return messageError("MsgGetBlockTxn.Decode", str)
+		}
+		index += diff
+		msg.Indexes = append(msg.Indexes, uint32(index))
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Encode(w io.Writer, pver uint32) error {
+	count := len(msg.Indexes)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.Encode", str)
+	}
+
+	err := s.WriteElements(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	next := uint32(0)
+	for _, index := range msg.Indexes {
+		if index < next {
+			str := fmt.Sprintf("transaction index %v is out of "+
+				"order", index)
+			return messageError("MsgGetBlockTxn.Encode", str)
+		}
+		err = s.WriteVarInt(w, pver, uint64(index-next))
+		if err != nil {
+			return err
+		}
+		next = index + 1
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max indexes (varInt each).
+	return hash.HashSize + MaxVarIntPayload + maxTxPerBlock*MaxVarIntPayload
+}
+
+// NewMsgGetBlockTxn returns a new getblocktxn message that conforms to the
+// Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *hash.Hash, indexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   indexes,
+	}
+}
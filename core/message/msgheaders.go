@@ -7,7 +7,9 @@ package message
 
 import (
 	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/protocol"
 	s "github.com/Qitmeer/qitmeer/core/serialization"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"io"
@@ -22,20 +24,37 @@ const MaxBlockHeadersPerMsg = 2000
 // to a getheaders message (MsgGetHeaders).  The maximum number of block headers
 // per message is currently 2000.  See MsgGetHeaders for details on requesting
 // the headers.
+//
+// Since protocol version HeaderParentsVersion every header is followed by the
+// hashes of its parents, which the header only commits to through its parent
+// root.  Parents[i] holds the parents of Headers[i].
 type MsgHeaders struct {
 	Headers []*types.BlockHeader
+	Parents [][]*hash.Hash
 	GS      *blockdag.GraphState
 }
 
 // AddBlockHeader adds a new block header to the message.
 func (msg *MsgHeaders) AddBlockHeader(bh *types.BlockHeader) error {
+	return msg.AddBlockHeaderWithParents(bh, nil)
+}
+
+// AddBlockHeaderWithParents adds a new block header and the hashes of the
+// parents of its block to the message.
+func (msg *MsgHeaders) AddBlockHeaderWithParents(bh *types.BlockHeader, parents []*hash.Hash) error {
 	if len(msg.Headers)+1 > MaxBlockHeadersPerMsg {
 		str := fmt.Sprintf("too many block headers in message [max %v]",
 			MaxBlockHeadersPerMsg)
 		return messageError("MsgHeaders.AddBlockHeader", str)
 	}
+	if len(parents) > types.MaxParentsPerBlock {
+		str := fmt.Sprintf("too many parents for block header [max %v]",
+			types.MaxParentsPerBlock)
+		return messageError("MsgHeaders.AddBlockHeader", str)
+	}
 
 	msg.Headers = append(msg.Headers, bh)
+	msg.Parents = append(msg.Parents, parents)
 	return nil
 }
 
@@ -58,6 +77,7 @@ func (msg *MsgHeaders) Decode(r io.Reader, pver uint32) error {
 	// reduce the number of allocations.
 	headers := make([]types.BlockHeader, count)
 	msg.Headers = make([]*types.BlockHeader, 0, count)
+	msg.Parents = make([][]*hash.Hash, 0, count)
 	for i := uint64(0); i < count; i++ {
 		bh := &headers[i]
 		err := bh.Deserialize(r)
@@ -76,7 +96,15 @@ func (msg *MsgHeaders) Decode(r io.Reader, pver uint32) error {
 				"transactions [count %v]", txCount)
 			return messageError("MsgHeaders.BtcDecode", str)
 		}
-		msg.AddBlockHeader(bh)
+
+		var parents []*hash.Hash
+		if pver >= protocol.HeaderParentsVersion {
+			parents, err = readHeaderParents(r, pver)
+			if err != nil {
+				return err
+			}
+		}
+		msg.AddBlockHeaderWithParents(bh, parents)
 	}
 	msg.GS = blockdag.NewGraphState()
 	err = msg.GS.Decode(r, pver)
@@ -102,7 +130,7 @@ func (msg *MsgHeaders) Encode(w io.Writer, pver uint32) error {
 		return err
 	}
 
-	for _, bh := range msg.Headers {
+	for i, bh := range msg.Headers {
 		err := bh.Serialize(w)
 		if err != nil {
 			return err
@@ -115,6 +143,17 @@ func (msg *MsgHeaders) Encode(w io.Writer, pver uint32) error {
 		if err != nil {
 			return err
 		}
+
+		if pver >= protocol.HeaderParentsVersion {
+			var parents []*hash.Hash
+			if i < len(msg.Parents) {
+				parents = msg.Parents[i]
+			}
+			err = writeHeaderParents(w, pver, parents)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	err = msg.GS.Encode(w, pver)
@@ -135,8 +174,52 @@ func (msg *MsgHeaders) Command() string {
 func (msg *MsgHeaders) MaxPayloadLength(pver uint32) uint32 {
 	// Num headers (varInt) + max allowed headers (header length + 1 byte
 	// for the number of transactions which is always 0).
-	return MaxVarIntPayload + ((types.MaxBlockHeaderPayload+1)*
-		MaxBlockHeadersPerMsg + msg.GS.MaxPayloadLength())
+	headerPayload := uint32(types.MaxBlockHeaderPayload + 1)
+	if pver >= protocol.HeaderParentsVersion {
+		// Num parents (varInt) + max allowed parents.
+		headerPayload += MaxVarIntPayload +
+			types.MaxParentsPerBlock*hash.HashSize
+	}
+	return MaxVarIntPayload + headerPayload*MaxBlockHeadersPerMsg +
+		msg.GS.MaxPayloadLength()
+}
+
+// readHeaderParents reads the parent hashes which follow a block header.
+func readHeaderParents(r io.Reader, pver uint32) ([]*hash.Hash, error) {
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	if count > types.MaxParentsPerBlock {
+		str := fmt.Sprintf("too many parents for block header "+
+			"[count %v, max %v]", count, types.MaxParentsPerBlock)
+		return nil, messageError("MsgHeaders.BtcDecode", str)
+	}
+	parents := make([]*hash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var parent hash.Hash
+		err := s.ReadElements(r, &parent)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, &parent)
+	}
+	return parents, nil
+}
+
+// writeHeaderParents writes the parent hashes which follow a block header.
+func writeHeaderParents(w io.Writer, pver uint32, parents []*hash.Hash) error {
+	err := s.WriteVarInt(w, pver, uint64(len(parents)))
+	if err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		err := s.WriteElements(w, parent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (msg *MsgHeaders) String() string {
@@ -148,6 +231,7 @@ func (msg *MsgHeaders) String() string {
 func NewMsgHeaders(gs *blockdag.GraphState) *MsgHeaders {
 	return &MsgHeaders{
 		Headers: make([]*types.BlockHeader, 0, MaxBlockHeadersPerMsg),
+		Parents: make([][]*hash.Hash, 0, MaxBlockHeadersPerMsg),
 		GS:      gs,
 	}
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+)
+
+// CmpctBlocksVersion is the version of the compact blocks which is announced
+// by the sendcmpct message.  The short ids are computed from the hashes of the
+// transactions without their witness.
+const CmpctBlocksVersion uint64 = 1
+
+// MsgSendCmpct implements the Message interface and represents a sendcmpct
+// message.  It tells the peer that compact blocks are supported.  When
+// Announce is set the peer is asked to send the new blocks directly as
+// cmpctblock messages, instead of announcing them first, which is the high
+// bandwidth mode.
+type MsgSendCmpct struct {
+	Announce bool
+	Version  uint64
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) Decode(r io.Reader, pver uint32) error {
+	return s.ReadElements(r, &msg.Announce, &msg.Version)
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) Encode(w io.Writer, pver uint32) error {
+	return s.WriteElements(w, msg.Announce, msg.Version)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	// Announce 1 byte + version 8 bytes.
+	return 9
+}
+
+// NewMsgSendCmpct returns a new sendcmpct message that conforms to the
+// Message interface.  See MsgSendCmpct for details.
+func NewMsgSendCmpct(announce bool) *MsgSendCmpct {
+	return &MsgSendCmpct{
+		Announce: announce,
+		Version:  CmpctBlocksVersion,
+	}
+}
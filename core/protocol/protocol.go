@@ -16,7 +16,22 @@ const (
 	InitialProcotolVersion uint32 = 20
 
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 22
+	ProtocolVersion uint32 = 25
+
+	// HeaderParentsVersion is the protocol version which added the parent
+	// hashes of every block header to the headers message, so the DAG can
+	// be rebuilt from headers alone.
+	HeaderParentsVersion uint32 = 23
+
+	// CmpctBlockVersion is the protocol version which added the compact
+	// block relay messages sendcmpct, cmpctblock, getblocktxn and blocktxn.
+	CmpctBlockVersion uint32 = 24
+
+	// AddrV2Version is the protocol version which encodes the addresses of
+	// the addr message with the id of their network, so the addresses
+	// which don't fit in an IPv6 address such as the version 3 tor hidden
+	// services can be relayed.
+	AddrV2Version uint32 = 25
 )
 
 // Network represents which qitmeer network a message belongs to.
@@ -72,4 +87,10 @@ const (
 
 	// a peer supports committed filters (CFs).
 	CF
+
+	// a peer only serves the recent blocks, its old blocks were pruned.
+	Limited
+
+	// a peer supports the encrypted v2 transport.
+	P2PV2
 )
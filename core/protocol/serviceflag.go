@@ -7,9 +7,11 @@ import (
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	Full:  "Full",
-	Bloom: "Bloom",
-	CF:    "CF",
+	Full:    "Full",
+	Bloom:   "Bloom",
+	CF:      "CF",
+	Limited: "Limited",
+	P2PV2:   "P2PV2",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -18,6 +20,8 @@ var orderedSFStrings = []ServiceFlag{
 	Full,
 	Bloom,
 	CF,
+	Limited,
+	P2PV2,
 }
 
 // String returns the ServiceFlag in human-readable form.
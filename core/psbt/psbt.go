@@ -0,0 +1,531 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package psbt implements a partially signed transaction container modeled
+// after BIP174.  The container carries an unsigned transaction along with
+// the data offline signers need to check and sign it: the outputs spent by
+// the inputs, the redeem scripts, the BIP32 derivation paths of the keys and
+// the signatures already collected.
+//
+// The container is serialized as the magic bytes followed by a global map, a
+// map per input and a map per output.  Every map is a list of
+// <keylen><keytype><keydata><valuelen><value> pairs ended by a zero byte.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"io"
+	"sort"
+)
+
+// magic is the prefix of a serialized container, "psbt" followed by 0xff.
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// The key types of the global, input and output maps.
+const (
+	globalUnsignedTxType = 0x00
+
+	inputUtxoType            = 0x01
+	inputPartialSigType      = 0x02
+	inputSighashType         = 0x03
+	inputRedeemScriptType    = 0x04
+	inputBip32DerivationType = 0x06
+	inputFinalScriptSigType  = 0x07
+
+	outputRedeemScriptType    = 0x00
+	outputBip32DerivationType = 0x02
+)
+
+// maxFieldSize is the maximum size of a key or a value, which is large enough
+// for any transaction the mempool accepts.
+const maxFieldSize = 1000000
+
+var (
+	// ErrInvalidMagic is returned when the data is not a serialized
+	// container.
+	ErrInvalidMagic = errors.New("invalid psbt magic")
+
+	// ErrDuplicateKey is returned when a map has the same key twice.
+	ErrDuplicateKey = errors.New("duplicate psbt key")
+
+	// ErrInvalidKey is returned when a key has an unexpected size.
+	ErrInvalidKey = errors.New("invalid psbt key")
+
+	// ErrInvalidValue is returned when a value can't be decoded.
+	ErrInvalidValue = errors.New("invalid psbt value")
+
+	// ErrSignedTx is returned when the transaction of a container already
+	// has signature scripts.
+	ErrSignedTx = errors.New("psbt transaction has signature scripts")
+
+	// ErrInvalidIndex is returned when an input or output index is out of
+	// range.
+	ErrInvalidIndex = errors.New("invalid psbt input or output index")
+)
+
+// PartialSig is a signature of an input by one of the keys its output
+// script requires.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Bip32Derivation is the BIP32 derivation path of a public key from the
+// master key of the passed fingerprint.
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// Unknown is a key value pair of a type this package doesn't know, kept so it
+// isn't lost when the container is passed along.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// Input holds the signing data of an input of the transaction.
+type Input struct {
+	// Utxo is the output spent by the input.
+	Utxo *types.TxOutput
+
+	PartialSigs     []*PartialSig
+	SighashType     txscript.SigHashType
+	RedeemScript    []byte
+	Bip32Derivation []*Bip32Derivation
+
+	// FinalScriptSig is the signature script of the input once finalized.
+	FinalScriptSig []byte
+
+	Unknowns []*Unknown
+}
+
+// Output holds the data of an output of the transaction, which lets signers
+// recognize the change outputs paying back to them.
+type Output struct {
+	RedeemScript    []byte
+	Bip32Derivation []*Bip32Derivation
+	Unknowns        []*Unknown
+}
+
+// Packet is a partially signed transaction.
+type Packet struct {
+	UnsignedTx *types.Transaction
+	Inputs     []*Input
+	Outputs    []*Output
+	Unknowns   []*Unknown
+}
+
+// New returns a container for the passed transaction, which must not have
+// any signature script yet.
+func New(tx *types.Transaction) (*Packet, error) {
+	for _, txIn := range tx.TxIn {
+		if len(txIn.SignScript) != 0 {
+			return nil, ErrSignedTx
+		}
+	}
+	p := &Packet{
+		UnsignedTx: tx,
+		Inputs:     make([]*Input, len(tx.TxIn)),
+		Outputs:    make([]*Output, len(tx.TxOut)),
+	}
+	for i := range p.Inputs {
+		p.Inputs[i] = &Input{}
+	}
+	for i := range p.Outputs {
+		p.Outputs[i] = &Output{}
+	}
+	return p, nil
+}
+
+// Input returns the input of the passed index.
+func (p *Packet) Input(i int) (*Input, error) {
+	if i < 0 || i >= len(p.Inputs) {
+		return nil, ErrInvalidIndex
+	}
+	return p.Inputs[i], nil
+}
+
+// Output returns the output of the passed index.
+func (p *Packet) Output(i int) (*Output, error) {
+	if i < 0 || i >= len(p.Outputs) {
+		return nil, ErrInvalidIndex
+	}
+	return p.Outputs[i], nil
+}
+
+// writeKV writes a key value pair, the key being made of the key type and the
+// key data.
+func writeKV(w io.Writer, keyType byte, keyData []byte, value []byte) error {
+	key := append([]byte{keyType}, keyData...)
+	if err := s.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+	return s.WriteVarBytes(w, 0, value)
+}
+
+// writeUnknowns writes the unknown key value pairs.
+func writeUnknowns(w io.Writer, unknowns []*Unknown) error {
+	for _, u := range unknowns {
+		if err := s.WriteVarBytes(w, 0, u.Key); err != nil {
+			return err
+		}
+		if err := s.WriteVarBytes(w, 0, u.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serializeUtxo(txOut *types.TxOutput) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, txOut.Amount)
+	buf.Write(txOut.Asset[:])
+	s.WriteVarBytes(&buf, 0, txOut.PkScript)
+	return buf.Bytes()
+}
+
+func deserializeUtxo(value []byte) (*types.TxOutput, error) {
+	r := bytes.NewReader(value)
+	txOut := &types.TxOutput{}
+	if err := binary.Read(r, binary.LittleEndian, &txOut.Amount); err != nil {
+		return nil, ErrInvalidValue
+	}
+	if _, err := io.ReadFull(r, txOut.Asset[:]); err != nil {
+		return nil, ErrInvalidValue
+	}
+	pkScript, err := s.ReadVarBytes(r, 0, maxFieldSize, "pkScript")
+	if err != nil || r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+	txOut.PkScript = pkScript
+	return txOut, nil
+}
+
+func serializeBip32Path(d *Bip32Derivation) []byte {
+	value := make([]byte, 4*(len(d.Path)+1))
+	binary.LittleEndian.PutUint32(value, d.Fingerprint)
+	for i, index := range d.Path {
+		binary.LittleEndian.PutUint32(value[4*(i+1):], index)
+	}
+	return value
+}
+
+func deserializeBip32Derivation(pubKey []byte, value []byte) (*Bip32Derivation, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return nil, ErrInvalidValue
+	}
+	d := &Bip32Derivation{
+		PubKey:      pubKey,
+		Fingerprint: binary.LittleEndian.Uint32(value),
+		Path:        make([]uint32, len(value)/4-1),
+	}
+	for i := range d.Path {
+		d.Path[i] = binary.LittleEndian.Uint32(value[4*(i+1):])
+	}
+	return d, nil
+}
+
+// validPubKey returns whether the key data is sized as a compressed or an
+// uncompressed public key.
+func validPubKey(pubKey []byte) bool {
+	return len(pubKey) == 33 || len(pubKey) == 65
+}
+
+func writeBip32Derivations(w io.Writer, keyType byte, derivations []*Bip32Derivation) error {
+	sorted := append([]*Bip32Derivation(nil), derivations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].PubKey, sorted[j].PubKey) < 0
+	})
+	for _, d := range sorted {
+		if err := writeKV(w, keyType, d.PubKey, serializeBip32Path(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Input) serialize(w io.Writer) error {
+	if in.Utxo != nil {
+		err := writeKV(w, inputUtxoType, nil, serializeUtxo(in.Utxo))
+		if err != nil {
+			return err
+		}
+	}
+	sigs := append([]*PartialSig(nil), in.PartialSigs...)
+	sort.Slice(sigs, func(i, j int) bool {
+		return bytes.Compare(sigs[i].PubKey, sigs[j].PubKey) < 0
+	})
+	for _, sig := range sigs {
+		err := writeKV(w, inputPartialSigType, sig.PubKey, sig.Signature)
+		if err != nil {
+			return err
+		}
+	}
+	if in.SighashType != 0 {
+		value := make([]byte, 4)
+		binary.LittleEndian.PutUint32(value, uint32(in.SighashType))
+		if err := writeKV(w, inputSighashType, nil, value); err != nil {
+			return err
+		}
+	}
+	if in.RedeemScript != nil {
+		err := writeKV(w, inputRedeemScriptType, nil, in.RedeemScript)
+		if err != nil {
+			return err
+		}
+	}
+	err := writeBip32Derivations(w, inputBip32DerivationType, in.Bip32Derivation)
+	if err != nil {
+		return err
+	}
+	if in.FinalScriptSig != nil {
+		err := writeKV(w, inputFinalScriptSigType, nil, in.FinalScriptSig)
+		if err != nil {
+			return err
+		}
+	}
+	return writeUnknowns(w, in.Unknowns)
+}
+
+func (out *Output) serialize(w io.Writer) error {
+	if out.RedeemScript != nil {
+		err := writeKV(w, outputRedeemScriptType, nil, out.RedeemScript)
+		if err != nil {
+			return err
+		}
+	}
+	err := writeBip32Derivations(w, outputBip32DerivationType, out.Bip32Derivation)
+	if err != nil {
+		return err
+	}
+	return writeUnknowns(w, out.Unknowns)
+}
+
+// Serialize writes the container to w.
+func (p *Packet) Serialize(w io.Writer) error {
+	if _, err := w.Write(magic); err != nil {
+		return err
+	}
+	serializedTx, err := p.UnsignedTx.Serialize()
+	if err != nil {
+		return err
+	}
+	if err := writeKV(w, globalUnsignedTxType, nil, serializedTx); err != nil {
+		return err
+	}
+	if err := writeUnknowns(w, p.Unknowns); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	for _, in := range p.Inputs {
+		if err := in.serialize(w); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	for _, out := range p.Outputs {
+		if err := out.serialize(w); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// B64Encode returns the base64 encoding of the serialized container, which is
+// the form the container is passed around in.
+func (p *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// readMap reads the key value pairs of a map up to its separator, calling
+// the passed function for every pair.  Duplicate keys are rejected.
+func readMap(r io.Reader, f func(key []byte, value []byte) error) error {
+	seen := make(map[string]struct{})
+	for {
+		key, err := s.ReadVarBytes(r, 0, maxFieldSize, "psbt key")
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return nil
+		}
+		value, err := s.ReadVarBytes(r, 0, maxFieldSize, "psbt value")
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[string(key)]; ok {
+			return ErrDuplicateKey
+		}
+		seen[string(key)] = struct{}{}
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+func (in *Input) deserialize(r io.Reader) error {
+	return readMap(r, func(key []byte, value []byte) error {
+		switch key[0] {
+		case inputUtxoType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			utxo, err := deserializeUtxo(value)
+			if err != nil {
+				return err
+			}
+			in.Utxo = utxo
+
+		case inputPartialSigType:
+			if !validPubKey(key[1:]) {
+				return ErrInvalidKey
+			}
+			in.PartialSigs = append(in.PartialSigs, &PartialSig{
+				PubKey:    key[1:],
+				Signature: value,
+			})
+
+		case inputSighashType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			if len(value) != 4 {
+				return ErrInvalidValue
+			}
+			in.SighashType = txscript.SigHashType(binary.LittleEndian.Uint32(value))
+
+		case inputRedeemScriptType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			in.RedeemScript = value
+
+		case inputBip32DerivationType:
+			if !validPubKey(key[1:]) {
+				return ErrInvalidKey
+			}
+			d, err := deserializeBip32Derivation(key[1:], value)
+			if err != nil {
+				return err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, d)
+
+		case inputFinalScriptSigType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			in.FinalScriptSig = value
+
+		default:
+			in.Unknowns = append(in.Unknowns, &Unknown{Key: key, Value: value})
+		}
+		return nil
+	})
+}
+
+func (out *Output) deserialize(r io.Reader) error {
+	return readMap(r, func(key []byte, value []byte) error {
+		switch key[0] {
+		case outputRedeemScriptType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			out.RedeemScript = value
+
+		case outputBip32DerivationType:
+			if !validPubKey(key[1:]) {
+				return ErrInvalidKey
+			}
+			d, err := deserializeBip32Derivation(key[1:], value)
+			if err != nil {
+				return err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, d)
+
+		default:
+			out.Unknowns = append(out.Unknowns, &Unknown{Key: key, Value: value})
+		}
+		return nil
+	})
+}
+
+// Parse reads a serialized container from r.
+func Parse(r io.Reader) (*Packet, error) {
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, prefix); err != nil || !bytes.Equal(prefix, magic) {
+		return nil, ErrInvalidMagic
+	}
+
+	var tx *types.Transaction
+	var unknowns []*Unknown
+	err := readMap(r, func(key []byte, value []byte) error {
+		switch key[0] {
+		case globalUnsignedTxType:
+			if len(key) != 1 {
+				return ErrInvalidKey
+			}
+			tx = &types.Transaction{}
+			if err := tx.Deserialize(bytes.NewReader(value)); err != nil {
+				return fmt.Errorf("invalid psbt transaction: %v", err)
+			}
+
+		default:
+			unknowns = append(unknowns, &Unknown{Key: key, Value: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, errors.New("missing psbt transaction")
+	}
+
+	p, err := New(tx)
+	if err != nil {
+		return nil, err
+	}
+	p.Unknowns = unknowns
+	for _, in := range p.Inputs {
+		if err := in.deserialize(r); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range p.Outputs {
+		if err := out.deserialize(r); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// B64Decode parses the base64 encoding of a serialized container.
+func B64Decode(str string) (*Packet, error) {
+	serialized, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(serialized))
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func TestPsbt(t *testing.T) {
+	chainParams := &params.PrivNetParams
+
+	var keys []ecc.PrivateKey
+	var pubKeys []*address.SecpPubKeyAddress
+	for i := byte(1); i <= 3; i++ {
+		key, pubKey := ecc.Secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{i}, 32))
+		addr, err := address.NewSecpPubKeyAddress(pubKey.SerializeCompressed(),
+			chainParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		pubKeys = append(pubKeys, addr)
+	}
+
+	// The first input pays to the first key, the second one to a 2-of-3
+	// multisig script.
+	pkhAddr, err := address.NewPubKeyHashAddress(pubKeys[0].Hash160()[:],
+		chainParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhScript, err := txscript.PayToAddrScript(pkhAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shAddr, err := address.NewAddressScriptHashFromHash(
+		hash.Hash160(redeemScript), chainParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shScript, err := txscript.PayToAddrScript(p2shAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{2}, 1), nil))
+	tx.AddTxOut(types.NewTxOutput(2900, pkhScript))
+	p, err := New(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Fee(); err != ErrMissingUtxo {
+		t.Fatalf("fee without the utxos: %v", err)
+	}
+	if err := p.Sign(0, keys[0], chainParams); err != ErrMissingUtxo {
+		t.Fatalf("sign without the utxo: %v", err)
+	}
+	p.Inputs[0].Utxo = types.NewTxOutput(1000, pkhScript)
+	p.Inputs[1].Utxo = types.NewTxOutput(2000, p2shScript)
+	p.Inputs[1].Bip32Derivation = []*Bip32Derivation{
+		{PubKey: pubKeys[1].ScriptAddress(), Fingerprint: 7, Path: []uint32{0x8000002c, 1}},
+	}
+	if fee, err := p.Fee(); err != nil || fee != 100 {
+		t.Fatalf("fee %d %v", fee, err)
+	}
+	if err := p.Sign(1, keys[1], chainParams); err != ErrMissingRedeemScript {
+		t.Fatalf("sign without the redeem script: %v", err)
+	}
+	p.Inputs[1].RedeemScript = redeemScript
+
+	// Every signer works on its own copy of the serialized container.
+	encoded, err := p.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key ecc.PrivateKey, inputs ...int) *Packet {
+		signed, err := B64Decode(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range inputs {
+			if err := signed.Sign(i, key, chainParams); err != nil {
+				t.Fatalf("sign input %d: %v", i, err)
+			}
+		}
+		return signed
+	}
+	first := sign(keys[0], 0, 1)
+	third := sign(keys[2], 1)
+	if err := third.Sign(0, keys[2], chainParams); err != ErrNotSigner {
+		t.Fatalf("sign with a foreign key: %v", err)
+	}
+	if missing, err := first.MissingSigs(1, chainParams); err != nil || missing != 1 {
+		t.Fatalf("missing signatures %d %v", missing, err)
+	}
+	if err := first.Finalize(1, chainParams); err != ErrIncomplete {
+		t.Fatalf("finalize an incomplete input: %v", err)
+	}
+
+	combined, err := Combine(first, third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err = combined.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined, err = B64Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(combined.Inputs[1].PartialSigs) != 2 ||
+		len(combined.Inputs[1].Bip32Derivation) != 1 ||
+		combined.Inputs[1].Bip32Derivation[0].Path[0] != 0x8000002c {
+		t.Fatalf("combined input %+v", combined.Inputs[1])
+	}
+	if _, err := combined.Extract(); err != ErrIncomplete {
+		t.Fatalf("extract before finalizing: %v", err)
+	}
+	for i := range combined.Inputs {
+		if err := combined.Finalize(i, chainParams); err != nil {
+			t.Fatalf("finalize input %d: %v", i, err)
+		}
+	}
+	if !combined.IsComplete() {
+		t.Fatalf("finalized container is not complete")
+	}
+	signedTx, err := combined.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pkScript := range [][]byte{pkhScript, p2shScript} {
+		vm, err := txscript.NewEngine(pkScript, signedTx, i, verifyFlags,
+			txscript.DefaultScriptVersion, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+
+	other := types.NewTransaction()
+	other.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{3}, 0), nil))
+	otherPacket, err := New(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine(first, otherPacket); err != ErrDifferentTx {
+		t.Fatalf("combine different transactions: %v", err)
+	}
+	if _, err := New(signedTx); err != ErrSignedTx {
+		t.Fatalf("container of a signed transaction: %v", err)
+	}
+	if _, err := B64Decode("cHNidA=="); err != ErrInvalidMagic {
+		t.Fatalf("invalid magic: %v", err)
+	}
+}
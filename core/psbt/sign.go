@@ -0,0 +1,434 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+// verifyFlags are the script flags the finalized inputs are checked with.
+const verifyFlags = txscript.ScriptBip16 |
+	txscript.ScriptVerifyDERSignatures |
+	txscript.ScriptVerifyStrictEncoding |
+	txscript.ScriptVerifyMinimalData |
+	txscript.ScriptVerifyCleanStack |
+	txscript.ScriptVerifyLowS
+
+var (
+	// ErrMissingUtxo is returned when an operation requires the output
+	// spent by an input, which wasn't added to the container.
+	ErrMissingUtxo = errors.New("missing psbt input utxo")
+
+	// ErrMissingRedeemScript is returned when a pay-to-script-hash input
+	// has no redeem script.
+	ErrMissingRedeemScript = errors.New("missing psbt input redeem script")
+
+	// ErrFinalized is returned when signing an input already finalized.
+	ErrFinalized = errors.New("psbt input already finalized")
+
+	// ErrNotSigner is returned when the key doesn't sign for the input.
+	ErrNotSigner = errors.New("the key can't sign the psbt input")
+
+	// ErrIncomplete is returned when the signatures of an input don't
+	// satisfy its script yet.
+	ErrIncomplete = errors.New("psbt input is missing signatures")
+
+	// ErrDifferentTx is returned when combining the containers of
+	// different transactions.
+	ErrDifferentTx = errors.New("can't combine the psbt of different " +
+		"transactions")
+)
+
+// scriptHash returns the script hash of a pay-to-script-hash output script,
+// nil for any other script.
+func scriptHash(pkScript []byte, chainParams *params.Params) []byte {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, chainParams)
+	if err != nil || class != txscript.ScriptHashTy || len(addrs) != 1 {
+		return nil
+	}
+	return addrs[0].ScriptAddress()
+}
+
+// signScript returns the script signed by the input, the redeem script of a
+// pay-to-script-hash output and the output script otherwise.
+func (in *Input) signScript(chainParams *params.Params) ([]byte, error) {
+	if in.Utxo == nil {
+		return nil, ErrMissingUtxo
+	}
+	h := scriptHash(in.Utxo.PkScript, chainParams)
+	if h == nil {
+		return in.Utxo.PkScript, nil
+	}
+	if in.RedeemScript == nil {
+		return nil, ErrMissingRedeemScript
+	}
+	if !bytes.Equal(h, hash.Hash160(in.RedeemScript)) {
+		return nil, errors.New("psbt input redeem script doesn't " +
+			"match its utxo")
+	}
+	return in.RedeemScript, nil
+}
+
+// partialSig returns the signature of the passed public key, nil if missing.
+func (in *Input) partialSig(pubKey []byte) []byte {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(sig.PubKey, pubKey) {
+			return sig.Signature
+		}
+	}
+	return nil
+}
+
+// addPartialSig adds or replaces the signature of the passed public key.
+func (in *Input) addPartialSig(pubKey []byte, signature []byte) {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(sig.PubKey, pubKey) {
+			sig.Signature = signature
+			return
+		}
+	}
+	in.PartialSigs = append(in.PartialSigs, &PartialSig{
+		PubKey:    pubKey,
+		Signature: signature,
+	})
+}
+
+// Sign adds the signature of the passed key to the input of the passed index.
+// The output spent by the input and, for a pay-to-script-hash output, the
+// redeem script must have been added.
+func (p *Packet) Sign(i int, privKey ecc.PrivateKey, chainParams *params.Params) error {
+	in, err := p.Input(i)
+	if err != nil {
+		return err
+	}
+	if in.FinalScriptSig != nil {
+		return ErrFinalized
+	}
+	if _, err := in.signScript(chainParams); err != nil {
+		return err
+	}
+
+	pubKey := ecc.Secp256k1.NewPublicKey(privKey.Public()).SerializeCompressed()
+	pkhAddr, err := address.NewPubKeyHashAddress(hash.Hash160(pubKey),
+		chainParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		return err
+	}
+	var kdb txscript.KeyClosure = func(addr types.Address) (ecc.PrivateKey, bool, error) {
+		if !bytes.Equal(addr.ScriptAddress(), pubKey) &&
+			!bytes.Equal(addr.ScriptAddress(), pkhAddr.ScriptAddress()) {
+			return nil, false, ErrNotSigner
+		}
+		return privKey, true, nil // compressed is true
+	}
+	var sdb txscript.ScriptClosure = func(types.Address) ([]byte, error) {
+		return in.RedeemScript, nil
+	}
+	hashType := in.SighashType
+	if hashType == 0 {
+		hashType = txscript.SigHashAll
+	}
+	sigScript, err := txscript.SignTxOutput(chainParams, p.UnsignedTx, i,
+		in.Utxo.PkScript, hashType, kdb, sdb, nil, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		return err
+	}
+
+	// Whatever the script, the signature is the first push, followed by
+	// the public key or the redeem script.
+	pushes, err := txscript.PushedData(sigScript)
+	if err != nil {
+		return err
+	}
+	if scriptHash(in.Utxo.PkScript, chainParams) != nil && len(pushes) > 0 {
+		pushes = pushes[:len(pushes)-1]
+	}
+	if len(pushes) == 0 || len(pushes[0]) == 0 {
+		return ErrNotSigner
+	}
+	in.addPartialSig(pubKey, pushes[0])
+	return nil
+}
+
+// Combine merges the data of several containers of the same transaction into
+// the first one, which is returned.
+func Combine(packets ...*Packet) (*Packet, error) {
+	if len(packets) == 0 {
+		return nil, errors.New("no psbt to combine")
+	}
+	combined := packets[0]
+	for _, p := range packets[1:] {
+		if p.UnsignedTx.TxHash() != combined.UnsignedTx.TxHash() {
+			return nil, ErrDifferentTx
+		}
+		for i, in := range p.Inputs {
+			combined.Inputs[i].merge(in)
+		}
+		for i, out := range p.Outputs {
+			combined.Outputs[i].merge(out)
+		}
+		combined.Unknowns = mergeUnknowns(combined.Unknowns, p.Unknowns)
+	}
+	return combined, nil
+}
+
+func mergeBip32Derivations(derivations []*Bip32Derivation,
+	other []*Bip32Derivation) []*Bip32Derivation {
+
+next:
+	for _, d := range other {
+		for _, known := range derivations {
+			if bytes.Equal(known.PubKey, d.PubKey) {
+				continue next
+			}
+		}
+		derivations = append(derivations, d)
+	}
+	return derivations
+}
+
+func mergeUnknowns(unknowns []*Unknown, other []*Unknown) []*Unknown {
+next:
+	for _, u := range other {
+		for _, known := range unknowns {
+			if bytes.Equal(known.Key, u.Key) {
+				continue next
+			}
+		}
+		unknowns = append(unknowns, u)
+	}
+	return unknowns
+}
+
+func (in *Input) merge(other *Input) {
+	if in.Utxo == nil {
+		in.Utxo = other.Utxo
+	}
+	if in.FinalScriptSig == nil {
+		in.FinalScriptSig = other.FinalScriptSig
+	}
+	if in.FinalScriptSig != nil {
+		// A finalized input only keeps its utxo.
+		in.PartialSigs = nil
+		in.SighashType = 0
+		in.RedeemScript = nil
+		in.Bip32Derivation = nil
+		return
+	}
+	for _, sig := range other.PartialSigs {
+		if in.partialSig(sig.PubKey) == nil {
+			in.addPartialSig(sig.PubKey, sig.Signature)
+		}
+	}
+	if in.SighashType == 0 {
+		in.SighashType = other.SighashType
+	}
+	if in.RedeemScript == nil {
+		in.RedeemScript = other.RedeemScript
+	}
+	in.Bip32Derivation = mergeBip32Derivations(in.Bip32Derivation,
+		other.Bip32Derivation)
+	in.Unknowns = mergeUnknowns(in.Unknowns, other.Unknowns)
+}
+
+func (out *Output) merge(other *Output) {
+	if out.RedeemScript == nil {
+		out.RedeemScript = other.RedeemScript
+	}
+	out.Bip32Derivation = mergeBip32Derivations(out.Bip32Derivation,
+		other.Bip32Derivation)
+	out.Unknowns = mergeUnknowns(out.Unknowns, other.Unknowns)
+}
+
+// MissingSigs returns the number of signatures the input of the passed index
+// still needs to be finalized.
+func (p *Packet) MissingSigs(i int, chainParams *params.Params) (int, error) {
+	in, err := p.Input(i)
+	if err != nil {
+		return 0, err
+	}
+	if in.FinalScriptSig != nil {
+		return 0, nil
+	}
+	script, err := in.signScript(chainParams)
+	if err != nil {
+		return 0, err
+	}
+	_, addrs, nRequired, err := txscript.ExtractPkScriptAddrs(script, chainParams)
+	if err != nil {
+		return 0, err
+	}
+	for _, addr := range addrs {
+		if nRequired > 0 && in.findSig(addr) != nil {
+			nRequired--
+		}
+	}
+	return nRequired, nil
+}
+
+// findSig returns the public key and the signature of the key of the passed
+// address, nil if missing.
+func (in *Input) findSig(addr types.Address) *PartialSig {
+	for _, sig := range in.PartialSigs {
+		switch addr.(type) {
+		case *address.PubKeyHashAddress:
+			if bytes.Equal(addr.ScriptAddress(), hash.Hash160(sig.PubKey)) {
+				return sig
+			}
+		default:
+			if bytes.Equal(addr.ScriptAddress(), sig.PubKey) {
+				return sig
+			}
+		}
+	}
+	return nil
+}
+
+// Finalize builds the signature script of the input of the passed index from
+// its partial signatures and checks it spends the output.  Pay-to-pubkey,
+// pay-to-pubkey-hash and pay-to-script-hash multisig outputs are supported.
+func (p *Packet) Finalize(i int, chainParams *params.Params) error {
+	in, err := p.Input(i)
+	if err != nil {
+		return err
+	}
+	if in.FinalScriptSig != nil {
+		return nil
+	}
+	script, err := in.signScript(chainParams)
+	if err != nil {
+		return err
+	}
+	class, addrs, nRequired, err := txscript.ExtractPkScriptAddrs(script, chainParams)
+	if err != nil {
+		return err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	switch class {
+	case txscript.PubKeyTy:
+		sig := in.findSig(addrs[0])
+		if sig == nil {
+			return ErrIncomplete
+		}
+		builder.AddData(sig.Signature)
+
+	case txscript.PubKeyHashTy:
+		sig := in.findSig(addrs[0])
+		if sig == nil {
+			return ErrIncomplete
+		}
+		builder.AddData(sig.Signature).AddData(sig.PubKey)
+
+	case txscript.MultiSigTy:
+		// The signatures are in the order of the keys of the script.
+		signed := 0
+		for _, addr := range addrs {
+			if signed == nRequired {
+				break
+			}
+			if sig := in.findSig(addr); sig != nil {
+				builder.AddData(sig.Signature)
+				signed++
+			}
+		}
+		if signed < nRequired {
+			return ErrIncomplete
+		}
+
+	default:
+		return fmt.Errorf("can't finalize psbt input spending a %v "+
+			"script", class)
+	}
+	if in.RedeemScript != nil {
+		builder.AddData(in.RedeemScript)
+	}
+	sigScript, err := builder.Script()
+	if err != nil {
+		return err
+	}
+
+	// Check the script on a copy of the transaction, the signatures don't
+	// depend on the signature scripts of the other inputs.
+	tx := *p.UnsignedTx
+	tx.TxIn = make([]*types.TxInput, len(p.UnsignedTx.TxIn))
+	for j, txIn := range p.UnsignedTx.TxIn {
+		txInCopy := *txIn
+		tx.TxIn[j] = &txInCopy
+	}
+	tx.TxIn[i].SignScript = sigScript
+	vm, err := txscript.NewEngine(in.Utxo.PkScript, &tx, i, verifyFlags,
+		txscript.DefaultScriptVersion, nil)
+	if err != nil {
+		return err
+	}
+	if err := vm.Execute(); err != nil {
+		return fmt.Errorf("invalid psbt input signatures: %v", err)
+	}
+
+	in.FinalScriptSig = sigScript
+	in.PartialSigs = nil
+	in.SighashType = 0
+	in.RedeemScript = nil
+	in.Bip32Derivation = nil
+	return nil
+}
+
+// IsComplete returns whether every input is finalized.
+func (p *Packet) IsComplete() bool {
+	for _, in := range p.Inputs {
+		if in.FinalScriptSig == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the signed transaction of a complete container.
+func (p *Packet) Extract() (*types.Transaction, error) {
+	if !p.IsComplete() {
+		return nil, ErrIncomplete
+	}
+	serializedTx, err := p.UnsignedTx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	var tx types.Transaction
+	if err := tx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, err
+	}
+	for i, in := range p.Inputs {
+		tx.TxIn[i].SignScript = in.FinalScriptSig
+	}
+	return &tx, nil
+}
+
+// Fee returns the MEER fee the transaction pays, which can only be computed
+// once the outputs spent by every input were added.
+func (p *Packet) Fee() (int64, error) {
+	var fee int64
+	for _, in := range p.Inputs {
+		if in.Utxo == nil {
+			return 0, ErrMissingUtxo
+		}
+		if in.Utxo.Asset == types.MeerAssetId {
+			fee += int64(in.Utxo.Amount)
+		}
+	}
+	for _, txOut := range p.UnsignedTx.TxOut {
+		if txOut.Asset == types.MeerAssetId {
+			fee -= int64(txOut.Amount)
+		}
+	}
+	return fee, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package types
+
+import (
+	"encoding/binary"
+	"github.com/Qitmeer/qitmeer/common/hash"
+)
+
+// AssetIdSize is the number of bytes used to serialize an asset identifier
+// behind the amount of every output of an asset transaction.
+const AssetIdSize = hash.HashSize
+
+// AssetId identifies a native asset.  It is derived from the first outpoint
+// spent by the AssetIssue transaction that created the asset, so it is known
+// before the issuing transaction is signed and can never be issued twice.
+//
+// The zero value denotes the native MEER coin.
+type AssetId hash.Hash
+
+// MeerAssetId is the asset identifier of the native coin.
+var MeerAssetId = AssetId{}
+
+// NewAssetId returns the identifier of the asset issued by a transaction whose
+// first input spends the passed outpoint.
+func NewAssetId(op *TxOutPoint) AssetId {
+	var buf [hash.HashSize + 4]byte
+	copy(buf[:], op.Hash[:])
+	binary.LittleEndian.PutUint32(buf[hash.HashSize:], op.OutIndex)
+	return AssetId(hash.DoubleHashH(buf[:]))
+}
+
+// NewAssetIdFromStr creates an asset identifier from a hash string in the same
+// byte-reversed hex format used for transaction hashes.
+func NewAssetIdFromStr(str string) (*AssetId, error) {
+	h, err := hash.NewHashFromStr(str)
+	if err != nil {
+		return nil, err
+	}
+	id := AssetId(*h)
+	return &id, nil
+}
+
+// String returns the asset identifier as the hexadecimal string of the
+// byte-reversed hash.
+func (a AssetId) String() string {
+	return hash.Hash(a).String()
+}
+
+// IsMeer returns whether or not the identifier denotes the native coin.
+func (a AssetId) IsMeer() bool {
+	return a == MeerAssetId
+}
+
+// IsAssetTxType returns whether or not the passed transaction type carries
+// asset-tagged outputs.
+func IsAssetTxType(txType TxType) bool {
+	switch txType {
+	case AssetIssue, AssetRevoke, AssetTransfer:
+		return true
+	}
+	return false
+}
+
+// IsAssetTx returns whether or not the transaction is one of the asset
+// transaction types, which serialize an asset identifier for every output.
+func (tx *Transaction) IsAssetTx() bool {
+	return IsAssetTxType(DetermineTxType(tx))
+}
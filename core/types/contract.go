@@ -0,0 +1,130 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+)
+
+// ContractId identifies a contract.  It is derived from the first outpoint
+// spent by the ContractCreate transaction that created the contract, so it is
+// known before the creating transaction is signed.
+type ContractId hash.Hash
+
+// contractIdTag separates the contract identifiers from the asset
+// identifiers derived from the same outpoint.
+var contractIdTag = []byte("contract")
+
+// NewContractId returns the identifier of the contract created by a
+// transaction whose first input spends the passed outpoint.
+func NewContractId(op *TxOutPoint) ContractId {
+	buf := make([]byte, len(contractIdTag)+hash.HashSize+4)
+	offset := copy(buf, contractIdTag)
+	offset += copy(buf[offset:], op.Hash[:])
+	binary.LittleEndian.PutUint32(buf[offset:], op.OutIndex)
+	return ContractId(hash.DoubleHashH(buf))
+}
+
+// NewContractIdFromStr creates a contract identifier from a hash string in
+// the same byte-reversed hex format used for transaction hashes.
+func NewContractIdFromStr(str string) (*ContractId, error) {
+	h, err := hash.NewHashFromStr(str)
+	if err != nil {
+		return nil, err
+	}
+	addr := ContractId(*h)
+	return &addr, nil
+}
+
+// String returns the contract identifier as the hexadecimal string of the
+// byte-reversed hash.
+func (a ContractId) String() string {
+	return hash.Hash(a).String()
+}
+
+// IsContractTxType returns whether or not the passed transaction type carries
+// a contract payload.
+func IsContractTxType(txType TxType) bool {
+	switch txType {
+	case ContractCreate, ContractDestroy, ContractUpdate:
+		return true
+	}
+	return false
+}
+
+// IsContractTx returns whether or not the transaction is one of the contract
+// transaction types.
+func (tx *Transaction) IsContractTx() bool {
+	return IsContractTxType(DetermineTxType(tx))
+}
+
+// ContractPayload is the payload of a contract transaction.  It is carried by
+// the first output of the transaction, see the blockchain package.
+//
+// The serialized payload is the gas limit as a little-endian uint64, followed
+// by the identifier of the contract for ContractUpdate and ContractDestroy, and
+// the data: the code of the contract for ContractCreate, the input of the call
+// for ContractUpdate and nothing for ContractDestroy.
+type ContractPayload struct {
+	// GasLimit is the maximum amount of gas the execution may use.  The
+	// fee of the transaction must pay for all of it.
+	GasLimit uint64
+
+	// Contract is the identifier of the called or destroyed contract.
+	Contract ContractId
+
+	// Data is the code of a created contract or the input of a call.
+	Data []byte
+}
+
+// Bytes returns the serialized payload for the passed transaction type.
+func (p *ContractPayload) Bytes(txType TxType) []byte {
+	size := 8 + len(p.Data)
+	if txType != ContractCreate {
+		size += hash.HashSize
+	}
+	serialized := make([]byte, size)
+	binary.LittleEndian.PutUint64(serialized, p.GasLimit)
+	offset := 8
+	if txType != ContractCreate {
+		offset += copy(serialized[offset:], p.Contract[:])
+	}
+	copy(serialized[offset:], p.Data)
+	return serialized
+}
+
+// ParseContractPayload decodes the serialized payload of a contract transaction
+// of the passed type.
+func ParseContractPayload(txType TxType, serialized []byte) (*ContractPayload, error) {
+	if !IsContractTxType(txType) {
+		return nil, fmt.Errorf("%v transaction has no contract payload",
+			txType)
+	}
+	minSize := 8
+	if txType != ContractCreate {
+		minSize += hash.HashSize
+	}
+	if len(serialized) < minSize {
+		return nil, fmt.Errorf("contract payload of %d bytes is shorter "+
+			"than %d bytes", len(serialized), minSize)
+	}
+	p := &ContractPayload{
+		GasLimit: binary.LittleEndian.Uint64(serialized),
+	}
+	offset := 8
+	if txType != ContractCreate {
+		copy(p.Contract[:], serialized[offset:offset+hash.HashSize])
+		offset += hash.HashSize
+	}
+	p.Data = serialized[offset:]
+	if txType == ContractDestroy && len(p.Data) > 0 {
+		return nil, fmt.Errorf("contract destroy payload carries %d "+
+			"bytes of data", len(p.Data))
+	}
+	if txType == ContractCreate && len(p.Data) == 0 {
+		return nil, fmt.Errorf("contract create payload carries no code")
+	}
+	return p, nil
+}
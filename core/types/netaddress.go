@@ -7,8 +7,10 @@
 package types
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/Qitmeer/qitmeer/common/network"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	s "github.com/Qitmeer/qitmeer/core/serialization"
@@ -22,11 +24,37 @@ import (
 // a TCP address as required.
 var ErrInvalidNetAddr = errors.New("provided net.Addr is not a net.TCPAddr")
 
+// The ids of the networks of the addresses in the addr message since protocol
+// version AddrV2Version, they are the same as the ones of BIP155.
+const (
+	netIDIPv4  uint8 = 1
+	netIDIPv6  uint8 = 2
+	netIDTorV2 uint8 = 3
+	netIDTorV3 uint8 = 4
+)
+
+// netIDAddrLen are the lengths of the addresses of the known networks.
+var netIDAddrLen = map[uint8]int{
+	netIDIPv4:  4,
+	netIDIPv6:  16,
+	netIDTorV2: 10,
+	netIDTorV3: 32,
+}
+
+// maxNetIDAddrLen is the maximum length of an address of any network, so the
+// addresses of the networks which are not known yet can be skipped.
+const maxNetIDAddrLen = 512
+
 // MaxNetAddressPayload returns the max payload size for the NetAddress
 // based on the protocol version.
 func MaxNetAddressPayload(pver uint32) uint32 {
 	// Services 8 bytes + ip 16 bytes + port 2 bytes.
 	plen := uint32(26)
+	if pver >= protocol.AddrV2Version {
+		// Services 8 bytes + network id 1 byte + address length 3
+		// bytes + address + port 2 bytes.
+		plen = 14 + maxNetIDAddrLen
+	}
 
 	// Timestamp 4 bytes.
 	plen += 4
@@ -52,6 +80,11 @@ type NetAddress struct {
 	// Port the peer is using.  This is encoded in big endian on the wire
 	// which differs from most everything else.
 	Port uint16
+
+	// Host is the host name of a peer without IP, such as a version 3 tor
+	// hidden service or a name resolved by a proxy.  Only the version 3
+	// hidden services can be encoded on the wire, see WriteNetAddressV2.
+	Host string
 }
 
 // HasService returns whether the specified service is supported by the address.
@@ -207,3 +240,103 @@ func WriteNetAddress(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
 	// Sigh.  protocol mixes little and big endian.
 	return binary.Write(w, binary.BigEndian, na.Port)
 }
+
+// ReadNetAddressV2 reads an encoded NetAddress from r in the format of the addr
+// message since protocol version AddrV2Version, the IP is replaced by the id of
+// a network and the address in that network.  The addresses of the networks
+// which are not known have neither IP nor host.
+func ReadNetAddressV2(r io.Reader, pver uint32, na *NetAddress, ts bool) error {
+	if ts {
+		err := s.ReadElements(r, (*s.Uint32Time)(&na.Timestamp))
+		if err != nil {
+			return err
+		}
+	}
+
+	var netID uint8
+	err := s.ReadElements(r, &na.Services, &netID)
+	if err != nil {
+		return err
+	}
+	addr, err := s.ReadVarBytes(r, pver, maxNetIDAddrLen, "address")
+	if err != nil {
+		return err
+	}
+	port, err := s.BinarySerializer.Uint16(r, binary.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	*na = NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      port,
+	}
+	addrLen, ok := netIDAddrLen[netID]
+	if !ok {
+		return nil
+	}
+	if len(addr) != addrLen {
+		return fmt.Errorf("address of network %d has %d bytes, want %d",
+			netID, len(addr), addrLen)
+	}
+	switch netID {
+	case netIDIPv4, netIDIPv6:
+		na.IP = net.IP(addr).To16()
+	case netIDTorV2:
+		na.IP = net.IP(append(append([]byte{}, network.OnionCatPrefix...), addr...))
+	case netIDTorV3:
+		na.Host = network.OnionV3Host(addr)
+	}
+	return nil
+}
+
+// WriteNetAddressV2 serializes a NetAddress to w in the format of the addr
+// message since protocol version AddrV2Version.  The only host names which can
+// be serialized are the ones of the version 3 tor hidden services.
+func WriteNetAddressV2(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
+	netID, addr, err := netIDAddr(na)
+	if err != nil {
+		return err
+	}
+	if ts {
+		err := s.WriteElements(w, uint32(na.Timestamp.Unix()))
+		if err != nil {
+			return err
+		}
+	}
+	err = s.WriteElements(w, na.Services, netID)
+	if err != nil {
+		return err
+	}
+	err = s.WriteVarBytes(w, pver, addr)
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, na.Port)
+}
+
+// netIDAddr returns the id of the network of the NetAddress and its address in
+// that network.
+func netIDAddr(na *NetAddress) (uint8, []byte, error) {
+	if na.Host != "" {
+		version, data, err := network.ParseOnionHost(na.Host)
+		if err != nil {
+			return 0, nil, err
+		}
+		if version != 3 {
+			return 0, nil, fmt.Errorf("host %s has no network id", na.Host)
+		}
+		return netIDTorV3, data, nil
+	}
+	if ip := na.IP.To4(); ip != nil {
+		return netIDIPv4, ip, nil
+	}
+	// Ensure to always write 16 bytes even if the ip is nil.
+	ip := make([]byte, 16)
+	copy(ip, na.IP.To16())
+	if bytes.HasPrefix(ip, network.OnionCatPrefix) {
+		return netIDTorV2, ip[len(network.OnionCatPrefix):], nil
+	}
+	return netIDIPv6, ip, nil
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/network"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_NetAddressV2(t *testing.T) {
+	v2IP := net.IP(append(append([]byte{}, network.OnionCatPrefix...),
+		bytes.Repeat([]byte{0x11}, 10)...))
+	v3Host := network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32))
+	tests := []struct {
+		na    NetAddress
+		netID uint8
+		len   int
+	}{
+		{NetAddress{IP: net.ParseIP("8.8.8.8"), Port: 8130}, netIDIPv4, 4},
+		{NetAddress{IP: net.ParseIP("2001:4860::8888"), Port: 8130}, netIDIPv6, 16},
+		{NetAddress{IP: v2IP, Port: 8130}, netIDTorV2, 10},
+		{NetAddress{Host: v3Host, Port: 8130}, netIDTorV3, 32},
+	}
+	pver := protocol.AddrV2Version
+	for _, test := range tests {
+		test.na.Timestamp = time.Unix(0x5f000000, 0)
+		test.na.Services = protocol.Full
+		var buf bytes.Buffer
+		if err := WriteNetAddressV2(&buf, pver, &test.na, true); err != nil {
+			t.Fatalf("%v: %v", test.na, err)
+		}
+		// Timestamp, services, then the network id and the length of
+		// the address.
+		data := buf.Bytes()
+		if data[12] != test.netID || int(data[13]) != test.len {
+			t.Errorf("%v: network %d of %d bytes, want %d of %d bytes",
+				test.na, data[12], data[13], test.netID, test.len)
+		}
+
+		var na NetAddress
+		if err := ReadNetAddressV2(&buf, pver, &na, true); err != nil {
+			t.Fatalf("%v: %v", test.na, err)
+		}
+		if !na.IP.Equal(test.na.IP) || na.Host != test.na.Host ||
+			na.Port != test.na.Port || na.Services != test.na.Services ||
+			!na.Timestamp.Equal(test.na.Timestamp) {
+			t.Errorf("read %v, want %v", na, test.na)
+		}
+	}
+
+	// Only the host names of the version 3 hidden services are encoded.
+	na := NetAddress{Host: "seed.example.com", Port: 8130}
+	if err := WriteNetAddressV2(&bytes.Buffer{}, pver, &na, false); err == nil {
+		t.Error("host name encoded")
+	}
+
+	// The addresses of unknown networks are skipped, the ones of a known
+	// network must have its length.
+	unknown := []byte{1, 0, 0, 0, 0, 0, 0, 0, 99, 3, 1, 2, 3, 0x1f, 0xc2}
+	if err := ReadNetAddressV2(bytes.NewReader(unknown), pver, &na, false); err != nil {
+		t.Fatal(err)
+	}
+	if na.IP != nil || na.Host != "" || na.Port != 8130 {
+		t.Errorf("address of unknown network read as %v", na)
+	}
+	badLen := []byte{1, 0, 0, 0, 0, 0, 0, 0, netIDIPv4, 3, 1, 2, 3, 0x1f, 0xc2}
+	if err := ReadNetAddressV2(bytes.NewReader(badLen), pver, &na, false); err == nil {
+		t.Error("IPv4 address of 3 bytes read")
+	}
+}
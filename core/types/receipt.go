@@ -2,11 +2,27 @@
 
 package types
 
-import "github.com/Qitmeer/qitmeer/common/hash"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+)
+
+// maxReceiptItems is the maximum number of events or transaction receipts a
+// serialized block receipt may declare.  It only guards the allocations while
+// decoding.
+const maxReceiptItems = MaxBlockPayload
 
 // block execution event, ex. validator change event
 type Event []byte
 
+// BlockReceipt is the result of the contract transactions of a block.  Once the
+// contracts deployment is active, its storage root and the merkle root of its
+// transaction receipts are committed to by the state root of the blocks it is
+// the main parent of.
 type BlockReceipt struct {
 	BlockNumber uint64
 
@@ -26,4 +42,173 @@ type BlockReceipt struct {
 	// for example authority set changes (ex. validator set changes)
 	// fast warp sync by tracking validator set changes trustlessly
 	Events []Event
+
+	// The receipts of the contract transactions of the block in the order
+	// they were executed.
+	TxReceipts []*TxReceipt
+}
+
+// TxReceipt is the outcome of the execution of a contract transaction.
+type TxReceipt struct {
+	TxHash hash.Hash
+
+	// The created, called or destroyed contract.
+	Contract ContractId
+
+	// Whether or not the execution succeeded.  The changes of a failed
+	// execution are discarded, but its gas is still used.
+	Success bool
+
+	GasUsed uint64
+
+	// The events emitted by the contract.
+	Events []Event
+}
+
+// Serialize encodes the block receipt to w.
+func (r *BlockReceipt) Serialize(w io.Writer) error {
+	err := s.BinarySerializer.PutUint64(w, binary.LittleEndian, r.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(r.StorageRoot[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(r.ChangeRoot[:]); err != nil {
+		return err
+	}
+	if err := writeEvents(w, r.Events); err != nil {
+		return err
+	}
+	err = s.WriteVarInt(w, 0, uint64(len(r.TxReceipts)))
+	if err != nil {
+		return err
+	}
+	for _, txr := range r.TxReceipts {
+		if err := txr.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize decodes a block receipt from r.
+func (r *BlockReceipt) Deserialize(rd io.Reader) error {
+	var err error
+	r.BlockNumber, err = s.BinarySerializer.Uint64(rd, binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rd, r.StorageRoot[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rd, r.ChangeRoot[:]); err != nil {
+		return err
+	}
+	r.Events, err = readEvents(rd)
+	if err != nil {
+		return err
+	}
+	count, err := s.ReadVarInt(rd, 0)
+	if err != nil {
+		return err
+	}
+	if count > maxReceiptItems {
+		return fmt.Errorf("BlockReceipt.Deserialize: too many " +
+			"transaction receipts")
+	}
+	r.TxReceipts = make([]*TxReceipt, count)
+	for i := range r.TxReceipts {
+		txr := &TxReceipt{}
+		if err := txr.Deserialize(rd); err != nil {
+			return err
+		}
+		r.TxReceipts[i] = txr
+	}
+	return nil
+}
+
+// Serialize encodes the transaction receipt to w.
+func (txr *TxReceipt) Serialize(w io.Writer) error {
+	if _, err := w.Write(txr.TxHash[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(txr.Contract[:]); err != nil {
+		return err
+	}
+	var success uint8
+	if txr.Success {
+		success = 1
+	}
+	if err := s.BinarySerializer.PutUint8(w, success); err != nil {
+		return err
+	}
+	err := s.BinarySerializer.PutUint64(w, binary.LittleEndian, txr.GasUsed)
+	if err != nil {
+		return err
+	}
+	return writeEvents(w, txr.Events)
+}
+
+// Deserialize decodes a transaction receipt from r.
+func (txr *TxReceipt) Deserialize(r io.Reader) error {
+	if _, err := io.ReadFull(r, txr.TxHash[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, txr.Contract[:]); err != nil {
+		return err
+	}
+	success, err := s.BinarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+	txr.Success = success != 0
+	txr.GasUsed, err = s.BinarySerializer.Uint64(r, binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	txr.Events, err = readEvents(r)
+	return err
+}
+
+// Hash returns the double hash of the serialized transaction receipt.
+func (txr *TxReceipt) Hash() hash.Hash {
+	var buf bytes.Buffer
+	// Ignore the error return since there is no way the encode could fail
+	// except being out of memory which would cause a run-time panic.
+	_ = txr.Serialize(&buf)
+	return hash.DoubleHashH(buf.Bytes())
+}
+
+// writeEvents encodes a list of events to w.
+func writeEvents(w io.Writer, events []Event) error {
+	err := s.WriteVarInt(w, 0, uint64(len(events)))
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := s.WriteVarBytes(w, 0, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEvents decodes a list of events from r.
+func readEvents(r io.Reader) ([]Event, error) {
+	count, err := s.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxReceiptItems {
+		return nil, fmt.Errorf("readEvents: too many events")
+	}
+	events := make([]Event, count)
+	for i := range events {
+		events[i], err = s.ReadVarBytes(r, 0, MaxBlockPayload, "event")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
 }
@@ -21,16 +21,55 @@ const (
 	TxTypeRegular   TxType = 0x03
 	AssetIssue      TxType = 0xa0
 	AssetRevoke     TxType = 0xa1
+	AssetTransfer   TxType = 0xa2
 	ContractCreate  TxType = 0xc0
 	ContractDestroy TxType = 0xc1
 	ContractUpdate  TxType = 0xc2
 )
 
+// txTypeStrings is a map of transaction types back to their constant names
+// for pretty printing.
+var txTypeStrings = map[TxType]string{
+	CoinBase:        "coinbase",
+	Leger:           "leger",
+	TxTypeRegular:   "regular",
+	AssetIssue:      "assetissue",
+	AssetRevoke:     "assetrevoke",
+	AssetTransfer:   "assettransfer",
+	ContractCreate:  "contractcreate",
+	ContractDestroy: "contractdestroy",
+	ContractUpdate:  "contractupdate",
+}
+
+// String returns the TxType in human-readable form.
+func (t TxType) String() string {
+	if s, ok := txTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%#x)", byte(t))
+}
+
 const (
 
 	// TxVersion is the current latest supported transaction version.
 	TxVersion uint32 = 1
 
+	// TxVersionMask extracts the transaction version number from the
+	// version field.  The bits above it carry the transaction type.
+	TxVersionMask uint32 = 0xff
+
+	// TxTypeShift is the number of bits the transaction type is shifted to
+	// the left within the version field.
+	TxTypeShift = 8
+
+	// TxTypeFlag marks the transactions carrying a type in the version
+	// field.  It lies in the serialization type half of the serialized
+	// version, which only accepted TxSerializeFull and TxSerializeNoWitness
+	// before, so no transaction serialized without the types can be read
+	// as a typed transaction.  The type bits of the transactions without
+	// the flag are ignored.
+	TxTypeFlag uint32 = 1 << 30
+
 	// defaultTxInOutAlloc is the default size used for the backing array
 	// for transaction inputs and outputs.  The array will dynamically grow
 	// as needed, but this figure is intended to provide enough space for
@@ -219,11 +258,23 @@ func (t *Transaction) AddTxOut(to *TxOutput) {
 	t.TxOut = append(t.TxOut, to)
 }
 
-// DetermineTxType determines the type of stake transaction a transaction is; if
-// none, it returns that it is an assumed regular tx.
+// DetermineTxType determines the type of a transaction from the type bits of
+// its version; if the version isn't flagged with TxTypeFlag, it returns that it
+// is an assumed regular tx.
 func DetermineTxType(tx *Transaction) TxType {
-	//TODO txType
-	return TxTypeRegular
+	if tx.Version&TxTypeFlag == 0 {
+		return TxTypeRegular
+	}
+	return TxType((tx.Version & 0xffff) >> TxTypeShift)
+}
+
+// SetTxType stores the passed transaction type in the version field while
+// keeping the version number.
+func (tx *Transaction) SetTxType(txType TxType) {
+	tx.Version &= TxVersionMask
+	if txType != TxTypeRegular {
+		tx.Version |= TxTypeFlag | uint32(txType)<<TxTypeShift
+	}
 }
 
 // SerializeSize returns the number of bytes it would take to serialize the
@@ -246,6 +297,9 @@ func (tx *Transaction) SerializeSize() int {
 	for _, txOut := range tx.TxOut {
 		n += txOut.SerializeSize()
 	}
+	if tx.IsAssetTx() {
+		n += AssetIdSize * len(tx.TxOut)
+	}
 	for _, txIn := range tx.TxIn {
 		n += txIn.SerializeSizeWitness()
 	}
@@ -267,6 +321,9 @@ func (tx *Transaction) SerializeSizeNoWitness() int {
 	for _, txOut := range tx.TxOut {
 		n += txOut.SerializeSize()
 	}
+	if tx.IsAssetTx() {
+		n += AssetIdSize * len(tx.TxOut)
+	}
 	return n
 }
 
@@ -347,8 +404,9 @@ func (tx *Transaction) encodePrefix(w io.Writer, pver uint32) error {
 		return err
 	}
 
+	withAsset := tx.IsAssetTx()
 	for _, to := range tx.TxOut {
-		err = writeTxOut(w, pver, to)
+		err = writeTxOut(w, pver, to, withAsset)
 		if err != nil {
 			return err
 		}
@@ -381,12 +439,19 @@ func WriteOutPoint(w io.Writer, pver uint32, version uint32, op *TxOutPoint) err
 	return s.BinarySerializer.PutUint32(w, binary.LittleEndian, op.OutIndex)
 }
 
-// writeTxOut encodes for a transaction output (TxOut) to w.
-func writeTxOut(w io.Writer, pver uint32, to *TxOutput) error {
+// writeTxOut encodes for a transaction output (TxOut) to w.  The asset
+// identifier is only written for outputs of asset transactions.
+func writeTxOut(w io.Writer, pver uint32, to *TxOutput, withAsset bool) error {
 	err := s.BinarySerializer.PutUint64(w, binary.LittleEndian, uint64(to.Amount))
 	if err != nil {
 		return err
 	}
+	if withAsset {
+		_, err = w.Write(to.Asset[:])
+		if err != nil {
+			return err
+		}
+	}
 	return s.WriteVarBytes(w, pver, to.PkScript)
 }
 
@@ -417,13 +482,13 @@ func (tx *Transaction) Deserialize(r io.Reader) error {
 func (tx *Transaction) Decode(r io.Reader, pver uint32) error {
 	// The serialized encoding of the version includes the real transaction
 	// version in the lower 16 bits and the transaction serialization type
-	// in the upper 16 bits.
+	// in the upper 16 bits, the type flag is kept with the version.
 	version, err := s.BinarySerializer.Uint32(r, binary.LittleEndian)
 	if err != nil {
 		return err
 	}
-	tx.Version = uint32(version & 0xffff)
-	serType := TxSerializeType(version >> 16)
+	tx.Version = version & (0xffff | TxTypeFlag)
+	serType := TxSerializeType((version &^ TxTypeFlag) >> 16)
 
 	// returnScriptBuffers is a closure that returns any script buffers that
 	// were borrowed from the pool when there are any deserialization
@@ -525,6 +590,7 @@ func (tx *Transaction) decodePrefix(r io.Reader) (uint64, error) {
 
 	// TxOuts.
 	var totalScriptSize uint64
+	withAsset := tx.IsAssetTx()
 	txOuts := make([]TxOutput, count)
 	tx.TxOut = make([]*TxOutput, count)
 	for i := uint64(0); i < count; i++ {
@@ -532,7 +598,7 @@ func (tx *Transaction) decodePrefix(r io.Reader) (uint64, error) {
 		// and needs to be returned to the pool on error.
 		to := &txOuts[i]
 		tx.TxOut[i] = to
-		err = readTxOut(r, to)
+		err = readTxOut(r, to, withAsset)
 		if err != nil {
 			return 0, err
 		}
@@ -581,13 +647,20 @@ func ReadOutPoint(r io.Reader, version uint32, op *TxOutPoint) error {
 
 // readTxOut reads the next sequence of bytes from r as a transaction output
 // (TxOut).
-func readTxOut(r io.Reader, to *TxOutput) error {
+func readTxOut(r io.Reader, to *TxOutput, withAsset bool) error {
 	value, err := s.BinarySerializer.Uint64(r, binary.LittleEndian)
 	if err != nil {
 		return err
 	}
 	to.Amount = uint64(value)
 
+	if withAsset {
+		_, err = io.ReadFull(r, to.Asset[:])
+		if err != nil {
+			return err
+		}
+	}
+
 	to.PkScript, err = readScript(r)
 	return err
 }
@@ -869,6 +942,7 @@ func NewTxDeep(msgTx *Transaction) *Tx {
 		txOuts[i] = &TxOutput{
 			Amount:   txout.Amount,
 			PkScript: pkScript,
+			Asset:    txout.Asset,
 		}
 	}
 
@@ -1001,6 +1075,9 @@ func (ti *TxInput) SerializeSizeWitness() int {
 type TxOutput struct {
 	Amount   uint64
 	PkScript []byte //Here, asm/type -> OP_XXX OP_RETURN
+	// Asset is the asset the amount is denominated in.  It is only
+	// serialized for asset transactions and is MeerAssetId otherwise.
+	Asset AssetId
 }
 
 // NewTxOutput returns a new bitcoin transaction output with the provided
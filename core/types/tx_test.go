@@ -1,6 +1,7 @@
 package types
 
 import (
+	"bytes"
 	"encoding/hex"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"testing"
@@ -77,3 +78,78 @@ func Test_TxExtensibility(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func Test_AssetTxSerialize(t *testing.T) {
+	tx, err := createTx(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].PreviousOut = *NewOutPoint(&hash.Hash{1}, 0)
+	tx.SetTxType(AssetIssue)
+	assetId := NewAssetId(&tx.TxIn[0].PreviousOut)
+	tx.TxOut[0].Asset = assetId
+
+	if tx.Version&TxVersionMask != TxVersion {
+		t.Fatalf("version %d, want %d", tx.Version&TxVersionMask, TxVersion)
+	}
+	if !tx.IsAssetTx() {
+		t.Fatalf("transaction type %v is not an asset type", DetermineTxType(tx))
+	}
+
+	serialized, err := tx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serialized) != tx.SerializeSize() {
+		t.Fatalf("serialized %d bytes, want %d", len(serialized), tx.SerializeSize())
+	}
+	var newTx Transaction
+	err = newTx.Deserialize(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetermineTxType(&newTx) != AssetIssue {
+		t.Fatalf("transaction type %v, want %v", DetermineTxType(&newTx), AssetIssue)
+	}
+	if newTx.TxOut[0].Asset != assetId {
+		t.Fatalf("asset %v, want %v", newTx.TxOut[0].Asset, assetId)
+	}
+	if newTx.TxHash() != tx.TxHash() {
+		t.Fatal("transaction hash changed by serialization")
+	}
+
+	// The asset identifier is not serialized for regular transactions.
+	tx.SetTxType(TxTypeRegular)
+	if DetermineTxType(tx) != TxTypeRegular {
+		t.Fatalf("transaction type %v, want %v", DetermineTxType(tx), TxTypeRegular)
+	}
+	if tx.SerializeSize() != len(serialized)-AssetIdSize {
+		t.Fatalf("regular transaction size %d, want %d", tx.SerializeSize(),
+			len(serialized)-AssetIdSize)
+	}
+
+	// The version of the transactions serialized before the types could
+	// already have the bits of the type set, they stay regular without
+	// the type flag.
+	tx.Version = TxVersion | uint32(AssetIssue)<<TxTypeShift
+	if DetermineTxType(tx) != TxTypeRegular {
+		t.Fatalf("transaction type %v, want %v", DetermineTxType(tx), TxTypeRegular)
+	}
+	legacy, err := tx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy) != len(serialized)-AssetIdSize {
+		t.Fatalf("legacy transaction size %d, want %d", len(legacy),
+			len(serialized)-AssetIdSize)
+	}
+	newTx = Transaction{}
+	err = newTx.Deserialize(bytes.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newTx.Version != tx.Version || DetermineTxType(&newTx) != TxTypeRegular {
+		t.Fatalf("legacy transaction version %x of type %v, want %x",
+			newTx.Version, DetermineTxType(&newTx), tx.Version)
+	}
+}
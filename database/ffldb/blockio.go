@@ -18,8 +18,11 @@ import (
 	"github.com/Qitmeer/qitmeer/database"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -311,6 +314,30 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// removeFile closes the block file for the passed flat file number if it is
+// open and deletes it.  It is used to prune the old block files, so it must not
+// be called for the current write file.
+func (s *blockStore) removeFile(fileNum uint32) error {
+	s.obfMutex.Lock()
+	if blockFile, ok := s.openBlockFiles[fileNum]; ok {
+		s.lruMutex.Lock()
+		s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+		delete(s.fileNumToLRUElem, fileNum)
+		s.lruMutex.Unlock()
+
+		// Close the file under the write lock for the file in case any
+		// readers are currently reading from it.
+		blockFile.Lock()
+		_ = blockFile.file.Close()
+		blockFile.Unlock()
+
+		delete(s.openBlockFiles, fileNum)
+	}
+	s.obfMutex.Unlock()
+
+	return s.deleteFileFunc(fileNum)
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -715,15 +742,44 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// firstBlockFile searches the database directory for the oldest flat block file
+// which has not been pruned.  It returns -1 when there are no block files.
+func firstBlockFile(dbPath string) int {
+	files, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return -1
+	}
+	firstFile := -1
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".fdb")
+		if len(name) != 9 || name == file.Name() {
+			continue
+		}
+		fileNum, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		if firstFile == -1 || int(fileNum) < firstFile {
+			firstFile = int(fileNum)
+		}
+	}
+	return firstFile
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
 // to detect unexpected shutdowns in the middle of writes so the block files
-// can be reconciled.
+// can be reconciled.  The scan starts at the oldest block file, because the
+// files before it may have been pruned.
 func scanBlockFiles(dbPath string) (int, uint32) {
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	firstFile := firstBlockFile(dbPath)
+	if firstFile == -1 {
+		firstFile = 0
+	}
+	for i := firstFile; ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -972,6 +972,10 @@ type transaction struct {
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
 
+	// Block files that need to be deleted once the pruned block index has
+	// been committed.
+	pendingPrunedFiles []uint32
+
 	// Active iterators that need to be notified when the pending keys have
 	// been updated so the cursors can properly handle updates to the
 	// transaction state.
@@ -1369,6 +1373,10 @@ func (tx *transaction) FetchBlock(hash *hash.Hash) ([]byte, error) {
 		return nil, err
 	}
 	location := deserializeBlockLoc(blockRow)
+	if location.blockLen == 0 {
+		str := fmt.Sprintf("block %s has been pruned", hash)
+		return nil, makeDbErr(database.ErrBlockPruned, str, nil)
+	}
 
 	// Read the block from the appropriate location.  The function also
 	// performs a checksum over the data to detect data corruption.
@@ -1500,6 +1508,10 @@ func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, e
 		return nil, err
 	}
 	location := deserializeBlockLoc(blockRow)
+	if location.blockLen == 0 {
+		str := fmt.Sprintf("block %s has been pruned", region.Hash)
+		return nil, makeDbErr(database.ErrBlockPruned, str, nil)
+	}
 
 	// Ensure the region is within the bounds of the block.
 	endOffset := region.Offset + region.Len
@@ -1598,6 +1610,10 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 			return nil, err
 		}
 		location := deserializeBlockLoc(blockRow)
+		if location.blockLen == 0 {
+			str := fmt.Sprintf("block %s has been pruned", region.Hash)
+			return nil, makeDbErr(database.ErrBlockPruned, str, nil)
+		}
 
 		// Ensure the region is within the bounds of the block.
 		endOffset := region.Offset + region.Len
@@ -1629,6 +1645,105 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	return blockRegions, nil
 }
 
+// PruneBlocks deletes the oldest flat block files until the total size of the
+// block files is no more than the passed target size.  The block index rows of
+// the blocks in a deleted file are kept with only their headers, so HasBlock
+// and FetchBlockHeader keep working while FetchBlock returns ErrBlockPruned.
+// Pruning stops at the first file which contains a block the keep function
+// returns true for and the current write file is never deleted.  The files are
+// deleted once the transaction has been committed.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, keep func(hash *hash.Hash) bool) ([]hash.Hash, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	store := tx.db.store
+	firstFile := firstBlockFile(store.basePath)
+	if firstFile < 0 {
+		return nil, nil
+	}
+	wc := store.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+
+	// Sum up the size of all of the block files.
+	fileSizes := make(map[uint32]uint64)
+	totalSize := uint64(0)
+	for fileNum := uint32(firstFile); fileNum <= curFileNum; fileNum++ {
+		fi, err := os.Stat(blockFilePath(store.basePath, fileNum))
+		if err != nil {
+			continue
+		}
+		fileSizes[fileNum] = uint64(fi.Size())
+		totalSize += uint64(fi.Size())
+	}
+	if totalSize <= targetSize {
+		return nil, nil
+	}
+
+	// Group the blocks which are not pruned yet by their block file.
+	fileBlocks := make(map[uint32][]hash.Hash)
+	err := tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		location := deserializeBlockLoc(v)
+		if location.blockLen == 0 || location.blockFileNum >= curFileNum {
+			return nil
+		}
+		var h hash.Hash
+		copy(h[:], k)
+		fileBlocks[location.blockFileNum] = append(
+			fileBlocks[location.blockFileNum], h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []hash.Hash
+	for fileNum := uint32(firstFile); fileNum < curFileNum &&
+		totalSize > targetSize; fileNum++ {
+
+		blocks := fileBlocks[fileNum]
+		for i := range blocks {
+			if keep(&blocks[i]) {
+				return pruned, nil
+			}
+		}
+
+		// Only keep the headers of the blocks in the file.
+		for i := range blocks {
+			blockRow, err := tx.fetchBlockRow(&blocks[i])
+			if err != nil {
+				return nil, err
+			}
+			blockRow = serializeBlockRow(blockLocation{},
+				blockRow[blockHdrOffset:])
+			err = tx.blockIdxBucket.Put(blocks[i][:], blockRow)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pruned = append(pruned, blocks...)
+		tx.pendingPrunedFiles = append(tx.pendingPrunedFiles, fileNum)
+		totalSize -= fileSizes[fileNum]
+	}
+
+	return pruned, nil
+}
+
 // close marks the transaction closed then releases any pending data, the
 // underlying snapshot, the transaction read lock, and the write lock when the
 // transaction is writable.
@@ -1643,6 +1758,9 @@ func (tx *transaction) close() {
 	tx.pendingKeys = nil
 	tx.pendingRemove = nil
 
+	// Clear the block files that would have been deleted on commit.
+	tx.pendingPrunedFiles = nil
+
 	// Release the snapshot.
 	if tx.snapshot != nil {
 		tx.snapshot.Release()
@@ -1726,7 +1844,19 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+
+	// The pruned block files are no longer referenced by the block index,
+	// so they can be deleted now.
+	for _, fileNum := range tx.pendingPrunedFiles {
+		if err := tx.db.store.removeFile(fileNum); err != nil {
+			dblog.Warn("Unable to delete pruned block file", "file",
+				fileNum, "error", err)
+		}
+	}
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -2040,9 +2170,10 @@ func initDB(ldb *leveldb.DB) error {
 	return nil
 }
 
-// openDB opens the database at the provided path.  database.ErrDbDoesNotExist
-// is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network protocol.Network, create bool) (database.DB, error) {
+// openDB opens the database at the provided path, the new blocks are written
+// to files of up to fileSize bytes.  database.ErrDbDoesNotExist is returned if
+// the database doesn't exist and the create flag is not set.
+func openDB(dbPath string, network protocol.Network, fileSize uint32, create bool) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2077,6 +2208,7 @@ func openDB(dbPath string, network protocol.Network, create bool) (database.DB,
 	// database cache which wraps the underlying leveldb database to provide
 	// write caching.
 	store := newBlockStore(dbPath, network)
+	store.maxBlockFileSize = fileSize
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
 	pdb := &db{store: store, cache: cache}
 
@@ -19,49 +19,60 @@ const (
 	dbType = "ffldb"
 )
 
-// parseArgs parses the arguments from the database Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, protocol.Network, error) {
-	if len(args) != 2 {
-		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
+// parseArgs parses the arguments from the database Open/Create methods.  The
+// optional third argument is the maximum size of the block files, which lets
+// the tests spread a few blocks over several files.
+func parseArgs(funcName string, args ...interface{}) (string, protocol.Network, uint32, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", 0, 0, fmt.Errorf("invalid arguments to %s.%s -- "+
 			"expected database path and block network", dbType,
 			funcName)
 	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
+		return "", 0, 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
 			"expected database path string", dbType, funcName)
 	}
 
 	network, ok := args[1].(protocol.Network)
 	if !ok {
-		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
+		return "", 0, 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
 			"expected block network", dbType, funcName)
 	}
 
-	return dbPath, network, nil
+	fileSize := maxBlockFileSize
+	if len(args) == 3 {
+		fileSize, ok = args[2].(uint32)
+		if !ok || fileSize == 0 || fileSize > maxBlockFileSize {
+			return "", 0, 0, fmt.Errorf("third argument to %s.%s is "+
+				"invalid -- expected block file size", dbType, funcName)
+		}
+	}
+
+	return dbPath, network, fileSize, nil
 }
 
 // openDBDriver is the callback provided during driver registration that opens
 // an existing database for use.
 func openDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Open", args...)
+	dbPath, network, fileSize, err := parseArgs("Open", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDB(dbPath, network, fileSize, false)
 }
 
 // createDBDriver is the callback provided during driver registration that
 // creates, initializes, and opens a database for use.
 func createDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Create", args...)
+	dbPath, network, fileSize, err := parseArgs("Create", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return openDB(dbPath, network, fileSize, true)
 }
 
 // useLogger is the callback provided during driver registration that sets the
@@ -0,0 +1,226 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pruneTestBlocks is the number of blocks stored by the pruning tests, each
+// one in its own block file.
+const pruneTestBlocks = 5
+
+// newPruneTestDB creates a database in a new temporary directory and stores
+// the test blocks in it, one per block file.  It returns the directory, the
+// database, the blocks and the size of a block file.
+func newPruneTestDB(t *testing.T) (string, database.DB, []*types.SerializedBlock, uint64) {
+	var blocks []*types.SerializedBlock
+	for i := 0; i < pruneTestBlocks; i++ {
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{}, 0), nil))
+		tx.AddTxOut(types.NewTxOutput(uint64(i), bytes.Repeat([]byte{0x51}, 100)))
+		block := types.Block{Header: types.BlockHeader{
+			Timestamp: time.Unix(int64(i), 0),
+			Pow:       pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{}),
+		}}
+		if err := block.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, types.NewBlock(&block))
+	}
+	rawBlock, err := blocks[0].Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSize := uint64(len(rawBlock) + 12)
+
+	dir, err := ioutil.TempDir("", "ffldbprune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idb, err := database.Create(dbType, filepath.Join(dir, "db"),
+		protocol.PrivNet, uint32(fileSize))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	err = idb.Update(func(dbTx database.Tx) error {
+		for _, block := range blocks {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, idb, blocks, fileSize
+}
+
+// pruneBlocks prunes the blocks of the database down to the target size and
+// returns the hashes of the pruned blocks.
+func pruneBlocks(t *testing.T, idb database.DB, targetSize uint64, keep func(*hash.Hash) bool) []hash.Hash {
+	var pruned []hash.Hash
+	err := idb.Update(func(dbTx database.Tx) error {
+		var err error
+		pruned, err = dbTx.PruneBlocks(targetSize, keep)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pruned
+}
+
+// checkPruned checks that only the headers of the first blocks are left and
+// that the other blocks can still be fetched.
+func checkPruned(t *testing.T, idb database.DB, blocks []*types.SerializedBlock, numPruned int) {
+	err := idb.View(func(dbTx database.Tx) error {
+		for i, block := range blocks {
+			has, err := dbTx.HasBlock(block.Hash())
+			if err != nil || !has {
+				t.Errorf("block %d: has %v, %v", i, has, err)
+			}
+			rawHeader, err := dbTx.FetchBlockHeader(block.Hash())
+			if err != nil {
+				t.Errorf("block %d header: %v", i, err)
+			}
+			var header types.BlockHeader
+			err = header.Deserialize(bytes.NewReader(rawHeader))
+			if err != nil || header.BlockHash() != *block.Hash() {
+				t.Errorf("block %d: wrong header", i)
+			}
+			_, err = dbTx.FetchBlock(block.Hash())
+			if i < numPruned {
+				if !database.IsError(err, database.ErrBlockPruned) {
+					t.Errorf("block %d: fetched %v, want pruned", i, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("block %d: %v", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PruneBlocksTarget(t *testing.T) {
+	dir, idb, blocks, fileSize := newPruneTestDB(t)
+	defer os.RemoveAll(dir)
+	defer idb.Close()
+
+	// Nothing is pruned when the files fit.
+	if pruned := pruneBlocks(t, idb, pruneTestBlocks*fileSize, nil); len(pruned) != 0 {
+		t.Fatalf("%d blocks pruned below the target", len(pruned))
+	}
+
+	// The oldest files are deleted down to the target size.
+	pruned := pruneBlocks(t, idb, 2*fileSize, func(*hash.Hash) bool {
+		return false
+	})
+	if len(pruned) != 3 {
+		t.Fatalf("%d blocks pruned, want 3", len(pruned))
+	}
+	for i := range pruned {
+		if pruned[i] != *blocks[i].Hash() {
+			t.Fatalf("pruned block %d is %v", i, pruned[i])
+		}
+	}
+	basePath := filepath.Join(dir, "db")
+	for i := 0; i < pruneTestBlocks; i++ {
+		_, err := os.Stat(blockFilePath(basePath, uint32(i)))
+		if exists := err == nil; exists != (i >= 3) {
+			t.Errorf("block file %d exists: %v", i, exists)
+		}
+	}
+	checkPruned(t, idb, blocks, 3)
+
+	// The current write file is never deleted.
+	pruned = pruneBlocks(t, idb, 0, func(*hash.Hash) bool { return false })
+	if len(pruned) != 1 || pruned[0] != *blocks[3].Hash() {
+		t.Fatalf("pruned %v, want the block 3", pruned)
+	}
+	checkPruned(t, idb, blocks, 4)
+
+	// Pruning requires a writable transaction.
+	err := idb.View(func(dbTx database.Tx) error {
+		_, err := dbTx.PruneBlocks(0, nil)
+		return err
+	})
+	if !database.IsError(err, database.ErrTxNotWritable) {
+		t.Fatalf("pruned in a read-only transaction: %v", err)
+	}
+}
+
+func Test_PruneBlocksKeep(t *testing.T) {
+	dir, idb, blocks, _ := newPruneTestDB(t)
+	defer os.RemoveAll(dir)
+	defer idb.Close()
+
+	// Pruning stops at the first block to keep, even if the newer ones
+	// aren't kept.
+	keep := func(h *hash.Hash) bool {
+		return *h == *blocks[2].Hash()
+	}
+	pruned := pruneBlocks(t, idb, 0, keep)
+	if len(pruned) != 2 {
+		t.Fatalf("%d blocks pruned, want 2", len(pruned))
+	}
+	checkPruned(t, idb, blocks, 2)
+
+	// A rolled back prune doesn't delete anything.
+	idb.Update(func(dbTx database.Tx) error {
+		if _, err := dbTx.PruneBlocks(0, func(*hash.Hash) bool {
+			return false
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("rollback")
+	})
+	checkPruned(t, idb, blocks, 2)
+}
+
+func Test_PruneBlocksReopen(t *testing.T) {
+	dir, idb, blocks, fileSize := newPruneTestDB(t)
+	defer os.RemoveAll(dir)
+
+	pruneBlocks(t, idb, 2*fileSize, func(*hash.Hash) bool { return false })
+	idb.Close()
+
+	// The write cursor is found after the first block files are gone.
+	basePath := filepath.Join(dir, "db")
+	lastFile, fileLen := scanBlockFiles(basePath)
+	if lastFile != pruneTestBlocks-1 || uint64(fileLen) != fileSize {
+		t.Fatalf("scanned file %d length %d, want %d %d", lastFile,
+			fileLen, pruneTestBlocks-1, fileSize)
+	}
+	if first := firstBlockFile(basePath); first != 3 {
+		t.Fatalf("first block file %d, want 3", first)
+	}
+
+	idb, err := database.Open(dbType, basePath, protocol.PrivNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idb.Close()
+	checkPruned(t, idb, blocks, 3)
+}
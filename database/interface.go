@@ -391,6 +391,20 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// PruneBlocks deletes the data of the oldest blocks until the stored
+	// blocks fit into the target size in bytes.  The pruning stops at the
+	// first block which the keep function wants to keep.  The headers of
+	// the pruned blocks are kept, fetching their data returns
+	// ErrBlockPruned.  It returns the hashes of the pruned blocks.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	PruneBlocks(targetSize uint64, keep func(hash *hash.Hash) bool) ([]hash.Hash, error)
+
 	// ******************************************************************
 	// Methods related to both atomic metadata storage and block storage.
 	// ******************************************************************
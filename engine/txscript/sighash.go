@@ -166,7 +166,7 @@ func putUint64LE(buf []byte, val uint64) int {
 // sigHashPrefixSerializeSize returns the number of bytes the passed parameters
 // would take when encoded with the format used by the prefix hash portion of
 // the overall signature hash.
-func sigHashPrefixSerializeSize(hashType SigHashType, txIns []*types.TxInput, txOuts []*types.TxOutput, signIdx int) int {
+func sigHashPrefixSerializeSize(hashType SigHashType, txIns []*types.TxInput, txOuts []*types.TxOutput, signIdx int, withAsset bool) int {
 	// 1) 4 bytes version/serialization type
 	// 2) number of inputs varint
 	// 3) per input:
@@ -180,6 +180,7 @@ func sigHashPrefixSerializeSize(hashType SigHashType, txIns []*types.TxInput, tx
 	//    b) 2 bytes script version
 	//    c) pkscript len varint (1 byte if not SigHashSingle output)
 	//    d) N bytes pkscript (0 bytes if not SigHashSingle output)
+	//    e) 32 bytes asset id (asset transactions only)
 	// 6) 4 bytes lock time
 	// 7) 4 bytes expiry
 	numTxIns := len(txIns)
@@ -188,6 +189,9 @@ func sigHashPrefixSerializeSize(hashType SigHashType, txIns []*types.TxInput, tx
 		numTxIns*(hash.HashSize+4+1+4) +
 		varIntSerializeSize(uint64(numTxOuts)) +
 		numTxOuts*(8+2) + 4 + 4
+	if withAsset {
+		size += numTxOuts * types.AssetIdSize
+	}
 	for txOutIdx, txOut := range txOuts {
 		pkScript := txOut.PkScript
 		if hashType&sigHashMask == SigHashSingle && txOutIdx != signIdx {
@@ -296,6 +300,7 @@ func calcSignatureHash(prevOutScript []ParsedOpcode, hashType SigHashType, tx *t
 	//    b) pkscript version (as little-endian uint16)
 	//    c) pkscript length (as varint)
 	//    d) pkscript (as unmodified bytes)
+	//    e) asset id (as unmodified bytes, asset transactions only)
 	// 6) transaction lock time (as little-endian uint32)
 	// 7) transaction expiry (as little-endian uint32)
 	//
@@ -336,7 +341,8 @@ func calcSignatureHash(prevOutScript []ParsedOpcode, hashType SigHashType, tx *t
 			// Nothing special here.
 		}
 
-		size := sigHashPrefixSerializeSize(hashType, txIns, txOuts, idx)
+		withAsset := tx.IsAssetTx()
+		size := sigHashPrefixSerializeSize(hashType, txIns, txOuts, idx, withAsset)
 		prefixBuf := make([]byte, size)
 
 		// Commit to the version and hash serialization type.
@@ -381,6 +387,17 @@ func calcSignatureHash(prevOutScript []ParsedOpcode, hashType SigHashType, tx *t
 			offset += putUint64LE(prefixBuf[offset:], uint64(value))
 			offset += putVarInt(prefixBuf[offset:], uint64(len(pkScript)))
 			offset += copy(prefixBuf[offset:], pkScript)
+
+			// Commit to the asset of the output for asset
+			// transactions.  SigHashSingle clears it with the
+			// other fields of the outputs that are not signed.
+			if withAsset {
+				asset := txOut.Asset
+				if hashType&sigHashMask == SigHashSingle && txOutIdx != idx {
+					asset = types.MeerAssetId
+				}
+				offset += copy(prefixBuf[offset:], asset[:])
+			}
 		}
 
 		// Commit to the lock time and expiry.
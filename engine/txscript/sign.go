@@ -854,7 +854,8 @@ func calcSignatureHash2(prevOutScript []ParsedOpcode, hashType SigHashType, txSc
 			// Nothing special here.
 		}
 
-		size := sigHashPrefixSerializeSize(hashType, txIns, txOuts, idx)
+		withAsset := tx.IsAssetTx()
+		size := sigHashPrefixSerializeSize(hashType, txIns, txOuts, idx, withAsset)
 		prefixBuf := make([]byte, size)
 
 		// Commit to the version and hash serialization type.
@@ -899,6 +900,17 @@ func calcSignatureHash2(prevOutScript []ParsedOpcode, hashType SigHashType, txSc
 			offset += putUint64LE(prefixBuf[offset:], uint64(value))
 			offset += putVarInt(prefixBuf[offset:], uint64(len(pkScript)))
 			offset += copy(prefixBuf[offset:], pkScript)
+
+			// Commit to the asset of the output for asset
+			// transactions.  SigHashSingle clears it with the
+			// other fields of the outputs that are not signed.
+			if withAsset {
+				asset := txOut.Asset
+				if hashType&sigHashMask == SigHashSingle && txOutIdx != idx {
+					asset = types.MeerAssetId
+				}
+				offset += copy(prefixBuf[offset:], asset[:])
+			}
 		}
 
 		// Commit to the lock time and expiry.
@@ -0,0 +1,112 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+// Package vm defines the interface of the engines which execute the contract
+// transactions and implements a deterministic reference engine.
+//
+// The chain runs the contract transactions of every block in DAG order.  Each
+// call is given a view of the storage of the called contract, and the changes
+// it makes are only committed when the execution succeeds.
+package vm
+
+import (
+	"fmt"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+)
+
+// StateDB is the storage of a single contract as seen by an engine.  Keys and
+// values are opaque to the chain, an engine is free to choose their encoding.
+type StateDB interface {
+	// GetState returns the value stored at the passed key, or nil when
+	// there is none.
+	GetState(key []byte) ([]byte, error)
+
+	// SetState stores the passed value at the key.  An empty value deletes
+	// the key.
+	SetState(key []byte, value []byte) error
+}
+
+// Context describes a single call of a contract.
+type Context struct {
+	// Contract is the address of the called contract.
+	Contract hash.Hash
+
+	// Caller is the script of the output spent by the first input of the
+	// calling transaction.
+	Caller []byte
+
+	// TxHash is the hash of the calling transaction.
+	TxHash hash.Hash
+
+	// BlockOrder is the order of the block containing the transaction.
+	BlockOrder uint64
+
+	// Code is the code of the contract.
+	Code []byte
+
+	// Input is the input passed by the calling transaction.
+	Input []byte
+
+	// GasLimit is the maximum amount of gas the call may use.
+	GasLimit uint64
+}
+
+// Result is the outcome of a call.
+type Result struct {
+	// GasUsed is the amount of gas the call used.
+	GasUsed uint64
+
+	// Events are the events the call emitted.
+	Events [][]byte
+
+	// Err is set when the execution failed, in which case the changes to
+	// the storage must be discarded.
+	Err error
+}
+
+// Engine executes the code of contracts.  An engine must be deterministic:
+// the same code, input and storage always produce the same result.
+type Engine interface {
+	// Name returns the name the engine is registered with.
+	Name() string
+
+	// Validate checks the code of a contract when it is created.
+	Validate(code []byte) error
+
+	// Execute runs the code of the contract described by the context.
+	// Failures of the execution are reported by the result, the returned
+	// error is only set when the storage can't be accessed.
+	Execute(ctx *Context, state StateDB) (*Result, error)
+}
+
+// engines holds all of the registered engines.
+var engines = make(map[string]Engine)
+
+// RegisterEngine adds an engine to the available engines.  An error is
+// returned if an engine with the same name has already been registered.
+func RegisterEngine(engine Engine) error {
+	if _, exists := engines[engine.Name()]; exists {
+		return fmt.Errorf("engine %q is already registered",
+			engine.Name())
+	}
+	engines[engine.Name()] = engine
+	return nil
+}
+
+// GetEngine returns the registered engine with the passed name.
+func GetEngine(name string) (Engine, error) {
+	engine, exists := engines[name]
+	if !exists {
+		return nil, fmt.Errorf("engine %q is not registered", name)
+	}
+	return engine, nil
+}
+
+// SupportedEngines returns the names of the registered engines.
+func SupportedEngines() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package vm
+
+import (
+	"errors"
+)
+
+// Execution errors of the reference engine.
+var (
+	// ErrOutOfGas is returned when a call uses more than its gas limit.
+	ErrOutOfGas = errors.New("out of gas")
+
+	// ErrRevert is returned when the code executes OP_REVERT.
+	ErrRevert = errors.New("execution reverted")
+
+	// ErrInvalidOpcode is returned for unknown opcodes.
+	ErrInvalidOpcode = errors.New("invalid opcode")
+
+	// ErrShortCode is returned when the operand of a push runs past the
+	// end of the code.
+	ErrShortCode = errors.New("push past end of code")
+
+	// ErrCodeTooLarge is returned when the code is larger than
+	// MaxCodeSize.
+	ErrCodeTooLarge = errors.New("code is larger than the maximum allowed")
+
+	// ErrStackUnderflow is returned when an opcode requires more items
+	// than there are on the stack.
+	ErrStackUnderflow = errors.New("stack underflow")
+
+	// ErrStackOverflow is returned when the stack grows beyond
+	// MaxStackSize items.
+	ErrStackOverflow = errors.New("stack overflow")
+
+	// ErrInvalidJump is returned when a jump does not target an
+	// OP_JUMPDEST.
+	ErrInvalidJump = errors.New("invalid jump destination")
+)
@@ -0,0 +1,329 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package vm
+
+import (
+	"encoding/binary"
+)
+
+// RefEngineName is the name the reference engine is registered with.
+const RefEngineName = "ref"
+
+const (
+	// MaxCodeSize is the maximum size of the code of a contract run by the
+	// reference engine.
+	MaxCodeSize = 8192
+
+	// MaxStackSize is the maximum number of items on the stack of the
+	// reference engine.
+	MaxStackSize = 256
+
+	// WordSize is the size of the words the reference engine operates on.
+	// Words are unsigned 64-bit integers, they are stored and emitted in
+	// big-endian byte order.
+	WordSize = 8
+)
+
+// The opcodes of the reference engine.  Unless noted otherwise, an opcode pops
+// its operands from the stack, the first operand being the top item, and
+// pushes its result.
+const (
+	OP_STOP     = 0x00 // End the execution successfully.
+	OP_ADD      = 0x01 // a + b
+	OP_SUB      = 0x02 // a - b
+	OP_MUL      = 0x03 // a * b
+	OP_DIV      = 0x04 // a / b, zero when b is zero
+	OP_MOD      = 0x05 // a % b, zero when b is zero
+	OP_LT       = 0x10 // 1 if a < b, else 0
+	OP_GT       = 0x11 // 1 if a > b, else 0
+	OP_EQ       = 0x12 // 1 if a == b, else 0
+	OP_ISZERO   = 0x13 // 1 if a == 0, else 0
+	OP_AND      = 0x14 // a & b
+	OP_OR       = 0x15 // a | b
+	OP_NOT      = 0x16 // ^a
+	OP_POP      = 0x20 // Drop the top item.
+	OP_DUP      = 0x21 // Duplicate the top item.
+	OP_SWAP     = 0x22 // Swap the two top items.
+	OP_PUSH     = 0x30 // Push the following word of the code.
+	OP_INPUT    = 0x40 // Push the word of the input at offset a.
+	OP_INPUTLEN = 0x41 // Push the size of the input.
+	OP_SLOAD    = 0x50 // Push the value stored at key a.
+	OP_SSTORE   = 0x51 // Store value b at key a.
+	OP_JUMP     = 0x60 // Continue at the OP_JUMPDEST at a.
+	OP_JUMPI    = 0x61 // Continue at the OP_JUMPDEST at a when b is not 0.
+	OP_JUMPDEST = 0x62 // Mark a jump destination.
+	OP_LOG      = 0x70 // Emit a as an event.
+	OP_REVERT   = 0xfe // End the execution and discard all changes.
+)
+
+// opcodeGas holds the gas used by every opcode, the opcodes which are not in
+// it are invalid.
+var opcodeGas = map[byte]uint64{
+	OP_STOP:     0,
+	OP_ADD:      1,
+	OP_SUB:      1,
+	OP_MUL:      2,
+	OP_DIV:      2,
+	OP_MOD:      2,
+	OP_LT:       1,
+	OP_GT:       1,
+	OP_EQ:       1,
+	OP_ISZERO:   1,
+	OP_AND:      1,
+	OP_OR:       1,
+	OP_NOT:      1,
+	OP_POP:      1,
+	OP_DUP:      1,
+	OP_SWAP:     1,
+	OP_PUSH:     1,
+	OP_INPUT:    2,
+	OP_INPUTLEN: 1,
+	OP_SLOAD:    20,
+	OP_SSTORE:   50,
+	OP_JUMP:     2,
+	OP_JUMPI:    3,
+	OP_JUMPDEST: 1,
+	OP_LOG:      10,
+	OP_REVERT:   0,
+}
+
+// refEngine is the deterministic reference engine.  It is a simple stack
+// machine operating on 64-bit words.
+type refEngine struct{}
+
+// Name returns the name the engine is registered with.
+//
+// This is part of the Engine interface implementation.
+func (e *refEngine) Name() string {
+	return RefEngineName
+}
+
+// Validate checks that the code only contains known opcodes and that every
+// push has its full operand.
+//
+// This is part of the Engine interface implementation.
+func (e *refEngine) Validate(code []byte) error {
+	_, err := jumpDests(code)
+	return err
+}
+
+// jumpDests checks the code and returns the offsets of its OP_JUMPDEST opcodes.
+func jumpDests(code []byte) (map[uint64]struct{}, error) {
+	if len(code) > MaxCodeSize {
+		return nil, ErrCodeTooLarge
+	}
+	dests := make(map[uint64]struct{})
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		if _, ok := opcodeGas[op]; !ok {
+			return nil, ErrInvalidOpcode
+		}
+		switch op {
+		case OP_PUSH:
+			if pc+WordSize >= len(code) {
+				return nil, ErrShortCode
+			}
+			pc += WordSize
+		case OP_JUMPDEST:
+			dests[uint64(pc)] = struct{}{}
+		}
+	}
+	return dests, nil
+}
+
+// Execute runs the code of the contract described by the context.
+//
+// This is part of the Engine interface implementation.
+func (e *refEngine) Execute(ctx *Context, state StateDB) (*Result, error) {
+	result := &Result{}
+	dests, err := jumpDests(ctx.Code)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+
+	stack := make([]uint64, 0, 16)
+	pop := func() uint64 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	for pc := uint64(0); pc < uint64(len(ctx.Code)); pc++ {
+		op := ctx.Code[pc]
+
+		// Charge the gas before the opcode is executed.
+		gas := opcodeGas[op]
+		if result.GasUsed+gas > ctx.GasLimit {
+			result.GasUsed = ctx.GasLimit
+			result.Err = ErrOutOfGas
+			return result, nil
+		}
+		result.GasUsed += gas
+
+		if len(stack) < numOperands(op) {
+			result.Err = ErrStackUnderflow
+			return result, nil
+		}
+
+		switch op {
+		case OP_STOP:
+			return result, nil
+
+		case OP_REVERT:
+			result.Err = ErrRevert
+			return result, nil
+
+		case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_LT, OP_GT,
+			OP_EQ, OP_AND, OP_OR:
+			a, b := pop(), pop()
+			stack = append(stack, binaryOp(op, a, b))
+
+		case OP_ISZERO:
+			stack = append(stack, boolWord(pop() == 0))
+
+		case OP_NOT:
+			stack = append(stack, ^pop())
+
+		case OP_POP:
+			pop()
+
+		case OP_DUP:
+			stack = append(stack, stack[len(stack)-1])
+
+		case OP_SWAP:
+			n := len(stack)
+			stack[n-1], stack[n-2] = stack[n-2], stack[n-1]
+
+		case OP_PUSH:
+			stack = append(stack,
+				binary.BigEndian.Uint64(ctx.Code[pc+1:pc+1+WordSize]))
+			pc += WordSize
+
+		case OP_INPUT:
+			offset := pop()
+			var word [WordSize]byte
+			if offset < uint64(len(ctx.Input)) {
+				copy(word[:], ctx.Input[offset:])
+			}
+			stack = append(stack, binary.BigEndian.Uint64(word[:]))
+
+		case OP_INPUTLEN:
+			stack = append(stack, uint64(len(ctx.Input)))
+
+		case OP_SLOAD:
+			value, err := state.GetState(wordBytes(pop()))
+			if err != nil {
+				return nil, err
+			}
+			if len(value) > WordSize {
+				value = value[len(value)-WordSize:]
+			}
+			var word [WordSize]byte
+			copy(word[WordSize-len(value):], value)
+			stack = append(stack, binary.BigEndian.Uint64(word[:]))
+
+		case OP_SSTORE:
+			key, value := pop(), pop()
+			var err error
+			if value == 0 {
+				err = state.SetState(wordBytes(key), nil)
+			} else {
+				err = state.SetState(wordBytes(key), wordBytes(value))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+		case OP_JUMP, OP_JUMPI:
+			dest := pop()
+			if op == OP_JUMPI && pop() == 0 {
+				continue
+			}
+			if _, ok := dests[dest]; !ok {
+				result.Err = ErrInvalidJump
+				return result, nil
+			}
+			// The destination is executed next.
+			pc = dest - 1
+
+		case OP_JUMPDEST:
+
+		case OP_LOG:
+			result.Events = append(result.Events, wordBytes(pop()))
+		}
+
+		if len(stack) > MaxStackSize {
+			result.Err = ErrStackOverflow
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// numOperands returns the number of stack items the passed opcode pops.
+func numOperands(op byte) int {
+	switch op {
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_LT, OP_GT, OP_EQ,
+		OP_AND, OP_OR, OP_SWAP, OP_SSTORE, OP_JUMPI:
+		return 2
+	case OP_ISZERO, OP_NOT, OP_POP, OP_DUP, OP_INPUT, OP_SLOAD, OP_JUMP,
+		OP_LOG:
+		return 1
+	}
+	return 0
+}
+
+// binaryOp applies the passed arithmetic, comparison or bitwise opcode to its
+// operands.  Arithmetic wraps around on overflow.
+func binaryOp(op byte, a, b uint64) uint64 {
+	switch op {
+	case OP_ADD:
+		return a + b
+	case OP_SUB:
+		return a - b
+	case OP_MUL:
+		return a * b
+	case OP_DIV:
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	case OP_MOD:
+		if b == 0 {
+			return 0
+		}
+		return a % b
+	case OP_LT:
+		return boolWord(a < b)
+	case OP_GT:
+		return boolWord(a > b)
+	case OP_EQ:
+		return boolWord(a == b)
+	case OP_AND:
+		return a & b
+	case OP_OR:
+		return a | b
+	}
+	return 0
+}
+
+// boolWord returns 1 for true and 0 for false.
+func boolWord(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// wordBytes returns the big-endian encoding of the passed word.
+func wordBytes(w uint64) []byte {
+	var b [WordSize]byte
+	binary.BigEndian.PutUint64(b[:], w)
+	return b[:]
+}
+
+func init() {
+	if err := RegisterEngine(&refEngine{}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type testState map[string][]byte
+
+func (s testState) GetState(key []byte) ([]byte, error) {
+	return s[string(key)], nil
+}
+
+func (s testState) SetState(key []byte, value []byte) error {
+	if len(value) == 0 {
+		delete(s, string(key))
+		return nil
+	}
+	s[string(key)] = value
+	return nil
+}
+
+func push(w uint64) []byte {
+	code := []byte{OP_PUSH, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(code[1:], w)
+	return code
+}
+
+func concat(parts ...[]byte) []byte {
+	var code []byte
+	for _, p := range parts {
+		code = append(code, p...)
+	}
+	return code
+}
+
+func Test_RefEngine(t *testing.T) {
+	engine, err := GetEngine(RefEngineName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add the first input word to the counter at key 1 and log it.
+	counter := concat(push(1), []byte{OP_SLOAD}, push(0),
+		[]byte{OP_INPUT, OP_ADD, OP_DUP, OP_LOG}, push(1),
+		[]byte{OP_SSTORE, OP_STOP})
+	if err := engine.Validate(counter); err != nil {
+		t.Fatal(err)
+	}
+	state := testState{}
+	ctx := &Context{Code: counter, Input: wordBytes(5), GasLimit: 1000}
+	for i := uint64(1); i <= 2; i++ {
+		result, err := engine.Execute(ctx, state)
+		if err != nil || result.Err != nil {
+			t.Fatalf("execution failed: %v %v", err, result.Err)
+		}
+		if len(result.Events) != 1 ||
+			binary.BigEndian.Uint64(result.Events[0]) != 5*i {
+			t.Fatalf("events %x, want %d", result.Events, 5*i)
+		}
+	}
+	if binary.BigEndian.Uint64(state[string(wordBytes(1))]) != 10 {
+		t.Fatalf("the counter was not stored")
+	}
+
+	// Loop forever until the gas runs out.
+	loop := concat([]byte{OP_JUMPDEST}, push(0), []byte{OP_JUMP})
+	result, err := engine.Execute(&Context{Code: loop, GasLimit: 100}, state)
+	if err != nil || result.Err != ErrOutOfGas || result.GasUsed != 100 {
+		t.Fatalf("result %v %v, want out of gas", err, result)
+	}
+
+	tests := []struct {
+		code []byte
+		err  error
+	}{
+		{[]byte{0xff}, ErrInvalidOpcode},
+		{[]byte{OP_PUSH, 1, 2}, ErrShortCode},
+		{[]byte{OP_ADD}, ErrStackUnderflow},
+		{concat(push(1), []byte{OP_JUMP}), ErrInvalidJump},
+		{[]byte{OP_REVERT}, ErrRevert},
+		{make([]byte, MaxCodeSize+1), ErrCodeTooLarge},
+	}
+	for i, test := range tests {
+		result, err := engine.Execute(&Context{Code: test.code, GasLimit: 100}, state)
+		if err != nil || result.Err != test.err {
+			t.Fatalf("test %d: result %v %v, want %v", i, err, result.Err, test.err)
+		}
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
 	"github.com/Qitmeer/qitmeer/services/common"
@@ -72,7 +74,7 @@ func (api *PublicBlockChainAPI) GetNodeInfo() (interface{}, error) {
 		TestNet:          api.node.node.Config.TestNet,
 		Confirmations:    blockdag.StableConfirmations,
 		CoinbaseMaturity: int32(api.node.node.Params.CoinbaseMaturity),
-		Modules:          []string{rpc.DefaultServiceNameSpace, rpc.MinerNameSpace, rpc.TestNameSpace, rpc.LogNameSpace},
+		Modules:          []string{rpc.DefaultServiceNameSpace, rpc.MinerNameSpace, rpc.TestNameSpace, rpc.LogNameSpace, rpc.WalletNameSpace},
 	}
 	ret.GraphState = *getGraphStateResult(best.GraphState)
 	return ret, nil
@@ -122,12 +124,15 @@ func (api *PublicBlockChainAPI) GetPeerInfo() (interface{}, error) {
 			LastRecv:   statsSnap.LastRecv.Unix(),
 			BytesSent:  statsSnap.BytesSent,
 			BytesRecv:  statsSnap.BytesRecv,
+			SentPerMsg: getMsgStatsResult(statsSnap.SentPerMsg),
+			RecvPerMsg: getMsgStatsResult(statsSnap.RecvPerMsg),
 			ConnTime:   statsSnap.ConnTime.Unix(),
 			PingTime:   float64(statsSnap.LastPingMicros),
 			TimeOffset: statsSnap.TimeOffset,
 			Version:    statsSnap.Version,
 			SubVer:     statsSnap.UserAgent,
 			Inbound:    statsSnap.Inbound,
+			Transport:  statsSnap.Transport,
 			BanScore:   int32(p.BanScore()),
 			SyncNode:   statsSnap.ID == syncPeerID,
 		}
@@ -144,6 +149,43 @@ func (api *PublicBlockChainAPI) GetPeerInfo() (interface{}, error) {
 	return infos, nil
 }
 
+func getMsgStatsResult(stats map[string]peer.MsgStats) map[string]json.MsgStats {
+	result := make(map[string]json.MsgStats, len(stats))
+	for cmd, s := range stats {
+		result[cmd] = json.MsgStats{Msgs: s.Msgs, Bytes: s.Bytes}
+	}
+	return result
+}
+
+// Return the bytes received and sent, the recent rates in bytes per second
+// and the upload target.  The durations are in seconds.
+func (api *PublicBlockChainAPI) GetNetTotals() (interface{}, error) {
+	totals := api.node.node.peerServer.NetTotals()
+	rates := make([]json.NetRateResult, 0, len(totals.Rates))
+	for _, r := range totals.Rates {
+		rates = append(rates, json.NetRateResult{
+			Window:     int64(r.Window.Seconds()),
+			SentPerSec: r.SentPerSec,
+			RecvPerSec: r.RecvPerSec,
+		})
+	}
+	ut := totals.UploadTarget
+	return &json.GetNetTotalsResult{
+		TotalBytesRecv: totals.BytesRecv,
+		TotalBytesSent: totals.BytesSent,
+		TimeMillis:     totals.Time.UnixNano() / int64(time.Millisecond),
+		Rates:          rates,
+		UploadTarget: json.UploadTargetResult{
+			TimeFrame:             int64(ut.Timeframe.Seconds()),
+			Target:                ut.Target,
+			TargetReached:         ut.TargetReached,
+			ServeHistoricalBlocks: ut.ServeHistoricalBlocks,
+			BytesLeftInCycle:      ut.BytesLeftInCycle,
+			TimeLeftInCycle:       int64(ut.TimeLeftInCycle.Seconds()),
+		},
+	}, nil
+}
+
 // Return the RPC info
 func (api *PublicBlockChainAPI) GetRpcInfo() (interface{}, error) {
 	rs := api.node.node.rpcServer.ReqStatus
@@ -195,20 +237,49 @@ func (api *PrivateBlockChainAPI) Stop() (interface{}, error) {
 func (api *PrivateBlockChainAPI) Banlist() (interface{}, error) {
 	bl := api.node.node.peerServer.GetBanlist()
 	bls := []*json.GetBanlistResult{}
-	for k, v := range bl {
-		bls = append(bls, &json.GetBanlistResult{Host: k, Expire: v.String()})
+	for _, v := range bl {
+		bls = append(bls, &json.GetBanlistResult{
+			Host:    v.Subnet,
+			Created: v.Created.String(),
+			Expire:  v.Until.String(),
+			Reason:  v.Reason,
+		})
 	}
 	return bls, nil
 }
 
-// RemoveBan
+// SetBan bans a subnet in CIDR notation or a single host for the duration in
+// seconds, the ban duration of the config by default.
+func (api *PrivateBlockChainAPI) SetBan(subnet string, duration *int64, reason *string) (interface{}, error) {
+	dur := connmgr.BanDuration
+	if duration != nil && *duration != 0 {
+		if *duration < 0 {
+			return nil, rpc.RpcInvalidError("The ban duration %d is negative", *duration)
+		}
+		dur = time.Duration(*duration) * time.Second
+	}
+	re := "manually banned"
+	if reason != nil && len(*reason) > 0 {
+		re = *reason
+	}
+	if err := api.node.node.peerServer.SetBan(subnet, dur, re); err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return true, nil
+}
+
+// RemoveBan removes the ban of a subnet or host, or all the bans when it isn't
+// given.
 func (api *PrivateBlockChainAPI) RemoveBan(host *string) (interface{}, error) {
 	ho := ""
 	if host != nil {
 		ho = *host
 	}
-	api.node.node.peerServer.RemoveBan(ho)
-	return true, nil
+	removed, err := api.node.node.peerServer.RemoveBan(ho)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return removed, nil
 }
 
 // SetRpcMaxClients
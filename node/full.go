@@ -5,7 +5,6 @@ import (
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
-	"github.com/Qitmeer/qitmeer/node/notify"
 	"github.com/Qitmeer/qitmeer/p2p/peerserver"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
@@ -26,7 +25,7 @@ type QitmeerFull struct {
 	// under node
 	node *Node
 	// msg notifier
-	nfManager notify.Notify
+	nfManager *notifymgr.NotifyMgr
 	// database
 	db database.DB
 	// account/wallet service
@@ -58,6 +57,7 @@ func (qm *QitmeerFull) Start(server *peerserver.PeerServer) error {
 
 	qm.blockManager.Start()
 	qm.txManager.Start()
+	qm.acctmanager.Start()
 	return nil
 }
 
@@ -70,6 +70,7 @@ func (qm *QitmeerFull) Stop() error {
 	qm.blockManager.WaitForStop()
 
 	qm.txManager.Stop()
+	qm.acctmanager.Stop()
 
 	log.Info("try stop cpu miner")
 	// Stop the CPU miner if needed.
@@ -86,18 +87,24 @@ func (qm *QitmeerFull) APIs() []rpc.API {
 	apis = append(apis, qm.cpuMiner.APIs()...)
 	apis = append(apis, qm.blockManager.API())
 	apis = append(apis, qm.txManager.APIs()...)
+	apis = append(apis, qm.nfManager.APIs()...)
 	apis = append(apis, qm.apis()...)
 	return apis
 }
 func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 
+	cfg := node.Config
+	nfManager := &notifymgr.NotifyMgr{Server: node.peerServer, RpcServer: node.rpcServer,
+		Params: node.Params}
+
 	// account manager
-	acctmgr, err := acct.New()
+	acctmgr, err := acct.New(cfg, node.Params, node.DB, nfManager)
 	if err != nil {
 		return nil, err
 	}
 	qm := QitmeerFull{
 		node:        node,
+		nfManager:   nfManager,
 		db:          node.DB,
 		acctmanager: acctmgr,
 		timeSource:  blockchain.NewMedianTime(),
@@ -105,10 +112,10 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 	}
 	// Create the transaction and address indexes if needed.
 	var indexes []index.Indexer
-	cfg := node.Config
 
 	var txIndex *index.TxIndex
 	var addrIndex *index.AddrIndex
+	var cfIndex *index.CfIndex
 	log.Info("Transaction index is enabled")
 	txIndex = index.NewTxIndex(qm.db)
 	indexes = append(indexes, txIndex)
@@ -117,14 +124,21 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 		addrIndex = index.NewAddrIndex(qm.db, node.Params)
 		indexes = append(indexes, addrIndex)
 	}
+	if !cfg.NoCFilters {
+		log.Info("Committed filter index is enabled")
+		cfIndex = index.NewCfIndex(qm.db)
+		indexes = append(indexes, cfIndex)
+	}
+	if cfg.Wallet {
+		log.Info("Wallet is enabled")
+		indexes = append(indexes, acctmgr.Index())
+	}
 	// index-manager
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
 		indexManager = index.NewManager(qm.db, indexes, node.Params)
 	}
 
-	qm.nfManager = &notifymgr.NotifyMgr{Server: node.peerServer, RpcServer: node.rpcServer}
-
 	// block-manager
 	bm, err := blkmgr.NewBlockManager(qm.nfManager, indexManager, node.DB, qm.timeSource, qm.sigCache, node.Config, node.Params,
 		mining.BlockVersion(node.Params.Net), node.quit)
@@ -132,6 +146,8 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 		return nil, err
 	}
 	qm.blockManager = bm
+	bm.SetCfIndex(cfIndex)
+	acctmgr.SetBlockManager(bm)
 
 	// txmanager
 	tm, err := tx.NewTxManager(bm, txIndex, addrIndex, cfg, qm.nfManager, qm.sigCache, node.DB)
@@ -140,10 +156,12 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 	}
 	qm.txManager = tm
 	bm.SetTxManager(tm)
+	bm.SetFeeEstimator(tm.FeeEstimator())
 	// prepare peerServer
 	node.peerServer.BlockManager = bm
 	node.peerServer.TimeSource = qm.timeSource
 	node.peerServer.TxMemPool = qm.txManager.MemPool().(*mempool.TxPool)
+	node.peerServer.CfIndex = cfIndex
 
 	// Cpu Miner
 	// Create the mining policy based on the configuration options.
@@ -165,6 +183,7 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 
 	qm.cpuMiner = miner.NewCPUMiner(cfg, node.Params, &policy, qm.sigCache,
 		qm.txManager.MemPool().(*mempool.TxPool), qm.timeSource, qm.blockManager, defaultNumWorkers)
+	qm.nfManager.LongPoll = qm.cpuMiner
 	// init address api
 	qm.addressApi = address.NewAddressApi(cfg, node.Params)
 	return &qm, nil
@@ -3,9 +3,11 @@ package node
 
 import (
 	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/p2p/peerserver"
 	"github.com/Qitmeer/qitmeer/rpc"
+	"github.com/Qitmeer/qitmeer/services/light"
 )
 
 // QitmeerLight implements the qitmeer light node service.
@@ -13,26 +15,46 @@ type QitmeerLight struct {
 	// database
 	db     database.DB
 	config *config.Config
+
+	// the synced block headers
+	headerChain *light.HeaderChain
+	// header sync with the full nodes
+	syncManager *light.SyncManager
 }
 
+// Start the light node.  The light node does not use the peer server since it
+// only makes outbound connections to full nodes, so the passed server is nil.
 func (light *QitmeerLight) Start(server *peerserver.PeerServer) error {
 	log.Debug("Starting Qitmeer light node service")
+	light.syncManager.Start()
 	return nil
 }
 
 func (light *QitmeerLight) Stop() error {
 	log.Debug("Stopping Qitmeer light node service")
-	return nil
+	return light.syncManager.Stop()
 }
 
 func (light *QitmeerLight) APIs() []rpc.API {
-	return []rpc.API{}
+	return []rpc.API{light.headerChain.API()}
 }
 
 func newQitmeerLight(n *Node) (*QitmeerLight, error) {
-	light := QitmeerLight{
+	ql := QitmeerLight{
 		config: n.Config,
 		db:     n.DB,
 	}
-	return &light, nil
+	timeSource := blockchain.NewMedianTime()
+	hc, err := light.NewHeaderChain(n.DB, n.Params, n.Config.DAGType, timeSource)
+	if err != nil {
+		return nil, err
+	}
+	ql.headerChain = hc
+
+	sm, err := light.NewSyncManager(n.Config, n.Params, hc, timeSource)
+	if err != nil {
+		return nil, err
+	}
+	ql.syncManager = sm
+	return &ql, nil
 }
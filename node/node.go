@@ -55,12 +55,17 @@ func NewNode(cfg *config.Config, database database.DB, chainParams *params.Param
 		quit:   make(chan struct{}),
 	}
 
-	server, err := peerserver.NewPeerServer(cfg, chainParams)
-	if err != nil {
-		return nil, err
+	// The light node only makes outbound connections to full nodes and does
+	// not serve any peer.
+	if !cfg.LightNode {
+		server, err := peerserver.NewPeerServer(cfg, chainParams)
+		if err != nil {
+			return nil, err
+		}
+		n.peerServer = server
 	}
-	n.peerServer = server
 
+	var err error
 	if !cfg.DisableRPC {
 		n.rpcServer, err = rpc.NewRPCServer(cfg)
 		if err != nil {
@@ -81,7 +86,9 @@ func (n *Node) Stop() error {
 	// stop rpc server
 	n.rpcServer.Stop()
 	// stop p2p server
-	n.peerServer.Stop()
+	if n.peerServer != nil {
+		n.peerServer.Stop()
+	}
 
 	failure := &ServiceStopError{
 		Services: make(map[reflect.Type]error),
@@ -155,8 +162,10 @@ func (n *Node) Start() error {
 	n.runningSvcs = services
 
 	// start p2p server
-	if err := n.peerServer.Start(); err != nil {
-		return err
+	if n.peerServer != nil {
+		if err := n.peerServer.Start(); err != nil {
+			return err
+		}
 	}
 	// start RPC by service
 	if !n.Config.DisableRPC {
@@ -164,7 +173,9 @@ func (n *Node) Start() error {
 			for _, service := range services {
 				service.Stop()
 			}
-			n.peerServer.Stop()
+			if n.peerServer != nil {
+				n.peerServer.Stop()
+			}
 			return err
 		}
 	}
@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 )
@@ -11,4 +12,6 @@ type Notify interface {
 	AnnounceNewTransactions(newTxs []*types.TxDesc)
 	RelayInventory(invVect *message.InvVect, data interface{})
 	BroadcastMessage(msg message.Message)
+	NotifyBlockConnected(block *types.SerializedBlock)
+	NotifyReorganization(rd *blockchain.ReorganizationNotifyData)
 }
@@ -14,6 +14,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/common/network"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
@@ -651,22 +652,30 @@ func (a *AddrManager) reset() {
 
 // HostToNetAddress returns a netaddress given a host address. If the address is
 // a Tor .onion address this will be taken care of. Else if the host is not an
-// IP address it will be resolved (via Tor if required).
+// IP address it will be resolved, or kept as is when the address manager has
+// no lookup function because the names are resolved by a proxy.
+//
+// The version 2 onion addresses are mapped to the OnionCat range, the version 3
+// ones don't fit in an IP and are kept as the host of the netaddress.
 func (a *AddrManager) HostToNetAddress(host string, port uint16, services protocol.ServiceFlag) (*types.NetAddress, error) {
-	// Tor address is 16 char base32 + ".onion"
 	var ip net.IP
-	if len(host) == 22 && host[16:] == ".onion" {
-		// go base32 encoding uses capitals (as does the rfc
-		// but Tor and bitcoind tend to user lowercase, so we switch
-		// case here.
-		data, err := base32.StdEncoding.DecodeString(
-			strings.ToUpper(host[:16]))
+	if network.IsOnionHost(host) {
+		version, data, err := network.ParseOnionHost(host)
 		if err != nil {
 			return nil, err
 		}
-		prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
-		ip = net.IP(append(prefix, data...))
+		if version == 3 {
+			na := types.NewNetAddressIPPort(nil, port, services)
+			na.Host = strings.ToLower(host)
+			return na, nil
+		}
+		ip = net.IP(append(append([]byte{}, network.OnionCatPrefix...), data...))
 	} else if ip = net.ParseIP(host); ip == nil {
+		if a.lookupFunc == nil {
+			na := types.NewNetAddressIPPort(nil, port, services)
+			na.Host = host
+			return na, nil
+		}
 		ips, err := a.lookupFunc(host)
 		if err != nil {
 			return nil, err
@@ -682,8 +691,12 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services protoc
 
 // ipString returns a string for the ip from the provided NetAddress. If the
 // ip is in the range used for Tor addresses then it will be transformed into
-// the relevant .onion address.
+// the relevant .onion address.  The host is returned for the addresses without
+// IP.
 func ipString(na *types.NetAddress) string {
+	if na.Host != "" {
+		return na.Host
+	}
 	if isOnionCatTor(na) {
 		// We know now that na.IP is long enogh.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
@@ -907,6 +920,19 @@ func (a *AddrManager) Good(addr *types.NetAddress) {
 	a.addrNew[newBucket][rmkey] = rmka
 }
 
+// Services returns the services advertised by the given address, or 0 when the
+// address is unknown.
+func (a *AddrManager) Services(addr *types.NetAddress) protocol.ServiceFlag {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	ka := a.find(addr)
+	if ka == nil {
+		return 0
+	}
+	return ka.NetAddress().Services
+}
+
 // SetServices sets the services for the giiven address to the provided value.
 func (a *AddrManager) SetServices(addr *types.NetAddress, services protocol.ServiceFlag) {
 	a.mtx.Lock()
@@ -932,7 +958,7 @@ func (a *AddrManager) SetServices(addr *types.NetAddress, services protocol.Serv
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *types.NetAddress, priority AddressPriority) error {
 	if !IsRoutable(na) {
-		return fmt.Errorf("address %s is not routable", na.IP)
+		return fmt.Errorf("address %s is not routable", ipString(na))
 	}
 
 	a.lamtx.Lock()
@@ -970,8 +996,8 @@ func getReachabilityFrom(localAddr, remoteAddr *types.NetAddress) int {
 		return Unreachable
 	}
 
-	if isOnionCatTor(remoteAddr) {
-		if isOnionCatTor(localAddr) {
+	if isTor(remoteAddr) {
+		if isTor(localAddr) {
 			return Private
 		}
 
@@ -1059,7 +1085,7 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *types.NetAddress) *types.N
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !isIPv4(remoteAddr) && !isOnionCatTor(remoteAddr) {
+		if !isIPv4(remoteAddr) && !isTor(remoteAddr) {
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
@@ -1072,7 +1098,8 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *types.NetAddress) *types.N
 
 // New returns a new address manager.
 // Use Start to begin processing asynchronous address updates.
-// The address manager uses lookupFunc for necessary DNS lookups.
+// The address manager uses lookupFunc for necessary DNS lookups, the host names
+// are kept as is when it is nil.
 func New(dataDir string, getAddrPer int, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
 	if getAddrPer <= 0 {
 		getAddrPer = getAddrPercent
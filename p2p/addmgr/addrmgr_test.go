@@ -0,0 +1,144 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addmgr
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/network"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_HostToNetAddress(t *testing.T) {
+	lookups := 0
+	lookup := func(host string) ([]net.IP, error) {
+		lookups++
+		return []net.IP{net.ParseIP("1.2.3.4")}, nil
+	}
+	v3Host := network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32))
+
+	tests := []struct {
+		host    string
+		lookup  func(string) ([]net.IP, error)
+		key     string
+		network string
+	}{
+		{"8.8.8.8", lookup, "8.8.8.8:8130", IPv4Net},
+		{"2001:4860::8888", lookup, "[2001:4860::8888]:8130", IPv6Net},
+		{"expyuzz4wqqyqhjn.onion", lookup, "expyuzz4wqqyqhjn.onion:8130",
+			OnionNet},
+		{strings.ToUpper(v3Host), lookup, v3Host + ":8130", OnionNet},
+		{"seed.example.com", lookup, "1.2.3.4:8130", IPv4Net},
+		{"seed.example.com", nil, "seed.example.com:8130", IPv6Net},
+	}
+	for _, test := range tests {
+		a := New("", 0, test.lookup)
+		na, err := a.HostToNetAddress(test.host, 8130, protocol.Full)
+		if err != nil {
+			t.Errorf("%s: %v", test.host, err)
+			continue
+		}
+		if key := NetAddressKey(na); key != test.key {
+			t.Errorf("%s: key %s, want %s", test.host, key, test.key)
+		}
+		if n := AddrNetwork(na); n != test.network {
+			t.Errorf("%s: network %s, want %s", test.host, n, test.network)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("%d lookups, want 1", lookups)
+	}
+
+	a := New("", 0, lookup)
+	if _, err := a.HostToNetAddress("expyuzz4wqqyqhj1.onion", 8130,
+		protocol.Full); err == nil {
+		t.Error("invalid onion host converted")
+	}
+}
+
+func Test_OnionV3RoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "addmgr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := New(dir, 100, nil)
+	src := types.NewNetAddressIPPort(net.ParseIP("8.8.8.8"), 8130, protocol.Full)
+	v3Host := network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32))
+	var onion *types.NetAddress
+	for _, host := range []string{v3Host, "seed.example.com"} {
+		na, err := a.HostToNetAddress(host, 8130, protocol.Full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.AddAddress(na, src)
+		if onion == nil {
+			onion = na
+		}
+	}
+	// Only the version 3 onion is stored, the other host names can't be
+	// relayed.
+	if n := a.numAddresses(); n != 1 {
+		t.Fatalf("%d addresses, want the version 3 onion", n)
+	}
+	a.Good(onion)
+	cache := a.AddressCache()
+	if len(cache) != 1 || cache[0].Host != v3Host {
+		t.Fatalf("address cache %v, want the version 3 onion", cache)
+	}
+
+	// The onion is relayed through the addr message to another address
+	// manager.
+	msg := message.NewMsgAddr()
+	msg.AddAddresses(cache...)
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, protocol.AddrV2Version); err != nil {
+		t.Fatal(err)
+	}
+	var decoded message.MsgAddr
+	if err := decoded.Decode(&buf, protocol.AddrV2Version); err != nil {
+		t.Fatal(err)
+	}
+	b := New(dir, 0, nil)
+	b.AddAddresses(decoded.AddrList, src)
+	ka := b.GetAddress()
+	if ka == nil || NetAddressKey(ka.NetAddress()) != v3Host+":8130" {
+		t.Fatalf("address %v relayed, want %s", ka, v3Host)
+	}
+	if n := AddrNetwork(ka.NetAddress()); n != OnionNet {
+		t.Errorf("network %s, want %s", n, OnionNet)
+	}
+
+	// It is saved with the peers and loaded again.
+	b.savePeers()
+	c := New(dir, 0, nil)
+	c.loadPeers()
+	if ka := c.GetAddress(); ka == nil || ka.NetAddress().Host != v3Host {
+		t.Fatalf("address %v loaded, want %s", ka, v3Host)
+	}
+
+	// A local onion is advertised to the peers of tor.
+	local, err := c.HostToNetAddress(v3Host, 8130, protocol.Full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddLocalAddress(local, ManualPrio); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := c.HostToNetAddress("expyuzz4wqqyqhjn.onion", 8130, protocol.Full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best := c.GetBestLocalAddress(remote); best.Host != v3Host {
+		t.Fatalf("best local address %v, want %s", best, v3Host)
+	}
+}
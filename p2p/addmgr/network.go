@@ -8,6 +8,7 @@ package addmgr
 
 import (
 	"fmt"
+	"github.com/Qitmeer/qitmeer/common/network"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"net"
 )
@@ -108,6 +109,22 @@ func isIPv4(na *types.NetAddress) bool {
 	return na.IP.To4() != nil
 }
 
+// isOnionV3 returns whether or not the passed address is a version 3 tor
+// hidden service, which has a host rather than an IP.
+func isOnionV3(na *types.NetAddress) bool {
+	if na.IP != nil || na.Host == "" {
+		return false
+	}
+	version, _, err := network.ParseOnionHost(na.Host)
+	return err == nil && version == 3
+}
+
+// isTor returns whether or not the passed address is a tor hidden service of
+// any version.
+func isTor(na *types.NetAddress) bool {
+	return isOnionCatTor(na) || isOnionV3(na)
+}
+
 // isLocal returns whether or not the given address is a local address.
 func isLocal(na *types.NetAddress) bool {
 	return na.IP.IsLoopback() || zero4Net.Contains(na.IP)
@@ -121,6 +138,28 @@ func isOnionCatTor(na *types.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// The networks of the addresses, as named by the onlynet option.
+const (
+	IPv4Net  = "ipv4"
+	IPv6Net  = "ipv6"
+	OnionNet = "onion"
+)
+
+// AddrNetwork returns the network of the given address, the Tor addresses are
+// in the onion network rather than the IPv6 one.
+func AddrNetwork(na *types.NetAddress) string {
+	if network.IsOnionHost(na.Host) {
+		return OnionNet
+	}
+	if isIPv4(na) {
+		return IPv4Net
+	}
+	if isOnionCatTor(na) {
+		return OnionNet
+	}
+	return IPv6Net
+}
+
 // isRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -225,8 +264,12 @@ func isValid(na *types.NetAddress) bool {
 
 // IsRoutable returns whether or not the passed address is routable over
 // the public internet.  This is true as long as the address is valid and is not
-// in any reserved ranges.
+// in any reserved ranges.  The only addresses without IP which are routable are
+// the version 3 tor hidden services.
 func IsRoutable(na *types.NetAddress) bool {
+	if na.Host != "" {
+		return isOnionV3(na)
+	}
 	return isValid(na) && !(isRFC1918(na) || isRFC2544(na) ||
 		isRFC3927(na) || isRFC4862(na) || isRFC3849(na) ||
 		isRFC4843(na) || isRFC5737(na) || isRFC6598(na) ||
@@ -245,6 +288,11 @@ func GroupKey(na *types.NetAddress) string {
 	if !IsRoutable(na) {
 		return "unroutable"
 	}
+	if isOnionV3(na) {
+		// group is keyed off the first 4 bits of the key of the service.
+		_, key, _ := network.ParseOnionHost(na.Host)
+		return fmt.Sprintf("tor:%d", key[0]&((1<<4)-1))
+	}
 	if isIPv4(na) {
 		return na.IP.Mask(net.CIDRMask(16, 32)).String()
 	}
@@ -0,0 +1,185 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/network"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/p2p/addmgr"
+	"net"
+	"strconv"
+	"time"
+)
+
+// HostAddr is the address of a peer which is not resolved locally, a tor
+// hidden service or a host name resolved by the proxy.  It is kept as is until
+// the proxy connects to it.
+type HostAddr struct {
+	addr string
+}
+
+// NewHostAddr returns the address of the passed 'host:port', which isn't
+// resolved.
+func NewHostAddr(addr string) *HostAddr {
+	return &HostAddr{addr: addr}
+}
+
+// Network returns the network of the address.
+func (h *HostAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address in the form of 'host:port'.
+func (h *HostAddr) String() string {
+	return h.addr
+}
+
+func isOnionHost(host string) bool {
+	return network.IsOnionHost(host)
+}
+
+// Dialer connects to the peers and resolves their host names.  When proxies are
+// configured, it goes through them so that the node doesn't reveal its IP nor
+// leak its lookups.
+type Dialer struct {
+	proxy      *network.Proxy
+	onionProxy *network.Proxy
+	onlyNet    []string
+	timeout    time.Duration
+}
+
+// NewDialer returns the dialer of the proxies of the configuration, the
+// connections which aren't set up within timeout fail.
+func NewDialer(cfg *config.Config, timeout time.Duration) *Dialer {
+	d := Dialer{
+		onlyNet: cfg.OnlyNet,
+		timeout: timeout,
+	}
+	if cfg.Proxy != "" {
+		d.proxy = &network.Proxy{
+			Addr:         cfg.Proxy,
+			Username:     cfg.ProxyUser,
+			Password:     cfg.ProxyPass,
+			TorIsolation: cfg.TorIsolation,
+		}
+	}
+	if cfg.OnionProxy != "" {
+		d.onionProxy = &network.Proxy{
+			Addr:         cfg.OnionProxy,
+			Username:     cfg.OnionProxyUser,
+			Password:     cfg.OnionProxyPass,
+			TorIsolation: cfg.TorIsolation,
+		}
+	} else {
+		d.onionProxy = d.proxy
+	}
+	if cfg.NoOnion {
+		d.onionProxy = nil
+	}
+	return &d
+}
+
+// Dial connects to the address on the named network, the tor hidden services
+// through the onion proxy and the others through the proxy if it is set.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if isOnionHost(host) {
+		if d.onionProxy == nil {
+			return nil, fmt.Errorf("no onion proxy to connect to %s", addr)
+		}
+		return d.onionProxy.DialTimeout("tcp", addr, d.timeout)
+	}
+	if d.proxy != nil {
+		return d.proxy.DialTimeout("tcp", addr, d.timeout)
+	}
+	return net.DialTimeout(network, addr, d.timeout)
+}
+
+// LookupFunc returns the function resolving the host names, such as for the
+// DNS seeding.  It is nil behind a proxy, the names are then sent to the proxy
+// so that no lookup leaks to the local resolver.
+func (d *Dialer) LookupFunc() LookupFunc {
+	if d.proxy != nil {
+		return nil
+	}
+	return net.LookupIP
+}
+
+// ResolveAddr takes an address in the form of 'host:port' and returns a
+// net.Addr which maps to the original address with any host names resolved
+// to IP addresses.  The tor hidden services, and the host names behind a
+// proxy, are returned as is.
+func (d *Dialer) ResolveAddr(addr string) (net.Addr, error) {
+	host, strPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(strPort)
+	if err != nil {
+		return nil, err
+	}
+
+	if isOnionHost(host) {
+		return NewHostAddr(addr), nil
+	}
+
+	// Skip if host is already an IP address.
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.TCPAddr{
+			IP:   ip,
+			Port: port,
+		}, nil
+	}
+
+	lookup := d.LookupFunc()
+	if lookup == nil {
+		return NewHostAddr(addr), nil
+	}
+
+	// Attempt to look up an IP address associated with the parsed host.
+	ips, err := lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	return &net.TCPAddr{
+		IP:   ips[0],
+		Port: port,
+	}, nil
+}
+
+// IsReachable returns whether the peers of the address are connected to
+// automatically: the onion addresses need an onion proxy, and the network of
+// the address must be one of the onlynet option when it is given.
+func (d *Dialer) IsReachable(na *types.NetAddress) bool {
+	addrNet := addmgr.AddrNetwork(na)
+	if addrNet == addmgr.OnionNet && d.onionProxy == nil {
+		return false
+	}
+	if len(d.onlyNet) == 0 {
+		return true
+	}
+	for _, n := range d.onlyNet {
+		if n == addrNet {
+			return true
+		}
+	}
+	return false
+}
+
+// HidesIP returns whether the clearnet connections go through the proxy, in
+// which case the node shouldn't advertise its own IP.
+func (d *Dialer) HidesIP() bool {
+	return d.proxy != nil
+}
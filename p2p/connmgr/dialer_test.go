@@ -0,0 +1,196 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/network"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newProxy starts a SOCKS5 proxy which sends the host names of the connect
+// requests it gets on the returned channel, and then refuses them.
+func newProxy(t *testing.T) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil {
+					return
+				}
+				// Only the domain names are expected.
+				n := int(buf[4])
+				if buf[3] != 3 {
+					hosts <- ""
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:n+2]); err != nil {
+					return
+				}
+				hosts <- string(buf[:n])
+				conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			}(conn)
+		}
+	}()
+	return listener, hosts
+}
+
+func Test_DialerResolveAddr(t *testing.T) {
+	direct := NewDialer(&config.Config{}, time.Second)
+	proxied := NewDialer(&config.Config{Proxy: "127.0.0.1:9050"}, time.Second)
+	if direct.LookupFunc() == nil {
+		t.Fatal("no lookup without a proxy")
+	}
+	if proxied.LookupFunc() != nil {
+		t.Fatal("lookup behind a proxy")
+	}
+
+	v3Addr := network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32)) + ":8130"
+	tests := []struct {
+		dialer *Dialer
+		addr   string
+		host   bool
+	}{
+		{direct, "8.8.8.8:8130", false},
+		{direct, "[2001:4860::8888]:8130", false},
+		{direct, "localhost:8130", false},
+		{direct, "expyuzz4wqqyqhjn.onion:8130", true},
+		{direct, v3Addr, true},
+		{proxied, "8.8.8.8:8130", false},
+		{proxied, "seed.example.com:8130", true},
+		{proxied, v3Addr, true},
+	}
+	for _, test := range tests {
+		addr, err := test.dialer.ResolveAddr(test.addr)
+		if err != nil {
+			t.Errorf("%s: %v", test.addr, err)
+			continue
+		}
+		_, isHost := addr.(*HostAddr)
+		if isHost != test.host {
+			t.Errorf("%s: resolved to %T", test.addr, addr)
+			continue
+		}
+		if isHost && addr.String() != test.addr {
+			t.Errorf("%s: resolved to %s", test.addr, addr)
+		}
+	}
+}
+
+func Test_DialerProxies(t *testing.T) {
+	proxyListener, proxyHosts := newProxy(t)
+	defer proxyListener.Close()
+	onionListener, onionHosts := newProxy(t)
+	defer onionListener.Close()
+	proxy := proxyListener.Addr().String()
+	onionProxy := onionListener.Addr().String()
+	v3Host := network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32))
+
+	d := NewDialer(&config.Config{Proxy: proxy, OnionProxy: onionProxy},
+		time.Second)
+	tests := []struct {
+		addr  string
+		hosts chan string
+	}{
+		{"seed.example.com:8130", proxyHosts},
+		{v3Host + ":8130", onionHosts},
+		{"expyuzz4wqqyqhjn.onion:8130", onionHosts},
+	}
+	for _, test := range tests {
+		host, _, _ := net.SplitHostPort(test.addr)
+		if _, err := d.Dial("tcp", test.addr); err == nil {
+			t.Errorf("%s: refused connection succeeded", test.addr)
+		}
+		select {
+		case got := <-test.hosts:
+			if got != host {
+				t.Errorf("%s: proxy got %q", test.addr, got)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: not sent to the expected proxy", test.addr)
+		}
+	}
+
+	// The onions go through the proxy when there is no onion proxy, but
+	// never when tor is disabled.
+	d = NewDialer(&config.Config{Proxy: proxy}, time.Second)
+	d.Dial("tcp", v3Host+":8130")
+	if got := <-proxyHosts; got != v3Host {
+		t.Errorf("proxy got %q", got)
+	}
+	d = NewDialer(&config.Config{Proxy: proxy, NoOnion: true}, time.Second)
+	if _, err := d.Dial("tcp", v3Host+":8130"); err == nil {
+		t.Error("onion dialed without onion proxy")
+	}
+	d = NewDialer(&config.Config{}, time.Second)
+	if _, err := d.Dial("tcp", v3Host+":8130"); err == nil {
+		t.Error("onion dialed without proxy")
+	}
+}
+
+func Test_DialerIsReachable(t *testing.T) {
+	ipv4 := types.NewNetAddressIPPort(net.ParseIP("8.8.8.8"), 8130,
+		protocol.Full)
+	ipv6 := types.NewNetAddressIPPort(net.ParseIP("2001:4860::8888"), 8130,
+		protocol.Full)
+	onionCat := types.NewNetAddressIPPort(
+		net.ParseIP("fd87:d87e:eb43:25df:8a67:3cb4:2188:1d2d"), 8130,
+		protocol.Full)
+	v3 := types.NewNetAddressIPPort(nil, 8130, protocol.Full)
+	v3.Host = network.OnionV3Host(bytes.Repeat([]byte{0x5a}, 32))
+
+	tests := []struct {
+		cfg       config.Config
+		reachable [4]bool // ipv4, ipv6, onioncat, v3
+	}{
+		{config.Config{}, [4]bool{true, true, false, false}},
+		{config.Config{OnionProxy: "127.0.0.1:9050"},
+			[4]bool{true, true, true, true}},
+		{config.Config{Proxy: "127.0.0.1:9050", NoOnion: true},
+			[4]bool{true, true, false, false}},
+		{config.Config{OnlyNet: []string{"ipv4"}},
+			[4]bool{true, false, false, false}},
+		{config.Config{OnlyNet: []string{"ipv6"}},
+			[4]bool{false, true, false, false}},
+		{config.Config{OnionProxy: "127.0.0.1:9050",
+			OnlyNet: []string{"onion"}}, [4]bool{false, false, true, true}},
+		{config.Config{OnlyNet: []string{"onion"}},
+			[4]bool{false, false, false, false}},
+		{config.Config{Proxy: "127.0.0.1:9050",
+			OnlyNet: []string{"ipv4", "onion"}},
+			[4]bool{true, false, true, true}},
+	}
+	for i, test := range tests {
+		d := NewDialer(&test.cfg, time.Second)
+		for j, na := range []*types.NetAddress{ipv4, ipv6, onionCat, v3} {
+			if got := d.IsReachable(na); got != test.reachable[j] {
+				t.Errorf("test %d address %d: reachable %v", i, j, got)
+			}
+		}
+	}
+}
@@ -27,6 +27,10 @@ const (
 	// precomputedLen defines the amount of decay factors (one per second) that
 	// should be precomputed at initialization.
 	precomputedLen = 64
+
+	// maxBanReasons defines the amount of reasons of the last increases
+	// which are kept.
+	maxBanReasons = 8
 )
 
 // precomputedFactor stores precomputed exponential decay factors for the first
@@ -65,6 +69,7 @@ type DynamicBanScore struct {
 	lastUnix   int64
 	transient  float64
 	persistent uint32
+	reasons    []string
 	mtx        sync.Mutex
 }
 
@@ -89,12 +94,28 @@ func (s *DynamicBanScore) Int() uint32 {
 }
 
 // Increase increases both the persistent and decaying scores by the values
-// passed as parameters. The resulting score is returned.
+// passed as parameters and records the reason of the increase. The resulting
+// score is returned.
 //
 // This function is safe for concurrent access.
-func (s *DynamicBanScore) Increase(persistent, transient uint32) uint32 {
+func (s *DynamicBanScore) Increase(persistent, transient uint32, reason string) uint32 {
 	s.mtx.Lock()
 	r := s.increase(persistent, transient, time.Now())
+	if len(s.reasons) == maxBanReasons {
+		s.reasons = s.reasons[1:]
+	}
+	s.reasons = append(s.reasons, reason)
+	s.mtx.Unlock()
+	return r
+}
+
+// Reasons returns the reasons of the last increases, the oldest first.
+//
+// This function is safe for concurrent access.
+func (s *DynamicBanScore) Reasons() []string {
+	s.mtx.Lock()
+	r := make([]string, len(s.reasons))
+	copy(r, s.reasons)
 	s.mtx.Unlock()
 	return r
 }
@@ -107,6 +128,7 @@ func (s *DynamicBanScore) Reset() {
 	s.persistent = 0
 	s.transient = 0
 	s.lastUnix = 0
+	s.reasons = nil
 	s.mtx.Unlock()
 }
 
@@ -73,3 +73,14 @@ func SeedFromDNS(chainParams *params.Params, reqServices protocol.ServiceFlag, l
 		}(host)
 	}
 }
+
+// SeedFromProxy connects once to each DNS seed through connect, in place of
+// SeedFromDNS when the host names are resolved by a proxy.  The proxy resolves
+// a seed to one of its nodes, which is then asked for addresses like any
+// outbound peer.
+func SeedFromProxy(chainParams *params.Params, connect func(addr net.Addr)) {
+	for _, dnsseed := range chainParams.DNSSeeds {
+		connect(NewHostAddr(net.JoinHostPort(dnsseed.Host,
+			chainParams.DefaultPort)))
+	}
+}
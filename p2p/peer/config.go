@@ -118,4 +118,10 @@ type Config struct {
 	// TrickleInterval is the duration of the ticker which trickles down the
 	// inventory to a peer.
 	TrickleInterval time.Duration
+
+	// V2Transport specifies whether to use the encrypted v2 transport.  An
+	// inbound peer accepts both transports, an outbound peer initiates the
+	// v2 handshake so it should only be set when the remote peer is known
+	// to support it.
+	V2Transport bool
 }
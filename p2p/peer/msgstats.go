@@ -0,0 +1,62 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package peer
+
+import (
+	"github.com/Qitmeer/qitmeer/core/message"
+	"sync"
+)
+
+// OtherCmd is the command under which the bytes of the messages which failed
+// to be read are counted.
+const OtherCmd = "*other*"
+
+// MsgStats counts the messages of a command and their bytes, header included.
+type MsgStats struct {
+	Msgs  uint64
+	Bytes uint64
+}
+
+// msgStats keeps the MsgStats of each command in one direction.
+type msgStats struct {
+	mtx  sync.Mutex
+	cmds map[string]*MsgStats
+}
+
+// add counts a message of n bytes, msg is nil when it couldn't be read.
+func (ms *msgStats) add(msg message.Message, n int) {
+	if n <= 0 {
+		return
+	}
+	cmd := OtherCmd
+	if msg != nil {
+		cmd = msg.Command()
+	}
+
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	if ms.cmds == nil {
+		ms.cmds = make(map[string]*MsgStats)
+	}
+	stats, ok := ms.cmds[cmd]
+	if !ok {
+		stats = &MsgStats{}
+		ms.cmds[cmd] = stats
+	}
+	stats.Msgs++
+	stats.Bytes += uint64(n)
+}
+
+// snapshot returns a copy of the stats by command.
+func (ms *msgStats) snapshot() map[string]MsgStats {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	result := make(map[string]MsgStats, len(ms.cmds))
+	for cmd, stats := range ms.cmds {
+		result[cmd] = *stats
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package peer
+
+import (
+	"github.com/Qitmeer/qitmeer/core/message"
+	"testing"
+)
+
+func Test_MsgStats(t *testing.T) {
+	var ms msgStats
+	if stats := ms.snapshot(); len(stats) != 0 {
+		t.Fatalf("stats before any message: %v", stats)
+	}
+
+	ms.add(message.NewMsgPing(1), 32)
+	ms.add(message.NewMsgPing(2), 32)
+	ms.add(message.NewMsgPong(1), 32)
+	ms.add(message.NewMsgVerAck(), 24)
+	ms.add(nil, 7)
+	ms.add(nil, 3)
+	// Nothing was read.
+	ms.add(message.NewMsgVerAck(), 0)
+	ms.add(nil, -1)
+
+	stats := ms.snapshot()
+	want := map[string]MsgStats{
+		message.CmdPing:   {Msgs: 2, Bytes: 64},
+		message.CmdPong:   {Msgs: 1, Bytes: 32},
+		message.CmdVerAck: {Msgs: 1, Bytes: 24},
+		OtherCmd:          {Msgs: 2, Bytes: 10},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("stats of %d commands, want %d", len(stats), len(want))
+	}
+	for cmd, s := range want {
+		if stats[cmd] != s {
+			t.Errorf("%s: %+v, want %+v", cmd, stats[cmd], s)
+		}
+	}
+
+	// The snapshot is a copy.
+	ms.add(message.NewMsgPing(3), 32)
+	if stats[message.CmdPing].Msgs != 2 || ms.snapshot()[message.CmdPing].Msgs != 3 {
+		t.Fatal("snapshot changed with the stats")
+	}
+}
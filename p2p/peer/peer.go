@@ -15,6 +15,7 @@ import (
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/services/bloom"
 	"github.com/satori/go.uuid"
 	"math/rand"
 	"net"
@@ -33,6 +34,8 @@ type StatsSnap struct {
 	LastRecv       time.Time
 	BytesSent      uint64
 	BytesRecv      uint64
+	SentPerMsg     map[string]MsgStats
+	RecvPerMsg     map[string]MsgStats
 	ConnTime       time.Time
 	TimeOffset     int64
 	Version        uint32
@@ -42,6 +45,7 @@ type StatsSnap struct {
 	LastPingTime   time.Time
 	LastPingMicros int64
 	GraphState     *blockdag.GraphState
+	Transport      string
 }
 
 // ID returns the peer id.
@@ -147,7 +151,10 @@ func (p *Peer) AssociateConnection(c *connmgr.ConnReq) {
 	go func(peer *Peer) {
 		if err := peer.start(); err != nil {
 			log.Debug("Cannot start peer", "peer", peer.addr, "error", err)
-			c.Ban = true
+			// An old peer failing the v2 handshake isn't misbehaving.
+			if err != ErrV2Handshake {
+				c.Ban = true
+			}
 			peer.Disconnect()
 		}
 	}(p)
@@ -177,9 +184,20 @@ func (p *Peer) QueueMessage(msg message.Message, doneChan chan<- struct{}) {
 // number allowed by the message and randomizes the chosen addresses when there
 // are too many.  It returns the addresses that were actually sent and no
 // message will be sent if there are no entries in the provided addresses slice.
+// The addresses without IP are only sent to the peers which support the
+// protocol version AddrV2Version.
 //
 // This function is safe for concurrent access.
 func (p *Peer) PushAddrMsg(addresses []*types.NetAddress) ([]*types.NetAddress, error) {
+	if p.ProtocolVersion() < protocol.AddrV2Version {
+		ipAddresses := make([]*types.NetAddress, 0, len(addresses))
+		for _, na := range addresses {
+			if na.IP != nil {
+				ipAddresses = append(ipAddresses, na)
+			}
+		}
+		addresses = ipAddresses
+	}
 
 	// Nothing to send.
 	if len(addresses) == 0 {
@@ -340,6 +358,29 @@ func (p *Peer) UserAgent() string {
 	return userAgent
 }
 
+// Transport returns the transport of the messages, TransportV1 or TransportV2.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Transport() string {
+	p.flagsMtx.Lock()
+	transport := p.transport
+	p.flagsMtx.Unlock()
+
+	return transport
+}
+
+// V2Failed returns whether the remote peer failed the v2 handshake initiated
+// by this outbound peer, it should be connected again with the v1 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2Failed() bool {
+	p.flagsMtx.Lock()
+	v2Failed := p.v2Failed
+	p.flagsMtx.Unlock()
+
+	return v2Failed
+}
+
 // Services returns the services flag of the remote peer.
 //
 // This function is safe for concurrent access.
@@ -410,6 +451,14 @@ func (p *Peer) AddKnownInventory(invVect *message.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *message.InvVect) bool {
+	return p.knownInventory.Exists(invVect)
+}
+
 // UpdateLastGS updates the last known graph state for the peer.
 //
 // This function is safe for concurrent access.
@@ -447,6 +496,38 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// SupportsCmpctBlocks returns if the peer sent a sendcmpct message of a known
+// version, in which case the blocks can be requested as compact blocks.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SupportsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	sendCmpct := p.sendCmpct
+	p.flagsMtx.Unlock()
+
+	return sendCmpct
+}
+
+// WantsCmpctBlocks returns if the peer asked for the high bandwidth mode, in
+// which the new blocks are sent as compact blocks without announcing them.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	wants := p.sendCmpct && p.cmpctHighBandwidth
+	p.flagsMtx.Unlock()
+
+	return wants
+}
+
+// Filter returns the bloom filter loaded by the remote peer.  The filter is
+// not loaded until the peer sends a filterload message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Filter() *bloom.Filter {
+	return p.filter
+}
+
 // QueueInventory adds the passed inventory to the inventory send queue which
 // might not be sent right away, rather it is trickled to the peer in batches.
 // Inventory that the peer is already known to have is ignored.
@@ -567,6 +648,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	userAgent := p.userAgent
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
+	transport := p.transport
 	p.flagsMtx.Unlock()
 
 	// Get a copy of all relevant flags and stats.
@@ -580,6 +662,8 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastRecv:       p.LastRecv(),
 		BytesSent:      p.BytesSent(),
 		BytesRecv:      p.BytesReceived(),
+		SentPerMsg:     p.sentMsgStats.snapshot(),
+		RecvPerMsg:     p.recvMsgStats.snapshot(),
 		ConnTime:       p.timeConnected,
 		TimeOffset:     p.timeOffset,
 		Version:        protocolVersion,
@@ -588,6 +672,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
 		GraphState:     p.lastGS,
+		Transport:      transport,
 	}
 
 	p.statsMtx.RUnlock()
@@ -177,42 +177,89 @@ out:
 			if p.cfg.Listeners.OnFeeFilter != nil {
 				p.cfg.Listeners.OnFeeFilter(p, msg)
 			}
-		/*
-			case *message.MsgHeaders:
-				if p.cfg.Listeners.OnHeaders != nil {
-					p.cfg.Listeners.OnHeaders(p, msg)
-				}
 
-			case *message.MsgGetCFilter:
-				if p.cfg.Listeners.OnGetCFilter != nil {
-					p.cfg.Listeners.OnGetCFilter(p, msg)
-				}
+		case *message.MsgGetCFilter:
+			if p.cfg.Listeners.OnGetCFilter != nil {
+				p.cfg.Listeners.OnGetCFilter(p, msg)
+			}
 
-			case *message.MsgGetCFHeaders:
-				if p.cfg.Listeners.OnGetCFHeaders != nil {
-					p.cfg.Listeners.OnGetCFHeaders(p, msg)
-				}
+		case *message.MsgGetCFHeaders:
+			if p.cfg.Listeners.OnGetCFHeaders != nil {
+				p.cfg.Listeners.OnGetCFHeaders(p, msg)
+			}
 
-			case *message.MsgGetCFTypes:
-				if p.cfg.Listeners.OnGetCFTypes != nil {
-					p.cfg.Listeners.OnGetCFTypes(p, msg)
-				}
+		case *message.MsgGetCFTypes:
+			if p.cfg.Listeners.OnGetCFTypes != nil {
+				p.cfg.Listeners.OnGetCFTypes(p, msg)
+			}
 
-			case *message.MsgCFilter:
-				if p.cfg.Listeners.OnCFilter != nil {
-					p.cfg.Listeners.OnCFilter(p, msg)
-				}
+		case *message.MsgCFilter:
+			if p.cfg.Listeners.OnCFilter != nil {
+				p.cfg.Listeners.OnCFilter(p, msg)
+			}
 
-			case *message.MsgCFHeaders:
-				if p.cfg.Listeners.OnCFHeaders != nil {
-					p.cfg.Listeners.OnCFHeaders(p, msg)
-				}
+		case *message.MsgCFHeaders:
+			if p.cfg.Listeners.OnCFHeaders != nil {
+				p.cfg.Listeners.OnCFHeaders(p, msg)
+			}
 
-			case *message.MsgCFTypes:
-				if p.cfg.Listeners.OnCFTypes != nil {
-					p.cfg.Listeners.OnCFTypes(p, msg)
-				}
+		case *message.MsgCFTypes:
+			if p.cfg.Listeners.OnCFTypes != nil {
+				p.cfg.Listeners.OnCFTypes(p, msg)
+			}
+		case *message.MsgFilterAdd:
+			if p.cfg.Listeners.OnFilterAdd != nil {
+				p.cfg.Listeners.OnFilterAdd(p, msg)
+			}
+
+		case *message.MsgFilterClear:
+			if p.cfg.Listeners.OnFilterClear != nil {
+				p.cfg.Listeners.OnFilterClear(p, msg)
+			}
 
+		case *message.MsgFilterLoad:
+			if p.cfg.Listeners.OnFilterLoad != nil {
+				p.cfg.Listeners.OnFilterLoad(p, msg)
+			}
+
+		case *message.MsgMerkleBlock:
+			if p.cfg.Listeners.OnMerkleBlock != nil {
+				p.cfg.Listeners.OnMerkleBlock(p, msg)
+			}
+		case *message.MsgHeaders:
+			if p.cfg.Listeners.OnHeaders != nil {
+				p.cfg.Listeners.OnHeaders(p, msg)
+			}
+
+		case *message.MsgSendCmpct:
+			// Only the known version of the compact blocks is
+			// used, the others are ignored.
+			if msg.Version == message.CmpctBlocksVersion {
+				p.flagsMtx.Lock()
+				p.sendCmpct = true
+				p.cmpctHighBandwidth = msg.Announce
+				p.flagsMtx.Unlock()
+			}
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *message.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *message.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *message.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+		/*
 			case *message.MsgSendHeaders:
 				p.flagsMtx.Lock()
 				p.sendHeadersPreferred = true
@@ -19,6 +19,7 @@ import (
 	"github.com/Qitmeer/qitmeer/p2p/peer/invcache"
 	"github.com/Qitmeer/qitmeer/p2p/peer/nounce"
 	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/services/bloom"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/satori/go.uuid"
 	"net"
@@ -56,6 +57,10 @@ type Peer struct {
 	lastRecv int64 //last recv time
 	lastSend int64 //last sent time
 
+	// Messages and bytes by command, they have their own mutex.
+	sentMsgStats msgStats
+	recvMsgStats msgStats
+
 	// These fields protects by the flagsMtx mutex
 	flagsMtx sync.Mutex
 	// - address
@@ -75,13 +80,22 @@ type Peer struct {
 	// - negotiated protocol version
 	protocolVersion uint32
 
+	// - transport of the messages
+	transport string
+	v2Failed  bool
+
 	versionSent          bool // peer sent the version msg
 	verAckReceived       bool // peer received the version ack msg
 	sendHeadersPreferred bool // peer wants header instead of block
+	sendCmpct            bool // peer supports compact blocks
+	cmpctHighBandwidth   bool // peer wants compact blocks unannounced
 
 	// Inv
 	knownInventory *invcache.InventoryCache
 
+	// Bloom filter loaded by the remote SPV peer
+	filter *bloom.Filter
+
 	// prevget
 	PrevGet     PrevGet
 	prevGetHdrs PrevGet
@@ -139,6 +153,7 @@ func (p *Peer) readMessage() (message.Message, []byte, error) {
 	n, msg, buf, err := message.ReadMessageN(p.conn, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	p.recvMsgStats.add(msg, n)
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -202,6 +217,7 @@ func (p *Peer) writeMessage(msg message.Message) error {
 	n, err := message.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	p.sentMsgStats.add(msg, n)
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -407,12 +423,45 @@ func (p *Peer) negotiateOutboundProtocol() error {
 	return p.readRemoteVersionMsg()
 }
 
+// negotiateTransport sets up the transport of the messages before the version
+// messages are exchanged.
+func (p *Peer) negotiateTransport() error {
+	if !p.cfg.V2Transport {
+		return nil
+	}
+	if p.inbound {
+		conn, transport, err := respondV2(p.conn, p.cfg.ChainParams.Net)
+		if err != nil {
+			return err
+		}
+		p.flagsMtx.Lock()
+		p.conn = conn
+		p.transport = transport
+		p.flagsMtx.Unlock()
+		return nil
+	}
+	conn, err := initiateV2(p.conn, p.cfg.ChainParams.Net)
+	p.flagsMtx.Lock()
+	defer p.flagsMtx.Unlock()
+	if err != nil {
+		p.v2Failed = err == ErrV2Handshake
+		return err
+	}
+	p.conn = conn
+	p.transport = TransportV2
+	return nil
+}
+
 // start begins processing input and output messages.
 func (p *Peer) start() error {
 	log.Trace("Starting peer", "peer", p.addr)
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -481,6 +530,7 @@ func newPeerBase(cfg *Config, inbound bool) *Peer {
 	p := Peer{
 		inbound:         inbound,
 		knownInventory:  invcache.NewLruInventoryCache(maxKnownInventory),
+		filter:          bloom.LoadFilter(nil),
 		stallControl:    make(chan stallControlMsg, 1), // nonblocking sync
 		outputQueue:     make(chan outMsg, outputBufferSize),
 		sendQueue:       make(chan outMsg, 1),   // nonblocking sync
@@ -494,6 +544,7 @@ func newPeerBase(cfg *Config, inbound bool) *Peer {
 		services:        cfg.Services,
 		protocolVersion: protocolVersion,
 		lastGS:          blockdag.NewGraphState(),
+		transport:       TransportV1,
 	}
 	p.PrevGet.Init(&p)
 	p.prevGetHdrs.Init(&p)
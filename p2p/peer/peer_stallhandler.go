@@ -82,10 +82,13 @@ out:
 				switch msgCmd := msg.message.Command(); msgCmd {
 				case message.CmdBlock:
 					fallthrough
+				case message.CmdCmpctBlock:
+					fallthrough
 				case message.CmdTx:
 					fallthrough
 				case message.CmdNotFound:
 					delete(pendingResponses, message.CmdBlock)
+					delete(pendingResponses, message.CmdCmpctBlock)
 					delete(pendingResponses, message.CmdTx)
 					delete(pendingResponses, message.CmdNotFound)
 
@@ -215,11 +218,16 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[message.CmdInv] = deadline
 
 	case message.CmdGetData:
-		// Expects a block, tx, or notfound message.
+		// Expects a block, cmpctblock, tx, or notfound message.
 		pendingResponses[message.CmdBlock] = deadline
+		pendingResponses[message.CmdCmpctBlock] = deadline
 		pendingResponses[message.CmdTx] = deadline
 		pendingResponses[message.CmdNotFound] = deadline
 
+	case message.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[message.CmdBlockTxn] = deadline
+
 	case message.CmdGetHeaders:
 		// Expects a headers message.  Use a longer deadline since it
 		// can take a while for the remote peer to load all of the
@@ -0,0 +1,283 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package peer
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"net"
+	"sync"
+)
+
+// The transports of the messages of a peer.
+const (
+	// TransportV1 sends the messages in plaintext.
+	TransportV1 = "v1"
+
+	// TransportV2 encrypts and authenticates the messages, the keys are
+	// agreed by an ephemeral ECDH over secp256k1 at connection setup.  The
+	// peers themselves are not authenticated, so it doesn't protect against
+	// a man in the middle.
+	TransportV2 = "v2"
+)
+
+const (
+	// v2KeySize is the size of the ephemeral public keys exchanged by the
+	// v2 handshake, they are the x coordinates of the points.
+	v2KeySize = 32
+
+	// v2TagSize is the size of the Poly1305 tag of the sealed data.
+	v2TagSize = 16
+
+	// v2LengthSize is the size of the encrypted length of a v2 packet.
+	v2LengthSize = 4 + v2TagSize
+
+	// v2MaxPacketSize is the maximum plaintext size of a v2 packet, it
+	// fits the largest message.
+	v2MaxPacketSize = message.MessageHeaderSize + message.MaxMessagePayload
+)
+
+// ErrV2Handshake is returned when the remote peer doesn't complete the v2
+// handshake, it likely only supports the v1 transport.
+var ErrV2Handshake = errors.New("v2 transport handshake failed")
+
+// v2Conn is a connection which encrypts the written bytes into packets and
+// decrypts the read packets.  Each packet is made of its length and content,
+// both sealed by ChaCha20-Poly1305 with a nonce counting the packets of the
+// direction, so that observers can neither read nor tamper the messages.
+type v2Conn struct {
+	net.Conn
+
+	sendMtx   sync.Mutex
+	send      cipher.AEAD
+	sendNonce uint64
+
+	recv      cipher.AEAD
+	recvNonce uint64
+	recvBuf   []byte
+}
+
+func v2Nonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// Write seals the bytes into one packet.
+func (c *v2Conn) Write(b []byte) (int, error) {
+	if len(b) > v2MaxPacketSize {
+		return 0, fmt.Errorf("v2 packet of %d bytes is too large", len(b))
+	}
+	c.sendMtx.Lock()
+	defer c.sendMtx.Unlock()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(b)))
+	packet := c.send.Seal(nil, v2Nonce(c.sendNonce), length[:], nil)
+	packet = c.send.Seal(packet, v2Nonce(c.sendNonce+1), b, nil)
+	c.sendNonce += 2
+	if _, err := c.Conn.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read returns the bytes of the current packet, or reads the next one.
+func (c *v2Conn) Read(b []byte) (int, error) {
+	if len(c.recvBuf) == 0 {
+		packet, err := c.readPacket()
+		if err != nil {
+			return 0, err
+		}
+		c.recvBuf = packet
+	}
+	n := copy(b, c.recvBuf)
+	c.recvBuf = c.recvBuf[n:]
+	return n, nil
+}
+
+func (c *v2Conn) readPacket() ([]byte, error) {
+	var sealedLength [v2LengthSize]byte
+	if _, err := io.ReadFull(c.Conn, sealedLength[:]); err != nil {
+		return nil, err
+	}
+	length, err := c.recv.Open(nil, v2Nonce(c.recvNonce), sealedLength[:], nil)
+	if err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(length)
+	if size > v2MaxPacketSize {
+		return nil, fmt.Errorf("v2 packet of %d bytes is too large", size)
+	}
+	sealed := make([]byte, int(size)+v2TagSize)
+	if _, err := io.ReadFull(c.Conn, sealed); err != nil {
+		return nil, err
+	}
+	packet, err := c.recv.Open(sealed[:0], v2Nonce(c.recvNonce+1), sealed, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.recvNonce += 2
+	return packet, nil
+}
+
+// prefixConn replays the bytes already read from a connection.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// newV2Key returns an ephemeral key whose public key can't be taken for the
+// start of a v1 message header.
+func newV2Key(network protocol.Network) (*secp256k1.PrivateKey, []byte, error) {
+	for {
+		key, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		pubKey := make([]byte, v2KeySize)
+		key.PublicKey.X.FillBytes(pubKey)
+		if !bytes.Equal(pubKey[:4], v1Magic(network)) {
+			return key, pubKey, nil
+		}
+	}
+}
+
+func v1Magic(network protocol.Network) []byte {
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(network))
+	return magic[:]
+}
+
+// newV2Conn derives the keys of both directions from the ECDH secret of the
+// local key and the remote public key and wraps the connection.
+func newV2Conn(conn net.Conn, network protocol.Network, key *secp256k1.PrivateKey,
+	initiatorKey []byte, responderKey []byte, initiator bool) (*v2Conn, error) {
+	remoteKey := responderKey
+	if !initiator {
+		remoteKey = initiatorKey
+	}
+	// Only the x coordinates are exchanged, both points of x give the same
+	// shared x coordinate.
+	pubKey, err := secp256k1.ParsePubKey(append([]byte{0x02}, remoteKey...))
+	if err != nil {
+		return nil, err
+	}
+	x, _ := secp256k1.S256().ScalarMult(pubKey.X, pubKey.Y, key.D.Bytes())
+	secret := make([]byte, v2KeySize)
+	x.FillBytes(secret)
+
+	salt := append([]byte("qitmeer_v2_transport"), v1Magic(network)...)
+	info := append(append([]byte{}, initiatorKey...), responderKey...)
+	kdf := hkdf.New(sha256.New, secret, salt, info)
+	var initiatorSendKey, responderSendKey [chacha20poly1305.KeySize]byte
+	if _, err := io.ReadFull(kdf, initiatorSendKey[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(kdf, responderSendKey[:]); err != nil {
+		return nil, err
+	}
+	initiatorSend, err := chacha20poly1305.New(initiatorSendKey[:])
+	if err != nil {
+		return nil, err
+	}
+	responderSend, err := chacha20poly1305.New(responderSendKey[:])
+	if err != nil {
+		return nil, err
+	}
+	if initiator {
+		return &v2Conn{Conn: conn, send: initiatorSend, recv: responderSend}, nil
+	}
+	return &v2Conn{Conn: conn, send: responderSend, recv: initiatorSend}, nil
+}
+
+// confirmV2 exchanges an empty packet, which proves both sides derived the
+// same keys before any message is sent.
+func confirmV2(c *v2Conn) error {
+	if _, err := c.Write(nil); err != nil {
+		return err
+	}
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(packet) != 0 {
+		return errors.New("unexpected v2 confirmation")
+	}
+	return nil
+}
+
+// initiateV2 runs the handshake of the outbound side.  Any failure is
+// reported as ErrV2Handshake, so the caller can retry with v1.
+func initiateV2(conn net.Conn, network protocol.Network) (net.Conn, error) {
+	key, pubKey, err := newV2Key(network)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(pubKey); err != nil {
+		return nil, ErrV2Handshake
+	}
+	remoteKey := make([]byte, v2KeySize)
+	if _, err := io.ReadFull(conn, remoteKey); err != nil {
+		return nil, ErrV2Handshake
+	}
+	c, err := newV2Conn(conn, network, key, pubKey, remoteKey, true)
+	if err != nil {
+		return nil, ErrV2Handshake
+	}
+	if err := confirmV2(c); err != nil {
+		return nil, ErrV2Handshake
+	}
+	return c, nil
+}
+
+// respondV2 runs the handshake of the inbound side.  A v1 peer starts with
+// the network magic, in which case the connection is returned as is along
+// with the v1 transport.
+func respondV2(conn net.Conn, network protocol.Network) (net.Conn, string, error) {
+	remoteKey := make([]byte, v2KeySize)
+	if _, err := io.ReadFull(conn, remoteKey[:4]); err != nil {
+		return nil, "", err
+	}
+	if bytes.Equal(remoteKey[:4], v1Magic(network)) {
+		return &prefixConn{Conn: conn, prefix: remoteKey[:4]}, TransportV1, nil
+	}
+	if _, err := io.ReadFull(conn, remoteKey[4:]); err != nil {
+		return nil, "", err
+	}
+	key, pubKey, err := newV2Key(network)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := conn.Write(pubKey); err != nil {
+		return nil, "", err
+	}
+	c, err := newV2Conn(conn, network, key, remoteKey, pubKey, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := confirmV2(c); err != nil {
+		return nil, "", err
+	}
+	return c, TransportV2, nil
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/Qitmeer/qitmeer/params"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// bufConn is a connection reading and writing an in memory buffer.
+type bufConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *bufConn) Read(b []byte) (int, error) {
+	return c.buf.Read(b)
+}
+
+func (c *bufConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+// newV2Pair returns the initiator and responder sides of a v2 connection whose
+// packets are written to in memory buffers.
+func newV2Pair(t *testing.T) (*v2Conn, *v2Conn) {
+	network := params.PrivNetParams.Net
+	initiatorKey, initiatorPubKey, err := newV2Key(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderKey, responderPubKey, err := newV2Key(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator, err := newV2Conn(&bufConn{}, network, initiatorKey,
+		initiatorPubKey, responderPubKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, err := newV2Conn(&bufConn{}, network, responderKey,
+		initiatorPubKey, responderPubKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return initiator, responder
+}
+
+// sealed returns the packets written to the passed connection so far.
+func sealed(c *v2Conn) []byte {
+	buf := &c.Conn.(*bufConn).buf
+	packets := append([]byte{}, buf.Bytes()...)
+	buf.Reset()
+	return packets
+}
+
+// deliver makes the passed packets the next bytes read by the connection.
+func deliver(c *v2Conn, packets []byte) {
+	c.Conn.(*bufConn).buf.Write(packets)
+}
+
+// tcpPair returns both ends of a loopback tcp connection, the handshakes
+// rely on the buffering of the connection.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	local, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := listener.Accept()
+	if err != nil {
+		local.Close()
+		t.Fatal(err)
+	}
+	return local, remote
+}
+
+func Test_V2Handshake(t *testing.T) {
+	network := params.PrivNetParams.Net
+	local, remote := tcpPair(t)
+	defer local.Close()
+	defer remote.Close()
+
+	type result struct {
+		conn      net.Conn
+		transport string
+		err       error
+	}
+	responded := make(chan result, 1)
+	go func() {
+		conn, transport, err := respondV2(remote, network)
+		responded <- result{conn, transport, err}
+	}()
+	initiator, err := initiateV2(local, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-responded
+	if r.err != nil || r.transport != TransportV2 {
+		t.Fatalf("responder transport %v, error %v", r.transport, r.err)
+	}
+
+	// Messages are received whole in both directions, in the order they
+	// were sent, whatever the size of the reads.
+	msgs := [][]byte{[]byte("version"), bytes.Repeat([]byte{0xaa}, 5000), {0x01}}
+	for _, msg := range msgs {
+		if _, err := initiator.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, msg := range msgs {
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(r.conn, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("received %x, want %x", got, msg)
+		}
+	}
+	if _, err := r.conn.Write([]byte("verack")); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len("verack"))
+	if _, err := io.ReadFull(initiator, got); err != nil || string(got) != "verack" {
+		t.Fatalf("received %q, error %v", got, err)
+	}
+}
+
+func Test_V2Tampered(t *testing.T) {
+	initiator, responder := newV2Pair(t)
+	if _, err := initiator.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	packet := sealed(initiator)
+
+	// Flipping a bit of the length or the content fails the packet, the
+	// untouched packet is still accepted afterwards.
+	for _, i := range []int{0, v2LengthSize - 1, v2LengthSize, len(packet) - 1} {
+		tampered := append([]byte{}, packet...)
+		tampered[i] ^= 0x01
+		deliver(responder, tampered)
+		if _, err := responder.readPacket(); err == nil {
+			t.Fatalf("packet tampered at byte %d accepted", i)
+		}
+		responder.Conn.(*bufConn).buf.Reset()
+	}
+
+	deliver(responder, packet)
+	got, err := responder.readPacket()
+	if err != nil || string(got) != "ping" {
+		t.Fatalf("received %q, error %v", got, err)
+	}
+
+	// A replayed packet doesn't match the nonce of the next one.
+	deliver(responder, packet)
+	if _, err := responder.readPacket(); err == nil {
+		t.Fatal("replayed packet accepted")
+	}
+}
+
+func Test_V2OversizePacket(t *testing.T) {
+	initiator, responder := newV2Pair(t)
+	if _, err := initiator.Write(make([]byte, v2MaxPacketSize+1)); err == nil {
+		t.Fatal("oversize packet written")
+	}
+
+	// A peer announcing an oversize packet is rejected before its content
+	// is read.
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], v2MaxPacketSize+1)
+	deliver(responder, initiator.send.Seal(nil, v2Nonce(0), length[:], nil))
+	if _, err := responder.readPacket(); err == nil {
+		t.Fatal("oversize packet accepted")
+	}
+}
+
+func Test_V1Fallback(t *testing.T) {
+	network := params.PrivNetParams.Net
+
+	// A v2 responder serves a v1 peer, which starts with the network
+	// magic, and replays the bytes it read.
+	local, remote := tcpPair(t)
+	header := append(v1Magic(network), []byte("version")...)
+	if _, err := local.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	conn, transport, err := respondV2(remote, network)
+	if err != nil || transport != TransportV1 {
+		t.Fatalf("transport %v, error %v", transport, err)
+	}
+	got := make([]byte, len(header))
+	if _, err := io.ReadFull(conn, got); err != nil || !bytes.Equal(got, header) {
+		t.Fatalf("received %x, error %v", got, err)
+	}
+	local.Close()
+	remote.Close()
+
+	// A v1 peer drops the v2 initiator, which reports the failed handshake
+	// so that it is connected again with v1.
+	local, remote = tcpPair(t)
+	go func() {
+		io.ReadFull(remote, make([]byte, v2KeySize))
+		remote.Close()
+	}()
+	if _, err := initiateV2(local, network); err != ErrV2Handshake {
+		t.Fatalf("got error %v, want %v", err, ErrV2Handshake)
+	}
+	local.Close()
+
+	// The v1 peer may also answer with its own messages.
+	local, remote = tcpPair(t)
+	go func() {
+		io.ReadFull(remote, make([]byte, v2KeySize))
+		remote.Write(append(v1Magic(network), make([]byte, 64)...))
+		io.Copy(ioutil.Discard, remote)
+	}()
+	if _, err := initiateV2(local, network); err != ErrV2Handshake {
+		t.Fatalf("got error %v, want %v", err, ErrV2Handshake)
+	}
+	local.Close()
+	remote.Close()
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// banListFilename is the file of the ban list in the data dir.
+const banListFilename = "banlist.json"
+
+// BanEntry is a banned subnet, a single host is banned as a subnet of one
+// address.
+type BanEntry struct {
+	Subnet  string    `json:"subnet"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+	Reason  string    `json:"reason"`
+
+	ipNet *net.IPNet
+}
+
+// ParseSubnet parses a subnet in CIDR notation or a single IP address.
+func ParseSubnet(subnet string) (*net.IPNet, error) {
+	if _, ipNet, err := net.ParseCIDR(subnet); err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(subnet)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid subnet or IP address: %s", subnet)
+	}
+	bits := net.IPv6len * 8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = net.IPv4len * 8
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// subnetKey returns the key of a subnet in the ban list, the single hosts are
+// keyed by their address.
+func subnetKey(ipNet *net.IPNet) string {
+	if ones, bits := ipNet.Mask.Size(); ones == bits {
+		return ipNet.IP.String()
+	}
+	return ipNet.String()
+}
+
+// banList keeps the banned subnets and saves them to the data dir, so that the
+// bans survive the restarts.
+type banList struct {
+	mtx     sync.Mutex
+	file    string
+	entries map[string]*BanEntry
+}
+
+// newBanList returns the ban list saved in the data dir.  A missing or
+// unreadable file starts an empty list, the unreadable file is kept aside as a
+// backup so the next save doesn't overwrite the bans it holds.
+func newBanList(dataDir string) *banList {
+	bl := &banList{
+		file:    filepath.Join(dataDir, banListFilename),
+		entries: make(map[string]*BanEntry),
+	}
+	if err := bl.load(); err != nil {
+		log.Error("Failed to load the ban list", "file", bl.file, "error", err)
+		bl.entries = make(map[string]*BanEntry)
+		backup := bl.file + ".bak"
+		if err := os.Rename(bl.file, backup); err != nil {
+			log.Error("Failed to back up the ban list", "file", bl.file,
+				"error", err)
+		} else {
+			log.Warn("Moved the unreadable ban list", "backup", backup)
+		}
+	}
+	return bl
+}
+
+// load reads the bans saved in the file.  The entries with a malformed subnet
+// are skipped, the rest of the list is still loaded.
+func (bl *banList) load() error {
+	r, err := os.Open(bl.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var entries []*BanEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e == nil {
+			continue
+		}
+		ipNet, err := ParseSubnet(e.Subnet)
+		if err != nil {
+			log.Warn("Skipping malformed ban", "file", bl.file,
+				"error", err)
+			continue
+		}
+		if now.After(e.Until) {
+			continue
+		}
+		e.ipNet = ipNet
+		bl.entries[subnetKey(ipNet)] = e
+	}
+	log.Info(fmt.Sprintf("Loaded %d bans from file '%s'", len(bl.entries), bl.file))
+	return nil
+}
+
+// save writes the ban list, it must be called with the lock held.
+func (bl *banList) save() {
+	tmpfile := bl.file + ".new"
+	w, err := os.Create(tmpfile)
+	if err != nil {
+		log.Error("Error opening file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(bl.list()); err != nil {
+		w.Close()
+		log.Error("Failed to encode file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Error("Error closing file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := os.Rename(tmpfile, bl.file); err != nil {
+		log.Error("Error writing file", "file", bl.file, "error", err)
+	}
+}
+
+// list returns the bans sorted by subnet, it must be called with the lock
+// held.
+func (bl *banList) list() []*BanEntry {
+	result := make([]*BanEntry, 0, len(bl.entries))
+	for _, e := range bl.entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Subnet < result[j].Subnet
+	})
+	return result
+}
+
+// Ban bans the subnet until the given time, a subnet which is already banned
+// gets the new time and reason.
+func (bl *banList) Ban(ipNet *net.IPNet, until time.Time, reason string) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	key := subnetKey(ipNet)
+	bl.entries[key] = &BanEntry{
+		Subnet:  key,
+		Created: time.Now(),
+		Until:   until,
+		Reason:  reason,
+		ipNet:   ipNet,
+	}
+	bl.save()
+}
+
+// Unban removes the ban of the subnet, or all the bans when ipNet is nil.  It
+// returns whether a ban was removed.
+func (bl *banList) Unban(ipNet *net.IPNet) bool {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if ipNet == nil {
+		if len(bl.entries) == 0 {
+			return false
+		}
+		bl.entries = make(map[string]*BanEntry)
+		bl.save()
+		return true
+	}
+	key := subnetKey(ipNet)
+	if _, ok := bl.entries[key]; !ok {
+		return false
+	}
+	delete(bl.entries, key)
+	bl.save()
+	return true
+}
+
+// BannedBy returns the ban covering the host, or nil when it isn't banned.
+// The expired bans are removed.
+func (bl *banList) BannedBy(host string) *BanEntry {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	now := time.Now()
+	var result *BanEntry
+	expired := false
+	for key, e := range bl.entries {
+		if now.After(e.Until) {
+			log.Info("Peer is no longer banned", "subnet", e.Subnet)
+			delete(bl.entries, key)
+			expired = true
+			continue
+		}
+		if result == nil && e.ipNet.Contains(ip) {
+			result = e
+		}
+	}
+	if expired {
+		bl.save()
+	}
+	return result
+}
+
+// Entries returns the bans which haven't expired, sorted by subnet.
+func (bl *banList) Entries() []*BanEntry {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	now := time.Now()
+	result := []*BanEntry{}
+	for _, e := range bl.list() {
+		if now.Before(e.Until) {
+			e := *e
+			result = append(result, &e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_ParseSubnet(t *testing.T) {
+	tests := []struct {
+		subnet string
+		key    string
+		host   string
+		banned bool
+	}{
+		{"1.2.3.4", "1.2.3.4", "1.2.3.4", true},
+		{"1.2.3.4", "1.2.3.4", "1.2.3.5", false},
+		{"1.2.3.4", "1.2.3.4", "::ffff:1.2.3.4", true},
+		{"1.2.3.0/24", "1.2.3.0/24", "1.2.3.200", true},
+		{"1.2.3.4/24", "1.2.3.0/24", "1.2.4.1", false},
+		{"2001:db8::1", "2001:db8::1", "2001:db8::1", true},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db8:ffff::1", true},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db9::1", false},
+		{"", "", "", false},
+		{"1.2.3", "", "", false},
+		{"1.2.3.4/33", "", "", false},
+		{"host.example.com", "", "", false},
+	}
+	for _, test := range tests {
+		ipNet, err := ParseSubnet(test.subnet)
+		if test.key == "" {
+			if err == nil {
+				t.Errorf("%q: invalid subnet parsed", test.subnet)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.subnet, err)
+			continue
+		}
+		if key := subnetKey(ipNet); key != test.key {
+			t.Errorf("%q: key %s, want %s", test.subnet, key, test.key)
+		}
+		bl := &banList{entries: make(map[string]*BanEntry)}
+		bl.entries[subnetKey(ipNet)] = &BanEntry{
+			Subnet: subnetKey(ipNet),
+			Until:  time.Now().Add(time.Hour),
+			ipNet:  ipNet,
+		}
+		if banned := bl.BannedBy(test.host) != nil; banned != test.banned {
+			t.Errorf("%q: %s banned %v", test.subnet, test.host, banned)
+		}
+	}
+}
+
+func Test_BanListSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bl := newBanList(dir)
+	until := time.Now().Add(time.Hour).Round(time.Second)
+	for _, subnet := range []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32"} {
+		ipNet, err := ParseSubnet(subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bl.Ban(ipNet, until, "test "+subnet)
+	}
+	ipNet, _ := ParseSubnet("5.6.7.8")
+	bl.Ban(ipNet, time.Now().Add(-time.Second), "expired")
+	ipNet, _ = ParseSubnet("9.9.9.9")
+	bl.Ban(ipNet, until, "unbanned")
+	if !bl.Unban(ipNet) || bl.Unban(ipNet) {
+		t.Fatal("unban of 9.9.9.9 failed")
+	}
+
+	// The expired and unbanned entries aren't loaded.
+	loaded := newBanList(dir)
+	entries := loaded.Entries()
+	want := []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32"}
+	if len(entries) != len(want) || len(loaded.entries) != len(want) {
+		t.Fatalf("loaded %d bans, want %d", len(loaded.entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Subnet != want[i] || e.Reason != "test "+want[i] ||
+			!e.Until.Equal(until) {
+			t.Errorf("ban %d: %+v", i, e)
+		}
+	}
+	if e := loaded.BannedBy("10.20.30.40"); e == nil || e.Subnet != "10.0.0.0/8" {
+		t.Errorf("10.20.30.40 banned by %+v", e)
+	}
+
+	// Unbanning everything is saved too.
+	if !loaded.Unban(nil) || loaded.Unban(nil) {
+		t.Fatal("unban of all subnets failed")
+	}
+	if n := len(newBanList(dir).Entries()); n != 0 {
+		t.Fatalf("%d bans after unbanning all", n)
+	}
+
+	// A malformed subnet only skips its own entry.
+	data := fmt.Sprintf(`[{"subnet":"1.2.3","until":%q},`+
+		`{"subnet":"10.0.0.0/8","until":%q}]`,
+		until.Format(time.RFC3339), until.Format(time.RFC3339))
+	if err := ioutil.WriteFile(bl.file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded = newBanList(dir)
+	if e := loaded.BannedBy("10.1.2.3"); len(loaded.entries) != 1 || e == nil {
+		t.Fatalf("loaded %d bans, 10.1.2.3 banned by %+v",
+			len(loaded.entries), e)
+	}
+
+	// A malformed file starts an empty list, and is kept as a backup when
+	// the list is saved again.
+	if err := ioutil.WriteFile(bl.file, []byte("[{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded = newBanList(dir)
+	if n := len(loaded.entries); n != 0 {
+		t.Fatalf("%d bans loaded from a malformed file", n)
+	}
+	loaded.Ban(ipNet, until, "after malformed")
+	backup, err := ioutil.ReadFile(bl.file + ".bak")
+	if err != nil || string(backup) != "[{" {
+		t.Fatalf("backup %q %v", backup, err)
+	}
+}
+
+func Test_BanExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bl := newBanList(dir)
+	ipNet, _ := ParseSubnet("1.2.3.0/24")
+	bl.Ban(ipNet, time.Now().Add(100*time.Millisecond), "short")
+	ipNet, _ = ParseSubnet("1.2.3.4")
+	bl.Ban(ipNet, time.Now().Add(time.Hour), "long")
+	if e := bl.BannedBy("1.2.3.5"); e == nil || e.Reason != "short" {
+		t.Fatalf("1.2.3.5 banned by %+v", e)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := len(bl.Entries()); n != 1 {
+		t.Fatalf("%d bans after expiry, want 1", n)
+	}
+	if e := bl.BannedBy("1.2.3.5"); e != nil {
+		t.Fatalf("1.2.3.5 still banned by %+v", e)
+	}
+	if e := bl.BannedBy("1.2.3.4"); e == nil || e.Reason != "long" {
+		t.Fatalf("1.2.3.4 banned by %+v", e)
+	}
+
+	// The expired ban is removed from the file as well.
+	if n := len(newBanList(dir).entries); n != 1 {
+		t.Fatalf("%d bans saved after expiry, want 1", n)
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"net"
+	"strings"
 	"time"
 )
 
 type BanPeerMsg struct {
-	sp  *serverPeer
-	dur time.Duration
+	sp     *serverPeer
+	dur    time.Duration
+	reason string
 }
 
 // BanPeer bans a peer that has already been connected to the server by ip.
@@ -26,10 +28,15 @@ func (s *PeerServer) handleBanPeerMsg(state *peerState, msg *BanPeerMsg) {
 		log.Debug(fmt.Sprintf("can't split ban peer %s %v", msg.sp.Addr(), err))
 		return
 	}
+	ipNet, err := ParseSubnet(host)
+	if err != nil {
+		log.Debug(fmt.Sprintf("can't ban peer %s %v", msg.sp.Addr(), err))
+		return
+	}
 	direction := directionString(msg.sp.Inbound())
-	log.Info(fmt.Sprintf("Banned peer %s (%s) for %v", host, direction,
-		connmgr.BanDuration))
-	state.banned[host] = time.Now().Add(msg.dur)
+	log.Info(fmt.Sprintf("Banned peer %s (%s) for %v: %s", host, direction,
+		msg.dur, msg.reason))
+	state.banned.Ban(ipNet, time.Now().Add(msg.dur), msg.reason)
 }
 
 // addBanScore increases the persistent and decaying ban score fields by the
@@ -58,7 +65,7 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 		}
 		return
 	}
-	score := sp.banScore.Increase(persistent, transient)
+	score := sp.banScore.Increase(persistent, transient, reason)
 	if score > warnThreshold {
 		log.Warn(fmt.Sprintf("Misbehaving peer %s: %s -- ban score increased to %d",
 			sp, reason, score))
@@ -66,7 +73,11 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 			log.Warn("Misbehaving peer -- banning and disconnecting", "peer", sp)
 			dur := float64(transient) / float64(connmgr.BanThreshold)
 			dur *= float64(connmgr.BanDuration)
-			msg := BanPeerMsg{sp: sp, dur: time.Duration(dur)}
+			msg := BanPeerMsg{
+				sp:     sp,
+				dur:    time.Duration(dur),
+				reason: strings.Join(sp.banScore.Reasons(), "; "),
+			}
 			if msg.dur > connmgr.BanDuration {
 				msg.dur = connmgr.BanDuration
 			}
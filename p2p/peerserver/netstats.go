@@ -0,0 +1,173 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"github.com/Qitmeer/qitmeer/core/types"
+	"sync"
+	"time"
+)
+
+const (
+	// netStatsInterval is the resolution of the recent traffic kept to
+	// compute the rates.
+	netStatsInterval = 10 * time.Second
+
+	// netStatsIntervals is the number of intervals kept, it covers the
+	// longest of the rate windows.
+	netStatsIntervals = int64(15 * time.Minute / netStatsInterval)
+
+	// UploadTargetTimeframe is the cycle of the upload target.
+	UploadTargetTimeframe = 24 * time.Hour
+
+	// historicBlockAge is the age of the blocks which are no longer served
+	// once the upload target is reached.
+	historicBlockAge = 7 * 24 * time.Hour
+)
+
+// NetRateWindows are the time windows of the traffic rates.
+var NetRateWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// NetRate is the average traffic over a time window.
+type NetRate struct {
+	Window     time.Duration
+	SentPerSec float64
+	RecvPerSec float64
+}
+
+// UploadTarget is the state of the upload target in the current cycle.
+type UploadTarget struct {
+	Timeframe             time.Duration
+	Target                uint64
+	TargetReached         bool
+	ServeHistoricalBlocks bool
+	BytesLeftInCycle      uint64
+	TimeLeftInCycle       time.Duration
+}
+
+// NetTotals is the traffic of the server since start.
+type NetTotals struct {
+	BytesRecv    uint64
+	BytesSent    uint64
+	Time         time.Time
+	Rates        []NetRate
+	UploadTarget UploadTarget
+}
+
+// netStats keeps the recent traffic of the server in intervals of
+// netStatsInterval, and the bytes sent in the cycle of the upload target.
+type netStats struct {
+	mtx   sync.Mutex
+	now   func() time.Time // the clock of the traffic
+	start time.Time
+	sent  [netStatsIntervals]uint64
+	recv  [netStatsIntervals]uint64
+	last  int64 // the newest interval, in intervals since the epoch
+
+	target     uint64 // the upload target in bytes per cycle, 0 for none
+	cycleStart time.Time
+	cycleSent  uint64
+}
+
+// newNetStats returns the stats of the traffic with the upload target in bytes
+// per cycle, the traffic is timed with the passed clock.
+func newNetStats(target uint64, clock func() time.Time) *netStats {
+	now := clock()
+	return &netStats{
+		now:        clock,
+		start:      now,
+		last:       now.UnixNano() / int64(netStatsInterval),
+		target:     target,
+		cycleStart: now,
+	}
+}
+
+// advance clears the intervals which passed since the last traffic and starts
+// a new cycle of the upload target when the current one is over.  It must be
+// called with the lock held.
+func (ns *netStats) advance(now time.Time) int64 {
+	current := now.UnixNano() / int64(netStatsInterval)
+	for i := ns.last + 1; i <= current && i <= ns.last+netStatsIntervals; i++ {
+		ns.sent[i%netStatsIntervals] = 0
+		ns.recv[i%netStatsIntervals] = 0
+	}
+	if current > ns.last {
+		ns.last = current
+	}
+	if now.Sub(ns.cycleStart) >= UploadTargetTimeframe {
+		ns.cycleStart = now
+		ns.cycleSent = 0
+	}
+	return ns.last
+}
+
+func (ns *netStats) addSent(n uint64) {
+	ns.mtx.Lock()
+	current := ns.advance(ns.now())
+	ns.sent[current%netStatsIntervals] += n
+	ns.cycleSent += n
+	ns.mtx.Unlock()
+}
+
+func (ns *netStats) addRecv(n uint64) {
+	ns.mtx.Lock()
+	current := ns.advance(ns.now())
+	ns.recv[current%netStatsIntervals] += n
+	ns.mtx.Unlock()
+}
+
+// rates returns the average traffic over each of NetRateWindows.
+func (ns *netStats) rates(now time.Time) []NetRate {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+
+	current := ns.advance(now)
+	result := make([]NetRate, 0, len(NetRateWindows))
+	for _, window := range NetRateWindows {
+		// The window ends with the current interval, which is partial.
+		count := int64(window / netStatsInterval)
+		elapsed := time.Duration(count-1)*netStatsInterval +
+			now.Sub(time.Unix(0, current*int64(netStatsInterval)))
+		if uptime := now.Sub(ns.start); uptime < elapsed {
+			elapsed = uptime
+		}
+		var sent, recv uint64
+		for i := current - count + 1; i <= current; i++ {
+			sent += ns.sent[i%netStatsIntervals]
+			recv += ns.recv[i%netStatsIntervals]
+		}
+		rate := NetRate{Window: window}
+		if secs := elapsed.Seconds(); secs > 0 {
+			rate.SentPerSec = float64(sent) / secs
+			rate.RecvPerSec = float64(recv) / secs
+		}
+		result = append(result, rate)
+	}
+	return result
+}
+
+// uploadTarget returns the state of the upload target.  The historic blocks
+// are served as long as a block of the maximum size fits in the bytes left.
+func (ns *netStats) uploadTarget(now time.Time) UploadTarget {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+
+	ns.advance(now)
+	ut := UploadTarget{
+		Timeframe:             UploadTargetTimeframe,
+		Target:                ns.target,
+		ServeHistoricalBlocks: true,
+	}
+	if ns.target == 0 {
+		return ut
+	}
+	if ns.cycleSent < ns.target {
+		ut.BytesLeftInCycle = ns.target - ns.cycleSent
+	}
+	ut.TargetReached = ut.BytesLeftInCycle == 0
+	ut.ServeHistoricalBlocks = ut.BytesLeftInCycle > types.MaxBlockPayload
+	ut.TimeLeftInCycle = ns.cycleStart.Add(UploadTargetTimeframe).Sub(now)
+	return ut
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"github.com/Qitmeer/qitmeer/core/types"
+	"testing"
+	"time"
+)
+
+// testClock is a clock which only moves when the test advances it.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) time.Time {
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// checkRates checks the sent and received rates of the 1, 5 and 15 minutes
+// windows.
+func checkRates(t *testing.T, ns *netStats, now time.Time, sent, recv [3]float64) {
+	t.Helper()
+	rates := ns.rates(now)
+	if len(rates) != len(NetRateWindows) {
+		t.Fatalf("%d rates, want %d", len(rates), len(NetRateWindows))
+	}
+	for i, rate := range rates {
+		if rate.Window != NetRateWindows[i] || rate.SentPerSec != sent[i] ||
+			rate.RecvPerSec != recv[i] {
+			t.Errorf("%v rate: %+v, want %v sent %v received", NetRateWindows[i],
+				rate, sent[i], recv[i])
+		}
+	}
+}
+
+func Test_NetStatsRates(t *testing.T) {
+	// The clock starts at the beginning of an interval.
+	clock := &testClock{now: time.Unix(1600000000, 0)}
+	ns := newNetStats(0, clock.Now)
+
+	// The windows longer than the uptime are averaged over the uptime.
+	clock.advance(time.Second)
+	ns.addSent(100)
+	ns.addRecv(10)
+	clock.advance(2 * time.Minute)
+	ns.addSent(200)
+	checkRates(t, ns, clock.advance(3*time.Second),
+		[3]float64{200.0 / 54, 300.0 / 124, 300.0 / 124},
+		[3]float64{0, 10.0 / 124, 10.0 / 124})
+
+	// The old intervals leave the windows.
+	now := clock.advance(10*time.Minute - 2*time.Minute - 4*time.Second)
+	checkRates(t, ns, now, [3]float64{0, 0, 300.0 / 600},
+		[3]float64{0, 0, 10.0 / 600})
+
+	// The ring buffer is cleared when the traffic comes back after more
+	// than its length, even in the slots of the same index.
+	clock.advance(20 * time.Minute)
+	ns.addSent(50)
+	ns.addRecv(5)
+	checkRates(t, ns, clock.advance(5*time.Second),
+		[3]float64{50.0 / 55, 50.0 / 295, 50.0 / 895},
+		[3]float64{5.0 / 55, 5.0 / 295, 5.0 / 895})
+}
+
+func Test_NetStatsUploadTarget(t *testing.T) {
+	clock := &testClock{now: time.Unix(1600000000, 0)}
+
+	// Without a target, the historic blocks are always served.
+	ns := newNetStats(0, clock.Now)
+	ns.addSent(10 * types.MaxBlockPayload)
+	if ut := ns.uploadTarget(clock.Now()); ut.TargetReached ||
+		!ut.ServeHistoricalBlocks || ut.BytesLeftInCycle != 0 {
+		t.Fatalf("upload target without target: %+v", ut)
+	}
+
+	target := uint64(3 * types.MaxBlockPayload)
+	ns = newNetStats(target, clock.Now)
+	tests := []struct {
+		sent    uint64
+		elapsed time.Duration
+		left    uint64
+		reached bool
+		serve   bool
+	}{
+		{0, 0, target, false, true},
+		{types.MaxBlockPayload, time.Hour, 2 * types.MaxBlockPayload, false, true},
+		{2*types.MaxBlockPayload - 10, 2 * time.Hour, 10, false, false},
+		{20, 23 * time.Hour, 0, true, false},
+		// A new cycle starts after the timeframe.
+		{0, UploadTargetTimeframe, target, false, true},
+		{types.MaxBlockPayload, UploadTargetTimeframe + time.Hour,
+			2 * types.MaxBlockPayload, false, true},
+	}
+	start := clock.Now()
+	for i, test := range tests {
+		clock.now = start.Add(test.elapsed)
+		ns.addSent(test.sent)
+		ut := ns.uploadTarget(clock.Now())
+		if ut.Target != target || ut.Timeframe != UploadTargetTimeframe ||
+			ut.BytesLeftInCycle != test.left || ut.TargetReached != test.reached ||
+			ut.ServeHistoricalBlocks != test.serve {
+			t.Errorf("test %d: upload target %+v", i, ut)
+		}
+		left := UploadTargetTimeframe - test.elapsed%UploadTargetTimeframe
+		if ut.TimeLeftInCycle != left {
+			t.Errorf("test %d: %v left in cycle, want %v", i,
+				ut.TimeLeftInCycle, left)
+		}
+	}
+}
@@ -19,6 +19,21 @@ import (
 func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer, error) {
 
 	services := defaultServices
+	if cfg.NoPeerBloomFilters {
+		services &^= protocol.Bloom
+	}
+	if cfg.NoCFilters {
+		services &^= protocol.CF
+	}
+	// A pruned node can't serve the old blocks, so peers shouldn't sync
+	// from it.
+	if cfg.Prune > 0 {
+		services &^= protocol.Full
+		services |= protocol.Limited
+	}
+	if cfg.V2Transport {
+		services |= protocol.P2PV2
+	}
 
 	s := PeerServer{
 		services:    services,
@@ -31,6 +46,10 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 		relayInv:    make(chan relayMsg, cfg.MaxPeers),
 		broadcast:   make(chan broadcastMsg, cfg.MaxPeers),
 		quit:        make(chan struct{}),
+		v1Peers:     make(map[string]struct{}),
+		dialer:      connmgr.NewDialer(cfg, defaultConnectTimeout),
+		banList:     newBanList(cfg.DataDir),
+		netStats:    newNetStats(cfg.MaxUploadTarget*1024*1024, time.Now),
 	}
 	if cfg.BanDuration > 0 {
 		connmgr.BanDuration = cfg.BanDuration
@@ -39,7 +58,7 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	if cfg.BanThreshold > 0 {
 		connmgr.BanThreshold = cfg.BanThreshold
 	}
-	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, net.LookupIP)
+	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, s.dialer.LookupFunc())
 	var listeners []net.Listener
 	var nat NAT
 	if !cfg.DisableListen {
@@ -93,7 +112,10 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 					log.Warn("Skipping specified external IP", "error", err)
 				}
 			}
-		} else {
+		} else if !s.dialer.HidesIP() {
+			// Behind a proxy the bound addresses and upnp would
+			// reveal the IP, only the external IPs such as an onion
+			// address are advertised.
 			if cfg.Upnp {
 				nat, err = Discover()
 				if err != nil {
@@ -122,7 +144,13 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	if !cfg.PrivNet && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
 			addr := s.addrManager.GetAddress()
-			if addr == nil {
+			// The addresses of the networks we don't connect to may
+			// be most of the known addresses, skip them.
+			for tries := 0; addr != nil && !s.dialer.IsReachable(addr.NetAddress()) &&
+				tries < maxUnreachableTries; tries++ {
+				addr = s.addrManager.GetAddress()
+			}
+			if addr == nil || !s.dialer.IsReachable(addr.NetAddress()) {
 				//break
 				return nil, errors.New("no valid connect address")
 			}
@@ -146,7 +174,7 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 				return nil, errors.New("no valid connect address")
 			}
 			addrString := addmgr.NetAddressKey(addr.NetAddress())
-			return addrStringToNetAddr(addrString)
+			return s.dialer.ResolveAddr(addrString)
 		}
 	}
 	// Create a connection manager.
@@ -177,7 +205,7 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 		permanentPeers = cfg.AddPeers
 	}
 	for _, addr := range permanentPeers {
-		tcpAddr, err := addrStringToNetAddr(addr)
+		tcpAddr, err := s.dialer.ResolveAddr(addr)
 		if err != nil {
 			return nil, err
 		}
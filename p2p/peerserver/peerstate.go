@@ -12,7 +12,7 @@ type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
+	banned          *banList
 	outboundGroups  map[string]int
 }
 
@@ -43,14 +43,10 @@ func (ps *peerState) forAllOutboundPeers(closure func(sp *serverPeer)) {
 }
 
 func (ps *peerState) IsBanPeer(host string) bool {
-	if banEnd, ok := ps.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			log.Debug(fmt.Sprintf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd)))
-			return true
-		}
-		log.Info("Peer is no longer banned", "peer", host)
-		delete(ps.banned, host)
+	if ban := ps.banned.BannedBy(host); ban != nil {
+		log.Debug(fmt.Sprintf("Peer %s is banned by %s for another %v - disconnecting",
+			host, ban.Subnet, time.Until(ban.Until)))
+		return true
 	}
 	return false
 }
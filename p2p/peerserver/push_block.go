@@ -1,11 +1,35 @@
 package peerserver
 
 import (
+	"errors"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/services/bloom"
+	"github.com/Qitmeer/qitmeer/services/cmpctblock"
 )
 
+// errHistoricBlockLimited is returned when a historic block isn't served
+// because the upload target is reached.
+var errHistoricBlockLimited = errors.New("upload target reached, historic blocks are no longer served")
+
+// checkHistoricBlock disconnects the peer requesting a historic block once the
+// upload target is reached, so that it fetches the block from another peer.
+func (s *PeerServer) checkHistoricBlock(sp *serverPeer, block *types.SerializedBlock, doneChan chan<- struct{}) error {
+	if !s.isHistoricBlockLimited(sp, block) {
+		return nil
+	}
+	log.Debug("Upload target reached, disconnecting peer requesting a "+
+		"historic block", "peer", sp, "hash", block.Hash())
+	sp.Disconnect()
+
+	if doneChan != nil {
+		doneChan <- struct{}{}
+	}
+	return errHistoricBlockLimited
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *PeerServer) pushBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
@@ -20,6 +44,9 @@ func (s *PeerServer) pushBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan
 		}
 		return err
 	}
+	if err := s.checkHistoricBlock(sp, block, doneChan); err != nil {
+		return err
+	}
 
 	// Once we have fetched data wait for any previous operation to finish.
 	if waitChan != nil {
@@ -32,3 +59,98 @@ func (s *PeerServer) pushBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan
 
 	return nil
 }
+
+// pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
+// the connected peer.  Since a merkle block requires the peer to have a filter
+// loaded, this call will simply be ignored if there is no filter loaded.  An
+// error is returned if the block hash is not known.
+func (s *PeerServer) pushMerkleBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+	// Do not send a response if the peer doesn't have a filter loaded.
+	if !sp.Filter().IsLoaded() {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return nil
+	}
+
+	block, err := sp.server.BlockManager.GetChain().FetchBlockByHash(hash)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash", "hash", hash,
+			"error", err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	if err := s.checkHistoricBlock(sp, block, doneChan); err != nil {
+		return err
+	}
+
+	// Generate a merkle block by filtering the requested block according
+	// to the filter for the peer.
+	merkle, matchedTxIndices := bloom.NewMerkleBlock(block, sp.Filter())
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	// Send the merkleblock.  Only send the done channel with this message
+	// if no transactions will be sent afterwards.
+	var dc chan<- struct{}
+	if len(matchedTxIndices) == 0 {
+		dc = doneChan
+	}
+	sp.QueueMessage(merkle, dc)
+
+	// Finally, send any matched transactions.
+	blkTransactions := block.Block().Transactions
+	for i, txIndex := range matchedTxIndices {
+		// Only send the done channel on the final transaction.
+		var dc chan<- struct{}
+		if i == len(matchedTxIndices)-1 {
+			dc = doneChan
+		}
+		sp.QueueMessage(&message.MsgTx{Tx: blkTransactions[txIndex]}, dc)
+	}
+
+	return nil
+}
+
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  An error is returned if the block hash is not known.
+func (s *PeerServer) pushCmpctBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+	block, err := sp.server.BlockManager.GetChain().FetchBlockByHash(hash)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash", "hash", hash,
+			"error", err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	if err := s.checkHistoricBlock(sp, block, doneChan); err != nil {
+		return err
+	}
+	msg, err := cmpctblock.New(block)
+	if err != nil {
+		log.Warn("Unable to build the compact block", "hash", hash,
+			"error", err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	sp.QueueMessage(msg, doneChan)
+
+	return nil
+}
@@ -86,7 +86,18 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 		peers := make([]*serverPeer, 0)
 		msg.reply <- peers
 	case disconnectNodeMsg:
-		msg.reply <- errors.New("not support")
+		found := false
+		state.forAllPeers(func(sp *serverPeer) {
+			if msg.cmp(sp) {
+				found = true
+				sp.Disconnect()
+			}
+		})
+		if found {
+			msg.reply <- nil
+		} else {
+			msg.reply <- errors.New("peer not found")
+		}
 
 	case getPeerMsg:
 		has := false
@@ -16,6 +16,7 @@ import (
 	"github.com/Qitmeer/qitmeer/p2p/addmgr"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/services/cmpctblock"
 	"github.com/satori/go.uuid"
 	"time"
 )
@@ -100,6 +101,14 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *message.MsgVersion) *message.
 	// Choose whether or not to relay transactions.
 	sp.setDisableRelayTx(msg.DisableRelayTx)
 
+	// Tell the peer the blocks can be sent as compact blocks.  The block
+	// manager asks the peers delivering the new blocks to send them
+	// unannounced.
+	if !sp.server.cfg.NoCmpctBlocks &&
+		uint32(msg.ProtocolVersion) >= protocol.CmpctBlockVersion {
+		p.QueueMessage(message.NewMsgSendCmpct(false), nil)
+	}
+
 	// Add the remote peer time as a sample for creating an offset against
 	// the local clock to keep the network time in sync.
 	sp.server.TimeSource.AddTimeSample(p.Addr(), msg.Timestamp)
@@ -302,12 +311,14 @@ func (sp *serverPeer) OnGetHeaders(p *peer.Peer, msg *message.MsgGetHeaders) {
 
 	headersMsg := message.NewMsgHeaders(chain.BestSnapshot().GraphState)
 	for i := 0; i < hsLen; i++ {
-		blockHead, err := chain.HeaderByHash(hashSlice[i])
+		// The parents are sent along with the header so that light
+		// nodes can rebuild the DAG without the block bodies.
+		block, err := chain.FetchBlockByHash(hashSlice[i])
 		if err != nil {
 			log.Trace(fmt.Sprintf("Sorry, there are not these blocks %s for %s", hashSlice[i].String(), p.String()))
 			return
 		}
-		headersMsg.AddBlockHeader(&blockHead)
+		headersMsg.AddBlockHeaderWithParents(&block.Block().Header, block.Block().Parents)
 	}
 	if len(headersMsg.Headers) > 0 {
 		p.QueueMessage(headersMsg, nil)
@@ -389,6 +400,10 @@ func (sp *serverPeer) OnGetData(p *peer.Peer, msg *message.MsgGetData) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan)
 		case message.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
+		case message.InvTypeFilteredBlock:
+			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
+		case message.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
 			log.Warn("Unknown type in inventory request", "type", iv.Type)
 			continue
@@ -499,9 +514,7 @@ func (sp *serverPeer) OnTx(p *peer.Peer, msg *message.MsgTx) {
 
 // OnMemPool
 func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
-	if sp.server.services&protocol.Bloom != protocol.Bloom {
-		log.Debug(fmt.Sprintf("peer %v sent mempool request with bloom filtering disabled -- disconnecting", sp))
-		sp.Disconnect()
+	if !sp.enforceBloomService("mempool") {
 		return
 	}
 
@@ -511,7 +524,13 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 	txDescs := txMemPool.TxDescs()
 	invMsg := message.NewMsgInvSizeHint(uint(len(txDescs)))
 
+	// Only the transactions matching the bloom filter of the peer are
+	// announced when it has one loaded.
+	filter := sp.Filter()
 	for _, txDesc := range txDescs {
+		if filter.IsLoaded() && !filter.MatchTxAndUpdate(txDesc.Tx) {
+			continue
+		}
 		iv := message.NewInvVect(message.InvTypeTx, txDesc.Tx.Hash())
 		invMsg.AddInvVect(iv)
 		if len(invMsg.InvList)+1 > message.MaxInvPerMsg {
@@ -523,3 +542,249 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 		sp.QueueMessage(invMsg, nil)
 	}
 }
+
+// enforceBloomService disconnects the peer and returns false when bloom
+// filtering is not served by the server.
+func (sp *serverPeer) enforceBloomService(cmd string) bool {
+	if sp.server.services&protocol.Bloom == protocol.Bloom {
+		return true
+	}
+	log.Debug(fmt.Sprintf("peer %v sent %s request with bloom filtering "+
+		"disabled -- disconnecting", sp, cmd))
+	sp.Disconnect()
+	return false
+}
+
+// OnFilterAdd is invoked when a peer receives a filteradd message and is used
+// to add an element to the loaded bloom filter of the peer.
+func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *message.MsgFilterAdd) {
+	if !sp.enforceBloomService(msg.Command()) {
+		return
+	}
+
+	filter := sp.Filter()
+	if !filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("peer %v sent a filteradd request with no "+
+			"filter loaded -- disconnecting", sp))
+		sp.addBanScore(100, 0, msg.Command())
+		sp.Disconnect()
+		return
+	}
+
+	filter.Add(msg.Data)
+}
+
+// OnFilterClear is invoked when a peer receives a filterclear message and is
+// used to unload the bloom filter of the peer.
+func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *message.MsgFilterClear) {
+	if !sp.enforceBloomService(msg.Command()) {
+		return
+	}
+
+	filter := sp.Filter()
+	if !filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("peer %v sent a filterclear request with no "+
+			"filter loaded -- disconnecting", sp))
+		sp.addBanScore(100, 0, msg.Command())
+		sp.Disconnect()
+		return
+	}
+
+	filter.Unload()
+}
+
+// OnFilterLoad is invoked when a peer receives a filterload message and is
+// used to load the bloom filter that transactions and blocks relayed to the
+// peer are filtered by.
+func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *message.MsgFilterLoad) {
+	if !sp.enforceBloomService(msg.Command()) {
+		return
+	}
+
+	// Loading a filter turns transaction relay back on for peers which
+	// asked not to receive transactions in their version message.
+	sp.setDisableRelayTx(false)
+
+	sp.Filter().Reload(msg)
+}
+
+// enforceCFService disconnects the peer and returns false when committed
+// filters are not served by the server.
+func (sp *serverPeer) enforceCFService() bool {
+	if sp.server.services&protocol.CF == protocol.CF &&
+		sp.server.CfIndex != nil {
+		return true
+	}
+	log.Debug(fmt.Sprintf("peer %v sent a committed filter request with "+
+		"cfilters disabled -- disconnecting", sp))
+	sp.Disconnect()
+	return false
+}
+
+// OnGetCFilter is invoked when a peer receives a getcfilter message and is
+// used to respond with the committed filter of the requested block.
+func (sp *serverPeer) OnGetCFilter(_ *peer.Peer, msg *message.MsgGetCFilter) {
+	// Ignore getcfilter requests if not in sync.
+	if !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+	if !sp.enforceCFService() {
+		return
+	}
+
+	filterBytes, err := sp.server.CfIndex.FilterByBlockHash(&msg.BlockHash,
+		msg.FilterType)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Unable to fetch committed filter %v for "+
+			"%v: %v", msg.FilterType, msg.BlockHash, err))
+		return
+	}
+	if filterBytes == nil {
+		log.Trace(fmt.Sprintf("No committed filter for %v for %s",
+			msg.BlockHash, sp))
+		return
+	}
+
+	filterMsg := message.NewMsgCFilter(&msg.BlockHash, msg.FilterType,
+		filterBytes)
+	sp.QueueMessage(filterMsg, nil)
+}
+
+// OnGetCFHeaders is invoked when a peer receives a getcfheaders message and is
+// used to respond with the filter hashes of the requested range of blocks.
+func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *message.MsgGetCFHeaders) {
+	// Ignore getcfheaders requests if not in sync.
+	if !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+	if !sp.enforceCFService() {
+		return
+	}
+
+	chain := sp.server.BlockManager.GetChain()
+	stopOrder, err := chain.BlockOrderByHash(&msg.StopHash)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Unknown stop hash %v in getcfheaders "+
+			"from %s: %v", msg.StopHash, sp, err))
+		return
+	}
+	if msg.StartOrder > stopOrder ||
+		stopOrder-msg.StartOrder >= message.MaxCFHeadersPerMsg {
+		log.Debug(fmt.Sprintf("Invalid getcfheaders range %d-%d from %s",
+			msg.StartOrder, stopOrder, sp))
+		return
+	}
+
+	// Fetch the hashes of the blocks in the range along with the block
+	// preceding it, whose filter header the range is chained to.
+	var blockHashes []*hash.Hash
+	firstOrder := msg.StartOrder
+	if firstOrder > 0 {
+		firstOrder--
+	}
+	for order := firstOrder; order <= stopOrder; order++ {
+		blockHash, err := chain.BlockHashByOrder(order)
+		if err != nil {
+			log.Debug(fmt.Sprintf("No block at order %d: %v", order, err))
+			return
+		}
+		blockHashes = append(blockHashes, blockHash)
+	}
+
+	headersMsg := message.NewMsgCFHeaders()
+	headersMsg.FilterType = msg.FilterType
+	headersMsg.StopHash = msg.StopHash
+	if msg.StartOrder > 0 {
+		prevHeader, err := sp.server.CfIndex.FilterHeaderByBlockHash(
+			blockHashes[0], msg.FilterType)
+		if err != nil || prevHeader == nil {
+			log.Debug(fmt.Sprintf("No committed filter header for %v",
+				blockHashes[0]))
+			return
+		}
+		headersMsg.PrevFilterHeader = *prevHeader
+		blockHashes = blockHashes[1:]
+	}
+
+	filterHashes, err := sp.server.CfIndex.FilterHashesByBlockHashes(
+		blockHashes, msg.FilterType)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Unable to fetch committed filter hashes: %v",
+			err))
+		return
+	}
+	for i, filterHash := range filterHashes {
+		if filterHash == nil {
+			log.Debug(fmt.Sprintf("No committed filter for %v",
+				blockHashes[i]))
+			return
+		}
+		headersMsg.AddCFHash(filterHash)
+	}
+
+	sp.QueueMessage(headersMsg, nil)
+}
+
+// OnGetCFTypes is invoked when a peer receives a getcftypes message and is
+// used to respond with the committed filter types supported by the server.
+func (sp *serverPeer) OnGetCFTypes(_ *peer.Peer, msg *message.MsgGetCFTypes) {
+	if !sp.enforceCFService() {
+		return
+	}
+
+	cfTypesMsg := message.NewMsgCFTypes([]message.FilterType{
+		message.GCSFilterRegular,
+	})
+	sp.QueueMessage(cfTypesMsg, nil)
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock message.  The
+// block manager reconstructs the block from the transaction pool, like for
+// the blocks further receives are blocked until the compact block is handled.
+func (sp *serverPeer) OnCmpctBlock(p *peer.Peer, msg *message.MsgCmpctBlock) {
+	if sp.server.cfg.NoCmpctBlocks {
+		return
+	}
+	blockHash := msg.Header.BlockHash()
+	p.AddKnownInventory(message.NewInvVect(message.InvTypeBlock, &blockHash))
+
+	sp.server.BlockManager.QueueCmpctBlock(msg, sp.syncPeer)
+	score := <-sp.syncPeer.BlockProcessed
+	if score > connmgr.NoneScore {
+		sp.addBanScore(0, uint32(score), "oncmpctblock")
+	}
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn message and is
+// used to send the transactions of a compact block the peer misses.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *message.MsgGetBlockTxn) {
+	if sp.server.cfg.NoCmpctBlocks {
+		return
+	}
+	block, err := sp.server.BlockManager.GetChain().FetchBlockByHash(&msg.BlockHash)
+	if err != nil {
+		log.Debug("Unable to fetch requested block hash", "hash",
+			msg.BlockHash, "error", err)
+		return
+	}
+	txnMsg, err := cmpctblock.BlockTxn(block, msg)
+	if err != nil {
+		sp.addBanScore(0, uint32(connmgr.ManyScore), "ongetblocktxn")
+		log.Debug("Invalid getblocktxn", "peer", sp, "error", err)
+		return
+	}
+	sp.QueueMessage(txnMsg, nil)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn message, which
+// completes a compact block waiting in the block manager.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *message.MsgBlockTxn) {
+	if sp.server.cfg.NoCmpctBlocks {
+		return
+	}
+	sp.server.BlockManager.QueueBlockTxn(msg, sp.syncPeer)
+	score := <-sp.syncPeer.BlockProcessed
+	if score > connmgr.NoneScore {
+		sp.addBanScore(0, uint32(score), "onblocktxn")
+	}
+}
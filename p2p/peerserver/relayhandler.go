@@ -1,11 +1,12 @@
 package peerserver
 
 import (
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
-	"github.com/Qitmeer/qitmeer/services/mempool"
+	"github.com/Qitmeer/qitmeer/services/cmpctblock"
 	"sync/atomic"
 )
 
@@ -14,10 +15,25 @@ import (
 func (s *PeerServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 	log.Trace("handleRelayInvMsg", "msg", msg)
 	var gs *blockdag.GraphState
+	var cmpctBlock *message.MsgCmpctBlock
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
+		// If the inventory is a block and the peer is in the high
+		// bandwidth mode of the compact blocks, send the compact block
+		// without announcing it.
+		if msg.invVect.Type == message.InvTypeBlock && sp.WantsCmpctBlocks() &&
+			!s.cfg.NoCmpctBlocks && !sp.IsKnownInventory(msg.invVect) {
+			if cmpctBlock == nil {
+				cmpctBlock = s.newCmpctBlock(&msg.invVect.Hash)
+			}
+			if cmpctBlock != nil {
+				sp.AddKnownInventory(msg.invVect)
+				sp.QueueMessage(cmpctBlock, nil)
+				return
+			}
+		}
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
@@ -44,12 +60,23 @@ func (s *PeerServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			txD, ok := msg.data.(*mempool.TxDesc)
-			if ok {
-				feeFilter := atomic.LoadInt64(&sp.feeFilter)
-				if feeFilter > 0 && txD.FeePerKB < feeFilter {
-					return
-				}
+			txD, ok := msg.data.(*types.TxDesc)
+			if !ok {
+				log.Warn("Underlying data for tx inv relay is not a " +
+					"transaction")
+				return
+			}
+
+			feeFilter := atomic.LoadInt64(&sp.feeFilter)
+			if feeFilter > 0 && txD.FeePerKB < feeFilter {
+				return
+			}
+
+			// Don't relay the transaction if there is a bloom
+			// filter loaded and the transaction doesn't match it.
+			filter := sp.Filter()
+			if filter.IsLoaded() && !filter.MatchTxAndUpdate(txD.Tx) {
+				return
 			}
 		} else if msg.invVect.Type == message.InvTypeBlock {
 			gs = s.BlockManager.GetChain().BestSnapshot().GraphState
@@ -70,3 +97,21 @@ func (s *PeerServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 	})
 	log.Trace("handleRelayInvMsg done")
 }
+
+// newCmpctBlock returns the compact block of the relayed block, or nil when it
+// can't be built.
+func (s *PeerServer) newCmpctBlock(blockHash *hash.Hash) *message.MsgCmpctBlock {
+	block, err := s.BlockManager.GetChain().FetchBlockByHash(blockHash)
+	if err != nil {
+		log.Warn("Unable to fetch the relayed block", "hash", blockHash,
+			"error", err)
+		return nil
+	}
+	msg, err := cmpctblock.New(block)
+	if err != nil {
+		log.Warn("Unable to build the compact block", "hash", blockHash,
+			"error", err)
+		return nil
+	}
+	return msg
+}
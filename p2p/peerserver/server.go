@@ -20,11 +20,11 @@ import (
 	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/blkmgr"
+	"github.com/Qitmeer/qitmeer/services/index"
 	"github.com/Qitmeer/qitmeer/services/mempool"
 	"github.com/Qitmeer/qitmeer/version"
 	"github.com/satori/go.uuid"
 	"net"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,7 +32,7 @@ import (
 
 const (
 	// the default services supported by the node
-	defaultServices = protocol.Full | protocol.CF
+	defaultServices = protocol.Full | protocol.Bloom | protocol.CF
 
 	// the default services that are required to be supported
 	defaultRequiredServices = protocol.Full
@@ -51,6 +51,10 @@ const (
 
 	// connection timeout setting
 	defaultConnectTimeout = time.Second * 30
+
+	// maxUnreachableTries is the number of addresses skipped at most
+	// while looking for a reachable address to connect to.
+	maxUnreachableTries = 100
 )
 
 var (
@@ -71,6 +75,9 @@ type PeerServer struct {
 	bytesReceived uint64 // Total bytes received from all peers since start.
 	bytesSent     uint64 // Total bytes sent by all peers since start.
 
+	// The recent traffic and the upload target.
+	netStats *netStats
+
 	started  int32 // p2p server start flag
 	shutdown int32 // p2p server stop flag
 
@@ -99,10 +106,20 @@ type PeerServer struct {
 	TimeSource   blockchain.MedianTimeSource
 	BlockManager *blkmgr.BlockManager
 	TxMemPool    *mempool.TxPool
+	CfIndex      *index.CfIndex
 
 	services protocol.ServiceFlag
 
 	state *peerState
+
+	dialer *connmgr.Dialer
+
+	banList *banList
+
+	// The outbound addresses which failed the v2 handshake, they are
+	// connected with the v1 transport.
+	v1Peers    map[string]struct{}
+	v1PeersMtx sync.Mutex
 }
 
 // OutboundGroupCount returns the number of peers connected to the given
@@ -134,7 +151,9 @@ func (s *PeerServer) inboundPeerConnected(c *connmgr.ConnReq) {
 // manager of the attempt.
 func (s *PeerServer) outboundPeerConnected(c *connmgr.ConnReq) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	peerCfg := newPeerConfig(sp)
+	peerCfg.V2Transport = s.useV2Transport(c)
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		log.Debug(fmt.Sprintf("Cannot create outbound peer %s: %v", c.Addr, err))
 		s.connManager.Disconnect(c.ID())
@@ -148,6 +167,43 @@ func (s *PeerServer) outboundPeerConnected(c *connmgr.ConnReq) {
 	s.addrManager.Attempt(sp.NA())
 }
 
+// useV2Transport returns whether to initiate the v2 transport with an outbound
+// connection.  The remote peer must advertise it, or be a permanent peer whose
+// services may be unknown, and must not have failed the v2 handshake before.
+func (s *PeerServer) useV2Transport(c *connmgr.ConnReq) bool {
+	if !s.cfg.V2Transport {
+		return false
+	}
+	addr := c.Addr.String()
+	s.v1PeersMtx.Lock()
+	_, v1 := s.v1Peers[addr]
+	s.v1PeersMtx.Unlock()
+	if v1 {
+		return false
+	}
+	if c.Permanent {
+		return true
+	}
+	na, err := s.addrManager.DeserializeNetAddress(addr)
+	if err != nil {
+		return false
+	}
+	return protocol.HasServices(s.addrManager.Services(na), protocol.P2PV2)
+}
+
+// v2Failed records an outbound peer which failed the v2 handshake, so that it
+// is connected with the v1 transport from now on.
+func (s *PeerServer) v2Failed(sp *serverPeer) {
+	log.Debug("Peer failed the v2 transport handshake, falling back to v1", "peer", sp.Addr())
+	s.v1PeersMtx.Lock()
+	s.v1Peers[sp.Addr()] = struct{}{}
+	s.v1PeersMtx.Unlock()
+	if na := sp.NA(); na != nil {
+		services := s.addrManager.Services(na)
+		s.addrManager.SetServices(na, services&^protocol.P2PV2)
+	}
+}
+
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
 
@@ -172,10 +228,16 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnSyncDAG:        sp.OnSyncDAG,
 			OnSyncPoint:      sp.OnSyncPoint,
 			OnFeeFilter:      sp.OnFeeFilter,
+			OnGetCFilter:     sp.OnGetCFilter,
+			OnGetCFHeaders:   sp.OnGetCFHeaders,
+			OnGetCFTypes:     sp.OnGetCFTypes,
+			OnFilterAdd:      sp.OnFilterAdd,
+			OnFilterClear:    sp.OnFilterClear,
+			OnFilterLoad:     sp.OnFilterLoad,
+			OnCmpctBlock:     sp.OnCmpctBlock,
+			OnGetBlockTxn:    sp.OnGetBlockTxn,
+			OnBlockTxn:       sp.OnBlockTxn,
 			//OnHeaders:        sp.OnHeaders,
-			//OnGetCFilter:     sp.OnGetCFilter,
-			//OnGetCFHeaders:   sp.OnGetCFHeaders,
-			//OnGetCFTypes:     sp.OnGetCFTypes,
 		},
 		NewestGS:         sp.newestGS,
 		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
@@ -186,6 +248,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		DisableRelayTx:   sp.server.cfg.BlocksOnly,
 		ProtocolVersion:  maxProtocolVersion,
 		TrickleInterval:  sp.server.cfg.TrickleInterval,
+		V2Transport:      sp.server.cfg.V2Transport,
 	}
 }
 
@@ -215,43 +278,6 @@ func isWhitelisted(cfg *config.Config, addr net.Addr) bool {
 	return false
 }
 
-// addrStringToNetAddr takes an address in the form of 'host:port' and returns
-// a net.Addr which maps to the original address with any host names resolved
-// to IP addresses.
-func addrStringToNetAddr(addr string) (net.Addr, error) {
-	host, strPort, err := net.SplitHostPort(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	port, err := strconv.Atoi(strPort)
-	if err != nil {
-		return nil, err
-	}
-
-	// Skip if host is already an IP address.
-	if ip := net.ParseIP(host); ip != nil {
-		return &net.TCPAddr{
-			IP:   ip,
-			Port: port,
-		}, nil
-	}
-
-	// Attempt to look up an IP address associated with the parsed host.
-	ips, err := net.LookupIP(host)
-	if err != nil {
-		return nil, err
-	}
-	if len(ips) == 0 {
-		return nil, fmt.Errorf("no addresses found for %s", host)
-	}
-
-	return &net.TCPAddr{
-		IP:   ips[0],
-		Port: port,
-	}, nil
-}
-
 func (p *PeerServer) Start() error {
 
 	// Already started?
@@ -304,12 +330,38 @@ func (s *PeerServer) AddPeer(sp *serverPeer) {
 // counter for the server.  It is safe for concurrent access.
 func (s *PeerServer) AddBytesReceived(bytesReceived uint64) {
 	atomic.AddUint64(&s.bytesReceived, bytesReceived)
+	s.netStats.addRecv(bytesReceived)
 }
 
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *PeerServer) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.netStats.addSent(bytesSent)
+}
+
+// NetTotals returns the bytes received and sent since start, the recent
+// rates and the state of the upload target.  It is safe for concurrent access.
+func (s *PeerServer) NetTotals() *NetTotals {
+	now := s.netStats.now()
+	return &NetTotals{
+		BytesRecv:    atomic.LoadUint64(&s.bytesReceived),
+		BytesSent:    atomic.LoadUint64(&s.bytesSent),
+		Time:         now,
+		Rates:        s.netStats.rates(now),
+		UploadTarget: s.netStats.uploadTarget(now),
+	}
+}
+
+// isHistoricBlockLimited returns whether the block is too old to be served to
+// the peer because the upload target is reached.  The whitelisted peers are
+// always served.
+func (s *PeerServer) isHistoricBlockLimited(sp *serverPeer, block *types.SerializedBlock) bool {
+	if sp.isWhitelisted || s.netStats.uploadTarget(s.netStats.now()).ServeHistoricalBlocks {
+		return false
+	}
+	age := s.TimeSource.AdjustedTime().Sub(block.Block().Header.Timestamp)
+	return age > historicBlockAge
 }
 
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
@@ -317,6 +369,9 @@ func (s *PeerServer) AddBytesSent(bytesSent uint64) {
 func (s *PeerServer) peerDoneHandler(sp *serverPeer) {
 	log.Trace("start peerDoneHandler")
 	sp.WaitForDisconnect()
+	if !sp.Inbound() && sp.V2Failed() {
+		s.v2Failed(sp)
+	}
 	s.donePeers <- sp
 
 	// Only tell block manager we are gone if we ever told it we existed.
@@ -341,21 +396,29 @@ func (s *PeerServer) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
+		banned:          s.banList,
 		outboundGroups:  make(map[string]int),
 	}
 	s.state = state
 
 	if !s.cfg.DisableDNSSeed {
-		// Add peers discovered through DNS to the address manager.
-		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, net.LookupIP, func(addrs []*types.NetAddress) {
-			// Bitcoind uses a lookup of the dns seeder here. This
-			// is rather strange since the values looked up by the
-			// DNS seed lookups will vary quite a lot.
-			// to replicate this behaviour we put all addresses as
-			// having come from the first one.
-			s.addrManager.AddAddresses(addrs, addrs[0])
-		})
+		if lookup := s.dialer.LookupFunc(); lookup != nil {
+			// Add peers discovered through DNS to the address manager.
+			connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, lookup, func(addrs []*types.NetAddress) {
+				// Bitcoind uses a lookup of the dns seeder here. This
+				// is rather strange since the values looked up by the
+				// DNS seed lookups will vary quite a lot.
+				// to replicate this behaviour we put all addresses as
+				// having come from the first one.
+				s.addrManager.AddAddresses(addrs, addrs[0])
+			})
+		} else {
+			// Behind a proxy, connect to the seeds by name and
+			// learn the addresses from the nodes they resolve to.
+			connmgr.SeedFromProxy(s.chainParams, func(addr net.Addr) {
+				go s.connManager.Connect(&connmgr.ConnReq{Addr: addr})
+			})
+		}
 	}
 	go s.connManager.Start()
 
@@ -431,7 +494,7 @@ func (s *PeerServer) BroadcastMessage(msg message.Message, exclPeers ...*serverP
 
 // Dial connects to the address on the named network.
 func (s *PeerServer) Dial(network, addr string) (net.Conn, error) {
-	return net.DialTimeout(network, addr, defaultConnectTimeout)
+	return s.dialer.Dial(network, addr)
 }
 
 // ConnectedCount returns the number of currently connected peers.
@@ -457,19 +520,43 @@ func (s *PeerServer) HasPeer(uuid uuid.UUID) bool {
 	return <-replyChan
 }
 
-func (s *PeerServer) GetBanlist() map[string]time.Time {
-	return s.state.banned
+// GetBanlist returns the bans which haven't expired, sorted by subnet.
+func (s *PeerServer) GetBanlist() []*BanEntry {
+	return s.banList.Entries()
 }
 
-func (s *PeerServer) RemoveBan(host string) {
-	if len(host) == 0 {
-		s.state.banned = map[string]time.Time{}
+// SetBan bans the subnet, in CIDR notation or a single IP address, for the
+// duration and disconnects its peers.
+func (s *PeerServer) SetBan(subnet string, dur time.Duration, reason string) error {
+	ipNet, err := ParseSubnet(subnet)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Banned subnet %s for %v: %s", ipNet, dur, reason))
+	s.banList.Ban(ipNet, time.Now().Add(dur), reason)
+
+	replyChan := make(chan error)
+	s.query <- disconnectNodeMsg{
+		cmp: func(sp *serverPeer) bool {
+			return sp.NA() != nil && ipNet.Contains(sp.NA().IP)
+		},
+		reply: replyChan,
+	}
+	<-replyChan
+	return nil
+}
+
+// RemoveBan removes the ban of the subnet, or all the bans when subnet is
+// empty.  It returns whether a ban was removed.
+func (s *PeerServer) RemoveBan(subnet string) (bool, error) {
+	if len(subnet) == 0 {
 		log.Trace("Remove all ban")
-		return
+		return s.banList.Unban(nil), nil
 	}
-	_, ok := s.state.banned[host]
-	if ok {
-		delete(s.state.banned, host)
-		log.Trace(fmt.Sprintf("RemoveBan:%s", host))
+	ipNet, err := ParseSubnet(subnet)
+	if err != nil {
+		return false, err
 	}
+	log.Trace(fmt.Sprintf("RemoveBan:%s", subnet))
+	return s.banList.Unban(ipNet), nil
 }
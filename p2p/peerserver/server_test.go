@@ -0,0 +1,56 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+package peerserver
+
+import (
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/p2p/addmgr"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func Test_V2Fallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peerserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &PeerServer{
+		cfg:         &config.Config{V2Transport: true},
+		addrManager: addmgr.New(dir, 0, nil),
+		v1Peers:     make(map[string]struct{}),
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("173.194.115.66"), Port: 8130}
+	na := types.NewNetAddressIPPort(addr.IP, uint16(addr.Port),
+		protocol.Full|protocol.P2PV2)
+	s.addrManager.AddAddress(na, na)
+	c := &connmgr.ConnReq{Addr: addr}
+	if !s.useV2Transport(c) {
+		t.Fatal("v2 not used with a peer advertising it")
+	}
+
+	// The peer failed the v2 handshake, it is connected again with v1.
+	sp := newServerPeer(s, false)
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{}, addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.v2Failed(sp)
+	if s.useV2Transport(c) {
+		t.Fatal("v2 used again with a peer which failed it")
+	}
+	if protocol.HasServices(s.addrManager.Services(na), protocol.P2PV2) {
+		t.Fatal("failed peer still advertised as v2")
+	}
+	if s.useV2Transport(&connmgr.ConnReq{Addr: addr, Permanent: true}) {
+		t.Fatal("v2 used again with a permanent peer which failed it")
+	}
+}
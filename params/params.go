@@ -75,6 +75,29 @@ type ConsensusDeployment struct {
 	ExpireTime uint64
 }
 
+// Constants that define the deployment offset in the deployments field of the
+// parameters for each deployment.  This is useful to be able to get the details
+// of a specific deployment by name.
+const (
+	// DeploymentStateRoot defines the rule change deployment ID for the
+	// commitment to the utxo set in the StateRoot of block headers.
+	DeploymentStateRoot = iota
+
+	// DeploymentAssets defines the rule change deployment ID for the asset
+	// transactions.
+	DeploymentAssets
+
+	// DeploymentContracts defines the rule change deployment ID for the
+	// contract transactions.
+	DeploymentContracts
+
+	// NOTE: DefinedDeployments must always come last since it is used to
+	// determine how many defined deployments there currently are.
+
+	// DefinedDeployments is the number of currently defined deployments.
+	DefinedDeployments
+)
+
 // Params defines a qitmeer network by its parameters.  These parameters may be
 // used by qitmeer applications to differentiate networks as well as addresses
 // and keys for one network from those intended for use on another network.
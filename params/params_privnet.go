@@ -10,6 +10,7 @@ import (
 	"github.com/Qitmeer/qitmeer/common"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"math"
 	"math/big"
 	"time"
 )
@@ -113,7 +114,30 @@ var PrivNetParams = Params{
 	Checkpoints: nil,
 
 	// Consensus rule change deployments.
-	Deployments: map[uint32][]ConsensusDeployment{},
+	//
+	// The deployments are defined for the block version generated on the
+	// test networks and activated as soon as the miners signal them.
+	RuleChangeActivationThreshold: 108, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       144,
+	Deployments: map[uint32][]ConsensusDeployment{
+		12: {
+			DeploymentStateRoot: {
+				BitNumber:  0,
+				StartTime:  0,
+				ExpireTime: math.MaxInt64,
+			},
+			DeploymentAssets: {
+				BitNumber:  1,
+				StartTime:  0,
+				ExpireTime: math.MaxInt64,
+			},
+			DeploymentContracts: {
+				BitNumber:  2,
+				StartTime:  0,
+				ExpireTime: math.MaxInt64,
+			},
+		},
+	},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "R",
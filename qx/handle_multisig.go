@@ -0,0 +1,381 @@
+package qx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/common/marshal"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+// The multisig commands assume every input of the transaction spends an
+// output paying to the P2SH address of the passed m-of-n redeem script, which
+// is the case of a custody address funding the transaction on its own.
+
+// netParams returns the parameters of the passed network name.
+func netParams(network string) (*params.Params, error) {
+	switch network {
+	case "mainnet":
+		return &params.MainNetParams, nil
+	case "testnet":
+		return &params.TestNetParams, nil
+	case "privnet":
+		return &params.PrivNetParams, nil
+	case "mixnet":
+		return &params.MixNetParams, nil
+	}
+	return nil, fmt.Errorf("unknown network : %s", network)
+}
+
+func decodeRawTx(rawTxStr string) (*types.Transaction, error) {
+	if len(rawTxStr)%2 != 0 {
+		return nil, fmt.Errorf("invaild raw transaction : %s", rawTxStr)
+	}
+	serializedTx, err := hex.DecodeString(rawTxStr)
+	if err != nil {
+		return nil, err
+	}
+	var tx types.Transaction
+	err = tx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// decodeRedeemScript decodes a multisig redeem script and returns it with the
+// public keys it lists, the number of signatures it requires and the pkScript
+// paying to its P2SH address.
+func decodeRedeemScript(redeemScriptStr string, param *params.Params) ([]byte, []types.Address, int, []byte, error) {
+	redeemScript, err := hex.DecodeString(redeemScriptStr)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	class, pubKeys, nRequired, err := txscript.ExtractPkScriptAddrs(redeemScript, param)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	if class != txscript.MultiSigTy {
+		return nil, nil, 0, nil, fmt.Errorf("not a multisig redeem script : %s", redeemScriptStr)
+	}
+	addr, err := address.NewAddressScriptHashFromHash(hash.Hash160(redeemScript), param)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	return redeemScript, pubKeys, nRequired, pkScript, nil
+}
+
+// MultisigNew returns the m-of-n redeem script of the passed public keys and
+// the P2SH address paying to it.
+func MultisigNew(nRequired int, pubKeyStrs []string, network string) (string, string, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return "", "", err
+	}
+	if nRequired < 1 || nRequired > len(pubKeyStrs) {
+		return "", "", fmt.Errorf("invalid number of required signatures : %d of %d", nRequired, len(pubKeyStrs))
+	}
+	pubKeys := make([]*address.SecpPubKeyAddress, 0, len(pubKeyStrs))
+	for _, pubKeyStr := range pubKeyStrs {
+		pubKeyBytes, err := hex.DecodeString(pubKeyStr)
+		if err != nil {
+			return "", "", err
+		}
+		pubKey, err := address.NewSecpPubKeyAddress(pubKeyBytes, param)
+		if err != nil {
+			return "", "", err
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	redeemScript, err := txscript.MultiSigScript(pubKeys, nRequired)
+	if err != nil {
+		return "", "", err
+	}
+	addr, err := address.NewAddressScriptHashFromHash(hash.Hash160(redeemScript), param)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(redeemScript), addr.Encode(), nil
+}
+
+// TxSignMultisig adds the signatures of the passed private key to every input
+// of the transaction, keeping the signatures already present.
+func TxSignMultisig(privkeyStr string, redeemScriptStr string, rawTxStr string, network string) (string, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return "", err
+	}
+	privkeyByte, err := hex.DecodeString(privkeyStr)
+	if err != nil {
+		return "", err
+	}
+	if len(privkeyByte) != 32 {
+		return "", fmt.Errorf("invaid ec private key bytes: %d", len(privkeyByte))
+	}
+	privateKey, pubKey := ecc.Secp256k1.PrivKeyFromBytes(privkeyByte)
+	redeemScript, pubKeys, _, pkScript, err := decodeRedeemScript(redeemScriptStr, param)
+	if err != nil {
+		return "", err
+	}
+	pubKeyAddr, err := address.NewSecpPubKeyCompressedAddress(pubKey, param)
+	if err != nil {
+		return "", err
+	}
+	signer := pubKeyAddr.Encode()
+	found := false
+	for _, addr := range pubKeys {
+		if addr.Encode() == signer {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("the private key is not a key of the redeem script")
+	}
+
+	redeemTx, err := decodeRawTx(rawTxStr)
+	if err != nil {
+		return "", err
+	}
+	var kdb txscript.KeyClosure = func(addr types.Address) (ecc.PrivateKey, bool, error) {
+		if addr.Encode() != signer {
+			return nil, false, fmt.Errorf("no key for address %s", addr.Encode())
+		}
+		return privateKey, true, nil // compressed is true
+	}
+	var sdb txscript.ScriptClosure = func(types.Address) ([]byte, error) {
+		return redeemScript, nil
+	}
+	var sigScripts [][]byte
+	for i, txIn := range redeemTx.TxIn {
+		sigScript, err := txscript.SignTxOutput(param, redeemTx, i, pkScript, txscript.SigHashAll, kdb, sdb, txIn.SignScript, ecc.ECDSA_Secp256k1)
+		if err != nil {
+			return "", err
+		}
+		sigScripts = append(sigScripts, sigScript)
+	}
+
+	for i := range sigScripts {
+		redeemTx.TxIn[i].SignScript = sigScripts[i]
+	}
+
+	return marshal.MessageToHex(&message.MsgTx{Tx: redeemTx})
+}
+
+// TxCombine merges the signatures of several partially signed copies of the
+// same transaction.  Signatures which don't verify against the redeem script
+// are dropped.
+func TxCombine(redeemScriptStr string, rawTxStrs []string, network string) (string, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return "", err
+	}
+	redeemScript, _, _, pkScript, err := decodeRedeemScript(redeemScriptStr, param)
+	if err != nil {
+		return "", err
+	}
+	if len(rawTxStrs) == 0 {
+		return "", fmt.Errorf("no transaction to combine")
+	}
+	txs := make([]*types.Transaction, 0, len(rawTxStrs))
+	for _, rawTxStr := range rawTxStrs {
+		tx, err := decodeRawTx(rawTxStr)
+		if err != nil {
+			return "", err
+		}
+		if len(txs) > 0 && tx.TxHash() != txs[0].TxHash() {
+			return "", fmt.Errorf("can't combine different transactions : %s and %s", txs[0].TxHash(), tx.TxHash())
+		}
+		txs = append(txs, tx)
+	}
+
+	// Without any key, signing only merges the signatures of the previous
+	// script, so gather the signatures of every copy in a single script.
+	var kdb txscript.KeyClosure = func(addr types.Address) (ecc.PrivateKey, bool, error) {
+		return nil, false, fmt.Errorf("no key for address %s", addr.Encode())
+	}
+	var sdb txscript.ScriptClosure = func(types.Address) ([]byte, error) {
+		return redeemScript, nil
+	}
+	combinedTx := txs[0]
+	var sigScripts [][]byte
+	for i := range combinedTx.TxIn {
+		builder := txscript.NewScriptBuilder()
+		for _, tx := range txs {
+			for _, sig := range multisigSignatures(tx.TxIn[i].SignScript, redeemScript) {
+				builder.AddData(sig)
+			}
+		}
+		builder.AddData(redeemScript)
+		previousScript, err := builder.Script()
+		if err != nil {
+			return "", err
+		}
+		sigScript, err := txscript.SignTxOutput(param, combinedTx, i, pkScript, txscript.SigHashAll, kdb, sdb, previousScript, ecc.ECDSA_Secp256k1)
+		if err != nil {
+			return "", err
+		}
+		sigScripts = append(sigScripts, sigScript)
+	}
+
+	for i := range sigScripts {
+		combinedTx.TxIn[i].SignScript = sigScripts[i]
+	}
+
+	return marshal.MessageToHex(&message.MsgTx{Tx: combinedTx})
+}
+
+// multisigSignatures returns the signatures pushed by the signature script of
+// a P2SH input spending the passed redeem script, without checking them.
+func multisigSignatures(sigScript []byte, redeemScript []byte) [][]byte {
+	pushes, err := txscript.PushedData(sigScript)
+	if err != nil || len(pushes) == 0 ||
+		!bytes.Equal(pushes[len(pushes)-1], redeemScript) {
+		return nil
+	}
+	var sigs [][]byte
+	for _, push := range pushes[:len(pushes)-1] {
+		if len(push) != 0 {
+			sigs = append(sigs, push)
+		}
+	}
+	return sigs
+}
+
+// MultisigInputStatus is the signing status of an input spending a multisig
+// redeem script.
+type MultisigInputStatus struct {
+	Index    int
+	Required int
+	Signed   []string
+	Missing  []string
+}
+
+// Complete returns whether the input has all of the signatures it requires.
+func (s *MultisigInputStatus) Complete() bool {
+	return len(s.Signed) >= s.Required
+}
+
+// TxMultisigStatus returns, for every input of the transaction, the public
+// keys of the redeem script with a valid signature and the ones without.
+func TxMultisigStatus(redeemScriptStr string, rawTxStr string, network string) ([]*MultisigInputStatus, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return nil, err
+	}
+	redeemScript, pubKeys, nRequired, _, err := decodeRedeemScript(redeemScriptStr, param)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeRawTx(rawTxStr)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MultisigInputStatus, 0, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		signed := make(map[int]bool)
+		for _, sig := range multisigSignatures(txIn.SignScript, redeemScript) {
+			pSig, err := ecc.Secp256k1.ParseDERSignature(sig[:len(sig)-1])
+			if err != nil {
+				continue
+			}
+			hashType := txscript.SigHashType(sig[len(sig)-1])
+			sigHash, err := txscript.CalcSignatureHash(redeemScript, hashType, tx, i, nil)
+			if err != nil {
+				continue
+			}
+			for j, addr := range pubKeys {
+				pubKey := addr.(*address.SecpPubKeyAddress).PubKey()
+				if ecc.Secp256k1.Verify(pubKey, sigHash, pSig.GetR(), pSig.GetS()) {
+					signed[j] = true
+					break
+				}
+			}
+		}
+
+		status := &MultisigInputStatus{Index: i, Required: nRequired}
+		for j, addr := range pubKeys {
+			pubKey := hex.EncodeToString(addr.ScriptAddress())
+			if signed[j] {
+				status.Signed = append(status.Signed, pubKey)
+			} else {
+				status.Missing = append(status.Missing, pubKey)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func MultisigNewSTDO(nRequired int, pubKeyStrs []string, network string) {
+	redeemScript, addr, err := MultisigNew(nRequired, pubKeyStrs, network)
+	if err != nil {
+		ErrExit(err)
+	}
+	result := &json.OrderedResult{
+		{Key: "address", Val: addr},
+		{Key: "redeemscript", Val: redeemScript},
+	}
+	marshaled, err := result.MarshalJSON()
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", marshaled)
+}
+
+func TxSignMultisigSTDO(privkeyStr string, redeemScriptStr string, rawTxStr string, network string) {
+	mtxHex, err := TxSignMultisig(privkeyStr, redeemScriptStr, rawTxStr, network)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", mtxHex)
+}
+
+func TxCombineSTDO(redeemScriptStr string, rawTxStrs []string, network string) {
+	mtxHex, err := TxCombine(redeemScriptStr, rawTxStrs, network)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", mtxHex)
+}
+
+func TxMultisigStatusSTDO(redeemScriptStr string, rawTxStr string, network string) {
+	statuses, err := TxMultisigStatus(redeemScriptStr, rawTxStr, network)
+	if err != nil {
+		ErrExit(err)
+	}
+	inputs := make([]*json.OrderedResult, 0, len(statuses))
+	complete := true
+	for _, status := range statuses {
+		complete = complete && status.Complete()
+		inputs = append(inputs, &json.OrderedResult{
+			{Key: "index", Val: status.Index},
+			{Key: "required", Val: status.Required},
+			{Key: "signatures", Val: len(status.Signed)},
+			{Key: "complete", Val: status.Complete()},
+			{Key: "signed", Val: status.Signed},
+			{Key: "missing", Val: status.Missing},
+		})
+	}
+	result := &json.OrderedResult{
+		{Key: "complete", Val: complete},
+		{Key: "inputs", Val: inputs},
+	}
+	marshaled, err := result.MarshalJSON()
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", marshaled)
+}
@@ -0,0 +1,277 @@
+package qx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/marshal"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/psbt"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/wallet"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PsbtCreate returns a partially signed transaction of an unsigned raw
+// transaction, such as the result of tx-encode.
+func PsbtCreate(rawTxStr string) (string, error) {
+	tx, err := decodeRawTx(rawTxStr)
+	if err != nil {
+		return "", err
+	}
+	p, err := psbt.New(tx)
+	if err != nil {
+		return "", err
+	}
+	return p.B64Encode()
+}
+
+// PsbtUpdate adds signing data to an input, when input isn't negative, or to
+// an output, when output isn't negative, of a partially signed transaction.
+// The utxo spent by an input is encoded as AMOUNT:PKSCRIPT with the amount in
+// atoms, and a BIP32 derivation as PUBKEY:FINGERPRINT:PATH.  Empty values are
+// ignored.
+func PsbtUpdate(psbtStr string, input int, output int, utxo string, redeemScriptStr string, derivation string) (string, error) {
+	p, err := psbt.B64Decode(psbtStr)
+	if err != nil {
+		return "", err
+	}
+	if (input < 0) == (output < 0) {
+		return "", fmt.Errorf("either an input or an output index is required")
+	}
+
+	var redeemScript []byte
+	if redeemScriptStr != "" {
+		redeemScript, err = hex.DecodeString(redeemScriptStr)
+		if err != nil {
+			return "", err
+		}
+	}
+	var bip32Derivation *psbt.Bip32Derivation
+	if derivation != "" {
+		bip32Derivation, err = parseBip32Derivation(derivation)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if input >= 0 {
+		in, err := p.Input(input)
+		if err != nil {
+			return "", err
+		}
+		if utxo != "" {
+			fields := strings.SplitN(utxo, ":", 2)
+			if len(fields) != 2 {
+				return "", fmt.Errorf("invalid utxo : %s", utxo)
+			}
+			amount, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return "", err
+			}
+			pkScript, err := hex.DecodeString(fields[1])
+			if err != nil {
+				return "", err
+			}
+			in.Utxo = types.NewTxOutput(amount, pkScript)
+		}
+		if redeemScript != nil {
+			in.RedeemScript = redeemScript
+		}
+		if bip32Derivation != nil {
+			in.Bip32Derivation = append(in.Bip32Derivation, bip32Derivation)
+		}
+	} else {
+		out, err := p.Output(output)
+		if err != nil {
+			return "", err
+		}
+		if utxo != "" {
+			return "", fmt.Errorf("an output has no utxo")
+		}
+		if redeemScript != nil {
+			out.RedeemScript = redeemScript
+		}
+		if bip32Derivation != nil {
+			out.Bip32Derivation = append(out.Bip32Derivation, bip32Derivation)
+		}
+	}
+	return p.B64Encode()
+}
+
+func parseBip32Derivation(derivation string) (*psbt.Bip32Derivation, error) {
+	fields := strings.SplitN(derivation, ":", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid bip32 derivation : %s", derivation)
+	}
+	pubKey, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ecc.Secp256k1.ParsePubKey(pubKey); err != nil {
+		return nil, err
+	}
+	fingerprint, err := hex.DecodeString(fields[1])
+	if err != nil || len(fingerprint) != 4 {
+		return nil, fmt.Errorf("invalid bip32 fingerprint : %s", fields[1])
+	}
+	path, err := wallet.ParseDerivationPath(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	return &psbt.Bip32Derivation{
+		PubKey:      pubKey,
+		Fingerprint: binary.LittleEndian.Uint32(fingerprint),
+		Path:        path,
+	}, nil
+}
+
+// PsbtSign signs every input of the partially signed transaction the passed
+// key can sign for.
+func PsbtSign(privkeyStr string, psbtStr string, network string) (string, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return "", err
+	}
+	privkeyByte, err := hex.DecodeString(privkeyStr)
+	if err != nil {
+		return "", err
+	}
+	if len(privkeyByte) != 32 {
+		return "", fmt.Errorf("invaid ec private key bytes: %d", len(privkeyByte))
+	}
+	privateKey, _ := ecc.Secp256k1.PrivKeyFromBytes(privkeyByte)
+
+	p, err := psbt.B64Decode(psbtStr)
+	if err != nil {
+		return "", err
+	}
+	signed := 0
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil {
+			continue
+		}
+		err := p.Sign(i, privateKey, param)
+		if err == psbt.ErrNotSigner {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("input %d : %v", i, err)
+		}
+		signed++
+	}
+	if signed == 0 {
+		return "", fmt.Errorf("the private key can't sign any input")
+	}
+	return p.B64Encode()
+}
+
+// PsbtCombine merges several partially signed copies of the same transaction.
+func PsbtCombine(psbtStrs []string) (string, error) {
+	packets := make([]*psbt.Packet, 0, len(psbtStrs))
+	for _, psbtStr := range psbtStrs {
+		p, err := psbt.B64Decode(psbtStr)
+		if err != nil {
+			return "", err
+		}
+		packets = append(packets, p)
+	}
+	p, err := psbt.Combine(packets...)
+	if err != nil {
+		return "", err
+	}
+	return p.B64Encode()
+}
+
+// PsbtFinalize finalizes the inputs with enough signatures.  Once every input
+// is finalized, the signed raw transaction is returned when extract is set,
+// the partially signed transaction otherwise.
+func PsbtFinalize(psbtStr string, network string, extract bool) (string, bool, error) {
+	param, err := netParams(network)
+	if err != nil {
+		return "", false, err
+	}
+	p, err := psbt.B64Decode(psbtStr)
+	if err != nil {
+		return "", false, err
+	}
+	for i := range p.Inputs {
+		err := p.Finalize(i, param)
+		if err != nil && err != psbt.ErrIncomplete {
+			return "", false, fmt.Errorf("input %d : %v", i, err)
+		}
+	}
+	if !p.IsComplete() || !extract {
+		encoded, err := p.B64Encode()
+		return encoded, p.IsComplete(), err
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		return "", false, err
+	}
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: tx})
+	return mtxHex, true, err
+}
+
+func PsbtCreateSTDO(rawTxStr string) {
+	encoded, err := PsbtCreate(rawTxStr)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", encoded)
+}
+
+func PsbtUpdateSTDO(psbtStr string, input int, output int, utxo string, redeemScriptStr string, derivation string) {
+	encoded, err := PsbtUpdate(psbtStr, input, output, utxo, redeemScriptStr, derivation)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", encoded)
+}
+
+func PsbtSignSTDO(privkeyStr string, psbtStr string, network string) {
+	encoded, err := PsbtSign(privkeyStr, psbtStr, network)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", encoded)
+}
+
+func PsbtCombineSTDO(psbtStrs []string) {
+	encoded, err := PsbtCombine(psbtStrs)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", encoded)
+}
+
+func PsbtFinalizeSTDO(psbtStr string, network string, extract bool) {
+	encoded, complete, err := PsbtFinalize(psbtStr, network, extract)
+	if err != nil {
+		ErrExit(err)
+	}
+	if !complete {
+		fmt.Fprintf(os.Stderr, "the transaction is missing signatures\n")
+	}
+	fmt.Printf("%s\n", encoded)
+}
+
+func PsbtDecodeSTDO(psbtStr string, network string) {
+	param, err := netParams(network)
+	if err != nil {
+		ErrExit(err)
+	}
+	p, err := psbt.B64Decode(psbtStr)
+	if err != nil {
+		ErrExit(err)
+	}
+	marshaled, err := json.Marshal(marshal.MarshJsonPsbt(p, param))
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", marshaled)
+}
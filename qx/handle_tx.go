@@ -219,6 +219,43 @@ func TxEncodeSTDO(version TxVersionFlag, lockTime TxLockTimeFlag, txIn TxInputsF
 	fmt.Printf("%s\n", mtxHex)
 }
 
+// TxFee returns the fee in atoms a transaction pays at the passed fee rate in
+// atoms per kilobyte, such as the rate returned by the estimateFee RPC.  The
+// transaction should be signed, since the fee depends on its size.
+func TxFee(rawTxStr string, feeRate int64) (int64, error) {
+	if feeRate < 0 {
+		return 0, fmt.Errorf("invaild fee rate : %d", feeRate)
+	}
+	if len(rawTxStr)%2 != 0 {
+		return 0, fmt.Errorf("invaild raw transaction : %s", rawTxStr)
+	}
+	serializedTx, err := hex.DecodeString(rawTxStr)
+	if err != nil {
+		return 0, err
+	}
+	var tx types.Transaction
+	err = tx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return 0, err
+	}
+
+	// Like the minimum relay fee of the mempool, a non-zero rate is charged
+	// at least once.
+	fee := int64(tx.SerializeSize()) * feeRate / 1000
+	if fee == 0 && feeRate > 0 {
+		fee = feeRate
+	}
+	return fee, nil
+}
+
+func TxFeeSTDO(rawTxStr string, feeRate int64) {
+	fee, err := TxFee(rawTxStr, feeRate)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%d\n", fee)
+}
+
 func TxSignSTDO(privkeyStr string, rawTxStr string, network string) {
 	mtxHex, err := TxSign(privkeyStr, rawTxStr, network)
 	if err != nil {
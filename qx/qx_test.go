@@ -29,6 +29,18 @@ func TestTxEncode(t *testing.T) {
 	assert.Equal(t, rs, "0100000001410b13fbb6fbfbc574d84b8e88d6c56224dbd2d4a364a1805e3659373b7e512500000000ffffffff020bd62f7c000000001976a914afda839fa515ffdbcbc8630b60909c64cfd73f7a88ac00e1f505000000001976a914b51127b89f9b704e7cfbc69286f0de2e00e7196988ac000000000000000000096e880100")
 }
 
+func TestTxFee(t *testing.T) {
+	tx := "0100000001255fea249c9747f7f4a8c432ca6f6bbed20db023fa9101288cad1a4e8056a5f600000000ffffffff0100943577000000001976a914c50b62be2f7c23cf0b9d904fa9984efbdb75859888ac0000000000000000a2b54c5e0100"
+	fee, err := TxFee(tx, 10000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(tx)/2*10), fee)
+	fee, err = TxFee(tx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fee)
+	_, err = TxFee(tx, -1)
+	assert.Error(t, err)
+}
+
 func TestNewEntropy(t *testing.T) {
 	s, _ := NewEntropy(32)
 	fmt.Printf("%s\n", s)
@@ -123,3 +135,115 @@ func TestGPSToCompact(t *testing.T) {
 	// output :
 	// 36284416
 }
+
+func TestTxMultisig(t *testing.T) {
+	keys := []string{
+		"c39fb9103419af8be42385f3d6390b4c0c8f2cb67cf24dd43a059c4045d1a409",
+		"dbae6e0b3174330ad24be8d952307e95106eb8d573defdc1f393ef2abf2e7b9c",
+		"7686a4df8171ebf04ede968167d0593fd4fbd8ee9feb07d453e768e06cc5e51d",
+	}
+	var pubKeys []string
+	for _, k := range keys {
+		p, err := EcPrivateKeyToEcPublicKey(false, k)
+		assert.NoError(t, err)
+		pubKeys = append(pubKeys, p)
+	}
+	net := "testnet"
+	script, addr, err := MultisigNew(2, pubKeys, net)
+	assert.NoError(t, err)
+	_, _, err = MultisigNew(4, pubKeys, net)
+	assert.Error(t, err)
+
+	inputs := map[string]uint32{"25517e3b3759365e80a164a3d4d2db2462c5d6888e4bd874c5fbfbb6fb130b41": 0}
+	outputs := map[string]uint64{addr: 100000000}
+	tx, err := TxEncode(1, 0, nil, inputs, outputs)
+	assert.NoError(t, err)
+
+	missing := func(tx string) []int {
+		statuses, err := TxMultisigStatus(script, tx, net)
+		assert.NoError(t, err)
+		assert.Len(t, statuses, 1)
+		assert.Equal(t, 2, statuses[0].Required)
+		return []int{len(statuses[0].Signed), len(statuses[0].Missing)}
+	}
+	assert.Equal(t, []int{0, 3}, missing(tx))
+
+	// Two custodians sign their own copy, a key outside of the script can't.
+	_, err = TxSignMultisig("1111111111111111111111111111111111111111111111111111111111111111", script, tx, net)
+	assert.Error(t, err)
+	tx1, err := TxSignMultisig(keys[0], script, tx, net)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, missing(tx1))
+	tx2, err := TxSignMultisig(keys[2], script, tx, net)
+	assert.NoError(t, err)
+
+	combined, err := TxCombine(script, []string{tx1, tx2}, net)
+	assert.NoError(t, err)
+	statuses, err := TxMultisigStatus(script, combined, net)
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Complete())
+	assert.Equal(t, []string{pubKeys[1]}, statuses[0].Missing)
+
+	// Signing on top of a partially signed copy keeps its signatures.
+	signed, err := TxSignMultisig(keys[1], script, tx1, net)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, missing(signed))
+
+	_, err = TxCombine(script, []string{tx1, "0100000001410b13fbb6fbfbc574d84b8e88d6c56224dbd2d4a364a1805e3659373b7e512500000000ffffffff020bd62f7c000000001976a914afda839fa515ffdbcbc8630b60909c64cfd73f7a88ac00e1f505000000001976a914b51127b89f9b704e7cfbc69286f0de2e00e7196988ac000000000000000000096e880100"}, net)
+	assert.Error(t, err)
+}
+
+func TestPsbt(t *testing.T) {
+	keys := []string{
+		"c39fb9103419af8be42385f3d6390b4c0c8f2cb67cf24dd43a059c4045d1a409",
+		"dbae6e0b3174330ad24be8d952307e95106eb8d573defdc1f393ef2abf2e7b9c",
+		"7686a4df8171ebf04ede968167d0593fd4fbd8ee9feb07d453e768e06cc5e51d",
+	}
+	var pubKeys []string
+	for _, k := range keys {
+		p, err := EcPrivateKeyToEcPublicKey(false, k)
+		assert.NoError(t, err)
+		pubKeys = append(pubKeys, p)
+	}
+	net := "testnet"
+	script, addr, err := MultisigNew(2, pubKeys, net)
+	assert.NoError(t, err)
+	param, err := netParams(net)
+	assert.NoError(t, err)
+	_, _, _, pkScript, err := decodeRedeemScript(script, param)
+	assert.NoError(t, err)
+
+	inputs := map[string]uint32{"25517e3b3759365e80a164a3d4d2db2462c5d6888e4bd874c5fbfbb6fb130b41": 0}
+	outputs := map[string]uint64{addr: 99990000}
+	tx, err := TxEncode(1, 0, nil, inputs, outputs)
+	assert.NoError(t, err)
+	p, err := PsbtCreate(tx)
+	assert.NoError(t, err)
+
+	_, err = PsbtUpdate(p, 0, 0, "", script, "")
+	assert.Error(t, err)
+	_, err = PsbtSign(keys[0], p, net)
+	assert.Error(t, err)
+	p, err = PsbtUpdate(p, 0, -1, fmt.Sprintf("100000000:%x", pkScript), script, "")
+	assert.NoError(t, err)
+	p, err = PsbtUpdate(p, -1, 0, "", script, pubKeys[1]+":0a1b2c3d:m/44'/0'/0'/0/1")
+	assert.NoError(t, err)
+
+	p1, err := PsbtSign(keys[0], p, net)
+	assert.NoError(t, err)
+	p2, err := PsbtSign(keys[2], p, net)
+	assert.NoError(t, err)
+	partial, complete, err := PsbtFinalize(p1, net, true)
+	assert.NoError(t, err)
+	assert.False(t, complete)
+	assert.Equal(t, p1, partial)
+
+	combined, err := PsbtCombine([]string{p1, p2})
+	assert.NoError(t, err)
+	signed, complete, err := PsbtFinalize(combined, net, true)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	statuses, err := TxMultisigStatus(script, signed, net)
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Complete())
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/config"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// rpcUserKey is the context key of the user who authenticated the request.
+type rpcUserKey struct{}
+
+// rpcUser is a user allowed to authenticate to the RPC server.
+type rpcUser struct {
+	name string
+
+	// salt and passHash are the rpcauth credentials of the user, the
+	// HMAC-SHA256 of the password keyed by the salt.  They are nil for the
+	// user configured with rpcuser and rpcpass.
+	salt     []byte
+	passHash []byte
+
+	// allowed holds the namespaces and the methods in the
+	// namespace_method form the user is allowed to call.  The user is
+	// allowed to call every method when it is nil.
+	allowed map[string]struct{}
+}
+
+// allows returns whether the user is allowed to call the passed method of the
+// passed namespace.
+func (u *rpcUser) allows(namespace, method string) bool {
+	if u.allowed == nil {
+		return true
+	}
+	if _, ok := u.allowed[namespace]; ok {
+		return true
+	}
+	_, ok := u.allowed[namespace+serviceMethodSeparator+method]
+	return ok
+}
+
+// checkPassword returns whether the passed password matches the rpcauth
+// credentials of the user.
+//
+// This check is time-constant.
+func (u *rpcUser) checkPassword(password string) bool {
+	mac := hmac.New(sha256.New, u.salt)
+	mac.Write([]byte(password))
+	return hmac.Equal(mac.Sum(nil), u.passHash)
+}
+
+// rpcUserFromContext returns the user who authenticated the request of the
+// passed context, nil if unknown.
+func rpcUserFromContext(ctx context.Context) *rpcUser {
+	user, _ := ctx.Value(rpcUserKey{}).(*rpcUser)
+	return user
+}
+
+// parseRPCUsers returns the users configured with rpcuser and rpcpass and
+// with rpcauth, whose allowed methods are restricted by rpcallow.
+//
+// An rpcauth credential has the <user>:<salt>$<hash> form, where the hash is
+// the hex encoded HMAC-SHA256 of the password keyed by the salt.  An rpcallow
+// rule has the <user>:<namespace or namespace_method>[,...] form.
+func parseRPCUsers(cfg *config.Config) (map[string]*rpcUser, error) {
+	users := make(map[string]*rpcUser)
+	if cfg.RPCUser != "" && cfg.RPCPass != "" {
+		users[cfg.RPCUser] = &rpcUser{name: cfg.RPCUser}
+	}
+
+	for _, auth := range cfg.RPCAuth {
+		fields := strings.SplitN(auth, ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("malformed rpcauth %q", auth)
+		}
+		credentials := strings.SplitN(fields[1], "$", 2)
+		if len(credentials) != 2 || credentials[0] == "" {
+			return nil, fmt.Errorf("malformed rpcauth credentials of "+
+				"user %s", fields[0])
+		}
+		passHash, err := hex.DecodeString(credentials[1])
+		if err != nil || len(passHash) != sha256.Size {
+			return nil, fmt.Errorf("malformed rpcauth hash of user %s",
+				fields[0])
+		}
+		if _, ok := users[fields[0]]; ok {
+			return nil, fmt.Errorf("duplicate rpc user %s", fields[0])
+		}
+		users[fields[0]] = &rpcUser{
+			name:     fields[0],
+			salt:     []byte(credentials[0]),
+			passHash: passHash,
+		}
+	}
+
+	for _, allow := range cfg.RPCAllow {
+		fields := strings.SplitN(allow, ":", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return nil, fmt.Errorf("malformed rpcallow %q", allow)
+		}
+		user, ok := users[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("rpcallow of unknown user %s",
+				fields[0])
+		}
+		if user.allowed == nil {
+			user.allowed = make(map[string]struct{})
+		}
+		for _, rule := range strings.Split(fields[1], ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				user.allowed[rule] = struct{}{}
+			}
+		}
+	}
+	return users, nil
+}
+
+// authenticate returns the user of the passed HTTP Basic authorization header,
+// nil when the credentials don't match any user.
+//
+// This check is time-constant for the user configured with rpcuser and
+// rpcpass, and for the password of the rpcauth users.
+func (s *RpcServer) authenticate(authhdr string) *rpcUser {
+	authsha := sha256.Sum256([]byte(authhdr))
+	if subtle.ConstantTimeCompare(authsha[:], s.authsha[:]) == 1 {
+		return s.users[s.config.RPCUser]
+	}
+
+	const prefix = "Basic "
+	if !strings.HasPrefix(authhdr, prefix) {
+		return nil
+	}
+	login, err := base64.StdEncoding.DecodeString(authhdr[len(prefix):])
+	if err != nil {
+		return nil
+	}
+	fields := strings.SplitN(string(login), ":", 2)
+	if len(fields) != 2 {
+		return nil
+	}
+	user, ok := s.users[fields[0]]
+	if !ok || user.passHash == nil || !user.checkPassword(fields[1]) {
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/Qitmeer/qitmeer/config"
+	"testing"
+)
+
+func TestRPCUsers(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("salt"))
+	mac.Write([]byte("dashboardpass"))
+	cfg := &config.Config{
+		RPCUser: "admin",
+		RPCPass: "adminpass",
+		RPCAuth: []string{"dashboard:salt$" + hex.EncodeToString(mac.Sum(nil))},
+		RPCAllow: []string{
+			"dashboard:qitmeer_getBlockCount, miner",
+			"dashboard:log_setLogLevel",
+		},
+	}
+	s, err := NewRPCServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic := func(user, pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(user+":"+pass))
+	}
+
+	admin := s.authenticate(basic("admin", "adminpass"))
+	if admin == nil || !admin.allows(TestNameSpace, "stop") {
+		t.Fatalf("admin not allowed to stop the node")
+	}
+	for _, auth := range []string{basic("admin", "dashboardpass"),
+		basic("dashboard", "adminpass"), basic("other", "dashboardpass"),
+		"Basic !"} {
+		if s.authenticate(auth) != nil {
+			t.Fatalf("authenticated %s", auth)
+		}
+	}
+
+	dashboard := s.authenticate(basic("dashboard", "dashboardpass"))
+	if dashboard == nil {
+		t.Fatalf("dashboard not authenticated")
+	}
+	tests := []struct {
+		namespace string
+		method    string
+		allowed   bool
+	}{
+		{DefaultServiceNameSpace, "getBlockCount", true},
+		{DefaultServiceNameSpace, "getBlock", false},
+		{MinerNameSpace, "getBlockTemplate", true},
+		{LogNameSpace, "setLogLevel", true},
+		{TestNameSpace, "stop", false},
+	}
+	for _, test := range tests {
+		if dashboard.allows(test.namespace, test.method) != test.allowed {
+			t.Fatalf("%s_%s allowed: %v", test.namespace, test.method,
+				!test.allowed)
+		}
+	}
+
+	for _, cfg := range []*config.Config{
+		{RPCAuth: []string{"dashboard:salt"}},
+		{RPCAuth: []string{"dashboard:salt$00"}},
+		{RPCAllow: []string{"unknown:qitmeer"}},
+	} {
+		if _, err := NewRPCServer(cfg); err == nil {
+			t.Fatalf("accepted malformed configuration %v", cfg)
+		}
+	}
+}
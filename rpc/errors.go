@@ -25,6 +25,21 @@ func (e *methodNotFoundError) Error() string {
 	return fmt.Sprintf("The method %s%s%s does not exist/is not available", e.service, serviceMethodSeparator, e.method)
 }
 
+// request is for a method the user isn't allowed to call
+type methodNotAllowedError struct {
+	service string
+	method  string
+}
+
+func (e *methodNotAllowedError) ErrorCode() int { return -32001 }
+
+func (e *methodNotAllowedError) Error() string {
+	if e.service == DefaultServiceNameSpace {
+		return fmt.Sprintf("The method %s is not allowed", e.method)
+	}
+	return fmt.Sprintf("The method %s%s%s is not allowed", e.service, serviceMethodSeparator, e.method)
+}
+
 // received message isn't a valid request
 type invalidRequestError struct{ message string }
 
@@ -34,6 +34,7 @@ const (
 	MinerNameSpace          = "miner"
 	TestNameSpace           = "test"
 	LogNameSpace            = "log"
+	WalletNameSpace         = "wallet"
 )
 
 type jsonRequest struct {
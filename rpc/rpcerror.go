@@ -53,6 +53,12 @@ func RpcAddressKeyError(fmtStr string, args ...interface{}) error {
 	return fmt.Errorf("Invalid AddressOrKey : %s", msg)
 }
 
+// RpcNoCFIndexError is a convenience function for returning a nicely
+// formatted RPC error which indicates the committed filter index is disabled.
+func RpcNoCFIndexError() error {
+	return fmt.Errorf("The CF index must be enabled for this command")
+}
+
 func RpcInternalError(err, context string) error {
 	return fmt.Errorf("%s : %s", context, err)
 }
@@ -4,7 +4,6 @@ package rpc
 
 import (
 	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/util"
@@ -45,7 +44,9 @@ type RpcServer struct {
 	codecs   mapset.Set
 
 	authsha                [sha256.Size]byte
+	users                  map[string]*rpcUser
 	numClients             int32
+	numWebsockets          int32
 	statusLines            map[int]string
 	requestProcessShutdown chan struct{}
 
@@ -122,6 +123,11 @@ func NewRPCServer(cfg *config.Config) (*RpcServer, error) {
 			base64.StdEncoding.EncodeToString([]byte(login))
 		rpc.authsha = sha256.Sum256([]byte(auth))
 	}
+	users, err := parseRPCUsers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rpc.users = users
 	return &rpc, nil
 }
 
@@ -178,14 +184,16 @@ func (s *RpcServer) startHTTP(listenAddrs []string) error {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, err := s.checkAuth(r, true)
+		user, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r)
+		s.jsonRPCRead(w, r.WithContext(
+			context.WithValue(r.Context(), rpcUserKey{}, user)))
 	})
+	rpcServeMux.Handle(websocketPath, s.websocketHandler())
 	listeners, err := parseListeners(s.config, listenAddrs)
 	if err != nil {
 		return err
@@ -237,33 +245,29 @@ func (s *RpcServer) decrementClients() {
 
 // TODO, repalace Basic Authentication
 // checkAuth checks the HTTP Basic authentication supplied by a wallet or RPC
-// client in the HTTP request r.  If the supplied authentication does not match
-// the username and password expected, a non-nil error is returned.
-//
-// This check is time-constant.
-func (s *RpcServer) checkAuth(r *http.Request, require bool) (bool, error) {
+// client in the HTTP request r and returns the authenticated user.  If the
+// supplied authentication does not match the username and password of any
+// user, a non-nil error is returned.
+func (s *RpcServer) checkAuth(r *http.Request, require bool) (*rpcUser, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			log.Warn("RPC authentication failure", "from", r.RemoteAddr,
 				"error", "no authorization header")
-			return false, fmt.Errorf("auth failure")
+			return nil, fmt.Errorf("auth failure")
 		}
 
-		return false, nil
+		return nil, nil
 	}
 
-	authsha := sha256.Sum256([]byte(authhdr[0]))
-
 	// Check for auth
-	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
-	if cmp == 1 {
-		return true, nil
+	if user := s.authenticate(authhdr[0]); user != nil {
+		return user, nil
 	}
 
-	// Request's auth doesn't match either user
+	// Request's auth doesn't match any user
 	log.Warn("RPC authentication failure", "from", r.RemoteAddr)
-	return false, fmt.Errorf("auth failure")
+	return nil, fmt.Errorf("auth failure")
 }
 
 // jsonAuthFail sends a message back to the client if the http auth is rejected.
@@ -570,6 +574,20 @@ func (s *RpcServer) handle(ctx context.Context, codec ServerCodec, req *serverRe
 		return codec.CreateErrorResponse(&req.id, &invalidParamsError{"Expected subscription id as first argument"}), nil
 	}
 
+	// Enforce the methods the user is allowed to call.
+	method := formatName(req.callb.method.Name)
+	if user := rpcUserFromContext(ctx); user == nil || !user.allows(req.svcname, method) {
+		var name string
+		if user != nil {
+			name = user.name
+		}
+		log.Warn("RPC method not allowed", "user", name, "method",
+			req.svcname+serviceMethodSeparator+method, "from",
+			ctx.Value("remote"))
+		return codec.CreateErrorResponse(&req.id,
+			&methodNotAllowedError{req.svcname, method}), nil
+	}
+
 	if req.callb.isSubscribe {
 		subid, err := s.createSubscription(ctx, codec, req)
 		if err != nil {
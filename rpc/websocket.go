@@ -0,0 +1,134 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// The parts code inspired by
+// https://github.com/ethereum/go-ethereum/rpc
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/log"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// websocketPath is the path the websocket endpoint is served at.
+const websocketPath = "/ws"
+
+// websocketJSONCodec is a custom JSON codec with payload size enforcement and
+// special number parsing.
+var websocketJSONCodec = websocket.Codec{
+	// Marshal is the stock JSON marshaller used by the websocket library too.
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		msg, err := json.Marshal(v)
+		return msg, websocket.TextFrame, err
+	},
+	// Unmarshal is a specialized unmarshaller to properly convert numbers.
+	Unmarshal: func(msg []byte, payloadType byte, v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+
+		return dec.Decode(v)
+	},
+}
+
+// websocketHandler returns the handler of the websocket endpoint.  Unlike the
+// HTTP endpoint, a websocket connection serves any number of requests and
+// supports subscriptions.
+func (s *RpcServer) websocketHandler() http.Handler {
+	wsServer := websocket.Server{
+		Handshake: wsHandshakeValidator,
+		Handler: func(conn *websocket.Conn) {
+			// The read deadline of the handshake is kept by the
+			// hijacked connection.
+			conn.SetReadDeadline(time.Time{})
+
+			// Create a custom encode/decode pair to enforce payload
+			// size and number encoding.
+			conn.MaxPayloadBytes = maxRequestContentLength
+			encoder := func(v interface{}) error {
+				return websocketJSONCodec.Send(conn, v)
+			}
+			decoder := func(v interface{}) error {
+				return websocketJSONCodec.Receive(conn, v)
+			}
+			codec := NewCodec(conn, encoder, decoder)
+			defer codec.Close()
+
+			r := conn.Request()
+			ctx := context.WithValue(r.Context(), "remote", r.RemoteAddr)
+			ctx = context.WithValue(ctx, "scheme", "ws")
+			ctx = context.WithValue(ctx, "local", r.Host)
+			s.serveRequest(ctx, codec, false,
+				OptionMethodInvocation|OptionSubscriptions)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.run) != 1 { // server stopped
+			return
+		}
+
+		// Limit the number of websocket connections to max allowed.
+		if s.limitWebsockets(w, r.RemoteAddr) {
+			return
+		}
+		atomic.AddInt32(&s.numWebsockets, 1)
+		defer atomic.AddInt32(&s.numWebsockets, -1)
+
+		user, err := s.checkAuth(r, true)
+		if err != nil {
+			jsonAuthFail(w)
+			return
+		}
+		log.Debug("New websocket client", "remote", r.RemoteAddr)
+		wsServer.ServeHTTP(w, r.WithContext(
+			context.WithValue(r.Context(), rpcUserKey{}, user)))
+		log.Debug("Websocket client disconnected", "remote", r.RemoteAddr)
+	})
+}
+
+// limitWebsockets responds with a 503 service unavailable and returns true if
+// adding another websocket client would exceed the maximum allowed websocket
+// clients.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) limitWebsockets(w http.ResponseWriter, remoteAddr string) bool {
+	if int(atomic.LoadInt32(&s.numWebsockets)+1) > s.config.RPCMaxWebsockets {
+		log.Info("RPC websocket clients exceeded", "max",
+			s.config.RPCMaxWebsockets, "client", remoteAddr)
+		http.Error(w, "503 Too busy.  Try again later.",
+			http.StatusServiceUnavailable)
+		return true
+	}
+	return false
+}
+
+// wsHandshakeValidator rejects the websocket connections a browser opens on
+// behalf of a page of another host, since those would be authenticated by the
+// cached credentials of the user.  Clients which don't send an origin are
+// accepted.
+func wsHandshakeValidator(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host != r.Host {
+		log.Warn("Websocket origin not allowed", "origin", origin,
+			"host", r.Host)
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+	return nil
+}
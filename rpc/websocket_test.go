@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Qitmeer/qitmeer/config"
+	"golang.org/x/net/websocket"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wsTestService is the service called by the websocket tests.
+type wsTestService struct{}
+
+func (wsTestService) Echo(s string) (string, error) {
+	return s, nil
+}
+
+// Counter notifies the numbers from 0 to n-1 once the subscription is active.
+func (wsTestService) Counter(ctx context.Context, n int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		for {
+			notifier.subMu.RLock()
+			_, active := notifier.active[sub.ID]
+			notifier.subMu.RUnlock()
+			if active {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < n; i++ {
+			notifier.Notify(sub.ID, i)
+		}
+	}()
+	return sub, nil
+}
+
+// wsMessage is a response or a notification received by a websocket client.
+type wsMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Method string `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// newWSTestServer starts the websocket endpoint of a server allowing
+// maxWebsockets clients.
+func newWSTestServer(t *testing.T, maxWebsockets int) (*RpcServer, *httptest.Server) {
+	s, err := NewRPCServer(&config.Config{
+		RPCUser:          "user",
+		RPCPass:          "pass",
+		RPCMaxWebsockets: maxWebsockets,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterService(DefaultServiceNameSpace, wsTestService{}); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&s.run, 1)
+	return s, httptest.NewServer(s.websocketHandler())
+}
+
+// dialWS connects to the websocket endpoint with the passed origin and
+// credentials.
+func dialWS(ts *httptest.Server, origin, user, pass string) (*websocket.Conn, error) {
+	host := strings.TrimPrefix(ts.URL, "http://")
+	if origin == "" {
+		origin = ts.URL
+	}
+	cfg, err := websocket.NewConfig("ws://"+host+websocketPath, origin)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Header.Set("Authorization", "Basic "+
+		base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	return websocket.DialConfig(cfg)
+}
+
+// wsCall sends a request and returns the next message received.
+func wsCall(t *testing.T, conn *websocket.Conn, id int, method string, params ...interface{}) *wsMessage {
+	t.Helper()
+	req := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	}
+	if err := websocket.JSON.Send(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	return wsReceive(t, conn)
+}
+
+func wsReceive(t *testing.T, conn *websocket.Conn) *wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return &msg
+}
+
+func Test_WebsocketRequests(t *testing.T) {
+	_, ts := newWSTestServer(t, 10)
+	defer ts.Close()
+	conn, err := dialWS(ts, "", "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A connection serves any number of requests.
+	for i, s := range []string{"a", "b"} {
+		msg := wsCall(t, conn, i, "qitmeer_echo", s)
+		if msg.Error != nil || string(msg.Result) != `"`+s+`"` {
+			t.Fatalf("echo %s: %s %+v", s, msg.Result, msg.Error)
+		}
+	}
+
+	msg := wsCall(t, conn, 3, "qitmeer_subscribe", "counter", 3)
+	var id string
+	if msg.Error != nil || json.Unmarshal(msg.Result, &id) != nil || id == "" {
+		t.Fatalf("subscribe: %s %+v", msg.Result, msg.Error)
+	}
+	for i := 0; i < 3; i++ {
+		msg := wsReceive(t, conn)
+		if msg.Method != "qitmeer_subscription" || msg.Params.Subscription != id ||
+			string(msg.Params.Result) != strconv.Itoa(i) {
+			t.Fatalf("notification %d: %+v", i, msg)
+		}
+	}
+
+	msg = wsCall(t, conn, 4, "qitmeer_unsubscribe", id)
+	if msg.Error != nil || string(msg.Result) != "true" {
+		t.Fatalf("unsubscribe: %s %+v", msg.Result, msg.Error)
+	}
+	msg = wsCall(t, conn, 5, "qitmeer_unsubscribe", id)
+	if msg.Error == nil {
+		t.Fatal("unsubscribed twice")
+	}
+	msg = wsCall(t, conn, 6, "qitmeer_subscribe", "unknown")
+	if msg.Error == nil {
+		t.Fatal("subscribed to an unknown subscription")
+	}
+}
+
+func Test_WebsocketAuth(t *testing.T) {
+	s, ts := newWSTestServer(t, 10)
+	defer ts.Close()
+
+	tests := []struct {
+		origin string
+		user   string
+		pass   string
+		ok     bool
+	}{
+		{"", "user", "pass", true},
+		{"", "user", "wrong", false},
+		{"", "", "", false},
+		{"http://example.com", "user", "pass", false},
+	}
+	for _, test := range tests {
+		conn, err := dialWS(ts, test.origin, test.user, test.pass)
+		if (err == nil) != test.ok {
+			t.Errorf("%+v: dial error %v", test, err)
+		}
+		if err == nil {
+			conn.Close()
+		}
+	}
+
+	// No client is served once the server is stopped.
+	s.Stop()
+	if conn, err := dialWS(ts, "", "user", "pass"); err == nil {
+		conn.Close()
+		t.Fatal("connected to a stopped server")
+	}
+}
+
+func Test_WebsocketLimit(t *testing.T) {
+	s, ts := newWSTestServer(t, 1)
+	defer ts.Close()
+
+	conn, err := dialWS(ts, "", "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := dialWS(ts, "", "user", "pass"); err == nil {
+		conn.Close()
+		t.Fatal("connected over the limit")
+	}
+
+	// The slot is freed when the client disconnects.
+	conn.Close()
+	for i := 0; atomic.LoadInt32(&s.numWebsockets) != 0; i++ {
+		if i > 1000 {
+			t.Fatal("websocket client not released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn, err = dialWS(ts, "", "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -134,6 +134,25 @@ function get_mempool(){
   get_result "$data"
 }
 
+function estimate_fee(){
+  local target=$1
+  if [ "$target" == "" ]; then
+    target=1
+  fi
+  local data='{"jsonrpc":"2.0","method":"estimateFee","params":['$target'],"id":1}'
+  get_result "$data"
+}
+
+function get_mempool_info(){
+  local data='{"jsonrpc":"2.0","method":"getMempoolInfo","params":[],"id":1}'
+  get_result "$data"
+}
+
+function save_mempool(){
+  local data='{"jsonrpc":"2.0","method":"saveMempool","params":[],"id":1}'
+  get_result "$data"
+}
+
 # return block by hash
 #   func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, blockHash common.Hash, fullTx bool) (map[string]interface{}, error)
 function get_block_by_hash(){
@@ -212,6 +231,167 @@ function create_raw_tx(){
   get_result "$data"
 }
 
+function create_psbt(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createPsbt","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function update_psbt(){
+  local psbt=$1
+  shift
+  local scripts=""
+  for script in $@; do
+    scripts=$scripts',"'$script'"'
+  done
+  local data='{"jsonrpc":"2.0","method":"updatePsbt","params":["'$psbt'",['${scripts#,}']],"id":1}'
+  get_result "$data"
+}
+
+function sign_psbt(){
+  local private_key=$1
+  local psbt=$2
+  local data='{"jsonrpc":"2.0","method":"test_signPsbt","params":["'$private_key'","'$psbt'"],"id":1}'
+  get_result "$data"
+}
+
+function combine_psbt(){
+  local psbts=""
+  for psbt in $@; do
+    psbts=$psbts',"'$psbt'"'
+  done
+  local data='{"jsonrpc":"2.0","method":"combinePsbt","params":[['${psbts#,}']],"id":1}'
+  get_result "$data"
+}
+
+function finalize_psbt(){
+  local psbt=$1
+  local extract=$2
+  if [ "$extract" == "" ]; then
+    extract="true"
+  fi
+  local data='{"jsonrpc":"2.0","method":"finalizePsbt","params":["'$psbt'",'$extract'],"id":1}'
+  get_result "$data"
+}
+
+function decode_psbt(){
+  local psbt=$1
+  local data='{"jsonrpc":"2.0","method":"decodePsbt","params":["'$psbt'"],"id":1}'
+  get_result "$data"
+}
+
+function create_asset_issue_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createAssetIssueTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function create_asset_transfer_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createAssetTransferTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function create_asset_revoke_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createAssetRevokeTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function get_asset_info(){
+  local asset_id=$1
+  local data='{"jsonrpc":"2.0","method":"getAssetInfo","params":["'$asset_id'"],"id":1}'
+  get_result "$data"
+}
+
+function list_assets(){
+  local data='{"jsonrpc":"2.0","method":"listAssets","params":[],"id":1}'
+  get_result "$data"
+}
+
+function get_asset_balances(){
+  local addr=$1
+  local data='{"jsonrpc":"2.0","method":"getAssetBalances","params":["'$addr'"],"id":1}'
+  get_result "$data"
+}
+
+function create_contract_create_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createContractCreateTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function create_contract_call_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createContractCallTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function create_contract_destroy_tx(){
+  local input=$1
+  local data='{"jsonrpc":"2.0","method":"createContractDestroyTransaction","params":['$input'],"id":1}'
+  get_result "$data"
+}
+
+function get_contract(){
+  local contract_id=$1
+  local data='{"jsonrpc":"2.0","method":"getContract","params":["'$contract_id'"],"id":1}'
+  get_result "$data"
+}
+
+function get_block_receipt(){
+  local block_hash=$1
+  local data='{"jsonrpc":"2.0","method":"getBlockReceipt","params":["'$block_hash'"],"id":1}'
+  get_result "$data"
+}
+
+function create_wallet(){
+  local passphrase=$1
+  local mnemonic=$2
+  local data='{"jsonrpc":"2.0","method":"wallet_createWallet","params":["'$passphrase'"],"id":1}'
+  if [ "$mnemonic" != "" ]; then
+    data='{"jsonrpc":"2.0","method":"wallet_createWallet","params":["'$passphrase'","'$mnemonic'"],"id":1}'
+  fi
+  get_result "$data"
+}
+
+function get_new_address(){
+  local data='{"jsonrpc":"2.0","method":"wallet_getNewAddress","params":[],"id":1}'
+  get_result "$data"
+}
+
+function get_wallet_balance(){
+  local data='{"jsonrpc":"2.0","method":"getBalance","params":[],"id":1}'
+  get_result "$data"
+}
+
+function list_unspent(){
+  local data='{"jsonrpc":"2.0","method":"listUnspent","params":[],"id":1}'
+  get_result "$data"
+}
+
+function send_to_address(){
+  local addr=$1
+  local amount=$2
+  local data='{"jsonrpc":"2.0","method":"wallet_sendToAddress","params":["'$addr'",'$amount'],"id":1}'
+  get_result "$data"
+}
+
+function wallet_unlock(){
+  local passphrase=$1
+  local timeout=$2
+  if [ "$timeout" == "" ]; then
+    timeout=0
+  fi
+  local data='{"jsonrpc":"2.0","method":"wallet_unlock","params":["'$passphrase'",'$timeout'],"id":1}'
+  get_result "$data"
+}
+
+function wallet_lock(){
+  local data='{"jsonrpc":"2.0","method":"wallet_lock","params":[],"id":1}'
+  get_result "$data"
+}
+
 function decode_raw_tx(){
   local input=$1
   local data='{"jsonrpc":"2.0","method":"decodeRawTransaction","params":["'$input'"],"id":1}'
@@ -257,6 +437,18 @@ function get_block_template(){
   get_result "$data"
 }
 
+function get_block_template_longpoll(){
+  local longpollid=$1
+  local data='{"jsonrpc":"2.0","method":"getBlockTemplate","params":[[],{"longpollid":"'$longpollid'"}],"id":1}'
+  get_result "$data"
+}
+
+function propose_block(){
+  local block_data=$1
+  local data='{"jsonrpc":"2.0","method":"getBlockTemplate","params":[[],{"mode":"proposal","data":"'$block_data'"}],"id":1}'
+  get_result "$data"
+}
+
 function get_mainchain_height(){
   local data='{"jsonrpc":"2.0","method":"getMainChainHeight","params":[],"id":1}'
   get_result "$data"
@@ -294,6 +486,11 @@ function get_peer_info(){
   get_result "$data"
 }
 
+function get_net_totals(){
+  local data='{"jsonrpc":"2.0","method":"getNetTotals","params":[],"id":null}'
+  get_result "$data"
+}
+
 function get_rpc_info(){
   local data='{"jsonrpc":"2.0","method":"getRpcInfo","params":[],"id":null}'
   get_result "$data"
@@ -334,6 +531,17 @@ function ban_list(){
   get_result "$data"
 }
 
+function set_ban(){
+  local subnet=$1
+  local duration=$2
+  local reason=$3
+  if [ "$duration" == "" ]; then
+    duration=0
+  fi
+  local data='{"jsonrpc":"2.0","method":"test_setBan","params":["'$subnet'",'$duration',"'$reason'"],"id":1}'
+  get_result "$data"
+}
+
 function remove_ban(){
   local bhost=$1
   local data='{"jsonrpc":"2.0","method":"test_removeBan","params":["'$bhost'"],"id":1}'
@@ -385,6 +593,96 @@ function get_fees(){
   get_result "$data"
 }
 
+function get_cfilter(){
+  local block_hash=$1
+  local data='{"jsonrpc":"2.0","method":"getCFilter","params":["'$block_hash'"],"id":1}'
+  get_result "$data"
+}
+
+function get_cfilter_header(){
+  local block_hash=$1
+  local data='{"jsonrpc":"2.0","method":"getCFilterHeader","params":["'$block_hash'"],"id":1}'
+  get_result "$data"
+}
+
+function get_anticone(){
+  local block_hash=$1
+  local data='{"jsonrpc":"2.0","method":"getAnticone","params":["'$block_hash'"],"id":1}'
+  get_result "$data"
+}
+
+function get_past_set(){
+  local block_hash=$1
+  local start=$2
+  local count=$3
+  if [ "$start" == "" ]; then
+    start=0
+  fi
+  if [ "$count" == "" ]; then
+    count=1000
+  fi
+  local data='{"jsonrpc":"2.0","method":"getPastSet","params":["'$block_hash'",'$start','$count'],"id":1}'
+  get_result "$data"
+}
+
+function get_future_set(){
+  local block_hash=$1
+  local start=$2
+  local count=$3
+  if [ "$start" == "" ]; then
+    start=0
+  fi
+  if [ "$count" == "" ]; then
+    count=1000
+  fi
+  local data='{"jsonrpc":"2.0","method":"getFutureSet","params":["'$block_hash'",'$start','$count'],"id":1}'
+  get_result "$data"
+}
+
+function get_blue_set(){
+  local block_hash=$1
+  local start=$2
+  local count=$3
+  if [ "$start" == "" ]; then
+    start=0
+  fi
+  if [ "$count" == "" ]; then
+    count=1000
+  fi
+  local data='{"jsonrpc":"2.0","method":"getBlueSet","params":["'$block_hash'",'$start','$count'],"id":1}'
+  get_result "$data"
+}
+
+function get_main_parent_chain(){
+  local from=$1
+  local to=$2
+  local data='{"jsonrpc":"2.0","method":"getMainParentChain","params":["'$from'","'$to'"],"id":1}'
+  get_result "$data"
+}
+
+function get_block_maturity(){
+  local target=$1
+  local views='"'${2//,/\",\"}'"'
+  local data='{"jsonrpc":"2.0","method":"getBlockMaturity","params":["'$target'",['$views']],"id":1}'
+  get_result "$data"
+}
+
+function export_dag(){
+  local start=$1
+  local end=$2
+  local format=$3
+  if [ "$format" == "" ]; then
+    format=json
+  fi
+  local data='{"jsonrpc":"2.0","method":"exportDAG","params":['$start','$end',"'$format'"],"id":1}'
+  get_result "$data"
+}
+
+function get_deployment_info(){
+  local data='{"jsonrpc":"2.0","method":"getDeploymentInfo","params":[],"id":1}'
+  get_result "$data"
+}
+
 function get_result(){
   local proto="https"
   if [ $notls -eq 1 ]; then
@@ -448,12 +746,14 @@ function usage(){
   echo "chain  :"
   echo "  nodeinfo"
   echo "  peerinfo"
+  echo "  nettotals"
   echo "  rpcinfo"
   echo "  rpcmax <max>"
   echo "  main  <hash>"
   echo "  stop"
   echo "  banlist"
-  echo "  removeban"
+  echo "  setban <ip|subnet> [duration secs] [reason]"
+  echo "  removeban [ip|subnet]"
   echo "  loglevel [trace, debug, info, warn, error, critical]"
   echo "block  :"
   echo "  block <order|hash>"
@@ -470,6 +770,16 @@ function usage(){
   echo "  tips"
   echo "  coinbase <hash>"
   echo "  fees <hash>"
+  echo "  cfilter <hash>"
+  echo "  cfilterheader <hash>"
+  echo "  deploymentinfo"
+  echo "  anticone <hash>"
+  echo "  pastset <hash> <start> <count>"
+  echo "  futureset <hash> <start> <count>"
+  echo "  blueset <hash> <start> <count>"
+  echo "  mainparentchain <from hash> <to hash>"
+  echo "  maturity <target hash> <view hash,...>"
+  echo "  exportdag <start order> <end order> <json|dot>"
   echo "tx     :"
   echo "  tx <id>"
   echo "  txv2 <id>"
@@ -478,10 +788,43 @@ function usage(){
   echo "  txSign <rawTx>"
   echo "  sendRawTx <signedRawTx>"
   echo "  getrawtxs <address>"
+  echo "  estimatefee <target_confirmations,default=1>"
+  echo "  mempoolinfo"
+  echo "  savemempool"
+  echo "psbt   :"
+  echo "  createPsbt"
+  echo "  updatePsbt <psbt> [redeem_script...]"
+  echo "  signPsbt <private_key> <psbt>"
+  echo "  combinePsbt <psbt...>"
+  echo "  finalizePsbt <psbt> <extract,default=true>"
+  echo "  decodePsbt <psbt>"
+  echo "asset  :"
+  echo "  createAssetIssueTx"
+  echo "  createAssetTransferTx"
+  echo "  createAssetRevokeTx"
+  echo "  assetinfo <asset_id>"
+  echo "  listassets"
+  echo "  assetbalances <address>"
+  echo "contract:"
+  echo "  createContractCreateTx"
+  echo "  createContractCallTx"
+  echo "  createContractDestroyTx"
+  echo "  contract <contract_id>"
+  echo "  blockreceipt <hash>"
+  echo "wallet : (the wallet module must be in --modules)"
+  echo "  createwallet <passphrase> <mnemonic,optional>"
+  echo "  getnewaddress"
+  echo "  getbalance"
+  echo "  listunspent"
+  echo "  sendtoaddress <address> <amount>"
+  echo "  unlock <passphrase> <timeout_seconds,default=0>"
+  echo "  lock"
   echo "utxo   :"
   echo "  getutxo <tx_id> <index> <include_mempool,default=true>"
   echo "miner  :"
   echo "  template"
+  echo "  templatelongpoll <longpollid>"
+  echo "  proposeblock <hex>"
   echo "  generate <num>"
 }
 
@@ -754,6 +1097,14 @@ elif [ "$1" == "template" ]; then
     shift
     get_block_template $1 | jq .
 
+elif [ "$1" == "templatelongpoll" ]; then
+    shift
+    get_block_template_longpoll $1 | jq .
+
+elif [ "$1" == "proposeblock" ]; then
+    shift
+    propose_block $1
+
 elif [ "$1" == "mainHeight" ]; then
     shift
     get_mainchain_height
@@ -774,6 +1125,50 @@ elif [ "$1" == "fees" ]; then
   shift
   get_fees $@
 
+elif [ "$1" == "cfilter" ]; then
+  shift
+  get_cfilter $@
+
+elif [ "$1" == "cfilterheader" ]; then
+  shift
+  get_cfilter_header $@
+
+elif [ "$1" == "deploymentinfo" ]; then
+  shift
+  get_deployment_info|jq .
+
+elif [ "$1" == "anticone" ]; then
+  shift
+  get_anticone $@|jq .
+
+elif [ "$1" == "pastset" ]; then
+  shift
+  get_past_set $@|jq .
+
+elif [ "$1" == "futureset" ]; then
+  shift
+  get_future_set $@|jq .
+
+elif [ "$1" == "blueset" ]; then
+  shift
+  get_blue_set $@|jq .
+
+elif [ "$1" == "mainparentchain" ]; then
+  shift
+  get_main_parent_chain $@|jq .
+
+elif [ "$1" == "maturity" ]; then
+  shift
+  get_block_maturity $@
+
+elif [ "$1" == "exportdag" ]; then
+  shift
+  if [ "$3" == "dot" ]; then
+    export_dag $@|jq -r .
+  else
+    export_dag $@|jq .
+  fi
+
 elif [ "$1" == "nodeinfo" ]; then
   shift
   get_node_info
@@ -782,6 +1177,10 @@ elif [ "$1" == "peerinfo" ]; then
   shift
   get_peer_info
 
+elif [ "$1" == "nettotals" ]; then
+  shift
+  get_net_totals
+
 elif [ "$1" == "rpcinfo" ]; then
   shift
   get_rpc_info
@@ -814,6 +1213,10 @@ elif [ "$1" == "banlist" ]; then
   shift
   ban_list | jq .
 
+elif [ "$1" == "setban" ]; then
+  shift
+  set_ban "$@"
+
 elif [ "$1" == "removeban" ]; then
   shift
   remove_ban $@
@@ -830,6 +1233,74 @@ elif [ "$1" == "createRawTx" ]; then
   shift
   create_raw_tx $@
 
+elif [ "$1" == "createPsbt" ]; then
+  shift
+  create_psbt $@
+
+elif [ "$1" == "updatePsbt" ]; then
+  shift
+  update_psbt $@
+
+elif [ "$1" == "signPsbt" ]; then
+  shift
+  sign_psbt $@
+
+elif [ "$1" == "combinePsbt" ]; then
+  shift
+  combine_psbt $@
+
+elif [ "$1" == "finalizePsbt" ]; then
+  shift
+  finalize_psbt $@
+
+elif [ "$1" == "decodePsbt" ]; then
+  shift
+  decode_psbt $@
+
+elif [ "$1" == "createAssetIssueTx" ]; then
+  shift
+  create_asset_issue_tx $@
+
+elif [ "$1" == "createAssetTransferTx" ]; then
+  shift
+  create_asset_transfer_tx $@
+
+elif [ "$1" == "createAssetRevokeTx" ]; then
+  shift
+  create_asset_revoke_tx $@
+
+elif [ "$1" == "assetinfo" ]; then
+  shift
+  get_asset_info $@
+
+elif [ "$1" == "listassets" ]; then
+  shift
+  list_assets | jq .
+
+elif [ "$1" == "assetbalances" ]; then
+  shift
+  get_asset_balances $@
+
+elif [ "$1" == "createContractCreateTx" ]; then
+  shift
+  create_contract_create_tx $@
+
+elif [ "$1" == "createContractCallTx" ]; then
+  shift
+  create_contract_call_tx $@
+
+elif [ "$1" == "createContractDestroyTx" ]; then
+  shift
+  create_contract_destroy_tx $@
+
+elif [ "$1" == "contract" ]; then
+  shift
+  get_contract $@
+
+elif [ "$1" == "blockreceipt" ]; then
+  shift
+  get_block_receipt $@
+
 elif [ "$1" == "decodeRawTx" ]; then
   shift
   decode_raw_tx $@
@@ -852,6 +1323,17 @@ elif [ "$1" == "mempool" ]; then
   shift
   get_mempool $@
 
+elif [ "$1" == "estimatefee" ]; then
+  shift
+  estimate_fee $@
+
+elif [ "$1" == "mempoolinfo" ]; then
+  shift
+  get_mempool_info $@
+
+elif [ "$1" == "savemempool" ]; then
+  shift
+  save_mempool $@
 
 elif [ "$1" == "txSign" ]; then
   shift
@@ -865,6 +1347,34 @@ elif [ "$1" == "getutxo" ]; then
   get_utxo $@
 
 ## Accounts
+elif [ "$1" == "createwallet" ]; then
+  shift
+  create_wallet "$@"
+
+elif [ "$1" == "getnewaddress" ]; then
+  shift
+  get_new_address
+
+elif [ "$1" == "getbalance" ]; then
+  shift
+  get_wallet_balance
+
+elif [ "$1" == "listunspent" ]; then
+  shift
+  list_unspent | jq .
+
+elif [ "$1" == "sendtoaddress" ]; then
+  shift
+  send_to_address $@
+
+elif [ "$1" == "unlock" ]; then
+  shift
+  wallet_unlock "$@"
+
+elif [ "$1" == "lock" ]; then
+  shift
+  wallet_lock
+
 elif [ "$1" == "newaccount" ]; then
   shift
   new_account "$@"
@@ -0,0 +1,21 @@
+#!/bin/bash
+
+# Print the rpcauth option of a qitmeerd RPC user:
+#   rpcauth=<user>:<salt>$<hex HMAC-SHA256 of the password keyed by the salt>
+# A random password is generated and printed when none is given.
+
+set -e
+
+if [ "$1" == "" ]; then
+  echo "Usage: $0 <user> [password]"
+  exit 1
+fi
+user=$1
+password=$2
+if [ "$password" == "" ]; then
+  password=$(openssl rand -base64 32)
+  echo "password: $password"
+fi
+salt=$(openssl rand -hex 16)
+hash=$(printf '%s' "$password" | openssl dgst -sha256 -hmac "$salt" | sed 's/^.* //')
+echo "rpcauth=$user:$salt\$$hash"
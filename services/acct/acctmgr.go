@@ -1,12 +1,88 @@
 package acct
 
 import (
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/bip32"
+	"github.com/Qitmeer/qitmeer/crypto/bip39"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/node/notify"
+	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
+	"github.com/Qitmeer/qitmeer/services/blkmgr"
+	"github.com/Qitmeer/qitmeer/services/index"
+	"github.com/Qitmeer/qitmeer/wallet"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// mnemonicEntropyBits is the size of the entropy of new mnemonics.
+	mnemonicEntropyBits = 256
+
+	// redeemP2PKHSigScriptSize is the worst case size of a signature script
+	// redeeming a pay-to-pubkey-hash output: OP_DATA_73 <sig> OP_DATA_33
+	// <compressed pubkey>.
+	redeemP2PKHSigScriptSize = 1 + 73 + 1 + 33
+
+	// dustInputSize is the size of the input spending an output, used to
+	// tell whether change is worth creating.
+	dustInputSize = 165
+
+	// addressGapLimit is the number of consecutive addresses without
+	// outputs after which the scan of a restored wallet stops deriving
+	// addresses.
+	addressGapLimit = 20
+)
+
+var (
+	// ErrWalletDisabled is returned by the wallet operations when the node
+	// runs without --wallet.
+	ErrWalletDisabled = errors.New("wallet is disabled, start the node with --wallet")
+
+	// ErrLocked is returned when an operation needs the private keys while
+	// the wallet is locked.
+	ErrLocked = errors.New("wallet is locked, unlock it first")
+
+	// ErrInsufficientFunds is returned when the spendable outputs of the
+	// wallet do not cover a payment and its fee.
+	ErrInsufficientFunds = errors.New("insufficient funds")
 )
 
 // account manager communicate with various backends for signing transactions.
 type AccountManager struct {
+	cfg    *config.Config
+	params *params.Params
+	db     database.DB
+	notify notify.Notify
+	bm     *blkmgr.BlockManager
+	index  *UtxoIndex
+
+	// The following fields are protected by the lock.  The lock is never
+	// held while calling into the chain or the database, since the chain
+	// calls back into the wallet through the index while holding its own
+	// locks.
+	lock sync.RWMutex
+	ks   *keyStore
+	// - extended public key of the account
+	acctKey *bip32.Key
+	// - extended private key of the account, nil while locked
+	privKey   *bip32.Key
+	lockTimer *time.Timer
+	// - pay-to-pubkey-hash scripts and addresses of the derived keys
+	scripts map[string]uint32
+	addrs   map[string]uint32
+	// - outputs spent by wallet transactions still in the mempool
+	pending map[types.TxOutPoint]hash.Hash
 }
 
 func (a *AccountManager) Start() error {
@@ -16,20 +92,612 @@ func (a *AccountManager) Start() error {
 
 func (a *AccountManager) Stop() error {
 	log.Debug("Stopping account manager")
+	a.Lock()
 	return nil
 }
 
-func (a AccountManager) APIs() []rpc.API {
+func (a *AccountManager) APIs() []rpc.API {
 	return []rpc.API{
 		{
 			NameSpace: rpc.DefaultServiceNameSpace,
-			Service:   NewPublicAccountManagerAPI(&a),
+			Service:   NewPublicAccountManagerAPI(a),
 			Public:    true,
 		},
+		{
+			NameSpace: rpc.WalletNameSpace,
+			Service:   NewPrivateWalletAPI(a),
+			Public:    false,
+		},
+	}
+}
+
+// Index returns the index keeping track of the outputs paying to the wallet.
+func (a *AccountManager) Index() index.Indexer {
+	return a.index
+}
+
+// SetBlockManager sets the block manager used to look up outputs and to
+// process the transactions of the wallet.
+func (a *AccountManager) SetBlockManager(bm *blkmgr.BlockManager) {
+	a.bm = bm
+}
+
+// enabled returns ErrWalletDisabled when the node runs without a wallet.
+func (a *AccountManager) enabled() error {
+	if !a.cfg.Wallet || a.bm == nil {
+		return ErrWalletDisabled
 	}
+	return nil
 }
 
-func New() (*AccountManager, error) {
-	a := AccountManager{}
+// accountPath returns the BIP44 derivation path of the external addresses of
+// the first account.
+func (a *AccountManager) accountPath() wallet.DerivationPath {
+	return wallet.DerivationPath{
+		bip32.FirstHardenedChild + 44,
+		bip32.FirstHardenedChild + a.params.HDCoinType,
+		bip32.FirstHardenedChild + 0,
+		0,
+	}
+}
+
+func (a *AccountManager) bip32Version() bip32.Bip32Version {
+	return bip32.Bip32Version{
+		PrivKeyVersion: a.params.HDPrivateKeyID[:],
+		PubKeyVersion:  a.params.HDPublicKeyID[:],
+	}
+}
+
+// deriveAccountKey derives the extended private key of the account from the
+// wallet seed.
+func (a *AccountManager) deriveAccountKey(seed []byte) (*bip32.Key, error) {
+	key, err := bip32.NewMasterKey2(seed, a.bip32Version())
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range a.accountPath() {
+		key, err = key.NewChildKey(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// addressOf returns the pay-to-pubkey-hash address of the passed public key.
+func (a *AccountManager) addressOf(pubKey []byte) (types.Address, error) {
+	return address.NewPubKeyHashAddress(hash.Hash160(pubKey), a.params,
+		ecc.ECDSA_Secp256k1)
+}
+
+// deriveAddress derives the address of the passed index and adds it to the
+// watched addresses.
+//
+// This function MUST be called with the lock held (for writes).
+func (a *AccountManager) deriveAddress(i uint32) (types.Address, error) {
+	child, err := a.acctKey.NewChildKey(i)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := a.addressOf(child.Key)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	a.scripts[string(pkScript)] = i
+	a.addrs[addr.Encode()] = i
+	return addr, nil
+}
+
+// loadAccount sets the account key of the keystore and derives the addresses
+// handed out so far.
+//
+// This function MUST be called with the lock held (for writes).
+func (a *AccountManager) loadAccount(ks *keyStore) error {
+	acctKey, err := bip32.B58Deserialize(ks.PubKey, a.bip32Version())
+	if err != nil {
+		return err
+	}
+	a.ks = ks
+	a.acctKey = acctKey
+	for i := uint32(0); i < ks.NextIndex; i++ {
+		if _, err := a.deriveAddress(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateWallet creates the wallet from the passed BIP39 mnemonic, or from a
+// new one when it is empty, encrypts its seed with the passphrase and returns
+// the mnemonic.  The main chain is scanned for the addresses and outputs of a
+// restored mnemonic before it returns.
+func (a *AccountManager) CreateWallet(passphrase string, mnemonic string) (string, error) {
+	if err := a.enabled(); err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("the passphrase can not be empty")
+	}
+	restored := mnemonic != ""
+	if !restored {
+		entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+		if err != nil {
+			return "", err
+		}
+		mnemonic, err = bip39.NewMnemonic(entropy)
+		if err != nil {
+			return "", err
+		}
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return "", err
+	}
+	acctKey, err := a.deriveAccountKey(seed)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.createKeyStore(seed, passphrase, acctKey); err != nil {
+		return "", err
+	}
+	if restored {
+		if err := a.scanAddresses(); err != nil {
+			return "", err
+		}
+	}
+	return mnemonic, nil
+}
+
+// createKeyStore saves the keystore of a new wallet and loads its account.
+func (a *AccountManager) createKeyStore(seed []byte, passphrase string, acctKey *bip32.Key) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.ks != nil {
+		return ErrWalletExists
+	}
+	ks, err := newKeyStore(keyStorePath(a.cfg.DataDir), seed, passphrase,
+		acctKey.PublicKey().B58Serialize())
+	if err != nil {
+		return err
+	}
+	ks.NextIndex = 1
+	if err := ks.save(); err != nil {
+		return err
+	}
+	if err := a.loadAccount(ks); err != nil {
+		return err
+	}
+	log.Info("Created wallet", "path", ks.path)
+	return nil
+}
+
+// scanAddresses looks through the main chain for the outputs paying to a
+// restored wallet.  Addresses are derived up to addressGapLimit past the last
+// one which received an output, the keystore hands out the addresses after it
+// and the outputs found are added to the utxo index.
+func (a *AccountManager) scanAddresses() error {
+	a.lock.Lock()
+	err := a.useAddress(0)
+	a.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	chain := a.bm.GetChain()
+	for order := uint64(0); order <= uint64(chain.BlockDAG().GetMainChainTip().GetOrder()); order++ {
+		block, err := chain.BlockByOrder(order)
+		if err != nil {
+			return fmt.Errorf("scan of block order %d: %v", order, err)
+		}
+		if a.index.knownInvalid(block) {
+			continue
+		}
+		if err := a.useScripts(block); err != nil {
+			return err
+		}
+		err = a.db.Update(func(dbTx database.Tx) error {
+			return a.index.ConnectBlock(dbTx, block, nil)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.ks.save(); err != nil {
+		return err
+	}
+	log.Info("Scanned wallet", "addresses", a.ks.NextIndex)
+	return nil
+}
+
+// useScripts records the addresses of the wallet paid by the outputs of the
+// passed block.
+func (a *AccountManager) useScripts(block *types.SerializedBlock) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, tx := range block.Transactions() {
+		for _, txOut := range tx.Tx.TxOut {
+			i, ok := a.scripts[string(txOut.PkScript)]
+			if !ok {
+				continue
+			}
+			if err := a.useAddress(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// useAddress records that the address of the passed index received an output,
+// so the addresses up to it are not handed out again, and derives the
+// addresses up to addressGapLimit past it.
+//
+// This function MUST be called with the lock held (for writes).
+func (a *AccountManager) useAddress(i uint32) error {
+	if i >= a.ks.NextIndex {
+		a.ks.NextIndex = i + 1
+	}
+	for j := uint32(len(a.addrs)); j < a.ks.NextIndex+addressGapLimit; j++ {
+		if _, err := a.deriveAddress(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAddress derives the next address of the wallet.
+func (a *AccountManager) NewAddress() (types.Address, error) {
+	if err := a.enabled(); err != nil {
+		return nil, err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.newAddress()
+}
+
+// newAddress derives the next address of the wallet and records it in the
+// keystore.
+//
+// This function MUST be called with the lock held (for writes).
+func (a *AccountManager) newAddress() (types.Address, error) {
+	if a.ks == nil {
+		return nil, ErrNoWallet
+	}
+	addr, err := a.deriveAddress(a.ks.NextIndex)
+	if err != nil {
+		return nil, err
+	}
+	a.ks.NextIndex++
+	if err := a.ks.save(); err != nil {
+		a.ks.NextIndex--
+		return nil, err
+	}
+	return addr, nil
+}
+
+// Unlock decrypts the keys of the wallet.  The wallet locks itself again after
+// timeout, a timeout of zero keeps it unlocked until Lock is called.
+func (a *AccountManager) Unlock(passphrase string, timeout time.Duration) error {
+	if err := a.enabled(); err != nil {
+		return err
+	}
+	a.lock.RLock()
+	ks := a.ks
+	a.lock.RUnlock()
+	if ks == nil {
+		return ErrNoWallet
+	}
+
+	seed, err := ks.decryptSeed(passphrase)
+	if err != nil {
+		return err
+	}
+	privKey, err := a.deriveAccountKey(seed)
+	if err != nil {
+		return err
+	}
+	if privKey.PublicKey().B58Serialize() != ks.PubKey {
+		return errors.New("the decrypted seed does not match the wallet")
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.privKey = privKey
+	if a.lockTimer != nil {
+		a.lockTimer.Stop()
+		a.lockTimer = nil
+	}
+	if timeout > 0 {
+		a.lockTimer = time.AfterFunc(timeout, a.Lock)
+	}
+	return nil
+}
+
+// Lock forgets the decrypted keys of the wallet.
+func (a *AccountManager) Lock() {
+	a.lock.Lock()
+	a.privKey = nil
+	if a.lockTimer != nil {
+		a.lockTimer.Stop()
+		a.lockTimer = nil
+	}
+	a.lock.Unlock()
+}
+
+// isMine returns whether the public key script pays to an address of the
+// wallet.
+func (a *AccountManager) isMine(pkScript []byte) bool {
+	a.lock.RLock()
+	_, ok := a.scripts[string(pkScript)]
+	a.lock.RUnlock()
+	return ok
+}
+
+// spent forgets a pending spend once the output was spent in a block.
+func (a *AccountManager) spent(op *types.TxOutPoint) {
+	a.lock.Lock()
+	delete(a.pending, *op)
+	a.lock.Unlock()
+}
+
+// utxo is an indexed output of the wallet as seen by the chain.
+type utxo struct {
+	outpoint      types.TxOutPoint
+	entry         *blockchain.UtxoEntry
+	confirmations uint
+	mature        bool
+}
+
+// unspent returns the unspent outputs of the wallet.  Outputs of the index
+// which the chain does not know as unspent, or which are not denominated in
+// MEER, are skipped.
+func (a *AccountManager) unspent() ([]*utxo, error) {
+	var outpoints []types.TxOutPoint
+	err := a.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(utxoIndexKey)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			op, err := outpointFromKey(k)
+			if err != nil {
+				return err
+			}
+			outpoints = append(outpoints, op)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chain := a.bm.GetChain()
+	bd := chain.BlockDAG()
+	tip := bd.GetMainChainTip()
+	utxos := make([]*utxo, 0, len(outpoints))
+	for _, op := range outpoints {
+		entry, err := chain.FetchUtxoEntry(op)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || entry.IsSpent() || !entry.Asset().IsMeer() {
+			continue
+		}
+		u := &utxo{outpoint: op, entry: entry, mature: true}
+		if ib := bd.GetBlock(entry.BlockHash()); ib != nil {
+			u.confirmations = bd.GetConfirmations(ib.GetID())
+			if entry.IsCoinBase() {
+				err := bd.CheckBlueAndMature([]uint{ib.GetID()},
+					[]uint{tip.GetID()}, uint(a.params.CoinbaseMaturity))
+				u.mature = err == nil
+			}
+		}
+		utxos = append(utxos, u)
+	}
+	return utxos, nil
+}
+
+// Balance returns the total amount of the mature unspent outputs of the
+// wallet.
+func (a *AccountManager) Balance() (types.Amount, error) {
+	if err := a.enabled(); err != nil {
+		return 0, err
+	}
+	utxos, err := a.unspent()
+	if err != nil {
+		return 0, err
+	}
+	var balance types.Amount
+	for _, u := range utxos {
+		if u.mature {
+			balance += types.Amount(u.entry.Amount())
+		}
+	}
+	return balance, nil
+}
+
+// ListUnspent returns the unspent outputs of the wallet.
+func (a *AccountManager) ListUnspent() ([]*utxo, error) {
+	if err := a.enabled(); err != nil {
+		return nil, err
+	}
+	return a.unspent()
+}
+
+// SendToAddress pays amount to addr from the mature outputs of the wallet,
+// returning change to a new address, and submits the transaction to the
+// mempool.
+func (a *AccountManager) SendToAddress(addr types.Address, amount types.Amount) (*hash.Hash, error) {
+	if err := a.enabled(); err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("invalid amount %v", amount)
+	}
+	a.lock.RLock()
+	locked := a.privKey == nil
+	a.lock.RUnlock()
+	if locked {
+		return nil, ErrLocked
+	}
+
+	utxos, err := a.unspent()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := a.buildTx(addr, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	stx := types.NewTx(tx)
+	acceptedTxs, err := a.bm.ProcessTransaction(stx, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	a.lock.Lock()
+	for _, txIn := range tx.TxIn {
+		a.pending[txIn.PreviousOut] = *stx.Hash()
+	}
+	a.lock.Unlock()
+	if a.notify != nil {
+		a.notify.AnnounceNewTransactions(acceptedTxs)
+	}
+	return stx.Hash(), nil
+}
+
+// buildTx returns the signed transaction paying amount to addr from the
+// passed outputs of the wallet.
+func (a *AccountManager) buildTx(addr types.Address, amount types.Amount, utxos []*utxo) (*types.Transaction, error) {
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	feeRate := a.cfg.MinTxFee
+	mp := a.bm.GetTxManager().MemPool()
+
+	// Spend the largest outputs first to keep the transaction small.
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].entry.Amount() > utxos[j].entry.Amount()
+	})
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.privKey == nil {
+		return nil, ErrLocked
+	}
+
+	tx := types.NewTransaction()
+	tx.AddTxOut(types.NewTxOutput(uint64(amount), pkScript))
+	var total types.Amount
+	var fee int64
+	prevScripts := make([][]byte, 0)
+	for _, u := range utxos {
+		if !u.mature {
+			continue
+		}
+		if txHash, ok := a.pending[u.outpoint]; ok && mp.HaveTransaction(&txHash) {
+			continue
+		}
+		tx.AddTxIn(types.NewTxInput(&u.outpoint, nil))
+		prevScripts = append(prevScripts, u.entry.PkScript())
+		total += types.Amount(u.entry.Amount())
+
+		// Leave room for a change output in the size estimate.
+		size := tx.SerializeSize() + len(tx.TxIn)*redeemP2PKHSigScriptSize +
+			tx.TxOut[0].SerializeSize()
+		fee = calcFee(int64(size), feeRate)
+		if total >= amount+types.Amount(fee) {
+			break
+		}
+	}
+	if total < amount+types.Amount(fee) {
+		return nil, ErrInsufficientFunds
+	}
+
+	// Change which costs more to spend than it is worth is left to the
+	// fee.
+	change := total - amount - types.Amount(fee)
+	dustLimit := 3 * calcFee(int64(dustInputSize+tx.TxOut[0].SerializeSize()), feeRate)
+	if int64(change) > dustLimit {
+		changeAddr, err := a.newAddress()
+		if err != nil {
+			return nil, err
+		}
+		changeScript, err := txscript.PayToAddrScript(changeAddr)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(types.NewTxOutput(uint64(change), changeScript))
+	}
+
+	kdb := txscript.KeyClosure(func(addr types.Address) (ecc.PrivateKey, bool, error) {
+		i, ok := a.addrs[addr.Encode()]
+		if !ok {
+			return nil, false, fmt.Errorf("address %s is not in the wallet", addr.Encode())
+		}
+		child, err := a.privKey.NewChildKey(i)
+		if err != nil {
+			return nil, false, err
+		}
+		privKey, _ := ecc.Secp256k1.PrivKeyFromBytes(child.Key)
+		return privKey, true, nil
+	})
+	for i := range tx.TxIn {
+		sigScript, err := txscript.SignTxOutput(a.params, tx, i, prevScripts[i],
+			txscript.SigHashAll, kdb, nil, nil, ecc.ECDSA_Secp256k1)
+		if err != nil {
+			return nil, err
+		}
+		tx.TxIn[i].SignScript = sigScript
+	}
+	return tx, nil
+}
+
+// calcFee returns the fee of a transaction of the passed size at a fee rate in
+// atoms per kB.
+func calcFee(size int64, feeRate int64) int64 {
+	fee := size * feeRate / 1000
+	if fee == 0 && feeRate > 0 {
+		fee = feeRate
+	}
+	return fee
+}
+
+func New(cfg *config.Config, par *params.Params, db database.DB, ntmgr notify.Notify) (*AccountManager, error) {
+	a := AccountManager{
+		cfg:     cfg,
+		params:  par,
+		db:      db,
+		notify:  ntmgr,
+		scripts: make(map[string]uint32),
+		addrs:   make(map[string]uint32),
+		pending: make(map[types.TxOutPoint]hash.Hash),
+	}
+	a.index = &UtxoIndex{am: &a}
+	if !cfg.Wallet {
+		return &a, nil
+	}
+
+	ks, err := loadKeyStore(keyStorePath(cfg.DataDir))
+	if err == ErrNoWallet {
+		log.Info("No wallet found, create one with createWallet")
+		return &a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.loadAccount(ks); err != nil {
+		return nil, err
+	}
+	log.Info("Loaded wallet", "path", ks.path, "addresses", ks.NextIndex)
 	return &a, nil
 }
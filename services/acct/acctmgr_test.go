@@ -0,0 +1,83 @@
+package acct
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func Test_AddressGapLimit(t *testing.T) {
+	a := &AccountManager{
+		params:  &params.PrivNetParams,
+		scripts: make(map[string]uint32),
+		addrs:   make(map[string]uint32),
+	}
+	acctKey, err := a.deriveAccountKey(bytes.Repeat([]byte{0x5a}, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.loadAccount(&keyStore{
+		PubKey:    acctKey.PublicKey().B58Serialize(),
+		NextIndex: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.useAddress(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// payTo returns a block paying to the addresses of the passed indexes.
+	payTo := func(indexes ...uint32) *types.SerializedBlock {
+		tx := types.NewTransaction()
+		for _, i := range indexes {
+			child, err := a.acctKey.NewChildKey(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr, err := a.addressOf(child.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkScript, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.AddTxOut(types.NewTxOutput(1, pkScript))
+		}
+		block := &types.Block{Header: types.BlockHeader{
+			Pow: pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{}),
+		}}
+		block.AddTransaction(tx)
+		return types.NewBlock(block)
+	}
+
+	tests := []struct {
+		indexes   []uint32
+		nextIndex uint32
+	}{
+		// The lookahead finds addresses up to the gap limit.
+		{[]uint32{addressGapLimit}, addressGapLimit + 1},
+		// Each use extends the lookahead.
+		{[]uint32{2 * addressGapLimit}, 2*addressGapLimit + 1},
+		// Lower addresses do not move the next index back.
+		{[]uint32{3}, 2*addressGapLimit + 1},
+		// Addresses past the gap limit are not found.
+		{[]uint32{4*addressGapLimit + 1}, 2*addressGapLimit + 1},
+	}
+	for i, test := range tests {
+		if err := a.useScripts(payTo(test.indexes...)); err != nil {
+			t.Fatal(err)
+		}
+		if a.ks.NextIndex != test.nextIndex {
+			t.Fatalf("test %d: next index %d, want %d", i,
+				a.ks.NextIndex, test.nextIndex)
+		}
+		if len(a.addrs) != int(test.nextIndex+addressGapLimit) {
+			t.Fatalf("test %d: %d addresses derived, want %d", i,
+				len(a.addrs), test.nextIndex+addressGapLimit)
+		}
+	}
+}
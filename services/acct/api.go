@@ -1,16 +1,138 @@
 package acct
 
-// PublicEthereumAPI provides an API to access Ethereum full node-related
-// information.
+import (
+	"encoding/hex"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/rpc"
+	"time"
+)
+
+// PublicAccountManagerAPI provides the read only API to the wallet of the node.
 type PublicAccountManagerAPI struct {
 	a *AccountManager
 }
 
-// NewPublicEthereumAPI creates a new Ethereum protocol API for full nodes.
+// NewPublicAccountManagerAPI creates a new wallet API.
 func NewPublicAccountManagerAPI(a *AccountManager) *PublicAccountManagerAPI {
 	return &PublicAccountManagerAPI{a}
 }
 
-func (api *PublicAccountManagerAPI) GetBalance() int32 {
-	return 0
+// GetBalance returns the amount of the mature unspent outputs of the wallet
+// in MEER.
+func (api *PublicAccountManagerAPI) GetBalance() (interface{}, error) {
+	balance, err := api.a.Balance()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to get balance")
+	}
+	return balance.ToCoin(), nil
+}
+
+// ListUnspent returns the unspent outputs of the wallet.
+func (api *PublicAccountManagerAPI) ListUnspent() (interface{}, error) {
+	utxos, err := api.a.ListUnspent()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to list unspent outputs")
+	}
+	results := make([]json.ListUnspentResult, 0, len(utxos))
+	for _, u := range utxos {
+		pkScript := u.entry.PkScript()
+		var addr string
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, api.a.params)
+		if err == nil && len(addrs) > 0 {
+			addr = addrs[0].Encode()
+		}
+		results = append(results, json.ListUnspentResult{
+			TxId:          u.outpoint.Hash.String(),
+			Vout:          u.outpoint.OutIndex,
+			Address:       addr,
+			ScriptPubKey:  hex.EncodeToString(pkScript),
+			Amount:        types.Amount(u.entry.Amount()).ToCoin(),
+			Confirmations: u.confirmations,
+			Coinbase:      u.entry.IsCoinBase(),
+			Spendable:     u.mature,
+		})
+	}
+	return results, nil
+}
+
+// PrivateWalletAPI provides the operations of the wallet which hold or use
+// its keys.  They are in the wallet namespace, which is only served when it is
+// listed in the RPC modules.
+type PrivateWalletAPI struct {
+	a *AccountManager
+}
+
+// NewPrivateWalletAPI creates a new private wallet API.
+func NewPrivateWalletAPI(a *AccountManager) *PrivateWalletAPI {
+	return &PrivateWalletAPI{a}
+}
+
+// CreateWallet creates the wallet of the node, encrypted with the passphrase,
+// and returns its BIP39 mnemonic.  An existing mnemonic can be passed to
+// restore a wallet.
+func (api *PrivateWalletAPI) CreateWallet(passphrase string, mnemonic *string) (interface{}, error) {
+	m := ""
+	if mnemonic != nil {
+		m = *mnemonic
+	}
+	m, err := api.a.CreateWallet(passphrase, m)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to create wallet")
+	}
+	return m, nil
+}
+
+// GetNewAddress derives a new receiving address of the wallet.
+func (api *PrivateWalletAPI) GetNewAddress() (interface{}, error) {
+	addr, err := api.a.NewAddress()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to derive address")
+	}
+	return addr.Encode(), nil
+}
+
+// SendToAddress pays amount MEER to the address from the wallet and returns
+// the id of the transaction.  The wallet must be unlocked.
+func (api *PrivateWalletAPI) SendToAddress(addr string, amount float64) (interface{}, error) {
+	a, err := address.DecodeAddress(addr)
+	if err != nil {
+		return nil, rpc.RpcAddressKeyError("Could not decode address: %v", err)
+	}
+	if !address.IsForNetwork(a, api.a.params) {
+		return nil, rpc.RpcAddressKeyError("Wrong network: %v", addr)
+	}
+	atoms, err := types.NewAmount(amount)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid amount: %v", err)
+	}
+	txHash, err := api.a.SendToAddress(a, atoms)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to send")
+	}
+	return txHash.String(), nil
+}
+
+// Unlock decrypts the keys of the wallet for timeout seconds, or until lock is
+// called when timeout is zero.
+func (api *PrivateWalletAPI) Unlock(passphrase string, timeout int64) (interface{}, error) {
+	if timeout < 0 {
+		return nil, rpc.RpcInvalidError("Invalid timeout %d", timeout)
+	}
+	err := api.a.Unlock(passphrase, time.Duration(timeout)*time.Second)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to unlock wallet")
+	}
+	return nil, nil
+}
+
+// Lock forgets the decrypted keys of the wallet.
+func (api *PrivateWalletAPI) Lock() (interface{}, error) {
+	if err := api.a.enabled(); err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to lock wallet")
+	}
+	api.a.Lock()
+	return nil, nil
 }
@@ -0,0 +1,208 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package acct
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// keyStoreDirName is the directory under the data dir that houses the
+	// wallet keystore.
+	keyStoreDirName = "keystore"
+
+	// keyStoreFileName is the name of the encrypted wallet file.
+	keyStoreFileName = "wallet.json"
+
+	keyStoreVersion = 1
+
+	// The scrypt parameters used to derive the encryption key from the
+	// passphrase.
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// scryptN is the CPU/memory cost of the key derivation.  It is a variable so
+// the tests can use a cheaper setting.
+var scryptN = 1 << 18
+
+var (
+	// ErrNoWallet is returned when an operation needs a wallet and none has
+	// been created in the data dir.
+	ErrNoWallet = errors.New("no wallet found, create one with createWallet")
+
+	// ErrWalletExists is returned when creating a wallet over an existing
+	// one.
+	ErrWalletExists = errors.New("wallet already exists")
+
+	// ErrDecrypt is returned when the passphrase does not decrypt the
+	// wallet seed.
+	ErrDecrypt = errors.New("could not decrypt the wallet with the given passphrase")
+)
+
+type scryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+type cryptoJSON struct {
+	Cipher     string       `json:"cipher"`
+	CipherText string       `json:"ciphertext"`
+	Nonce      string       `json:"nonce"`
+	KDF        string       `json:"kdf"`
+	KDFParams  scryptParams `json:"kdfparams"`
+}
+
+// keyStore is the on-disk form of the wallet.  The BIP39 seed is kept
+// encrypted with a key derived from the passphrase, while the extended public
+// key of the account and the number of derived addresses are kept in the clear
+// so the wallet can watch its addresses while locked.
+type keyStore struct {
+	Version   int        `json:"version"`
+	PubKey    string     `json:"xpub"`
+	NextIndex uint32     `json:"nextindex"`
+	Crypto    cryptoJSON `json:"crypto"`
+
+	path string
+}
+
+// keyStorePath returns the path of the wallet file in the data dir.
+func keyStorePath(dataDir string) string {
+	return filepath.Join(dataDir, keyStoreDirName, keyStoreFileName)
+}
+
+// loadKeyStore reads the wallet file at path.  It returns ErrNoWallet when
+// there is no such file.
+func loadKeyStore(path string) (*keyStore, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoWallet
+	}
+	if err != nil {
+		return nil, err
+	}
+	ks := &keyStore{path: path}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("malformed wallet file %s: %v", path, err)
+	}
+	if ks.Version != keyStoreVersion {
+		return nil, fmt.Errorf("unsupported wallet version %d", ks.Version)
+	}
+	return ks, nil
+}
+
+// newKeyStore encrypts seed with passphrase and returns the keystore that
+// holds it.  The keystore is not written until save is called.
+func newKeyStore(path string, seed []byte, passphrase string, pubKey string) (*keyStore, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	cipherText := gcm.Seal(nil, nonce, seed, nil)
+
+	return &keyStore{
+		Version: keyStoreVersion,
+		PubKey:  pubKey,
+		Crypto: cryptoJSON{
+			Cipher:     "aes-256-gcm",
+			CipherText: hex.EncodeToString(cipherText),
+			Nonce:      hex.EncodeToString(nonce),
+			KDF:        "scrypt",
+			KDFParams: scryptParams{
+				N:    scryptN,
+				R:    scryptR,
+				P:    scryptP,
+				Salt: hex.EncodeToString(salt),
+			},
+		},
+		path: path,
+	}, nil
+}
+
+// decryptSeed returns the seed of the wallet.
+func (ks *keyStore) decryptSeed(passphrase string) ([]byte, error) {
+	c := &ks.Crypto
+	if c.Cipher != "aes-256-gcm" || c.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported wallet encryption %s/%s", c.KDF, c.Cipher)
+	}
+	salt, err := hex.DecodeString(c.KDFParams.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(c.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, c.KDFParams.N, c.KDFParams.R,
+		c.KDFParams.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid wallet nonce size %d", len(nonce))
+	}
+	seed, err := gcm.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return seed, nil
+}
+
+// save writes the keystore to its file.  The file is written to a temporary
+// file first so a crash never leaves a truncated wallet behind.
+func (ks *keyStore) save() error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
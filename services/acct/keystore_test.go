@@ -0,0 +1,52 @@
+package acct
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_KeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(n int) { scryptN = n }(scryptN)
+	scryptN = 1 << 10
+
+	path := keyStorePath(dir)
+	if _, err := loadKeyStore(path); err != ErrNoWallet {
+		t.Fatalf("got error %v, want %v", err, ErrNoWallet)
+	}
+
+	seed := bytes.Repeat([]byte{0x5a}, 64)
+	ks, err := newKeyStore(path, seed, "passphrase", "xpub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.NextIndex = 3
+	if err := ks.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PubKey != "xpub" || loaded.NextIndex != 3 {
+		t.Fatalf("loaded keystore differs: %+v", loaded)
+	}
+	if _, err := loaded.decryptSeed("wrong"); err != ErrDecrypt {
+		t.Fatalf("got error %v, want %v", err, ErrDecrypt)
+	}
+	decrypted, err := loaded.decryptSeed("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, seed) {
+		t.Fatal("decrypted seed differs")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package acct
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+const (
+	// utxoIndexName is the human-readable name for the index.
+	utxoIndexName = "account utxo index"
+)
+
+var (
+	// utxoIndexKey is the key of the wallet utxo index and the db bucket
+	// used to house it.
+	utxoIndexKey = []byte("acctutxoidx")
+)
+
+// UtxoIndex tracks the outputs paying to the addresses of the wallet as blocks
+// connect and disconnect.  The outputs are kept in a bucket keyed by the
+// serialized outpoint, the chain remains the authority on whether an indexed
+// output can still be spent.
+//
+// The serialized format of the keys is:
+//
+//   <txid><index>
+//
+//   Field      Type        Size
+//   txid       hash.Hash   32
+//   index      uint32      4
+type UtxoIndex struct {
+	am    *AccountManager
+	chain *blockchain.BlockChain
+}
+
+// outpointKey returns the key of an outpoint in the index bucket.
+func outpointKey(op *types.TxOutPoint) []byte {
+	key := make([]byte, hash.HashSize+4)
+	copy(key, op.Hash[:])
+	binary.LittleEndian.PutUint32(key[hash.HashSize:], op.OutIndex)
+	return key
+}
+
+// outpointFromKey returns the outpoint serialized in an index bucket key.
+func outpointFromKey(key []byte) (types.TxOutPoint, error) {
+	var op types.TxOutPoint
+	if len(key) != hash.HashSize+4 {
+		return op, fmt.Errorf("malformed outpoint key %x", key)
+	}
+	copy(op.Hash[:], key[:hash.HashSize])
+	op.OutIndex = binary.LittleEndian.Uint32(key[hash.HashSize:])
+	return op, nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) Key() []byte {
+	return utxoIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) Name() string {
+	return utxoIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(utxoIndexKey)
+	return err
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing
+// to initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) Init() error {
+	return nil
+}
+
+// SetChain sets the chain the index looks up block states in.
+//
+// This is part of the ChainSetter interface.
+func (idx *UtxoIndex) SetChain(chain *blockchain.BlockChain) {
+	idx.chain = chain
+}
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to restore the outputs spent by disconnected blocks.
+//
+// This implements the NeedsInputser interface.
+func (idx *UtxoIndex) NeedsInputs() bool {
+	return true
+}
+
+// knownInvalid returns whether the passed block was marked invalid by the
+// chain, in which case none of its transactions take effect.
+func (idx *UtxoIndex) knownInvalid(block *types.SerializedBlock) bool {
+	if idx.chain == nil {
+		return false
+	}
+	node := idx.chain.BlockIndex().LookupNode(block.Hash())
+	return node != nil && node.GetStatus().KnownInvalid()
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  It removes the outputs of the wallet spent by
+// the block and adds the outputs paying to the wallet.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	if idx.knownInvalid(block) {
+		return nil
+	}
+	bucket := dbTx.Metadata().Bucket(utxoIndexKey)
+	for _, tx := range block.Transactions() {
+		if !tx.Tx.IsCoinBase() {
+			for _, txIn := range tx.Tx.TxIn {
+				key := outpointKey(&txIn.PreviousOut)
+				if bucket.Get(key) == nil {
+					continue
+				}
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+				idx.am.spent(&txIn.PreviousOut)
+			}
+		}
+		for i, txOut := range tx.Tx.TxOut {
+			if !idx.am.isMine(txOut.PkScript) {
+				continue
+			}
+			op := types.NewOutPoint(tx.Hash(), uint32(i))
+			if err := bucket.Put(outpointKey(op), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  It removes the outputs created by the
+// block and restores the outputs of the wallet it spent.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	if idx.knownInvalid(block) {
+		return nil
+	}
+	bucket := dbTx.Metadata().Bucket(utxoIndexKey)
+	txs := block.Transactions()
+	for _, tx := range txs {
+		for i := range tx.Tx.TxOut {
+			op := types.NewOutPoint(tx.Hash(), uint32(i))
+			if err := bucket.Delete(outpointKey(op)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, stxo := range stxos {
+		if !idx.am.isMine(stxo.PkScript) {
+			continue
+		}
+		if int(stxo.TxIndex) >= len(txs) ||
+			int(stxo.TxInIndex) >= len(txs[stxo.TxIndex].Tx.TxIn) {
+			return fmt.Errorf("spent output %d:%d is outside of block %s",
+				stxo.TxIndex, stxo.TxInIndex, block.Hash())
+		}
+		op := &txs[stxo.TxIndex].Tx.TxIn[stxo.TxInIndex].PreviousOut
+		if err := bucket.Put(outpointKey(op), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/common/marshal"
+	"github.com/Qitmeer/qitmeer/core/address"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
 	"strconv"
 )
@@ -154,8 +157,8 @@ func (api *PublicBlockAPI) GetBlock(h hash.Hash, verbose *bool, inclTx *bool, fu
 	cs := ib.GetChildren()
 	children := []*hash.Hash{}
 	if cs != nil && !cs.IsEmpty() {
-		for _, v := range cs.GetMap() {
-			children = append(children, v.(blockdag.IBlock).GetHash())
+		for k := range cs.GetMap() {
+			children = append(children, api.bm.chain.BlockDAG().GetBlockHash(k))
 		}
 	}
 	api.bm.chain.CalculateDAGDuplicateTxs(blk)
@@ -215,8 +218,8 @@ func (api *PublicBlockAPI) GetBlockV2(h hash.Hash, verbose *bool, inclTx *bool,
 	cs := ib.GetChildren()
 	children := []*hash.Hash{}
 	if cs != nil && !cs.IsEmpty() {
-		for _, v := range cs.GetMap() {
-			children = append(children, v.(blockdag.IBlock).GetHash())
+		for k := range cs.GetMap() {
+			children = append(children, api.bm.chain.BlockDAG().GetBlockHash(k))
 		}
 	}
 	api.bm.chain.CalculateDAGDuplicateTxs(blk)
@@ -290,6 +293,17 @@ func (api *PublicBlockAPI) GetBlockHeader(hash hash.Hash, verbose bool) (interfa
 		Time:          blockHeader.Timestamp.Unix(),
 		PowResult:     blockHeader.Pow.GetPowResult(),
 	}
+	// The state root of the utxo set after connecting the block at its
+	// current order, as computed by this node.
+	if node.IsOrdered() {
+		stateRoot, err := api.bm.chain.FetchStateRoot(node.GetOrder())
+		if err != nil {
+			return nil, rpc.RpcInternalError(err.Error(), "Fetch state root")
+		}
+		if stateRoot != nil {
+			blockHeaderReply.OrderState = stateRoot.String()
+		}
+	}
 
 	return blockHeaderReply, nil
 
@@ -387,6 +401,117 @@ func (api *PublicBlockAPI) Tips() (interface{}, error) {
 	return tips, nil
 }
 
+// Return the anticone of a block at the current state of the DAG.
+func (api *PublicBlockAPI) GetAnticone(h hash.Hash) (interface{}, error) {
+	anticone, err := api.bm.chain.BlockDAG().GetAnticone(&h)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return hashStrings(anticone), nil
+}
+
+// Return a page of the past set of a block, the closest blocks first.
+func (api *PublicBlockAPI) GetPastSet(h hash.Hash, start *uint, count *uint) (interface{}, error) {
+	return api.getDAGSet(api.bm.chain.BlockDAG().GetPastSet, h, start, count)
+}
+
+// Return a page of the future set of a block, the closest blocks first.
+func (api *PublicBlockAPI) GetFutureSet(h hash.Hash, start *uint, count *uint) (interface{}, error) {
+	return api.getDAGSet(api.bm.chain.BlockDAG().GetFutureSet, h, start, count)
+}
+
+// Return a page of the blue set of the past of a block, as colored by the block.
+func (api *PublicBlockAPI) GetBlueSet(h hash.Hash, start *uint, count *uint) (interface{}, error) {
+	return api.getDAGSet(api.bm.chain.BlockDAG().GetBlueSet, h, start, count)
+}
+
+func (api *PublicBlockAPI) getDAGSet(getSet func(*hash.Hash, uint, uint) ([]*hash.Hash, bool, error),
+	h hash.Hash, start *uint, count *uint) (interface{}, error) {
+	s := uint(0)
+	if start != nil {
+		s = *start
+	}
+	c := uint(blockdag.MaxTopologyPageSize)
+	if count != nil {
+		c = *count
+	}
+	blocks, more, err := getSet(&h, s, c)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return json.GetDAGSetResult{
+		Hash:   h.String(),
+		Start:  s,
+		Blocks: hashStrings(blocks),
+		More:   more,
+	}, nil
+}
+
+// Return the main parent chain from a block to one of its descendants.
+func (api *PublicBlockAPI) GetMainParentChain(from hash.Hash, to hash.Hash) (interface{}, error) {
+	chain, err := api.bm.chain.BlockDAG().GetMainParentChain(&from, &to)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return hashStrings(chain), nil
+}
+
+// Return the maturity of the target block in the view of the passed blocks,
+// it is the layer distance to the highest view having the target in its past.
+// The maturity is 0 when none of the views has the target in its past.
+func (api *PublicBlockAPI) GetBlockMaturity(target hash.Hash, views []hash.Hash) (interface{}, error) {
+	bd := api.bm.chain.BlockDAG()
+	ib := bd.GetBlock(&target)
+	if ib == nil {
+		return nil, rpc.RpcInvalidError("Block not found: %v", target)
+	}
+	if len(views) == 0 {
+		return nil, rpc.RpcInvalidError("No view blocks")
+	}
+	viewIds := make([]uint, 0, len(views))
+	for i := range views {
+		view := bd.GetBlock(&views[i])
+		if view == nil {
+			return nil, rpc.RpcInvalidError("Block not found: %v", views[i])
+		}
+		viewIds = append(viewIds, view.GetID())
+	}
+	return bd.GetMaturity(ib.GetID(), viewIds), nil
+}
+
+// Export the blocks of a range of orders with their parents, main parent,
+// coloring and layer.  The format is json, whose blocks can be replayed as
+// blockdag test data, or dot for graphviz.
+func (api *PublicBlockAPI) ExportDAG(start uint, end uint, format *string) (interface{}, error) {
+	f := "json"
+	if format != nil {
+		f = *format
+	}
+	if f != "json" && f != "dot" {
+		return nil, rpc.RpcInvalidError("Unknown format %s, use json or dot", f)
+	}
+	blocks, err := api.bm.chain.BlockDAG().Export(start, end)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	if f == "json" {
+		return blocks, nil
+	}
+	var buf bytes.Buffer
+	if err := blockdag.WriteDot(&buf, blocks); err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Export DAG")
+	}
+	return buf.String(), nil
+}
+
+func hashStrings(hs []*hash.Hash) []string {
+	result := make([]string, 0, len(hs))
+	for _, h := range hs {
+		result = append(result, h.String())
+	}
+	return result
+}
+
 // GetCoinbase
 func (api *PublicBlockAPI) GetCoinbase(h hash.Hash, verbose *bool) (interface{}, error) {
 	vb := false
@@ -415,3 +540,235 @@ func (api *PublicBlockAPI) GetCoinbase(h hash.Hash, verbose *bool) (interface{},
 func (api *PublicBlockAPI) GetFees(h hash.Hash) (interface{}, error) {
 	return api.bm.chain.GetFees(&h), nil
 }
+
+// GetAssetInfo returns the registry information of an issued asset.
+func (api *PublicBlockAPI) GetAssetInfo(id string) (interface{}, error) {
+	assetId, err := types.NewAssetIdFromStr(id)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid asset id: %v", id)
+	}
+	entry, err := api.bm.chain.FetchAssetEntry(*assetId)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch asset")
+	}
+	if entry == nil {
+		return nil, rpc.RpcInvalidError("Asset not found: %v", id)
+	}
+	return api.marshalAssetEntry(entry), nil
+}
+
+// ListAssets returns the registry information of all issued assets.
+func (api *PublicBlockAPI) ListAssets() (interface{}, error) {
+	entries, err := api.bm.chain.FetchAssetEntries()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch assets")
+	}
+	result := make([]json.OrderedResult, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, api.marshalAssetEntry(entry))
+	}
+	return result, nil
+}
+
+// GetAssetBalances returns the amount of every asset held by an address.
+func (api *PublicBlockAPI) GetAssetBalances(addr string) (interface{}, error) {
+	a, err := address.DecodeAddress(addr)
+	if err != nil {
+		return nil, rpc.RpcAddressKeyError("Could not decode "+
+			"address: %v", err)
+	}
+	if !address.IsForNetwork(a, api.bm.ChainParams()) {
+		return nil, rpc.RpcAddressKeyError("Wrong network: %v", addr)
+	}
+	pkScript, err := txscript.PayToAddrScript(a)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Pay to address script")
+	}
+	balances, err := api.bm.chain.FetchAssetBalances(pkScript)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch asset balances")
+	}
+	result := make(map[string]uint64, len(balances))
+	for id, amount := range balances {
+		result[id.String()] = amount
+	}
+	return result, nil
+}
+
+// GetBlockReceipt returns the receipt of the contract transactions of a
+// connected block.
+func (api *PublicBlockAPI) GetBlockReceipt(h hash.Hash) (interface{}, error) {
+	receipt, err := api.bm.chain.FetchBlockReceipt(&h)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch block receipt")
+	}
+	if receipt == nil {
+		return nil, rpc.RpcInvalidError("No receipt for block: %v", h)
+	}
+	txReceipts := make([]json.OrderedResult, 0, len(receipt.TxReceipts))
+	for _, txr := range receipt.TxReceipts {
+		txReceipts = append(txReceipts, json.OrderedResult{
+			{Key: "txid", Val: txr.TxHash.String()},
+			{Key: "contractid", Val: txr.Contract.String()},
+			{Key: "success", Val: txr.Success},
+			{Key: "gasused", Val: txr.GasUsed},
+			{Key: "events", Val: marshalEvents(txr.Events)},
+		})
+	}
+	return json.OrderedResult{
+		{Key: "hash", Val: h.String()},
+		{Key: "order", Val: receipt.BlockNumber},
+		{Key: "storageroot", Val: receipt.StorageRoot.String()},
+		{Key: "changeroot", Val: receipt.ChangeRoot.String()},
+		{Key: "transactions", Val: txReceipts},
+	}, nil
+}
+
+// GetContract returns the owner and the code of a contract.
+func (api *PublicBlockAPI) GetContract(id string) (interface{}, error) {
+	contractId, err := types.NewContractIdFromStr(id)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid contract id: %v", id)
+	}
+	entry, err := api.bm.chain.FetchContract(*contractId)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch contract")
+	}
+	if entry == nil {
+		return nil, rpc.RpcInvalidError("Contract not found: %v", id)
+	}
+	owner := hex.EncodeToString(entry.Owner())
+	_, addrs, _, _ := txscript.ExtractPkScriptAddrs(entry.Owner(), api.bm.ChainParams())
+	if len(addrs) == 1 {
+		owner = addrs[0].Encode()
+	}
+	return json.OrderedResult{
+		{Key: "contractid", Val: entry.Id().String()},
+		{Key: "owner", Val: owner},
+		{Key: "code", Val: hex.EncodeToString(entry.Code())},
+	}, nil
+}
+
+// marshalEvents returns the hex encoding of the passed events.
+func marshalEvents(events []types.Event) []string {
+	result := make([]string, 0, len(events))
+	for _, event := range events {
+		result = append(result, hex.EncodeToString(event))
+	}
+	return result
+}
+
+// GetCFilter returns the serialized committed filter of a block.
+func (api *PublicBlockAPI) GetCFilter(h hash.Hash, filterType *uint8) (interface{}, error) {
+	if api.bm.cfIndex == nil {
+		return nil, rpc.RpcNoCFIndexError()
+	}
+	ft := message.GCSFilterRegular
+	if filterType != nil {
+		ft = message.FilterType(*filterType)
+	}
+	filterBytes, err := api.bm.cfIndex.FilterByBlockHash(&h, ft)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Failed to fetch filter: %v", err)
+	}
+	if filterBytes == nil {
+		return nil, rpc.RpcInvalidError("No filter for block: %v", h)
+	}
+	return hex.EncodeToString(filterBytes), nil
+}
+
+// GetCFilterHeader returns the committed filter header of a block.
+func (api *PublicBlockAPI) GetCFilterHeader(h hash.Hash, filterType *uint8) (interface{}, error) {
+	if api.bm.cfIndex == nil {
+		return nil, rpc.RpcNoCFIndexError()
+	}
+	ft := message.GCSFilterRegular
+	if filterType != nil {
+		ft = message.FilterType(*filterType)
+	}
+	header, err := api.bm.cfIndex.FilterHeaderByBlockHash(&h, ft)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Failed to fetch filter header: %v", err)
+	}
+	if header == nil {
+		return nil, rpc.RpcInvalidError("No filter header for block: %v", h)
+	}
+	return header.String(), nil
+}
+
+// GetDeploymentInfo returns the state of the consensus rule change deployments
+// defined for the block version of the chain, as of the block following the
+// main chain tip.
+func (api *PublicBlockAPI) GetDeploymentInfo() (interface{}, error) {
+	chain := api.bm.chain
+	par := api.bm.ChainParams()
+	tip := chain.BlockDAG().GetMainChainTip().GetHash()
+	deployments := par.Deployments[chain.BlockVersion]
+	result := json.GetDeploymentInfoResult{
+		Hash:        tip.String(),
+		Window:      par.MinerConfirmationWindow,
+		Threshold:   par.RuleChangeActivationThreshold,
+		Deployments: make([]json.DeploymentInfoResult, 0, len(deployments)),
+	}
+	for id, deployment := range deployments {
+		state, err := chain.ThresholdState(tip, uint32(id))
+		if err != nil {
+			return nil, rpc.RpcInternalError(err.Error(), "Failed to get deployment state")
+		}
+		result.Deployments = append(result.Deployments, json.DeploymentInfoResult{
+			Name:       deploymentName(id),
+			Bit:        deployment.BitNumber,
+			StartTime:  deployment.StartTime,
+			ExpireTime: deployment.ExpireTime,
+			Status:     thresholdStateName(state),
+		})
+	}
+	return result, nil
+}
+
+// deploymentName returns the name of a deployment as shown by the RPC.
+func deploymentName(id int) string {
+	switch id {
+	case params.DeploymentStateRoot:
+		return "stateroot"
+	case params.DeploymentAssets:
+		return "assets"
+	case params.DeploymentContracts:
+		return "contracts"
+	}
+	return fmt.Sprintf("deployment%d", id)
+}
+
+// thresholdStateName returns the name of a threshold state as shown by the RPC.
+func thresholdStateName(state blockchain.ThresholdState) string {
+	switch state {
+	case blockchain.ThresholdDefined:
+		return "defined"
+	case blockchain.ThresholdStarted:
+		return "started"
+	case blockchain.ThresholdLockedIn:
+		return "lockedin"
+	case blockchain.ThresholdActive:
+		return "active"
+	case blockchain.ThresholdFailed:
+		return "failed"
+	}
+	return state.String()
+}
+
+func (api *PublicBlockAPI) marshalAssetEntry(entry *blockchain.AssetEntry) json.OrderedResult {
+	issuer := hex.EncodeToString(entry.Issuer())
+	_, addrs, _, _ := txscript.ExtractPkScriptAddrs(entry.Issuer(), api.bm.ChainParams())
+	if len(addrs) == 1 {
+		issuer = addrs[0].Encode()
+	}
+	issueTx := entry.IssueTx()
+	return json.OrderedResult{
+		{Key: "assetid", Val: entry.Id().String()},
+		{Key: "issuetx", Val: issueTx.String()},
+		{Key: "issuer", Val: issuer},
+		{Key: "supply", Val: entry.Supply()},
+		{Key: "revoked", Val: entry.Revoked()},
+		{Key: "circulating", Val: entry.Circulating()},
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/common/progresslog"
+	"github.com/Qitmeer/qitmeer/services/index"
+	"github.com/Qitmeer/qitmeer/services/mempool"
 	"github.com/Qitmeer/qitmeer/services/zmq"
 	"sync"
 	"sync/atomic"
@@ -86,6 +88,17 @@ type BlockManager struct {
 
 	//tx manager
 	txManager TxManager
+
+	// committed filter index, nil when committed filters are disabled
+	cfIndex *index.CfIndex
+
+	// fee estimator fed by the connected blocks, nil when disabled
+	feeEstimator *mempool.FeeEstimator
+
+	// compact blocks waiting for their missing transactions, and the
+	// peers sending the new blocks as compact blocks unannounced
+	cmpctBlocks        map[hash.Hash]*pendingCmpctBlock
+	cmpctHighBandwidth []*peer.ServerPeer
 }
 
 // NewBlockManager returns a new block manager.
@@ -102,6 +115,7 @@ func NewBlockManager(ntmgr notify.Notify, indexManager blockchain.IndexManager,
 		requestedTxns:     make(map[hash.Hash]struct{}),
 		requestedEverTxns: make(map[hash.Hash]uint8),
 		requestedBlocks:   make(map[hash.Hash]struct{}),
+		cmpctBlocks:       make(map[hash.Hash]*pendingCmpctBlock),
 		peers:             make(map[*peer.Peer]*peer.ServerPeer),
 		progressLogger:    progresslog.NewBlockProgressLogger("Processed", log),
 		msgChan:           make(chan interface{}, cfg.MaxPeers*3),
@@ -120,6 +134,8 @@ func NewBlockManager(ntmgr notify.Notify, indexManager blockchain.IndexManager,
 		SigCache:       sigCache,
 		IndexManager:   indexManager,
 		DAGType:        cfg.DAGType,
+		DAGCacheSize:   cfg.DAGCacheSize,
+		PruneTarget:    cfg.Prune * 1024 * 1024,
 		BlockVersion:   blockVersion,
 		CacheInvalidTx: cfg.CacheInvalidTx,
 	})
@@ -245,12 +261,14 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.notify.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		/*
-			if r := b.server.rpcServer; r != nil {
-				// Notify registered websocket clients of incoming block.
-				r.ntfnMgr.NotifyBlockConnected(block)
-			}
-		*/
+		// Register block with the fee estimator, if it exists.
+		if b.feeEstimator != nil {
+			b.feeEstimator.RegisterBlock(block)
+		}
+
+		// Notify registered websocket and getblocktemplate long poll
+		// clients of incoming block.
+		b.notify.NotifyBlockConnected(block)
 
 		b.zmqNotify.BlockConnected(block)
 
@@ -262,22 +280,28 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			log.Warn("Chain disconnected notification is not a block slice.")
 			break
 		}
+
+		// Rollback previous block recorded by the fee estimator.
+		if b.feeEstimator != nil {
+			if err := b.feeEstimator.Rollback(block.Hash()); err != nil {
+				log.Debug("Fee estimator rollback", "error", err)
+			}
+		}
+
 		b.zmqNotify.BlockDisconnected(block)
 	// The blockchain is reorganizing.
 	case blockchain.Reorganization:
 		log.Trace("Chain reorganization notification")
-		/*
-			rd, ok := notification.Data.(*blockchain.ReorganizationNotifyData)
-			if !ok {
-				log.Warn("Chain reorganization notification is malformed")
-				break
-			}
+		rd, ok := notification.Data.(*blockchain.ReorganizationNotifyData)
+		if !ok {
+			log.Warn("Chain reorganization notification is malformed")
+			break
+		}
 
-			// Notify registered websocket clients.
-			if r := b.server.rpcServer; r != nil {
-				r.ntfnMgr.NotifyReorganization(rd)
-			}
+		// Notify registered websocket clients.
+		b.notify.NotifyReorganization(rd)
 
+		/*
 			// Drop the associated mining template from the old chain, since it
 			// will be no longer valid.
 			b.cachedCurrentTemplate = nil
@@ -519,6 +543,14 @@ out:
 				score := b.handleBlockMsg(msg)
 				log.Trace("notify syncPeer BlockProcessed done")
 				msg.peer.BlockProcessed <- score
+			case *cmpctBlockMsg:
+				log.Trace("blkmgr msgChan cmpctBlockMsg", "msg", msg)
+				score := b.handleCmpctBlockMsg(msg)
+				msg.peer.BlockProcessed <- score
+			case *blockTxnMsg:
+				log.Trace("blkmgr msgChan blockTxnMsg", "msg", msg)
+				score := b.handleBlockTxnMsg(msg)
+				msg.peer.BlockProcessed <- score
 			case *invMsg:
 				log.Trace("blkmgr msgChan invMsg", "msg", msg)
 				b.handleInvMsg(msg)
@@ -571,17 +603,6 @@ out:
 					b.GetTxManager().MemPool().PruneExpiredTx()
 				}
 
-				// Allow any clients performing long polling via the
-				// getblocktemplate RPC to be notified when the new block causes
-				// their old block template to become stale.
-				// TODO, re-impl the client notify by subscript/publish
-				/*
-					rpcServer := b.rpcServer
-					if rpcServer != nil {
-						rpcServer.gbtWorkState.NotifyBlockConnected(msg.block.Hash())
-					}
-				*/
-
 				msg.reply <- processBlockResponse{
 					isOrphan: isOrphan,
 					err:      nil,
@@ -1054,6 +1075,14 @@ func (b *BlockManager) GetTxManager() TxManager {
 	return b.txManager
 }
 
+func (b *BlockManager) SetCfIndex(cfIndex *index.CfIndex) {
+	b.cfIndex = cfIndex
+}
+
+func (b *BlockManager) SetFeeEstimator(feeEstimator *mempool.FeeEstimator) {
+	b.feeEstimator = feeEstimator
+}
+
 // headerNode is used as a node in a list of headers that are linked together
 // between checkpoints.
 type headerNode struct {
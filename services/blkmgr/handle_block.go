@@ -132,19 +132,13 @@ func (b *BlockManager) handleBlockMsg(bmsg *blockMsg) connmgr.BanScore {
 		// Clear the rejected transactions.
 		b.rejectedTxns = make(map[hash.Hash]struct{})
 
-		// Allow any clients performing long polling via the
-		// getblocktemplate RPC to be notified when the new block causes
-		// their old block template to become stale.
-		// TODO, refactor how bm work with rpc-server
-		/*
-			rpcServer := b.server.rpcServer
-			if rpcServer != nil {
-				rpcServer.gbtWorkState.NotifyBlockConnected(blockHash)
-			}
-		*/
 		isCurrent := b.IsCurrent()
 		if isCurrent {
 			log.Info("Your synchronization has been completed. ")
+
+			// The peer delivered a new block, ask it to send the
+			// next ones as compact blocks unannounced.
+			b.updateCmpctHighBandwidth(bmsg.peer)
 		}
 
 		if len(b.requestedBlocks) == 0 ||
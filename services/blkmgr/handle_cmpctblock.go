@@ -0,0 +1,239 @@
+package blkmgr
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/services/cmpctblock"
+	"sync/atomic"
+)
+
+// maxCmpctHighBandwidthPeers is the maximum number of peers asked to send the
+// new blocks as compact blocks without announcing them first.
+const maxCmpctHighBandwidthPeers = 3
+
+// pendingCmpctBlock is a compact block waiting for the transactions which
+// were requested from its peer.
+type pendingCmpctBlock struct {
+	block *cmpctblock.PartialBlock
+	peer  *peer.ServerPeer
+}
+
+// cmpctBlockMsg packages a cmpctblock message and the peer it came from
+// together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	msg  *message.MsgCmpctBlock
+	peer *peer.ServerPeer
+}
+
+// blockTxnMsg packages a blocktxn message and the peer it came from together
+// so the block handler has access to that information.
+type blockTxnMsg struct {
+	msg  *message.MsgBlockTxn
+	peer *peer.ServerPeer
+}
+
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.  Like for the blocks, the result is sent to the
+// BlockProcessed channel of the peer.
+func (b *BlockManager) QueueCmpctBlock(msg *message.MsgCmpctBlock, sp *peer.ServerPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.BlockProcessed <- connmgr.NoneScore
+		return
+	}
+	b.msgChan <- &cmpctBlockMsg{msg: msg, peer: sp}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue.  Like for the blocks, the result is sent to the
+// BlockProcessed channel of the peer.
+func (b *BlockManager) QueueBlockTxn(msg *message.MsgBlockTxn, sp *peer.ServerPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.BlockProcessed <- connmgr.NoneScore
+		return
+	}
+	b.msgChan <- &blockTxnMsg{msg: msg, peer: sp}
+}
+
+// useCmpctBlocks returns whether the blocks announced by the peer are fetched
+// as compact blocks.  They are only worth it once the chain is current, since
+// the transactions of the old blocks aren't in the pool.
+func (b *BlockManager) useCmpctBlocks(sp *peer.ServerPeer) bool {
+	return !b.config.NoCmpctBlocks && sp.SupportsCmpctBlocks() && b.IsCurrent()
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The block
+// is reconstructed from the transaction pool, and the missing transactions
+// are requested from the peer.
+func (b *BlockManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) connmgr.BanScore {
+	sp, exists := b.peers[cmsg.peer.Peer]
+	if !exists {
+		log.Warn(fmt.Sprintf("Received compact block message from unknown peer %s", cmsg.peer))
+		return connmgr.SlightScore
+	}
+	blockHash := cmsg.msg.Header.BlockHash()
+
+	// The compact block is either requested, or sent unannounced by a high
+	// bandwidth peer.  The ones sent by a peer which was just moved out of
+	// the high bandwidth mode are ignored.
+	_, requested := sp.RequestedBlocks[blockHash]
+	if !requested && !b.isCmpctHighBandwidth(sp) {
+		log.Debug("Ignoring unrequested compact block", "hash", blockHash,
+			"peer", sp)
+		return connmgr.NoneScore
+	}
+	if _, exists := b.cmpctBlocks[blockHash]; exists {
+		return connmgr.NoneScore
+	}
+	haveBlock, err := b.chain.HaveBlock(&blockHash)
+	if err != nil {
+		log.Warn("Unexpected failure when checking for existing block",
+			"hash", blockHash, "error", err)
+		return connmgr.NoneScore
+	}
+	if haveBlock {
+		delete(sp.RequestedBlocks, blockHash)
+		delete(b.requestedBlocks, blockHash)
+		return connmgr.NoneScore
+	}
+	if !requested {
+		// Leave the block to the peer it is already requested from.
+		if _, exists := b.requestedBlocks[blockHash]; exists {
+			return connmgr.NoneScore
+		}
+		b.requestedBlocks[blockHash] = struct{}{}
+		b.limitMap(b.requestedBlocks, maxRequestedBlocks)
+		sp.RequestedBlocks[blockHash] = struct{}{}
+	}
+
+	pb, err := cmpctblock.NewPartialBlock(cmsg.msg,
+		b.GetTxManager().MemPool().MiningDescs())
+	if err == cmpctblock.ErrShortIDCollision {
+		log.Debug("Fetching the full block of the compact block", "hash",
+			blockHash, "peer", sp, "error", err)
+		b.requestFullBlock(&blockHash, sp)
+		return connmgr.NoneScore
+	}
+	if err != nil {
+		log.Warn("Rejected compact block", "hash", blockHash, "peer", sp,
+			"error", err)
+		delete(sp.RequestedBlocks, blockHash)
+		delete(b.requestedBlocks, blockHash)
+		return connmgr.ManyScore
+	}
+
+	missing := pb.Missing()
+	if len(missing) > 0 {
+		log.Debug("Requesting the missing transactions of the compact block",
+			"hash", blockHash, "missing", len(missing),
+			"txs", cmsg.msg.TxCount(), "peer", sp)
+		b.cmpctBlocks[blockHash] = &pendingCmpctBlock{block: pb, peer: sp}
+		sp.QueueMessage(message.NewMsgGetBlockTxn(&blockHash, missing), nil)
+		return connmgr.NoneScore
+	}
+	return b.processPartialBlock(pb, sp)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  They complete
+// the compact blocks waiting for their missing transactions.
+func (b *BlockManager) handleBlockTxnMsg(bmsg *blockTxnMsg) connmgr.BanScore {
+	sp, exists := b.peers[bmsg.peer.Peer]
+	if !exists {
+		log.Warn(fmt.Sprintf("Received blocktxn message from unknown peer %s", bmsg.peer))
+		return connmgr.SlightScore
+	}
+	blockHash := bmsg.msg.BlockHash
+	pending, exists := b.cmpctBlocks[blockHash]
+	if !exists || pending.peer != sp {
+		log.Debug("Ignoring unrequested block transactions", "hash",
+			blockHash, "peer", sp)
+		return connmgr.NoneScore
+	}
+	delete(b.cmpctBlocks, blockHash)
+
+	if err := pending.block.Fill(bmsg.msg); err != nil {
+		log.Warn("Rejected block transactions", "hash", blockHash,
+			"peer", sp, "error", err)
+		delete(sp.RequestedBlocks, blockHash)
+		delete(b.requestedBlocks, blockHash)
+		return connmgr.ManyScore
+	}
+	return b.processPartialBlock(pending.block, sp)
+}
+
+// processPartialBlock processes the reconstructed block like the blocks
+// received in full.  When the transactions taken from the pool turn out not to
+// be the ones of the block, the block is fetched in full.
+func (b *BlockManager) processPartialBlock(pb *cmpctblock.PartialBlock, sp *peer.ServerPeer) connmgr.BanScore {
+	block, err := pb.Block()
+	if err != nil {
+		log.Debug("Fetching the full block of the compact block", "hash",
+			pb.Hash(), "peer", sp, "error", err)
+		b.requestFullBlock(pb.Hash(), sp)
+		return connmgr.NoneScore
+	}
+	return b.handleBlockMsg(&blockMsg{block: block, peer: sp})
+}
+
+// requestFullBlock requests the block in full from the peer, it stays
+// requested from this peer.
+func (b *BlockManager) requestFullBlock(blockHash *hash.Hash, sp *peer.ServerPeer) {
+	gdmsg := message.NewMsgGetData()
+	gdmsg.AddInvVect(message.NewInvVect(message.InvTypeBlock, blockHash))
+	sp.QueueMessage(gdmsg, nil)
+}
+
+// isCmpctHighBandwidth returns whether the peer is asked to send the new
+// blocks as compact blocks without announcing them.
+func (b *BlockManager) isCmpctHighBandwidth(sp *peer.ServerPeer) bool {
+	for _, p := range b.cmpctHighBandwidth {
+		if p == sp {
+			return true
+		}
+	}
+	return false
+}
+
+// updateCmpctHighBandwidth asks the peer which delivered a new block to send
+// the next ones as compact blocks without announcing them.  Only the last
+// maxCmpctHighBandwidthPeers peers doing so are kept in the high bandwidth
+// mode, the oldest one is moved out of it.
+func (b *BlockManager) updateCmpctHighBandwidth(sp *peer.ServerPeer) {
+	if b.config.NoCmpctBlocks || !sp.SupportsCmpctBlocks() {
+		return
+	}
+	peers := make([]*peer.ServerPeer, 0, maxCmpctHighBandwidthPeers)
+	for _, p := range b.cmpctHighBandwidth {
+		if p != sp {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == len(b.cmpctHighBandwidth) {
+		if len(peers) >= maxCmpctHighBandwidthPeers {
+			peers[0].QueueMessage(message.NewMsgSendCmpct(false), nil)
+			peers = peers[1:]
+		}
+		sp.QueueMessage(message.NewMsgSendCmpct(true), nil)
+	}
+	b.cmpctHighBandwidth = append(peers, sp)
+}
+
+// clearCmpctState forgets the compact block state of the peer which is gone.
+func (b *BlockManager) clearCmpctState(sp *peer.ServerPeer) {
+	for blockHash, pending := range b.cmpctBlocks {
+		if pending.peer == sp {
+			delete(b.cmpctBlocks, blockHash)
+		}
+	}
+	for i, p := range b.cmpctHighBandwidth {
+		if p == sp {
+			b.cmpctHighBandwidth = append(b.cmpctHighBandwidth[:i],
+				b.cmpctHighBandwidth[i+1:]...)
+			break
+		}
+	}
+}
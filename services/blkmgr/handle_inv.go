@@ -121,6 +121,7 @@ func (b *BlockManager) handleInvMsg(imsg *invMsg) {
 	// Request as much as possible at once.  Anything that won't fit into
 	// the request will be requested on the next inv message.
 	numRequested := 0
+	useCmpctBlocks := b.useCmpctBlocks(imsg.peer)
 	gdmsg := message.NewMsgGetData()
 	requestQueue := imsg.peer.RequestQueue
 	for len(requestQueue) != 0 {
@@ -136,7 +137,12 @@ func (b *BlockManager) handleInvMsg(imsg *invMsg) {
 				b.requestedBlocks[iv.Hash] = struct{}{}
 				b.limitMap(b.requestedBlocks, maxRequestedBlocks)
 				imsg.peer.RequestedBlocks[iv.Hash] = struct{}{}
-				gdmsg.AddInvVect(iv)
+				if useCmpctBlocks {
+					gdmsg.AddInvVect(message.NewInvVect(
+						message.InvTypeCmpctBlock, &iv.Hash))
+				} else {
+					gdmsg.AddInvVect(iv)
+				}
 				numRequested++
 			}
 
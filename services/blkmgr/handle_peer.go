@@ -54,6 +54,7 @@ func (b *BlockManager) handleDonePeerMsg(sp *peer.ServerPeer) {
 	log.Info("Lost peer", "peer", sp)
 
 	b.clearRequestedState(sp)
+	b.clearCmpctState(sp)
 
 	if b.syncPeer == sp {
 		// Update the sync peer. The server has already disconnected the
@@ -30,6 +30,8 @@ type TxPool interface {
 
 	HaveTransaction(hash *hash.Hash) bool
 
+	MiningDescs() []*types.TxDesc
+
 	PruneExpiredTx()
 
 	ProcessTransaction(tx *types.Tx, allowOrphan, rateLimit, allowHighFees bool) ([]*types.TxDesc, error)
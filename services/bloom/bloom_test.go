@@ -0,0 +1,116 @@
+package bloom
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func Test_MurmurHash3(t *testing.T) {
+	// Test vectors from the bitcoind bloom filter tests.
+	tests := []struct {
+		seed uint32
+		data []byte
+		want uint32
+	}{
+		{0x00000000, []byte{}, 0x00000000},
+		{0xfba4c795, []byte{}, 0x6a396f08},
+		{0xffffffff, []byte{}, 0x81f16f39},
+		{0x00000000, []byte{0x00}, 0x514e28b7},
+		{0x00000000, []byte{0x21, 0x43, 0x65, 0x87}, 0xf55b516b},
+		{0x5082edee, []byte{0x21, 0x43, 0x65, 0x87}, 0x2362f9de},
+	}
+	for _, test := range tests {
+		if got := MurmurHash3(test.seed, test.data); got != test.want {
+			t.Errorf("MurmurHash3(%x, %x) = %x, want %x", test.seed,
+				test.data, got, test.want)
+		}
+	}
+}
+
+func Test_Filter(t *testing.T) {
+	f := NewFilter(10, 0, 0.000001, message.BloomUpdateAll)
+	if !f.IsLoaded() {
+		t.Fatal("new filter is not loaded")
+	}
+
+	data := []byte{0x99, 0x10, 0x8a, 0xd8, 0xed, 0x9b, 0xb6, 0x27}
+	if f.Matches(data) {
+		t.Fatal("empty filter matches data")
+	}
+	f.Add(data)
+	if !f.Matches(data) {
+		t.Fatal("filter does not match added data")
+	}
+
+	op := types.NewOutPoint(&hash.Hash{0x01}, 2)
+	f.AddOutPoint(op)
+	if !f.MatchesOutPoint(op) {
+		t.Fatal("filter does not match added outpoint")
+	}
+
+	f.Unload()
+	if f.IsLoaded() || f.Matches(data) {
+		t.Fatal("unloaded filter still matches")
+	}
+}
+
+func Test_MerkleBlock(t *testing.T) {
+	block := &types.Block{Header: params.PrivNetParams.GenesisBlock.Header}
+	for i := 0; i < 5; i++ {
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{byte(i + 1)}, 0), nil))
+		tx.AddTxOut(types.NewTxOutput(uint64(i+1), []byte{0x51}))
+		block.Transactions = append(block.Transactions, tx)
+	}
+	sb := types.NewBlock(block)
+	merkles := merkle.BuildMerkleTreeStore(sb.Transactions(), false)
+	root := merkles[len(merkles)-1]
+
+	f := NewFilter(10, 0, 0.000001, message.BloomUpdateNone)
+	f.AddHash(sb.Transactions()[3].Hash())
+
+	mb, matched := NewMerkleBlock(sb, f)
+	if mb.Transactions != 5 {
+		t.Fatalf("got %d transactions, want 5", mb.Transactions)
+	}
+	if len(matched) != 1 || matched[0] != 3 {
+		t.Fatalf("got matched indices %v, want [3]", matched)
+	}
+
+	// Walk the partial merkle tree the way an SPV client does and check
+	// that it commits to the root of the block.
+	var bitsUsed, hashesUsed uint32
+	width := func(height uint32) uint32 {
+		return (mb.Transactions + (1 << height) - 1) >> height
+	}
+	var extract func(height, pos uint32) *hash.Hash
+	extract = func(height, pos uint32) *hash.Hash {
+		bit := (mb.Flags[bitsUsed/8] >> (bitsUsed % 8)) & 1
+		bitsUsed++
+		if height == 0 || bit == 0 {
+			h := mb.Hashes[hashesUsed]
+			hashesUsed++
+			return h
+		}
+		left := extract(height-1, pos*2)
+		right := left
+		if pos*2+1 < width(height-1) {
+			right = extract(height-1, pos*2+1)
+		}
+		return merkle.HashMerkleBranches(left, right)
+	}
+	height := uint32(0)
+	for width(height) > 1 {
+		height++
+	}
+	if got := extract(height, 0); !got.IsEqual(root) {
+		t.Fatalf("partial merkle root %v, want %v", got, root)
+	}
+	if hashesUsed != uint32(len(mb.Hashes)) {
+		t.Fatalf("used %d of %d hashes", hashesUsed, len(mb.Hashes))
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2017 The btcsuite developers
+// Copyright (c) 2017 The Lightning Network Developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+)
+
+// DeriveKey derives the siphash key of a block filter from the block hash.
+func DeriveKey(blockHash *hash.Hash) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], blockHash[:KeySize])
+	return key
+}
+
+// BuildBasicFilter builds the basic filter of a block.  It contains the public
+// key script of every output created by the block and of every output the
+// block spends, which are passed in prevOutScripts since they are not part of
+// the block itself.  Empty and OP_RETURN scripts are never included.
+func BuildBasicFilter(block *types.Block, prevOutScripts [][]byte) (*Filter, error) {
+	blockHash := block.BlockHash()
+	key := DeriveKey(&blockHash)
+
+	data := make([][]byte, 0, len(prevOutScripts)+len(block.Transactions))
+	for _, tx := range block.Transactions {
+		for _, txOut := range tx.TxOut {
+			if len(txOut.PkScript) == 0 ||
+				txOut.PkScript[0] == txscript.OP_RETURN {
+				continue
+			}
+			data = append(data, txOut.PkScript)
+		}
+	}
+	for _, pkScript := range prevOutScripts {
+		if len(pkScript) == 0 {
+			continue
+		}
+		data = append(data, pkScript)
+	}
+
+	return NewFilter(DefaultP, DefaultM, key, data)
+}
+
+// MakeHeaderForFilter makes a filter chain header for a filter, given the
+// filter and the previous filter chain header.
+func MakeHeaderForFilter(filter *Filter, prevHeader *hash.Hash) (hash.Hash, error) {
+	filterHash, err := filter.Hash()
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return MakeHeaderForFilterHash(&filterHash, prevHeader), nil
+}
+
+// MakeHeaderForFilterHash makes a filter chain header from the hash of a
+// filter and the previous filter chain header.
+func MakeHeaderForFilterHash(filterHash *hash.Hash, prevHeader *hash.Hash) hash.Hash {
+	var data [hash.HashSize * 2]byte
+	copy(data[:], filterHash[:])
+	copy(data[hash.HashSize:], prevHeader[:])
+	return hash.DoubleHashH(data[:])
+}
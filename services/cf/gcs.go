@@ -0,0 +1,321 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Copyright (c) 2016-2017 The Lightning Network Developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package cf implements the Golomb-coded set (GCS) compact block filters
+// described by BIP158 and the filter header chain of BIP157.
+package cf
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// DefaultP is the Golomb-Rice coding parameter of the basic filter.
+	DefaultP = 19
+
+	// DefaultM is the inverse false positive rate of the basic filter.
+	DefaultM = 784931
+
+	// MaxFilterN is the maximum number of items a filter may contain.
+	MaxFilterN = 1<<32 - 1
+)
+
+var (
+	// ErrNTooBig signifies that the filter can't handle N items.
+	ErrNTooBig = errors.New("N is too big to fit in uint32")
+
+	// ErrPTooBig signifies that the filter can't handle `1/2**P`
+	// collision probability.
+	ErrPTooBig = errors.New("P is too big, the maximum is 32")
+
+	// ErrMisserialized signifies a filter that was serialized incorrectly.
+	ErrMisserialized = errors.New("filter data is malformed")
+)
+
+// Filter describes an immutable filter that can be built from a set of data
+// elements, serialized, deserialized, and queried in a thread-safe manner.
+// The serialized form is compressed as a Golomb Coded Set (GCS) and is
+// prefixed by the number of items it contains as a variable length integer.
+type Filter struct {
+	n          uint32
+	p          uint8
+	modulusNM  uint64
+	filterData []byte
+}
+
+// hashToRange maps the siphash of the passed data uniformly onto the range
+// [0, f) without a division.
+func hashToRange(key *[KeySize]byte, data []byte, f uint64) uint64 {
+	hi, _ := bits.Mul64(SipHash24(key, data), f)
+	return hi
+}
+
+// NewFilter builds a new GCS filter with the collision probability of
+// `1/(2**P)`, the inverse false positive rate M, key `key`, and including
+// every []byte in `data` as a member of the set.  Duplicate items are only
+// added once.
+func NewFilter(P uint8, M uint64, key [KeySize]byte, data [][]byte) (*Filter, error) {
+	if uint64(len(data)) > MaxFilterN {
+		return nil, ErrNTooBig
+	}
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+
+	// Remove duplicate items so the set is the same regardless of how many
+	// times an item was added.
+	unique := make([][]byte, 0, len(data))
+	seen := make(map[string]struct{}, len(data))
+	for _, d := range data {
+		if _, ok := seen[string(d)]; ok {
+			continue
+		}
+		seen[string(d)] = struct{}{}
+		unique = append(unique, d)
+	}
+
+	// Hash the items into the target range and sort them so the
+	// differences can be Golomb-Rice coded.
+	modulusNM := uint64(len(unique)) * M
+	values := make([]uint64, 0, len(unique))
+	for _, d := range unique {
+		values = append(values, hashToRange(&key, d, modulusNM))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var w bitWriter
+	var last uint64
+	for _, v := range values {
+		w.writeGolomb(v-last, P)
+		last = v
+	}
+
+	return &Filter{
+		n:          uint32(len(unique)),
+		p:          P,
+		modulusNM:  modulusNM,
+		filterData: w.bytes,
+	}, nil
+}
+
+// FromNBytes deserializes a GCS filter from a known P and M, and serialized
+// filter as returned by NBytes().
+func FromNBytes(P uint8, M uint64, d []byte) (*Filter, error) {
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+	r := bytes.NewReader(d)
+	n, err := s.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, ErrMisserialized
+	}
+	if n > MaxFilterN {
+		return nil, ErrNTooBig
+	}
+	return &Filter{
+		n:          uint32(n),
+		p:          P,
+		modulusNM:  n * M,
+		filterData: d[len(d)-r.Len():],
+	}, nil
+}
+
+// N returns the size of the data set used to build the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// P returns the filter's collision probability as a negative power of 2.
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// Bytes returns the serialized format of the GCS filter without the number
+// of items it contains.
+func (f *Filter) Bytes() []byte {
+	filterData := make([]byte, len(f.filterData))
+	copy(filterData, f.filterData)
+	return filterData
+}
+
+// NBytes returns the serialized format of the GCS filter with N, which uses
+// a variable length integer, prepended.
+func (f *Filter) NBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(s.VarIntSerializeSize(uint64(f.n)) + len(f.filterData))
+	if err := s.WriteVarInt(&buf, 0, uint64(f.n)); err != nil {
+		return nil, err
+	}
+	buf.Write(f.filterData)
+	return buf.Bytes(), nil
+}
+
+// Hash returns the double hash of the serialized filter, which is the value
+// committed to by the filter header chain.
+func (f *Filter) Hash() (hash.Hash, error) {
+	nBytes, err := f.NBytes()
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.DoubleHashH(nBytes), nil
+}
+
+// Match checks whether a []byte value is likely (within collision probability)
+// to be a member of the set represented by the filter.
+func (f *Filter) Match(key [KeySize]byte, data []byte) (bool, error) {
+	if f.n == 0 {
+		return false, nil
+	}
+	term := hashToRange(&key, data, f.modulusNM)
+
+	r := bitReader{data: f.filterData}
+	var value uint64
+	for i := uint32(0); i < f.n; i++ {
+		delta, err := r.readGolomb(f.p)
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		switch {
+		case value == term:
+			return true, nil
+		case value > term:
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// MatchAny checks whether any []byte value is likely (within collision
+// probability) to be a member of the set represented by the filter faster
+// than calling Match() for each value individually.
+func (f *Filter) MatchAny(key [KeySize]byte, data [][]byte) (bool, error) {
+	if f.n == 0 || len(data) == 0 {
+		return false, nil
+	}
+	terms := make([]uint64, 0, len(data))
+	for _, d := range data {
+		terms = append(terms, hashToRange(&key, d, f.modulusNM))
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+
+	// Walk the filter and the sorted terms in lockstep.
+	r := bitReader{data: f.filterData}
+	var value uint64
+	t := 0
+	for i := uint32(0); i < f.n; i++ {
+		delta, err := r.readGolomb(f.p)
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for terms[t] < value {
+			t++
+			if t == len(terms) {
+				return false, nil
+			}
+		}
+		if terms[t] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// bitWriter appends individual bits to a byte slice, most significant bit
+// first.
+type bitWriter struct {
+	bytes []byte
+	free  uint8
+}
+
+// writeBit appends a single bit.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.bytes[len(w.bytes)-1] |= 1 << w.free
+	}
+}
+
+// writeBits appends the n least significant bits of v.
+func (w *bitWriter) writeBits(v uint64, n uint8) {
+	for n > 0 {
+		n--
+		w.writeBit(v&(1<<n) != 0)
+	}
+}
+
+// writeGolomb appends the Golomb-Rice coding of v with parameter p: the
+// quotient in unary followed by the p bit remainder.
+func (w *bitWriter) writeGolomb(v uint64, p uint8) {
+	for q := v >> p; q > 0; q-- {
+		w.writeBit(true)
+	}
+	w.writeBit(false)
+	w.writeBits(v, p)
+}
+
+// bitReader reads individual bits from a byte slice written by bitWriter.
+type bitReader struct {
+	data []byte
+	pos  uint64
+}
+
+// readBit returns the next bit.
+func (r *bitReader) readBit() (bool, error) {
+	idx := r.pos / 8
+	if idx >= uint64(len(r.data)) {
+		return false, ErrMisserialized
+	}
+	bit := r.data[idx]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits returns the next n bits as an integer.
+func (r *bitReader) readBits(n uint8) (uint64, error) {
+	var v uint64
+	for ; n > 0; n-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// readGolomb returns the next Golomb-Rice coded value with parameter p.
+func (r *bitReader) readGolomb(p uint8) (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+	rem, err := r.readBits(p)
+	if err != nil {
+		return 0, err
+	}
+	return q<<p | rem, nil
+}
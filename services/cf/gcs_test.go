@@ -0,0 +1,98 @@
+package cf
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"testing"
+)
+
+func Test_SipHash24(t *testing.T) {
+	// Test vectors from the reference implementation with the key
+	// 00 01 02 ... 0f and the messages 00 01 02 ... (len-1).
+	var key [KeySize]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	tests := []struct {
+		len  int
+		want uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{1, 0x74f839c593dc67fd},
+		{7, 0xab0200f58b01d137},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, test := range tests {
+		msg := make([]byte, test.len)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		if got := SipHash24(&key, msg); got != test.want {
+			t.Errorf("siphash of %d bytes: got %x, want %x", test.len, got, test.want)
+		}
+	}
+}
+
+func Test_FilterMatch(t *testing.T) {
+	key := DeriveKey(&hash.Hash{1, 2, 3})
+	var contents [][]byte
+	for i := 0; i < 100; i++ {
+		contents = append(contents, []byte{0x76, 0xa9, byte(i), byte(i >> 8)})
+	}
+	// Duplicates are only stored once.
+	contents = append(contents, contents[0])
+
+	f, err := NewFilter(DefaultP, DefaultM, key, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.N() != 100 {
+		t.Fatalf("filter has %d items, want 100", f.N())
+	}
+
+	// Round trip the filter through its serialized form.
+	nBytes, err := f.NBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := FromNBytes(DefaultP, DefaultM, nBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Bytes(), f2.Bytes()) || f2.N() != f.N() {
+		t.Fatal("deserialized filter differs")
+	}
+
+	for _, c := range contents {
+		match, err := f2.Match(key, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Fatalf("filter does not match %x", c)
+		}
+	}
+	match, err := f2.Match(key, []byte("not in the filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Fatal("filter matched an item it does not contain")
+	}
+
+	match, err = f2.MatchAny(key, [][]byte{[]byte("nope"), contents[42]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Fatal("filter does not match any of the items")
+	}
+	match, err = f2.MatchAny(key, [][]byte{[]byte("nope"), []byte("nor this")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Fatal("filter matched items it does not contain")
+	}
+}
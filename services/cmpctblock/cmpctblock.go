@@ -0,0 +1,209 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package cmpctblock builds the compact blocks of the blocks and reconstructs
+// the blocks of the compact blocks from the transaction pool.
+package cmpctblock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/services/cf"
+)
+
+// shortIDMask keeps the low ShortIDSize bytes of the siphash of a transaction.
+const shortIDMask = 1<<(8*message.ShortIDSize) - 1
+
+var (
+	// ErrShortIDCollision is returned when two transactions of a compact
+	// block have the same short id, the block has to be fetched in full.
+	ErrShortIDCollision = errors.New("short id collision in compact block")
+
+	// ErrTxRootMismatch is returned when the reconstructed transactions
+	// don't match the transaction root of the header, which happens when
+	// a transaction of the pool collides with a transaction of the block.
+	// The block has to be fetched in full.
+	ErrTxRootMismatch = errors.New("reconstructed block doesn't match its transaction root")
+)
+
+// ShortIDKey returns the siphash key of the short ids of a compact block, it
+// is derived from the header and the nonce so that the collisions can't be
+// predicted across the blocks and peers.
+func ShortIDKey(header *types.BlockHeader, nonce uint64) *[cf.KeySize]byte {
+	var buf bytes.Buffer
+	header.Serialize(&buf)
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], nonce)
+	buf.Write(n[:])
+
+	var key [cf.KeySize]byte
+	copy(key[:], hash.HashB(buf.Bytes()))
+	return &key
+}
+
+// ShortID returns the short id of the transaction hash.
+func ShortID(key *[cf.KeySize]byte, txHash *hash.Hash) uint64 {
+	return cf.SipHash24(key, txHash[:]) & shortIDMask
+}
+
+// New returns the compact block of the block, the coinbase is prefilled and
+// the other transactions are given by their short ids.
+func New(block *types.SerializedBlock) (*message.MsgCmpctBlock, error) {
+	nonce, err := s.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	msgBlock := block.Block()
+	msg := message.NewMsgCmpctBlock(&msgBlock.Header, msgBlock.Parents, nonce)
+	key := ShortIDKey(&msgBlock.Header, nonce)
+	for i, tx := range block.Transactions() {
+		if i == 0 {
+			msg.PrefilledTxs = append(msg.PrefilledTxs,
+				&message.PrefilledTx{Index: 0, Tx: tx.Tx})
+			continue
+		}
+		msg.ShortIDs = append(msg.ShortIDs, ShortID(key, tx.Hash()))
+	}
+	return msg, nil
+}
+
+// BlockTxn returns the transactions of the block requested by the getblocktxn
+// message.
+func BlockTxn(block *types.SerializedBlock, msg *message.MsgGetBlockTxn) (*message.MsgBlockTxn, error) {
+	txs := block.Block().Transactions
+	result := message.NewMsgBlockTxn(block.Hash())
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txs) {
+			return nil, fmt.Errorf("transaction index %d is out of range, "+
+				"the block has %d transactions", index, len(txs))
+		}
+		result.Transactions = append(result.Transactions, txs[index])
+	}
+	return result, nil
+}
+
+// PartialBlock is a block being reconstructed from a compact block.  The
+// transactions found in the pool are filled in, and the missing ones have to
+// be requested from the peer by a getblocktxn message.
+type PartialBlock struct {
+	msg     *message.MsgCmpctBlock
+	hash    hash.Hash
+	txs     []*types.Transaction
+	missing []uint32
+}
+
+// NewPartialBlock fills the transactions of the compact block from the
+// transactions of the pool.  ErrShortIDCollision is returned when the compact
+// block can't be reconstructed.
+func NewPartialBlock(msg *message.MsgCmpctBlock, pool []*types.TxDesc) (*PartialBlock, error) {
+	count := msg.TxCount()
+	if count == 0 {
+		return nil, errors.New("compact block without transactions")
+	}
+	pb := &PartialBlock{
+		msg:  msg,
+		hash: msg.Header.BlockHash(),
+		txs:  make([]*types.Transaction, count),
+	}
+	for _, ptx := range msg.PrefilledTxs {
+		if int(ptx.Index) >= count || pb.txs[ptx.Index] != nil {
+			return nil, fmt.Errorf("invalid prefilled transaction index %d",
+				ptx.Index)
+		}
+		pb.txs[ptx.Index] = ptx.Tx
+	}
+
+	// Map the short ids to the indexes of the transactions they stand for.
+	indexes := make(map[uint64]uint32, len(msg.ShortIDs))
+	next := 0
+	for i := range pb.txs {
+		if pb.txs[i] != nil {
+			continue
+		}
+		id := msg.ShortIDs[next]
+		next++
+		if _, exists := indexes[id]; exists {
+			return nil, ErrShortIDCollision
+		}
+		indexes[id] = uint32(i)
+	}
+
+	// A short id matching several transactions of the pool is ambiguous,
+	// its transaction is requested from the peer.
+	key := ShortIDKey(&msg.Header, msg.Nonce)
+	ambiguous := make(map[uint32]struct{})
+	for _, desc := range pool {
+		index, exists := indexes[ShortID(key, desc.Tx.Hash())]
+		if !exists {
+			continue
+		}
+		if pb.txs[index] != nil {
+			ambiguous[index] = struct{}{}
+			continue
+		}
+		pb.txs[index] = desc.Tx.Tx
+	}
+	for index := range ambiguous {
+		pb.txs[index] = nil
+	}
+
+	for i, tx := range pb.txs {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// Hash returns the hash of the block.
+func (pb *PartialBlock) Hash() *hash.Hash {
+	return &pb.hash
+}
+
+// Missing returns the indexes of the transactions which weren't found in the
+// pool, in increasing order.
+func (pb *PartialBlock) Missing() []uint32 {
+	return pb.missing
+}
+
+// Fill fills the missing transactions with the transactions of the blocktxn
+// message, which must be the requested ones.
+func (pb *PartialBlock) Fill(msg *message.MsgBlockTxn) error {
+	if len(msg.Transactions) != len(pb.missing) {
+		return fmt.Errorf("got %d transactions of block %s instead of "+
+			"the %d requested", len(msg.Transactions), pb.hash,
+			len(pb.missing))
+	}
+	for i, index := range pb.missing {
+		pb.txs[index] = msg.Transactions[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// Block returns the reconstructed block once no transaction is missing.
+// ErrTxRootMismatch is returned when the transactions don't match the header.
+func (pb *PartialBlock) Block() (*types.SerializedBlock, error) {
+	if len(pb.missing) > 0 {
+		return nil, fmt.Errorf("block %s misses %d transactions", pb.hash,
+			len(pb.missing))
+	}
+	block := types.NewBlock(&types.Block{
+		Header:       pb.msg.Header,
+		Parents:      pb.msg.Parents,
+		Transactions: pb.txs,
+	})
+	merkles := merkle.BuildMerkleTreeStore(block.Transactions(), false)
+	if !pb.msg.Header.TxRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, ErrTxRootMismatch
+	}
+	return block, nil
+}
@@ -0,0 +1,127 @@
+package cmpctblock
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/params"
+	"testing"
+)
+
+func testBlock(n int) *types.SerializedBlock {
+	block := &types.Block{Header: params.PrivNetParams.GenesisBlock.Header}
+	block.Parents = []*hash.Hash{&hash.Hash{0x01}}
+	for i := 0; i < n; i++ {
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{byte(i + 1)}, 0), nil))
+		tx.AddTxOut(types.NewTxOutput(uint64(i+1), []byte{0x51}))
+		block.Transactions = append(block.Transactions, tx)
+	}
+	merkles := merkle.BuildMerkleTreeStore(types.NewBlock(block).Transactions(), false)
+	block.Header.TxRoot = *merkles[len(merkles)-1]
+	return types.NewBlock(block)
+}
+
+func Test_Reconstruct(t *testing.T) {
+	sb := testBlock(6)
+	msg, err := New(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The compact block goes through the wire encoding.
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &message.MsgCmpctBlock{}
+	if err := decoded.Decode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.ShortIDs) != 5 || len(decoded.PrefilledTxs) != 1 ||
+		decoded.PrefilledTxs[0].Index != 0 || len(decoded.Parents) != 1 {
+		t.Fatalf("decoded %d short ids, %d prefilled txs and %d parents",
+			len(decoded.ShortIDs), len(decoded.PrefilledTxs), len(decoded.Parents))
+	}
+
+	// The pool has all the transactions but the ones at index 2 and 4.
+	txs := sb.Transactions()
+	pool := []*types.TxDesc{{Tx: txs[1]}, {Tx: txs[3]}, {Tx: txs[5]}}
+	pb, err := NewPartialBlock(decoded, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := pb.Missing()
+	if len(missing) != 2 || missing[0] != 2 || missing[1] != 4 {
+		t.Fatalf("missing transactions %v, want [2 4]", missing)
+	}
+	if _, err := pb.Block(); err == nil {
+		t.Fatal("got a block with missing transactions")
+	}
+
+	getMsg := message.NewMsgGetBlockTxn(pb.Hash(), missing)
+	buf.Reset()
+	if err := getMsg.Encode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatal(err)
+	}
+	decodedGet := &message.MsgGetBlockTxn{}
+	if err := decodedGet.Decode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatal(err)
+	}
+	txnMsg, err := BlockTxn(sb, decodedGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pb.Fill(txnMsg); err != nil {
+		t.Fatal(err)
+	}
+	block, err := pb.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.Hash().IsEqual(sb.Hash()) {
+		t.Fatalf("reconstructed block %v, want %v", block.Hash(), sb.Hash())
+	}
+
+	// An index out of the block is refused.
+	if _, err := BlockTxn(sb, message.NewMsgGetBlockTxn(sb.Hash(), []uint32{6})); err == nil {
+		t.Fatal("served a transaction out of the block")
+	}
+}
+
+func Test_TxRootMismatch(t *testing.T) {
+	sb := testBlock(3)
+	msg, err := New(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace a transaction of the pool by another one with the same short
+	// id, the reconstruction must not be taken for the block.
+	key := ShortIDKey(&msg.Header, msg.Nonce)
+	other := types.NewTransaction()
+	other.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{0xff}, 0), nil))
+	other.AddTxOut(types.NewTxOutput(1, []byte{0x51}))
+	otherTx := types.NewTx(other)
+	msg.ShortIDs[1] = ShortID(key, otherTx.Hash())
+
+	txs := sb.Transactions()
+	pb, err := NewPartialBlock(msg, []*types.TxDesc{{Tx: txs[1]}, {Tx: otherTx}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.Missing()) != 0 {
+		t.Fatalf("missing transactions %v", pb.Missing())
+	}
+	if _, err := pb.Block(); err != ErrTxRootMismatch {
+		t.Fatalf("got error %v, want %v", err, ErrTxRootMismatch)
+	}
+
+	// Duplicated short ids can't be reconstructed.
+	msg.ShortIDs[1] = msg.ShortIDs[0]
+	if _, err := NewPartialBlock(msg, nil); err != ErrShortIDCollision {
+		t.Fatalf("got error %v, want %v", err, ErrShortIDCollision)
+	}
+}
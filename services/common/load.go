@@ -10,6 +10,7 @@ import (
 	"github.com/Qitmeer/qitmeer/config"
 	"github.com/Qitmeer/qitmeer/core/address"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/p2p/addmgr"
 	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/mempool"
@@ -33,11 +34,14 @@ const (
 	defaultBlockMinSize           = 0
 	defaultBlockMaxSize           = 375000
 	defaultMaxRPCClients          = 10
+	defaultMaxRPCWebsockets       = 25
 	defaultMaxPeers               = 125
 	defaultMiningStateSync        = false
 	defaultMaxInboundPeersPerHost = 10 // The default max total of inbound peer for host
 	defaultTrickleInterval        = peer.TrickleTimeout
 	defaultCacheInvalidTx         = false
+	defaultDAGCacheSize           = 100000
+	minPruneTargetMiB             = 1024
 )
 const (
 	defaultSigCacheMaxSize = 100000
@@ -73,14 +77,17 @@ func LoadConfig() (*config.Config, []string, error) {
 		RPCKey:            defaultRPCKeyFile,
 		RPCCert:           defaultRPCCertFile,
 		RPCMaxClients:     defaultMaxRPCClients,
+		RPCMaxWebsockets:  defaultMaxRPCWebsockets,
 		Generate:          defaultGenerate,
 		MaxPeers:          defaultMaxPeers,
 		MinTxFee:          mempool.DefaultMinRelayTxFee,
+		MaxMempool:        mempool.DefaultMaxPoolSize,
 		BlockMinSize:      defaultBlockMinSize,
 		BlockMaxSize:      defaultBlockMaxSize,
 		SigCacheMaxSize:   defaultSigCacheMaxSize,
 		MiningStateSync:   defaultMiningStateSync,
 		DAGType:           defaultDAGType,
+		DAGCacheSize:      defaultDAGCacheSize,
 		Banning:           false,
 		MaxInbound:        defaultMaxInboundPeersPerHost,
 		TrickleInterval:   defaultTrickleInterval,
@@ -321,6 +328,26 @@ func LoadConfig() (*config.Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The current block file is never pruned, so the target must leave
+	// room for more than one block file.
+	if cfg.Prune != 0 && cfg.Prune < minPruneTargetMiB {
+		err := fmt.Errorf("%s: the --prune option must be at least %d MiB",
+			funcName, minPruneTargetMiB)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --addrindex do not mix.
+	if cfg.Prune != 0 && cfg.AddrIndex {
+		err := fmt.Errorf("%s: the --prune and --addrindex options may "+
+			"not be activated at the same time because the address "+
+			"index needs the old blocks", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	for _, strAddr := range cfg.MiningAddrs {
 		addr, err := address.DecodeAddress(strAddr)
@@ -373,6 +400,58 @@ func LoadConfig() (*config.Config, []string, error) {
 		}
 	}
 
+	// Validate the proxy addresses.
+	for _, proxy := range []string{cfg.Proxy, cfg.OnionProxy} {
+		if proxy == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(proxy); err != nil {
+			str := "%s: the proxy address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, proxy, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Tor stream isolation randomizes the credentials of the proxies.
+	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
+		str := "%s: the --torisolation option requires the --proxy or " +
+			"--onion option"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.TorIsolation && (cfg.ProxyUser != "" || cfg.ProxyPass != "" ||
+		cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
+		log.Warn("Tor isolation set, overriding the specified proxy credentials")
+	}
+
+	// Validate the networks to connect to.
+	for _, n := range cfg.OnlyNet {
+		switch n {
+		case addmgr.IPv4Net, addmgr.IPv6Net:
+		case addmgr.OnionNet:
+			if cfg.NoOnion || (cfg.Proxy == "" && cfg.OnionProxy == "") {
+				str := "%s: the onion network needs the --proxy or " +
+					"--onion option and can't be used with --noonion"
+				err := fmt.Errorf(str, funcName)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		default:
+			str := "%s: the onlynet value of '%s' is invalid, it must " +
+				"be one of %s, %s or %s"
+			err := fmt.Errorf(str, funcName, n, addmgr.IPv4Net,
+				addmgr.IPv6Net, addmgr.OnionNet)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -0,0 +1,258 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/services/cf"
+	"math"
+)
+
+const (
+	// cfIndexName is the human-readable name for the index.
+	cfIndexName = "committed filter index"
+)
+
+var (
+	// cfIndexKey is the key of the committed filter index and the db bucket
+	// used to house it.
+	cfIndexKey = []byte("cfbyhashidx")
+)
+
+// -----------------------------------------------------------------------------
+// The committed filter index consists of an entry for every block in the main
+// chain.  Each entry holds the regular BIP158 filter of the block along with
+// the filter header, which commits to the filter and to the filter header of
+// the block preceding it in the block order.
+//
+// The serialized format for the keys and values in the cf index bucket is:
+//
+//   <block hash> = <filter header><filter>
+//
+//   Field           Type              Size
+//   block hash      hash.Hash         32 bytes
+//   filter header   hash.Hash         32 bytes
+//   filter          []byte            variable
+// -----------------------------------------------------------------------------
+
+// dbPutCfIndexEntry uses an existing database transaction to store the filter
+// and the filter header of the block with the passed hash.
+func dbPutCfIndexEntry(dbTx database.Tx, blockHash *hash.Hash, header *hash.Hash, filter []byte) error {
+	serialized := make([]byte, hash.HashSize+len(filter))
+	copy(serialized, header[:])
+	copy(serialized[hash.HashSize:], filter)
+	return dbTx.Metadata().Bucket(cfIndexKey).Put(blockHash[:], serialized)
+}
+
+// dbFetchCfIndexEntry uses an existing database transaction to retrieve the
+// filter header and filter of the block with the passed hash.  When there is
+// no entry for the provided hash, nil will be returned for both the filter
+// and the error.
+func dbFetchCfIndexEntry(dbTx database.Tx, blockHash *hash.Hash) (*hash.Hash, []byte, error) {
+	serialized := dbTx.Metadata().Bucket(cfIndexKey).Get(blockHash[:])
+	if serialized == nil {
+		return nil, nil, nil
+	}
+	if len(serialized) < hash.HashSize {
+		return nil, nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt committed filter index "+
+				"entry for %s", blockHash),
+		}
+	}
+
+	var header hash.Hash
+	copy(header[:], serialized[:hash.HashSize])
+	filter := make([]byte, len(serialized)-hash.HashSize)
+	copy(filter, serialized[hash.HashSize:])
+	return &header, filter, nil
+}
+
+// CfIndex implements a committed filter (cf) by hash index.
+type CfIndex struct {
+	db database.DB
+}
+
+// Ensure the CfIndex type implements the Indexer interface.
+var _ Indexer = (*CfIndex)(nil)
+
+// Ensure the CfIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CfIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *CfIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the hash-based cf index. This is part of the Indexer
+// interface.
+func (idx *CfIndex) Init() error {
+	return nil // Nothing to do.
+}
+
+// Key returns the database key to use for the index as a byte slice. This is
+// part of the Indexer interface.
+func (idx *CfIndex) Key() []byte {
+	return cfIndexKey
+}
+
+// Name returns the human-readable name of the index. This is part of the
+// Indexer interface.
+func (idx *CfIndex) Name() string {
+	return cfIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to
+// be created for the first time. It creates the bucket for the filters and
+// their headers.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(cfIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer builds the regular filter of the
+// block from the scripts it creates and spends and chains its header to the
+// header of the current index tip.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	prevScripts := make([][]byte, 0, len(stxos))
+	for _, stxo := range stxos {
+		prevScripts = append(prevScripts, stxo.PkScript)
+	}
+	filter, err := cf.BuildBasicFilter(block.Block(), prevScripts)
+	if err != nil {
+		return err
+	}
+	filterBytes, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+
+	// The index tip has not been updated yet, so it is the block preceding
+	// the connected one in the block order.
+	var prevHeader hash.Hash
+	tipHash, tipOrder, err := dbFetchIndexerTip(dbTx, cfIndexKey)
+	if err != nil {
+		return err
+	}
+	if tipOrder != math.MaxUint32 {
+		header, _, err := dbFetchCfIndexEntry(dbTx, tipHash)
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return AssertError(fmt.Sprintf("missing committed filter "+
+				"of index tip %s", tipHash))
+		}
+		prevHeader = *header
+	}
+
+	header, err := cf.MakeHeaderForFilter(filter, &prevHeader)
+	if err != nil {
+		return err
+	}
+	return dbPutCfIndexEntry(dbTx, block.Hash(), &header, filterBytes)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the filter and the
+// filter header of the block.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	return dbTx.Metadata().Bucket(cfIndexKey).Delete(block.Hash()[:])
+}
+
+// FilterByBlockHash returns the serialized contents of a block's filter of
+// the passed type.  When there is no filter for the block, nil is returned
+// for both the filter and the error.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterByBlockHash(h *hash.Hash, filterType message.FilterType) ([]byte, error) {
+	if filterType != message.GCSFilterRegular {
+		return nil, fmt.Errorf("unsupported filter type %v", filterType)
+	}
+	var filter []byte
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		_, filter, err = dbFetchCfIndexEntry(dbTx, h)
+		return err
+	})
+	return filter, err
+}
+
+// FilterHeaderByBlockHash returns the filter header of a block's filter of the
+// passed type.  When there is no filter for the block, nil is returned for
+// both the header and the error.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHeaderByBlockHash(h *hash.Hash, filterType message.FilterType) (*hash.Hash, error) {
+	if filterType != message.GCSFilterRegular {
+		return nil, fmt.Errorf("unsupported filter type %v", filterType)
+	}
+	var header *hash.Hash
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		header, _, err = dbFetchCfIndexEntry(dbTx, h)
+		return err
+	})
+	return header, err
+}
+
+// FilterHashesByBlockHashes returns the hashes of the filters of the passed
+// type for the passed blocks.  A nil hash is returned for every block that has
+// no filter.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHashesByBlockHashes(blockHashes []*hash.Hash, filterType message.FilterType) ([]*hash.Hash, error) {
+	if filterType != message.GCSFilterRegular {
+		return nil, fmt.Errorf("unsupported filter type %v", filterType)
+	}
+	filterHashes := make([]*hash.Hash, len(blockHashes))
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for i, blockHash := range blockHashes {
+			_, filter, err := dbFetchCfIndexEntry(dbTx, blockHash)
+			if err != nil {
+				return err
+			}
+			if filter == nil {
+				continue
+			}
+			filterHash := hash.DoubleHashH(filter)
+			filterHashes[i] = &filterHash
+		}
+		return nil
+	})
+	return filterHashes, err
+}
+
+// NewCfIndex returns a new instance of an indexer that is used to create a
+// mapping of the hashes of all blocks in the blockchain to their respective
+// committed filters.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package. This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCfIndex(db database.DB) *CfIndex {
+	return &CfIndex{db: db}
+}
+
+// DropCfIndex drops the CF index from the provided database if it exists.
+func DropCfIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, cfIndexKey, cfIndexName, interrupt)
+}
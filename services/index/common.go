@@ -31,6 +31,12 @@ type NeedsInputser interface {
 	NeedsInputs() bool
 }
 
+// ChainSetter provides a generic interface for an indexer that needs the
+// chain it indexes, for example to look up the status of the connected blocks.
+type ChainSetter interface {
+	SetChain(chain *blockchain.BlockChain)
+}
+
 // Indexer provides a generic interface for an indexer that is managed by an
 // index manager such as the Manager type provided by this package.
 type Indexer interface {
@@ -83,6 +83,9 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		if err := indexer.Init(); err != nil {
 			return err
 		}
+		if idx, ok := indexer.(ChainSetter); ok {
+			idx.SetChain(chain)
+		}
 		if indexer.Name() == txIndexName {
 			indexer.(*TxIndex).chain = chain
 			if chain.CacheInvalidTx {
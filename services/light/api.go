@@ -0,0 +1,77 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package light
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/rpc"
+	"strconv"
+)
+
+// API returns the reduced RPC service of the light node.
+func (hc *HeaderChain) API() rpc.API {
+	return rpc.API{
+		NameSpace: rpc.DefaultServiceNameSpace,
+		Service:   NewPublicLightAPI(hc),
+		Public:    true,
+	}
+}
+
+type PublicLightAPI struct {
+	chain *HeaderChain
+}
+
+func NewPublicLightAPI(hc *HeaderChain) *PublicLightAPI {
+	return &PublicLightAPI{hc}
+}
+
+// Return the count of the blocks ordered on the main chain of the header DAG.
+func (api *PublicLightAPI) GetBlockCount() (interface{}, error) {
+	return api.chain.GraphState().GetMainOrder() + 1, nil
+}
+
+// GetBlockHeader implements the getblockheader command from the synced
+// headers.
+func (api *PublicLightAPI) GetBlockHeader(hash hash.Hash, verbose bool) (interface{}, error) {
+	blockHeader, id, err := api.chain.HeaderByHash(&hash)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Block not found")
+	}
+
+	// When the verbose flag isn't set, simply return the serialized block
+	// header as a hex-encoded string.
+	if !verbose {
+		var headerBuf bytes.Buffer
+		err := blockHeader.Serialize(&headerBuf)
+		if err != nil {
+			context := "Failed to serialize block header"
+			return nil, rpc.RpcInternalError(err.Error(), context)
+		}
+		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+	confirmations, layer := api.chain.Confirmations(id)
+	return json.GetBlockHeaderVerboseResult{
+		Hash:          hash.String(),
+		Confirmations: int64(confirmations),
+		Version:       int32(blockHeader.Version),
+		ParentRoot:    blockHeader.ParentRoot.String(),
+		TxRoot:        blockHeader.TxRoot.String(),
+		StateRoot:     blockHeader.StateRoot.String(),
+		Difficulty:    blockHeader.Difficulty,
+		Layer:         uint32(layer),
+		Time:          blockHeader.Timestamp.Unix(),
+		PowResult:     blockHeader.Pow.GetPowResult(),
+	}, nil
+}
+
+// Query whether a given block is on the main chain of the header DAG.
+func (api *PublicLightAPI) IsOnMainChain(h hash.Hash) (interface{}, error) {
+	_, id, err := api.chain.HeaderByHash(&h)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Block not found")
+	}
+	return strconv.FormatBool(api.chain.IsOnMainChain(id)), nil
+}
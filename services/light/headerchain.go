@@ -0,0 +1,380 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/params"
+	"math/big"
+	"sync"
+	"time"
+)
+
+var (
+	// headersBucketName is the name of the db bucket used to house the
+	// headers of the light node.
+	headersBucketName = []byte("lightheaders")
+
+	// ErrMissingParents indicates a header refers to parents which are not
+	// known yet, so the DAG has to be synced before it can be connected.
+	ErrMissingParents = errors.New("header parents are not known")
+)
+
+// headerNode is a block header known by the light node along with the
+// parents of its block and the accumulated work of its main chain.
+type headerNode struct {
+	header  types.BlockHeader
+	hash    hash.Hash
+	parents []*hash.Hash
+	ids     []uint
+	workSum *big.Int
+}
+
+// GetHash returns the block hash. This is part of the blockdag.IBlockData
+// interface.
+func (node *headerNode) GetHash() *hash.Hash {
+	return &node.hash
+}
+
+// GetParents returns the DAG ids of the parents. This is part of the
+// blockdag.IBlockData interface.
+func (node *headerNode) GetParents() []uint {
+	return node.ids
+}
+
+// GetTimestamp returns the block time. This is part of the
+// blockdag.IBlockData interface.
+func (node *headerNode) GetTimestamp() int64 {
+	return node.header.Timestamp.Unix()
+}
+
+// GetWeight returns the weight of the block. This is part of the
+// blockdag.IBlockData interface.
+func (node *headerNode) GetWeight() uint64 {
+	return uint64(node.workSum.BitLen())
+}
+
+// serialize returns the header followed by the parent hashes in the format
+// used to store them in the database.
+func (node *headerNode) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	err := node.header.Serialize(&buf)
+	if err != nil {
+		return nil, err
+	}
+	err = s.WriteVarInt(&buf, 0, uint64(len(node.parents)))
+	if err != nil {
+		return nil, err
+	}
+	for _, parent := range node.parents {
+		err = s.WriteElements(&buf, parent)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeHeaderNode decodes a header and its parents stored by serialize.
+func deserializeHeaderNode(serialized []byte) (*headerNode, error) {
+	r := bytes.NewReader(serialized)
+	node := &headerNode{}
+	err := node.header.Deserialize(r)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > types.MaxParentsPerBlock {
+		return nil, fmt.Errorf("stored header has too many parents (%d)", count)
+	}
+	node.parents = make([]*hash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var parent hash.Hash
+		err = s.ReadElements(r, &parent)
+		if err != nil {
+			return nil, err
+		}
+		node.parents = append(node.parents, &parent)
+	}
+	node.hash = node.header.BlockHash()
+	return node, nil
+}
+
+// HeaderChain keeps the block headers synced by a light node.  The headers
+// are connected to a BlockDAG so the node knows the same block order as the
+// full nodes without downloading any block body.
+type HeaderChain struct {
+	params     *params.Params
+	db         database.DB
+	timeSource blockchain.MedianTimeSource
+
+	// lock protects the fields below as well as the block dag, which calls
+	// back into getBlockId with its own lock held.
+	lock  sync.RWMutex
+	bd    *blockdag.BlockDAG
+	ids   map[hash.Hash]uint
+	nodes map[uint]*headerNode
+
+	subsidyCache *blockchain.SubsidyCache
+}
+
+// getBlockId returns the DAG id of the block with the passed hash.  The
+// caller must hold the chain lock.
+func (hc *HeaderChain) getBlockId(h *hash.Hash) uint {
+	id, ok := hc.ids[*h]
+	if !ok {
+		return blockdag.MaxId
+	}
+	return id
+}
+
+// calcWeight is the weight function of the block dag.
+func (hc *HeaderChain) calcWeight(blocks int64, blockhash *hash.Hash, state byte) int64 {
+	return hc.subsidyCache.CalcBlockSubsidy(blocks)
+}
+
+// connect adds the node to the block dag.  The parents of the node must be
+// known and the caller must hold the chain lock for writes.
+func (hc *HeaderChain) connect(node *headerNode) error {
+	node.ids = make([]uint, 0, len(node.parents))
+	for _, parent := range node.parents {
+		id, ok := hc.ids[*parent]
+		if !ok {
+			return ErrMissingParents
+		}
+		node.ids = append(node.ids, id)
+	}
+
+	node.workSum = pow.CalcWork(node.header.Difficulty, node.header.Pow.GetPowType())
+	if len(node.ids) > 0 {
+		mainParent := hc.bd.GetMainParent(hc.bd.GetIdSet(node.parents))
+		node.workSum.Add(node.workSum, hc.nodes[mainParent.GetID()].workSum)
+	}
+
+	id := hc.bd.GetBlockTotal()
+	hc.ids[node.hash] = id
+	_, ib := hc.bd.AddBlock(node)
+	if ib == nil {
+		delete(hc.ids, node.hash)
+		return fmt.Errorf("header %s does not form a legal DAG", node.hash)
+	}
+	hc.nodes[id] = node
+	return nil
+}
+
+// checkHeader performs the checks of a header which do not need the block
+// body, including the proof of work.  The caller must hold the chain lock.
+func (hc *HeaderChain) checkHeader(node *headerNode) error {
+	numPb := len(node.parents)
+	if numPb == 0 {
+		return fmt.Errorf("header %s does not have any parent", node.hash)
+	}
+	if numPb > types.MaxParentsPerBlock {
+		return fmt.Errorf("header %s has too many parents - got %d, max %d",
+			node.hash, numPb, types.MaxParentsPerBlock)
+	}
+	parentsSet := blockdag.NewHashSet()
+	parentsSet.AddList(node.parents)
+	if parentsSet.Size() != numPb {
+		return fmt.Errorf("header %s has duplicate parents", node.hash)
+	}
+
+	// The parents are only committed to by the parent root of the header.
+	paMerkles := merkle.BuildParentsMerkleTreeStore(node.parents)
+	paMerkleRoot := paMerkles[len(paMerkles)-1]
+	if !node.header.ParentRoot.IsEqual(paMerkleRoot) {
+		return fmt.Errorf("header %s parents merkle root is invalid - "+
+			"header indicates %v, but calculated value is %v", node.hash,
+			&node.header.ParentRoot, paMerkleRoot)
+	}
+
+	for _, parent := range node.parents {
+		if _, ok := hc.ids[*parent]; !ok {
+			return ErrMissingParents
+		}
+	}
+	mainParent := hc.bd.GetMainParent(hc.bd.GetIdSet(node.parents))
+	if mainParent == nil {
+		return ErrMissingParents
+	}
+	return blockchain.CheckBlockHeaderSanity(&node.header, hc.timeSource,
+		hc.params, mainParent.GetHeight()+1)
+}
+
+// ProcessHeader checks a header received from the network and connects it to
+// the DAG.  It returns whether the header was new.  ErrMissingParents is
+// returned when the parents of the header have not been synced yet.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) ProcessHeader(header *types.BlockHeader, parents []*hash.Hash) (bool, error) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	node := &headerNode{
+		header:  *header,
+		hash:    header.BlockHash(),
+		parents: parents,
+	}
+	if _, ok := hc.ids[node.hash]; ok {
+		return false, nil
+	}
+	if err := hc.checkHeader(node); err != nil {
+		return false, err
+	}
+	if err := hc.connect(node); err != nil {
+		return false, err
+	}
+
+	id := hc.ids[node.hash]
+	serialized, err := node.serialize()
+	if err != nil {
+		return false, err
+	}
+	err = hc.db.Update(func(dbTx database.Tx) error {
+		var key [4]byte
+		binary.BigEndian.PutUint32(key[:], uint32(id))
+		return dbTx.Metadata().Bucket(headersBucketName).Put(key[:], serialized)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// HaveHeader returns whether the header of the block with the passed hash is
+// known.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) HaveHeader(h *hash.Hash) bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	_, ok := hc.ids[*h]
+	return ok
+}
+
+// HeaderByHash returns the header of the block with the passed hash along
+// with its id in the DAG.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) HeaderByHash(h *hash.Hash) (*types.BlockHeader, uint, error) {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	id, ok := hc.ids[*h]
+	if !ok {
+		return nil, 0, fmt.Errorf("block %s is not known", h)
+	}
+	header := hc.nodes[id].header
+	return &header, id, nil
+}
+
+// GraphState returns the current graph state of the header DAG.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) GraphState() *blockdag.GraphState {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.bd.GetGraphState()
+}
+
+// MainLocator returns the main chain locator used to sync the DAG from the
+// passed sync point.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) MainLocator(point *hash.Hash) []*hash.Hash {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return blockdag.NewDAGSync(hc.bd).GetMainLocator(point)
+}
+
+// IsOnMainChain returns whether the block with the passed id is on the main
+// chain of the DAG.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) IsOnMainChain(id uint) bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.bd.IsOnMainChain(id)
+}
+
+// Confirmations returns the number of confirmations of the block with the
+// passed id along with its layer in the DAG.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) Confirmations(id uint) (uint, uint) {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	return hc.bd.GetConfirmations(id), hc.bd.GetLayer(id)
+}
+
+// load replays the headers stored in the database into the DAG.
+func (hc *HeaderChain) load() error {
+	return hc.db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(headersBucketName)
+		if err != nil {
+			return err
+		}
+		var key [4]byte
+		for id := uint32(1); ; id++ {
+			binary.BigEndian.PutUint32(key[:], id)
+			serialized := bucket.Get(key[:])
+			if serialized == nil {
+				break
+			}
+			node, err := deserializeHeaderNode(serialized)
+			if err != nil {
+				return err
+			}
+			if err := hc.connect(node); err != nil {
+				return fmt.Errorf("unable to load header %s: %v", node.hash, err)
+			}
+		}
+		return nil
+	})
+}
+
+// NewHeaderChain returns a header chain which starts at the genesis block of
+// the passed network and contains every header stored in the database.
+func NewHeaderChain(db database.DB, par *params.Params, dagType string, timeSource blockchain.MedianTimeSource) (*HeaderChain, error) {
+	hc := &HeaderChain{
+		params:       par,
+		db:           db,
+		timeSource:   timeSource,
+		bd:           &blockdag.BlockDAG{},
+		ids:          make(map[hash.Hash]uint),
+		nodes:        make(map[uint]*headerNode),
+		subsidyCache: blockchain.NewSubsidyCache(0, par),
+	}
+	hc.bd.Init(dagType, hc.calcWeight,
+		1.0/float64(par.TargetTimePerBlock/time.Second), hc.getBlockId, nil, 0)
+
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	genesis := &headerNode{
+		header: par.GenesisBlock.Header,
+		hash:   par.GenesisBlock.BlockHash(),
+	}
+	if err := hc.connect(genesis); err != nil {
+		return nil, err
+	}
+	if err := hc.load(); err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Loaded %d block headers", hc.bd.GetBlockTotal()))
+	return hc, nil
+}
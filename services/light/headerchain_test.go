@@ -0,0 +1,89 @@
+package light
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"github.com/Qitmeer/qitmeer/params"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_HeaderChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lightheaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	par := &params.PrivNetParams
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), par.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hc, err := NewHeaderChain(db, par, "phantom", blockchain.NewMedianTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hc.HaveHeader(par.GenesisHash) {
+		t.Fatal("the header chain does not start at the genesis block")
+	}
+	if hc.GraphState().GetTotal() != 1 {
+		t.Fatalf("got %d headers, want 1", hc.GraphState().GetTotal())
+	}
+
+	newHeader := func(parents []*hash.Hash) *types.BlockHeader {
+		header := par.GenesisBlock.Header
+		paMerkles := merkle.BuildParentsMerkleTreeStore(parents)
+		header.ParentRoot = *paMerkles[len(paMerkles)-1]
+		header.Timestamp = time.Unix(par.GenesisBlock.Header.Timestamp.Unix()+1, 0)
+		return &header
+	}
+
+	// Headers of blocks following unknown blocks can not be connected.
+	unknown := hash.Hash{1}
+	_, err = hc.ProcessHeader(newHeader([]*hash.Hash{&unknown}), []*hash.Hash{&unknown})
+	if err != ErrMissingParents {
+		t.Fatalf("got error %v, want %v", err, ErrMissingParents)
+	}
+
+	// The parents must match the parent root of the header.
+	header := newHeader([]*hash.Hash{par.GenesisHash})
+	_, err = hc.ProcessHeader(header, []*hash.Hash{par.GenesisHash, &unknown})
+	if err == nil || err == ErrMissingParents {
+		t.Fatalf("header with wrong parents was accepted: %v", err)
+	}
+
+	// A header needs parents.
+	_, err = hc.ProcessHeader(header, nil)
+	if err == nil {
+		t.Fatal("header without parents was accepted")
+	}
+
+	// The stored form of a header keeps its parents.
+	node := &headerNode{
+		header:  *header,
+		hash:    header.BlockHash(),
+		parents: []*hash.Hash{par.GenesisHash, &unknown},
+	}
+	serialized, err := node.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := deserializeHeaderNode(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.hash.IsEqual(&node.hash) || len(loaded.parents) != 2 ||
+		!loaded.parents[1].IsEqual(&unknown) {
+		t.Fatal("deserialized header differs")
+	}
+}
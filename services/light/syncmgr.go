@@ -0,0 +1,483 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/p2p/addmgr"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/version"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultTargetOutbound is the default number of full nodes to sync
+	// the headers from.
+	defaultTargetOutbound = 8
+
+	// connectionRetryInterval is the base amount of time to wait in between
+	// retries when connecting to persistent peers.
+	connectionRetryInterval = time.Second * 5
+
+	// connectTimeout is the timeout of dialing a peer.
+	connectTimeout = time.Second * 30
+
+	// syncRetryInterval is the interval at which the sync with the sync
+	// peer is resumed when it did not make any progress.
+	syncRetryInterval = time.Minute
+)
+
+// newPeerMsg signifies a newly connected peer to the sync handler.
+type newPeerMsg struct {
+	peer *peer.Peer
+}
+
+// donePeerMsg signifies a disconnected peer to the sync handler.
+type donePeerMsg struct {
+	peer *peer.Peer
+}
+
+// invMsg packages an inv message and the peer it came from.
+type invMsg struct {
+	inv  *message.MsgInv
+	peer *peer.Peer
+}
+
+// headersMsg packages a headers message and the peer it came from.
+type headersMsg struct {
+	headers *message.MsgHeaders
+	peer    *peer.Peer
+}
+
+// SyncManager connects to full nodes and keeps the header chain in sync with
+// them.  The DAG is synced the same way full nodes sync blocks: the sync peer
+// announces the blocks missing from the main chain locator with an inv, whose
+// headers, including the parents of every block, are then requested with a
+// getheaders message.
+type SyncManager struct {
+	started  int32
+	shutdown int32
+
+	cfg        *config.Config
+	params     *params.Params
+	chain      *HeaderChain
+	timeSource blockchain.MedianTimeSource
+
+	addrManager *addmgr.AddrManager
+	connManager *connmgr.ConnManager
+	dialer      *connmgr.Dialer
+
+	// The following fields are only used by the sync handler.
+	peers    map[*peer.Peer]struct{}
+	syncPeer *peer.Peer
+
+	msgChan chan interface{}
+	wg      sync.WaitGroup
+	quit    chan struct{}
+}
+
+// Start begins connecting to full nodes and syncing the headers.
+func (sm *SyncManager) Start() {
+	// Already started?
+	if atomic.AddInt32(&sm.started, 1) != 1 {
+		return
+	}
+
+	log.Info("Starting light node header sync")
+	sm.addrManager.Start()
+	if !sm.cfg.DisableDNSSeed {
+		if lookup := sm.dialer.LookupFunc(); lookup != nil {
+			connmgr.SeedFromDNS(sm.params, protocol.Full, lookup, func(addrs []*types.NetAddress) {
+				sm.addrManager.AddAddresses(addrs, addrs[0])
+			})
+		} else {
+			connmgr.SeedFromProxy(sm.params, func(addr net.Addr) {
+				go sm.connManager.Connect(&connmgr.ConnReq{Addr: addr})
+			})
+		}
+	}
+
+	permanentPeers := sm.cfg.ConnectPeers
+	if len(permanentPeers) == 0 {
+		permanentPeers = sm.cfg.AddPeers
+	}
+	for _, addr := range permanentPeers {
+		tcpAddr, err := sm.dialer.ResolveAddr(addr)
+		if err != nil {
+			log.Warn("Can't resolve peer address", "addr", addr, "error", err)
+			continue
+		}
+		go sm.connManager.Connect(&connmgr.ConnReq{
+			Addr:      tcpAddr,
+			Permanent: true,
+		})
+	}
+	go sm.connManager.Start()
+
+	sm.wg.Add(1)
+	go sm.syncHandler()
+}
+
+// Stop disconnects from all peers and stops syncing the headers.
+func (sm *SyncManager) Stop() error {
+	if atomic.AddInt32(&sm.shutdown, 1) != 1 {
+		log.Warn("Light node header sync is already in the process of shutting down")
+		return nil
+	}
+
+	log.Info("Stopping light node header sync")
+	close(sm.quit)
+	sm.wg.Wait()
+	sm.connManager.Stop()
+	return sm.addrManager.Stop()
+}
+
+// syncHandler is the main handler of the sync manager.  It must be run as a
+// goroutine.
+func (sm *SyncManager) syncHandler() {
+	ticker := time.NewTicker(syncRetryInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case m := <-sm.msgChan:
+			switch msg := m.(type) {
+			case newPeerMsg:
+				sm.handleNewPeer(msg.peer)
+
+			case donePeerMsg:
+				sm.handleDonePeer(msg.peer)
+
+			case invMsg:
+				sm.handleInv(msg.inv, msg.peer)
+
+			case headersMsg:
+				sm.handleHeaders(msg.headers, msg.peer)
+
+			default:
+				log.Warn(fmt.Sprintf("Invalid message type in sync handler: %T", msg))
+			}
+
+		case <-ticker.C:
+			if sm.syncPeer != nil {
+				sm.requestSync(sm.syncPeer)
+			} else {
+				sm.startSync()
+			}
+
+		case <-sm.quit:
+			for p := range sm.peers {
+				p.Disconnect()
+			}
+			break out
+		}
+	}
+	sm.wg.Done()
+	log.Trace("Light sync handler done")
+}
+
+// queue passes a message to the sync handler unless the sync manager is
+// shutting down.
+func (sm *SyncManager) queue(msg interface{}) {
+	select {
+	case sm.msgChan <- msg:
+	case <-sm.quit:
+	}
+}
+
+// isBehind returns whether the passed peer knows a better DAG than the header
+// chain.
+func (sm *SyncManager) isBehind(p *peer.Peer) bool {
+	return p.LastGS().IsExcellent(sm.chain.GraphState())
+}
+
+// startSync chooses the best peer to sync the headers from among the peers
+// which know a better DAG.
+func (sm *SyncManager) startSync() {
+	var best *peer.Peer
+	for p := range sm.peers {
+		if !sm.isBehind(p) {
+			continue
+		}
+		if best == nil || p.LastGS().IsExcellent(best.LastGS()) {
+			best = p
+		}
+	}
+	if best == nil {
+		return
+	}
+	log.Info(fmt.Sprintf("Syncing headers to %s from peer %s",
+		best.LastGS().String(), best.Addr()))
+	sm.syncPeer = best
+	best.PrevGet.Clean()
+	sm.requestSync(best)
+}
+
+// requestSync asks the peer for the blocks which follow the main chain of the
+// header chain.
+func (sm *SyncManager) requestSync(p *peer.Peer) {
+	if !sm.isBehind(p) {
+		return
+	}
+	p.PushSyncDAGMsg(sm.chain.GraphState(), sm.chain.MainLocator(p.PrevGet.Point))
+}
+
+// handleNewPeer starts syncing from the new peer when no sync is in progress.
+func (sm *SyncManager) handleNewPeer(p *peer.Peer) {
+	log.Info(fmt.Sprintf("New full node peer: %s, user-agent:%s", p, p.UserAgent()))
+	sm.peers[p] = struct{}{}
+	if sm.syncPeer == nil {
+		sm.startSync()
+	}
+}
+
+// handleDonePeer removes the peer and switches to another sync peer if
+// needed.
+func (sm *SyncManager) handleDonePeer(p *peer.Peer) {
+	if _, ok := sm.peers[p]; !ok {
+		return
+	}
+	delete(sm.peers, p)
+	log.Info(fmt.Sprintf("Lost peer %s", p))
+	if sm.syncPeer == p {
+		sm.syncPeer = nil
+		sm.startSync()
+	}
+}
+
+// handleInv requests the headers of the announced blocks which are not known
+// yet.
+func (sm *SyncManager) handleInv(msg *message.MsgInv, p *peer.Peer) {
+	if msg.GS != nil {
+		p.UpdateLastGS(msg.GS)
+	}
+	blocks := make([]*hash.Hash, 0, len(msg.InvList))
+	for _, iv := range msg.InvList {
+		if iv.Type != message.InvTypeBlock {
+			continue
+		}
+		p.AddKnownInventory(iv)
+		if sm.chain.HaveHeader(&iv.Hash) {
+			continue
+		}
+		h := iv.Hash
+		blocks = append(blocks, &h)
+	}
+	if len(blocks) > 0 {
+		p.PushGetHeadersMsg(sm.chain.GraphState(), blocks)
+	}
+	if sm.syncPeer == nil {
+		sm.startSync()
+	}
+}
+
+// handleHeaders connects the received headers to the header chain and keeps
+// syncing when the peer still knows a better DAG.
+func (sm *SyncManager) handleHeaders(msg *message.MsgHeaders, p *peer.Peer) {
+	p.UpdateLastGS(msg.GS)
+
+	var added int
+	for i, header := range msg.Headers {
+		var parents []*hash.Hash
+		if i < len(msg.Parents) {
+			parents = msg.Parents[i]
+		}
+		isNew, err := sm.chain.ProcessHeader(header, parents)
+		if err == ErrMissingParents {
+			// The block follows blocks which have not been synced
+			// yet, so sync the DAG from this peer.
+			if sm.syncPeer == nil {
+				sm.syncPeer = p
+			}
+			break
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf("Rejected header %s from %s: %v",
+				header.BlockHash(), p, err))
+			p.Disconnect()
+			return
+		}
+		if isNew {
+			added++
+		}
+	}
+	if added > 0 {
+		gs := sm.chain.GraphState()
+		log.Info(fmt.Sprintf("Processed %d block headers, graph state %s",
+			added, gs.String()))
+		p.PrevGet.UpdatePoint(gs.GetMainChainTip())
+	}
+
+	if sm.syncPeer != p {
+		return
+	}
+	if sm.isBehind(p) {
+		sm.requestSync(p)
+		return
+	}
+	log.Info(fmt.Sprintf("Headers are synced with peer %s", p.Addr()))
+	sm.syncPeer = nil
+}
+
+// onVersion only accepts full nodes which send the parents of the headers.
+func (sm *SyncManager) onVersion(p *peer.Peer, msg *message.MsgVersion) *message.MsgReject {
+	if !protocol.HasServices(msg.Services, protocol.Full) {
+		reason := fmt.Sprintf("required services %#x not offered",
+			uint64(protocol.Full))
+		return message.NewMsgReject(msg.Command(), message.RejectNonstandard, reason)
+	}
+	if uint32(msg.ProtocolVersion) < protocol.HeaderParentsVersion {
+		reason := fmt.Sprintf("protocol version must be %d or greater",
+			protocol.HeaderParentsVersion)
+		return message.NewMsgReject(msg.Command(), message.RejectObsolete, reason)
+	}
+	if msg.LastGS.IsGenesis() && !msg.LastGS.GetTips().HasOnly(sm.params.GenesisHash) {
+		return message.NewMsgReject(msg.Command(), message.RejectNonstandard, "wrong genesis")
+	}
+
+	if !sm.cfg.PrivNet {
+		if sm.addrManager.NeedMoreAddresses() {
+			p.QueueMessage(message.NewMsgGetAddr(), nil)
+		}
+		sm.addrManager.Good(p.NA())
+	}
+	sm.timeSource.AddTimeSample(p.Addr(), msg.Timestamp)
+	p.UpdateLastGS(msg.LastGS)
+
+	sm.queue(newPeerMsg{peer: p})
+	return nil
+}
+
+// onAddr adds the addresses advertised by the peer to the address manager.
+func (sm *SyncManager) onAddr(p *peer.Peer, msg *message.MsgAddr) {
+	if sm.cfg.PrivNet || len(msg.AddrList) == 0 {
+		return
+	}
+	sm.addrManager.AddAddresses(msg.AddrList, p.NA())
+}
+
+// newPeerConfig returns the configuration of the peers of the sync manager.
+func (sm *SyncManager) newPeerConfig() *peer.Config {
+	return &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVersion: sm.onVersion,
+			OnAddr:    sm.onAddr,
+			OnInv: func(p *peer.Peer, msg *message.MsgInv) {
+				sm.queue(invMsg{inv: msg, peer: p})
+			},
+			OnHeaders: func(p *peer.Peer, msg *message.MsgHeaders) {
+				sm.queue(headersMsg{headers: msg, peer: p})
+			},
+			OnGraphState: func(p *peer.Peer, msg *message.MsgGraphState) {
+				p.UpdateLastGS(msg.GS)
+			},
+			OnSyncResult: func(p *peer.Peer, msg *message.MsgSyncResult) {
+				p.UpdateLastGS(msg.GS)
+			},
+			OnSyncPoint: func(p *peer.Peer, msg *message.MsgSyncPoint) {
+				p.UpdateLastGS(msg.GS)
+				if sm.chain.HaveHeader(msg.SyncPoint) {
+					p.PrevGet.UpdatePoint(msg.SyncPoint)
+				}
+			},
+		},
+		NewestGS: func() (*blockdag.GraphState, error) {
+			return sm.chain.GraphState(), nil
+		},
+		UserAgentName:    "qitmeer-light",
+		UserAgentVersion: fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch),
+		ChainParams:      sm.params,
+		Services:         protocol.Light,
+		DisableRelayTx:   true,
+		ProtocolVersion:  peer.MaxProtocolVersion,
+		TrickleInterval:  sm.cfg.TrickleInterval,
+		HostToNetAddress: sm.addrManager.HostToNetAddress,
+	}
+}
+
+// outboundPeerConnected is invoked by the connection manager when a new
+// outbound connection is established.
+func (sm *SyncManager) outboundPeerConnected(c *connmgr.ConnReq) {
+	p, err := peer.NewOutboundPeer(sm.newPeerConfig(), c.Addr.String())
+	if err != nil {
+		log.Debug(fmt.Sprintf("Cannot create outbound peer %s: %v", c.Addr, err))
+		sm.connManager.Disconnect(c.ID())
+		return
+	}
+	p.AssociateConnection(c)
+	sm.addrManager.Attempt(p.NA())
+	go func() {
+		p.WaitForDisconnect()
+		sm.connManager.Disconnect(c.ID())
+		sm.queue(donePeerMsg{peer: p})
+	}()
+}
+
+// NewSyncManager returns a sync manager which keeps the passed header chain
+// in sync with the full nodes of the network.
+func NewSyncManager(cfg *config.Config, par *params.Params, chain *HeaderChain, timeSource blockchain.MedianTimeSource) (*SyncManager, error) {
+	dialer := connmgr.NewDialer(cfg, connectTimeout)
+	sm := SyncManager{
+		cfg:         cfg,
+		params:      par,
+		chain:       chain,
+		timeSource:  timeSource,
+		addrManager: addmgr.New(cfg.DataDir, cfg.GetAddrPercent, dialer.LookupFunc()),
+		dialer:      dialer,
+		peers:       make(map[*peer.Peer]struct{}),
+		msgChan:     make(chan interface{}, cfg.MaxPeers*3),
+		quit:        make(chan struct{}),
+	}
+
+	// Only connect to the specified peers in connect-only mode.
+	var newAddressFunc func() (net.Addr, error)
+	if !cfg.PrivNet && len(cfg.ConnectPeers) == 0 {
+		newAddressFunc = func() (net.Addr, error) {
+			addr := sm.addrManager.GetAddress()
+			if addr == nil {
+				return nil, errors.New("no valid connect address")
+			}
+			if !protocol.HasServices(addr.NetAddress().Services, protocol.Full) ||
+				!sm.dialer.IsReachable(addr.NetAddress()) {
+				return nil, errors.New("no valid connect address")
+			}
+			if addr.GetAttempts() > 1 && time.Since(addr.LastAttempt()) < 10*time.Minute {
+				return nil, errors.New("no valid connect address")
+			}
+			return sm.dialer.ResolveAddr(addmgr.NetAddressKey(addr.NetAddress()))
+		}
+	}
+
+	targetOutbound := defaultTargetOutbound
+	if cfg.MaxPeers < targetOutbound {
+		targetOutbound = cfg.MaxPeers
+	}
+	cmgr, err := connmgr.New(&connmgr.Config{
+		RetryDuration:  connectionRetryInterval,
+		TargetOutbound: uint32(targetOutbound),
+		Dial:           sm.dialer.Dial,
+		OnConnection:   sm.outboundPeerConnected,
+		GetNewAddress:  newAddressFunc,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sm.connManager = cmgr
+	return &sm, nil
+}
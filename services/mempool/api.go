@@ -1,6 +1,7 @@
 package mempool
 
 import (
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/rpc"
 	"sort"
@@ -35,3 +36,50 @@ func (api *PublicMempoolAPI) GetMempool(txType *string, verbose bool) (interface
 	sort.Strings(hashStrings)
 	return hashStrings, nil
 }
+
+// GetMempoolInfo returns the size of the mempool, its limit and the fee rate a
+// transaction must currently pay to be accepted.
+func (api *PublicMempoolAPI) GetMempoolInfo() (interface{}, error) {
+	count, size := api.txPool.Size()
+	return json.GetMempoolInfoResult{
+		Size:          int64(count),
+		Bytes:         size,
+		MaxMempool:    api.txPool.cfg.Policy.MaxPoolSize,
+		MempoolMinFee: int64(api.txPool.MinRelayTxFee()),
+		MinRelayTxFee: int64(api.txPool.cfg.Policy.MinRelayTxFee),
+	}, nil
+}
+
+// SaveMempool writes the transactions of the mempool to the mempool file of
+// the data directory, and returns the number of transactions written.
+func (api *PublicMempoolAPI) SaveMempool() (interface{}, error) {
+	path := api.txPool.cfg.PersistFile
+	if path == "" {
+		return nil, rpc.RpcInternalError("No mempool file", "Configuration")
+	}
+	count, err := api.txPool.Save(path)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Unable to save mempool")
+	}
+	return count, nil
+}
+
+// EstimateFee returns the estimated fee per kilobyte in atoms a transaction
+// needs to pay to be confirmed within the passed number of DAG orders.  The
+// estimate is never below the minimum relay fee.
+func (api *PublicMempoolAPI) EstimateFee(targetConfirmations uint32) (interface{}, error) {
+	feeEstimator := api.txPool.cfg.FeeEstimator
+	if feeEstimator == nil {
+		return nil, rpc.RpcInternalError("Fee estimation disabled",
+			"Configuration")
+	}
+	feeRate, err := feeEstimator.EstimateFee(targetConfirmations)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	minRelayTxFee := int64(api.txPool.cfg.Policy.MinRelayTxFee)
+	if feeRate < minRelayTxFee {
+		feeRate = minRelayTxFee
+	}
+	return feeRate, nil
+}
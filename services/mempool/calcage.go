@@ -33,7 +33,8 @@ func calcInputValueAge(tx *types.Transaction, utxoView *blockchain.UtxoViewpoint
 		// Don't attempt to accumulate the total input age if the
 		// referenced transaction output doesn't exist.
 		txEntry := utxoView.LookupEntry(txIn.PreviousOut)
-		if txEntry != nil && !txEntry.IsSpent() {
+		// Asset inputs do not contribute any native coin value.
+		if txEntry != nil && !txEntry.IsSpent() && txEntry.Asset().IsMeer() {
 			// Inputs with dependencies currently in the mempool
 			// have their block height set to a special constant.
 			// Their input age should be computed as zero since
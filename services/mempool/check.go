@@ -36,12 +36,20 @@ func checkTransactionStandard(tx *types.Tx, height uint64,
 			"required data -- type %v", serType)
 		return txRuleError(message.RejectNonstandard, str)
 	}
-	if msgTx.Version > uint32(maxTxVersion) || msgTx.Version < 1 {
+	txVersion := msgTx.Version & types.TxVersionMask
+	if txVersion > uint32(maxTxVersion) || txVersion < 1 {
 		str := fmt.Sprintf("transaction version %d is not in the "+
-			"valid range of %d-%d", msgTx.Version, 1, maxTxVersion)
+			"valid range of %d-%d", txVersion, 1, maxTxVersion)
 		return txRuleError(message.RejectNonstandard, str)
 	}
 
+	// The transaction type must be known and its asset outputs must
+	// conform to the asset policy.
+	err := checkAssetStandard(msgTx)
+	if err != nil {
+		return err
+	}
+
 	// The transaction must be finalized to be standard and therefore
 	// considered for inclusion in a block.
 	// TODO fix type conversion
@@ -88,6 +96,12 @@ func checkTransactionStandard(tx *types.Tx, height uint64,
 	// be "dust" (except when the script is a null data script).
 	numNullDataOutputs := 0
 	for i, txOut := range msgTx.TxOut {
+		// The payload output of a contract transaction is checked by
+		// the consensus rules.
+		if i == 0 && msgTx.IsContractTx() {
+			continue
+		}
+
 		//TODO the tx version
 		scriptClass := txscript.GetScriptClass(txscript.DefaultScriptVersion, txOut.PkScript)
 		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
@@ -106,10 +120,11 @@ func checkTransactionStandard(tx *types.Tx, height uint64,
 		// Accumulate the number of outputs which only carry data.  For
 		// all other script types, ensure the output value is not
 		// "dust".
-		// TODO DUST decision (may careful about reject Dust for token base tx)
+		// Asset amounts are not denominated in the native coin, so
+		// outputs carrying an asset are never considered dust.
 		if scriptClass == txscript.NullDataTy {
 			numNullDataOutputs++
-		} else if isDust(txOut, minRelayTxFee) {
+		} else if txOut.Asset.IsMeer() && isDust(txOut, minRelayTxFee) {
 			str := fmt.Sprintf("transaction output %d: payment "+
 				"of %d is dust", i, txOut.Amount)
 			return txRuleError(message.RejectDust, str)
@@ -270,19 +285,27 @@ func isDust(txOut *types.TxOutput, minRelayTxFee types.Amount) bool {
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// Note it does not check for double spends against transactions already in the
-// main chain.
+// The double spend is allowed when every transaction it conflicts with signals
+// replacement, in which case the passed transaction is a replacement candidate
+// which must still be validated with validateReplacement.  Note it does not
+// check for double spends against transactions already in the main chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
-func (mp *TxPool) checkPoolDoubleSpend(tx *types.Tx) error {
+func (mp *TxPool) checkPoolDoubleSpend(tx *types.Tx) (bool, error) {
+	var isReplacement bool
 	for _, txIn := range tx.Transaction().TxIn {
-		if txR, exists := mp.outpoints[txIn.PreviousOut]; exists {
+		txR, exists := mp.outpoints[txIn.PreviousOut]
+		if !exists {
+			continue
+		}
+		if mp.cfg.Policy.RejectReplacement || !mp.signalsReplacement(txR, nil) {
 			str := fmt.Sprintf("transaction %v in the pool "+
 				"already spends the same coins", txR.Hash())
-			return txRuleError(message.RejectDuplicate, str)
+			return false, txRuleError(message.RejectDuplicate, str)
 		}
+		isReplacement = true
 	}
-	return nil
+	return isReplacement, nil
 }
 
 // checkInputsStandard performs a series of checks on a transaction's inputs
@@ -79,4 +79,12 @@ type Config struct {
 
 	// block chain
 	BC *blockchain.BlockChain
+
+	// FeeEstimator provides a feeEstimator.  If it is not nil, the mempool
+	// records all new transactions it observes into the feeEstimator.
+	FeeEstimator *FeeEstimator
+
+	// PersistFile is the file the mempool is saved to by the savemempool
+	// RPC.
+	PersistFile string
 }
@@ -0,0 +1,456 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	// estimateFeeDepth is the maximum number of DAG orders before a
+	// transaction is confirmed that we want to track.
+	estimateFeeDepth = 25
+
+	// estimateFeeBinSize is the number of transactions stored in each bin.
+	estimateFeeBinSize = 100
+
+	// estimateFeeMaxReplacements is the max number of replacements that
+	// can be made by the transactions found in a given block.
+	estimateFeeMaxReplacements = 10
+
+	// estimateFeeSaveVersion is the version of the serialized state of
+	// the fee estimator.
+	estimateFeeSaveVersion = 1
+
+	// DefaultEstimateFeeMaxRollback is the default number of rollbacks
+	// allowed by the fee estimator for blocks disconnected from the DAG.
+	DefaultEstimateFeeMaxRollback = 10
+
+	// DefaultEstimateFeeMinRegisteredBlocks is the default minimum
+	// number of blocks which must be observed by the fee estimator before
+	// it will provide fee estimations.
+	DefaultEstimateFeeMinRegisteredBlocks = 3
+
+	// unminedOrder is the order used for the transactions which have not
+	// been mined yet, and for the last known order before the fee
+	// estimator has registered any block.
+	unminedOrder = math.MaxUint64
+)
+
+// observedTransaction represents an observed transaction and some
+// additional data required for the fee estimation algorithm.
+type observedTransaction struct {
+	// A transaction hash.
+	hash hash.Hash
+
+	// The fee per kilobyte of the transaction in atoms.
+	feeRate int64
+
+	// The order of the first block the transaction could have been
+	// confirmed in when it was observed.
+	observed uint64
+
+	// The order of the block in which it was mined.  If the transaction
+	// has not yet been mined, it is unminedOrder.
+	mined uint64
+}
+
+// confirmBin returns the bin of the transaction, that is the number of DAG
+// orders it took to confirm the transaction after the first one it could have
+// been confirmed in.
+func (o *observedTransaction) confirmBin() int {
+	if o.mined <= o.observed {
+		return 0
+	}
+	return int(o.mined - o.observed)
+}
+
+// registeredBlock has the hash of a block and the transactions it put into
+// and dropped from the bins, so that it can be rolled back when the block is
+// disconnected from the DAG.
+type registeredBlock struct {
+	hash    hash.Hash
+	mined   []*observedTransaction
+	dropped []*observedTransaction
+}
+
+// FeeEstimator manages the data necessary to create fee estimations.  It is
+// safe for concurrent access.
+//
+// The transactions accepted to the mempool are observed along with their fee
+// rate, and they are put into bins by the number of DAG orders they took to be
+// confirmed once a block including them is connected.  The estimated fee rate
+// to be confirmed within a number of orders is the median fee rate of the
+// transactions which were confirmed that fast.
+type FeeEstimator struct {
+	maxRollback         uint32
+	minRegisteredBlocks uint32
+
+	// The last known order of the DAG.
+	lastKnownOrder uint64
+
+	// The number of blocks that have been registered.
+	numBlocksRegistered uint32
+
+	mtx      sync.Mutex
+	observed map[hash.Hash]*observedTransaction
+	bin      [estimateFeeDepth][]*observedTransaction
+
+	// The cached estimates.
+	cached []int64
+
+	// Transactions that have been removed from the bins, and added by the
+	// most recently registered blocks.  This allows blocks to be rolled
+	// back when they are disconnected.
+	registered []*registeredBlock
+}
+
+// NewFeeEstimator creates a FeeEstimator for which at most maxRollback blocks
+// can be unregistered and which returns an error unless minRegisteredBlocks
+// have been registered with it.
+func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
+	return &FeeEstimator{
+		maxRollback:         maxRollback,
+		minRegisteredBlocks: minRegisteredBlocks,
+		lastKnownOrder:      unminedOrder,
+		observed:            make(map[hash.Hash]*observedTransaction),
+	}
+}
+
+// ObserveTransaction is called when a new transaction is observed in the
+// mempool.
+func (ef *FeeEstimator) ObserveTransaction(t *types.TxDesc) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// If we haven't seen a block yet we don't know when this one arrived,
+	// so we ignore it.
+	if ef.lastKnownOrder == unminedOrder {
+		return
+	}
+
+	txHash := *t.Tx.Hash()
+	if _, ok := ef.observed[txHash]; !ok {
+		ef.observed[txHash] = &observedTransaction{
+			hash:     txHash,
+			feeRate:  t.FeePerKB,
+			observed: ef.lastKnownOrder + 1,
+			mined:    unminedOrder,
+		}
+	}
+}
+
+// RemoveTransaction is called when a transaction observed in the mempool is
+// removed from it without being mined, such as when it is replaced or
+// evicted, so it is no longer waiting to be mined.
+func (ef *FeeEstimator) RemoveTransaction(txHash *hash.Hash) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	if o, ok := ef.observed[*txHash]; ok && o.mined == unminedOrder {
+		delete(ef.observed, *txHash)
+	}
+}
+
+// RegisterBlock informs the fee estimator of a new block to take into account.
+func (ef *FeeEstimator) RegisterBlock(block *types.SerializedBlock) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// The previous estimates are invalid, so delete them.
+	ef.cached = nil
+
+	// The orders of the blocks connected by a reorganization of the DAG
+	// may be lower than the last known one.
+	order := block.Order()
+	if ef.lastKnownOrder == unminedOrder || order > ef.lastKnownOrder {
+		ef.lastKnownOrder = order
+	}
+	ef.numBlocksRegistered++
+
+	// Count the number of replacements we make per bin so that we don't
+	// replace too many.
+	var replacementCounts [estimateFeeDepth]int
+
+	// Keep track of the changes to the bins in case the block is
+	// disconnected.
+	registered := &registeredBlock{hash: *block.Hash()}
+
+	// Go through the transactions in the block in random order, so the
+	// replacements are not biased by the order of the block.
+	txs := block.Transactions()
+	for _, i := range rand.Perm(len(txs)) {
+		// Have we observed this transaction in the mempool?  The
+		// parallel blocks of the DAG may include the same transaction,
+		// which is only counted by the first one.
+		o, ok := ef.observed[*txs[i].Hash()]
+		if !ok || o.mined != unminedOrder {
+			continue
+		}
+
+		o.mined = order
+		blocksToConfirm := o.confirmBin()
+		if blocksToConfirm >= estimateFeeDepth ||
+			replacementCounts[blocksToConfirm] == estimateFeeMaxReplacements {
+
+			o.mined = unminedOrder
+			continue
+		}
+		replacementCounts[blocksToConfirm]++
+		registered.mined = append(registered.mined, o)
+
+		// Replace a random transaction of a full bin with this one, but
+		// not one added by this same block.
+		bin := ef.bin[blocksToConfirm]
+		if len(bin) == estimateFeeBinSize {
+			l := estimateFeeBinSize - replacementCounts[blocksToConfirm] + 1
+			drop := rand.Intn(l)
+			registered.dropped = append(registered.dropped, bin[drop])
+
+			bin[drop] = bin[l-1]
+			bin[l-1] = o
+		} else {
+			bin = append(bin, o)
+		}
+		ef.bin[blocksToConfirm] = bin
+	}
+
+	// Go through the mempool for transactions that have been in too long.
+	for txHash, o := range ef.observed {
+		if o.mined == unminedOrder &&
+			ef.lastKnownOrder+1-o.observed >= estimateFeeDepth {
+
+			delete(ef.observed, txHash)
+		}
+	}
+
+	// Add the block to the history and forget the mined transactions of
+	// the blocks which can no longer be rolled back.
+	ef.registered = append(ef.registered, registered)
+	for uint32(len(ef.registered)) > ef.maxRollback {
+		for _, o := range ef.registered[0].mined {
+			delete(ef.observed, o.hash)
+		}
+		ef.registered = ef.registered[1:]
+	}
+}
+
+// Rollback unregisters a recently registered block from the FeeEstimator.
+// This is used to reverse the effect of a block disconnected from the DAG on
+// the fee estimator.  The maximum number of rollbacks allowed is given by
+// maxRollback.
+//
+// Note: not everything can be rolled back because some transactions are
+// deleted if they have been observed too long ago.  That means the result of
+// Rollback won't always be exactly the same as if the block had not happened,
+// but it should be close enough.
+func (ef *FeeEstimator) Rollback(blockHash *hash.Hash) error {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	index := -1
+	for i, registered := range ef.registered {
+		if registered.hash.IsEqual(blockHash) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("no registered block %v to roll back",
+			blockHash)
+	}
+	registered := ef.registered[index]
+
+	// The previous estimates are invalid, so delete them.
+	ef.cached = nil
+
+	// Take the transactions mined by the block out of the bins, so they
+	// are counted again when they are mined by another block.
+	for _, o := range registered.mined {
+		i := o.confirmBin()
+		bin := ef.bin[i]
+		for j, prev := range bin {
+			if prev == o {
+				ef.bin[i] = append(bin[:j], bin[j+1:]...)
+				break
+			}
+		}
+		o.mined = unminedOrder
+	}
+
+	// Put back the transactions dropped by the block.
+	for _, o := range registered.dropped {
+		i := o.confirmBin()
+		if len(ef.bin[i]) < estimateFeeBinSize {
+			ef.bin[i] = append(ef.bin[i], o)
+		}
+	}
+
+	ef.registered = append(ef.registered[:index], ef.registered[index+1:]...)
+	ef.numBlocksRegistered--
+	return nil
+}
+
+// estimates returns the estimated fee rates for each number of DAG orders.
+// The estimate for a number is the median fee rate of the transactions which
+// were confirmed within that number of orders, but never higher than the
+// estimate for a lower number.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) estimates() []int64 {
+	estimates := make([]int64, estimateFeeDepth)
+	feeRates := make([]int64, 0, estimateFeeDepth*estimateFeeBinSize)
+	for i, bin := range ef.bin {
+		for _, o := range bin {
+			feeRates = append(feeRates, o.feeRate)
+		}
+		sort.Slice(feeRates, func(a, b int) bool {
+			return feeRates[a] < feeRates[b]
+		})
+
+		var estimate int64
+		if len(feeRates) > 0 {
+			estimate = feeRates[len(feeRates)/2]
+		}
+		if i > 0 && estimates[i-1] < estimate {
+			estimate = estimates[i-1]
+		}
+		estimates[i] = estimate
+	}
+	return estimates
+}
+
+// EstimateFee estimates the fee per kilobyte in atoms a transaction needs to
+// pay to be confirmed within the passed number of DAG orders.  The estimate
+// is zero when no transactions have been observed to confirm that fast.
+func (ef *FeeEstimator) EstimateFee(numOrders uint32) (int64, error) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// If the number of registered blocks is below the minimum, return
+	// an error.
+	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
+		return -1, errors.New("not enough blocks have been observed")
+	}
+
+	if numOrders == 0 {
+		return -1, errors.New("cannot confirm transaction in zero blocks")
+	}
+
+	if numOrders > estimateFeeDepth {
+		return -1, fmt.Errorf("can only estimate fees for up to %d "+
+			"blocks from now", estimateFeeDepth)
+	}
+
+	// If there are no cached results, generate them.
+	if ef.cached == nil {
+		ef.cached = ef.estimates()
+	}
+
+	return ef.cached[int(numOrders)-1], nil
+}
+
+// Save records the current state of the FeeEstimator to a []byte that can be
+// restored later.  Only the confirmed transactions of the bins are saved,
+// since the mempool and the blocks which could be rolled back don't survive a
+// restart.
+func (ef *FeeEstimator) Save() []byte {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	w := bytes.NewBuffer(make([]byte, 0))
+	binary.Write(w, binary.LittleEndian, uint32(estimateFeeSaveVersion))
+	binary.Write(w, binary.LittleEndian, ef.maxRollback)
+	binary.Write(w, binary.LittleEndian, ef.minRegisteredBlocks)
+	binary.Write(w, binary.LittleEndian, ef.lastKnownOrder)
+	binary.Write(w, binary.LittleEndian, ef.numBlocksRegistered)
+	for _, bin := range ef.bin {
+		binary.Write(w, binary.LittleEndian, uint32(len(bin)))
+		for _, o := range bin {
+			w.Write(o.hash[:])
+			binary.Write(w, binary.LittleEndian, o.feeRate)
+			binary.Write(w, binary.LittleEndian, o.observed)
+			binary.Write(w, binary.LittleEndian, o.mined)
+		}
+	}
+	return w.Bytes()
+}
+
+// RestoreFeeEstimator takes the state that was returned by Save and restores
+// it to a FeeEstimator.
+func RestoreFeeEstimator(data []byte) (*FeeEstimator, error) {
+	r := bytes.NewReader(data)
+
+	var version uint32
+	err := binary.Read(r, binary.LittleEndian, &version)
+	if err != nil {
+		return nil, err
+	}
+	if version != estimateFeeSaveVersion {
+		return nil, fmt.Errorf("incorrect version: expected %d found %d",
+			estimateFeeSaveVersion, version)
+	}
+
+	ef := &FeeEstimator{
+		observed: make(map[hash.Hash]*observedTransaction),
+	}
+	for _, field := range []interface{}{&ef.maxRollback,
+		&ef.minRegisteredBlocks, &ef.lastKnownOrder,
+		&ef.numBlocksRegistered} {
+
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range ef.bin {
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, err
+		}
+		if count > estimateFeeBinSize {
+			return nil, fmt.Errorf("bin %d has %d transactions, "+
+				"max %d", i, count, estimateFeeBinSize)
+		}
+		bin := make([]*observedTransaction, 0, count)
+		for j := uint32(0); j < count; j++ {
+			o := &observedTransaction{}
+			if _, err := io.ReadFull(r, o.hash[:]); err != nil {
+				return nil, err
+			}
+			for _, field := range []interface{}{&o.feeRate,
+				&o.observed, &o.mined} {
+
+				err := binary.Read(r, binary.LittleEndian, field)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if o.confirmBin() != i {
+				return nil, fmt.Errorf("transaction %v in bin %d "+
+					"confirmed after %d orders", o.hash, i,
+					o.confirmBin())
+			}
+			bin = append(bin, o)
+		}
+		ef.bin[i] = bin
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes left over", r.Len())
+	}
+
+	return ef, nil
+}
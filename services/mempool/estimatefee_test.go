@@ -0,0 +1,106 @@
+package mempool
+
+import (
+	"bytes"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"testing"
+)
+
+// newTestBlock returns a block of the passed order including the passed
+// transactions after a coinbase.
+func newTestBlock(order uint64, txs ...*types.Tx) *types.SerializedBlock {
+	block := &types.Block{Header: types.BlockHeader{
+		Difficulty: uint32(order),
+		Pow:        pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+	}}
+	block.AddTransaction(types.NewTransaction())
+	for _, tx := range txs {
+		block.AddTransaction(tx.Tx)
+	}
+	sblock := types.NewBlock(block)
+	sblock.SetOrder(order)
+	return sblock
+}
+
+func TestFeeEstimator(t *testing.T) {
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+
+	newTx := func(feeRate int64) *types.Tx {
+		mtx := types.NewTransaction()
+		mtx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{},
+			uint32(feeRate)), nil))
+		tx := types.NewTx(mtx)
+		ef.ObserveTransaction(&types.TxDesc{Tx: tx, FeePerKB: feeRate})
+		return tx
+	}
+
+	// Transactions are ignored until the first block is registered.
+	ignored := newTx(100)
+	ef.RegisterBlock(newTestBlock(1))
+	if _, err := ef.EstimateFee(1); err == nil {
+		t.Fatalf("estimate before enough blocks were registered")
+	}
+
+	// The high fee transactions are confirmed by the next block, the low
+	// fee ones a few orders later.  The duplicate of a parallel block is
+	// not counted again.
+	fast := []*types.Tx{newTx(5000), newTx(6000), newTx(7000)}
+	slow := []*types.Tx{newTx(1000), newTx(2000)}
+	ef.RegisterBlock(newTestBlock(2, append(fast, ignored)...))
+	ef.RegisterBlock(newTestBlock(3, fast[0]))
+	ef.RegisterBlock(newTestBlock(4))
+	ef.RegisterBlock(newTestBlock(5, slow...))
+
+	tests := []struct {
+		target uint32
+		want   int64
+	}{
+		{1, 6000},
+		{2, 6000},
+		{4, 5000},
+		{estimateFeeDepth, 5000},
+	}
+	for _, test := range tests {
+		feeRate, err := ef.EstimateFee(test.target)
+		if err != nil || feeRate != test.want {
+			t.Fatalf("estimate for %d: %d %v, want %d", test.target,
+				feeRate, err, test.want)
+		}
+	}
+	for _, target := range []uint32{0, estimateFeeDepth + 1} {
+		if _, err := ef.EstimateFee(target); err == nil {
+			t.Fatalf("estimate for %d", target)
+		}
+	}
+
+	// The state survives a restart.
+	restored, err := RestoreFeeEstimator(ef.Save())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.Save(), ef.Save()) {
+		t.Fatalf("restored state differs")
+	}
+	if feeRate, err := restored.EstimateFee(4); err != nil || feeRate != 5000 {
+		t.Fatalf("restored estimate %d %v", feeRate, err)
+	}
+
+	// Rolling back the last block forgets the slow transactions until they
+	// are mined again.
+	if err := ef.Rollback(newTestBlock(5, slow...).Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if feeRate, err := ef.EstimateFee(4); err != nil || feeRate != 6000 {
+		t.Fatalf("estimate after rollback %d %v", feeRate, err)
+	}
+	ef.RegisterBlock(newTestBlock(5, slow...))
+	if feeRate, err := ef.EstimateFee(4); err != nil || feeRate != 5000 {
+		t.Fatalf("estimate after reconnect %d %v", feeRate, err)
+	}
+	if err := ef.Rollback(&hash.Hash{1}); err == nil {
+		t.Fatalf("rollback of an unknown block")
+	}
+}
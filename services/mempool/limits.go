@@ -0,0 +1,232 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"container/heap"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+	"math"
+	"time"
+)
+
+// rollingMinFeeHalfLife is the time it takes for the minimum relay fee raised
+// by the evictions of a full pool to decay by half.
+const rollingMinFeeHalfLife = 12 * time.Hour
+
+// minRelayTxFee returns the fee per kilobyte a transaction must pay to be
+// accepted into the pool at the passed time: the configured minimum relay fee,
+// or more while the fee raised by the last evictions hasn't decayed yet.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) minRelayTxFee(now time.Time) types.Amount {
+	minFee := mp.cfg.Policy.MinRelayTxFee
+	if mp.rollingMinFee == 0 {
+		return minFee
+	}
+	halfLives := now.Sub(mp.rollingMinFeeTime).Hours() /
+		rollingMinFeeHalfLife.Hours()
+	rollingMinFee := mp.rollingMinFee / math.Pow(2, halfLives)
+	if rollingMinFee <= float64(minFee) {
+		return minFee
+	}
+	return types.Amount(rollingMinFee)
+}
+
+// MinRelayTxFee returns the fee per kilobyte a transaction must currently pay
+// to be accepted into the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinRelayTxFee() types.Amount {
+	mp.mtx.RLock()
+	minFee := mp.minRelayTxFee(time.Now())
+	mp.mtx.RUnlock()
+	return minFee
+}
+
+// Size returns the number of transactions in the pool and their total
+// serialized size.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Size() (int, int64) {
+	mp.mtx.RLock()
+	count, size := len(mp.pool), mp.poolSize
+	mp.mtx.RUnlock()
+	return count, size
+}
+
+// trimTargetPercent is the percentage of the maximum pool size a full pool is
+// trimmed down to, so the evictions are done in batches instead of on every
+// transaction accepted into a full pool.
+const trimTargetPercent = 95
+
+// evictionHeap is a min-heap of the transactions in the pool ordered by the
+// fee rate of their descendant packages.  It implements heap.Interface.
+type evictionHeap []*TxDesc
+
+func (h evictionHeap) Len() int { return len(h) }
+
+func (h evictionHeap) Less(i, j int) bool {
+	return h[i].descendantFeePerKB() < h[j].descendantFeePerKB()
+}
+
+func (h evictionHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *evictionHeap) Push(x interface{}) {
+	txDesc := x.(*TxDesc)
+	txDesc.heapIndex = len(*h)
+	*h = append(*h, txDesc)
+}
+
+func (h *evictionHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	txDesc := old[n-1]
+	old[n-1] = nil
+	txDesc.heapIndex = -1
+	*h = old[:n-1]
+	return txDesc
+}
+
+// descendantFeePerKB returns the fee rate of the transaction counting the fees
+// and sizes of its descendants, which are evicted along with it.
+func (txD *TxDesc) descendantFeePerKB() int64 {
+	return txD.descendantFee * 1000 / txD.descendantSize
+}
+
+// hasDescendants returns whether any transaction in the pool spends an output
+// of the passed transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) hasDescendants(tx *types.Tx) bool {
+	prevOut := types.TxOutPoint{Hash: *tx.Hash()}
+	for i := range tx.Tx.TxOut {
+		prevOut.OutIndex = uint32(i)
+		if _, ok := mp.outpoints[prevOut]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDescendantStats adds the passed fee and size to the descendant stats
+// of the passed transaction and moves it in the eviction heap.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) updateDescendantStats(txD *TxDesc, fee, size int64) {
+	txD.descendantFee += fee
+	txD.descendantSize += size
+	heap.Fix(&mp.evictionHeap, txD.heapIndex)
+}
+
+// recalcDescendantStats recomputes the descendant stats of the passed
+// transaction from its descendants in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) recalcDescendantStats(txD *TxDesc) {
+	fee := txD.Fee
+	size := int64(txD.Tx.Tx.SerializeSize())
+	for descendantHash := range mp.txDescendants(txD.Tx, nil) {
+		descendant := mp.pool[descendantHash]
+		fee += descendant.Fee
+		size += int64(descendant.Tx.Tx.SerializeSize())
+	}
+	mp.updateDescendantStats(txD, fee-txD.descendantFee,
+		size-txD.descendantSize)
+}
+
+// addDescendantStats sets the descendant stats of the passed transaction just
+// added to the pool, pushes it on the eviction heap and adds it to the stats
+// of its ancestors.
+//
+// A transaction is usually added after its descendants only when the block
+// containing it is disconnected, so the stats of its ancestors are then
+// recomputed instead of counting the descendants reachable through another
+// path twice.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addDescendantStats(txD *TxDesc) {
+	txD.descendantFee = txD.Fee
+	txD.descendantSize = int64(txD.Tx.Tx.SerializeSize())
+	heap.Push(&mp.evictionHeap, txD)
+	ancestors := mp.txAncestors(txD.Tx, nil)
+	if !mp.hasDescendants(txD.Tx) {
+		for ancestorHash := range ancestors {
+			mp.updateDescendantStats(mp.pool[ancestorHash], txD.descendantFee,
+				txD.descendantSize)
+		}
+		return
+	}
+
+	mp.recalcDescendantStats(txD)
+	for ancestorHash := range ancestors {
+		mp.recalcDescendantStats(mp.pool[ancestorHash])
+	}
+}
+
+// removeDescendantStats removes the passed transaction just removed from the
+// pool from the eviction heap and from the stats of the passed ancestors.  The
+// stats of the ancestors are recomputed when the transaction had descendants
+// left in the pool, which are no longer descendants of the ancestors through
+// it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeDescendantStats(txD *TxDesc,
+	ancestors map[hash.Hash]*types.Tx, hadDescendants bool) {
+
+	heap.Remove(&mp.evictionHeap, txD.heapIndex)
+	for ancestorHash := range ancestors {
+		ancestor := mp.pool[ancestorHash]
+		if hadDescendants {
+			mp.recalcDescendantStats(ancestor)
+			continue
+		}
+		mp.updateDescendantStats(ancestor, -txD.Fee,
+			-int64(txD.Tx.Tx.SerializeSize()))
+	}
+}
+
+// trimToSize evicts the transactions with the lowest fee rate, counting the
+// fees and sizes of their descendants which are evicted with them, when the
+// pool is larger than the maximum pool size, until it is no larger than
+// trimTargetPercent of it.  The minimum relay fee is then raised above the
+// highest evicted fee rate so the pool doesn't fill up again with
+// transactions paying less.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 || mp.poolSize <= maxSize {
+		return
+	}
+
+	targetSize := maxSize / 100 * trimTargetPercent
+	var maxEvictedFeePerKB int64
+	for mp.poolSize > targetSize && len(mp.evictionHeap) > 0 {
+		txDesc := mp.evictionHeap[0]
+		feePerKB := txDesc.descendantFeePerKB()
+		log.Debug("Evicting transaction from the full mempool", "txHash",
+			txDesc.Tx.Hash(), "feePerKB", feePerKB)
+		mp.removeTransaction(txDesc.Tx, true, true)
+		if feePerKB > maxEvictedFeePerKB {
+			maxEvictedFeePerKB = feePerKB
+		}
+	}
+
+	now := time.Now()
+	rollingMinFee := float64(maxEvictedFeePerKB +
+		int64(mp.cfg.Policy.MinRelayTxFee))
+	if rollingMinFee > float64(mp.minRelayTxFee(now)) {
+		mp.rollingMinFee = rollingMinFee
+		mp.rollingMinFeeTime = now
+		log.Debug("Raised the minimum relay fee of the full mempool",
+			"feePerKB", int64(rollingMinFee))
+	}
+}
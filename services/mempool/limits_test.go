@@ -0,0 +1,172 @@
+package mempool
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"testing"
+)
+
+func TestTrimToSize(t *testing.T) {
+	minRelayTxFee := types.Amount(DefaultMinRelayTxFee)
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: minRelayTxFee}})
+
+	// The low fee parent is kept thanks to its child, the transaction
+	// paying less than the package is evicted.
+	parent := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{1}, 0))
+	child := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(parent.Hash(), 0))
+	other := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{2}, 0))
+	addRBFTestTx(mp, child, 10000)
+	addRBFTestTx(mp, parent, 100)
+	addRBFTestTx(mp, other, 2000)
+
+	_, size := mp.Size()
+	mp.cfg.Policy.MaxPoolSize = size - 1
+	mp.trimToSize()
+	if count, _ := mp.Size(); count != 2 || mp.isTransactionInPool(other.Hash()) {
+		t.Fatalf("unexpected eviction, %d transactions left", count)
+	}
+
+	// The minimum relay fee is raised above the evicted fee rate and
+	// decays back to the configured one.
+	otherFeePerKB := 2000 * 1000 / int64(other.Tx.SerializeSize())
+	now := mp.rollingMinFeeTime
+	if minFee := int64(mp.minRelayTxFee(now)); minFee !=
+		otherFeePerKB+int64(minRelayTxFee) {
+		t.Fatalf("unexpected minimum relay fee %d", minFee)
+	}
+	halfLife := now.Add(rollingMinFeeHalfLife)
+	if minFee := int64(mp.minRelayTxFee(halfLife)); minFee !=
+		(otherFeePerKB+int64(minRelayTxFee))/2 {
+		t.Fatalf("unexpected decayed minimum relay fee %d", minFee)
+	}
+	if minFee := mp.minRelayTxFee(now.Add(10 * rollingMinFeeHalfLife)); minFee != minRelayTxFee {
+		t.Fatalf("unexpected decayed minimum relay fee %d", minFee)
+	}
+
+	// The parents are saved before their children.
+	ordered := mp.orderedTxDescs()
+	if len(ordered) != 2 || ordered[0].Tx != parent || ordered[1].Tx != child {
+		t.Fatalf("unexpected order")
+	}
+}
+
+func TestDescendantStats(t *testing.T) {
+	mp := New(&Config{Policy: Policy{
+		MinRelayTxFee: types.Amount(DefaultMinRelayTxFee),
+	}})
+
+	// checkStats compares the descendant stats kept for every transaction
+	// with the ones of its descendants in the pool and checks the eviction
+	// heap.
+	checkStats := func() {
+		t.Helper()
+		if len(mp.evictionHeap) != len(mp.pool) {
+			t.Fatalf("%d transactions in the eviction heap, want %d",
+				len(mp.evictionHeap), len(mp.pool))
+		}
+		for i, txDesc := range mp.evictionHeap {
+			if txDesc.heapIndex != i {
+				t.Fatalf("heap index %d, want %d", txDesc.heapIndex, i)
+			}
+			if i > 0 && mp.evictionHeap.Less(i, (i-1)/2) {
+				t.Fatalf("eviction heap out of order at %d", i)
+			}
+		}
+		for _, txDesc := range mp.pool {
+			fee := txDesc.Fee
+			size := int64(txDesc.Tx.Tx.SerializeSize())
+			for h := range mp.txDescendants(txDesc.Tx, nil) {
+				fee += mp.pool[h].Fee
+				size += int64(mp.pool[h].Tx.Tx.SerializeSize())
+			}
+			if txDesc.descendantFee != fee || txDesc.descendantSize != size {
+				t.Fatalf("%v has descendant fee %d and size %d, want %d "+
+					"and %d", txDesc.Tx.Hash(), txDesc.descendantFee,
+					txDesc.descendantSize, fee, size)
+			}
+		}
+	}
+
+	// A diamond: the grandchild descends from the root through both
+	// children and is counted once.
+	root := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{1}, 0))
+	left := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(root.Hash(), 0))
+	right := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(root.Hash(), 1))
+	grandchild := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(left.Hash(), 0), types.NewOutPoint(right.Hash(), 0))
+	addRBFTestTx(mp, root, 1000)
+	addRBFTestTx(mp, left, 2000)
+	addRBFTestTx(mp, right, 3000)
+	addRBFTestTx(mp, grandchild, 4000)
+	checkStats()
+	if fee := mp.pool[*root.Hash()].descendantFee; fee != 10000 {
+		t.Fatalf("root has descendant fee %d, want 10000", fee)
+	}
+
+	// The root is mined, its children stay in the pool.
+	mp.removeTransaction(root, false, false)
+	checkStats()
+
+	// A disconnected block adds a transaction back under the ones already
+	// in the pool.
+	top := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{2}, 0))
+	readded := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(top.Hash(), 0))
+	child := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(readded.Hash(), 0))
+	addRBFTestTx(mp, child, 500)
+	addRBFTestTx(mp, top, 100)
+	checkStats()
+	addRBFTestTx(mp, readded, 200)
+	checkStats()
+	if fee := mp.pool[*top.Hash()].descendantFee; fee != 800 {
+		t.Fatalf("top has descendant fee %d, want 800", fee)
+	}
+
+	// Removing the redeemers updates the stats of the ancestors.
+	mp.removeTransaction(readded, true, true)
+	checkStats()
+	mp.removeTransaction(left, true, true)
+	checkStats()
+}
+
+func TestTrimToSizeBatch(t *testing.T) {
+	mp := New(&Config{Policy: Policy{
+		MinRelayTxFee: types.Amount(DefaultMinRelayTxFee),
+	}})
+	for i := 0; i < 100; i++ {
+		tx := newRBFTestTx(types.MaxTxInSequenceNum,
+			types.NewOutPoint(&hash.Hash{byte(i), 1}, 0))
+		addRBFTestTx(mp, tx, int64(1000+i))
+	}
+
+	// A full pool is trimmed below its maximum size so the next accepted
+	// transactions don't evict again, the lowest fee rates first.
+	_, size := mp.Size()
+	mp.cfg.Policy.MaxPoolSize = size - 1
+	mp.trimToSize()
+	count, size := mp.Size()
+	if size > mp.cfg.Policy.MaxPoolSize/100*trimTargetPercent ||
+		count < 90 || count > 98 {
+		t.Fatalf("trimmed to %d transactions of %d bytes", count, size)
+	}
+	for _, txDesc := range mp.pool {
+		if txDesc.Fee < int64(1000+100-count) {
+			t.Fatalf("kept transaction paying %d", txDesc.Fee)
+		}
+	}
+	tx := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{0, 2}, 0))
+	addRBFTestTx(mp, tx, 5000)
+	mp.trimToSize()
+	if n, _ := mp.Size(); n != count+1 {
+		t.Fatalf("%d transactions left, want %d", n, count+1)
+	}
+}
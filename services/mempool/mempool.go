@@ -33,6 +33,21 @@ type TxPool struct {
 	orphansByPrev map[hash.Hash]map[hash.Hash]*types.Tx
 	outpoints     map[types.TxOutPoint]*types.Tx
 
+	// poolSize is the total serialized size of the transactions in the
+	// pool.
+	poolSize int64
+
+	// evictionHeap orders the transactions in the pool by the fee rate of
+	// their descendant packages, the lowest first, so a full pool evicts
+	// them without sorting the whole pool.
+	evictionHeap evictionHeap
+
+	// rollingMinFee is the minimum relay fee in atoms/kB raised by the
+	// evictions of a full pool when it was last updated.  It decays with
+	// rollingMinFeeHalfLife.
+	rollingMinFee     float64
+	rollingMinFeeTime time.Time
+
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 }
@@ -57,6 +72,14 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// descendantFee and descendantSize are the total fee and serialized
+	// size of the transaction and all of its descendants in the pool.
+	descendantFee  int64
+	descendantSize int64
+
+	// heapIndex is the index of the transaction in the eviction heap.
+	heapIndex int
 }
 
 // TxDescs returns a slice of descriptors for all the transactions in the pool.
@@ -79,8 +102,12 @@ func (mp *TxPool) TxDescs() []*TxDesc {
 // removeTransaction is the internal function which implements the public
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
+// The evicted flag tells whether the transaction is removed without being
+// mined, in which case it is removed from the fee estimator.  The redeemers
+// are always evicted.
+//
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
+func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers, evicted bool) {
 	tx := theTx.Transaction()
 	txHash := theTx.Hash()
 	if removeRedeemers {
@@ -88,13 +115,15 @@ func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
 		for i := uint32(0); i < uint32(len(tx.TxOut)); i++ {
 			outpoint := types.NewOutPoint(txHash, i)
 			if txRedeemer, exists := mp.outpoints[*outpoint]; exists {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true, true)
 			}
 		}
 	}
 
 	// Remove the transaction if needed.
 	if txDesc, exists := mp.pool[*txHash]; exists {
+		ancestors := mp.txAncestors(theTx, nil)
+		hasDescendants := mp.hasDescendants(theTx)
 		// Remove unconfirmed address index entries associated with the
 		// transaction if enabled.
 		// TODO address index
@@ -107,20 +136,36 @@ func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOut)
 		}
 		delete(mp.pool, *txHash)
+		mp.poolSize -= int64(txDesc.Tx.Tx.SerializeSize())
+		mp.removeDescendantStats(txDesc, ancestors, hasDescendants)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+		if evicted {
+			mp.txEvicted(txHash)
+		}
+	}
+}
+
+// txEvicted tells the fee estimator the passed transaction was removed from
+// the pool without being mined.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) txEvicted(txHash *hash.Hash) {
+	if mp.cfg.FeeEstimator != nil {
+		mp.cfg.FeeEstimator.RemoveTransaction(txHash)
 	}
 }
 
 // RemoveTransaction removes the passed transaction from the mempool. When the
 // removeRedeemers flag is set, any transactions that redeem outputs from the
 // removed transaction will also be removed recursively from the mempool, as
-// they would otherwise become orphans.
+// they would otherwise become orphans.  The passed transaction is meant to be
+// mined, so the fee estimator keeps it until the block is registered.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveTransaction(tx *types.Tx, removeRedeemers bool) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	mp.removeTransaction(tx, removeRedeemers)
+	mp.removeTransaction(tx, removeRedeemers, false)
 	mp.mtx.Unlock()
 }
 
@@ -137,7 +182,7 @@ func (mp *TxPool) RemoveDoubleSpends(tx *types.Tx) {
 	for _, txIn := range tx.Transaction().TxIn {
 		if txRedeemer, ok := mp.outpoints[txIn.PreviousOut]; ok {
 			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true, true)
 			}
 		}
 	}
@@ -151,8 +196,6 @@ func (mp *TxPool) RemoveDoubleSpends(tx *types.Tx) {
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	tx *types.Tx, height uint64, fee int64) *TxDesc {
-	// Add the transaction to the pool and mark the referenced outpoints
-	// as spent by the pool.
 	msgTx := tx.Transaction()
 	txD := &TxDesc{
 		TxDesc: types.TxDesc{
@@ -164,10 +207,25 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 		},
 		StartingPriority: CalcPriority(msgTx, utxoView, height, mp.cfg.BD),
 	}
+	mp.addTxDesc(utxoView, txD)
+	return txD
+}
+
+// addTxDesc adds the transaction of the passed descriptor to the memory pool
+// along with its metadata.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addTxDesc(utxoView *blockchain.UtxoViewpoint, txD *TxDesc) {
+	// Add the transaction to the pool and mark the referenced outpoints
+	// as spent by the pool.
+	tx := txD.Tx
+	msgTx := tx.Transaction()
 	mp.pool[*tx.Hash()] = txD
+	mp.poolSize += int64(msgTx.SerializeSize())
 	for _, txIn := range msgTx.TxIn {
 		mp.outpoints[txIn.PreviousOut] = tx
 	}
+	mp.addDescendantStats(txD)
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -178,7 +236,11 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	if mp.cfg.ExistsAddrIndex != nil {
 		mp.cfg.ExistsAddrIndex.AddUnconfirmedTx(msgTx)
 	}
-	return txD
+
+	// Record this tx for fee estimation if enabled.
+	if mp.cfg.FeeEstimator != nil {
+		mp.cfg.FeeEstimator.ObserveTransaction(&txD.TxDesc)
+	}
 }
 
 //Call addTransaction
@@ -222,6 +284,16 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, txRuleError(message.RejectInvalid, str)
 	}
 
+	// Don't accept the transaction types which can't be mined until a
+	// rule change deployment is active.
+	err = mp.cfg.BC.CheckTxTypeDeployment(msgTx)
+	if err != nil {
+		if cerr, ok := err.(blockchain.RuleError); ok {
+			return nil, nil, chainRuleError(cerr)
+		}
+		return nil, nil, err
+	}
+
 	// Don't accept transactions with a lock time after the maximum int32
 	// value for now.  This is an artifact of older bitcoind clients which
 	// treated this field as an int32 and would treat anything larger
@@ -272,7 +344,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = mp.checkPoolDoubleSpend(tx)
+	// Double spends of transactions signalling replacement are validated
+	// once the fee is known.
+	isReplacement, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -396,7 +470,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 	// Don't allow transactions with fees too low to get into a mined block.
 	serializedSize := int64(msgTx.SerializeSize())
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
-		mp.cfg.Policy.MinRelayTxFee)
+		mp.minRelayTxFee(time.Now()))
 	if txFee < minFee {
 		str := fmt.Sprintf("transaction %v has %v fees which "+
 			"is under the required amount of %v", txHash,
@@ -461,6 +535,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		}
 	}
 
+	// A replacement transaction must pay for the transactions it evicts.
+	var conflicts map[hash.Hash]*types.Tx
+	if isReplacement {
+		conflicts, err = mp.validateReplacement(tx, txFee)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	flags, err := mp.cfg.Policy.StandardVerifyFlags()
@@ -476,8 +559,14 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, err
 	}
 
-	// Add to transaction pool.
-	txD := mp.addTransaction(utxoView, tx, nextBlockHeight, txFee)
+	// Add to transaction pool, replacing the conflicts.  The lowest fee
+	// rate transactions are evicted when the pool is full, which can be
+	// the new transaction itself.
+	txD, err := mp.addReplacement(utxoView, tx, nextBlockHeight, txFee,
+		conflicts)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	log.Debug("Accepted transaction", "txHash", txHash, "pool size", len(mp.pool))
 
@@ -941,7 +1030,7 @@ func (mp *TxPool) pruneExpiredTx() {
 		if blockchain.IsExpired(tx.Tx, nextBlockHeight) {
 			log.Debug(fmt.Sprintf("Pruning expired transaction %v from the mempool",
 				tx.Tx.Hash()))
-			mp.removeTransaction(tx.Tx, true)
+			mp.removeTransaction(tx.Tx, true, true)
 		}
 	}
 }
@@ -0,0 +1,159 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+	"os"
+	"time"
+)
+
+const (
+	// MempoolFilename is the name of the file the mempool is saved to in
+	// the data directory.
+	MempoolFilename = "mempool.dat"
+
+	// mempoolSaveVersion is the version of the format of the saved
+	// mempool.
+	mempoolSaveVersion = 1
+)
+
+// orderedTxDescs returns the descriptors of the transactions in the pool with
+// every transaction after the transactions of the pool it spends.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) orderedTxDescs() []*TxDesc {
+	return orderTxDescs(mp.pool)
+}
+
+// orderTxDescs returns the passed descriptors with every transaction after the
+// passed transactions it spends.
+func orderTxDescs(txDescs map[hash.Hash]*TxDesc) []*TxDesc {
+	ordered := make([]*TxDesc, 0, len(txDescs))
+	visited := make(map[hash.Hash]struct{}, len(txDescs))
+	var visit func(txDesc *TxDesc)
+	visit = func(txDesc *TxDesc) {
+		txHash := *txDesc.Tx.Hash()
+		if _, ok := visited[txHash]; ok {
+			return
+		}
+		visited[txHash] = struct{}{}
+		for _, txIn := range txDesc.Tx.Tx.TxIn {
+			if parent, ok := txDescs[txIn.PreviousOut.Hash]; ok {
+				visit(parent)
+			}
+		}
+		ordered = append(ordered, txDesc)
+	}
+	for _, txDesc := range txDescs {
+		visit(txDesc)
+	}
+	return ordered
+}
+
+// Save writes the transactions of the pool to the passed file so they can be
+// restored with Load, and returns the number of transactions written.  The
+// file is replaced atomically.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(path string) (int, error) {
+	mp.mtx.RLock()
+	txDescs := mp.orderedTxDescs()
+	mp.mtx.RUnlock()
+
+	// Write a temporary file and then move it into place.
+	tmpfile := path + ".new"
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	binary.Write(w, binary.LittleEndian, uint32(mempoolSaveVersion))
+	binary.Write(w, binary.LittleEndian, uint32(len(txDescs)))
+	for _, txDesc := range txDescs {
+		serializedTx, err := txDesc.Tx.Tx.Serialize()
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		binary.Write(w, binary.LittleEndian, txDesc.Added.Unix())
+		w.Write(serializedTx)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpfile, path); err != nil {
+		return 0, err
+	}
+	return len(txDescs), nil
+}
+
+// Load restores the transactions saved to the passed file by Save and returns
+// the number of transactions accepted.  Every transaction is validated again
+// against the current chain, the ones which were mined, double spent or no
+// longer meet the policy are dropped.  A missing file is not an error.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var version, count uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return 0, err
+	}
+	if version != mempoolSaveVersion {
+		return 0, fmt.Errorf("incorrect version: expected %d found %d",
+			mempoolSaveVersion, version)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return 0, err
+	}
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	accepted := 0
+	for i := uint32(0); i < count; i++ {
+		var added int64
+		if err := binary.Read(r, binary.LittleEndian, &added); err != nil {
+			return accepted, err
+		}
+		var msgTx types.Transaction
+		if err := msgTx.Deserialize(r); err != nil {
+			return accepted, err
+		}
+		tx := types.NewTx(&msgTx)
+
+		// The transactions are not new, so they are not subject to the
+		// priority and rate limiting rules of the relayed ones.
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, false,
+			false, true)
+		if err != nil || len(missingParents) > 0 {
+			log.Debug("Dropped saved transaction", "txHash", tx.Hash(),
+				"error", err)
+			continue
+		}
+		txD.Added = time.Unix(added, 0)
+		accepted++
+	}
+	return accepted, nil
+}
@@ -7,6 +7,8 @@
 package mempool
 
 import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
 )
@@ -46,6 +48,10 @@ const (
 	// (1 + 15*74 + 3) + (15*34 + 3) + 23 = 1650
 	maxStandardSigScriptSize = 1650
 
+	// DefaultMaxPoolSize is the default maximum size in megabytes of the
+	// transactions in the pool.
+	DefaultMaxPoolSize = 300
+
 	// DefaultMinRelayTxFee is the minimum fee in atoms that is required for
 	// a transaction to be treated as free.
 	// It is also used to help determine if a transaction is considered dust
@@ -85,6 +91,10 @@ const (
 	// pushes in a transaction, after which it is considered non-standard.
 	maxNullDataOutputs = 4
 
+	// maxStandardAssetsPerTx is the maximum number of distinct assets a
+	// transaction may spend or create for it to be considered standard.
+	maxStandardAssetsPerTx = 4
+
 	// UnminedLayer is the layer used for the "block" layer field of the
 	// contextual transaction information provided in a transaction store
 	// when it has not yet been mined into a block.
@@ -113,6 +123,11 @@ type Policy struct {
 	// network. Otherwise, all non-standard transactions will be rejected.
 	AcceptNonStd bool
 
+	// RejectReplacement defines whether to reject all transactions
+	// spending the outputs already spent by transactions in the pool,
+	// even if those signal replacement.
+	RejectReplacement bool
+
 	// FreeTxRelayLimit defines the given amount in thousands of bytes
 	// per minute that transactions with no fee are rate limited to.
 	FreeTxRelayLimit float64
@@ -134,6 +149,11 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in AtomQitmeer/kB
 	MinRelayTxFee types.Amount
 
+	// MaxPoolSize is the maximum total size in bytes of the transactions
+	// in the pool.  The transactions with the lowest fee rate are evicted
+	// once it is exceeded.  Zero means no limit.
+	MaxPoolSize int64
+
 	// StandardVerifyFlags defines the function to retrieve the flags to
 	// use for verifying scripts for the block after the current best block.
 	// It must set the verification flags properly depending on the result
@@ -142,3 +162,43 @@ type Policy struct {
 	// This function must be safe for concurrent access.
 	StandardVerifyFlags func() (txscript.ScriptFlags, error)
 }
+
+// checkAssetStandard performs the standardness checks of the asset outputs of a
+// transaction.  Only regular, asset and contract transactions are standard,
+// asset outputs must pay to a public key, a public key hash or a script hash,
+// and a transaction may not carry more than maxStandardAssetsPerTx distinct
+// assets.
+func checkAssetStandard(tx *types.Transaction) error {
+	txType := types.DetermineTxType(tx)
+	if txType == types.TxTypeRegular || types.IsContractTxType(txType) {
+		return nil
+	}
+	if !types.IsAssetTxType(txType) {
+		str := fmt.Sprintf("transaction type %v is not standard", txType)
+		return txRuleError(message.RejectNonstandard, str)
+	}
+
+	assets := make(map[types.AssetId]struct{})
+	for i, txOut := range tx.TxOut {
+		if txOut.Asset.IsMeer() {
+			continue
+		}
+		assets[txOut.Asset] = struct{}{}
+		scriptClass := txscript.GetScriptClass(txscript.DefaultScriptVersion,
+			txOut.PkScript)
+		switch scriptClass {
+		case txscript.PubKeyTy, txscript.PubKeyHashTy, txscript.ScriptHashTy:
+		default:
+			str := fmt.Sprintf("transaction output %d: asset %v is "+
+				"locked by non-standard script class %v", i,
+				txOut.Asset, scriptClass)
+			return txRuleError(message.RejectNonstandard, str)
+		}
+	}
+	if len(assets) > maxStandardAssetsPerTx {
+		str := fmt.Sprintf("transaction carries %d assets, max %d",
+			len(assets), maxStandardAssetsPerTx)
+		return txRuleError(message.RejectNonstandard, str)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+const (
+	// MaxRBFSequence is the maximum sequence number an input can use to
+	// signal that the transaction spending it can be replaced by a
+	// transaction paying a higher fee (BIP125).
+	MaxRBFSequence = 0xfffffffd
+
+	// MaxReplacementEvictions is the maximum number of transactions that
+	// can be evicted from the mempool when accepting a transaction
+	// replacement.
+	MaxReplacementEvictions = 100
+)
+
+// signalsReplacement returns whether the passed transaction signals that it
+// can be replaced, either explicitly through the sequence number of one of
+// its inputs or implicitly through one of its unconfirmed ancestors.
+//
+// The cache is populated with the ancestors known not to signal replacement
+// and may be nil.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) signalsReplacement(tx *types.Tx,
+	cache map[hash.Hash]struct{}) bool {
+
+	if cache == nil {
+		cache = make(map[hash.Hash]struct{})
+	}
+
+	for _, txIn := range tx.Tx.TxIn {
+		if txIn.Sequence <= MaxRBFSequence {
+			return true
+		}
+
+		parentHash := txIn.PreviousOut.Hash
+		parent, ok := mp.pool[parentHash]
+		if !ok {
+			continue
+		}
+		if _, ok := cache[parentHash]; ok {
+			continue
+		}
+		if mp.signalsReplacement(parent.Tx, cache) {
+			return true
+		}
+		cache[parentHash] = struct{}{}
+	}
+
+	return false
+}
+
+// txAncestors returns all of the unconfirmed ancestors of the passed
+// transaction within the mempool.
+//
+// The cache is populated with the ancestors found and may be nil.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) txAncestors(tx *types.Tx,
+	cache map[hash.Hash]*types.Tx) map[hash.Hash]*types.Tx {
+
+	if cache == nil {
+		cache = make(map[hash.Hash]*types.Tx)
+	}
+
+	for _, txIn := range tx.Tx.TxIn {
+		parentHash := txIn.PreviousOut.Hash
+		parent, ok := mp.pool[parentHash]
+		if !ok {
+			continue
+		}
+		if _, ok := cache[parentHash]; ok {
+			continue
+		}
+		cache[parentHash] = parent.Tx
+		mp.txAncestors(parent.Tx, cache)
+	}
+
+	return cache
+}
+
+// txDescendants returns all of the unconfirmed descendants of the passed
+// transaction within the mempool.
+//
+// The cache is populated with the descendants found and may be nil.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) txDescendants(tx *types.Tx,
+	cache map[hash.Hash]*types.Tx) map[hash.Hash]*types.Tx {
+
+	if cache == nil {
+		cache = make(map[hash.Hash]*types.Tx)
+	}
+
+	prevOut := types.TxOutPoint{Hash: *tx.Hash()}
+	for i := range tx.Tx.TxOut {
+		prevOut.OutIndex = uint32(i)
+		child, ok := mp.outpoints[prevOut]
+		if !ok {
+			continue
+		}
+		if _, ok := cache[*child.Hash()]; ok {
+			continue
+		}
+		cache[*child.Hash()] = child
+		mp.txDescendants(child, cache)
+	}
+
+	return cache
+}
+
+// txConflicts returns all of the unconfirmed transactions that would be
+// evicted from the mempool if the passed transaction was accepted: the
+// transactions spending the same outputs and all of their descendants.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) txConflicts(tx *types.Tx) map[hash.Hash]*types.Tx {
+	conflicts := make(map[hash.Hash]*types.Tx)
+	for _, txIn := range tx.Tx.TxIn {
+		conflict, ok := mp.outpoints[txIn.PreviousOut]
+		if !ok {
+			continue
+		}
+		conflicts[*conflict.Hash()] = conflict
+		for h, descendant := range mp.txDescendants(conflict, nil) {
+			conflicts[h] = descendant
+		}
+	}
+	return conflicts
+}
+
+// validateReplacement determines whether the passed transaction, which spends
+// outputs already spent by signalling transactions in the pool, is allowed to
+// replace them.  The rules follow BIP125:
+//
+//   - the replacement may not evict more than MaxReplacementEvictions
+//     transactions, counting the descendants of the replaced transactions
+//   - the replacement may not spend the outputs of a transaction it replaces
+//   - the replacement must pay a higher fee rate than every transaction it
+//     evicts
+//   - the replacement must pay for the fees of the evicted transactions and
+//     for its own relay at the minimum relay fee rate
+//   - the replacement may not spend unconfirmed outputs the replaced
+//     transactions did not already spend
+//
+// The transactions to evict are returned when the replacement is valid.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) validateReplacement(tx *types.Tx,
+	txFee int64) (map[hash.Hash]*types.Tx, error) {
+
+	txHash := tx.Hash()
+	conflicts := mp.txConflicts(tx)
+	if len(conflicts) > MaxReplacementEvictions {
+		str := fmt.Sprintf("replacement transaction %v evicts more "+
+			"transactions than permitted: max is %v, evicts %v",
+			txHash, MaxReplacementEvictions, len(conflicts))
+		return nil, txRuleError(message.RejectNonstandard, str)
+	}
+
+	for ancestorHash := range mp.txAncestors(tx, nil) {
+		if _, ok := conflicts[ancestorHash]; !ok {
+			continue
+		}
+		str := fmt.Sprintf("replacement transaction %v spends parent "+
+			"transaction %v which it conflicts with", txHash,
+			ancestorHash)
+		return nil, txRuleError(message.RejectInvalid, str)
+	}
+
+	txSize := int64(tx.Tx.SerializeSize())
+	txFeePerKB := txFee * 1000 / txSize
+	var conflictsFee int64
+	conflictsParents := make(map[hash.Hash]struct{})
+	for conflictHash, conflict := range conflicts {
+		txDesc := mp.pool[conflictHash]
+		if txFeePerKB <= txDesc.FeePerKB {
+			str := fmt.Sprintf("replacement transaction %v has an "+
+				"insufficient fee rate: needs more than %v, has %v",
+				txHash, txDesc.FeePerKB, txFeePerKB)
+			return nil, txRuleError(message.RejectInsufficientFee, str)
+		}
+		conflictsFee += txDesc.Fee
+
+		for _, txIn := range conflict.Tx.TxIn {
+			conflictsParents[txIn.PreviousOut.Hash] = struct{}{}
+		}
+	}
+
+	minFee := calcMinRequiredTxRelayFee(txSize, mp.cfg.Policy.MinRelayTxFee)
+	if txFee < conflictsFee+minFee {
+		str := fmt.Sprintf("replacement transaction %v has an "+
+			"insufficient absolute fee: needs %v, has %v", txHash,
+			conflictsFee+minFee, txFee)
+		return nil, txRuleError(message.RejectInsufficientFee, str)
+	}
+
+	for _, txIn := range tx.Tx.TxIn {
+		parentHash := txIn.PreviousOut.Hash
+		if _, ok := conflictsParents[parentHash]; ok {
+			continue
+		}
+		if _, ok := mp.pool[parentHash]; ok {
+			str := fmt.Sprintf("replacement transaction %v spends "+
+				"new unconfirmed input %v not found in "+
+				"conflicting transactions", txHash,
+				txIn.PreviousOut)
+			return nil, txRuleError(message.RejectNonstandard, str)
+		}
+	}
+
+	return conflicts, nil
+}
+
+// addReplacement adds the passed transaction to the pool in place of the
+// passed conflicts, which may be empty, and then trims the pool to its maximum
+// size.  When the full pool evicts the transaction, the replaced transactions
+// are restored and an error is returned.  Otherwise they are removed from the
+// fee estimator like the other evicted transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addReplacement(utxoView *blockchain.UtxoViewpoint,
+	tx *types.Tx, height uint64, fee int64,
+	conflicts map[hash.Hash]*types.Tx) (*TxDesc, error) {
+
+	// Evict the replaced transactions and their descendants, which are all
+	// part of the conflicts, the children first.  The parents they spend
+	// from the pool are remembered to restore them.
+	txHash := tx.Hash()
+	replacedDescs := make(map[hash.Hash]*TxDesc, len(conflicts))
+	for conflictHash := range conflicts {
+		replacedDescs[conflictHash] = mp.pool[conflictHash]
+	}
+	replaced := orderTxDescs(replacedDescs)
+	poolParents := make(map[hash.Hash]struct{})
+	for _, txDesc := range replaced {
+		for _, txIn := range txDesc.Tx.Tx.TxIn {
+			if mp.isTransactionInPool(&txIn.PreviousOut.Hash) {
+				poolParents[txIn.PreviousOut.Hash] = struct{}{}
+			}
+		}
+	}
+	for i := len(replaced) - 1; i >= 0; i-- {
+		log.Debug("Replacing transaction", "txHash", replaced[i].Tx.Hash(),
+			"replacement", txHash)
+		mp.removeTransaction(replaced[i].Tx, false, false)
+	}
+
+	txD := mp.addTransaction(utxoView, tx, height, fee)
+	mp.trimToSize()
+	if !mp.isTransactionInPool(txHash) {
+		mp.restoreReplaced(replaced, poolParents)
+		str := fmt.Sprintf("transaction %v was not accepted into the "+
+			"full mempool: fee rate too low", txHash)
+		return nil, txRuleError(message.RejectInsufficientFee, str)
+	}
+	for _, txDesc := range replaced {
+		mp.txEvicted(txDesc.Tx.Hash())
+	}
+	return txD, nil
+}
+
+// restoreReplaced adds back the passed transactions, ordered with the parents
+// first, which were replaced by a transaction the full pool then evicted.  The
+// passed parents are the transactions they spent from the pool: a transaction
+// whose parent was evicted along with the replacement is evicted too.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) restoreReplaced(replaced []*TxDesc,
+	poolParents map[hash.Hash]struct{}) {
+
+	for _, txDesc := range replaced {
+		txHash := txDesc.Tx.Hash()
+		restore := true
+		for _, txIn := range txDesc.Tx.Tx.TxIn {
+			parentHash := &txIn.PreviousOut.Hash
+			if _, ok := poolParents[*parentHash]; ok &&
+				!mp.isTransactionInPool(parentHash) {
+				restore = false
+				break
+			}
+		}
+		var utxoView *blockchain.UtxoViewpoint
+		if restore {
+			var err error
+			utxoView, err = mp.fetchInputUtxos(txDesc.Tx)
+			if err != nil {
+				log.Warn("Failed to restore replaced transaction",
+					"txHash", txHash, "err", err)
+				restore = false
+			}
+		}
+		if !restore {
+			mp.txEvicted(txHash)
+			continue
+		}
+		log.Debug("Restoring replaced transaction", "txHash", txHash)
+		mp.addTxDesc(utxoView, txDesc)
+	}
+}
@@ -0,0 +1,180 @@
+package mempool
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"testing"
+)
+
+// newRBFTestTx returns a transaction with the passed sequence spending the
+// passed outputs into two outputs.
+func newRBFTestTx(sequence uint32, prevOuts ...*types.TxOutPoint) *types.Tx {
+	mtx := types.NewTransaction()
+	for _, prevOut := range prevOuts {
+		txIn := types.NewTxInput(prevOut, nil)
+		txIn.Sequence = sequence
+		mtx.AddTxIn(txIn)
+	}
+	mtx.AddTxOut(types.NewTxOutput(1e6, []byte{0x51}))
+	mtx.AddTxOut(types.NewTxOutput(1e6, []byte{0x51}))
+	return types.NewTx(mtx)
+}
+
+// addRBFTestTx adds the passed transaction paying the passed fee to the pool
+// without any validation.
+func addRBFTestTx(mp *TxPool, tx *types.Tx, fee int64) {
+	txD := &TxDesc{TxDesc: types.TxDesc{
+		Tx:       tx,
+		Fee:      fee,
+		FeePerKB: fee * 1000 / int64(tx.Tx.SerializeSize()),
+	}}
+	mp.pool[*tx.Hash()] = txD
+	for _, txIn := range tx.Tx.TxIn {
+		mp.outpoints[txIn.PreviousOut] = tx
+	}
+	mp.poolSize += int64(tx.Tx.SerializeSize())
+	mp.addDescendantStats(txD)
+}
+
+func TestReplacement(t *testing.T) {
+	mp := New(&Config{Policy: Policy{
+		MinRelayTxFee: types.Amount(DefaultMinRelayTxFee),
+	}})
+	confirmed := types.NewOutPoint(&hash.Hash{1}, 0)
+	other := types.NewOutPoint(&hash.Hash{2}, 0)
+
+	// A final transaction can't be replaced, but its child signalling
+	// replacement can.
+	final := newRBFTestTx(types.MaxTxInSequenceNum, confirmed)
+	addRBFTestTx(mp, final, 1000)
+	if _, err := mp.checkPoolDoubleSpend(newRBFTestTx(0, confirmed)); err == nil {
+		t.Fatalf("replaced a final transaction")
+	}
+	finalOut := types.NewOutPoint(final.Hash(), 0)
+	child := newRBFTestTx(MaxRBFSequence, finalOut)
+	addRBFTestTx(mp, child, 1000)
+	if isReplacement, err := mp.checkPoolDoubleSpend(
+		newRBFTestTx(0, finalOut)); err != nil || !isReplacement {
+		t.Fatalf("child not replaceable: %v", err)
+	}
+
+	// The signal is inherited by the descendants, which are evicted with
+	// the replaced transaction.
+	grandchild := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(child.Hash(), 0))
+	addRBFTestTx(mp, grandchild, 1000)
+	if !mp.signalsReplacement(grandchild, nil) {
+		t.Fatalf("grandchild does not inherit the signal")
+	}
+	replacement := newRBFTestTx(0, finalOut)
+	conflicts := mp.txConflicts(replacement)
+	if len(conflicts) != 2 || conflicts[*child.Hash()] == nil ||
+		conflicts[*grandchild.Hash()] == nil {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+
+	mp.cfg.Policy.RejectReplacement = true
+	if _, err := mp.checkPoolDoubleSpend(replacement); err == nil {
+		t.Fatalf("replacement accepted with RejectReplacement")
+	}
+	mp.cfg.Policy.RejectReplacement = false
+
+	unrelated := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(&hash.Hash{3}, 0))
+	addRBFTestTx(mp, unrelated, 1000)
+
+	size := int64(replacement.Tx.SerializeSize())
+	minFee := calcMinRequiredTxRelayFee(size,
+		types.Amount(DefaultMinRelayTxFee))
+	tests := []struct {
+		name  string
+		tx    *types.Tx
+		fee   int64
+		valid bool
+	}{
+		{"fee of the replaced transactions", replacement, 2000, false},
+		{"no relay fee", replacement, 2000 + minFee - 1, false},
+		{"bumped fee", replacement, 2000 + minFee, true},
+		{"new unconfirmed input", newRBFTestTx(0, finalOut,
+			types.NewOutPoint(unrelated.Hash(), 0)), 1e5, false},
+		{"spends a replaced transaction", newRBFTestTx(0, finalOut,
+			types.NewOutPoint(child.Hash(), 1)), 1e5, false},
+		{"new confirmed input", newRBFTestTx(0, finalOut, other), 1e5, true},
+	}
+	for _, test := range tests {
+		_, err := mp.validateReplacement(test.tx, test.fee)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected result %v", test.name, err)
+		}
+	}
+}
+
+func TestReplacementFullPool(t *testing.T) {
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+	ef.RegisterBlock(newTestBlock(1))
+	mp := New(&Config{
+		Policy: Policy{MinRelayTxFee: types.Amount(DefaultMinRelayTxFee)},
+		FetchUtxoView: func(*types.Tx) (*blockchain.UtxoViewpoint, error) {
+			return blockchain.NewUtxoViewpoint(), nil
+		},
+		FeeEstimator: ef,
+	})
+	utxoView := blockchain.NewUtxoViewpoint()
+
+	// A replaceable transaction and its child in a pool full of
+	// transactions paying higher fee rates than the replacement.
+	confirmed := types.NewOutPoint(&hash.Hash{1}, 0)
+	replaced := newRBFTestTx(MaxRBFSequence, confirmed)
+	child := newRBFTestTx(types.MaxTxInSequenceNum,
+		types.NewOutPoint(replaced.Hash(), 0))
+	mp.addTransaction(utxoView, replaced, 1, 2000)
+	mp.addTransaction(utxoView, child, 1, 2000)
+	for i := 0; i < 10; i++ {
+		mp.addTransaction(utxoView, newRBFTestTx(types.MaxTxInSequenceNum,
+			types.NewOutPoint(&hash.Hash{2, byte(i)}, 0)), 1, 1e5)
+	}
+	prevOuts := []*types.TxOutPoint{confirmed}
+	for i := 0; i < 10; i++ {
+		prevOuts = append(prevOuts, types.NewOutPoint(&hash.Hash{3, byte(i)}, 0))
+	}
+	replacement := newRBFTestTx(0, prevOuts...)
+	conflicts, err := mp.validateReplacement(replacement, 3e4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The full pool evicts the replacement, the replaced transactions are
+	// restored and still observed by the fee estimator.
+	count, size := mp.Size()
+	mp.cfg.Policy.MaxPoolSize = size
+	if _, err := mp.addReplacement(utxoView, replacement, 1, 3e4,
+		conflicts); err == nil {
+		t.Fatalf("replacement accepted into the full pool")
+	}
+	if n, _ := mp.Size(); n != count || !mp.isTransactionInPool(replaced.Hash()) ||
+		!mp.isTransactionInPool(child.Hash()) {
+		t.Fatalf("replaced transactions not restored, %d transactions left", n)
+	}
+	if ef.observed[*replaced.Hash()] == nil || ef.observed[*child.Hash()] == nil {
+		t.Fatalf("restored transactions removed from the fee estimator")
+	}
+	if ef.observed[*replacement.Hash()] != nil {
+		t.Fatalf("evicted replacement not removed from the fee estimator")
+	}
+
+	// Once the replacement is kept, the replaced transactions are removed
+	// from the fee estimator.
+	mp.cfg.Policy.MaxPoolSize = 0
+	if _, err := mp.addReplacement(utxoView, replacement, 1, 3e4,
+		conflicts); err != nil {
+		t.Fatal(err)
+	}
+	if mp.isTransactionInPool(replaced.Hash()) || mp.isTransactionInPool(child.Hash()) {
+		t.Fatalf("replaced transactions left in the pool")
+	}
+	if ef.observed[*replaced.Hash()] != nil || ef.observed[*child.Hash()] != nil {
+		t.Fatalf("replaced transactions left in the fee estimator")
+	}
+}
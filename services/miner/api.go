@@ -3,6 +3,7 @@
 package miner
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
@@ -10,6 +11,7 @@ import (
 	"github.com/Qitmeer/qitmeer/engine/txscript"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -55,8 +57,7 @@ type PublicMinerAPI struct {
 }
 
 func NewPublicMinerAPI(c *CPUMiner) *PublicMinerAPI {
-	pmAPI := &PublicMinerAPI{miner: c}
-	pmAPI.gbtWorkState = &gbtWorkState{timeSource: c.timeSource}
+	pmAPI := &PublicMinerAPI{miner: c, gbtWorkState: c.gbtWorkState}
 
 	pmAPI.gbtCoinbaseAux = &json.GetBlockTemplateResultAux{
 		Flags: hex.EncodeToString(builderScript(txscript.NewScriptBuilder().
@@ -65,17 +66,28 @@ func NewPublicMinerAPI(c *CPUMiner) *PublicMinerAPI {
 	return pmAPI
 }
 
-//func (api *PublicMinerAPI) GetBlockTemplate(request *mining.TemplateRequest) (interface{}, error){
-func (api *PublicMinerAPI) GetBlockTemplate(capabilities []string) (interface{}, error) {
+// GetBlockTemplate returns a block template for external mining.  The
+// optional request carries the mode, longpollid and data fields of BIP22 and
+// BIP23; its capabilities are added to the passed ones.  A request with a
+// longpollid is held until the template it identifies is stale, and a request
+// in the proposal mode validates the block in data instead.
+// See https://en.bitcoin.it/wiki/BIP_0022 for full specification
+func (api *PublicMinerAPI) GetBlockTemplate(ctx context.Context, capabilities []string, request *json.TemplateRequest) (interface{}, error) {
+	if request == nil {
+		request = &json.TemplateRequest{}
+	}
+	request.Capabilities = append(capabilities, request.Capabilities...)
+
 	// Set the default mode and override it if supplied.
 	mode := "template"
-	request := json.TemplateRequest{Mode: mode, Capabilities: capabilities}
+	if request.Mode != "" {
+		mode = request.Mode
+	}
 	switch mode {
 	case "template":
-		return handleGetBlockTemplateRequest(api, &request)
+		return handleGetBlockTemplateRequest(ctx, api, request)
 	case "proposal":
-		//TODO LL, will be added
-		//return handleGetBlockTemplateProposal(s, request)
+		return handleGetBlockTemplateProposal(api, request)
 	}
 	return nil, rpc.RpcInvalidError("Invalid mode")
 }
@@ -162,7 +174,7 @@ func (api *PublicMinerAPI) SubmitBlock(hexBlock string) (interface{}, error) {
 // in regards to whether or not it supports creating its own coinbase (the
 // coinbasetxn and coinbasevalue capabilities) and modifies the returned block
 // template accordingly.
-func handleGetBlockTemplateRequest(api *PublicMinerAPI, request *json.TemplateRequest) (interface{}, error) {
+func handleGetBlockTemplateRequest(ctx context.Context, api *PublicMinerAPI, request *json.TemplateRequest) (interface{}, error) {
 	// Extract the relevant passed capabilities and restrict the result to
 	// either a coinbase value or a coinbase transaction object depending on
 	// the request.  Default to only providing a coinbase value.
@@ -199,6 +211,14 @@ func handleGetBlockTemplateRequest(api *PublicMinerAPI, request *json.TemplateRe
 			"qitmeer is downloading blocks...")
 	}
 
+	// When a long poll ID was provided, this is a long poll request by the
+	// client to be notified when block template referenced by the ID should
+	// be replaced with a new one.
+	if request.LongPollID != "" {
+		return handleGetBlockTemplateLongPoll(ctx, api, request.LongPollID,
+			useCoinbaseValue)
+	}
+
 	// Protect concurrent access when updating block templates.
 	state := api.gbtWorkState
 	state.Lock()
@@ -215,6 +235,241 @@ func handleGetBlockTemplateRequest(api *PublicMinerAPI, request *json.TemplateRe
 	return state.blockTemplateResult(api, useCoinbaseValue, nil)
 }
 
+// handleGetBlockTemplateLongPoll is a helper for handleGetBlockTemplateRequest
+// which deals with handling long polling for block templates.  When a caller
+// sends a request with a long poll ID that was previously returned, a response
+// is not sent until the caller should stop working on the previous block
+// template in favor of the new one.  In particular, this is the case when the
+// tips of the DAG have changed or the transactions in the memory pool have
+// been updated and it has been long enough since the last template was
+// generated.
+func handleGetBlockTemplateLongPoll(ctx context.Context, api *PublicMinerAPI, longPollID string, useCoinbaseValue bool) (interface{}, error) {
+	state := api.gbtWorkState
+	state.Lock()
+	// The state unlock is intentionally not deferred here since it needs to
+	// be manually unlocked before waiting for a notification about block
+	// template changes.
+
+	if err := state.updateBlockTemplate(api, useCoinbaseValue); err != nil {
+		state.Unlock()
+		return nil, err
+	}
+
+	// Just return the current block template if the long poll ID provided by
+	// the caller is invalid.
+	parentRoot, lastGenerated, err := decodeTemplateID(longPollID)
+	if err != nil {
+		result, err := state.blockTemplateResult(api, useCoinbaseValue, nil)
+		state.Unlock()
+		return result, err
+	}
+
+	// Return the block template now if the specific block template
+	// identified by the long poll ID no longer matches the current block
+	// template as this means the provided template is stale.
+	templateRoot := state.template.Block.Header.ParentRoot
+	if !parentRoot.IsEqual(&templateRoot) ||
+		lastGenerated != state.lastGenerated.Unix() {
+
+		// Include whether or not it is valid to submit work against the
+		// old block template depending on whether or not the tips it
+		// builds on are still the tips of the DAG.
+		submitOld := parentRoot.IsEqual(&templateRoot)
+		result, err := state.blockTemplateResult(api, useCoinbaseValue, &submitOld)
+		state.Unlock()
+		return result, err
+	}
+
+	// Get a channel that will be notified when the template associated with
+	// the provided ID is stale and a new block template should be returned to
+	// the caller.
+	longPollChan := state.templateUpdateChan(parentRoot, lastGenerated)
+	state.Unlock()
+
+	select {
+	// When the client closes before it's time to send a reply, just return
+	// now so the goroutine doesn't hang around.
+	case <-ctx.Done():
+		return nil, ctx.Err()
+
+	// Wait until signal received to send the reply.
+	case <-longPollChan:
+	}
+
+	// Get the latest block template.
+	state.Lock()
+	defer state.Unlock()
+
+	if err := state.updateBlockTemplate(api, useCoinbaseValue); err != nil {
+		return nil, err
+	}
+
+	// Include whether or not it is valid to submit work against the old block
+	// template depending on whether or not the tips it builds on are still
+	// the tips of the DAG.
+	templateRoot = state.template.Block.Header.ParentRoot
+	submitOld := parentRoot.IsEqual(&templateRoot)
+	return state.blockTemplateResult(api, useCoinbaseValue, &submitOld)
+}
+
+// handleGetBlockTemplateProposal is a helper for GetBlockTemplate which deals
+// with block proposals as defined by BIP23.  The proposed block is validated
+// against the consensus rules without its proof of work.  Nil is returned when
+// the block would be accepted, otherwise the BIP22 reason of the rejection.
+func handleGetBlockTemplateProposal(api *PublicMinerAPI, request *json.TemplateRequest) (interface{}, error) {
+	hexData := request.Data
+	if hexData == "" {
+		return nil, rpc.RpcInvalidError("Data must contain the " +
+			"hex-encoded serialized block that is being proposed")
+	}
+
+	// Ensure the provided data is sane and deserialize the proposed block.
+	if len(hexData)%2 != 0 {
+		hexData = "0" + hexData
+	}
+	dataBytes, err := hex.DecodeString(hexData)
+	if err != nil {
+		return nil, rpc.RpcDecodeHexError(hexData)
+	}
+	block, err := types.NewBlockFromBytes(dataBytes)
+	if err != nil {
+		return nil, rpc.RpcDeserializationError("Block decode failed: %s", err.Error())
+	}
+
+	chain := api.miner.blockManager.GetChain()
+	if exists, _ := chain.HaveBlock(block.Hash()); exists {
+		return "duplicate", nil
+	}
+
+	// Ensure the block builds on the tips of the DAG.
+	parents := blockdag.NewIdSet()
+	for _, v := range block.Block().Parents {
+		parents.Add(chain.BlockIndex().GetDAGBlockID(v))
+	}
+	height, ok := chain.BlockDAG().CheckSubMainChainTip(parents.List())
+	if !ok {
+		return "bad-prevblk", nil
+	}
+	block.SetHeight(height)
+	block.SetOrder(uint64(chain.BestSnapshot().GraphState.GetTotal()))
+
+	if err := chain.CheckConnectBlockTemplate(block); err != nil {
+		if _, ok := err.(blockchain.RuleError); !ok {
+			log.Error("Failed to process block proposal", "error", err)
+			return nil, rpc.RpcInternalError(err.Error(), "Block proposal")
+		}
+
+		log.Info("Rejected block proposal", "hash", block.Hash(), "error", err)
+		return chainErrToGBTErrString(err), nil
+	}
+
+	return nil, nil
+}
+
+// chainErrToGBTErrString converts an error returned from the blockchain
+// package into a string which matches the reasons and format described in
+// BIP22 for rejection reasons.
+func chainErrToGBTErrString(err error) string {
+	// When the passed error is not a RuleError, just return a generic
+	// rejected string with the error text.
+	ruleErr, ok := err.(blockchain.RuleError)
+	if !ok {
+		return "rejected: " + err.Error()
+	}
+
+	switch ruleErr.ErrorCode {
+	case blockchain.ErrDuplicateBlock:
+		return "duplicate"
+	case blockchain.ErrBlockTooBig, blockchain.ErrWrongBlockSize:
+		return "bad-blk-length"
+	case blockchain.ErrBlockVersionTooOld:
+		return "bad-version"
+	case blockchain.ErrInvalidTime:
+		return "bad-time"
+	case blockchain.ErrTimeTooOld:
+		return "time-too-old"
+	case blockchain.ErrTimeTooNew:
+		return "time-too-new"
+	case blockchain.ErrDifficultyTooLow, blockchain.ErrUnexpectedDifficulty:
+		return "bad-diffbits"
+	case blockchain.ErrHighHash:
+		return "high-hash"
+	case blockchain.ErrBadMerkleRoot:
+		return "bad-txnmrklroot"
+	case blockchain.ErrBadParentsMerkleRoot:
+		return "bad-parentsmrklroot"
+	case blockchain.ErrBadStateRoot:
+		return "bad-stateroot"
+	case blockchain.ErrBadCheckpoint:
+		return "bad-checkpoint"
+	case blockchain.ErrForkTooOld:
+		return "fork-too-old"
+	case blockchain.ErrCheckpointTimeTooOld:
+		return "checkpoint-time-too-old"
+	case blockchain.ErrNoTransactions:
+		return "bad-txns-none"
+	case blockchain.ErrNoParents, blockchain.ErrDuplicateParent,
+		blockchain.ErrMissingParent, blockchain.ErrParentsBlockUnknown,
+		blockchain.ErrPrevBlockNotBest, blockchain.ErrInvalidTemplateParent:
+		return "bad-prevblk"
+	case blockchain.ErrInvalidAncestorBlock:
+		return "bad-prevblk-invalid"
+	case blockchain.ErrTooManyTransactions:
+		return "bad-txns-toomany"
+	case blockchain.ErrNoTxInputs:
+		return "bad-txns-noinputs"
+	case blockchain.ErrNoTxOutputs:
+		return "bad-txns-nooutputs"
+	case blockchain.ErrTxTooBig:
+		return "bad-txns-size"
+	case blockchain.ErrInvalidTxOutValue:
+		return "bad-txns-outputvalue"
+	case blockchain.ErrDuplicateTxInputs:
+		return "bad-txns-dupinputs"
+	case blockchain.ErrInvalidTxInput:
+		return "bad-txns-badinput"
+	case blockchain.ErrMissingTxOut:
+		return "bad-txns-missinginput"
+	case blockchain.ErrUnfinalizedTx:
+		return "bad-txns-unfinalizedtx"
+	case blockchain.ErrDuplicateTx:
+		return "bad-txns-duplicate"
+	case blockchain.ErrOverwriteTx:
+		return "bad-txns-overwrite"
+	case blockchain.ErrImmatureSpend:
+		return "bad-txns-maturity"
+	case blockchain.ErrSpendTooHigh:
+		return "bad-txns-highspend"
+	case blockchain.ErrBadFees:
+		return "bad-txns-fees"
+	case blockchain.ErrTooManySigOps:
+		return "high-sigops"
+	case blockchain.ErrFirstTxNotCoinbase:
+		return "bad-txns-nocoinbase"
+	case blockchain.ErrMultipleCoinbases:
+		return "bad-txns-multicoinbase"
+	case blockchain.ErrBadCoinbaseScriptLen:
+		return "bad-cb-length"
+	case blockchain.ErrBadCoinbaseValue:
+		return "bad-cb-value"
+	case blockchain.ErrCoinbaseHeight, blockchain.ErrMissingCoinbaseHeight:
+		return "bad-cb-height"
+	case blockchain.ErrScriptMalformed:
+		return "bad-script-malformed"
+	case blockchain.ErrScriptValidation:
+		return "bad-script-validate"
+	case blockchain.ErrBadBlockHeight:
+		return "bad-height"
+	case blockchain.ErrInvalidAssetTx, blockchain.ErrAssetNotConserved,
+		blockchain.ErrAssetUnauthorized, blockchain.ErrUnknownAsset:
+		return "bad-txns-asset"
+	case blockchain.ErrInvalidContractTx, blockchain.ErrContractGasNotPaid:
+		return "bad-txns-contract"
+	}
+
+	return "rejected: " + err.Error()
+}
+
 //LL
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
@@ -222,6 +477,29 @@ func encodeTemplateID(prevHash hash.Hash, lastGenerated time.Time) string {
 	return fmt.Sprintf("%s-%d", prevHash.String(), lastGenerated.Unix())
 }
 
+// decodeTemplateID decodes an ID that is used to uniquely identify a block
+// template.  This is mainly used as a mechanism to track when to update clients
+// that are using long polling for block templates.  The ID consists of the
+// merkle root of the parents of the template and the time the associated
+// template was generated.
+func decodeTemplateID(templateID string) (*hash.Hash, int64, error) {
+	fields := strings.Split(templateID, "-")
+	if len(fields) != 2 {
+		return nil, 0, fmt.Errorf("invalid longpollid format")
+	}
+
+	parentRoot, err := hash.NewHashFromStr(fields[0])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid longpollid format")
+	}
+	lastGenerated, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid longpollid format")
+	}
+
+	return parentRoot, lastGenerated, nil
+}
+
 // gbtWorkState houses state that is used in between multiple RPC invocations to
 // getblocktemplate.
 type gbtWorkState struct {
@@ -231,9 +509,133 @@ type gbtWorkState struct {
 	parentsSet    *blockdag.HashSet
 	minTimestamp  time.Time
 	template      *types.BlockTemplate
+	notifyMap     map[hash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
 }
 
+// newGbtWorkState returns a new instance of a gbtWorkState with all internal
+// fields initialized and ready to use.
+func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+	return &gbtWorkState{
+		notifyMap:  make(map[hash.Hash]map[int64]chan struct{}),
+		timeSource: timeSource,
+	}
+}
+
+// notifyLongPollers notifies any channels that have been registered to be
+// notified when block templates are stale.  The templates built on other
+// parents than the passed merkle root are stale, and so are the ones built
+// on them which were generated before the passed time.  A nil root makes all
+// the templates stale.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) notifyLongPollers(parentRoot *hash.Hash, lastGenerated time.Time) {
+	// Notify anything that is waiting for a block template update from
+	// parents which are not the tips of the DAG since their work is now
+	// invalid.
+	for root, channels := range state.notifyMap {
+		if parentRoot == nil || !root.IsEqual(parentRoot) {
+			for _, c := range channels {
+				close(c)
+			}
+			delete(state.notifyMap, root)
+		}
+	}
+
+	// Return now if the provided last generated timestamp has not been
+	// initialized or there is nothing registered for updates to the
+	// current parents.
+	if parentRoot == nil || lastGenerated.IsZero() {
+		return
+	}
+	channels, ok := state.notifyMap[*parentRoot]
+	if !ok {
+		return
+	}
+
+	// Notify anything that is waiting for a block template update from a
+	// block template generated before the most recently generated block
+	// template.
+	lastGeneratedUnix := lastGenerated.Unix()
+	for lastGen, c := range channels {
+		if lastGen < lastGeneratedUnix {
+			close(c)
+			delete(channels, lastGen)
+		}
+	}
+
+	// Remove the entry altogether if there are no more registered
+	// channels.
+	if len(channels) == 0 {
+		delete(state.notifyMap, *parentRoot)
+	}
+}
+
+// NotifyBlockConnected uses the newly-connected block to notify any long poll
+// clients with a new block template when their existing block template is
+// stale.  Every connected block becomes a tip of the DAG, so all the existing
+// templates are stale.
+func (state *gbtWorkState) NotifyBlockConnected() {
+	go func() {
+		state.Lock()
+		defer state.Unlock()
+
+		state.notifyLongPollers(nil, time.Time{})
+	}()
+}
+
+// NotifyMempoolTx uses the new last updated time for the transaction memory
+// pool to notify any long poll clients with a new block template when their
+// existing block template is stale due to enough time passing and the contents
+// of the memory pool changing.
+func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
+	go func() {
+		state.Lock()
+		defer state.Unlock()
+
+		// No need to notify anything if no block templates have been
+		// generated yet.
+		if state.template == nil || state.lastGenerated.IsZero() {
+			return
+		}
+
+		if time.Now().After(state.lastGenerated.Add(time.Second *
+			gbtRegenerateSeconds)) {
+
+			parentRoot := state.template.Block.Header.ParentRoot
+			state.notifyLongPollers(&parentRoot, lastUpdated)
+		}
+	}()
+}
+
+// templateUpdateChan returns a channel that will be closed once the block
+// template associated with the passed parents merkle root and last generated
+// time is stale.  The function will return existing channels for duplicate
+// parameters which allows multiple clients to wait for the same block template
+// without requiring a different channel for each client.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) templateUpdateChan(parentRoot *hash.Hash, lastGenerated int64) chan struct{} {
+	// Either get the current list of channels waiting for updates about
+	// changes to block template for the parents or create a new one.
+	channels, ok := state.notifyMap[*parentRoot]
+	if !ok {
+		m := make(map[int64]chan struct{})
+		state.notifyMap[*parentRoot] = m
+		channels = m
+	}
+
+	// Get the current channel associated with the time the block template
+	// was last generated or create a new one.
+	c, ok := channels[lastGenerated]
+	if !ok {
+		c = make(chan struct{})
+		channels[lastGenerated] = c
+	}
+
+	return c
+}
+
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
 // changed or the transactions in the memory pool have been updated and it has
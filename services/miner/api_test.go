@@ -0,0 +1,136 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package miner
+
+import (
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"testing"
+	"time"
+)
+
+func Test_DecodeTemplateID(t *testing.T) {
+	root := hash.Hash{1, 2, 3}
+	generated := time.Unix(1600000000, 0)
+	id := encodeTemplateID(root, generated)
+	gotRoot, gotGenerated, err := decodeTemplateID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotRoot != root || gotGenerated != generated.Unix() {
+		t.Fatalf("decoded %v %d, want %v %d", gotRoot, gotGenerated, root,
+			generated.Unix())
+	}
+
+	for _, id := range []string{
+		"",
+		root.String(),
+		root.String() + "-",
+		root.String() + "-1-2",
+		root.String() + "-x",
+		"xyz-1600000000",
+	} {
+		if _, _, err := decodeTemplateID(id); err == nil {
+			t.Errorf("%q: invalid template id decoded", id)
+		}
+	}
+}
+
+// isClosed returns whether the channel is closed.
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func Test_LongPollers(t *testing.T) {
+	state := newGbtWorkState(blockchain.NewMedianTime())
+	rootA := hash.Hash{0xa}
+	rootB := hash.Hash{0xb}
+
+	// The clients of the same template share a channel.
+	a1 := state.templateUpdateChan(&rootA, 1)
+	if state.templateUpdateChan(&rootA, 1) != a1 {
+		t.Fatal("new channel for the same template")
+	}
+	a2 := state.templateUpdateChan(&rootA, 2)
+	a3 := state.templateUpdateChan(&rootA, 3)
+	b1 := state.templateUpdateChan(&rootB, 1)
+	if a2 == a1 || b1 == a1 {
+		t.Fatal("same channel for different templates")
+	}
+
+	// The templates on other parents are stale, and those generated before
+	// the passed time on the same parents.
+	state.notifyLongPollers(&rootA, time.Unix(3, 0))
+	for i, test := range []struct {
+		c      chan struct{}
+		closed bool
+	}{{a1, true}, {a2, true}, {a3, false}, {b1, true}} {
+		if isClosed(test.c) != test.closed {
+			t.Errorf("channel %d closed: %v", i, !test.closed)
+		}
+	}
+	if len(state.notifyMap) != 1 || len(state.notifyMap[rootA]) != 1 {
+		t.Fatalf("left channels %v", state.notifyMap)
+	}
+
+	// Without a generation time, only the other parents are stale.
+	state.notifyLongPollers(&rootA, time.Time{})
+	if isClosed(a3) {
+		t.Fatal("template closed without a generation time")
+	}
+
+	// A closed channel isn't reused.
+	if state.templateUpdateChan(&rootA, 1) == a1 {
+		t.Fatal("closed channel reused")
+	}
+
+	// A connected block makes all the templates stale.
+	state.notifyLongPollers(nil, time.Time{})
+	if !isClosed(a3) || len(state.notifyMap) != 0 {
+		t.Fatalf("left channels %v", state.notifyMap)
+	}
+
+	// NotifyBlockConnected locks the state in the background.
+	c := state.templateUpdateChan(&rootB, 5)
+	state.NotifyBlockConnected()
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poller not notified of the connected block")
+	}
+}
+
+func Test_ChainErrToGBTErrString(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{blockchain.RuleError{ErrorCode: blockchain.ErrDuplicateBlock}, "duplicate"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrBlockTooBig}, "bad-blk-length"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrWrongBlockSize}, "bad-blk-length"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrHighHash}, "high-hash"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrBadStateRoot}, "bad-stateroot"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrMissingParent}, "bad-prevblk"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrInvalidTemplateParent}, "bad-prevblk"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrInvalidAncestorBlock}, "bad-prevblk-invalid"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrMissingCoinbaseHeight}, "bad-cb-height"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrUnknownAsset}, "bad-txns-asset"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrContractGasNotPaid}, "bad-txns-contract"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrNoParents,
+			Description: "no parents"}, "bad-prevblk"},
+		{blockchain.RuleError{ErrorCode: blockchain.ErrPoolSize,
+			Description: "bad input"}, "rejected: bad input"},
+		{errors.New("database error"), "rejected: database error"},
+	}
+	for _, test := range tests {
+		if got := chainErrToGBTErrString(test.err); got != test.want {
+			t.Errorf("%v: %s, want %s", test.err, got, test.want)
+		}
+	}
+}
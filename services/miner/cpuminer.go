@@ -80,6 +80,10 @@ type CPUMiner struct {
 	speedMonitorQuit  chan struct{}
 	quit              chan struct{}
 
+	// gbtWorkState is the state of the getblocktemplate RPC shared with
+	// its long poll clients.
+	gbtWorkState *gbtWorkState
+
 	// This is a map that keeps track of how many blocks have
 	// been mined on each parent by the CPUMiner. It is only
 	// for use in simulation networks, to diminish memory
@@ -107,9 +111,22 @@ func NewCPUMiner(cfg *config.Config, par *params.Params, policy *mining.Policy,
 		queryHashesPerSec: make(chan float64),
 		updateHashes:      make(chan uint64),
 		minedOnParents:    make(map[hash.Hash]uint8),
+		gbtWorkState:      newGbtWorkState(tsource),
 	}
 }
 
+// NotifyBlockConnected notifies the getblocktemplate long poll clients that
+// their block templates are stale, since a block was connected to the DAG.
+func (m *CPUMiner) NotifyBlockConnected() {
+	m.gbtWorkState.NotifyBlockConnected()
+}
+
+// NotifyMempoolTx notifies the getblocktemplate long poll clients whose block
+// templates are stale due to the transactions added to the mempool.
+func (m *CPUMiner) NotifyMempoolTx() {
+	m.gbtWorkState.NotifyMempoolTx(m.txSource.LastUpdated())
+}
+
 // GenerateNBlocks generates the requested number of blocks. It is self
 // contained in that it creates block templates and attempts to solve them while
 // detecting when it is performing stale work and reacting accordingly by
@@ -163,6 +163,9 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 	// determine which dependent transactions are now eligible for inclusion
 	// in the block once each transaction has been included.
 	dependers := make(map[hash.Hash]map[hash.Hash]*WeightedRandTx)
+	// candidates holds the transactions which can be included in the block
+	// as long as their ancestors in the source pool are included first.
+	candidates := make(map[hash.Hash]*WeightedRandTx, len(sourceTxns))
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -206,7 +209,10 @@ mempoolLoop:
 		// Setup dependencies for any transactions which reference
 		// other transactions in the mempool so they can be properly
 		// ordered below.
-		weirandItem := &WeightedRandTx{tx: tx}
+		weirandItem := &WeightedRandTx{
+			tx:   tx,
+			size: int64(tx.Transaction().SerializeSize()),
+		}
 		for _, txIn := range tx.Tx.TxIn {
 			originHash := &txIn.PreviousOut.Hash
 			entry := utxos.LookupEntry(txIn.PreviousOut)
@@ -250,11 +256,7 @@ mempoolLoop:
 		weirandItem.feePerKB = txDesc.FeePerKB
 		weirandItem.fee = txDesc.Fee
 
-		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if weirandItem.dependsOn == nil {
-			weightedRandQueue.Push(weirandItem)
-		}
+		candidates[*tx.Hash()] = weirandItem
 
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
@@ -262,6 +264,23 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
+	// Queue every transaction with the fee and size of its ancestors in the
+	// source pool, which are selected together with it.  The transactions
+	// depending on a transaction which can't be included are skipped.
+	for txHash, item := range candidates {
+		ancestors, ok := packageAncestors(item, candidates)
+		if !ok {
+			log.Trace(fmt.Sprintf("Skipping tx %s because one of its "+
+				"ancestors is not available", txHash))
+			continue
+		}
+		for _, ancestor := range ancestors {
+			item.ancestorFee += ancestor.fee
+			item.ancestorSize += ancestor.size
+		}
+		weightedRandQueue.Push(item)
+	}
+
 	log.Trace(fmt.Sprintf("Weighted random queue len %d, dependers len %d",
 		weightedRandQueue.Len(), len(dependers)))
 
@@ -272,101 +291,123 @@ mempoolLoop:
 
 	// Choose which transactions make it into the block.
 	for weightedRandQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
+		// Grab a transaction randomly weighted by the fee per kilobyte
+		// of its ancestor package.
 		weirandItem := weightedRandQueue.Pop()
 		tx := weirandItem.tx
 
 		// Grab any transactions which depend on this one.
 		deps := dependers[*tx.Hash()]
 
+		// The transaction is added to the block together with its
+		// ancestors which are not in the block yet.
+		ancestors, ok := packageAncestors(weirandItem, candidates)
+		if !ok {
+			log.Trace(fmt.Sprintf("Skipping tx %s because one of its "+
+				"ancestors was skipped", tx.Hash()))
+			logSkippedDeps(tx, deps)
+			continue
+		}
+		pkg := append(ancestors, weirandItem)
+
 		// Enforce maximum block size.  Also check for overflow.
-		txSize := uint32(tx.Transaction().SerializeSize())
-		blockPlusTxSize := blockSize + txSize
+		pkgSize := uint32(0)
+		pkgSigOpCost := int64(0)
+		for _, item := range pkg {
+			pkgSize += uint32(item.size)
+			pkgSigOpCost += int64(blockchain.CountSigOps(item.tx))
+		}
+		blockPlusTxSize := blockSize + pkgSize
 		if blockPlusTxSize < blockSize || blockPlusTxSize >= policy.BlockMaxSize {
-			log.Trace(fmt.Sprintf("Skipping tx %s (size %v) because it "+
-				"would exceed the max block size; cur block "+
-				"size %v, cur num tx %v", tx.Hash(), txSize,
+			log.Trace(fmt.Sprintf("Skipping tx %s (package size %v) "+
+				"because it would exceed the max block size; cur "+
+				"block size %v, cur num tx %v", tx.Hash(), pkgSize,
 				blockSize, len(blockTxns)))
-			logSkippedDeps(tx, deps)
 			continue
 		}
 
 		// Enforce maximum signature operation cost per block.  Also
 		// check for overflow.
-		sigOpCost := blockchain.CountSigOps(tx)
-		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
-			blockSigOpCost+int64(sigOpCost) > blockchain.MaxSigOpsPerBlock {
+		if blockSigOpCost+pkgSigOpCost < blockSigOpCost ||
+			blockSigOpCost+pkgSigOpCost > blockchain.MaxSigOpsPerBlock {
 			log.Trace(fmt.Sprintf("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash()))
-			logSkippedDeps(tx, deps)
 			continue
 		}
 
 		// Skip free transactions once the block is larger than the
-		// minimum block size.
+		// minimum block size.  A descendant paying enough can still
+		// include them later.
+		pkgFeePerKB := weirandItem.packageFeePerKB()
 		if sortedByFee &&
-			weirandItem.feePerKB < int64(policy.TxMinFreeFee) &&
+			pkgFeePerKB < int64(policy.TxMinFreeFee) &&
 			(blockPlusTxSize >= policy.BlockMinSize) {
-			log.Trace(fmt.Sprintf("Skipping tx %s with feePerKB %.2d "+
-				"< TxMinFreeFee %d and block size %d >= "+
-				"minBlockSize %d", tx.Hash(), weirandItem.feePerKB,
+			log.Trace(fmt.Sprintf("Skipping tx %s with package feePerKB "+
+				"%.2d < TxMinFreeFee %d and block size %d >= "+
+				"minBlockSize %d", tx.Hash(), pkgFeePerKB,
 				policy.TxMinFreeFee, blockPlusTxSize,
 				policy.BlockMinSize))
-			logSkippedDeps(tx, deps)
 			continue
 		}
 
-		// Ensure the transaction inputs pass all of the necessary
-		// preconditions before allowing it to be added to the block.
-		_, err = blockManager.GetChain().CheckTransactionInputs(tx, blockUtxos)
-		if err != nil {
-			log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
-				"CheckTransactionInputs: %v", tx.Hash(), err))
-			logSkippedDeps(tx, deps)
-			continue
-		}
-		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
-			scriptFlags, sigCache)
-		if err != nil {
-			log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
-				"ValidateTransactionScripts: %v", tx.Hash(), err))
-			logSkippedDeps(tx, deps)
-			continue
-		}
+		for _, item := range pkg {
+			itemTx := item.tx
+			itemHash := *itemTx.Hash()
+
+			// Ensure the transaction inputs pass all of the necessary
+			// preconditions before allowing it to be added to the
+			// block.  A transaction failing them can't be included
+			// with any of its descendants.
+			_, err = blockManager.GetChain().CheckTransactionInputs(itemTx, blockUtxos)
+			if err == nil {
+				err = blockchain.ValidateTransactionScripts(itemTx,
+					blockUtxos, scriptFlags, sigCache)
+			}
+			if err != nil {
+				log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
+					"input validation: %v", itemTx.Hash(), err))
+				delete(candidates, itemHash)
+				weightedRandQueue.Remove(item)
+				logSkippedDeps(itemTx, dependers[itemHash])
+				break
+			}
 
-		// Spend the transaction inputs in the block utxo view and add
-		// an entry for it to ensure any transactions which reference
-		// this one have it available as an input and can ensure they
-		// aren't double spending.
-		err = spendTransaction(blockUtxos, tx, &hash.ZeroHash)
-		if err != nil {
-			log.Warn(fmt.Sprintf("Unable to spend transaction %v in the preliminary "+
-				"UTXO view for the block template: %v",
-				tx.Hash(), err))
-		}
-		// Add the transaction to the block, increment counters, and
-		// save the fees and signature operation counts to the block
-		// template.
-		blockTxns = append(blockTxns, tx)
-		blockSize += txSize
-		blockSigOpCost += int64(sigOpCost)
-		totalFees += weirandItem.fee
-		txFees = append(txFees, weirandItem.fee)
-		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
-
-		log.Trace(fmt.Sprintf("Adding tx %s (priority %.2f, feePerKB %.2d)",
-			weirandItem.tx.Hash(), weirandItem.priority, weirandItem.feePerKB))
-
-		// Add transactions which depend on this one (and also do not
-		// have any other unsatisified dependencies) to the priority
-		// queue.
-		for _, item := range deps {
-			// Add the transaction to the priority queue if there
-			// are no more dependencies after this one.
-			delete(item.dependsOn, *tx.Hash())
-			if len(item.dependsOn) == 0 {
-				weightedRandQueue.Push(item)
+			// Spend the transaction inputs in the block utxo view and
+			// add an entry for it to ensure any transactions which
+			// reference this one have it available as an input and
+			// can ensure they aren't double spending.
+			err = spendTransaction(blockUtxos, itemTx, &hash.ZeroHash)
+			if err != nil {
+				log.Warn(fmt.Sprintf("Unable to spend transaction %v in the preliminary "+
+					"UTXO view for the block template: %v",
+					itemTx.Hash(), err))
+			}
+			// Add the transaction to the block, increment counters,
+			// and save the fees and signature operation counts to the
+			// block template.
+			sigOpCost := int64(blockchain.CountSigOps(itemTx))
+			blockTxns = append(blockTxns, itemTx)
+			blockSize += uint32(item.size)
+			blockSigOpCost += sigOpCost
+			totalFees += item.fee
+			txFees = append(txFees, item.fee)
+			txSigOpCosts = append(txSigOpCosts, sigOpCost)
+
+			log.Trace(fmt.Sprintf("Adding tx %s (priority %.2f, feePerKB %.2d)",
+				itemTx.Hash(), item.priority, item.feePerKB))
+
+			// An ancestor added with the package is no longer queued,
+			// and the transactions which depend on this one don't
+			// need to pay for it anymore.
+			if item != weirandItem {
+				weightedRandQueue.Remove(item)
+			}
+			for _, dep := range dependers[itemHash] {
+				delete(dep.dependsOn, itemHash)
+			}
+			for _, desc := range packageDescendants(itemTx, dependers) {
+				desc.ancestorFee -= item.fee
+				desc.ancestorSize -= item.size
 			}
 		}
 	}
@@ -419,8 +460,12 @@ mempoolLoop:
 		return nil, miningRuleError(ErrGettingDifficulty, err.Error())
 	}
 
-	// Choose the block version to generate based on the network.
-	blockVersion := BlockVersion(params.Net)
+	// Choose the block version to generate based on the network and signal
+	// the deployments being voted on.
+	blockVersion, err := blockManager.GetChain().CalcNextBlockVersion()
+	if err != nil {
+		return nil, miningRuleError(ErrGettingBlockVersion, err.Error())
+	}
 
 	// Create a new block ready to be solved.
 	merkles := merkle.BuildMerkleTreeStore(blockTxns, false)
@@ -448,7 +493,7 @@ mempoolLoop:
 		Version:    blockVersion,
 		ParentRoot: *paMerkles[len(paMerkles)-1],
 		TxRoot:     *merkles[len(merkles)-1],
-		StateRoot:  hash.Hash{}, //TODO, state root
+		StateRoot:  hash.Hash{}, // Calculated below
 		Timestamp:  ts,
 		Difficulty: reqDiff,
 		Pow:        pow.GetInstance(powType, 0, []byte{}),
@@ -465,6 +510,14 @@ mempoolLoop:
 		}
 	}
 
+	// Commit to the utxo set as of the main parent.  The root only depends
+	// on the parents, so it stays valid while the block is being solved.
+	stateRoot, err := blockManager.GetChain().CalcStateRoot(parents)
+	if err != nil {
+		return nil, miningRuleError(ErrCheckConnectBlock, err.Error())
+	}
+	block.Header.StateRoot = stateRoot
+
 	sblock := types.NewBlock(&block)
 	sblock.SetOrder(nextBlockOrder)
 	sblock.SetHeight(uint(nextBlockHeight))
@@ -548,6 +601,57 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 	}
 }
 
+// packageAncestors returns the ancestors of the passed transaction in the source
+// pool which are not in the block yet, ordered so that every transaction comes
+// after its own ancestors.  It returns false when one of the ancestors is not
+// among the candidates of the block.
+func packageAncestors(item *WeightedRandTx,
+	candidates map[hash.Hash]*WeightedRandTx) ([]*WeightedRandTx, bool) {
+
+	var ancestors []*WeightedRandTx
+	visited := make(map[hash.Hash]struct{})
+	var visit func(item *WeightedRandTx) bool
+	visit = func(item *WeightedRandTx) bool {
+		for parentHash := range item.dependsOn {
+			if _, ok := visited[parentHash]; ok {
+				continue
+			}
+			visited[parentHash] = struct{}{}
+			parent, ok := candidates[parentHash]
+			if !ok || !visit(parent) {
+				return false
+			}
+			ancestors = append(ancestors, parent)
+		}
+		return true
+	}
+	if !visit(item) {
+		return nil, false
+	}
+	return ancestors, true
+}
+
+// packageDescendants returns the transactions which depend on the passed one,
+// directly or through other transactions of the source pool.
+func packageDescendants(tx *types.Tx,
+	dependers map[hash.Hash]map[hash.Hash]*WeightedRandTx) map[hash.Hash]*WeightedRandTx {
+
+	descendants := make(map[hash.Hash]*WeightedRandTx)
+	queue := []*types.Tx{tx}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for depHash, dep := range dependers[*next.Hash()] {
+			if _, ok := descendants[depHash]; ok {
+				continue
+			}
+			descendants[depHash] = dep
+			queue = append(queue, dep.tx)
+		}
+	}
+	return descendants
+}
+
 // TODO, move the log logic
 // logSkippedDeps logs any dependencies which are also skipped as a result of
 // skipping a transaction while generating a block template at the trace level.
@@ -11,16 +11,34 @@ import (
 type WeightedRandTx struct {
 	tx       *types.Tx
 	fee      int64
+	size     int64
 	priority float64
 	feePerKB int64
 
 	dependsOn map[hash.Hash]struct{}
+
+	// ancestorFee and ancestorSize are the total fee and size of the
+	// unconfirmed ancestors of the transaction which are not in the block
+	// yet.  The transaction is selected together with them, so a child
+	// paying a high fee can pull its low fee parents into the block.
+	ancestorFee  int64
+	ancestorSize int64
 }
 
-// The Queue for weighted rand tx
+// packageFeePerKB returns the fee per kilobyte of the transaction together
+// with its ancestors which are not in the block yet.
+func (tx *WeightedRandTx) packageFeePerKB() int64 {
+	size := tx.size + tx.ancestorSize
+	if size <= 0 {
+		return 0
+	}
+	return (tx.fee + tx.ancestorFee) * 1000 / size
+}
+
+// The Queue for weighted rand tx, the transactions are weighted by the fee
+// rate of their ancestor package.
 type WeightedRandQueue struct {
-	totalFee int64
-	items    []*WeightedRandTx
+	items []*WeightedRandTx
 }
 
 // The length of WeightedRandQueue
@@ -31,31 +49,46 @@ func (wq *WeightedRandQueue) Len() int {
 // Push item to WeightedRandQueue
 func (wq *WeightedRandQueue) Push(tx *WeightedRandTx) {
 	wq.items = append(wq.items, tx)
-	wq.totalFee += tx.fee + 1
 }
 
-// Pop item from WeightedRandQueue
+// Pop item from WeightedRandQueue.  The weights are computed when popping
+// since the package fee rates change as ancestors are added to the block.
 func (wq *WeightedRandQueue) Pop() *WeightedRandTx {
 	if wq.Len() <= 0 {
 		return nil
 	}
-	factor := rand.Int63n(wq.totalFee)
+	totalWeight := int64(0)
+	for _, item := range wq.items {
+		totalWeight += item.packageFeePerKB() + 1
+	}
+	factor := rand.Int63n(totalWeight)
 
 	total := int64(0)
 	index := int(0)
 	var item *WeightedRandTx
 	for index, item = range wq.items {
-		total += item.fee
-		if total >= factor {
+		total += item.packageFeePerKB() + 1
+		if total > factor {
 			break
 		}
 	}
 	wq.items = append(wq.items[:index], wq.items[index+1:]...)
-	total = total - item.fee - 1
 
 	return item
 }
 
+// Remove item from WeightedRandQueue, it returns false if the item was not
+// queued.
+func (wq *WeightedRandQueue) Remove(tx *WeightedRandTx) bool {
+	for index, item := range wq.items {
+		if item == tx {
+			wq.items = append(wq.items[:index], wq.items[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // Build WeightedRandQueue
 func newWeightedRandQueue(reserve int) *WeightedRandQueue {
 	rand.Seed(time.Now().Unix())
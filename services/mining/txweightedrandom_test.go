@@ -2,6 +2,7 @@ package mining
 
 import (
 	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"testing"
 )
 
@@ -9,7 +10,7 @@ func Test_TXWeightedRandom(t *testing.T) {
 	const reserve = 10
 	itemQueue := newWeightedRandQueue(reserve)
 	for i := 0; i < reserve; i++ {
-		item := &WeightedRandTx{fee: int64(i)}
+		item := &WeightedRandTx{fee: int64(i), size: 1000}
 		itemQueue.Push(item)
 	}
 
@@ -18,3 +19,41 @@ func Test_TXWeightedRandom(t *testing.T) {
 		fmt.Println(item.fee)
 	}
 }
+
+func TestWeightedRandPackage(t *testing.T) {
+	// A free parent is only worth mining together with its child.
+	parent := &WeightedRandTx{fee: 0, size: 1000}
+	child := &WeightedRandTx{
+		fee:          3000,
+		size:         500,
+		ancestorFee:  parent.fee,
+		ancestorSize: parent.size,
+		dependsOn:    map[hash.Hash]struct{}{{1}: {}},
+	}
+	if feePerKB := parent.packageFeePerKB(); feePerKB != 0 {
+		t.Fatalf("parent package fee rate %d", feePerKB)
+	}
+	if feePerKB := child.packageFeePerKB(); feePerKB != 2000 {
+		t.Fatalf("child package fee rate %d", feePerKB)
+	}
+
+	candidates := map[hash.Hash]*WeightedRandTx{{1}: parent, {2}: child}
+	ancestors, ok := packageAncestors(child, candidates)
+	if !ok || len(ancestors) != 1 || ancestors[0] != parent {
+		t.Fatalf("child ancestors %v %v", ancestors, ok)
+	}
+	delete(candidates, hash.Hash{1})
+	if _, ok := packageAncestors(child, candidates); ok {
+		t.Fatalf("child package without its parent")
+	}
+
+	queue := newWeightedRandQueue(2)
+	queue.Push(parent)
+	queue.Push(child)
+	if !queue.Remove(parent) || queue.Remove(parent) {
+		t.Fatalf("unexpected removal")
+	}
+	if item := queue.Pop(); item != child || queue.Len() != 0 {
+		t.Fatalf("unexpected pop")
+	}
+}
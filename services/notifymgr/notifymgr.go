@@ -1,9 +1,11 @@
 package notifymgr
 
 import (
+	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/p2p/peerserver"
+	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
 )
 
@@ -12,6 +14,36 @@ import (
 type NotifyMgr struct {
 	Server    *peerserver.PeerServer
 	RpcServer *rpc.RpcServer
+	Params    *params.Params
+
+	// LongPoll is notified of the events which make the block templates of
+	// the getblocktemplate long poll clients stale.
+	LongPoll LongPollNotifier
+
+	// ws notifies the subscriptions of the websocket clients.
+	ws wsNotifier
+}
+
+// LongPollNotifier is notified of the events which make the block templates of
+// the getblocktemplate long poll clients stale.
+type LongPollNotifier interface {
+	// NotifyBlockConnected is called when a block was connected to the DAG.
+	NotifyBlockConnected()
+
+	// NotifyMempoolTx is called when transactions were added to the
+	// mempool.
+	NotifyMempoolTx()
+}
+
+// APIs returns the subscriptions offered to the websocket clients.
+func (ntmgr *NotifyMgr) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			NameSpace: rpc.DefaultServiceNameSpace,
+			Service:   NewPublicNotifyAPI(ntmgr),
+			Public:    true,
+		},
+	}
 }
 
 // AnnounceNewTransactions generates and relays inventory vectors and notifies
@@ -29,16 +61,16 @@ func (ntmgr *NotifyMgr) AnnounceNewTransactions(newTxs []*types.TxDesc) {
 		ntmgr.RelayInventory(iv, tx)
 		// reply to rpc
 		if ntmgr.RpcServer != nil {
-			//TODO reply to rpc layer (if websockect long connection or gbt long poll)
 			// Notify websocket clients about mempool transactions.
-			//qitmeer.node.rpcServer.ntfnMgr.NotifyMempoolTx(tx, true)
-			//
-			// Potentially notify any getblocktemplate long poll clients
-			// about stale block templates due to the new transaction.
-			//qitmeer.node.rpcServer.gbtWorkState.NotifyMempoolTx(
-			//	qitmeer.txMemPool.LastUpdated())
+			ntmgr.ws.notifyMempoolTx(tx, ntmgr.Params)
 		}
 	}
+
+	// Potentially notify any getblocktemplate long poll clients about stale
+	// block templates due to the new transactions.
+	if ntmgr.RpcServer != nil && ntmgr.LongPoll != nil && len(newTxs) > 0 {
+		ntmgr.LongPoll.NotifyMempoolTx()
+	}
 }
 
 // RelayInventory relays the passed inventory vector to all connected peers
@@ -50,3 +82,22 @@ func (ntmgr *NotifyMgr) RelayInventory(invVect *message.InvVect, data interface{
 func (ntmgr *NotifyMgr) BroadcastMessage(msg message.Message) {
 	ntmgr.Server.BroadcastMessage(msg)
 }
+
+// NotifyBlockConnected notifies the websocket and getblocktemplate long poll
+// clients of a block connected to the DAG.
+func (ntmgr *NotifyMgr) NotifyBlockConnected(block *types.SerializedBlock) {
+	if ntmgr.RpcServer != nil {
+		ntmgr.ws.notifyBlockConnected(block, ntmgr.Params)
+		if ntmgr.LongPoll != nil {
+			ntmgr.LongPoll.NotifyBlockConnected()
+		}
+	}
+}
+
+// NotifyReorganization notifies the websocket clients of the new orders of the
+// blocks after a reorganization of the DAG.
+func (ntmgr *NotifyMgr) NotifyReorganization(rd *blockchain.ReorganizationNotifyData) {
+	if ntmgr.RpcServer != nil {
+		ntmgr.ws.notifyReorganization(rd)
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package notifymgr
+
+import (
+	"context"
+	"github.com/Qitmeer/qitmeer/common/marshal"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/rpc"
+	"sync"
+)
+
+// maxQueuedNotifications is the number of notifications queued for a
+// subscription.  Notifications are dropped while the queue of a slow client
+// is full.
+const maxQueuedNotifications = 256
+
+// subscriptionKind identifies the notifications a subscription receives.
+type subscriptionKind int
+
+const (
+	subNewBlocks subscriptionKind = iota
+	subReorganizations
+	subNewTransactions
+	subAddressTransactions
+)
+
+// wsSubscription is a subscription of a websocket client.
+type wsSubscription struct {
+	kind     subscriptionKind
+	sub      *rpc.Subscription
+	notifier *rpc.Notifier
+	queue    chan interface{}
+
+	// verbose includes the serialized transaction in the notifications of
+	// new transactions.
+	verbose bool
+
+	// addrs are the encoded addresses an address subscription watches and
+	// unspent the outputs paying to them, so the transactions spending
+	// them are notified too.  Both are protected by the mutex of the
+	// notifier.
+	addrs   map[string]struct{}
+	unspent map[types.TxOutPoint]struct{}
+}
+
+// wsNotifier dispatches the chain and mempool events to the subscriptions of
+// the websocket clients.  The zero value is ready to use.
+type wsNotifier struct {
+	mtx  sync.Mutex
+	subs map[*wsSubscription]struct{}
+}
+
+// subscribe creates a subscription of the passed kind for the websocket client
+// of the context and starts delivering its notifications.
+func (n *wsNotifier) subscribe(ctx context.Context, s *wsSubscription) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	s.notifier = notifier
+	s.sub = notifier.CreateSubscription()
+	s.queue = make(chan interface{}, maxQueuedNotifications)
+
+	n.mtx.Lock()
+	if n.subs == nil {
+		n.subs = make(map[*wsSubscription]struct{})
+	}
+	n.subs[s] = struct{}{}
+	n.mtx.Unlock()
+
+	go n.deliver(s)
+	return s.sub, nil
+}
+
+// deliver writes the queued notifications of a subscription to its client
+// until the client unsubscribes or disconnects.
+//
+// This must be run as a goroutine.
+func (n *wsNotifier) deliver(s *wsSubscription) {
+	defer func() {
+		n.mtx.Lock()
+		delete(n.subs, s)
+		n.mtx.Unlock()
+	}()
+	for {
+		select {
+		case ntfn := <-s.queue:
+			if err := s.notifier.Notify(s.sub.ID, ntfn); err != nil {
+				log.Debug("Failed to send notification", "id",
+					s.sub.ID, "error", err)
+				return
+			}
+		case <-s.sub.Err():
+			return
+		case <-s.notifier.Closed():
+			return
+		}
+	}
+}
+
+// enqueue queues a notification of the passed subscription without blocking.
+//
+// This function MUST be called with the notifier lock held.
+func (s *wsSubscription) enqueue(ntfn interface{}) {
+	select {
+	case s.queue <- ntfn:
+	default:
+		log.Warn("Dropped notification of slow websocket client", "id",
+			s.sub.ID)
+	}
+}
+
+// notifyBlockConnected notifies the subscriptions of a connected block.
+func (n *wsNotifier) notifyBlockConnected(block *types.SerializedBlock, par *params.Params) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	var ntfn interface{}
+	for s := range n.subs {
+		switch s.kind {
+		case subNewBlocks:
+			if ntfn == nil {
+				ntfn = json.OrderedResult{
+					{Key: "hash", Val: block.Hash().String()},
+					{Key: "order", Val: block.Order()},
+					{Key: "height", Val: block.Height()},
+					{Key: "timestamp", Val: block.Block().Header.Timestamp.Unix()},
+					{Key: "txs", Val: len(block.Transactions())},
+				}
+			}
+			s.enqueue(ntfn)
+
+		case subAddressTransactions:
+			for _, tx := range block.Transactions() {
+				if s.matchTx(tx.Tx, par, true) {
+					s.enqueue(addressTxNotification(tx, block))
+				}
+			}
+		}
+	}
+}
+
+// notifyReorganization notifies the subscriptions of the new orders of the
+// blocks after a reorganization.
+func (n *wsNotifier) notifyReorganization(rd *blockchain.ReorganizationNotifyData) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	var ntfn interface{}
+	for s := range n.subs {
+		if s.kind != subReorganizations {
+			continue
+		}
+		if ntfn == nil {
+			blocks := make([]json.OrderedResult, 0, len(rd.Blocks))
+			for _, b := range rd.Blocks {
+				blocks = append(blocks, json.OrderedResult{
+					{Key: "hash", Val: b.Hash.String()},
+					{Key: "order", Val: b.Order},
+				})
+			}
+			ntfn = json.OrderedResult{
+				{Key: "oldtip", Val: rd.OldHash.String()},
+				{Key: "oldheight", Val: rd.OldHeight},
+				{Key: "newtip", Val: rd.NewHash.String()},
+				{Key: "newheight", Val: rd.NewHeight},
+				{Key: "blocks", Val: blocks},
+			}
+		}
+		s.enqueue(ntfn)
+	}
+}
+
+// notifyMempoolTx notifies the subscriptions of a transaction accepted to the
+// mempool.
+func (n *wsNotifier) notifyMempoolTx(txDesc *types.TxDesc, par *params.Params) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	tx := txDesc.Tx
+	for s := range n.subs {
+		switch s.kind {
+		case subNewTransactions:
+			ntfn := json.OrderedResult{
+				{Key: "txid", Val: tx.Hash().String()},
+				{Key: "fee", Val: txDesc.Fee},
+				{Key: "size", Val: tx.Tx.SerializeSize()},
+			}
+			if s.verbose {
+				ntfn = append(ntfn, json.KV{Key: "hex", Val: txHex(tx)})
+			}
+			s.enqueue(ntfn)
+
+		case subAddressTransactions:
+			if s.matchTx(tx.Tx, par, false) {
+				s.enqueue(addressTxNotification(tx, nil))
+			}
+		}
+	}
+}
+
+// matchTx returns whether the passed transaction pays to one of the addresses
+// of the subscription or spends an output paying to one.  The outputs paying
+// to the addresses are remembered, and forgotten again once they are spent by
+// a connected block.
+//
+// This function MUST be called with the notifier lock held.
+func (s *wsSubscription) matchTx(tx *types.Transaction, par *params.Params, connected bool) bool {
+	matched := false
+	for _, txIn := range tx.TxIn {
+		if _, ok := s.unspent[txIn.PreviousOut]; ok {
+			matched = true
+			if connected {
+				delete(s.unspent, txIn.PreviousOut)
+			}
+		}
+	}
+	txHash := tx.TxHash()
+	for i, txOut := range tx.TxOut {
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, par)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if _, ok := s.addrs[addr.Encode()]; ok {
+				matched = true
+				s.unspent[*types.NewOutPoint(&txHash, uint32(i))] = struct{}{}
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// addressTxNotification returns the notification of a transaction matching an
+// address subscription.  The block is nil for mempool transactions.
+func addressTxNotification(tx *types.Tx, block *types.SerializedBlock) json.OrderedResult {
+	blockHash := ""
+	if block != nil {
+		blockHash = block.Hash().String()
+	}
+	return json.OrderedResult{
+		{Key: "txid", Val: tx.Hash().String()},
+		{Key: "blockhash", Val: blockHash},
+		{Key: "hex", Val: txHex(tx)},
+	}
+}
+
+// txHex returns the hex encoding of the serialized transaction.
+func txHex(tx *types.Tx) string {
+	hex, err := marshal.MessageToHex(&message.MsgTx{Tx: tx.Tx})
+	if err != nil {
+		log.Error("Failed to serialize transaction", "txid", tx.Hash(),
+			"error", err)
+	}
+	return hex
+}
+
+// PublicNotifyAPI provides the subscriptions of the websocket clients.  The
+// subscriptions are created with the qitmeer_subscribe method, whose first
+// parameter is the name of the subscription, and cancelled with
+// qitmeer_unsubscribe.
+type PublicNotifyAPI struct {
+	ntmgr *NotifyMgr
+}
+
+func NewPublicNotifyAPI(ntmgr *NotifyMgr) *PublicNotifyAPI {
+	return &PublicNotifyAPI{ntmgr}
+}
+
+// NewBlocks notifies the blocks connected to the DAG.
+func (api *PublicNotifyAPI) NewBlocks(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.ws.subscribe(ctx, &wsSubscription{kind: subNewBlocks})
+}
+
+// Reorganizations notifies the new orders of the blocks after the DAG has
+// been reorganized.
+func (api *PublicNotifyAPI) Reorganizations(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.ws.subscribe(ctx, &wsSubscription{kind: subReorganizations})
+}
+
+// NewTransactions notifies the transactions accepted to the mempool.  The
+// serialized transactions are included when verbose is set.
+func (api *PublicNotifyAPI) NewTransactions(ctx context.Context, verbose *bool) (*rpc.Subscription, error) {
+	return api.ntmgr.ws.subscribe(ctx, &wsSubscription{
+		kind:    subNewTransactions,
+		verbose: verbose != nil && *verbose,
+	})
+}
+
+// AddressTransactions notifies the mempool and block transactions paying to
+// one of the passed addresses or spending an output paying to one notified
+// before.
+func (api *PublicNotifyAPI) AddressTransactions(ctx context.Context, addresses []string) (*rpc.Subscription, error) {
+	if len(addresses) == 0 {
+		return nil, rpc.RpcInvalidError("No addresses")
+	}
+	addrs := make(map[string]struct{}, len(addresses))
+	for _, encoded := range addresses {
+		addr, err := address.DecodeAddress(encoded)
+		if err != nil {
+			return nil, rpc.RpcAddressKeyError("Could not decode "+
+				"address: %v", err)
+		}
+		if !address.IsForNetwork(addr, api.ntmgr.Params) {
+			return nil, rpc.RpcAddressKeyError("Wrong network: %v",
+				encoded)
+		}
+		addrs[addr.Encode()] = struct{}{}
+	}
+	return api.ntmgr.ws.subscribe(ctx, &wsSubscription{
+		kind:    subAddressTransactions,
+		addrs:   addrs,
+		unspent: make(map[types.TxOutPoint]struct{}),
+	})
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2017-2018 The qitmeer developers
+
+package notifymgr
+
+import (
+	"encoding/base64"
+	ejson "encoding/json"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/rpc"
+	"golang.org/x/net/websocket"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testAddress returns a pay to pubkey hash address of the private network and
+// its script.
+func testAddress(t *testing.T, b byte) (types.Address, []byte) {
+	pkHash := make([]byte, 20)
+	pkHash[0] = b
+	addr, err := address.NewPubKeyHashAddress(pkHash, &params.PrivNetParams,
+		ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr, pkScript
+}
+
+// newTestTx returns a transaction spending the passed outputs to the passed
+// scripts.
+func newTestTx(spends []*types.TxOutPoint, pkScripts ...[]byte) *types.Tx {
+	tx := types.NewTransaction()
+	for _, spend := range spends {
+		tx.AddTxIn(types.NewTxInput(spend, nil))
+	}
+	for i, pkScript := range pkScripts {
+		tx.AddTxOut(types.NewTxOutput(uint64(i+1), pkScript))
+	}
+	return types.NewTx(tx)
+}
+
+// newTestBlock returns a block of the passed transactions.
+func newTestBlock(t *testing.T, txs ...*types.Tx) *types.SerializedBlock {
+	block := types.Block{Header: types.BlockHeader{
+		Pow: pow.GetInstance(pow.QITMEERKECCAK256, 0, []byte{}),
+	}}
+	for _, tx := range txs {
+		if err := block.AddTransaction(tx.Tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return types.NewBlock(&block)
+}
+
+// addTestSubscription adds a subscription to the notifier without a client,
+// its notifications stay queued.
+func addTestSubscription(n *wsNotifier, s *wsSubscription) *wsSubscription {
+	s.sub = &rpc.Subscription{ID: rpc.NewID()}
+	s.queue = make(chan interface{}, maxQueuedNotifications)
+	n.mtx.Lock()
+	if n.subs == nil {
+		n.subs = make(map[*wsSubscription]struct{})
+	}
+	n.subs[s] = struct{}{}
+	n.mtx.Unlock()
+	return s
+}
+
+// queuedTxs returns the txids and block hashes of the queued address
+// notifications.
+func queuedTxs(s *wsSubscription) []string {
+	var result []string
+	for {
+		select {
+		case ntfn := <-s.queue:
+			r := ntfn.(json.OrderedResult)
+			result = append(result, r[0].Val.(string)+"@"+r[1].Val.(string))
+		default:
+			return result
+		}
+	}
+}
+
+func Test_AddressTxMatch(t *testing.T) {
+	par := &params.PrivNetParams
+	addrA, scriptA := testAddress(t, 1)
+	_, scriptB := testAddress(t, 2)
+	_, scriptC := testAddress(t, 3)
+
+	var n wsNotifier
+	s := addTestSubscription(&n, &wsSubscription{
+		kind:    subAddressTransactions,
+		addrs:   map[string]struct{}{addrA.Encode(): {}},
+		unspent: make(map[types.TxOutPoint]struct{}),
+	})
+	other := addTestSubscription(&n, &wsSubscription{kind: subNewBlocks})
+
+	// The payment to A is notified and its output watched.
+	pay := newTestTx(nil, scriptB, scriptA)
+	payToA := types.NewOutPoint(pay.Hash(), 1)
+	payToB := types.NewOutPoint(pay.Hash(), 0)
+	n.notifyMempoolTx(&types.TxDesc{Tx: pay}, par)
+	unrelated := newTestTx(nil, scriptB)
+	n.notifyMempoolTx(&types.TxDesc{Tx: unrelated}, par)
+	if got := queuedTxs(s); len(got) != 1 || got[0] != pay.Hash().String()+"@" {
+		t.Fatalf("mempool notifications %v", got)
+	}
+	if _, ok := s.unspent[*payToA]; !ok || len(s.unspent) != 1 {
+		t.Fatalf("watched outputs %v", s.unspent)
+	}
+
+	// The spend of the watched output is notified, from the mempool and
+	// from the block, and the output is forgotten once connected.
+	spendA := newTestTx([]*types.TxOutPoint{payToA}, scriptC)
+	spendB := newTestTx([]*types.TxOutPoint{payToB}, scriptC)
+	n.notifyMempoolTx(&types.TxDesc{Tx: spendA}, par)
+	n.notifyMempoolTx(&types.TxDesc{Tx: spendB}, par)
+	if got := queuedTxs(s); len(got) != 1 || got[0] != spendA.Hash().String()+"@" {
+		t.Fatalf("mempool spend notifications %v", got)
+	}
+	block := newTestBlock(t, pay, spendA, spendB, unrelated)
+	n.notifyBlockConnected(block, par)
+	want := []string{pay.Hash().String() + "@" + block.Hash().String(),
+		spendA.Hash().String() + "@" + block.Hash().String()}
+	if got := queuedTxs(s); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("block notifications %v, want %v", got, want)
+	}
+	if len(s.unspent) != 0 {
+		t.Fatalf("spent outputs still watched: %v", s.unspent)
+	}
+	if len(other.queue) != 1 {
+		t.Fatalf("%d block notifications, want 1", len(other.queue))
+	}
+
+	// A spend of a forgotten output isn't notified any more.
+	n.notifyBlockConnected(newTestBlock(t, spendA), par)
+	if got := queuedTxs(s); len(got) != 0 {
+		t.Fatalf("spend of a forgotten output notified: %v", got)
+	}
+}
+
+func Test_SlowClientDropped(t *testing.T) {
+	par := &params.PrivNetParams
+	var n wsNotifier
+	slow := addTestSubscription(&n, &wsSubscription{kind: subNewTransactions})
+	verbose := addTestSubscription(&n, &wsSubscription{
+		kind:    subNewTransactions,
+		verbose: true,
+	})
+
+	// The notifications of a full queue are dropped without blocking the
+	// other subscriptions.
+	_, script := testAddress(t, 1)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < maxQueuedNotifications+10; i++ {
+			n.notifyMempoolTx(&types.TxDesc{Tx: newTestTx(nil, script)}, par)
+			if i < maxQueuedNotifications {
+				<-verbose.queue
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifications blocked by a slow client")
+	}
+	if len(slow.queue) != maxQueuedNotifications {
+		t.Fatalf("%d queued notifications, want %d", len(slow.queue),
+			maxQueuedNotifications)
+	}
+	if len(verbose.queue) != 10 {
+		t.Fatalf("%d queued notifications, want 10", len(verbose.queue))
+	}
+	ntfn := (<-verbose.queue).(json.OrderedResult)
+	if len(ntfn) != 4 || ntfn[3].Key != "hex" || ntfn[3].Val == "" {
+		t.Fatalf("verbose notification %v", ntfn)
+	}
+	if ntfn := (<-slow.queue).(json.OrderedResult); len(ntfn) != 3 {
+		t.Fatalf("notification %v", ntfn)
+	}
+}
+
+// wsTestClient is a websocket client whose messages are received in the
+// background.
+type wsTestClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	msgs chan map[string]ejson.RawMessage
+}
+
+func dialTestClient(t *testing.T, addr string) *wsTestClient {
+	cfg, err := websocket.NewConfig("ws://"+addr+"/ws", "http://"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Header.Set("Authorization", "Basic "+
+		base64.StdEncoding.EncodeToString([]byte("user:pass")))
+	conn, err := websocket.DialConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &wsTestClient{t: t, conn: conn, msgs: make(chan map[string]ejson.RawMessage, 100)}
+	go func() {
+		for {
+			var msg map[string]ejson.RawMessage
+			if err := websocket.JSON.Receive(conn, &msg); err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+// receive returns the next message, or nil when none comes within the
+// timeout.
+func (c *wsTestClient) receive(timeout time.Duration) map[string]ejson.RawMessage {
+	select {
+	case msg := <-c.msgs:
+		return msg
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// call sends a request and returns its response, the notifications received
+// meanwhile are skipped.
+func (c *wsTestClient) call(id int, method string, params ...interface{}) map[string]ejson.RawMessage {
+	c.t.Helper()
+	err := websocket.JSON.Send(c.conn, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.receive(5 * time.Second)
+		if msg == nil {
+			c.t.Fatalf("no response to %s", method)
+		}
+		if string(msg["id"]) == strconv.Itoa(id) {
+			return msg
+		}
+	}
+}
+
+// waitSubscriptions waits until the notifier has the passed number of
+// subscriptions.
+func waitSubscriptions(t *testing.T, n *wsNotifier, count int) {
+	t.Helper()
+	for i := 0; ; i++ {
+		n.mtx.Lock()
+		l := len(n.subs)
+		n.mtx.Unlock()
+		if l == count {
+			return
+		}
+		if i > 1000 {
+			t.Fatalf("%d subscriptions, want %d", l, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_WebsocketSubscriptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server, err := rpc.NewRPCServer(&config.Config{
+		RPCUser:          "user",
+		RPCPass:          "pass",
+		RPCMaxWebsockets: 10,
+		DisableTLS:       true,
+		RPCListeners:     []string{addr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntmgr := &NotifyMgr{RpcServer: server, Params: &params.PrivNetParams}
+	for _, api := range ntmgr.APIs() {
+		if err := server.RegisterService(api.NameSpace, api.Service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	c := dialTestClient(t, addr)
+	defer c.conn.Close()
+
+	resp := c.call(1, "qitmeer_subscribe", "addressTransactions", []string{"bad"})
+	if resp["error"] == nil {
+		t.Fatal("subscribed to a bad address")
+	}
+	resp = c.call(2, "qitmeer_subscribe", "addressTransactions", []string{})
+	if resp["error"] == nil {
+		t.Fatal("subscribed to no address")
+	}
+
+	resp = c.call(3, "qitmeer_subscribe", "newBlocks")
+	var id string
+	if resp["error"] != nil || ejson.Unmarshal(resp["result"], &id) != nil {
+		t.Fatalf("subscribe: %s", resp["error"])
+	}
+	waitSubscriptions(t, &ntmgr.ws, 1)
+
+	// The subscription is active once the client got its id, the blocks
+	// connected before are dropped.
+	block := newTestBlock(t)
+	var ntfn map[string]ejson.RawMessage
+	for i := 0; ntfn == nil; i++ {
+		if i > 100 {
+			t.Fatal("no block notification")
+		}
+		ntmgr.NotifyBlockConnected(block)
+		ntfn = c.receive(50 * time.Millisecond)
+	}
+	var params struct {
+		Subscription string `json:"subscription"`
+		Result       struct {
+			Hash string `json:"hash"`
+		} `json:"result"`
+	}
+	if err := ejson.Unmarshal(ntfn["params"], &params); err != nil ||
+		params.Subscription != id || params.Result.Hash != block.Hash().String() {
+		t.Fatalf("notification %s", ntfn["params"])
+	}
+
+	resp = c.call(4, "qitmeer_unsubscribe", id)
+	if resp["error"] != nil || string(resp["result"]) != "true" {
+		t.Fatalf("unsubscribe: %s %s", resp["result"], resp["error"])
+	}
+	waitSubscriptions(t, &ntmgr.ws, 0)
+
+	// The subscriptions of a client are removed when it disconnects.
+	c.call(5, "qitmeer_subscribe", "newTransactions")
+	c.call(6, "qitmeer_subscribe", "reorganizations")
+	waitSubscriptions(t, &ntmgr.ws, 2)
+	c.conn.Close()
+	waitSubscriptions(t, &ntmgr.ws, 0)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/psbt"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/crypto/ecc"
 	"github.com/Qitmeer/qitmeer/database"
@@ -52,6 +53,10 @@ func NewPublicTxAPI(tm *TxManager) *PublicTxAPI {
 type TransactionInput struct {
 	Txid string `json:"txid"`
 	Vout uint32 `json:"vout"`
+
+	// Sequence overrides the sequence number of the input, a sequence up
+	// to mempool.MaxRBFSequence signals the transaction is replaceable.
+	Sequence *uint32 `json:"sequence,omitempty"`
 }
 
 type Amounts map[string]uint64 //{\"address\":amount,...}
@@ -59,6 +64,226 @@ type Amounts map[string]uint64 //{\"address\":amount,...}
 func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 	amounts Amounts, lockTime *int64) (interface{}, error) {
 
+	mtx, err := api.createTransaction(types.TxTypeRegular, inputs, amounts,
+		nil, lockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the serialized and hex-encoded transaction.  Note that this
+	// is intentionally not directly returning because the first return
+	// value is a string and it would result in returning an empty string to
+	// the client instead of nothing (nil) in the case of an error.
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// AssetAmounts maps asset identifiers to the amounts of the asset paid to
+// every address. {\"assetid\":{\"address\":amount,...},...}
+type AssetAmounts map[string]Amounts
+
+// CreateAssetIssueTransaction creates an unsigned transaction issuing a new
+// asset.  The asset identifier is derived from the first input, whose
+// previous output script becomes the issuer allowed to revoke the asset.
+// The MEER amounts pay the change of the inputs.
+func (api *PublicTxAPI) CreateAssetIssueTransaction(inputs []TransactionInput,
+	amounts Amounts, assetAmounts Amounts, lockTime *int64) (interface{}, error) {
+
+	if len(inputs) == 0 {
+		return nil, rpc.RpcInvalidError("Issuing an asset requires at " +
+			"least one input")
+	}
+	if len(assetAmounts) == 0 {
+		return nil, rpc.RpcInvalidError("Issuing an asset requires at " +
+			"least one asset output")
+	}
+	// The asset identifier only depends on the first input, which is
+	// validated while the transaction is created.
+	mtx, err := api.createTransaction(types.AssetIssue, inputs, amounts,
+		nil, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	assetId := types.NewAssetId(&mtx.TxIn[0].PreviousOut)
+	err = api.addTxOutputs(mtx, assetAmounts, assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return json.OrderedResult{
+		{Key: "assetid", Val: assetId.String()},
+		{Key: "hex", Val: mtxHex},
+	}, nil
+}
+
+// CreateAssetTransferTransaction creates an unsigned transaction moving assets
+// between addresses.  The transaction has to create exactly the spent amount
+// of every asset.
+func (api *PublicTxAPI) CreateAssetTransferTransaction(inputs []TransactionInput,
+	amounts Amounts, assets AssetAmounts, lockTime *int64) (interface{}, error) {
+
+	return api.createAssetTransaction(types.AssetTransfer, inputs, amounts,
+		assets, lockTime)
+}
+
+// CreateAssetRevokeTransaction creates an unsigned transaction destroying the
+// part of the spent assets that is not paid to any address.  The first input
+// must spend an output locked by the script of the asset issuer.
+func (api *PublicTxAPI) CreateAssetRevokeTransaction(inputs []TransactionInput,
+	amounts Amounts, assets AssetAmounts, lockTime *int64) (interface{}, error) {
+
+	return api.createAssetTransaction(types.AssetRevoke, inputs, amounts,
+		assets, lockTime)
+}
+
+// createAssetTransaction creates an unsigned transfer or revoke transaction and
+// returns it hex-encoded.
+func (api *PublicTxAPI) createAssetTransaction(txType types.TxType,
+	inputs []TransactionInput, amounts Amounts, assets AssetAmounts,
+	lockTime *int64) (interface{}, error) {
+
+	assetAmounts := make(map[types.AssetId]Amounts, len(assets))
+	for assetStr, amounts := range assets {
+		assetId, err := types.NewAssetIdFromStr(assetStr)
+		if err != nil || assetId.IsMeer() {
+			return nil, rpc.RpcInvalidError("Invalid asset id: %v",
+				assetStr)
+		}
+		assetAmounts[*assetId] = amounts
+	}
+	mtx, err := api.createTransaction(txType, inputs, amounts,
+		assetAmounts, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// CreateContractCreateTransaction creates an unsigned transaction deploying
+// the hex-encoded code as a new contract.  The contract identifier is derived
+// from the first input, whose previous output script becomes the owner allowed
+// to destroy the contract.  The fee left by the inputs must pay for the gas
+// limit.
+func (api *PublicTxAPI) CreateContractCreateTransaction(inputs []TransactionInput,
+	amounts Amounts, code string, gasLimit uint64, lockTime *int64) (interface{}, error) {
+
+	if len(inputs) == 0 {
+		return nil, rpc.RpcInvalidError("Creating a contract requires at " +
+			"least one input")
+	}
+	codeBytes, err := hex.DecodeString(code)
+	if err != nil || len(codeBytes) == 0 {
+		return nil, rpc.RpcDecodeHexError(code)
+	}
+	mtx, err := api.createContractTransaction(types.ContractCreate, inputs,
+		amounts, &types.ContractPayload{GasLimit: gasLimit, Data: codeBytes},
+		lockTime)
+	if err != nil {
+		return nil, err
+	}
+	contractId := types.NewContractId(&mtx.TxIn[0].PreviousOut)
+
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return json.OrderedResult{
+		{Key: "contractid", Val: contractId.String()},
+		{Key: "hex", Val: mtxHex},
+	}, nil
+}
+
+// CreateContractCallTransaction creates an unsigned transaction calling a
+// contract with the hex-encoded input.
+func (api *PublicTxAPI) CreateContractCallTransaction(inputs []TransactionInput,
+	amounts Amounts, contract string, input string, gasLimit uint64,
+	lockTime *int64) (interface{}, error) {
+
+	contractId, err := types.NewContractIdFromStr(contract)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid contract id: %v", contract)
+	}
+	inputBytes, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, rpc.RpcDecodeHexError(input)
+	}
+	mtx, err := api.createContractTransaction(types.ContractUpdate, inputs,
+		amounts, &types.ContractPayload{GasLimit: gasLimit,
+			Contract: *contractId, Data: inputBytes}, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// CreateContractDestroyTransaction creates an unsigned transaction destroying a
+// contract along with its storage.  The first input must spend an output
+// locked by the script of the contract owner.
+func (api *PublicTxAPI) CreateContractDestroyTransaction(inputs []TransactionInput,
+	amounts Amounts, contract string, gasLimit uint64, lockTime *int64) (interface{}, error) {
+
+	contractId, err := types.NewContractIdFromStr(contract)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid contract id: %v", contract)
+	}
+	mtx, err := api.createContractTransaction(types.ContractDestroy, inputs,
+		amounts, &types.ContractPayload{GasLimit: gasLimit,
+			Contract: *contractId}, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// createContractTransaction creates an unsigned contract transaction whose
+// first output carries the passed payload.
+func (api *PublicTxAPI) createContractTransaction(txType types.TxType,
+	inputs []TransactionInput, amounts Amounts, payload *types.ContractPayload,
+	lockTime *int64) (*types.Transaction, error) {
+
+	if payload.GasLimit == 0 || payload.GasLimit > blockchain.MaxContractGasPerTx {
+		return nil, rpc.RpcInvalidError("Invalid gas limit: 0 >= %v > %v",
+			payload.GasLimit, blockchain.MaxContractGasPerTx)
+	}
+	mtx, err := api.createTransaction(txType, inputs, amounts, nil, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := blockchain.ContractPayloadScript(payload.Bytes(txType))
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Payload script")
+	}
+	mtx.TxOut = append([]*types.TxOutput{types.NewTxOutput(0, pkScript)},
+		mtx.TxOut...)
+	return mtx, nil
+}
+
+// createTransaction creates an unsigned transaction of the passed type
+// spending the inputs and paying the MEER amounts and the asset amounts.
+func (api *PublicTxAPI) createTransaction(txType types.TxType,
+	inputs []TransactionInput, amounts Amounts,
+	assetAmounts map[types.AssetId]Amounts,
+	lockTime *int64) (*types.Transaction, error) {
+
 	// Validate the locktime, if given.
 	if lockTime != nil &&
 		(*lockTime < 0 || *lockTime > int64(types.MaxTxInSequenceNum)) {
@@ -68,6 +293,7 @@ func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 	// Add all transaction inputs to a new transaction after performing
 	// some validity checks.
 	mtx := types.NewTransaction()
+	mtx.SetTxType(txType)
 	for _, input := range inputs {
 		txHash, err := hash.NewHashFromStr(input.Txid)
 		if err != nil {
@@ -78,22 +304,48 @@ func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 		if lockTime != nil && *lockTime != 0 {
 			txIn.Sequence = types.MaxTxInSequenceNum - 1
 		}
+		if input.Sequence != nil {
+			txIn.Sequence = *input.Sequence
+		}
 		mtx.AddTxIn(txIn)
 	}
 
 	// Add all transaction outputs to the transaction after performing
 	// some validity checks.
+	err := api.addTxOutputs(mtx, amounts, types.MeerAssetId)
+	if err != nil {
+		return nil, err
+	}
+	for assetId, amounts := range assetAmounts {
+		err := api.addTxOutputs(mtx, amounts, assetId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Set the Locktime, if given.
+	if lockTime != nil {
+		mtx.LockTime = uint32(*lockTime)
+	}
+	return mtx, nil
+}
+
+// addTxOutputs adds an output paying the amount of the passed asset for every
+// address of amounts to the transaction.
+func (api *PublicTxAPI) addTxOutputs(mtx *types.Transaction, amounts Amounts,
+	assetId types.AssetId) error {
+
 	for encodedAddr, amount := range amounts {
 		// Ensure amount is in the valid range for monetary amounts.
 		if amount <= 0 || amount > types.MaxAmount {
-			return nil, rpc.RpcInvalidError("Invalid amount: 0 >= %v "+
+			return rpc.RpcInvalidError("Invalid amount: 0 >= %v "+
 				"> %v", amount, types.MaxAmount)
 		}
 
 		// Decode the provided address.
 		addr, err := address.DecodeAddress(encodedAddr)
 		if err != nil {
-			return nil, rpc.RpcAddressKeyError("Could not decode "+
+			return rpc.RpcAddressKeyError("Could not decode "+
 				"address: %v", err)
 		}
 
@@ -104,38 +356,25 @@ func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 		case *address.PubKeyHashAddress:
 		case *address.ScriptHashAddress:
 		default:
-			return nil, rpc.RpcAddressKeyError("Invalid type: %T", addr)
+			return rpc.RpcAddressKeyError("Invalid type: %T", addr)
 		}
 		if !address.IsForNetwork(addr, api.txManager.bm.ChainParams()) {
-			return nil, rpc.RpcAddressKeyError("Wrong network: %v",
+			return rpc.RpcAddressKeyError("Wrong network: %v",
 				addr)
 		}
 
 		// Create a new script which pays to the provided address.
 		pkScript, err := txscript.PayToAddrScript(addr)
 		if err != nil {
-			return nil, rpc.RpcInternalError(err.Error(),
+			return rpc.RpcInternalError(err.Error(),
 				"Pay to address script")
 		}
 
 		txOut := types.NewTxOutput(amount, pkScript)
+		txOut.Asset = assetId
 		mtx.AddTxOut(txOut)
 	}
-
-	// Set the Locktime, if given.
-	if lockTime != nil {
-		mtx.LockTime = uint32(*lockTime)
-	}
-
-	// Return the serialized and hex-encoded transaction.  Note that this
-	// is intentionally not directly returning because the first return
-	// value is a string and it would result in returning an empty string to
-	// the client instead of nothing (nil) in the case of an error.
-	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
-	if err != nil {
-		return nil, err
-	}
-	return mtxHex, nil
+	return nil
 }
 
 func (api *PublicTxAPI) DecodeRawTransaction(hexTx string) (interface{}, error) {
@@ -163,6 +402,7 @@ func (api *PublicTxAPI) DecodeRawTransaction(hexTx string) (interface{}, error)
 		{Key: "txid", Val: mtx.TxHash().String()},
 		{Key: "txhash", Val: mtx.TxHashFull().String()},
 		{Key: "version", Val: int32(mtx.Version)},
+		{Key: "txtype", Val: types.DetermineTxType(&mtx).String()},
 		{Key: "locktime", Val: mtx.LockTime},
 		{Key: "timestamp", Val: mtx.Timestamp.Format(time.RFC3339)},
 		{Key: "vin", Val: marshal.MarshJsonVin(&mtx)},
@@ -890,6 +1130,193 @@ func (api *PublicTxAPI) GetRawTransactionByHash(txHash hash.Hash, verbose bool)
 	return api.GetRawTransaction(*txid, verbose)
 }
 
+// decodePsbt decodes the base64 encoding of a partially signed transaction.
+func decodePsbt(psbtStr string) (*psbt.Packet, error) {
+	p, err := psbt.B64Decode(psbtStr)
+	if err != nil {
+		return nil, rpc.RpcDeserializationError("Could not decode psbt: %v",
+			err)
+	}
+	return p, nil
+}
+
+// encodePsbt returns the base64 encoding of a partially signed transaction.
+func encodePsbt(p *psbt.Packet) (interface{}, error) {
+	encoded, err := p.B64Encode()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Encode psbt")
+	}
+	return encoded, nil
+}
+
+// CreatePsbt creates a partially signed transaction spending the passed
+// inputs, like createRawTransaction.
+func (api *PublicTxAPI) CreatePsbt(inputs []TransactionInput,
+	amounts Amounts, lockTime *int64) (interface{}, error) {
+
+	mtx, err := api.createTransaction(types.TxTypeRegular, inputs, amounts,
+		nil, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	p, err := psbt.New(mtx)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return encodePsbt(p)
+}
+
+// fetchUtxo returns the unspent output of the passed outpoint, looking up the
+// mempool before the utxo set.
+func (api *PublicTxAPI) fetchUtxo(out types.TxOutPoint) (*types.TxOutput, error) {
+	tx, err := api.txManager.txMemPool.FetchTransaction(&out.Hash)
+	if err == nil {
+		if out.OutIndex >= uint32(len(tx.Tx.TxOut)) {
+			return nil, rpc.RpcInvalidError("Invalid output index %v",
+				out)
+		}
+		return tx.Tx.TxOut[out.OutIndex], nil
+	}
+
+	chain := api.txManager.bm.GetChain()
+	entry, err := chain.FetchUtxoEntry(out)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch utxo")
+	}
+	if entry == nil || entry.IsSpent() {
+		return nil, rpc.RpcNoTxInfoError(&out.Hash)
+	}
+	amount := entry.Amount()
+	if entry.IsCoinBase() && out.OutIndex == 0 {
+		amount += uint64(chain.GetFees(entry.BlockHash()))
+	}
+	txOut := types.NewTxOutput(amount, entry.PkScript())
+	txOut.Asset = entry.Asset()
+	return txOut, nil
+}
+
+// UpdatePsbt adds the outputs spent by the inputs of the partially signed
+// transaction, found in the mempool or in the utxo set, and the passed redeem
+// scripts to the inputs and the outputs paying to them.
+func (api *PublicTxAPI) UpdatePsbt(psbtStr string,
+	redeemScripts *[]string) (interface{}, error) {
+
+	p, err := decodePsbt(psbtStr)
+	if err != nil {
+		return nil, err
+	}
+	scripts := make(map[string][]byte)
+	if redeemScripts != nil {
+		for _, scriptStr := range *redeemScripts {
+			script, err := hex.DecodeString(scriptStr)
+			if err != nil {
+				return nil, rpc.RpcDecodeHexError(scriptStr)
+			}
+			scripts[string(hash.Hash160(script))] = script
+		}
+	}
+	redeemScript := func(pkScript []byte) []byte {
+		class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+			api.txManager.bm.ChainParams())
+		if err != nil || class != txscript.ScriptHashTy {
+			return nil
+		}
+		return scripts[string(addrs[0].ScriptAddress())]
+	}
+
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil {
+			continue
+		}
+		if in.Utxo == nil {
+			utxo, err := api.fetchUtxo(p.UnsignedTx.TxIn[i].PreviousOut)
+			if err != nil {
+				return nil, err
+			}
+			in.Utxo = utxo
+		}
+		if in.RedeemScript == nil {
+			in.RedeemScript = redeemScript(in.Utxo.PkScript)
+		}
+	}
+	for i, out := range p.Outputs {
+		if out.RedeemScript == nil {
+			out.RedeemScript = redeemScript(p.UnsignedTx.TxOut[i].PkScript)
+		}
+	}
+	return encodePsbt(p)
+}
+
+// CombinePsbt merges the signatures and the data of several partially signed
+// copies of the same transaction.
+func (api *PublicTxAPI) CombinePsbt(psbtStrs []string) (interface{}, error) {
+	packets := make([]*psbt.Packet, 0, len(psbtStrs))
+	for _, psbtStr := range psbtStrs {
+		p, err := decodePsbt(psbtStr)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+	}
+	p, err := psbt.Combine(packets...)
+	if err != nil {
+		return nil, rpc.RpcInvalidError(err.Error())
+	}
+	return encodePsbt(p)
+}
+
+// FinalizePsbt builds the signature scripts of the inputs with enough
+// signatures.  Once every input is finalized, the signed transaction is
+// returned unless extract is false.
+func (api *PublicTxAPI) FinalizePsbt(psbtStr string,
+	extract *bool) (interface{}, error) {
+
+	p, err := decodePsbt(psbtStr)
+	if err != nil {
+		return nil, err
+	}
+	params := api.txManager.bm.ChainParams()
+	for i := range p.Inputs {
+		err := p.Finalize(i, params)
+		if err != nil && err != psbt.ErrIncomplete {
+			return nil, rpc.RpcInvalidError("Input %d: %v", i, err)
+		}
+	}
+
+	if p.IsComplete() && (extract == nil || *extract) {
+		tx, err := p.Extract()
+		if err != nil {
+			return nil, rpc.RpcInternalError(err.Error(), "Extract psbt")
+		}
+		mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: tx})
+		if err != nil {
+			return nil, err
+		}
+		return json.OrderedResult{
+			{Key: "hex", Val: mtxHex},
+			{Key: "complete", Val: true},
+		}, nil
+	}
+	encoded, err := encodePsbt(p)
+	if err != nil {
+		return nil, err
+	}
+	return json.OrderedResult{
+		{Key: "psbt", Val: encoded},
+		{Key: "complete", Val: p.IsComplete()},
+	}, nil
+}
+
+// DecodePsbt returns the content of a partially signed transaction, the fee it
+// pays and the number of signatures its inputs are missing.
+func (api *PublicTxAPI) DecodePsbt(psbtStr string) (interface{}, error) {
+	p, err := decodePsbt(psbtStr)
+	if err != nil {
+		return nil, err
+	}
+	return marshal.MarshJsonPsbt(p, api.txManager.bm.ChainParams()), nil
+}
+
 type PrivateTxAPI struct {
 	txManager *TxManager
 }
@@ -999,3 +1426,40 @@ func (api *PrivateTxAPI) TxSign(privkeyStr string, rawTxStr string) (interface{}
 	}
 	return mtxHex, nil
 }
+
+// SignPsbt signs every input of the partially signed transaction the passed
+// key can sign for.
+func (api *PrivateTxAPI) SignPsbt(privkeyStr string, psbtStr string) (interface{}, error) {
+	privkeyByte, err := hex.DecodeString(privkeyStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(privkeyByte) != 32 {
+		return nil, fmt.Errorf("error:%d", len(privkeyByte))
+	}
+	privateKey, _ := ecc.Secp256k1.PrivKeyFromBytes(privkeyByte)
+
+	p, err := decodePsbt(psbtStr)
+	if err != nil {
+		return nil, err
+	}
+	params := api.txManager.bm.ChainParams()
+	signed := 0
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil {
+			continue
+		}
+		err := p.Sign(i, privateKey, params)
+		if err == psbt.ErrNotSigner {
+			continue
+		}
+		if err != nil {
+			return nil, rpc.RpcInvalidError("Input %d: %v", i, err)
+		}
+		signed++
+	}
+	if signed == 0 {
+		return nil, rpc.RpcInvalidError("The key can't sign any input")
+	}
+	return encodePsbt(p)
+}
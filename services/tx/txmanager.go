@@ -1,10 +1,12 @@
 package tx
 
 import (
+	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/config"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
@@ -13,6 +15,7 @@ import (
 	"github.com/Qitmeer/qitmeer/services/common"
 	"github.com/Qitmeer/qitmeer/services/index"
 	"github.com/Qitmeer/qitmeer/services/mempool"
+	"path/filepath"
 	"time"
 )
 
@@ -26,6 +29,9 @@ type TxManager struct {
 	// mempool hold tx that need to be mined into blocks and relayed to other peers.
 	txMemPool *mempool.TxPool
 
+	// fee estimator fed by the mempool and the connected blocks
+	feeEstimator *mempool.FeeEstimator
+
 	// notify
 	ntmgr notify.Notify
 
@@ -34,15 +40,52 @@ type TxManager struct {
 
 	//invalidTx hash->block hash
 	invalidTx map[hash.Hash]*blockdag.HashSet
+
+	// mempool file the transactions are saved to on shutdown and restored
+	// from on startup, empty if they are not persisted
+	mempoolFile string
 }
 
 func (tm *TxManager) Start() error {
 	log.Info("Starting tx manager")
+
+	// Restore the transactions of the mempool saved on shutdown.
+	if tm.mempoolFile != "" {
+		count, err := tm.txMemPool.Load(tm.mempoolFile)
+		if err != nil {
+			log.Error("Failed to load the mempool", "file",
+				tm.mempoolFile, "error", err)
+		} else if count > 0 {
+			log.Info(fmt.Sprintf("Loaded %d transactions from file '%s'",
+				count, tm.mempoolFile))
+		}
+	}
 	return nil
 }
 
 func (tm *TxManager) Stop() error {
 	log.Info("Stopping tx manager")
+
+	// Save the transactions of the mempool to restore them on startup.
+	if tm.mempoolFile != "" {
+		count, err := tm.txMemPool.Save(tm.mempoolFile)
+		if err != nil {
+			log.Error("Failed to save the mempool", "file",
+				tm.mempoolFile, "error", err)
+		} else {
+			log.Info(fmt.Sprintf("Saved %d transactions to file '%s'",
+				count, tm.mempoolFile))
+		}
+	}
+
+	// Save fee estimator state in the database.
+	err := tm.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(dbnamespace.FeeEstimatorKeyName,
+			tm.feeEstimator.Save())
+	})
+	if err != nil {
+		log.Error("Failed to save the fee estimator", "error", err)
+	}
 	return nil
 }
 
@@ -50,20 +93,61 @@ func (tm *TxManager) MemPool() blkmgr.TxPool {
 	return tm.txMemPool
 }
 
+func (tm *TxManager) FeeEstimator() *mempool.FeeEstimator {
+	return tm.feeEstimator
+}
+
+// loadFeeEstimator restores the fee estimator saved in the database when the
+// node was stopped, or creates a new one.
+func loadFeeEstimator(db database.DB) *mempool.FeeEstimator {
+	var feeEstimator *mempool.FeeEstimator
+	db.Update(func(dbTx database.Tx) error {
+		metadata := dbTx.Metadata()
+		feeEstimationData := metadata.Get(dbnamespace.FeeEstimatorKeyName)
+		if feeEstimationData == nil {
+			return nil
+		}
+
+		// Delete it from the database so that we don't try to restore
+		// the same thing again somehow.
+		metadata.Delete(dbnamespace.FeeEstimatorKeyName)
+
+		// If there is an error, log it and make a new fee estimator.
+		var err error
+		feeEstimator, err = mempool.RestoreFeeEstimator(feeEstimationData)
+		if err != nil {
+			log.Error("Failed to restore fee estimator", "error", err)
+		}
+		return nil
+	})
+
+	// If no feeEstimator has been found, create a new one and start over.
+	if feeEstimator == nil {
+		feeEstimator = mempool.NewFeeEstimator(
+			mempool.DefaultEstimateFeeMaxRollback,
+			mempool.DefaultEstimateFeeMinRegisteredBlocks)
+	}
+	return feeEstimator
+}
+
 func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 	addrIndex *index.AddrIndex, cfg *config.Config, ntmgr notify.Notify,
 	sigCache *txscript.SigCache, db database.DB) (*TxManager, error) {
+	feeEstimator := loadFeeEstimator(db)
+
 	// mem-pool
 	txC := mempool.Config{
 		Policy: mempool.Policy{
 			MaxTxVersion:         2,
 			DisableRelayPriority: cfg.NoRelayPriority,
 			AcceptNonStd:         cfg.AcceptNonStd,
+			RejectReplacement:    cfg.RejectReplacement,
 			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
 			MaxOrphanTxs:         cfg.MaxOrphanTxs,
 			MaxOrphanTxSize:      mempool.DefaultMaxOrphanTxSize,
 			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
 			MinRelayTxFee:        types.Amount(cfg.MinTxFee),
+			MaxPoolSize:          int64(cfg.MaxMempool) * 1000000,
 			StandardVerifyFlags: func() (txscript.ScriptFlags, error) {
 				return common.StandardScriptVerifyFlags()
 			},
@@ -80,8 +164,14 @@ func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 		AddrIndex:        addrIndex,
 		BD:               bm.GetChain().BlockDAG(),
 		BC:               bm.GetChain(),
+		FeeEstimator:     feeEstimator,
+		PersistFile:      filepath.Join(cfg.DataDir, mempool.MempoolFilename),
 	}
 	txMemPool := mempool.New(&txC)
 	invalidTx := make(map[hash.Hash]*blockdag.HashSet)
-	return &TxManager{bm, txIndex, addrIndex, txMemPool, ntmgr, db, invalidTx}, nil
+	var mempoolFile string
+	if !cfg.NoPersistMempool {
+		mempoolFile = txC.PersistFile
+	}
+	return &TxManager{bm, txIndex, addrIndex, txMemPool, feeEstimator, ntmgr, db, invalidTx, mempoolFile}, nil
 }
@@ -190,6 +190,18 @@ func gatherChildren(n node, children *[]hash.Hash) {
 	}
 }
 
+// NodeChildren returns the hashes of the nodes referenced by the passed rlp
+// encoded trie node, that is the children which are stored separately.
+func NodeChildren(blob []byte) ([]hash.Hash, error) {
+	n, err := decodeNode(nil, blob, 0)
+	if err != nil {
+		return nil, err
+	}
+	var children []hash.Hash
+	gatherChildren(simplifyNode(n), &children)
+	return children, nil
+}
+
 // simplifyNode traverses the hierarchy of an expanded memory node and discards
 // all the internal caches, returning a node that only contains the raw data.
 func simplifyNode(n node) node {
@@ -68,6 +68,41 @@ func TestMissingRoot(t *testing.T) {
 	}
 }
 
+func TestNodeChildren(t *testing.T) {
+	diskdb := statedb.NewMemDatabase()
+	triedb := NewDatabase(diskdb)
+	trie, _ := New(hash.Hash{}, triedb)
+	for i := 0; i < 100; i++ {
+		updateString(trie, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	root, _ := trie.Commit(nil)
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every stored node is reachable from the root through the children.
+	reachable := make(map[hash.Hash]struct{})
+	var walk func(h hash.Hash)
+	walk = func(h hash.Hash) {
+		reachable[h] = struct{}{}
+		blob, err := diskdb.Get(h[:])
+		if err != nil {
+			t.Fatalf("missing node %x", h)
+		}
+		children, err := NodeChildren(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, child := range children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if len(reachable) != diskdb.Len() {
+		t.Errorf("%d nodes reachable, %d stored", len(reachable), diskdb.Len())
+	}
+}
+
 func TestMissingNodeDisk(t *testing.T)    { testMissingNode(t, false) }
 func TestMissingNodeMemonly(t *testing.T) { testMissingNode(t, true) }
 